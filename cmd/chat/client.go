@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"data-chatter/internal/apiclient"
+)
+
+// newClient creates an API client from the command-line options.
+func newClient(opts *options) *apiclient.Client {
+	return apiclient.New(apiclient.Options{Host: opts.host, Token: opts.token, Timeout: opts.timeout})
+}
+
+// progressEvent is a turn progress event from /llm/message/{id}/events.
+type progressEvent struct {
+	Type       string `json:"type"`
+	Tool       string `json:"tool"`
+	Rows       int    `json:"rows"`
+	DurationMs int64  `json:"duration_ms"`
+	Error      string `json:"error"`
+}
+
+// streamEvents calls onEvent for each progress event of turnID until the
+// turn finishes or ctx is cancelled. It returns once the stream is open, so
+// the caller can post the message without missing early events.
+func streamEvents(ctx context.Context, c *apiclient.Client, turnID string, onEvent func(progressEvent)) (<-chan struct{}, error) {
+	body, err := c.Stream(ctx, "/llm/message/"+turnID+"/events")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event stream: %w", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer body.Close()
+
+		scanner := bufio.NewScanner(body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event progressEvent
+			if json.Unmarshal([]byte(data), &event) != nil {
+				continue
+			}
+			if event.Type == "turn_finished" {
+				return
+			}
+			onEvent(event)
+		}
+	}()
+	return done, nil
+}
@@ -0,0 +1,58 @@
+// Package main provides chat, an interactive terminal client for the
+// data-chatter API. Questions are answered by the server's chat agent, tool
+// progress is streamed while a turn runs, and query results are drawn as
+// ASCII tables.
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"data-chatter/internal/env"
+	"data-chatter/internal/render"
+
+	"github.com/spf13/cobra"
+)
+
+// options holds the command-line flags.
+type options struct {
+	host    string
+	token   string
+	nulls   string
+	timeout time.Duration
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newRootCommand builds the chat command with its flags.
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+
+	cmd := &cobra.Command{
+		Use:           "chat",
+		Short:         "Interactive terminal client for data-chatter",
+		Args:          cobra.NoArgs,
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			nulls, err := render.ParseNullStyle(opts.nulls)
+			if err != nil {
+				return fmt.Errorf("unsupported --nulls %q (use null, empty, or na)", opts.nulls)
+			}
+			return newREPL(newClient(opts), nulls, cmd.InOrStdin(), cmd.OutOrStdout()).run()
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.host, "host", env.Get("DATACHATTER_HOST", "http://localhost:8081"), "API base URL (env DATACHATTER_HOST)")
+	flags.StringVar(&opts.token, "token", os.Getenv("DATACHATTER_TOKEN"), "Bearer token for authenticated servers (env DATACHATTER_TOKEN)")
+	flags.StringVar(&opts.nulls, "nulls", "null", "How NULLs appear in results: null, empty, or na")
+	flags.DurationVar(&opts.timeout, "timeout", 2*time.Minute, "Timeout for each request")
+	return cmd
+}
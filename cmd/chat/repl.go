@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+
+	"data-chatter/internal/apiclient"
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/render"
+)
+
+const prompt = "data-chatter> "
+
+const helpText = `Type a question to ask it, or one of:
+  \schema          list tables
+  \schema <table>  list a table's columns
+  \history         list this session's questions and turn IDs
+  \help            show this help
+  \quit            exit (also \q or Ctrl-D)
+Follow-ups such as "in EUR" reuse the previous answer. Ctrl-C cancels a running turn.
+`
+
+// queryResult is the JSON payload returned by the database_query tool.
+type queryResult struct {
+	Columns  []string                 `json:"columns"`
+	RowCount int                      `json:"row_count"`
+	Data     []map[string]interface{} `json:"data"`
+}
+
+// chatResponse is the /llm/message response.
+type chatResponse struct {
+	TurnID  string `json:"turn_id"`
+	Message string `json:"message"`
+	Results []struct {
+		IsError bool `json:"is_error"`
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+	} `json:"results"`
+	Error *apierror.Error `json:"error"`
+}
+
+// historyEntry is one question asked in the session.
+type historyEntry struct {
+	turnID  string
+	message string
+}
+
+// repl reads questions and backslash commands until EOF or \quit.
+type repl struct {
+	client  *apiclient.Client
+	nulls   render.NullStyle
+	in      *bufio.Scanner
+	out     io.Writer
+	history []historyEntry
+}
+
+// newREPL creates a REPL reading from in and writing to out.
+func newREPL(c *apiclient.Client, nulls render.NullStyle, in io.Reader, out io.Writer) *repl {
+	return &repl{client: c, nulls: nulls, in: bufio.NewScanner(in), out: out}
+}
+
+// run loops until the input ends or the user quits.
+func (r *repl) run() error {
+	fmt.Fprintf(r.out, "Connected to %s. Type \\help for commands.\n", r.client.Host())
+	for {
+		fmt.Fprint(r.out, prompt)
+		if !r.in.Scan() {
+			fmt.Fprintln(r.out)
+			return r.in.Err()
+		}
+
+		line := strings.TrimSpace(r.in.Text())
+		if line == "" {
+			continue
+		}
+		if !strings.HasPrefix(line, `\`) {
+			r.ask(line)
+			continue
+		}
+
+		command, arg, _ := strings.Cut(line, " ")
+		switch command {
+		case `\q`, `\quit`:
+			return nil
+		case `\help`, `\?`:
+			fmt.Fprint(r.out, helpText)
+		case `\schema`:
+			r.schema(strings.TrimSpace(arg))
+		case `\history`:
+			r.printHistory()
+		default:
+			fmt.Fprintf(r.out, "Unknown command %s. Type \\help for commands.\n", command)
+		}
+	}
+}
+
+// ask sends a question, printing tool progress while the turn runs and the
+// answer and result tables once it completes. Ctrl-C cancels the turn.
+func (r *repl) ask(message string) {
+	turnID := newTurnID()
+	request := map[string]string{
+		"message": message,
+		"turn_id": turnID,
+		"nulls":   string(r.nulls),
+	}
+	if len(r.history) > 0 {
+		request["previous_turn_id"] = r.history[len(r.history)-1].turnID
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.cancelOnInterrupt(ctx, turnID)
+
+	streamDone, err := streamEvents(ctx, r.client, turnID, r.printProgress)
+	if err != nil {
+		fmt.Fprintf(r.out, "(progress unavailable: %v)\n", err)
+	}
+
+	var response chatResponse
+	err = r.client.Post(ctx, "/llm/message", request, &response)
+	if err != nil {
+		// A turn rejected before it started never finishes its event stream
+		cancel()
+	}
+	if streamDone != nil {
+		<-streamDone
+	}
+	if err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return
+	}
+
+	r.history = append(r.history, historyEntry{turnID: response.TurnID, message: message})
+	fmt.Fprintf(r.out, "\n%s\n", response.Message)
+	for _, result := range response.Results {
+		if len(result.Content) == 0 {
+			continue
+		}
+		text := result.Content[0].Text
+		var parsed queryResult
+		if !result.IsError && json.Unmarshal([]byte(text), &parsed) == nil && parsed.Columns != nil {
+			fmt.Fprintln(r.out)
+			writeTable(r.out, parsed.Columns, render.Cells(parsed.Columns, parsed.Data, r.nulls))
+			fmt.Fprintf(r.out, "(%d rows)\n", parsed.RowCount)
+		}
+	}
+	if response.Error != nil {
+		fmt.Fprintf(r.out, "Error: %s\n", response.Error.Message)
+	}
+}
+
+// printProgress prints one streamed progress event.
+func (r *repl) printProgress(event progressEvent) {
+	switch event.Type {
+	case "tool_started":
+		fmt.Fprintf(r.out, "  running %s...\n", event.Tool)
+	case "rows_fetched":
+		fmt.Fprintf(r.out, "  %s: %d rows fetched\n", event.Tool, event.Rows)
+	case "tool_finished":
+		if event.Error != "" {
+			fmt.Fprintf(r.out, "  %s failed after %dms: %s\n", event.Tool, event.DurationMs, event.Error)
+		} else {
+			fmt.Fprintf(r.out, "  %s finished in %dms\n", event.Tool, event.DurationMs)
+		}
+	}
+}
+
+// cancelOnInterrupt cancels the running turn on the server when the user
+// presses Ctrl-C, until ctx is done.
+func (r *repl) cancelOnInterrupt(ctx context.Context, turnID string) {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	select {
+	case <-ctx.Done():
+	case <-interrupts:
+		fmt.Fprintln(r.out, "  cancelling...")
+		if err := r.client.Post(context.Background(), "/llm/message/"+turnID+"/cancel", nil, nil); err != nil {
+			fmt.Fprintf(r.out, "  cancel failed: %v\n", err)
+		}
+	}
+}
+
+// schema lists the tables, or the columns of table, using /autocomplete so
+// only names the user may read are shown.
+func (r *repl) schema(table string) {
+	prefix := ""
+	if table != "" {
+		prefix = table + "."
+	}
+
+	var response struct {
+		Suggestions []struct {
+			Kind     string `json:"kind"`
+			Name     string `json:"name"`
+			DataType string `json:"data_type"`
+		} `json:"suggestions"`
+	}
+	path := "/autocomplete?limit=100&prefix=" + url.QueryEscape(prefix)
+	if err := r.client.Get(context.Background(), path, &response); err != nil {
+		fmt.Fprintf(r.out, "Error: %v\n", err)
+		return
+	}
+
+	var rows [][]string
+	for _, suggestion := range response.Suggestions {
+		switch {
+		case table == "" && suggestion.Kind == "table":
+			rows = append(rows, []string{suggestion.Name})
+		case table != "" && suggestion.Kind == "column":
+			rows = append(rows, []string{suggestion.Name, suggestion.DataType})
+		}
+	}
+
+	switch {
+	case table == "":
+		writeTable(r.out, []string{"table"}, rows)
+	case len(rows) == 0:
+		fmt.Fprintf(r.out, "No table named %s.\n", table)
+	default:
+		writeTable(r.out, []string{"column", "type"}, rows)
+	}
+}
+
+// printHistory lists the questions asked so far with their turn IDs.
+func (r *repl) printHistory() {
+	if len(r.history) == 0 {
+		fmt.Fprintln(r.out, "No questions yet.")
+		return
+	}
+	rows := make([][]string, len(r.history))
+	for i, entry := range r.history {
+		rows[i] = []string{fmt.Sprint(i + 1), entry.turnID, entry.message}
+	}
+	writeTable(r.out, []string{"#", "turn", "question"}, rows)
+}
+
+// newTurnID generates a random identifier for a chat turn, so the REPL can
+// subscribe to its progress before posting the message.
+func newTurnID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
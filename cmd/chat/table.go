@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxCellWidth truncates long values so wide tables stay readable.
+const maxCellWidth = 40
+
+// writeTable draws rows under a header as an ASCII table:
+//
+//	+----+-------+
+//	| id | name  |
+//	+----+-------+
+//	| 1  | Alice |
+//	+----+-------+
+func writeTable(w io.Writer, header []string, rows [][]string) {
+	widths := make([]int, len(header))
+	for i, name := range header {
+		widths[i] = utf8.RuneCountInString(name)
+	}
+
+	cells := make([][]string, len(rows))
+	for r, row := range rows {
+		cells[r] = make([]string, len(header))
+		for i := range header {
+			if i < len(row) {
+				cells[r][i] = cellText(row[i])
+			}
+			widths[i] = max(widths[i], utf8.RuneCountInString(cells[r][i]))
+		}
+	}
+
+	border := "+"
+	for _, width := range widths {
+		border += strings.Repeat("-", width+2) + "+"
+	}
+
+	fmt.Fprintln(w, border)
+	writeTableRow(w, header, widths)
+	fmt.Fprintln(w, border)
+	for _, row := range cells {
+		writeTableRow(w, row, widths)
+	}
+	if len(cells) > 0 {
+		fmt.Fprintln(w, border)
+	}
+}
+
+// writeTableRow writes one row padded to the column widths.
+func writeTableRow(w io.Writer, row []string, widths []int) {
+	var b strings.Builder
+	b.WriteString("|")
+	for i, width := range widths {
+		b.WriteString(" ")
+		b.WriteString(row[i])
+		b.WriteString(strings.Repeat(" ", width-utf8.RuneCountInString(row[i])))
+		b.WriteString(" |")
+	}
+	fmt.Fprintln(w, b.String())
+}
+
+// cellText flattens a value onto one line and truncates it to maxCellWidth.
+func cellText(value string) string {
+	value = strings.NewReplacer("\r\n", " ", "\n", " ", "\t", " ").Replace(value)
+	if utf8.RuneCountInString(value) <= maxCellWidth {
+		return value
+	}
+	runes := []rune(value)
+	return string(runes[:maxCellWidth-3]) + "..."
+}
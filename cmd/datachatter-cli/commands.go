@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"data-chatter/internal/apierror"
+
+	"github.com/spf13/cobra"
+)
+
+// queryResult is the JSON payload returned by /db/query and the database_query tool.
+type queryResult struct {
+	Query    string                   `json:"query"`
+	Database string                   `json:"database"`
+	Columns  []string                 `json:"columns"`
+	RowCount int                      `json:"row_count"`
+	Data     []map[string]interface{} `json:"data"`
+}
+
+// toolResult is a tool's result as embedded in a chat response.
+type toolResult struct {
+	IsError bool `json:"is_error"`
+	Content []struct {
+		Text string `json:"text"`
+	} `json:"content"`
+}
+
+// chatResponse is the /llm/message response.
+type chatResponse struct {
+	TurnID  string          `json:"turn_id"`
+	Message string          `json:"message"`
+	Results []toolResult    `json:"results"`
+	Error   *apierror.Error `json:"error"`
+}
+
+// newHealthCommand checks the server's health endpoint.
+func newHealthCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "health",
+		Short: "Check server health",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var response struct {
+				Status   string `json:"status"`
+				Uptime   string `json:"uptime"`
+				Database struct {
+					Status          string `json:"status"`
+					OpenConnections int    `json:"open_connections"`
+					InUse           int    `json:"in_use"`
+				} `json:"database"`
+				LLM struct {
+					Status string `json:"status"`
+				} `json:"llm"`
+			}
+			if err := newClient(opts).Get(cmd.Context(), "/health", &response); err != nil {
+				return err
+			}
+			return output(cmd, opts, response, func(p printer) {
+				p.printf("%s (uptime %s)\n", response.Status, response.Uptime)
+				p.printf("database: %s (%d open, %d in use)\n", response.Database.Status, response.Database.OpenConnections, response.Database.InUse)
+				p.printf("llm: %s\n", response.LLM.Status)
+			})
+		},
+	}
+}
+
+// newToolsCommand lists the tools the server exposes to the LLM.
+func newToolsCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "tools",
+		Short: "List available tools",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var response struct {
+				Data []struct {
+					Name        string `json:"name"`
+					Description string `json:"description"`
+				} `json:"data"`
+			}
+			if err := newClient(opts).Get(cmd.Context(), "/tools", &response); err != nil {
+				return err
+			}
+			return output(cmd, opts, response.Data, func(p printer) {
+				rows := make([][]string, len(response.Data))
+				for i, tool := range response.Data {
+					rows[i] = []string{tool.Name, tool.Description}
+				}
+				p.table([]string{"NAME", "DESCRIPTION"}, rows)
+			})
+		},
+	}
+}
+
+// newQueryCommand runs a SQL SELECT query through /db/query.
+func newQueryCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "query <sql>",
+		Short: "Run a read-only SQL query",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var response queryResult
+			request := map[string]string{"query": strings.Join(args, " "), "nulls": opts.nulls}
+			if err := newClient(opts).Post(cmd.Context(), "/db/query", request, &response); err != nil {
+				return err
+			}
+			return output(cmd, opts, response, func(p printer) {
+				p.queryResult(response)
+			})
+		},
+	}
+}
+
+// newSchemaCommand fetches the schema endpoint.
+func newSchemaCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "schema",
+		Short: "Show database schema information",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var response map[string]interface{}
+			if err := newClient(opts).Get(cmd.Context(), "/db/schema", &response); err != nil {
+				return err
+			}
+			return output(cmd, opts, response, func(p printer) {
+				for _, key := range []string{"message", "note"} {
+					if value, ok := response[key]; ok {
+						p.printf("%v\n", value)
+					}
+				}
+			})
+		},
+	}
+}
+
+// newAskCommand sends a natural-language question to /llm/message.
+func newAskCommand(opts *options) *cobra.Command {
+	var previousTurnID string
+	var deterministic bool
+
+	cmd := &cobra.Command{
+		Use:   "ask <message>",
+		Short: "Ask a question in natural language",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			request := map[string]interface{}{"message": strings.Join(args, " "), "nulls": opts.nulls}
+			if previousTurnID != "" {
+				request["previous_turn_id"] = previousTurnID
+			}
+			if deterministic {
+				request["deterministic"] = true
+			}
+
+			var response chatResponse
+			if err := newClient(opts).Post(cmd.Context(), "/llm/message", request, &response); err != nil {
+				return err
+			}
+			if err := output(cmd, opts, response, func(p printer) {
+				p.chatResponse(response)
+			}); err != nil {
+				return err
+			}
+			if response.Error != nil {
+				return response.Error
+			}
+			for _, result := range response.Results {
+				if result.IsError {
+					return fmt.Errorf("a tool call failed")
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&previousTurnID, "previous-turn", "", "Turn ID of an earlier answer, for follow-ups such as \"in EUR\"")
+	cmd.Flags().BoolVar(&deterministic, "deterministic", false, "Ask in determinism mode, for reproducible answers")
+	return cmd
+}
+
+// restoreReport is the data of the /admin/restore response.
+type restoreReport struct {
+	Conversations int            `json:"conversations"`
+	History       int            `json:"history"`
+	SavedQueries  int            `json:"saved_queries"`
+	Suggestions   int            `json:"suggestions"`
+	OrgContext    int            `json:"org_context"`
+	Notifications int            `json:"notifications"`
+	Audit         int            `json:"audit"`
+	Tables        map[string]int `json:"tables"`
+	Skipped       []string       `json:"skipped"`
+}
+
+// newBackupCommand downloads a backup of the server's own data through
+// /admin/backup.
+func newBackupCommand(opts *options) *cobra.Command {
+	var outputPath string
+
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Back up the server's conversations, saved queries, metadata, and audit log",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := newClient(opts).Download(cmd.Context(), "/admin/backup")
+			if err != nil {
+				return err
+			}
+			if outputPath == "" || outputPath == "-" {
+				_, err := cmd.OutOrStdout().Write(data)
+				return err
+			}
+			if err := os.WriteFile(outputPath, data, 0o600); err != nil {
+				return fmt.Errorf("failed to write backup: %w", err)
+			}
+			fmt.Fprintf(cmd.ErrOrStderr(), "wrote %d bytes to %s\n", len(data), outputPath)
+			return nil
+		},
+	}
+	cmd.Flags().StringVarP(&outputPath, "output", "o", "", "File to write the backup to (default stdout)")
+	return cmd
+}
+
+// newRestoreCommand replaces the server's own data with a backup through
+// /admin/restore.
+func newRestoreCommand(opts *options) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <file>",
+		Short: "Restore the server's data from a backup (- reads stdin)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var data []byte
+			var err error
+			if args[0] == "-" {
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(args[0])
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read backup: %w", err)
+			}
+
+			var response struct {
+				Message string        `json:"message"`
+				Data    restoreReport `json:"data"`
+			}
+			if err := newClient(opts).Upload(cmd.Context(), "/admin/restore", "application/octet-stream", data, &response); err != nil {
+				return err
+			}
+			return output(cmd, opts, response.Data, func(p printer) {
+				report := response.Data
+				p.printf("%s\n", response.Message)
+				p.printf("conversations: %d\nhistory entries: %d\nsaved queries: %d\nsuggestions: %d\norg context versions: %d\nnotification preferences: %d\naudit entries added: %d\n",
+					report.Conversations, report.History, report.SavedQueries, report.Suggestions, report.OrgContext, report.Notifications, report.Audit)
+				for _, table := range slices.Sorted(maps.Keys(report.Tables)) {
+					p.printf("table %s: %d rows\n", table, report.Tables[table])
+				}
+				for _, skipped := range report.Skipped {
+					p.printf("skipped %s\n", skipped)
+				}
+			})
+		},
+	}
+}
+
+// chatResponse prints the answer text followed by each tool result.
+func (p printer) chatResponse(response chatResponse) {
+	p.printf("%s\n", response.Message)
+	if response.TurnID != "" {
+		p.printf("turn: %s\n", response.TurnID)
+	}
+	for _, result := range response.Results {
+		if len(result.Content) == 0 {
+			continue
+		}
+		text := result.Content[0].Text
+		p.printf("\n")
+
+		var parsed queryResult
+		if !result.IsError && json.Unmarshal([]byte(text), &parsed) == nil && parsed.Columns != nil {
+			p.queryResult(parsed)
+			continue
+		}
+		p.printf("%s\n", text)
+	}
+}
@@ -0,0 +1,83 @@
+// Package main provides datachatter-cli, a command-line client for the
+// data-chatter API intended for both interactive use and automation.
+// Every command exits non-zero when the request fails or the server
+// responds with a non-2xx status.
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"data-chatter/internal/apiclient"
+	"data-chatter/internal/env"
+	"data-chatter/internal/render"
+
+	"github.com/spf13/cobra"
+)
+
+// options holds the flags shared by every command.
+type options struct {
+	host    string
+	format  string
+	nulls   string
+	token   string
+	timeout time.Duration
+	verbose bool
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newRootCommand builds the command tree with its persistent flags.
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+
+	root := &cobra.Command{
+		Use:           "datachatter-cli",
+		Short:         "Command-line client for the data-chatter API",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			switch opts.format {
+			case formatText, formatJSON, formatCSV, formatMarkdown:
+			default:
+				return fmt.Errorf("unsupported --format %q (use text, json, csv, or markdown)", opts.format)
+			}
+			nulls, err := render.ParseNullStyle(opts.nulls)
+			if err != nil {
+				return fmt.Errorf("unsupported --nulls %q (use null, empty, or na)", opts.nulls)
+			}
+			opts.nulls = string(nulls)
+			return nil
+		},
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&opts.host, "host", env.Get("DATACHATTER_HOST", "http://localhost:8081"), "API base URL (env DATACHATTER_HOST)")
+	flags.StringVarP(&opts.format, "format", "f", formatText, "Output format: text, json, csv, or markdown")
+	flags.StringVar(&opts.nulls, "nulls", "null", "How NULLs appear in results: null, empty, or na")
+	flags.StringVar(&opts.token, "token", os.Getenv("DATACHATTER_TOKEN"), "Bearer token for authenticated servers (env DATACHATTER_TOKEN)")
+	flags.DurationVar(&opts.timeout, "timeout", 30*time.Second, "Request timeout")
+	flags.BoolVarP(&opts.verbose, "verbose", "v", false, "Log each request and response to stderr")
+
+	root.AddCommand(
+		newHealthCommand(opts),
+		newToolsCommand(opts),
+		newQueryCommand(opts),
+		newSchemaCommand(opts),
+		newAskCommand(opts),
+		newBackupCommand(opts),
+		newRestoreCommand(opts),
+	)
+	return root
+}
+
+// newClient creates an API client from the shared flags.
+func newClient(opts *options) *apiclient.Client {
+	return apiclient.New(apiclient.Options{Host: opts.host, Token: opts.token, Timeout: opts.timeout, Verbose: opts.verbose})
+}
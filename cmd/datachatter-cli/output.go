@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"data-chatter/internal/render"
+
+	"github.com/spf13/cobra"
+)
+
+// Output formats accepted by --format. The csv and markdown formats apply to
+// tables; other output is printed as text.
+const (
+	formatText     = "text"
+	formatJSON     = "json"
+	formatCSV      = "csv"
+	formatMarkdown = "markdown"
+)
+
+// printer writes human-readable output.
+type printer struct {
+	w      io.Writer
+	format string
+	nulls  render.NullStyle
+}
+
+// output writes value as indented JSON in json format, or calls text with a
+// printer otherwise.
+func output(cmd *cobra.Command, opts *options, value interface{}, text func(printer)) error {
+	out := cmd.OutOrStdout()
+	if opts.format == formatJSON {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+	text(printer{w: out, format: opts.format, nulls: render.NullStyle(opts.nulls)})
+	return nil
+}
+
+// printf writes formatted text.
+func (p printer) printf(format string, args ...interface{}) {
+	fmt.Fprintf(p.w, format, args...)
+}
+
+// table writes rows under a header as aligned columns, CSV, or a markdown table.
+func (p printer) table(header []string, rows [][]string) {
+	switch p.format {
+	case formatCSV:
+		render.WriteCSV(p.w, header, rows)
+		return
+	case formatMarkdown:
+		render.WriteMarkdown(p.w, header, rows)
+		return
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.ReplaceAll(strings.Join(row, "\t"), "\n", " "))
+	}
+	tw.Flush()
+}
+
+// queryResult writes a query's rows as a table, followed by the row count
+// in text format.
+func (p printer) queryResult(result queryResult) {
+	rows := render.Cells(result.Columns, result.Data, p.nulls)
+	if p.format == formatText {
+		for _, row := range rows {
+			for i, cell := range row {
+				row[i] = strings.ReplaceAll(cell, "\t", " ")
+			}
+		}
+	}
+	p.table(result.Columns, rows)
+	if p.format == formatText {
+		p.printf("(%d rows)\n", result.RowCount)
+	}
+}
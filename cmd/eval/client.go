@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+
+	"data-chatter/internal/apiclient"
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/eval"
+)
+
+// client is the eval.Pipeline of a data-chatter server.
+type client struct {
+	api *apiclient.Client
+}
+
+// newClient creates a client for the configured host.
+func newClient(opts *options) *client {
+	return &client{api: apiclient.New(apiclient.Options{Host: opts.host, Token: opts.token, Timeout: opts.timeout})}
+}
+
+// queryResult is the JSON payload returned by /db/query and the database
+// query tools.
+type queryResult struct {
+	Query   string                   `json:"query"`
+	Columns []string                 `json:"columns"`
+	Data    []map[string]interface{} `json:"data"`
+}
+
+// result converts the payload to an eval.Result.
+func (q queryResult) result() eval.Result {
+	result := eval.Result{SQL: q.Query, Columns: q.Columns, Rows: make([][]interface{}, len(q.Data))}
+	for i, record := range q.Data {
+		row := make([]interface{}, len(q.Columns))
+		for j, column := range q.Columns {
+			row[j] = record[column]
+		}
+		result.Rows[i] = row
+	}
+	return result
+}
+
+// Ask sends question to /llm/message in determinism mode, skipping the
+// answer cache, and returns the query results of its tool calls. Failed
+// tool calls and results that are not tables, such as charts, are left
+// out.
+func (c *client) Ask(ctx context.Context, question string) (eval.Answer, error) {
+	request := map[string]interface{}{"message": question, "deterministic": true, "no_cache": true}
+	var response struct {
+		Message string          `json:"message"`
+		Error   *apierror.Error `json:"error"`
+		Results []struct {
+			IsError bool `json:"is_error"`
+			Content []struct {
+				Text string `json:"text"`
+			} `json:"content"`
+		} `json:"results"`
+	}
+	if err := c.api.Post(ctx, "/llm/message", request, &response); err != nil {
+		return eval.Answer{}, err
+	}
+	if response.Error != nil {
+		return eval.Answer{}, response.Error
+	}
+
+	answer := eval.Answer{Message: response.Message}
+	for _, toolResult := range response.Results {
+		if toolResult.IsError || len(toolResult.Content) == 0 {
+			continue
+		}
+		var payload queryResult
+		if json.Unmarshal([]byte(toolResult.Content[0].Text), &payload) != nil || payload.Columns == nil {
+			continue
+		}
+		answer.Results = append(answer.Results, payload.result())
+	}
+	return answer, nil
+}
+
+// Query runs sql through /db/query.
+func (c *client) Query(ctx context.Context, sql string) (eval.Result, error) {
+	var response queryResult
+	if err := c.api.Post(ctx, "/db/query", map[string]string{"query": sql}, &response); err != nil {
+		return eval.Result{}, err
+	}
+	return response.result(), nil
+}
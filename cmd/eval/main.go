@@ -0,0 +1,132 @@
+// Package main provides eval, which runs a golden-query suite against a
+// data-chatter server and reports how accurately its chat agent answers.
+// Each question is asked through /llm/message, so the whole pipeline is
+// evaluated: prompt, model, tools, and access rules. The command exits
+// non-zero when accuracy is below --min-accuracy or, with --baseline, when
+// a case that passed in the baseline run no longer does.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"data-chatter/internal/env"
+	"data-chatter/internal/eval"
+
+	"github.com/spf13/cobra"
+)
+
+// options holds the command-line flags.
+type options struct {
+	host        string
+	token       string
+	timeout     time.Duration
+	parallel    int
+	run         string
+	format      string
+	output      string
+	baseline    string
+	minAccuracy float64
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// newRootCommand builds the eval command with its flags.
+func newRootCommand() *cobra.Command {
+	opts := &options{}
+
+	cmd := &cobra.Command{
+		Use:           "eval <suite.yaml|suite.json>",
+		Short:         "Run a golden-query suite against data-chatter and report its accuracy",
+		Args:          cobra.ExactArgs(1),
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return run(cmd, opts, args[0])
+		},
+	}
+
+	flags := cmd.Flags()
+	flags.StringVar(&opts.host, "host", env.Get("DATACHATTER_HOST", "http://localhost:8081"), "API base URL (env DATACHATTER_HOST)")
+	flags.StringVar(&opts.token, "token", os.Getenv("DATACHATTER_TOKEN"), "Bearer token for authenticated servers (env DATACHATTER_TOKEN)")
+	flags.DurationVar(&opts.timeout, "timeout", 2*time.Minute, "Timeout for each request")
+	flags.IntVarP(&opts.parallel, "parallel", "p", 1, "Number of cases run at once")
+	flags.StringVar(&opts.run, "run", "", "Only run cases whose ID matches this regular expression")
+	flags.StringVarP(&opts.format, "format", "f", "text", "Output format: text or json")
+	flags.StringVarP(&opts.output, "output", "o", "", "Also save the report as JSON to this file, e.g. to use as a later --baseline")
+	flags.StringVar(&opts.baseline, "baseline", "", "JSON report of an earlier run; fail if a case that passed there fails now")
+	flags.Float64Var(&opts.minAccuracy, "min-accuracy", 0, "Fail if fewer than this fraction of cases pass, from 0 to 1")
+	return cmd
+}
+
+// run loads the suite, runs it, and writes the report.
+func run(cmd *cobra.Command, opts *options, path string) error {
+	if opts.format != "text" && opts.format != "json" {
+		return fmt.Errorf("unsupported --format %q (use text or json)", opts.format)
+	}
+	suite, err := eval.Load(path)
+	if err != nil {
+		return err
+	}
+	if opts.run != "" {
+		pattern, err := regexp.Compile(opts.run)
+		if err != nil {
+			return fmt.Errorf("invalid --run: %w", err)
+		}
+		var cases []eval.Case
+		for _, c := range suite.Cases {
+			if pattern.MatchString(c.ID) {
+				cases = append(cases, c)
+			}
+		}
+		suite.Cases = cases
+	}
+	if len(suite.Cases) == 0 {
+		return fmt.Errorf("%s has no cases to run", path)
+	}
+	var baseline *eval.Report
+	if opts.baseline != "" {
+		if baseline, err = eval.LoadReport(opts.baseline); err != nil {
+			return err
+		}
+	}
+
+	report := eval.Run(cmd.Context(), suite, newClient(opts), opts.parallel)
+
+	out := cmd.OutOrStdout()
+	if opts.format == "json" {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	} else {
+		err = eval.WriteText(out, report)
+	}
+	if err != nil {
+		return err
+	}
+	if opts.output != "" {
+		data, _ := json.MarshalIndent(report, "", "  ")
+		if err := os.WriteFile(opts.output, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("failed to save report: %w", err)
+		}
+	}
+
+	if baseline != nil {
+		if regressed := eval.Regressions(baseline, report); len(regressed) > 0 {
+			return fmt.Errorf("%d cases regressed from the baseline: %s", len(regressed), strings.Join(regressed, ", "))
+		}
+	}
+	if report.Accuracy < opts.minAccuracy {
+		return fmt.Errorf("accuracy %.1f%% is below the minimum of %.1f%%", report.Accuracy*100, opts.minAccuracy*100)
+	}
+	return nil
+}
@@ -4,78 +4,644 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"os/signal"
-	"syscall"
+	"slices"
+	"strings"
 	"time"
 
+	"data-chatter/internal/answercache"
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/apiversion"
+	"data-chatter/internal/artifacts"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/calendar"
+	"data-chatter/internal/catalog"
+	"data-chatter/internal/cluster"
+	"data-chatter/internal/config"
+	"data-chatter/internal/conversation"
 	"data-chatter/internal/database"
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/digest"
+	"data-chatter/internal/encryption"
+	"data-chatter/internal/external"
+	"data-chatter/internal/feedback"
+	"data-chatter/internal/grpcapi"
 	"data-chatter/internal/handlers"
+	"data-chatter/internal/history"
+	"data-chatter/internal/jobs"
+	"data-chatter/internal/knowledge"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/logging"
+	"data-chatter/internal/metrics"
+	"data-chatter/internal/middleware"
+	"data-chatter/internal/notify"
+	"data-chatter/internal/orgcontext"
+	"data-chatter/internal/quality"
+	"data-chatter/internal/querycache"
+	"data-chatter/internal/rbac"
+	"data-chatter/internal/redact"
+	"data-chatter/internal/redis"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/reveal"
+	"data-chatter/internal/savedqueries"
+	"data-chatter/internal/semantic"
+	"data-chatter/internal/servertls"
+	"data-chatter/internal/service"
+	"data-chatter/internal/snapshots"
+	"data-chatter/internal/suggestions"
+	"data-chatter/internal/telemetry"
+	"data-chatter/internal/tenant"
+	"data-chatter/internal/version"
+	"data-chatter/web"
 
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 // main initializes the HTTP server with database connection, CORS middleware,
 // and graceful shutdown handling.
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Printf("Warning: Could not load .env file: %v", err)
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML config file; environment variables override its values (env CONFIG_FILE)")
+	daemon := flag.Bool("daemon", false, "log for a service manager: syslog priority prefixes and no timestamps (same as LOG_FORMAT=journal)")
+	serviceName := flag.String("service-name", "data-chatter", "name of the Windows service to run as when started by the service control manager")
+	flag.Parse()
+
+	envErr := godotenv.Load()
+	applied, configErr := applyConfigFile(*configPath)
+	demo, demoErr := config.ApplyDemo()
+	if *daemon {
+		os.Setenv("LOG_FORMAT", "journal")
+	}
+	redact.FromEnv()
+	logging.Setup()
+	build := version.Get()
+	slog.Info("data-chatter starting", "version", build.Version, "commit", build.Commit, "build_time", build.BuildTime, "go_version", build.GoVersion)
+	if envErr != nil {
+		slog.Warn("could not load .env file", "error", envErr)
+	}
+	if configErr != nil {
+		fatal("failed to load config file", configErr)
+	}
+	if *configPath != "" {
+		slog.Info("loaded config file", "path", *configPath, "applied", applied)
+	}
+	if demoErr != nil {
+		fatal("failed to apply demo mode", demoErr)
+	}
+	if config.DemoMode() {
+		slog.Warn("demo mode: read-only sample database, strict rate limits, nothing persisted, admin endpoints disabled", "applied", demo)
+	}
+
+	if err := service.Run(*serviceName, run); err != nil {
+		fatal("server failed", err)
+	}
+	slog.Info("server exited")
+}
+
+// run serves the HTTP and gRPC APIs until ctx is cancelled, calling ready
+// once both are listening, then shuts them down gracefully.
+func run(ctx context.Context, ready func()) error {
+	shutdownTracing, err := telemetry.Setup(context.Background())
+	if err != nil {
+		fatal("failed to configure tracing", err)
 	}
 
 	dbConfig := database.DefaultConfig()
 	dbConn, err := database.NewConnection(dbConfig)
 	if err != nil {
-		log.Fatalf("Failed to connect to database: %v", err)
+		fatal("failed to connect to database", err)
 	}
 	defer dbConn.Close()
 
-	handlers.InitializeToolEngine(dbConn)
+	if err := handlers.InitializeToolEngine(dbConn); err != nil {
+		fatal("failed to register tools", err)
+	}
+
+	authConfig, err := auth.ConfigFromEnv()
+	if err != nil {
+		fatal("failed to configure authentication", err)
+	}
+
+	auditLog, err := audit.NewRecorderFromEnv()
+	if err != nil {
+		fatal("failed to open audit log", err)
+	}
+	handlers.InitializeAuditLog(auditLog)
+
+	accessLog, err := middleware.AccessLogConfigFromEnv()
+	if err != nil {
+		fatal("failed to configure access log", err)
+	}
+
+	policy, err := rbac.LoadPolicyFromEnv()
+	if err != nil {
+		fatal("failed to load access policy", err)
+	}
+	authorizer := rbac.NewAuthorizer(policy, dbConn)
+	handlers.InitializeAccessControl(authorizer)
+
+	dbConn.Masker, err = database.MaskerFromEnv(authorizer.MayUnmask)
+	if err != nil {
+		fatal("failed to configure PII masking", err)
+	}
+
+	// With REDIS_ADDR, replicas share conversations, rate limits, schemas,
+	// and cached query results
+	shared := redis.NewFromEnv()
+	if shared != nil {
+		if err := shared.Ping(context.Background()); err != nil {
+			fatal("failed to reach shared state redis", err)
+		}
+		slog.Info("sharing state in redis", "addr", shared.Addr())
+		dbConn.SharedSchema = shared
+		handlers.InitializeConversations(conversation.NewSharedStore(shared))
+	}
+
+	dbConn.ResultCache, err = querycache.NewFromEnv(shared)
+	if err != nil {
+		fatal("failed to configure query cache", err)
+	}
+	handlers.InitializeQueryCache(dbConn.ResultCache)
+
+	dbConn.SlowQueries = database.NewSlowQueryLogFromEnv()
+	handlers.InitializeSlowQueries(dbConn.SlowQueries)
+
+	// With TENANTS_FILE each tenant's requests go to its own database
+	tenantConfigs, err := tenant.ConfigsFromEnv()
+	if err != nil {
+		fatal("failed to load tenants", err)
+	}
+	var tenants *tenant.Registry
+	if tenantConfigs != nil {
+		tenants, err = tenant.Open(tenantConfigs, dbConn, auditLog)
+		if err != nil {
+			fatal("failed to connect to tenant databases", err)
+		}
+		defer tenants.Close()
+	}
+
+	// Chat sessions may switch to the databases in DATABASES_FILE
+	databaseConfigs, err := catalog.ConfigsFromEnv()
+	if err != nil {
+		fatal("failed to load databases", err)
+	}
+	if databaseConfigs != nil {
+		if tenants != nil {
+			slog.Warn("named databases are not available in multi-tenant mode")
+		}
+		databases, err := catalog.Open(databaseConfigs, dbConn)
+		if err != nil {
+			fatal("failed to connect to named databases", err)
+		}
+		defer databases.Close()
+		handlers.InitializeDatabases(databases)
+	}
+
+	orgContext, err := orgcontext.NewStoreFromEnv()
+	if err != nil {
+		fatal("failed to load org context", err)
+	}
+	handlers.InitializeOrgContext(orgContext)
+
+	dictionaryStore, err := dictionary.NewStore(context.Background(), dbConn)
+	if err != nil {
+		slog.Warn("data dictionary disabled", "error", err)
+	}
+	handlers.InitializeDictionary(dictionaryStore)
+
+	notes, err := dictionary.NotesFromEnv()
+	if err != nil {
+		fatal("failed to load schema notes", err)
+	}
+	handlers.InitializeSchemaNotes(notes)
+
+	calendars, err := calendar.FromEnv()
+	if err != nil {
+		fatal("failed to load business calendars", err)
+	}
+	handlers.InitializeCalendars(calendars)
+
+	rules, err := dictionary.RulesFromEnv()
+	if err != nil {
+		fatal("failed to load column rules", err)
+	}
+	handlers.InitializeColumnRules(rules)
+
+	qualityStore, err := quality.NewStore(context.Background(), dbConn)
+	if err != nil {
+		slog.Warn("data-quality rules disabled", "error", err)
+	}
+	handlers.InitializeQuality(qualityStore)
+
+	embedder, err := semantic.EmbedderFromEnv()
+	if err != nil {
+		fatal("failed to configure embeddings", err)
+	}
+
+	// Text columns in SEMANTIC_COLUMNS are embedded for semantic_search
+	semanticConfig, err := semantic.ConfigFromEnv()
+	if err != nil {
+		fatal("failed to configure semantic search", err)
+	}
+	var semanticIndex *semantic.Index
+	if semanticConfig != nil {
+		if semanticIndex, err = semantic.NewIndex(context.Background(), dbConn, embedder, semanticConfig.Columns); err != nil {
+			slog.Warn("semantic search disabled", "error", err)
+		}
+	}
+	handlers.InitializeSemanticSearch(semanticIndex)
+
+	documents, err := knowledge.NewStore(context.Background(), dbConn, embedder)
+	if err != nil {
+		slog.Warn("business documentation disabled", "error", err)
+	} else {
+		// Chunks embedded with another model are not retrieved until they
+		// are embedded again
+		go func() {
+			if err := documents.Reembed(context.Background()); err != nil {
+				slog.Warn("failed to re-embed documentation", "error", err)
+			}
+		}()
+	}
+	handlers.InitializeDocuments(documents)
+
+	externalStore, err := external.NewStore(context.Background(), dbConn)
+	if err != nil {
+		slog.Warn("external tables disabled", "error", err)
+	} else {
+		dbConn.Loader = externalStore
+	}
+	uploadTTL, err := external.UploadTTLFromEnv()
+	if err != nil {
+		fatal("failed to configure uploads", err)
+	}
+	if externalStore != nil {
+		externalStore.SetUploadTTL(uploadTTL)
+	}
+	handlers.InitializeExternalTables(externalStore)
+
+	snapshotPolicy, err := snapshots.PolicyFromEnv()
+	if err != nil {
+		fatal("failed to configure snapshots", err)
+	}
+	snapshotStore, err := snapshots.NewStore(context.Background(), dbConn, snapshotPolicy)
+	if err != nil {
+		slog.Warn("snapshots disabled", "error", err)
+	}
+	handlers.InitializeSnapshots(snapshotStore)
+
+	apiSources, err := external.APISourcesFromEnv()
+	if err != nil {
+		fatal("failed to load API sources", err)
+	}
+	if externalStore != nil {
+		if err := externalStore.SyncAPISources(context.Background(), apiSources); err != nil {
+			fatal("failed to set up API sources", err)
+		}
+	} else if len(apiSources) > 0 {
+		slog.Warn("API sources disabled: they need external tables")
+	}
+
+	suggestionStore, err := suggestions.NewStoreFromEnv()
+	if err != nil {
+		fatal("failed to load suggestions", err)
+	}
+	handlers.InitializeSuggestions(suggestionStore)
+
+	// Stored prompts and results are encrypted when keys are configured
+	historyKeys, err := encryption.KeyringFromEnv(context.Background())
+	if err != nil {
+		fatal("failed to load history encryption keys", err)
+	}
+
+	// Tenants may save their own LLM API keys, stored only encrypted
+	var tenantProviders *tenant.ProviderStore
+	if tenants != nil {
+		tenantProviders, err = tenant.NewProviderStore(context.Background(), dbConn, historyKeys)
+		if err != nil {
+			slog.Warn("tenant provider settings disabled", "error", err)
+		} else {
+			tenants.UseProviders(tenantProviders)
+			handlers.InitializeTenantProviders(tenantProviders)
+		}
+	}
+
+	handlers.InitializeBackups(dbConn, historyKeys)
+
+	queryHistory, err := history.NewStoreFromEnv(historyKeys)
+	if err != nil {
+		fatal("failed to load query history", err)
+	}
+	handlers.InitializeHistory(queryHistory)
+
+	artifactStore, err := artifacts.NewStoreFromEnv(historyKeys)
+	if err != nil {
+		fatal("failed to configure artifact storage", err)
+	}
+	handlers.InitializeArtifacts(artifactStore)
+
+	savedQueryStore, err := savedqueries.NewStoreFromEnv()
+	if err != nil {
+		fatal("failed to load saved queries", err)
+	}
+	handlers.InitializeSavedQueries(savedQueryStore)
+
+	notificationPrefs, err := notify.NewStoreFromEnv()
+	if err != nil {
+		fatal("failed to load notification preferences", err)
+	}
+	handlers.InitializeNotifications(notificationPrefs)
+
+	// Alerts go to each user's channels, held through their quiet hours
+	sender := notify.NewSenderFromEnv(notificationPrefs)
+	sender.Start(ctx)
+
+	metricStore, err := metrics.NewStore(context.Background(), dbConn, sender)
+	if err != nil {
+		slog.Warn("scheduled metrics disabled", "error", err)
+	}
+	handlers.InitializeMetrics(metricStore)
+
+	digestStore, err := digest.NewStore(context.Background(), dbConn, sender, historyKeys)
+	if err != nil {
+		slog.Warn("usage digest disabled", "error", err)
+	}
+	handlers.InitializeDigest(digestStore)
+
+	feedbackStore, err := feedback.NewStore(context.Background(), dbConn, historyKeys)
+	if err != nil {
+		slog.Warn("answer feedback disabled", "error", err)
+	}
+	handlers.InitializeFeedback(feedbackStore)
+
+	digestConfig, err := digest.ConfigFromEnv()
+	if err != nil {
+		fatal("failed to configure usage digest", err)
+	}
+
+	revealTTL, err := reveal.TTLFromEnv()
+	if err != nil {
+		fatal("failed to configure reveal requests", err)
+	}
+	revealStore, err := reveal.NewStore(context.Background(), dbConn, sender, revealTTL)
+	if err != nil {
+		slog.Warn("reveal requests disabled", "error", err)
+	}
+	handlers.InitializeReveal(revealStore)
+
+	jobManager := jobs.NewManagerFromEnv()
+	handlers.InitializeJobs(jobManager, dbConn)
+	if tenants != nil {
+		jobManager.RouteTenants(tenants.Route)
+	}
+	if dbConfig.SQLiteReadOnly {
+		slog.Warn("job persistence disabled: the database is read-only")
+	} else if jobStore, err := jobs.NewStore(context.Background(), dbConn, historyKeys); err != nil {
+		slog.Warn("job persistence disabled", "error", err)
+	} else {
+		jobManager.Persist(jobStore)
+	}
+
+	// Periodic tasks fire on one replica at a time when the database can
+	// hold their schedules
+	scheduler := cluster.NewLocalScheduler()
+	if !dbConfig.SQLiteReadOnly {
+		if shared, err := cluster.NewScheduler(context.Background(), dbConn); err != nil {
+			slog.Warn("cluster scheduling disabled, periodic tasks run on every replica", "error", err)
+		} else {
+			scheduler = shared
+		}
+	}
+	scheduler.Every("prune_jobs", time.Minute, jobManager.Prune)
+	// Evaluations and samples are stored in the database, so a read-only
+	// one cannot take them
+	if qualityStore != nil && !dbConfig.SQLiteReadOnly {
+		scheduler.Every("evaluate_quality", quality.IntervalFromEnv(), qualityStore.Evaluate)
+	}
+	if metricStore != nil && !dbConfig.SQLiteReadOnly {
+		scheduler.Every("sample_metrics", metrics.MinInterval, metricStore.Sample)
+	}
+	if semanticIndex != nil {
+		scheduler.Every("refresh_semantic_index", semanticConfig.Interval, semanticIndex.Refresh)
+	}
+	if externalStore != nil {
+		scheduler.Every("prune_uploads", 10*time.Minute, externalStore.PruneUploads)
+	}
+	if snapshotStore != nil {
+		scheduler.Every("prune_snapshots", 10*time.Minute, snapshotStore.Prune)
+	}
+	if revealStore != nil {
+		scheduler.Every("prune_reveal_requests", time.Hour, revealStore.Prune)
+	}
+	if digestStore != nil && historyKeys.Enabled() {
+		scheduler.Every("reseal_turn_stats", time.Hour, digestStore.Reseal)
+	}
+	if feedbackStore != nil && historyKeys.Enabled() {
+		scheduler.Every("reseal_feedback", time.Hour, feedbackStore.Reseal)
+	}
+	if tenantProviders != nil {
+		scheduler.Every("reseal_tenant_providers", time.Hour, tenantProviders.Reseal)
+	}
+	if digestStore != nil {
+		scheduler.Every("rollup_turn_stats", time.Hour, digestStore.Rollup)
+	}
+	if digestStore != nil && digestConfig != nil {
+		scheduler.Daily("send_digest", digestConfig.At, func(ctx context.Context) error {
+			return digestStore.Send(ctx, digestConfig.Recipients)
+		})
+	}
+	scheduler.Start(ctx)
+
+	answers, err := answercache.NewFromEnv()
+	if err != nil {
+		fatal("failed to configure answer cache", err)
+	}
+	handlers.InitializeAnswerCache(answers)
+
+	if _, err := llm.ProviderConfigFromEnv(); err != nil {
+		fatal("failed to configure LLM provider", err)
+	}
+	credentials := llm.NewCredentialMonitor(llm.NewAnthropicClient(dbConn), 0)
+	credentials.Start(context.Background())
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8081"
 	}
+	tlsConfig, err := servertls.ConfigFromEnv()
+	if err != nil {
+		fatal("failed to configure TLS", err)
+	}
 
+	// Uploads, documents, bundles, and restores check their own, larger body limits
+	requestLimits, err := middleware.RequestLimitsConfigFromEnv()
+	if err != nil {
+		fatal("failed to configure request limits", err)
+	}
+	limitRequests := middleware.RequestLimits(requestLimits, "/data/upload", "/admin/docs", "/admin/config/import", "/admin/restore")
+
+	mux := setupRoutes(dbConn, credentials, authConfig, shared)
 	server := &http.Server{
 		Addr:         ":" + port,
-		Handler:      corsMiddleware(setupRoutes(dbConn)),
+		Handler:      tlsConfig.HSTS(otelhttp.NewHandler(requestid.Middleware(middleware.LoggingMiddleware(apiversion.Middleware(limitRequests(corsMiddleware(auth.Middleware(authConfig)(tenant.Middleware(tenants)(middleware.AccessLog(auditLog, accessLog)(middleware.LocaleMiddleware(middleware.CacheControlMiddleware(mux)))))))))), "http.server", otelhttp.WithSpanNameFormatter(routeSpanName(mux)))),
 		ReadTimeout:  15 * time.Second,
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
 
+	if tlsConfig.Enabled() {
+		if server.TLSConfig, err = tlsConfig.TLSConfig(); err != nil {
+			fatal("failed to configure TLS", err)
+		}
+	}
+
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		fatal("server failed to start", err)
+	}
 	go func() {
-		fmt.Printf("Server starting on :%s\n", port)
-		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+		slog.Info("server starting", "port", port, "tls", tlsConfig.Enabled(), "version", version.Version)
+		serve := server.Serve
+		if server.TLSConfig != nil {
+			// Certificates come from TLSConfig, and HTTP/2 is offered
+			serve = func(listener net.Listener) error { return server.ServeTLS(listener, "", "") }
+		}
+		if err := serve(listener); err != nil && err != http.ErrServerClosed {
+			fatal("server failed", err)
 		}
 	}()
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	fmt.Println("Server shutting down...")
+	// Plain HTTP is redirected to HTTPS when HTTP_REDIRECT_PORT is set
+	redirectServer := tlsConfig.RedirectServer(port)
+	if redirectServer != nil {
+		listener, err := net.Listen("tcp", redirectServer.Addr)
+		if err != nil {
+			fatal("failed to listen for HTTP redirects", err)
+		}
+		go func() {
+			slog.Info("http redirect server starting", "port", tlsConfig.RedirectPort)
+			if err := redirectServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+				fatal("http redirect server failed", err)
+			}
+		}()
+	}
+
+	// The gRPC API shares the REST routes for chat turns; GRPC_PORT=0 disables it
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9090"
+	}
+	grpcServer := grpcapi.NewServer(authConfig, tenants, handlers.NewGRPCService(mux))
+	if grpcPort != "0" {
+		listener, err := net.Listen("tcp", ":"+grpcPort)
+		if err != nil {
+			fatal("failed to listen for gRPC", err)
+		}
+		go func() {
+			slog.Info("grpc server starting", "port", grpcPort)
+			if err := grpcServer.Serve(listener); err != nil {
+				fatal("grpc server failed", err)
+			}
+		}()
+	}
+
+	ready()
+	<-ctx.Done()
+	slog.Info("server shutting down")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("server forced to shutdown: %w", err)
+	}
+	if redirectServer != nil {
+		redirectServer.Shutdown(shutdownCtx)
+	}
+	grpcServer.GracefulStop()
+	if err := jobManager.Close(shutdownCtx); err != nil {
+		slog.Error("failed to release jobs", "error", err)
+	}
+	if err := shutdownTracing(shutdownCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
 	}
+	return nil
+}
+
+// applyConfigFile loads the config file at path, if any, after .env so that
+// it only fills in settings the environment leaves unset. It returns the
+// environment variables the file set.
+func applyConfigFile(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	return file.Apply()
+}
+
+// fatal logs a startup or shutdown failure and exits.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// demoDisabled refuses requests to endpoints that change the server for
+// everyone, which a public playground in demo mode must not allow.
+func demoDisabled(http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.Write(w, r, http.StatusForbidden, "Forbidden", apierror.New(apierror.Forbidden, "This endpoint is disabled in demo mode"))
+	})
+}
 
-	fmt.Println("Server exited")
+// authenticatedOnly refuses requests to endpoints too dangerous to leave
+// open to anonymous callers when authentication is disabled, where the
+// admin role check lets every request through.
+func authenticatedOnly(config *auth.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if config.Enabled() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apierror.Write(w, r, http.StatusForbidden, "Forbidden", apierror.New(apierror.Forbidden, "This endpoint requires authentication to be enabled"))
+		})
+	}
 }
 
 // corsMiddleware provides Cross-Origin Resource Sharing support for web clients.
-// It sets appropriate headers and handles preflight OPTIONS requests.
+// It sets appropriate headers and handles preflight OPTIONS requests. Origins
+// come from CORS_ALLOWED_ORIGINS, a comma-separated list defaulting to "*";
+// requests from other origins get no Access-Control-Allow-Origin header.
 func corsMiddleware(next http.Handler) http.Handler {
+	origins := os.Getenv("CORS_ALLOWED_ORIGINS")
+	if origins == "" {
+		origins = "*"
+	}
+	allowed := strings.Split(origins, ",")
+	for i := range allowed {
+		allowed[i] = strings.TrimSpace(allowed[i])
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
+		if slices.Contains(allowed, "*") {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		} else {
+			w.Header().Add("Vary", "Origin")
+			if origin := r.Header.Get("Origin"); origin != "" && slices.Contains(allowed, origin) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			}
+		}
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID, Cache-Control, API-Version")
+		w.Header().Set("Access-Control-Expose-Headers", "Retry-After, X-Request-ID, API-Version, API-Supported-Versions")
 		w.Header().Set("Access-Control-Max-Age", "86400")
 
 		if r.Method == "OPTIONS" {
@@ -87,23 +653,133 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// routeSpanName names server spans after the matched route pattern, e.g.
+// "POST /llm/message/{id}/cancel", so span names do not contain IDs. Versioned
+// paths are named after the route they are an alias of.
+func routeSpanName(mux *http.ServeMux) func(string, *http.Request) string {
+	return func(_ string, r *http.Request) string {
+		if _, pattern := mux.Handler(apiversion.Unversioned(r)); pattern != "" {
+			return r.Method + " " + pattern
+		}
+		return r.Method
+	}
+}
+
 // setupRoutes configures all HTTP endpoints for the application.
-// Returns a ServeMux with routes for health checks, LLM integration,
-// database access, and tool execution.
-func setupRoutes(dbConn *database.Connection) *http.ServeMux {
+// Returns a ServeMux with routes for health and readiness checks, LLM integration,
+// database access, and tool execution. The LLM and direct query endpoints
+// are rate limited per client, each with its own buckets, kept in shared
+// when it is not nil so that replicas enforce one limit. Admin endpoints
+// require the admin role when authentication is enabled, and a tenant's
+// provider settings the tenant_admin role; in demo mode both are disabled.
+// The web UI is served at /ui/.
+// Routes are registered unversioned; apiversion.Middleware serves each
+// under /v1/ as well.
+func setupRoutes(dbConn *database.Connection, credentials *llm.CredentialMonitor, authConfig *auth.Config, shared *redis.Client) *http.ServeMux {
 	mux := http.NewServeMux()
 
 	dbHandler := handlers.NewDatabaseHandler(dbConn)
 	llmHandler := handlers.NewLLMHandler(dbConn)
+	readinessHandler := handlers.NewReadinessHandler(dbConn, credentials)
+	autocompleteHandler := handlers.NewAutocompleteHandler(dbConn)
+
+	rateLimit := middleware.RateLimitConfigFromEnv()
+	llmLimiter := middleware.NewSharedRateLimiter(rateLimit, shared, "llm")
+	dbLimiter := middleware.NewSharedRateLimiter(rateLimit, shared, "db")
+	handlers.InitializeBatchLimiter(llmLimiter)
+	adminOnly := auth.RequireRole(authConfig, "admin")
+	tenantAdminOnly := auth.RequireRole(authConfig, "tenant_admin")
+	if config.DemoMode() {
+		adminOnly, tenantAdminOnly = demoDisabled, demoDisabled
+	}
 
-	mux.HandleFunc("/health", handlers.HealthHandler)
-	mux.HandleFunc("/llm/message", llmHandler.ProcessMessageHandler)
-	mux.HandleFunc("/db/query", dbHandler.QueryHandler)
-	mux.HandleFunc("/db/schema", dbHandler.SchemaHandler)
+	mux.HandleFunc("/health", readinessHandler.HealthHandler)
+	mux.HandleFunc("/version", handlers.VersionHandler)
+	mux.HandleFunc("/readyz", readinessHandler.ReadyzHandler)
+	mux.Handle("/llm/message", llmLimiter.LimitFunc(llmHandler.ProcessMessageHandler))
+	mux.HandleFunc("/llm/messages/batch", llmHandler.BatchMessageHandler) // Limited per question
+	mux.HandleFunc("/llm/message/{id}/events", handlers.TurnEventsHandler)
+	mux.HandleFunc("/llm/message/{id}/cancel", llmHandler.CancelTurnHandler)
+	mux.Handle("/llm/rerun", llmLimiter.LimitFunc(llmHandler.RerunHandler))
+	mux.Handle("/llm/confirm/{id}", llmLimiter.LimitFunc(llmHandler.ConfirmHandler))
+	mux.HandleFunc("/llm/feedback", llmHandler.FeedbackHandler)
+	mux.HandleFunc("/conversations/{id}", llmHandler.ConversationHandler)
+	mux.HandleFunc("/conversations/{id}/fork", llmHandler.ForkConversationHandler)
+	mux.HandleFunc("/conversations/{id}/share", llmHandler.ShareConversationHandler)
+	mux.HandleFunc("/conversations/{id}/export", llmHandler.ExportConversationHandler)
+	mux.HandleFunc("/conversations/{id}/artifacts", llmHandler.ArtifactsHandler)
+	mux.HandleFunc("/conversations/{id}/artifacts/{artifact}", llmHandler.ArtifactHandler)
+	mux.HandleFunc("/conversations/{id}/turns/{turn}/comments", llmHandler.CommentHandler)
+	mux.HandleFunc("/conversations/{id}/turns/{turn}/export", llmHandler.ExportTurnHandler)
+	mux.HandleFunc("/conversations/{id}/turns/{turn}/trace", llmHandler.TurnTraceHandler)
+	mux.HandleFunc("/conversations/{id}/comments/{comment}", llmHandler.DeleteCommentHandler)
+	mux.HandleFunc("GET /conversations/{id}/live", llmHandler.LiveConversationHandler)
+	mux.Handle("/db/query", dbLimiter.LimitFunc(dbHandler.QueryHandler))
+	mux.Handle("/db/query/arrow", dbLimiter.LimitFunc(dbHandler.ArrowQueryHandler))
+	mux.Handle("/db/query/async", dbLimiter.LimitFunc(dbHandler.AsyncQueryHandler))
+	mux.Handle("/db/export", dbLimiter.LimitFunc(dbHandler.ExportHandler))
+	mux.Handle("/db/query/snapshot", dbLimiter.LimitFunc(dbHandler.SnapshotHandler))
+	mux.HandleFunc("/db/snapshots", handlers.SnapshotsHandler)
+	mux.HandleFunc("/db/snapshots/{name}", handlers.SnapshotDeleteHandler)
+	mux.HandleFunc("/data/upload", handlers.UploadHandler)
+	mux.HandleFunc("/jobs/{id}", handlers.JobHandler)
+	mux.HandleFunc("/jobs/{id}/export", handlers.ExportDownloadHandler)
+	mux.HandleFunc("/reveal-requests", handlers.RevealRequestsHandler)
+	mux.HandleFunc("/reveal-requests/{id}/run", handlers.RevealRunHandler)
+	mux.Handle("/db/schema", dbLimiter.LimitFunc(dbHandler.SchemaHandler))
+	mux.HandleFunc("/databases", handlers.DatabasesHandler)
+	mux.HandleFunc("/me/notifications", handlers.NotificationPreferencesHandler)
+	mux.Handle("/tenant/provider", tenantAdminOnly(http.HandlerFunc(handlers.TenantProviderHandler)))
+	mux.HandleFunc("/suggestions", handlers.SuggestionsHandler)
+	mux.HandleFunc("/history", handlers.HistoryHandler)
+	mux.Handle("/history/{id}/rerun", llmLimiter.LimitFunc(llmHandler.HistoryRerunHandler))
+	mux.HandleFunc("/queries/saved", handlers.SavedQueriesHandler)
+	mux.HandleFunc("/queries/saved/{id}", handlers.SavedQueryHandler)
+	mux.Handle("/queries/saved/{id}/run", llmLimiter.LimitFunc(llmHandler.RunSavedQueryHandler))
+	mux.Handle("/autocomplete", dbLimiter.LimitFunc(autocompleteHandler.SuggestHandler))
 	mux.HandleFunc("/tools", handlers.ToolsHandler)
-	mux.HandleFunc("/tools/execute", handlers.ToolCallHandler)
-	mux.HandleFunc("/tools/single", handlers.SingleToolHandler)
+	mux.Handle("/tools/execute", dbLimiter.LimitFunc(handlers.ToolCallHandler))
+	mux.Handle("/tools/single", dbLimiter.LimitFunc(handlers.SingleToolHandler))
+	mux.HandleFunc("/tools/stats", handlers.ToolStatsHandler)
+	mux.Handle("/admin/tools", adminOnly(http.HandlerFunc(handlers.AdminToolsHandler)))
+	mux.Handle("/admin/tools/{name}/enable", adminOnly(http.HandlerFunc(handlers.EnableToolHandler)))
+	mux.Handle("/admin/tools/{name}/disable", adminOnly(http.HandlerFunc(handlers.DisableToolHandler)))
+	mux.Handle("/admin/context", adminOnly(http.HandlerFunc(handlers.OrgContextHandler)))
+	mux.Handle("/admin/context/versions", adminOnly(http.HandlerFunc(handlers.OrgContextVersionsHandler)))
+	mux.Handle("/admin/context/versions/{version}/rollback", adminOnly(http.HandlerFunc(handlers.RollbackOrgContextHandler)))
+	mux.Handle("/admin/docs", adminOnly(http.HandlerFunc(handlers.DocumentsHandler)))
+	mux.Handle("/admin/docs/{id}", adminOnly(http.HandlerFunc(handlers.DocumentHandler)))
+	mux.Handle("/admin/suggestions", adminOnly(http.HandlerFunc(handlers.AdminSuggestionsHandler)))
+	mux.Handle("/admin/suggestions/{id}", adminOnly(http.HandlerFunc(handlers.AdminSuggestionHandler)))
+	mux.Handle("/admin/metrics", adminOnly(http.HandlerFunc(handlers.MetricsHandler)))
+	mux.Handle("/admin/metrics/{id}", adminOnly(http.HandlerFunc(handlers.MetricHandler)))
+	mux.Handle("/admin/metrics/{id}/samples", adminOnly(http.HandlerFunc(handlers.MetricSamplesHandler)))
+	mux.HandleFunc("/quality/scorecard", handlers.QualityScorecardHandler)
+	mux.Handle("/admin/query-cache", adminOnly(http.HandlerFunc(handlers.QueryCacheStatsHandler)))
+	mux.Handle("/admin/slow-queries", adminOnly(http.HandlerFunc(handlers.SlowQueriesHandler)))
+	mux.Handle("/admin/quality/rules", adminOnly(http.HandlerFunc(handlers.QualityRulesHandler)))
+	mux.Handle("/admin/quality/rules/{id}", adminOnly(http.HandlerFunc(handlers.QualityRuleHandler)))
+	mux.Handle("/admin/quality/evaluate", adminOnly(http.HandlerFunc(handlers.QualityEvaluateHandler)))
+	mux.Handle("/admin/semantic/refresh", adminOnly(http.HandlerFunc(handlers.SemanticRefreshHandler)))
+	mux.Handle("/admin/external-tables", adminOnly(http.HandlerFunc(handlers.ExternalTablesHandler)))
+	mux.Handle("/admin/external-tables/{name}", adminOnly(http.HandlerFunc(handlers.ExternalTableHandler)))
+	mux.Handle("/admin/external-tables/{name}/refresh", adminOnly(http.HandlerFunc(handlers.ExternalTableRefreshHandler)))
+	mux.Handle("/admin/reveal-requests", adminOnly(http.HandlerFunc(handlers.AdminRevealRequestsHandler)))
+	mux.Handle("/admin/reveal-requests/{id}/{decision}", adminOnly(http.HandlerFunc(handlers.RevealDecisionHandler)))
+	mux.Handle("/admin/dictionary", adminOnly(http.HandlerFunc(handlers.DictionaryHandler)))
+	mux.Handle("/admin/dictionary/{table}", adminOnly(http.HandlerFunc(handlers.DictionaryEntryHandler)))
+	mux.Handle("/admin/dictionary/{table}/{column}", adminOnly(http.HandlerFunc(handlers.DictionaryEntryHandler)))
+	mux.Handle("/admin/prompt-preview", adminOnly(http.HandlerFunc(llmHandler.PromptPreviewHandler)))
+	mux.Handle("/admin/config/export", adminOnly(http.HandlerFunc(handlers.ConfigExportHandler)))
+	mux.Handle("/admin/config/import", adminOnly(http.HandlerFunc(handlers.ConfigImportHandler)))
+	mux.Handle("/admin/feedback", adminOnly(http.HandlerFunc(handlers.AdminFeedbackHandler)))
+	mux.Handle("/admin/feedback/summary", adminOnly(http.HandlerFunc(handlers.FeedbackSummaryHandler)))
+	mux.Handle("/admin/usage", adminOnly(http.HandlerFunc(handlers.UsageHandler)))
+	mux.Handle("/admin/backup", adminOnly(http.HandlerFunc(llmHandler.BackupHandler)))
+	mux.Handle("/admin/restore", adminOnly(http.HandlerFunc(llmHandler.RestoreHandler)))
+	mux.Handle("/admin/db/config", adminOnly(authenticatedOnly(authConfig)(http.HandlerFunc(llmHandler.DatabaseConfigHandler))))
 	mux.HandleFunc("/api/", handlers.APIHandler)
+	mux.Handle("/ui/", web.Handler("/ui/"))
 	mux.HandleFunc("/", handlers.HomeHandler)
 
 	return mux
@@ -0,0 +1,173 @@
+// Package answercache remembers recent answers to chat questions, so that a
+// question close enough to one already answered can get the earlier answer
+// without another LLM call or query. Questions are compared by the same
+// local embeddings suggested questions are matched with, and an answer is
+// only reused while the tables it read are unchanged.
+package answercache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"data-chatter/internal/suggestions"
+)
+
+// DefaultThreshold is the similarity above which a question gets the cached
+// answer to an earlier one. It is stricter than suggestion matching, since
+// cached answers were not vetted by an admin.
+const DefaultThreshold = 0.95
+
+const (
+	defaultTTL  = time.Hour
+	defaultSize = 500
+)
+
+// Entry is a cached answer.
+type Entry struct {
+	// Scope is who the answer may be served to, and in what form; answers
+	// are only served within the scope they were cached in.
+	Scope    string
+	Question string
+	TurnID   string
+
+	// Queries are the SQL statements the answer ran, and Tables the data
+	// version of each table they read when it was answered.
+	Queries []string
+	Tables  map[string]string
+
+	// Response is the answer as it was sent.
+	Response   json.RawMessage
+	AnsweredAt time.Time
+
+	id        uint64
+	embedding suggestions.Embedding
+}
+
+// Age returns how long ago the answer was given.
+func (e Entry) Age() time.Duration {
+	return time.Since(e.AnsweredAt)
+}
+
+// Cache holds the most recent answers in memory, oldest first.
+type Cache struct {
+	threshold float64
+	ttl       time.Duration
+	size      int
+
+	mu      sync.Mutex
+	nextID  uint64
+	entries []Entry
+}
+
+// NewFromEnv creates a cache configured by ANSWER_CACHE_THRESHOLD (the
+// similarity, between 0 and 1, above which a cached answer is served; 0
+// turns the cache off), ANSWER_CACHE_TTL (how long an answer may be served,
+// default 1h), and ANSWER_CACHE_SIZE (how many answers are kept, default 500).
+func NewFromEnv() (*Cache, error) {
+	c := &Cache{threshold: DefaultThreshold, ttl: defaultTTL, size: defaultSize}
+	if value := os.Getenv("ANSWER_CACHE_THRESHOLD"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold < 0 || threshold > 1 {
+			return nil, fmt.Errorf("invalid ANSWER_CACHE_THRESHOLD %q: must be a number from 0 to 1", value)
+		}
+		c.threshold = threshold
+	}
+	if value, err := time.ParseDuration(os.Getenv("ANSWER_CACHE_TTL")); err == nil && value > 0 {
+		c.ttl = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("ANSWER_CACHE_SIZE")); err == nil && value > 0 {
+		c.size = value
+	}
+	return c, nil
+}
+
+// Enabled reports whether answers are cached at all.
+func (c *Cache) Enabled() bool {
+	return c != nil && c.threshold > 0
+}
+
+// Put caches an answer, replacing any earlier answer to the same question in
+// the same scope and evicting the oldest answers when the cache is full.
+func (c *Cache) Put(entry Entry) {
+	if !c.Enabled() {
+		return
+	}
+	entry.embedding = suggestions.Embed(entry.Question)
+	if len(entry.embedding) == 0 {
+		return
+	}
+	if entry.AnsweredAt.IsZero() {
+		entry.AnsweredAt = time.Now().UTC()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	entry.id = c.nextID
+	c.entries = slices.DeleteFunc(c.entries, func(e Entry) bool {
+		return e.Scope == entry.Scope && e.Question == entry.Question
+	})
+	c.entries = append(c.entries, entry)
+	if len(c.entries) > c.size {
+		c.entries = c.entries[len(c.entries)-c.size:]
+	}
+}
+
+// Lookup returns the cached answer in scope whose question is most similar
+// to question, with its similarity, if it reaches the threshold and has not
+// expired. fresh reports whether a candidate's tables are unchanged and it
+// may still be served; candidates it rejects are dropped and the next most
+// similar is tried. fresh is called without the cache locked, so it may
+// query the database.
+func (c *Cache) Lookup(scope, question string, fresh func(Entry) bool) (Entry, float64, bool) {
+	if !c.Enabled() {
+		return Entry{}, 0, false
+	}
+	asked := suggestions.Embed(question)
+	if len(asked) == 0 {
+		return Entry{}, 0, false
+	}
+
+	type candidate struct {
+		entry      Entry
+		similarity float64
+	}
+	var candidates []candidate
+	c.mu.Lock()
+	cutoff := time.Now().Add(-c.ttl)
+	c.entries = slices.DeleteFunc(c.entries, func(e Entry) bool { return e.AnsweredAt.Before(cutoff) })
+	for _, entry := range c.entries {
+		if entry.Scope != scope {
+			continue
+		}
+		if similarity := asked.Similarity(entry.embedding); similarity >= c.threshold {
+			candidates = append(candidates, candidate{entry, similarity})
+		}
+	}
+	c.mu.Unlock()
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].similarity > candidates[j].similarity
+	})
+	for _, candidate := range candidates {
+		if fresh(candidate.entry) {
+			return candidate.entry, candidate.similarity, true
+		}
+		c.remove(candidate.entry.id)
+	}
+	return Entry{}, 0, false
+}
+
+// remove drops the entry with id, if it is still cached.
+func (c *Cache) remove(id uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = slices.DeleteFunc(c.entries, func(e Entry) bool { return e.id == id })
+}
@@ -0,0 +1,215 @@
+// Package apiclient is the HTTP client the command-line tools use to call
+// the data-chatter API. It prefixes paths with the API version, sends the
+// bearer token, bounds each request by a timeout, and returns non-2xx
+// responses as errors carrying the server's message.
+package apiclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/apiversion"
+)
+
+// Options configures a Client.
+type Options struct {
+	// Host is the API base URL, e.g. http://localhost:8081.
+	Host string
+	// Token is sent as a bearer token when set.
+	Token string
+	// Timeout bounds each request; zero means no limit. Streams opened
+	// with Stream are not bounded.
+	Timeout time.Duration
+	// Verbose logs each request and response to stderr.
+	Verbose bool
+}
+
+// Client sends requests to the API.
+type Client struct {
+	opts       Options
+	httpClient *http.Client
+}
+
+// New creates a client for opts.Host.
+func New(opts Options) *Client {
+	return &Client{opts: opts, httpClient: &http.Client{}}
+}
+
+// Host returns the API base URL the client sends requests to.
+func (c *Client) Host() string {
+	return c.opts.Host
+}
+
+// Get sends a GET request and decodes the JSON response into out.
+func (c *Client) Get(ctx context.Context, path string, out interface{}) error {
+	return c.Do(ctx, http.MethodGet, path, nil, out)
+}
+
+// Post sends body as JSON and decodes the JSON response into out.
+func (c *Client) Post(ctx context.Context, path string, body, out interface{}) error {
+	return c.Do(ctx, http.MethodPost, path, body, out)
+}
+
+// Download sends a GET request and returns the response body as it is.
+func (c *Client) Download(ctx context.Context, path string) ([]byte, error) {
+	return c.Send(ctx, http.MethodGet, path, "", nil)
+}
+
+// Upload sends data as the body of a POST request and decodes the JSON
+// response into out.
+func (c *Client) Upload(ctx context.Context, path, contentType string, data []byte, out interface{}) error {
+	respBody, err := c.Send(ctx, http.MethodPost, path, contentType, data)
+	if err != nil {
+		return err
+	}
+	return decode(respBody, out)
+}
+
+// Do sends body as JSON (when non-nil) and decodes the JSON response into
+// out (when non-nil). Transport failures, non-2xx statuses, and undecodable
+// bodies are all returned as errors.
+func (c *Client) Do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	contentType := ""
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		contentType = "application/json"
+	}
+	respBody, err := c.Send(ctx, method, path, contentType, payload)
+	if err != nil {
+		return err
+	}
+	return decode(respBody, out)
+}
+
+// Send performs the request and returns the response body. Transport
+// failures and non-2xx statuses are returned as errors.
+func (c *Client) Send(ctx context.Context, method, path, contentType string, payload []byte) ([]byte, error) {
+	if c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+
+	req, err := c.newRequest(ctx, method, path, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	c.logf("> %s %s", method, req.URL)
+	switch {
+	case contentType == "application/json":
+		c.logf("> %s", payload)
+	case payload != nil:
+		c.logf("> (%d bytes)", len(payload))
+	}
+
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%s %s: no answer within %v", method, path, c.opts.Timeout)
+		}
+		return nil, fmt.Errorf("request to %s failed: %w", req.URL, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	c.logf("< %s (%v)", resp.Status, time.Since(start).Round(time.Millisecond))
+	c.logf("< %s", bytes.TrimSpace(respBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s returned %s: %s", method, path, resp.Status, ErrorMessage(respBody))
+	}
+	return respBody, nil
+}
+
+// Stream sends a GET request and returns the response body for the caller
+// to read as it arrives, such as a server-sent event stream. The request
+// lasts until ctx is done or the body is closed; statuses other than 200
+// are returned as errors.
+func (c *Client) Stream(ctx context.Context, path string) (io.ReadCloser, error) {
+	req, err := c.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request to %s failed: %w", req.URL, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("GET %s returned %s: %s", path, resp.Status, ErrorMessage(respBody))
+	}
+	return resp.Body, nil
+}
+
+// newRequest builds a request to path with the bearer token set.
+func (c *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	url := strings.TrimSuffix(c.opts.Host, "/") + apiversion.Path(path)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.opts.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.Token)
+	}
+	return req, nil
+}
+
+// decode parses a JSON response body into out, if it is set.
+func decode(body []byte, out interface{}) error {
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
+
+// logf writes a request/response log line to stderr in verbose mode.
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.opts.Verbose {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+	}
+}
+
+// ErrorMessage extracts the most specific message from an error response body.
+func ErrorMessage(body []byte) string {
+	var parsed struct {
+		Message string          `json:"message"`
+		Error   *apierror.Error `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err == nil {
+		switch {
+		case parsed.Error != nil && parsed.Message != "":
+			return parsed.Message + ": " + parsed.Error.Message + " (" + parsed.Error.Code + ")"
+		case parsed.Error != nil:
+			return parsed.Error.Message + " (" + parsed.Error.Code + ")"
+		case parsed.Message != "":
+			return parsed.Message
+		}
+	}
+	return strings.TrimSpace(string(body))
+}
@@ -0,0 +1,128 @@
+// Package apierror is the error envelope every endpoint answers failures
+// with: a summary message, an error with a stable machine-readable code, a
+// human-readable message, and optional details, and the request ID. Clients
+// branch on error.code rather than on messages or status codes.
+package apierror
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"data-chatter/internal/redact"
+	"data-chatter/internal/requestid"
+)
+
+// Stable error codes. Failed tool calls use the tool error codes in the
+// types package, such as "syntax_error" or "permission_denied".
+const (
+	InvalidRequest        = "invalid_request"         // The request body, path, or parameters were rejected
+	MethodNotAllowed      = "method_not_allowed"      // The endpoint does not take the request's method
+	NotFound              = "not_found"               // The named resource does not exist or is not visible to the caller
+	Unauthorized          = "unauthorized"            // Authentication is missing or invalid
+	Forbidden             = "forbidden"               // The caller may not use the endpoint or resource
+	QueryForbidden        = "query_forbidden"         // Access control refused a query
+	Conflict              = "conflict"                // The resource's state does not allow the change
+	RateLimited           = "rate_limited"            // The caller is over its rate limit
+	FeatureUnavailable    = "feature_unavailable"     // The feature is not configured or its storage could not be set up
+	UnsupportedAPIVersion = "unsupported_api_version" // The requested API version is not served
+	LLMUnavailable        = "llm_unavailable"         // No LLM provider is configured
+	LLMRateLimited        = "llm_rate_limited"        // The LLM provider is rate limited or overloaded
+	LLMError              = "llm_error"               // The LLM provider failed the request
+	TurnTimeout           = "turn_timeout"            // The chat turn ran out of time
+	TurnCancelled         = "turn_cancelled"          // The chat turn was cancelled by the user
+	RequestTimeout        = "request_timeout"         // The request ran longer than REQUEST_TIMEOUT
+	PayloadTooLarge       = "payload_too_large"       // The request body is larger than MAX_REQUEST_BODY_BYTES
+	Internal              = "internal_error"          // The server failed unexpectedly
+)
+
+// Error is the error object of a failed response.
+type Error struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// New returns an error with code and message.
+func New(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// WithDetails returns a copy of e carrying details, such as the limit a
+// value broke or the candidates a name could have meant.
+func (e *Error) WithDetails(details interface{}) *Error {
+	copied := *e
+	copied.Details = details
+	return &copied
+}
+
+// Error returns the message, so an Error can be returned as a Go error.
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// MarshalJSON encodes the error with secrets, such as a connection string
+// echoed by a driver, redacted from its message and details.
+func (e Error) MarshalJSON() ([]byte, error) {
+	type plain Error
+	redacted := plain(e)
+	redacted.Message = redact.String(e.Message)
+	redacted.Details = redact.Value(e.Details)
+	return json.Marshal(redacted)
+}
+
+// ForStatus returns the code for a failure that has nothing more specific
+// to say than its HTTP status.
+func ForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusRequestEntityTooLarge:
+		return InvalidRequest
+	case http.StatusUnauthorized:
+		return Unauthorized
+	case http.StatusForbidden:
+		return Forbidden
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusMethodNotAllowed:
+		return MethodNotAllowed
+	case http.StatusConflict:
+		return Conflict
+	case http.StatusTooManyRequests:
+		return RateLimited
+	case http.StatusServiceUnavailable:
+		return FeatureUnavailable
+	default:
+		return Internal
+	}
+}
+
+// Response is the body of a failed response from endpoints without a
+// response type of their own.
+type Response struct {
+	Message   string `json:"message"`
+	Error     *Error `json:"error"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Write answers r with status and the envelope for err, summarized by
+// message.
+func Write(w http.ResponseWriter, r *http.Request, status int, message string, err *Error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{
+		Message:   message,
+		Error:     err,
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// WriteMethodNotAllowed answers requests with a method the endpoint does
+// not take.
+func WriteMethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Write(w, r, http.StatusMethodNotAllowed, "Method not allowed", New(MethodNotAllowed, r.Method+" is not allowed on "+r.URL.Path))
+}
+
+// WriteInvalidRequest answers requests whose body or parameters were
+// rejected, with message saying why.
+func WriteInvalidRequest(w http.ResponseWriter, r *http.Request, message string) {
+	Write(w, r, http.StatusBadRequest, "Invalid request", New(InvalidRequest, message))
+}
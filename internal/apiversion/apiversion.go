@@ -0,0 +1,128 @@
+// Package apiversion serves the API under versioned paths such as /v1/, so
+// request and response payloads can change in a later version without
+// breaking clients of an earlier one. Unversioned paths remain aliases of
+// the current version for existing clients.
+package apiversion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"data-chatter/internal/apierror"
+)
+
+// Header is the request header naming the version a client wants, and the
+// response header naming the version that served it.
+const Header = "API-Version"
+
+// SupportedHeader is the response header listing every supported version.
+const SupportedHeader = "API-Supported-Versions"
+
+// Current is the version unversioned paths are served as.
+const Current = 1
+
+// Supported are the versions the server serves, oldest first.
+var Supported = []int{1}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying version.
+func NewContext(ctx context.Context, version int) context.Context {
+	return context.WithValue(ctx, contextKey{}, version)
+}
+
+// FromContext returns the version a request is served as, or Current when
+// ctx has none.
+func FromContext(ctx context.Context) int {
+	if version, ok := ctx.Value(contextKey{}).(int); ok {
+		return version
+	}
+	return Current
+}
+
+// Path returns the path of route under the current version, as in
+// "/v1/llm/message" for "/llm/message".
+func Path(route string) string {
+	return "/v" + strconv.Itoa(Current) + route
+}
+
+// Split separates a path's version prefix from the route it names: "/v1/llm/message"
+// is version 1 of "/llm/message". Unversioned paths have version 0.
+func Split(path string) (int, string) {
+	rest, ok := strings.CutPrefix(path, "/v")
+	if !ok {
+		return 0, path
+	}
+	digits, route, _ := strings.Cut(rest, "/")
+	version, err := strconv.Atoi(digits)
+	if err != nil || version < 1 || digits != strconv.Itoa(version) {
+		return 0, path
+	}
+	return version, "/" + route
+}
+
+// Unversioned returns r with its path's version prefix removed, so it
+// matches the routes registered without one. r is returned as is when its
+// path has no prefix.
+func Unversioned(r *http.Request) *http.Request {
+	version, route := Split(r.URL.Path)
+	if version == 0 {
+		return r
+	}
+	unversioned := r.Clone(r.Context())
+	unversioned.URL.Path = route
+	unversioned.URL.RawPath = ""
+	return unversioned
+}
+
+// Middleware resolves the version a request asks for, from its path prefix
+// or else its API-Version header, strips the prefix so it is routed like an
+// unversioned path, and names the version in the response. Requests for an
+// unsupported version, or whose header contradicts their path, are refused
+// with 400.
+func Middleware(next http.Handler) http.Handler {
+	supported := make([]string, len(Supported))
+	for i, version := range Supported {
+		supported[i] = strconv.Itoa(version)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(SupportedHeader, strings.Join(supported, ", "))
+
+		version, err := resolve(r)
+		if err != nil {
+			apierror.Write(w, r, http.StatusBadRequest, "Unsupported API version",
+				apierror.New(apierror.UnsupportedAPIVersion, err.Error()).WithDetails(map[string][]int{"supported": Supported}))
+			return
+		}
+
+		w.Header().Set(Header, strconv.Itoa(version))
+		r = Unversioned(r)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), version)))
+	})
+}
+
+// resolve returns the version r asks for.
+func resolve(r *http.Request) (int, error) {
+	version, _ := Split(r.URL.Path)
+	if header := strings.TrimSpace(r.Header.Get(Header)); header != "" {
+		requested, err := strconv.Atoi(strings.TrimPrefix(header, "v"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s header %q: want a version number such as %d", Header, header, Current)
+		}
+		if version != 0 && requested != version {
+			return 0, fmt.Errorf("%s header asks for version %d but the path is version %d", Header, requested, version)
+		}
+		version = requested
+	}
+	if version == 0 {
+		return Current, nil
+	}
+	if !slices.Contains(Supported, version) {
+		return 0, fmt.Errorf("version %d is not supported; supported versions: %v", version, Supported)
+	}
+	return version, nil
+}
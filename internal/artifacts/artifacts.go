@@ -0,0 +1,199 @@
+// Package artifacts keeps the files the agent generates while answering a
+// turn, such as CSV exports, chart images, and markdown reports, so answers
+// can include downloadable deliverables, and the parts of background
+// exports. Contents live in a blob store
+// chosen by ARTIFACT_STORE: memory by default, a local directory, or an S3
+// bucket. Artifacts hold query results, so contents written outside memory
+// are sealed with HISTORY_ENCRYPTION_KEYS when it is set.
+package artifacts
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"data-chatter/internal/encryption"
+)
+
+const (
+	// MaxBytes bounds the size of one artifact.
+	MaxBytes = 20 << 20
+
+	// memoryLimit bounds the artifacts kept in memory, the oldest being
+	// dropped first.
+	memoryLimit = 256 << 20
+
+	// maxNameLength bounds an artifact's file name.
+	maxNameLength = 100
+)
+
+// Artifact kinds.
+const (
+	KindCSV      = "csv"
+	KindChart    = "chart"
+	KindMarkdown = "markdown"
+)
+
+var (
+	// ErrNotFound is returned for artifacts that do not exist, or whose
+	// contents are no longer kept.
+	ErrNotFound = errors.New("artifact not found")
+
+	// ErrInvalid is returned for artifacts that fail validation.
+	ErrInvalid = errors.New("invalid artifact")
+)
+
+// Artifact describes a file attached to a turn. Its contents are read with
+// Store.Open.
+type Artifact struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"` // File name, e.g. "revenue_by_month.csv"
+	Kind           string    `json:"kind"`
+	ContentType    string    `json:"content_type"`
+	Size           int       `json:"size"`
+	Description    string    `json:"description,omitempty"`
+	ConversationID string    `json:"conversation_id,omitempty"`
+	TurnID         string    `json:"turn_id,omitempty"`
+	CreatedBy      string    `json:"created_by,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// extensions gives each kind's file extension and content type.
+var extensions = map[string]struct{ extension, contentType string }{
+	KindCSV:      {".csv", "text/csv; charset=utf-8"},
+	KindChart:    {".png", "image/png"},
+	KindMarkdown: {".md", "text/markdown; charset=utf-8"},
+}
+
+// unsafeName matches runs of characters left out of file names.
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Store saves and reads artifact contents.
+type Store struct {
+	blobs Blobs
+	keys  *encryption.Keyring
+}
+
+// NewStore keeps artifacts in blobs, sealing them with keys.
+func NewStore(blobs Blobs, keys *encryption.Keyring) *Store {
+	return &Store{blobs: blobs, keys: keys}
+}
+
+// NewStoreFromEnv reads ARTIFACT_STORE: an s3://bucket/prefix URL, a
+// directory, or, when unset, memory, where artifacts are lost on restart
+// and the oldest are dropped past 256 MiB. Artifacts written to a directory
+// or S3 are sealed with keys.
+func NewStoreFromEnv(keys *encryption.Keyring) (*Store, error) {
+	location := os.Getenv("ARTIFACT_STORE")
+	switch {
+	case location == "":
+		return NewStore(newMemoryBlobs(memoryLimit), nil), nil
+	case strings.HasPrefix(location, "s3://"):
+		blobs, err := newS3Blobs(location)
+		if err != nil {
+			return nil, err
+		}
+		return NewStore(blobs, keys), nil
+	}
+	blobs, err := newDirBlobs(filepath.Clean(location))
+	if err != nil {
+		return nil, err
+	}
+	return NewStore(blobs, keys), nil
+}
+
+// Create saves data as a new artifact of a's kind, giving it an ID and a
+// file name with the kind's extension.
+func (s *Store) Create(ctx context.Context, a Artifact, data []byte) (Artifact, error) {
+	format, ok := extensions[a.Kind]
+	if !ok {
+		return Artifact{}, fmt.Errorf("%w: kind must be %s, %s, or %s", ErrInvalid, KindCSV, KindChart, KindMarkdown)
+	}
+	if len(data) > MaxBytes {
+		return Artifact{}, fmt.Errorf("%w: %d bytes is over the %d byte limit", ErrInvalid, len(data), MaxBytes)
+	}
+
+	name := strings.Trim(unsafeName.ReplaceAllString(strings.TrimSuffix(strings.TrimSpace(a.Name), format.extension), "_"), "._-")
+	if name == "" {
+		name = a.Kind
+	}
+	if len(name) > maxNameLength {
+		name = name[:maxNameLength]
+	}
+	a.Name = name + format.extension
+	a.ContentType = format.contentType
+	a.Size = len(data)
+	a.ID = newID()
+	a.CreatedAt = time.Now().UTC()
+
+	sealed, err := s.keys.Seal(string(data))
+	if err != nil {
+		return Artifact{}, err
+	}
+	if err := s.blobs.Put(ctx, a.ID, []byte(sealed)); err != nil {
+		return Artifact{}, err
+	}
+	return a, nil
+}
+
+// Open returns the contents of the artifact with the given ID.
+func (s *Store) Open(ctx context.Context, id string) ([]byte, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return nil, ErrNotFound
+	}
+	sealed, err := s.blobs.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.keys.Open(string(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(data), nil
+}
+
+// SavePart stores part n of the export run by job, sealed as artifacts
+// are. Parts have no size limit of their own, but in memory they are
+// dropped, oldest first, with the artifacts past 256 MiB.
+func (s *Store) SavePart(ctx context.Context, job string, n int, data []byte) error {
+	sealed, err := s.keys.Seal(string(data))
+	if err != nil {
+		return err
+	}
+	return s.blobs.Put(ctx, partKey(job, n), []byte(sealed))
+}
+
+// OpenPart returns part n of the export run by job, or ErrNotFound.
+func (s *Store) OpenPart(ctx context.Context, job string, n int) ([]byte, error) {
+	if _, err := hex.DecodeString(job); err != nil || job == "" {
+		return nil, ErrNotFound
+	}
+	sealed, err := s.blobs.Get(ctx, partKey(job, n))
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.keys.Open(string(sealed))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(data), nil
+}
+
+// partKey is the blob key of part n of job's export.
+func partKey(job string, n int) string {
+	return fmt.Sprintf("export-%s-%06d", job, n)
+}
+
+// newID returns a random artifact ID.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,197 @@
+package artifacts
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"data-chatter/internal/awsauth"
+)
+
+// Blobs stores artifact contents by key.
+type Blobs interface {
+	// Put stores data under key, replacing what was there.
+	Put(ctx context.Context, key string, data []byte) error
+
+	// Get returns the data under key, or ErrNotFound.
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// memoryBlobs keeps up to limit bytes in memory, evicting the oldest.
+type memoryBlobs struct {
+	limit int
+
+	mu      sync.Mutex
+	size    int
+	order   *list.List // Of *memoryBlob, newest first
+	entries map[string]*list.Element
+}
+
+type memoryBlob struct {
+	key  string
+	data []byte
+}
+
+func newMemoryBlobs(limit int) *memoryBlobs {
+	return &memoryBlobs{limit: limit, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (m *memoryBlobs) Put(_ context.Context, key string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if element, ok := m.entries[key]; ok {
+		m.size -= len(element.Value.(*memoryBlob).data)
+		m.order.Remove(element)
+	}
+	m.entries[key] = m.order.PushFront(&memoryBlob{key: key, data: data})
+	m.size += len(data)
+	for m.size > m.limit && m.order.Len() > 1 {
+		oldest := m.order.Back()
+		blob := oldest.Value.(*memoryBlob)
+		m.order.Remove(oldest)
+		delete(m.entries, blob.key)
+		m.size -= len(blob.data)
+	}
+	return nil
+}
+
+func (m *memoryBlobs) Get(_ context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return element.Value.(*memoryBlob).data, nil
+}
+
+// dirBlobs keeps each blob in a file named by its key under a directory.
+type dirBlobs struct {
+	dir string
+}
+
+func newDirBlobs(dir string) (*dirBlobs, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create artifact directory: %w", err)
+	}
+	return &dirBlobs{dir: dir}, nil
+}
+
+func (d *dirBlobs) Put(_ context.Context, key string, data []byte) error {
+	// Written to a temporary file first, so readers never see part of a blob
+	tmp, err := os.CreateTemp(d.dir, ".artifact-*")
+	if err != nil {
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(d.dir, key)); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	return nil
+}
+
+func (d *dirBlobs) Get(_ context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(d.dir, key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	return data, nil
+}
+
+// s3Blobs keeps each blob in an S3 object named by its key under a prefix.
+type s3Blobs struct {
+	bucket string
+	prefix string
+	client *http.Client
+}
+
+// newS3Blobs stores blobs under an s3://bucket/prefix URL. Requests are
+// signed with AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, which are
+// required, since artifacts hold query results.
+func newS3Blobs(location string) (*s3Blobs, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, "s3://"), "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("%s is not an s3://bucket/prefix URL", location)
+	}
+	if _, ok := awsauth.CredentialsFromEnv(); !ok {
+		return nil, errors.New("artifacts in S3 need AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return &s3Blobs{bucket: bucket, prefix: prefix, client: &http.Client{Timeout: time.Minute}}, nil
+}
+
+func (s *s3Blobs) Put(ctx context.Context, key string, data []byte) error {
+	response, err := s.do(ctx, http.MethodPut, key, data)
+	if err != nil {
+		return fmt.Errorf("failed to write artifact: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to write artifact: %s", s3Error(response))
+	}
+	return nil
+}
+
+func (s *s3Blobs) Get(ctx context.Context, key string) ([]byte, error) {
+	response, err := s.do(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, fmt.Errorf("failed to read artifact: %s", s3Error(response))
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %w", err)
+	}
+	return data, nil
+}
+
+// do sends a signed request for the object under key.
+func (s *s3Blobs) do(ctx context.Context, method, key string, body []byte) (*http.Response, error) {
+	target, err := awsauth.S3ObjectURL(s.bucket, s.prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, method, target.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	creds, _ := awsauth.CredentialsFromEnv()
+	awsauth.Sign(request, creds, "s3", awsauth.Region(), awsauth.HashHex(body), time.Now().UTC())
+	return s.client.Do(request)
+}
+
+// s3Error describes a failed S3 response.
+func s3Error(response *http.Response) string {
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+	return fmt.Sprintf("S3 returned %s: %s", response.Status, strings.TrimSpace(string(body)))
+}
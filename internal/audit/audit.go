@@ -0,0 +1,208 @@
+// Package audit records who did what through the API, one JSON line per event.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+	"data-chatter/internal/redact"
+	"data-chatter/internal/requestid"
+)
+
+// Entry is a single audit record.
+type Entry struct {
+	Time           time.Time              `json:"time"`
+	Tenant         string                 `json:"tenant,omitempty"`
+	UserID         string                 `json:"user_id"`
+	Action         string                 `json:"action"`
+	Tool           string                 `json:"tool,omitempty"`
+	ToolCallID     string                 `json:"tool_call_id,omitempty"`
+	TurnID         string                 `json:"turn_id,omitempty"`
+	ConversationID string                 `json:"conversation_id,omitempty"`
+	Database       string                 `json:"database,omitempty"`
+	RequestID      string                 `json:"request_id,omitempty"`
+	Status         string                 `json:"status,omitempty"`
+	Details        map[string]interface{} `json:"details,omitempty"`
+}
+
+// ErrNoFile is returned when reading or restoring the entries of a recorder
+// that does not write to a file.
+var ErrNoFile = errors.New("the audit log is not written to a file; set AUDIT_LOG_FILE")
+
+// Recorder writes audit entries to an output stream, or to a tenant's own
+// stream for entries of a tenant that has one.
+type Recorder struct {
+	mu      sync.Mutex
+	out     io.Writer
+	path    string // The file out writes to, if it is AUDIT_LOG_FILE
+	tenants map[string]io.Writer
+}
+
+// NewRecorder creates a recorder writing JSON lines to out.
+func NewRecorder(out io.Writer) *Recorder {
+	return &Recorder{out: out}
+}
+
+// NewRecorderFromEnv writes to the file named by AUDIT_LOG_FILE, or stdout if unset.
+func NewRecorderFromEnv() (*Recorder, error) {
+	path := os.Getenv("AUDIT_LOG_FILE")
+	if path == "" {
+		return NewRecorder(os.Stdout), nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	return &Recorder{out: file, path: path}, nil
+}
+
+// SetTenantOutput sends the entries of tenant to out instead of the
+// recorder's own stream, keeping each tenant's audit trail apart.
+func (r *Recorder) SetTenantOutput(tenant string, out io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.tenants == nil {
+		r.tenants = make(map[string]io.Writer)
+	}
+	r.tenants[tenant] = out
+}
+
+// Record stamps the entry with the time, the tenant, the authenticated user,
+// the named database the request is routed to, and the request ID from ctx,
+// then writes it with secrets redacted from its details.
+func (r *Recorder) Record(ctx context.Context, entry Entry) {
+	if r == nil {
+		return
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.Tenant == "" {
+		entry.Tenant = auth.TenantID(ctx)
+	}
+	if entry.UserID == "" {
+		entry.UserID = auth.UserID(ctx)
+	}
+	if conn := database.ConnectionFromContext(ctx); entry.Database == "" && conn != nil {
+		entry.Database = conn.Name
+	}
+	if entry.RequestID == "" {
+		entry.RequestID = requestid.FromContext(ctx)
+	}
+	if entry.Details != nil {
+		entry.Details = redact.Value(entry.Details).(map[string]interface{})
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	out := r.out
+	if tenantOut, ok := r.tenants[entry.Tenant]; ok {
+		out = tenantOut
+	}
+	out.Write(append(line, '\n'))
+}
+
+// Entries returns the entries in the audit log file, oldest first. Entries
+// written to a tenant's own stream are not included.
+func (r *Recorder) Entries() ([]json.RawMessage, error) {
+	if r == nil {
+		return nil, ErrNoFile
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.path == "" {
+		return nil, ErrNoFile
+	}
+	return r.read()
+}
+
+// Restore adds the entries the audit log file lacks ahead of those already
+// in it, as when restoring a backup, so the trail of a lost server comes
+// back without dropping what was recorded since. It returns how many
+// entries were added.
+func (r *Recorder) Restore(entries []json.RawMessage) (int, error) {
+	if r == nil {
+		return 0, ErrNoFile
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.path == "" {
+		return 0, ErrNoFile
+	}
+
+	current, err := r.read()
+	if err != nil {
+		return 0, err
+	}
+	seen := make(map[string]bool, len(current))
+	for _, line := range current {
+		seen[string(line)] = true
+	}
+	var data bytes.Buffer
+	added := 0
+	for _, entry := range entries {
+		var line bytes.Buffer
+		if err := json.Compact(&line, entry); err != nil {
+			return 0, fmt.Errorf("invalid audit entry: %w", err)
+		}
+		if seen[line.String()] {
+			continue
+		}
+		seen[line.String()] = true
+		data.Write(append(line.Bytes(), '\n'))
+		added++
+	}
+	if added == 0 {
+		return 0, nil
+	}
+	for _, line := range current {
+		data.Write(append(line, '\n'))
+	}
+
+	tmp := r.path + ".tmp"
+	if err := os.WriteFile(tmp, data.Bytes(), 0o600); err != nil {
+		return 0, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := os.Rename(tmp, r.path); err != nil {
+		return 0, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if closer, ok := r.out.(io.Closer); ok {
+		closer.Close()
+	}
+	r.out = file
+	return added, nil
+}
+
+// read returns the lines of the audit log file. Callers must hold r.mu.
+func (r *Recorder) read() ([]json.RawMessage, error) {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	var lines []json.RawMessage
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			lines = append(lines, json.RawMessage(line))
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,288 @@
+// Package auth provides bearer JWT authentication and carries the
+// authenticated user through request contexts.
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"data-chatter/internal/env"
+)
+
+// clockSkew is the leeway allowed when checking exp and nbf claims.
+const clockSkew = 30 * time.Second
+
+// User is the authenticated identity attached to a request.
+type User struct {
+	ID    string   `json:"id"`
+	Name  string   `json:"name,omitempty"`
+	Email string   `json:"email,omitempty"`
+	Roles []string `json:"roles,omitempty"`
+
+	// Tenant is the tenant named by the token's tenant claim, if any.
+	Tenant string `json:"tenant,omitempty"`
+}
+
+// HasRole reports whether the user has the given role.
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Config controls how bearer tokens are verified.
+type Config struct {
+	Algorithm string // "HS256" or "RS256"
+	Secret    []byte // HMAC secret for HS256
+	PublicKey *rsa.PublicKey
+	Issuer    string // Expected iss claim, if set
+	Audience  string // Expected aud claim, if set
+	Required  bool   // Reject requests without a token
+
+	// AllowNoExpiry accepts tokens without an exp claim, which otherwise
+	// are rejected since they would stay valid forever.
+	AllowNoExpiry bool
+
+	// TenantClaim names the claim holding the user's tenant in
+	// multi-tenant mode.
+	TenantClaim string
+}
+
+// Enabled reports whether token verification is configured.
+func (c *Config) Enabled() bool {
+	return len(c.Secret) > 0 || c.PublicKey != nil
+}
+
+// ConfigFromEnv builds the auth configuration from JWT_* environment variables.
+// Authentication is disabled when neither JWT_SECRET nor JWT_PUBLIC_KEY_FILE is set.
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{
+		Algorithm: strings.ToUpper(env.Get("JWT_ALGORITHM", "HS256")),
+		Issuer:    os.Getenv("JWT_ISSUER"),
+		Audience:  os.Getenv("JWT_AUDIENCE"),
+
+		TenantClaim:   env.Get("JWT_TENANT_CLAIM", "tenant"),
+		AllowNoExpiry: os.Getenv("JWT_ALLOW_NO_EXP") == "true",
+	}
+
+	switch config.Algorithm {
+	case "HS256":
+		config.Secret = []byte(os.Getenv("JWT_SECRET"))
+	case "RS256":
+		if path := os.Getenv("JWT_PUBLIC_KEY_FILE"); path != "" {
+			key, err := loadRSAPublicKey(path)
+			if err != nil {
+				return nil, err
+			}
+			config.PublicKey = key
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT_ALGORITHM %q (use HS256 or RS256)", config.Algorithm)
+	}
+
+	config.Required = config.Enabled() && env.Get("AUTH_REQUIRED", "true") == "true"
+	return config, nil
+}
+
+// loadRSAPublicKey reads a PEM-encoded RSA public key or certificate.
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT public key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("JWT public key file contains no PEM data")
+	}
+
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT certificate: %w", err)
+		}
+		key, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("JWT certificate does not contain an RSA key")
+		}
+		return key, nil
+	}
+
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		if key, pkcs1Err := x509.ParsePKCS1PublicKey(block.Bytes); pkcs1Err == nil {
+			return key, nil
+		}
+		return nil, fmt.Errorf("failed to parse JWT public key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("JWT public key is not an RSA key")
+	}
+	return key, nil
+}
+
+// claims are the registered and custom JWT claims understood by the server.
+type claims struct {
+	Subject   string          `json:"sub"`
+	Name      string          `json:"name"`
+	Email     string          `json:"email"`
+	Roles     json.RawMessage `json:"roles"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+}
+
+// Verify checks a compact JWT's signature and claims and returns the user it identifies.
+func (c *Config) Verify(token string) (*User, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, errors.New("malformed token header")
+	}
+	// Only the configured algorithm is accepted, preventing alg-confusion attacks
+	if header.Alg != c.Algorithm {
+		return nil, fmt.Errorf("unexpected signing algorithm %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed token signature")
+	}
+	if err := c.verifySignature(parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, errors.New("malformed token payload")
+	}
+	var cl claims
+	if err := json.Unmarshal(payload, &cl); err != nil {
+		return nil, errors.New("malformed token claims")
+	}
+
+	if err := c.checkClaims(&cl); err != nil {
+		return nil, err
+	}
+
+	return &User{
+		ID:     cl.Subject,
+		Name:   cl.Name,
+		Email:  cl.Email,
+		Roles:  stringOrList(cl.Roles),
+		Tenant: c.tenant(payload),
+	}, nil
+}
+
+// tenant returns the string value of the tenant claim in a token payload,
+// or "" when the claim is missing or not a string.
+func (c *Config) tenant(payload []byte) string {
+	if c.TenantClaim == "" {
+		return ""
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &all); err != nil {
+		return ""
+	}
+	var tenant string
+	json.Unmarshal(all[c.TenantClaim], &tenant)
+	return tenant
+}
+
+// verifySignature checks the signature over the signing input.
+func (c *Config) verifySignature(signingInput string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch c.Algorithm {
+	case "HS256":
+		mac := hmac.New(sha256.New, c.Secret)
+		mac.Write([]byte(signingInput))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid token signature")
+		}
+	case "RS256":
+		if err := rsa.VerifyPKCS1v15(c.PublicKey, crypto.SHA256, digest[:], signature); err != nil {
+			return errors.New("invalid token signature")
+		}
+	default:
+		return fmt.Errorf("unsupported signing algorithm %q", c.Algorithm)
+	}
+	return nil
+}
+
+// checkClaims validates the time-based, issuer, and audience claims. The
+// exp claim is required unless AllowNoExpiry is set.
+func (c *Config) checkClaims(cl *claims) error {
+	now := time.Now()
+
+	if cl.Subject == "" {
+		return errors.New("token has no subject")
+	}
+	if cl.ExpiresAt == nil && !c.AllowNoExpiry {
+		return errors.New("token has no expiry")
+	}
+	if cl.ExpiresAt != nil && now.After(time.Unix(int64(*cl.ExpiresAt), 0).Add(clockSkew)) {
+		return errors.New("token has expired")
+	}
+	if cl.NotBefore != nil && now.Add(clockSkew).Before(time.Unix(int64(*cl.NotBefore), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	if c.Issuer != "" && cl.Issuer != c.Issuer {
+		return errors.New("token issuer is not trusted")
+	}
+	if c.Audience != "" {
+		matched := false
+		for _, aud := range stringOrList(cl.Audience) {
+			if aud == c.Audience {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return errors.New("token audience does not match")
+		}
+	}
+	return nil
+}
+
+// stringOrList decodes a claim that may be a single string or an array of strings.
+func stringOrList(raw json.RawMessage) []string {
+	if len(raw) == 0 {
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list
+	}
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil && single != "" {
+		return strings.Fields(strings.ReplaceAll(single, ",", " "))
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testSecret is the HS256 secret of the test configuration.
+var testSecret = []byte("secretsecretsecretsecretsecret12")
+
+// encodeSegment encodes v as a base64url JSON token segment.
+func encodeSegment(t *testing.T, v interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to encode token segment: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// signHS256 returns a token with claims, its header naming alg, signed with
+// secret.
+func signHS256(t *testing.T, alg string, claims map[string]interface{}, secret []byte) string {
+	t.Helper()
+	input := encodeSegment(t, map[string]string{"alg": alg, "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// signRS256 returns an RS256 token with claims signed with key.
+func signRS256(t *testing.T, claims map[string]interface{}, key *rsa.PrivateKey) string {
+	t.Helper()
+	input := encodeSegment(t, map[string]string{"alg": "RS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// validClaims returns claims for alice that are valid for the next hour.
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":   "alice",
+		"name":  "Alice",
+		"roles": []string{"admin", "analyst"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+// withClaim returns validClaims with key set to value, or removed when
+// value is nil.
+func withClaim(key string, value interface{}) map[string]interface{} {
+	claims := validClaims()
+	if value == nil {
+		delete(claims, key)
+	} else {
+		claims[key] = value
+	}
+	return claims
+}
+
+// withAudience returns claims with aud set to audience.
+func withAudience(claims map[string]interface{}, audience string) map[string]interface{} {
+	claims["aud"] = audience
+	return claims
+}
+
+func TestVerifyHS256(t *testing.T) {
+	config := &Config{Algorithm: "HS256", Secret: testSecret, Issuer: "https://auth.example.com", Audience: "data-chatter"}
+	issued := func(claims map[string]interface{}) map[string]interface{} {
+		claims["iss"] = "https://auth.example.com"
+		claims["aud"] = []string{"other", "data-chatter"}
+		return claims
+	}
+	valid := signHS256(t, "HS256", issued(validClaims()), testSecret)
+	header, payload, _ := strings.Cut(valid, ".")
+	payload, _, _ = strings.Cut(payload, ".")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", valid, ""},
+		{"wrong algorithm", signHS256(t, "HS512", issued(validClaims()), testSecret), "unexpected signing algorithm"},
+		{"RS256 header on HS256 config", signHS256(t, "RS256", issued(validClaims()), testSecret), "unexpected signing algorithm"},
+		{"alg none without signature", encodeSegment(t, map[string]string{"alg": "none"}) + "." + payload + ".", "unexpected signing algorithm"},
+		{"alg None", encodeSegment(t, map[string]string{"alg": "None"}) + "." + payload + ".", "unexpected signing algorithm"},
+		{"bad signature", signHS256(t, "HS256", issued(validClaims()), []byte("another-secret-another-secret-00")), "invalid token signature"},
+		{"tampered payload", header + "." + encodeSegment(t, issued(withClaim("roles", []string{"superuser"}))) + "." + strings.Split(valid, ".")[2], "invalid token signature"},
+		{"expired", signHS256(t, "HS256", issued(withClaim("exp", time.Now().Add(-time.Hour).Unix())), testSecret), "token has expired"},
+		{"expired within clock skew", signHS256(t, "HS256", issued(withClaim("exp", time.Now().Add(-10*time.Second).Unix())), testSecret), ""},
+		{"no expiry", signHS256(t, "HS256", issued(withClaim("exp", nil)), testSecret), "token has no expiry"},
+		{"before nbf", signHS256(t, "HS256", issued(withClaim("nbf", time.Now().Add(time.Hour).Unix())), testSecret), "token is not valid yet"},
+		{"after nbf", signHS256(t, "HS256", issued(withClaim("nbf", time.Now().Add(-time.Minute).Unix())), testSecret), ""},
+		{"no subject", signHS256(t, "HS256", issued(withClaim("sub", nil)), testSecret), "token has no subject"},
+		{"wrong issuer", signHS256(t, "HS256", withClaim("iss", "https://evil.example.com"), testSecret), "token issuer is not trusted"},
+		{"wrong audience", signHS256(t, "HS256", withAudience(issued(validClaims()), "someone-else"), testSecret), "token audience does not match"},
+		{"malformed", "not-a-token", "malformed token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := config.Verify(tt.token)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Verify() = %v, want a user", err)
+				}
+				if user.ID != "alice" || !user.HasRole("analyst") {
+					t.Errorf("Verify() user = %+v, want alice with the analyst role", user)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyAllowNoExpiry(t *testing.T) {
+	config := &Config{Algorithm: "HS256", Secret: testSecret, AllowNoExpiry: true}
+	if _, err := config.Verify(signHS256(t, "HS256", withClaim("exp", nil), testSecret)); err != nil {
+		t.Errorf("Verify() without exp and AllowNoExpiry = %v, want a user", err)
+	}
+	expired := signHS256(t, "HS256", withClaim("exp", time.Now().Add(-time.Hour).Unix()), testSecret)
+	if _, err := config.Verify(expired); err == nil {
+		t.Error("Verify() of an expired token with AllowNoExpiry succeeded, want an error")
+	}
+}
+
+func TestVerifyRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	config := &Config{Algorithm: "RS256", PublicKey: &key.PublicKey}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", signRS256(t, validClaims(), key), ""},
+		{"wrong key", signRS256(t, validClaims(), otherKey), "invalid token signature"},
+		{"expired", signRS256(t, withClaim("exp", time.Now().Add(-time.Hour).Unix()), key), "token has expired"},
+		// An HS256 token signed with the public key as its secret must not
+		// pass as RS256
+		{"HS256 with the public key as secret", signHS256(t, "HS256", validClaims(), key.PublicKey.N.Bytes()), "unexpected signing algorithm"},
+		{"alg none", encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, validClaims()) + ".", "unexpected signing algorithm"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := config.Verify(tt.token)
+			if tt.wantErr == "" {
+				if err != nil || user.ID != "alice" {
+					t.Errorf("Verify() = %+v, %v, want alice", user, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Verify() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	enabled := &Config{Algorithm: "HS256", Secret: testSecret, Required: true}
+	disabled := &Config{Algorithm: "HS256"}
+	admin := signHS256(t, "HS256", validClaims(), testSecret)
+	viewer := signHS256(t, "HS256", withClaim("roles", []string{"viewer"}), testSecret)
+	expired := signHS256(t, "HS256", withClaim("exp", time.Now().Add(-time.Hour).Unix()), testSecret)
+
+	tests := []struct {
+		name   string
+		config *Config
+		token  string
+		want   int
+	}{
+		{"auth off, no token", disabled, "", http.StatusOK},
+		{"auth off, any token", disabled, "garbage", http.StatusOK},
+		{"auth on, no token", enabled, "", http.StatusUnauthorized},
+		{"auth on, role held", enabled, admin, http.StatusOK},
+		{"auth on, role missing", enabled, viewer, http.StatusForbidden},
+		{"auth on, expired token", enabled, expired, http.StatusUnauthorized},
+		{"auth on, bad token", enabled, "garbage", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) })
+			handler := Middleware(tt.config)(RequireRole(tt.config, "admin")(ok))
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/config", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.want, rec.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"data-chatter/internal/apierror"
+)
+
+type contextKey int
+
+const (
+	userKey contextKey = iota
+	tokenKey
+	tenantKey
+)
+
+// publicPaths are reachable without a token even when authentication is required.
+var publicPaths = map[string]bool{
+	"/":        true,
+	"/health":  true,
+	"/readyz":  true,
+	"/version": true,
+}
+
+// IsPublic reports whether path is reachable without a token. The web UI
+// under /ui/ is static; its calls to the API carry the user's token.
+func IsPublic(path string) bool {
+	return publicPaths[path] || path == "/ui" || strings.HasPrefix(path, "/ui/")
+}
+
+// WithUser returns a context carrying the authenticated user and their raw token.
+func WithUser(ctx context.Context, user *User, token string) context.Context {
+	ctx = context.WithValue(ctx, userKey, user)
+	return context.WithValue(ctx, tokenKey, token)
+}
+
+// UserFromContext returns the authenticated user, or nil for anonymous requests.
+func UserFromContext(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey).(*User)
+	return user
+}
+
+// TokenFromContext returns the raw bearer token of the request, if any, so it
+// can be forwarded on internal calls made on the user's behalf.
+func TokenFromContext(ctx context.Context) string {
+	token, _ := ctx.Value(tokenKey).(string)
+	return token
+}
+
+// WithTenant returns a context carrying the tenant a request was resolved to.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey, tenant)
+}
+
+// TenantID returns the tenant of the request, or "" outside multi-tenant mode.
+func TenantID(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey).(string)
+	return tenant
+}
+
+// UserID returns the authenticated user's ID, or "anonymous". In
+// multi-tenant mode it is qualified with the tenant, as in "acme/alice", so
+// everything kept per user is also kept apart per tenant.
+func UserID(ctx context.Context) string {
+	id := "anonymous"
+	if user := UserFromContext(ctx); user != nil {
+		id = user.ID
+	}
+	return TenantUserID(ctx, id)
+}
+
+// TenantUserID qualifies a user ID with the tenant of ctx, if it has one.
+func TenantUserID(ctx context.Context, id string) string {
+	if tenant := TenantID(ctx); tenant != "" {
+		return tenant + "/" + id
+	}
+	return id
+}
+
+// Middleware verifies bearer tokens and attaches the user to the request context.
+// Invalid tokens are always rejected; missing tokens are rejected only when the
+// configuration requires authentication. Event streams may pass the token as an
+// access_token query parameter because browsers cannot set headers on EventSource.
+func Middleware(config *Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !config.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token := bearerToken(r)
+			if token == "" {
+				if config.Required && !IsPublic(r.URL.Path) {
+					writeUnauthorized(w, r, "Authentication required")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user, err := config.Verify(token)
+			if err != nil {
+				writeUnauthorized(w, r, err.Error())
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user, token)))
+		})
+	}
+}
+
+// RequireRole restricts a handler to users with role. When authentication is
+// disabled every request is allowed, matching the rest of the API.
+func RequireRole(config *Config, role string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !config.Enabled() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			user := UserFromContext(r.Context())
+			if user == nil {
+				writeUnauthorized(w, r, "Authentication required")
+				return
+			}
+			if !user.HasRole(role) {
+				apierror.Write(w, r, http.StatusForbidden, "Forbidden", apierror.New(apierror.Forbidden, "The "+role+" role is required"))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// bearerToken extracts the token from the Authorization header or, for GET
+// requests, the access_token query parameter.
+func bearerToken(r *http.Request) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		if scheme, token, ok := strings.Cut(header, " "); ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+	if r.Method == http.MethodGet {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// writeUnauthorized responds with 401 and a JSON error body.
+func writeUnauthorized(w http.ResponseWriter, r *http.Request, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="data-chatter"`)
+	apierror.Write(w, r, http.StatusUnauthorized, "Unauthorized", apierror.New(apierror.Unauthorized, message))
+}
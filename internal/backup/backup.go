@@ -0,0 +1,280 @@
+// Package backup copies the data data-chatter owns, as opposed to the
+// analytical data it queries, into one archive and back, so the chat layer
+// can be recovered on its own: conversations, query history, saved queries,
+// suggested questions, the org context, notification preferences, the
+// audit log, and the dc_ metadata tables, such as the data dictionary and
+// jobs. Archives hold prompts and results, so they are sealed with
+// HISTORY_ENCRYPTION_KEYS when it is set.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"data-chatter/internal/conversation"
+	"data-chatter/internal/database"
+	"data-chatter/internal/encryption"
+	"data-chatter/internal/history"
+	"data-chatter/internal/notify"
+	"data-chatter/internal/orgcontext"
+	"data-chatter/internal/savedqueries"
+	"data-chatter/internal/suggestions"
+)
+
+// Format names the archive format, and Version its revision.
+const (
+	Format  = "data-chatter-backup"
+	Version = 1
+)
+
+// ErrInvalid is returned for data that is not an archive of a supported version.
+var ErrInvalid = errors.New("invalid backup")
+
+// Archive is a backup of everything data-chatter keeps for itself.
+type Archive struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by,omitempty"`
+
+	Conversations []conversation.Conversation     `json:"conversations"`
+	History       map[string][]history.Entry      `json:"history"`       // By user ID
+	SavedQueries  map[string][]savedqueries.Query `json:"saved_queries"` // By user ID
+	Suggestions   []suggestions.Suggestion        `json:"suggestions"`
+	OrgContext    []orgcontext.Version            `json:"org_context"`
+	Notifications map[string]notify.Preferences   `json:"notifications"` // By user ID
+
+	// Audit holds the audit log's entries, oldest first, or is nil when the
+	// log is not written to a file.
+	Audit []json.RawMessage `json:"audit,omitempty"`
+
+	// Tables holds the rows of each metadata table, by table name.
+	Tables map[string]Table `json:"tables"`
+}
+
+// Table is the contents of one metadata table.
+type Table struct {
+	Columns []Column        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Column names a table column and gives its database type, which tells
+// restores which text values are times.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+// UnmarshalJSON keeps numbers exact, so large integers such as Unix
+// millisecond times are restored as they were.
+func (t *Table) UnmarshalJSON(data []byte) error {
+	type table Table
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode((*table)(t))
+}
+
+// New starts an empty archive created by createdBy.
+func New(createdBy string) *Archive {
+	return &Archive{
+		Format:    Format,
+		Version:   Version,
+		CreatedAt: time.Now().UTC(),
+		CreatedBy: createdBy,
+		Tables:    make(map[string]Table),
+	}
+}
+
+// Seal encodes an archive, encrypted with keys when they are set.
+func Seal(a *Archive, keys *encryption.Keyring) ([]byte, error) {
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode backup: %w", err)
+	}
+	sealed, err := keys.Seal(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sealed), nil
+}
+
+// Open decrypts and decodes an archive made by Seal.
+func Open(data []byte, keys *encryption.Keyring) (*Archive, error) {
+	plaintext, err := keys.Open(strings.TrimSpace(string(data)))
+	if err != nil {
+		return nil, err
+	}
+	var a Archive
+	if err := json.Unmarshal([]byte(plaintext), &a); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if a.Format != Format {
+		return nil, fmt.Errorf("%w: format is %q, not %q", ErrInvalid, a.Format, Format)
+	}
+	if a.Version != Version {
+		return nil, fmt.Errorf("%w: version %d is not supported", ErrInvalid, a.Version)
+	}
+	return &a, nil
+}
+
+// DumpTables reads every metadata table on conn. Databases that cannot keep
+// metadata tables have none to dump.
+func DumpTables(ctx context.Context, conn *database.Connection) (map[string]Table, error) {
+	tables := make(map[string]Table)
+	if conn.Config.CheckMetadataTables() != nil {
+		return tables, nil
+	}
+	names, err := conn.MetadataTableNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		table, err := dumpTable(ctx, conn, name)
+		if err != nil {
+			return nil, err
+		}
+		tables[name] = table
+	}
+	return tables, nil
+}
+
+// dumpTable reads every row of the table name.
+func dumpTable(ctx context.Context, conn *database.Connection, name string) (Table, error) {
+	rows, err := conn.DB.QueryContext(ctx, `SELECT * FROM `+conn.Config.QuoteIdentifier(name))
+	if err != nil {
+		return Table{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	defer rows.Close()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return Table{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	table := Table{Columns: make([]Column, len(columnTypes)), Rows: [][]interface{}{}}
+	for i, columnType := range columnTypes {
+		table.Columns[i] = Column{Name: columnType.Name(), Type: columnType.DatabaseTypeName()}
+	}
+
+	for rows.Next() {
+		values := make([]interface{}, len(columnTypes))
+		pointers := make([]interface{}, len(values))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return Table{}, fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+		table.Rows = append(table.Rows, values)
+	}
+	if err := rows.Err(); err != nil {
+		return Table{}, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return table, nil
+}
+
+// RestoreTables replaces the rows of each metadata table on conn with those
+// in tables, all in one transaction, and returns how many rows each table
+// got. Tables the server has not created, because the feature they belong
+// to is off, are skipped and listed.
+func RestoreTables(ctx context.Context, conn *database.Connection, tables map[string]Table) (map[string]int, []string, error) {
+	restored := make(map[string]int)
+	if len(tables) == 0 {
+		return restored, nil, nil
+	}
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, nil, err
+	}
+	names, err := conn.MetadataTableNames(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to begin restore: %w", err)
+	}
+	defer tx.Rollback()
+
+	var skipped []string
+	for _, name := range slices.Sorted(maps.Keys(tables)) {
+		if !slices.Contains(names, name) {
+			skipped = append(skipped, name)
+			continue
+		}
+		table := tables[name]
+		quoted := conn.Config.QuoteIdentifier(name)
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+quoted); err != nil {
+			return nil, nil, fmt.Errorf("failed to clear %s: %w", name, err)
+		}
+		if len(table.Columns) == 0 {
+			restored[name] = 0
+			continue
+		}
+
+		columns := make([]string, len(table.Columns))
+		placeholders := make([]string, len(table.Columns))
+		for i, column := range table.Columns {
+			columns[i] = conn.Config.QuoteIdentifier(column.Name)
+			placeholders[i] = conn.Config.Placeholder(i + 1)
+		}
+		insert, err := tx.PrepareContext(ctx, `INSERT INTO `+quoted+` (`+strings.Join(columns, ", ")+`) VALUES (`+strings.Join(placeholders, ", ")+`)`)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+		for _, row := range table.Rows {
+			if len(row) != len(table.Columns) {
+				insert.Close()
+				return nil, nil, fmt.Errorf("%w: a row of %s has %d values for %d columns", ErrInvalid, name, len(row), len(table.Columns))
+			}
+			args := make([]interface{}, len(row))
+			for i, value := range row {
+				args[i] = restoreValue(table.Columns[i], value)
+			}
+			if _, err := insert.ExecContext(ctx, args...); err != nil {
+				insert.Close()
+				return nil, nil, fmt.Errorf("failed to restore %s: %w", name, err)
+			}
+		}
+		insert.Close()
+		restored[name] = len(table.Rows)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("failed to commit restore: %w", err)
+	}
+	return restored, skipped, nil
+}
+
+// restoreValue converts a value decoded from an archive back into what the
+// driver takes for column: exact numbers to integers where they are whole,
+// and times, which JSON holds as text, to time.Time.
+func restoreValue(column Column, value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case string:
+		columnType := strings.ToUpper(column.Type)
+		if strings.Contains(columnType, "TIME") || strings.Contains(columnType, "DATE") {
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t
+			}
+		}
+	}
+	return value
+}
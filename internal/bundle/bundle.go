@@ -0,0 +1,132 @@
+// Package bundle packs a deployment's chat setup, that is its data
+// dictionary, org context, saved queries, suggested questions, and access
+// policy, into a bundle signed with CONFIG_BUNDLE_KEY, so a setup tuned in
+// one environment can be promoted to another that shares the key.
+package bundle
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/rbac"
+	"data-chatter/internal/savedqueries"
+	"data-chatter/internal/suggestions"
+)
+
+// Format names the bundle format, and Version its revision.
+const (
+	Format  = "data-chatter-config"
+	Version = 1
+)
+
+var (
+	// ErrNoKey is returned when CONFIG_BUNDLE_KEY is not set.
+	ErrNoKey = errors.New("CONFIG_BUNDLE_KEY is not set")
+
+	// ErrInvalid is returned for data that is not a bundle of a supported version.
+	ErrInvalid = errors.New("invalid config bundle")
+
+	// ErrBadSignature is returned for bundles not signed with this server's
+	// key, or changed after they were signed.
+	ErrBadSignature = errors.New("config bundle signature does not match")
+)
+
+// Contents is the chat setup carried by a bundle. Empty sections are left
+// alone on import rather than cleared.
+type Contents struct {
+	Dictionary   []dictionary.Entry              `json:"dictionary"`
+	OrgContext   string                          `json:"org_context,omitempty"`
+	SavedQueries map[string][]savedqueries.Query `json:"saved_queries"` // By owner's user ID
+	Suggestions  []suggestions.Suggestion        `json:"suggestions"`
+	Policy       *rbac.Policy                    `json:"policy,omitempty"`
+}
+
+// Bundle is the signed form of Contents. Signature is the HMAC-SHA256 of
+// the bundle's JSON without it, so reformatting the file keeps it valid but
+// editing any value does not.
+type Bundle struct {
+	Format     string          `json:"format"`
+	Version    int             `json:"version"`
+	ExportedAt time.Time       `json:"exported_at"`
+	ExportedBy string          `json:"exported_by,omitempty"`
+	Contents   json.RawMessage `json:"contents"`
+	Signature  string          `json:"signature"`
+}
+
+// KeyFromEnv returns the signing key in CONFIG_BUNDLE_KEY.
+func KeyFromEnv() ([]byte, error) {
+	key := os.Getenv("CONFIG_BUNDLE_KEY")
+	if key == "" {
+		return nil, ErrNoKey
+	}
+	return []byte(key), nil
+}
+
+// Seal signs contents exported by exportedBy with key.
+func Seal(contents Contents, exportedBy string, key []byte) (*Bundle, error) {
+	raw, err := json.Marshal(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode config bundle: %w", err)
+	}
+	b := &Bundle{
+		Format:     Format,
+		Version:    Version,
+		ExportedAt: time.Now().UTC(),
+		ExportedBy: exportedBy,
+		Contents:   raw,
+	}
+	b.Signature, err = b.sign(key)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Open checks that data is a bundle signed with key and returns it with
+// its contents.
+func Open(data []byte, key []byte) (*Bundle, Contents, error) {
+	var b Bundle
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, Contents{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if b.Format != Format {
+		return nil, Contents{}, fmt.Errorf("%w: format is %q, not %q", ErrInvalid, b.Format, Format)
+	}
+	if b.Version != Version {
+		return nil, Contents{}, fmt.Errorf("%w: version %d is not supported", ErrInvalid, b.Version)
+	}
+
+	expected, err := b.sign(key)
+	if err != nil {
+		return nil, Contents{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	if !hmac.Equal([]byte(expected), []byte(b.Signature)) {
+		return nil, Contents{}, ErrBadSignature
+	}
+
+	var contents Contents
+	if err := json.Unmarshal(b.Contents, &contents); err != nil {
+		return nil, Contents{}, fmt.Errorf("%w: contents: %v", ErrInvalid, err)
+	}
+	return &b, contents, nil
+}
+
+// sign returns the signature of b's fields other than Signature, in the
+// form "sha256=<hex>".
+func (b Bundle) sign(key []byte) (string, error) {
+	b.Signature = ""
+	data, err := json.Marshal(b)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil)), nil
+}
@@ -0,0 +1,411 @@
+// Package calc evaluates the arithmetic expressions of the calculate tool,
+// such as "pct_change(1200, 1380)" or "date('2025-03-31') - date('2025-01-01')",
+// so derived figures are computed exactly rather than by the LLM. The
+// grammar has numbers, dates, variables, the operators + - * / % ^, and a
+// fixed set of functions; it cannot loop, call out, or read anything but
+// the variables it is given, so any expression finishes quickly.
+package calc
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// MaxLength bounds an expression's length, and maxDepth its nesting.
+	MaxLength = 2000
+	maxDepth  = 64
+)
+
+// ErrInvalid is returned for expressions that do not parse or cannot be
+// evaluated, such as a division by zero.
+var ErrInvalid = errors.New("invalid expression")
+
+// Value is a number or a date.
+type Value struct {
+	Number float64
+	Date   time.Time
+	IsDate bool
+}
+
+// NumberValue returns n as a value.
+func NumberValue(n float64) Value {
+	return Value{Number: n}
+}
+
+// DateValue returns the day of t, in UTC, as a value.
+func DateValue(t time.Time) Value {
+	return Value{Date: t.UTC().Truncate(24 * time.Hour), IsDate: true}
+}
+
+// kind names v's type in error messages.
+func (v Value) kind() string {
+	if v.IsDate {
+		return "date"
+	}
+	return "number"
+}
+
+// invalid returns an ErrInvalid error with the formatted message.
+func invalid(format string, a ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalid, fmt.Sprintf(format, a...))
+}
+
+// String renders a date as YYYY-MM-DD and a number with at most 15
+// significant digits, so float artifacts such as 0.30000000000000004 read
+// as 0.3.
+func (v Value) String() string {
+	if v.IsDate {
+		return v.Date.Format(time.DateOnly)
+	}
+	return strconv.FormatFloat(v.Number, 'g', 15, 64)
+}
+
+// Result returns v as a JSON-ready value: a YYYY-MM-DD string for a date,
+// and a float64 rounded to 15 significant digits for a number.
+func (v Value) Result() interface{} {
+	if v.IsDate {
+		return v.String()
+	}
+	n, _ := strconv.ParseFloat(v.String(), 64)
+	return n
+}
+
+// ParseValue reads a variable's value: a number, or a YYYY-MM-DD date.
+func ParseValue(raw interface{}) (Value, error) {
+	switch value := raw.(type) {
+	case float64:
+		return NumberValue(value), nil
+	case int:
+		return NumberValue(float64(value)), nil
+	case string:
+		if date, err := time.Parse(time.DateOnly, value); err == nil {
+			return DateValue(date), nil
+		}
+		if n, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64); err == nil {
+			return NumberValue(n), nil
+		}
+	}
+	return Value{}, invalid("%v is neither a number nor a YYYY-MM-DD date", raw)
+}
+
+// Evaluate evaluates expression with the given variables.
+func Evaluate(expression string, variables map[string]Value) (Value, error) {
+	if len(expression) > MaxLength {
+		return Value{}, invalid("expression is longer than %d characters", MaxLength)
+	}
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return Value{}, err
+	}
+	p := &parser{tokens: tokens, variables: variables}
+	value, err := p.expression(0)
+	if err != nil {
+		return Value{}, err
+	}
+	if p.pos < len(p.tokens) {
+		return Value{}, invalid("unexpected %q", p.tokens[p.pos].text)
+	}
+	if !value.IsDate && (math.IsNaN(value.Number) || math.IsInf(value.Number, 0)) {
+		return Value{}, invalid("the result is not a finite number")
+	}
+	return value, nil
+}
+
+// Functions lists the function signatures, for the tool's description.
+func Functions() []string {
+	names := make([]string, 0, len(functions))
+	for name, f := range functions {
+		names = append(names, name+"("+f.args+")")
+	}
+	sort.Strings(names)
+	return names
+}
+
+// token kinds.
+const (
+	tokenNumber = iota
+	tokenString
+	tokenName
+	tokenOperator
+)
+
+// token is a lexical token of an expression.
+type token struct {
+	kind   int
+	text   string
+	number float64
+}
+
+// tokenize splits expression into numbers, quoted strings, names, and
+// operators. Numbers may have thousands separators written as _.
+func tokenize(expression string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(expression); {
+		c := rune(expression[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c >= '0' && c <= '9' || c == '.':
+			j := i
+			for j < len(expression) && (isDigit(expression[j]) || expression[j] == '.' || expression[j] == '_') {
+				j++
+			}
+			if j < len(expression) && (expression[j] == 'e' || expression[j] == 'E') {
+				k := j + 1
+				if k < len(expression) && (expression[k] == '+' || expression[k] == '-') {
+					k++
+				}
+				if k < len(expression) && isDigit(expression[k]) {
+					for j = k; j < len(expression) && isDigit(expression[j]); j++ {
+					}
+				}
+			}
+			text := expression[i:j]
+			n, err := strconv.ParseFloat(strings.ReplaceAll(text, "_", ""), 64)
+			if err != nil {
+				return nil, invalid("bad number %q", text)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: text, number: n})
+			i = j
+		case c == '\'' || c == '"':
+			end := strings.IndexByte(expression[i+1:], byte(c))
+			if end < 0 {
+				return nil, invalid("unterminated string at offset %d", i)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: expression[i+1 : i+1+end]})
+			i += end + 2
+		case c == '_' || unicode.IsLetter(c):
+			j := i
+			for j < len(expression) && (expression[j] == '_' || isDigit(expression[j]) || unicode.IsLetter(rune(expression[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenName, text: expression[i:j]})
+			i = j
+		case strings.ContainsRune("+-*/%^(),", c):
+			tokens = append(tokens, token{kind: tokenOperator, text: string(c)})
+			i++
+		default:
+			return nil, invalid("unexpected character %q at offset %d", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+// isDigit reports whether c is an ASCII digit.
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parser is a precedence-climbing parser that evaluates as it parses.
+type parser struct {
+	tokens    []token
+	pos       int
+	depth     int
+	variables map[string]Value
+}
+
+// binary operators by precedence; ^ is right-associative.
+var precedence = map[string]int{"+": 1, "-": 1, "*": 2, "/": 2, "%": 2, "^": 3}
+
+// expression parses operators binding at least as tightly as min.
+func (p *parser) expression(min int) (Value, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxDepth {
+		return Value{}, invalid("expression is nested more than %d deep", maxDepth)
+	}
+
+	left, err := p.unary()
+	if err != nil {
+		return Value{}, err
+	}
+	for p.pos < len(p.tokens) {
+		op := p.tokens[p.pos]
+		prec, ok := precedence[op.text]
+		if op.kind != tokenOperator || !ok || prec < min {
+			break
+		}
+		p.pos++
+		next := prec + 1
+		if op.text == "^" {
+			next = prec
+		}
+		right, err := p.expression(next)
+		if err != nil {
+			return Value{}, err
+		}
+		if left, err = apply(op.text, left, right); err != nil {
+			return Value{}, err
+		}
+	}
+	return left, nil
+}
+
+// unary parses a signed operand.
+func (p *parser) unary() (Value, error) {
+	if p.peek("-") || p.peek("+") {
+		negate := p.peek("-")
+		p.pos++
+		value, err := p.expression(precedence["^"])
+		if err != nil {
+			return Value{}, err
+		}
+		if value.IsDate {
+			return Value{}, invalid("a date cannot be signed")
+		}
+		if negate {
+			value.Number = -value.Number
+		}
+		return value, nil
+	}
+	return p.operand()
+}
+
+// operand parses a number, a date string, a variable, a function call, or
+// a parenthesized expression.
+func (p *parser) operand() (Value, error) {
+	if p.pos >= len(p.tokens) {
+		return Value{}, invalid("unexpected end of expression")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	switch t.kind {
+	case tokenNumber:
+		return NumberValue(t.number), nil
+	case tokenString:
+		date, err := time.Parse(time.DateOnly, t.text)
+		if err != nil {
+			return Value{}, invalid("%q is not a YYYY-MM-DD date", t.text)
+		}
+		return DateValue(date), nil
+	case tokenName:
+		if p.peek("(") {
+			return p.call(t.text)
+		}
+		if value, ok := p.variables[t.text]; ok {
+			return value, nil
+		}
+		if _, ok := functions[strings.ToLower(t.text)]; ok {
+			return Value{}, invalid("%s is a function; call it as %s(...)", t.text, t.text)
+		}
+		return Value{}, invalid("unknown variable %q", t.text)
+	}
+	if t.kind == tokenOperator && t.text == "(" {
+		value, err := p.expression(0)
+		if err != nil {
+			return Value{}, err
+		}
+		if err := p.expect(")"); err != nil {
+			return Value{}, err
+		}
+		return value, nil
+	}
+	return Value{}, invalid("unexpected %q", t.text)
+}
+
+// call parses the arguments of a call to name and applies it.
+func (p *parser) call(name string) (Value, error) {
+	f, ok := functions[strings.ToLower(name)]
+	if !ok {
+		return Value{}, invalid("unknown function %q", name)
+	}
+	p.pos++ // (
+	var args []Value
+	if p.peek(")") {
+		p.pos++
+	} else {
+		for {
+			arg, err := p.expression(0)
+			if err != nil {
+				return Value{}, err
+			}
+			args = append(args, arg)
+			if p.peek(",") {
+				p.pos++
+				continue
+			}
+			if err := p.expect(")"); err != nil {
+				return Value{}, err
+			}
+			break
+		}
+	}
+	if len(args) < f.min || f.max >= 0 && len(args) > f.max {
+		return Value{}, invalid("%s takes (%s)", name, f.args)
+	}
+	return f.apply(args)
+}
+
+// peek reports whether the next token is the operator text.
+func (p *parser) peek(text string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOperator && p.tokens[p.pos].text == text
+}
+
+// expect consumes the operator text, or fails.
+func (p *parser) expect(text string) error {
+	if !p.peek(text) {
+		return invalid("expected %q", text)
+	}
+	p.pos++
+	return nil
+}
+
+// apply applies a binary operator. Dates may be subtracted, giving days,
+// and have days added or subtracted.
+func apply(op string, left, right Value) (Value, error) {
+	switch {
+	case left.IsDate && right.IsDate:
+		if op == "-" {
+			return NumberValue(left.Date.Sub(right.Date).Hours() / 24), nil
+		}
+		return Value{}, invalid("dates can only be subtracted from each other")
+	case left.IsDate:
+		if op != "+" && op != "-" || right.Number != math.Trunc(right.Number) {
+			return Value{}, invalid("only whole days can be added to or subtracted from a date")
+		}
+		days := int(right.Number)
+		if op == "-" {
+			days = -days
+		}
+		return DateValue(left.Date.AddDate(0, 0, days)), nil
+	case right.IsDate:
+		if op != "+" || left.Number != math.Trunc(left.Number) {
+			return Value{}, invalid("a %s cannot be combined with a date by %q", left.kind(), op)
+		}
+		return DateValue(right.Date.AddDate(0, 0, int(left.Number))), nil
+	}
+
+	a, b := left.Number, right.Number
+	switch op {
+	case "+":
+		return NumberValue(a + b), nil
+	case "-":
+		return NumberValue(a - b), nil
+	case "*":
+		return NumberValue(a * b), nil
+	case "/":
+		if b == 0 {
+			return Value{}, invalid("division by zero")
+		}
+		return NumberValue(a / b), nil
+	case "%":
+		if b == 0 {
+			return Value{}, invalid("modulo by zero")
+		}
+		return NumberValue(math.Mod(a, b)), nil
+	case "^":
+		result := math.Pow(a, b)
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			return Value{}, invalid("%v ^ %v is not a finite number", a, b)
+		}
+		return NumberValue(result), nil
+	}
+	return Value{}, invalid("unknown operator %q", op)
+}
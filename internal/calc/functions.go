@@ -0,0 +1,215 @@
+package calc
+
+import (
+	"math"
+	"time"
+)
+
+// function is a built-in function taking min to max arguments (max -1 for
+// any number), described by args.
+type function struct {
+	args     string
+	min, max int
+	apply    func(args []Value) (Value, error)
+}
+
+// functions are the built-in functions, by lowercase name.
+var functions = map[string]function{
+	"abs":   numeric("x", math.Abs),
+	"floor": numeric("x", math.Floor),
+	"ceil":  numeric("x", math.Ceil),
+	"sqrt": {args: "x", min: 1, max: 1, apply: func(args []Value) (Value, error) {
+		x, err := numbers("sqrt", args)
+		if err != nil {
+			return Value{}, err
+		}
+		if x[0] < 0 {
+			return Value{}, invalid("sqrt of a negative number")
+		}
+		return NumberValue(math.Sqrt(x[0])), nil
+	}},
+	"ln": {args: "x", min: 1, max: 1, apply: func(args []Value) (Value, error) {
+		x, err := numbers("ln", args)
+		if err != nil {
+			return Value{}, err
+		}
+		if x[0] <= 0 {
+			return Value{}, invalid("ln of a number that is not positive")
+		}
+		return NumberValue(math.Log(x[0])), nil
+	}},
+	"round": {args: "x, digits=0", min: 1, max: 2, apply: func(args []Value) (Value, error) {
+		x, err := numbers("round", args)
+		if err != nil {
+			return Value{}, err
+		}
+		digits := 0.0
+		if len(x) == 2 {
+			digits = x[1]
+		}
+		if digits != math.Trunc(digits) || math.Abs(digits) > 15 {
+			return Value{}, invalid("round digits must be a whole number between -15 and 15")
+		}
+		scale := math.Pow(10, digits)
+		return NumberValue(math.Round(x[0]*scale) / scale), nil
+	}},
+	"min": aggregate("min", func(x []float64) float64 {
+		result := x[0]
+		for _, n := range x[1:] {
+			result = math.Min(result, n)
+		}
+		return result
+	}),
+	"max": aggregate("max", func(x []float64) float64 {
+		result := x[0]
+		for _, n := range x[1:] {
+			result = math.Max(result, n)
+		}
+		return result
+	}),
+	"sum": aggregate("sum", sum),
+	"avg": aggregate("avg", func(x []float64) float64 {
+		return sum(x) / float64(len(x))
+	}),
+
+	// Percentages and growth
+	"pct": {args: "part, whole", min: 2, max: 2, apply: func(args []Value) (Value, error) {
+		x, err := numbers("pct", args)
+		if err != nil {
+			return Value{}, err
+		}
+		if x[1] == 0 {
+			return Value{}, invalid("pct of a whole of zero")
+		}
+		return NumberValue(x[0] / x[1] * 100), nil
+	}},
+	"pct_change": {args: "from, to", min: 2, max: 2, apply: func(args []Value) (Value, error) {
+		x, err := numbers("pct_change", args)
+		if err != nil {
+			return Value{}, err
+		}
+		if x[0] == 0 {
+			return Value{}, invalid("pct_change from zero")
+		}
+		return NumberValue((x[1] - x[0]) / math.Abs(x[0]) * 100), nil
+	}},
+	"cagr": {args: "from, to, years", min: 3, max: 3, apply: func(args []Value) (Value, error) {
+		x, err := numbers("cagr", args)
+		if err != nil {
+			return Value{}, err
+		}
+		if x[0] <= 0 || x[1] < 0 || x[2] <= 0 {
+			return Value{}, invalid("cagr needs a positive from, a to of at least zero, and positive years")
+		}
+		return NumberValue((math.Pow(x[1]/x[0], 1/x[2]) - 1) * 100), nil
+	}},
+
+	// Dates
+	"date": {args: "'YYYY-MM-DD'", min: 1, max: 1, apply: func(args []Value) (Value, error) {
+		if !args[0].IsDate {
+			return Value{}, invalid("date takes a 'YYYY-MM-DD' string")
+		}
+		return args[0], nil
+	}},
+	"today": {args: "", min: 0, max: 0, apply: func([]Value) (Value, error) {
+		return DateValue(time.Now()), nil
+	}},
+	"days_between": {args: "from, to", min: 2, max: 2, apply: func(args []Value) (Value, error) {
+		d, err := dates("days_between", args)
+		if err != nil {
+			return Value{}, err
+		}
+		return NumberValue(d[1].Sub(d[0]).Hours() / 24), nil
+	}},
+	"add_days": {args: "date, days", min: 2, max: 2, apply: func(args []Value) (Value, error) {
+		return shift("add_days", args, func(t time.Time, n int) time.Time { return t.AddDate(0, 0, n) })
+	}},
+	"add_months": {args: "date, months", min: 2, max: 2, apply: func(args []Value) (Value, error) {
+		return shift("add_months", args, addMonths)
+	}},
+	"year":    datePart("year", func(t time.Time) int { return t.Year() }),
+	"month":   datePart("month", func(t time.Time) int { return int(t.Month()) }),
+	"day":     datePart("day", func(t time.Time) int { return t.Day() }),
+	"weekday": datePart("weekday", func(t time.Time) int { return (int(t.Weekday())+6)%7 + 1 }),
+}
+
+// numeric makes a function of one number.
+func numeric(args string, f func(float64) float64) function {
+	return function{args: args, min: 1, max: 1, apply: func(values []Value) (Value, error) {
+		if values[0].IsDate {
+			return Value{}, invalid("expected a number, not a date")
+		}
+		return NumberValue(f(values[0].Number)), nil
+	}}
+}
+
+// aggregate makes a function of one or more numbers.
+func aggregate(name string, f func([]float64) float64) function {
+	return function{args: "x, ...", min: 1, max: -1, apply: func(args []Value) (Value, error) {
+		x, err := numbers(name, args)
+		if err != nil {
+			return Value{}, err
+		}
+		return NumberValue(f(x)), nil
+	}}
+}
+
+// datePart makes a function returning a part of a date, such as its year.
+func datePart(name string, part func(time.Time) int) function {
+	return function{args: "date", min: 1, max: 1, apply: func(args []Value) (Value, error) {
+		d, err := dates(name, args)
+		if err != nil {
+			return Value{}, err
+		}
+		return NumberValue(float64(part(d[0]))), nil
+	}}
+}
+
+// shift moves a date by a whole number of units.
+func shift(name string, args []Value, move func(time.Time, int) time.Time) (Value, error) {
+	if !args[0].IsDate || args[1].IsDate || args[1].Number != math.Trunc(args[1].Number) {
+		return Value{}, invalid("%s takes a date and a whole number", name)
+	}
+	return DateValue(move(args[0].Date, int(args[1].Number))), nil
+}
+
+// addMonths adds n months to t, ending on the last day of the month when
+// t's day is past it, so 2025-01-31 plus a month is 2025-02-28.
+func addMonths(t time.Time, n int) time.Time {
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, n, 0)
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(t.Day(), last)-1)
+}
+
+// numbers returns args as numbers, failing on a date.
+func numbers(name string, args []Value) ([]float64, error) {
+	x := make([]float64, len(args))
+	for i, arg := range args {
+		if arg.IsDate {
+			return nil, invalid("%s takes numbers, not dates", name)
+		}
+		x[i] = arg.Number
+	}
+	return x, nil
+}
+
+// dates returns args as dates, failing on a number.
+func dates(name string, args []Value) ([]time.Time, error) {
+	d := make([]time.Time, len(args))
+	for i, arg := range args {
+		if !arg.IsDate {
+			return nil, invalid("%s takes dates, not numbers", name)
+		}
+		d[i] = arg.Date
+	}
+	return d, nil
+}
+
+// sum adds up x.
+func sum(x []float64) float64 {
+	var total float64
+	for _, n := range x {
+		total += n
+	}
+	return total
+}
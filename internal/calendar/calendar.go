@@ -0,0 +1,241 @@
+// Package calendar describes the organization's business calendars: when
+// the fiscal year starts, which day starts the week, which days are
+// weekends, and which are holidays. The calendars are described in the
+// LLM's system prompt and resolve periods for the date_range tool, so "last
+// fiscal quarter" and "business days this month" mean the same thing in
+// every answer.
+package calendar
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Fiscal year naming.
+const (
+	// NamingEnd names a fiscal year after the calendar year it ends in, so
+	// a year starting October 2024 is FY2025.
+	NamingEnd = "end"
+
+	// NamingStart names a fiscal year after the calendar year it starts in.
+	NamingStart = "start"
+)
+
+// DefaultName names the calendar used when BUSINESS_CALENDARS is unset.
+const DefaultName = "standard"
+
+// Calendar is a business calendar as configured.
+type Calendar struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+
+	// FiscalYearStart is the month the fiscal year starts, 1 to 12
+	// (default 1, January).
+	FiscalYearStart int `json:"fiscal_year_start,omitempty" yaml:"fiscal_year_start" toml:"fiscal_year_start"`
+
+	// FiscalYearNaming is NamingEnd (the default) or NamingStart.
+	FiscalYearNaming string `json:"fiscal_year_naming,omitempty" yaml:"fiscal_year_naming" toml:"fiscal_year_naming"`
+
+	// WeekStart is the day weeks start on (default monday).
+	WeekStart string `json:"week_start,omitempty" yaml:"week_start" toml:"week_start"`
+
+	// Weekend lists the days that are not business days (default saturday
+	// and sunday).
+	Weekend []string `json:"weekend,omitempty" yaml:"weekend" toml:"weekend"`
+
+	// Holidays are days off besides weekends.
+	Holidays []Holiday `json:"holidays,omitempty" yaml:"holidays" toml:"holidays"`
+
+	// TimeZone is the IANA zone "today" is in (default the server's).
+	TimeZone string `json:"time_zone,omitempty" yaml:"time_zone" toml:"time_zone"`
+
+	weekStart time.Weekday
+	weekend   map[time.Weekday]bool
+	location  *time.Location
+}
+
+// Holiday is a day off: a date, YYYY-MM-DD, or a date every year, MM-DD.
+type Holiday struct {
+	Date string `json:"date" yaml:"date" toml:"date"`
+	Name string `json:"name,omitempty" yaml:"name" toml:"name"`
+}
+
+// Set is the configured calendars. The first is the default.
+type Set struct {
+	Calendars []*Calendar
+
+	// Configured is false when the set holds only the standard calendar
+	// used without BUSINESS_CALENDARS.
+	Configured bool
+}
+
+// FromEnv reads the calendars in BUSINESS_CALENDARS, a JSON array of
+// calendars. When it is unset, the set holds one standard calendar: a
+// fiscal year starting in January, weeks starting on Monday, weekends on
+// Saturday and Sunday, and no holidays.
+func FromEnv() (*Set, error) {
+	value := os.Getenv("BUSINESS_CALENDARS")
+	if strings.TrimSpace(value) == "" {
+		standard := &Calendar{Name: DefaultName}
+		if err := standard.check(); err != nil {
+			return nil, err
+		}
+		return &Set{Calendars: []*Calendar{standard}}, nil
+	}
+
+	var calendars []*Calendar
+	if err := json.Unmarshal([]byte(value), &calendars); err != nil {
+		return nil, fmt.Errorf("invalid BUSINESS_CALENDARS: %w", err)
+	}
+	if len(calendars) == 0 {
+		return nil, fmt.Errorf("invalid BUSINESS_CALENDARS: no calendars")
+	}
+	seen := make(map[string]bool)
+	for i, c := range calendars {
+		if c == nil {
+			return nil, fmt.Errorf("invalid BUSINESS_CALENDARS: entry %d is null", i)
+		}
+		if err := c.check(); err != nil {
+			return nil, fmt.Errorf("invalid BUSINESS_CALENDARS: entry %d: %w", i, err)
+		}
+		if seen[strings.ToLower(c.Name)] {
+			return nil, fmt.Errorf("invalid BUSINESS_CALENDARS: calendar %q is defined twice", c.Name)
+		}
+		seen[strings.ToLower(c.Name)] = true
+	}
+	return &Set{Calendars: calendars, Configured: true}, nil
+}
+
+// Get returns the calendar with name, ignoring case, or the default
+// calendar when name is empty.
+func (s *Set) Get(name string) (*Calendar, bool) {
+	if name == "" {
+		return s.Default(), true
+	}
+	for _, c := range s.Calendars {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Default returns the default calendar.
+func (s *Set) Default() *Calendar {
+	return s.Calendars[0]
+}
+
+// Names returns the calendars' names.
+func (s *Set) Names() []string {
+	names := make([]string, len(s.Calendars))
+	for i, c := range s.Calendars {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// check validates a calendar and fills in its defaults.
+func (c *Calendar) check() error {
+	c.Name = strings.TrimSpace(c.Name)
+	if c.Name == "" {
+		return fmt.Errorf("a name is required")
+	}
+	if c.FiscalYearStart == 0 {
+		c.FiscalYearStart = 1
+	}
+	if c.FiscalYearStart < 1 || c.FiscalYearStart > 12 {
+		return fmt.Errorf("calendar %q: fiscal_year_start must be a month from 1 to 12", c.Name)
+	}
+	switch c.FiscalYearNaming {
+	case "":
+		c.FiscalYearNaming = NamingEnd
+	case NamingEnd, NamingStart:
+	default:
+		return fmt.Errorf("calendar %q: fiscal_year_naming must be %s or %s", c.Name, NamingEnd, NamingStart)
+	}
+
+	if c.WeekStart == "" {
+		c.WeekStart = "monday"
+	}
+	var ok bool
+	if c.weekStart, ok = ParseWeekday(c.WeekStart); !ok {
+		return fmt.Errorf("calendar %q: unknown week_start %q", c.Name, c.WeekStart)
+	}
+	if c.Weekend == nil {
+		c.Weekend = []string{"saturday", "sunday"}
+	}
+	c.weekend = make(map[time.Weekday]bool)
+	for _, name := range c.Weekend {
+		day, ok := ParseWeekday(name)
+		if !ok {
+			return fmt.Errorf("calendar %q: unknown weekend day %q", c.Name, name)
+		}
+		c.weekend[day] = true
+	}
+	if len(c.weekend) == 7 {
+		return fmt.Errorf("calendar %q: every day is a weekend day", c.Name)
+	}
+
+	for _, holiday := range c.Holidays {
+		if _, _, ok := holiday.parse(); !ok {
+			return fmt.Errorf("calendar %q: holiday date %q is not YYYY-MM-DD or MM-DD", c.Name, holiday.Date)
+		}
+	}
+
+	c.location = time.Local
+	if c.TimeZone != "" {
+		location, err := time.LoadLocation(c.TimeZone)
+		if err != nil {
+			return fmt.Errorf("calendar %q: unknown time_zone %q", c.Name, c.TimeZone)
+		}
+		c.location = location
+	}
+	return nil
+}
+
+// ParseWeekday reads an English day name or its three-letter
+// abbreviation, in any case.
+func ParseWeekday(name string) (time.Weekday, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if len(name) < 3 {
+		return 0, false
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, true
+		}
+	}
+	return 0, false
+}
+
+// WeekStartDay returns the day weeks start on.
+func (c *Calendar) WeekStartDay() time.Weekday {
+	return c.weekStart
+}
+
+// Today returns the current date in the calendar's time zone.
+func (c *Calendar) Today() time.Time {
+	now := time.Now().In(c.location)
+	return date(now.Year(), now.Month(), now.Day())
+}
+
+// parse reads the holiday's date: a year, or 0 for every year, and the day.
+func (h Holiday) parse() (int, time.Time, bool) {
+	if t, err := time.Parse(time.DateOnly, h.Date); err == nil {
+		return t.Year(), t, true
+	}
+	// Parse every-year dates in a leap year, so 02-29 is valid
+	if t, err := time.Parse("2006-01-02", "2000-"+h.Date); err == nil && len(h.Date) == 5 {
+		return 0, t, true
+	}
+	return 0, time.Time{}, false
+}
+
+// date returns midnight UTC of a day. Calendar arithmetic is done on such
+// days, so daylight saving time never shifts them.
+func date(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
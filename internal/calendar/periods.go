@@ -0,0 +1,238 @@
+package calendar
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Period units.
+const (
+	Day           = "day"
+	Week          = "week"
+	Month         = "month"
+	Quarter       = "quarter"
+	Year          = "year"
+	FiscalQuarter = "fiscal_quarter"
+	FiscalYear    = "fiscal_year"
+)
+
+// Units lists the period units, for the date_range tool's schema.
+var Units = []string{Day, Week, Month, Quarter, Year, FiscalQuarter, FiscalYear}
+
+// MaxRangeDays bounds the ranges business days are counted over.
+const MaxRangeDays = 3660
+
+// Range is a span of whole days, from Start to End inclusive.
+type Range struct {
+	Label string
+	Start time.Time
+	End   time.Time
+}
+
+// Days returns the number of days in the range.
+func (r Range) Days() int {
+	return int(r.End.Sub(r.Start).Hours()/24) + 1
+}
+
+// DayOff is a holiday on a particular date.
+type DayOff struct {
+	Date string `json:"date"`
+	Name string `json:"name,omitempty"`
+}
+
+// Period returns the period of unit containing anchor, moved by offset
+// periods: 0 is the current period, -1 the previous one, 1 the next. With
+// toDate, a period containing anchor ends at anchor, so "this quarter to
+// date" stops today.
+func (c *Calendar) Period(unit string, offset int, anchor time.Time, toDate bool) (Range, error) {
+	anchor = date(anchor.Year(), anchor.Month(), anchor.Day())
+	var r Range
+	switch unit {
+	case Day:
+		start := anchor.AddDate(0, 0, offset)
+		r = Range{Label: start.Format(time.DateOnly), Start: start, End: start}
+	case Week:
+		back := (int(anchor.Weekday()) - int(c.weekStart) + 7) % 7
+		start := anchor.AddDate(0, 0, 7*offset-back)
+		r = Range{Label: "Week of " + start.Format(time.DateOnly), Start: start, End: start.AddDate(0, 0, 6)}
+	case Month:
+		start := date(anchor.Year(), anchor.Month()+time.Month(offset), 1)
+		r = Range{Label: start.Format("January 2006"), Start: start, End: start.AddDate(0, 1, -1)}
+	case Quarter:
+		start := date(anchor.Year(), anchor.Month()-(anchor.Month()-1)%3+time.Month(3*offset), 1)
+		r = Range{
+			Label: fmt.Sprintf("Q%d %d", (int(start.Month())-1)/3+1, start.Year()),
+			Start: start,
+			End:   start.AddDate(0, 3, -1),
+		}
+	case Year:
+		start := date(anchor.Year()+offset, time.January, 1)
+		r = Range{Label: fmt.Sprint(start.Year()), Start: start, End: start.AddDate(1, 0, -1)}
+	case FiscalQuarter:
+		yearStart := c.fiscalYearStart(anchor)
+		quarter := monthsBetween(yearStart, anchor)/3 + offset
+		start := yearStart.AddDate(0, 3*quarter, 0)
+		r = Range{
+			Label: c.fiscalQuarterLabel(start),
+			Start: start,
+			End:   start.AddDate(0, 3, -1),
+		}
+	case FiscalYear:
+		start := c.fiscalYearStart(anchor).AddDate(offset, 0, 0)
+		r = Range{Label: c.fiscalYearLabel(start), Start: start, End: start.AddDate(1, 0, -1)}
+	default:
+		return Range{}, fmt.Errorf("unknown period %q; use one of %s", unit, strings.Join(Units, ", "))
+	}
+
+	if toDate && unit != Day && !anchor.Before(r.Start) && !anchor.After(r.End) {
+		r.End = anchor
+		r.Label += " to date"
+	}
+	return r, nil
+}
+
+// fiscalYearStart returns the first day of the fiscal year containing day.
+func (c *Calendar) fiscalYearStart(day time.Time) time.Time {
+	year := day.Year()
+	if int(day.Month()) < c.FiscalYearStart {
+		year--
+	}
+	return date(year, time.Month(c.FiscalYearStart), 1)
+}
+
+// fiscalYear returns the number of the fiscal year starting on start.
+func (c *Calendar) fiscalYear(start time.Time) int {
+	if c.FiscalYearNaming == NamingEnd && c.FiscalYearStart != 1 {
+		return start.Year() + 1
+	}
+	return start.Year()
+}
+
+// fiscalYearLabel names the fiscal year starting on start, e.g. "FY2025".
+func (c *Calendar) fiscalYearLabel(start time.Time) string {
+	return fmt.Sprintf("FY%d", c.fiscalYear(start))
+}
+
+// fiscalQuarterLabel names the fiscal quarter starting on start, e.g.
+// "FY2025 Q2".
+func (c *Calendar) fiscalQuarterLabel(start time.Time) string {
+	yearStart := c.fiscalYearStart(start)
+	return fmt.Sprintf("%s Q%d", c.fiscalYearLabel(yearStart), monthsBetween(yearStart, start)/3+1)
+}
+
+// monthsBetween returns the number of whole months from from's month to
+// to's month.
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+}
+
+// HolidaysBetween returns the holidays from start to end inclusive, by date.
+func (c *Calendar) HolidaysBetween(start, end time.Time) []DayOff {
+	var days []DayOff
+	for _, holiday := range c.Holidays {
+		year, day, _ := holiday.parse()
+		if year != 0 {
+			if !day.Before(start) && !day.After(end) {
+				days = append(days, DayOff{Date: day.Format(time.DateOnly), Name: holiday.Name})
+			}
+			continue
+		}
+		for y := start.Year(); y <= end.Year(); y++ {
+			on := date(y, day.Month(), day.Day())
+			if on.Month() != day.Month() {
+				continue // February 29 outside leap years
+			}
+			if !on.Before(start) && !on.After(end) {
+				days = append(days, DayOff{Date: on.Format(time.DateOnly), Name: holiday.Name})
+			}
+		}
+	}
+	sort.SliceStable(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days
+}
+
+// BusinessDays counts the days from start to end inclusive that are
+// neither weekend days nor holidays.
+func (c *Calendar) BusinessDays(start, end time.Time) int {
+	off := make(map[string]bool)
+	for _, holiday := range c.HolidaysBetween(start, end) {
+		off[holiday.Date] = true
+	}
+	count := 0
+	for day := start; !day.After(end); day = day.AddDate(0, 0, 1) {
+		if !c.weekend[day.Weekday()] && !off[day.Format(time.DateOnly)] {
+			count++
+		}
+	}
+	return count
+}
+
+// Describe explains the calendar for the LLM's system prompt, one rule per
+// line, with the current fiscal year and quarter as of today.
+func (c *Calendar) Describe(today time.Time) string {
+	var b strings.Builder
+
+	year, _ := c.Period(FiscalYear, 0, today, false)
+	quarter, _ := c.Period(FiscalQuarter, 0, today, false)
+	fmt.Fprintf(&b, "- Fiscal years start on %s 1 and are named after the calendar year they %s in.\n",
+		time.Month(c.FiscalYearStart), c.FiscalYearNaming)
+	fmt.Fprintf(&b, "- The current fiscal year is %s (%s to %s); the current fiscal quarter is %s (%s to %s).\n",
+		year.Label, year.Start.Format(time.DateOnly), year.End.Format(time.DateOnly),
+		quarter.Label, quarter.Start.Format(time.DateOnly), quarter.End.Format(time.DateOnly))
+	fmt.Fprintf(&b, "- Weeks start on %s. Weekend days: %s.\n", c.weekStart, c.weekendNames())
+
+	holidays := c.HolidaysBetween(year.Start, year.End)
+	if len(holidays) > 0 {
+		b.WriteString("- Holidays this fiscal year:")
+		for i, holiday := range holidays {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(" " + holiday.Date)
+			if holiday.Name != "" {
+				b.WriteString(" (" + holiday.Name + ")")
+			}
+		}
+		b.WriteString(".\n")
+	}
+	return b.String()
+}
+
+// weekendNames lists the weekend days in week order.
+func (c *Calendar) weekendNames() string {
+	var names []string
+	for i := 0; i < 7; i++ {
+		day := time.Weekday((int(c.weekStart) + i) % 7)
+		if c.weekend[day] {
+			names = append(names, day.String())
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Prompt describes the calendars for the LLM's system prompt, with the
+// default calendar first. It returns "" when no calendars are configured.
+func (s *Set) Prompt() string {
+	if s == nil || !s.Configured {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("Business calendars. Resolve fiscal periods, weeks, and business days with these rather than the calendar year, and prefer the date_range tool to working out dates yourself.\n\n")
+	for i, c := range s.Calendars {
+		if i == 1 {
+			b.WriteString("\nOther calendars, used only when the question names one:\n")
+		}
+		if i == 0 {
+			fmt.Fprintf(&b, "Default calendar %q:\n", c.Name)
+		} else {
+			fmt.Fprintf(&b, "Calendar %q:\n", c.Name)
+		}
+		b.WriteString(c.Describe(c.Today()))
+	}
+	return strings.TrimSpace(b.String())
+}
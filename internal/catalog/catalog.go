@@ -0,0 +1,138 @@
+// Package catalog holds the named databases a chat session may switch to,
+// such as an analytics replica beside the default database. A session's
+// schema prompt, tools, and audit trail follow its selection for the rest
+// of the session.
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+
+	"data-chatter/internal/database"
+)
+
+// Default names the default database, to switch a session back to it.
+const Default = "default"
+
+// databaseName is what a named database may be called.
+var databaseName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ErrUnknown is returned for names that are not in the catalog.
+var ErrUnknown = errors.New("unknown database")
+
+// Config describes a database in DATABASES_FILE. Named databases are of the
+// default database's type, so they share its SQL dialect and limits; fields
+// of Database left empty keep the default database's values.
+type Config struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Database    database.Target `json:"database"`
+}
+
+// ConfigsFromEnv reads the databases in the JSON file named by
+// DATABASES_FILE, an array of Config. Passwords may refer to environment
+// variables as ${NAME}. It returns nil when the variable is unset.
+func ConfigsFromEnv() ([]Config, error) {
+	path := os.Getenv("DATABASES_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read databases: %w", err)
+	}
+	var configs []Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse databases: %w", err)
+	}
+
+	names := make(map[string]bool)
+	for i := range configs {
+		config := &configs[i]
+		if !databaseName.MatchString(config.Name) || config.Name == Default {
+			return nil, fmt.Errorf("invalid database name %q: want lowercase letters, digits, dashes, and underscores, other than %q", config.Name, Default)
+		}
+		if names[config.Name] {
+			return nil, fmt.Errorf("database %s is listed twice", config.Name)
+		}
+		names[config.Name] = true
+		config.Database.Password = os.ExpandEnv(config.Database.Password)
+	}
+	return configs, nil
+}
+
+// Database describes a database a session may switch to.
+type Database struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// Databases lists the databases of configs a session may switch to, the
+// default first, without connecting to them.
+func Databases(configs []Config) []Database {
+	databases := []Database{{Name: Default, Description: "The default database"}}
+	for _, config := range configs {
+		databases = append(databases, Database{Name: config.Name, Description: config.Description})
+	}
+	return databases
+}
+
+// Catalog holds the connections to the named databases.
+type Catalog struct {
+	databases []Database
+	conns     map[string]*database.Connection
+}
+
+// Open connects to every named database with the settings of base, the
+// default connection.
+func Open(configs []Config, base *database.Connection) (*Catalog, error) {
+	c := &Catalog{
+		databases: Databases(configs),
+		conns:     make(map[string]*database.Connection, len(configs)),
+	}
+	for _, config := range configs {
+		conn, err := base.Derive(config.Database)
+		if err != nil {
+			c.Close()
+			return nil, fmt.Errorf("database %s: %w", config.Name, err)
+		}
+		conn.Name = config.Name
+		c.conns[config.Name] = conn
+	}
+	return c, nil
+}
+
+// List returns the databases a session may switch to, the default first.
+// A nil catalog lists only the default database.
+func (c *Catalog) List() []Database {
+	if c == nil {
+		return []Database{{Name: Default, Description: "The default database"}}
+	}
+	return c.databases
+}
+
+// Lookup returns the connection to the database called name, or nil for
+// the default database.
+func (c *Catalog) Lookup(name string) (*database.Connection, error) {
+	if name == "" || name == Default {
+		return nil, nil
+	}
+	if c != nil {
+		if conn, ok := c.conns[name]; ok {
+			return conn, nil
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknown, name)
+}
+
+// Close closes the connections to the named databases.
+func (c *Catalog) Close() error {
+	var errs []error
+	for _, conn := range c.conns {
+		errs = append(errs, conn.Close())
+	}
+	return errors.Join(errs...)
+}
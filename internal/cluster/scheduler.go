@@ -0,0 +1,200 @@
+// Package cluster coordinates periodic work across replicas that share a
+// database, so a task scheduled every period, or daily at a set time, fires
+// once per period cluster-wide rather than once per replica. Each task's
+// next run time is kept in the dc_schedules table of the connected database;
+// a replica fires the task only if it is the one to advance that time, which
+// a conditional UPDATE lets exactly one replica do.
+package cluster
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"data-chatter/internal/database"
+)
+
+// Table is where task schedules are kept. Its dc_ prefix keeps it out of
+// the schema shown to users and the LLM.
+const Table = database.MetadataTablePrefix + "schedules"
+
+// Task is periodic work. It must honor ctx, which ends on shutdown.
+type Task func(ctx context.Context) error
+
+// scheduled is a task with its name and schedule. next returns when a
+// task fired at now is due again; an immediate task fires as soon as it is
+// first scheduled rather than waiting for next.
+type scheduled struct {
+	name      string
+	poll      time.Duration
+	next      func(now time.Time) time.Time
+	immediate bool
+	run       Task
+}
+
+// Scheduler fires tasks every period. With a database, each firing happens
+// on exactly one replica; a replica that crashes mid-task does not hand the
+// firing to another, so a task runs at most once per period. Without one,
+// as from NewLocalScheduler, every replica fires every task.
+type Scheduler struct {
+	conn   *database.Connection
+	holder string
+
+	mu    sync.Mutex
+	tasks []scheduled
+	next  map[string]time.Time // local schedule, without a database
+}
+
+// NewScheduler creates the schedules table if it does not exist yet.
+func NewScheduler(ctx context.Context, conn *database.Connection) (*Scheduler, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		name     VARCHAR(255) NOT NULL PRIMARY KEY,
+		next_run BIGINT NOT NULL,
+		fired_by VARCHAR(64) NOT NULL,
+		fired_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	s := NewLocalScheduler()
+	s.conn = conn
+	return s, nil
+}
+
+// NewLocalScheduler creates a scheduler that coordinates with no other
+// replica, for single-instance deployments and databases it cannot write to.
+func NewLocalScheduler() *Scheduler {
+	return &Scheduler{holder: newHolder(), next: make(map[string]time.Time)}
+}
+
+// Every schedules task under name, which must be the same on every replica
+// and unique among tasks, to fire every period once Start is called.
+func (s *Scheduler) Every(name string, period time.Duration, task Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, scheduled{
+		name:      name,
+		poll:      min(max(period/4, time.Second), time.Minute),
+		next:      func(now time.Time) time.Time { return now.Add(period) },
+		immediate: true,
+		run:       task,
+	})
+}
+
+// Daily schedules task under name to fire once a day, at offset past
+// midnight UTC. Unlike Every, it does not fire when first scheduled.
+func (s *Scheduler) Daily(name string, offset time.Duration, task Task) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, scheduled{
+		name: name,
+		poll: time.Minute,
+		next: func(now time.Time) time.Time {
+			at := now.UTC().Truncate(24 * time.Hour).Add(offset)
+			if !at.After(now) {
+				at = at.Add(24 * time.Hour)
+			}
+			return at
+		},
+		run: task,
+	})
+}
+
+// Start polls for due tasks until ctx is done. Replicas poll every quarter
+// period, between 1s and 1m, or every minute for daily tasks, so a task
+// fires at most that late.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	tasks := append([]scheduled(nil), s.tasks...)
+	s.mu.Unlock()
+
+	for _, task := range tasks {
+		go s.loop(ctx, task)
+	}
+}
+
+// loop fires task whenever this replica claims it, until ctx is done.
+func (s *Scheduler) loop(ctx context.Context, task scheduled) {
+	ticker := time.NewTicker(task.poll)
+	defer ticker.Stop()
+	for {
+		claimed, err := s.claim(ctx, task, time.Now())
+		switch {
+		case err != nil:
+			slog.Warn("scheduled task claim failed", "task", task.name, "error", err)
+		case claimed:
+			if err := task.run(ctx); err != nil {
+				slog.Warn("scheduled task failed", "task", task.name, "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// claim reports whether this replica should fire task now, advancing its
+// next run if so.
+func (s *Scheduler) claim(ctx context.Context, task scheduled, now time.Time) (bool, error) {
+	name := task.name
+	if s.conn == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		next, ok := s.next[name]
+		if !ok && !task.immediate {
+			s.next[name] = task.next(now)
+			return false, nil
+		}
+		if now.Before(next) {
+			return false, nil
+		}
+		s.next[name] = task.next(now)
+		return true, nil
+	}
+
+	table, p := s.conn.Config.QuoteIdentifier(Table), s.conn.Config.Placeholder
+	var nextRun int64
+	err := s.conn.DB.QueryRowContext(ctx, `SELECT next_run FROM `+table+` WHERE name = `+p(1), name).Scan(&nextRun)
+	if errors.Is(err, sql.ErrNoRows) {
+		// The first replica to schedule an immediate task fires it; the
+		// others' inserts fail on the primary key
+		_, err := s.conn.DB.ExecContext(ctx, `INSERT INTO `+table+` (name, next_run, fired_by, fired_at) VALUES (`+p(1)+`, `+p(2)+`, `+p(3)+`, `+p(4)+`)`,
+			name, task.next(now).UnixMilli(), s.holder, now.UnixMilli())
+		return err == nil && task.immediate, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read schedule: %w", err)
+	}
+	if now.UnixMilli() < nextRun {
+		return false, nil
+	}
+
+	// Only one replica can advance next_run from the value all of them read
+	result, err := s.conn.DB.ExecContext(ctx, `UPDATE `+table+` SET next_run = `+p(1)+`, fired_by = `+p(2)+`, fired_at = `+p(3)+` WHERE name = `+p(4)+` AND next_run = `+p(5),
+		task.next(now).UnixMilli(), s.holder, now.UnixMilli(), name, nextRun)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim schedule: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// newHolder returns a random ID for this replica.
+func newHolder() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
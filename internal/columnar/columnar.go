@@ -0,0 +1,238 @@
+// Package columnar builds Apache Arrow record batches from query rows, so
+// large results can be handed to analytics clients in columnar form without
+// first materializing a map per row.
+package columnar
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+)
+
+// DefaultBatchSize is the number of rows per record batch.
+const DefaultBatchSize = 4096
+
+// Builder accumulates rows into Arrow record batches. Column types are
+// inferred from the first batch of values, since drivers report them
+// inconsistently across dialects: integers become int64, mixed numbers
+// float64, booleans bool, times timestamps, and everything else (including
+// columns that are entirely null) strings. Later values that do not fit an
+// inferred numeric, boolean, or time column are stored as null.
+type Builder struct {
+	columns   []string
+	batchSize int
+	emit      func(arrow.Record) error
+
+	mem     memory.Allocator
+	pending [][]interface{}
+	schema  *arrow.Schema
+	builder *array.RecordBuilder
+	rows    int
+}
+
+// NewBuilder creates a builder that passes each completed batch to emit.
+// The batch is released after emit returns, so emit must retain it to keep it.
+func NewBuilder(columns []string, batchSize int, emit func(arrow.Record) error) *Builder {
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	return &Builder{
+		columns:   columns,
+		batchSize: batchSize,
+		emit:      emit,
+		mem:       memory.DefaultAllocator,
+	}
+}
+
+// Schema returns the inferred schema, or nil before the first batch is complete.
+func (b *Builder) Schema() *arrow.Schema {
+	return b.schema
+}
+
+// Append adds a row of scanned values. The values are copied, so the caller
+// may reuse the slice.
+func (b *Builder) Append(values []interface{}) error {
+	if b.builder == nil {
+		row := make([]interface{}, len(values))
+		for i, value := range values {
+			row[i] = normalize(value)
+		}
+		b.pending = append(b.pending, row)
+		if len(b.pending) < b.batchSize {
+			return nil
+		}
+		b.start()
+		for _, pendingRow := range b.pending {
+			b.appendRow(pendingRow)
+		}
+		b.pending = nil
+		return b.flush()
+	}
+
+	for i, value := range values {
+		appendValue(b.builder.Field(i), normalize(value))
+	}
+	b.rows++
+	if b.rows >= b.batchSize {
+		return b.flush()
+	}
+	return nil
+}
+
+// Close emits the final partial batch. A result with no rows still emits an
+// empty batch so consumers receive the schema.
+func (b *Builder) Close() error {
+	if b.builder == nil {
+		b.start()
+		for _, row := range b.pending {
+			b.appendRow(row)
+		}
+		b.pending = nil
+		if err := b.flush(); err != nil {
+			return err
+		}
+	} else if b.rows > 0 {
+		if err := b.flush(); err != nil {
+			return err
+		}
+	}
+	b.builder.Release()
+	return nil
+}
+
+// start infers the schema from the pending rows and creates the record builder.
+func (b *Builder) start() {
+	fields := make([]arrow.Field, len(b.columns))
+	for i, column := range b.columns {
+		fields[i] = arrow.Field{Name: column, Type: inferType(b.pending, i), Nullable: true}
+	}
+	b.schema = arrow.NewSchema(fields, nil)
+	b.builder = array.NewRecordBuilder(b.mem, b.schema)
+}
+
+// appendRow appends already normalized values.
+func (b *Builder) appendRow(row []interface{}) {
+	for i, value := range row {
+		appendValue(b.builder.Field(i), value)
+	}
+	b.rows++
+}
+
+// flush emits the rows built so far as one record batch.
+func (b *Builder) flush() error {
+	record := b.builder.NewRecord()
+	defer record.Release()
+	b.rows = 0
+	return b.emit(record)
+}
+
+// normalize converts driver values into the small set of types the builder handles.
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []byte:
+		return string(v)
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case float32:
+		return float64(v)
+	default:
+		return v
+	}
+}
+
+// inferType picks the Arrow type for column i from the buffered rows.
+func inferType(rows [][]interface{}, i int) arrow.DataType {
+	var sawInt, sawFloat, sawBool, sawTime, sawOther bool
+	for _, row := range rows {
+		switch row[i].(type) {
+		case nil:
+		case int64:
+			sawInt = true
+		case float64:
+			sawFloat = true
+		case bool:
+			sawBool = true
+		case time.Time:
+			sawTime = true
+		default:
+			sawOther = true
+		}
+	}
+
+	switch {
+	case sawOther:
+		return arrow.BinaryTypes.String
+	case sawTime && !sawInt && !sawFloat && !sawBool:
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}
+	case sawBool && !sawInt && !sawFloat && !sawTime:
+		return arrow.FixedWidthTypes.Boolean
+	case sawFloat && !sawBool && !sawTime:
+		return arrow.PrimitiveTypes.Float64
+	case sawInt && !sawBool && !sawTime:
+		return arrow.PrimitiveTypes.Int64
+	default:
+		return arrow.BinaryTypes.String
+	}
+}
+
+// appendValue appends value to a column builder, storing null when it does not fit.
+func appendValue(builder array.Builder, value interface{}) {
+	if value == nil {
+		builder.AppendNull()
+		return
+	}
+
+	switch col := builder.(type) {
+	case *array.Int64Builder:
+		switch v := value.(type) {
+		case int64:
+			col.Append(v)
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+				col.Append(int64(v))
+			} else {
+				col.AppendNull()
+			}
+		default:
+			col.AppendNull()
+		}
+	case *array.Float64Builder:
+		switch v := value.(type) {
+		case float64:
+			col.Append(v)
+		case int64:
+			col.Append(float64(v))
+		default:
+			col.AppendNull()
+		}
+	case *array.BooleanBuilder:
+		if v, ok := value.(bool); ok {
+			col.Append(v)
+		} else {
+			col.AppendNull()
+		}
+	case *array.TimestampBuilder:
+		if v, ok := value.(time.Time); ok {
+			col.Append(arrow.Timestamp(v.UnixMicro()))
+		} else {
+			col.AppendNull()
+		}
+	case *array.StringBuilder:
+		switch v := value.(type) {
+		case string:
+			col.Append(v)
+		case time.Time:
+			col.Append(v.Format(time.RFC3339))
+		default:
+			col.Append(fmt.Sprint(v))
+		}
+	default:
+		builder.AppendNull()
+	}
+}
@@ -0,0 +1,392 @@
+// Package config loads server settings from a YAML or TOML file. Settings
+// are applied as the environment variables the rest of the server already
+// reads, and only where a variable is not set, so the environment (including
+// .env) always overrides the file.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"data-chatter/internal/calendar"
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/external"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/tools"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// File is the configuration file layout. Every field maps to one
+// environment variable, named in its comment; zero values are left unset.
+type File struct {
+	Server    Server    `yaml:"server" toml:"server"`
+	Database  Database  `yaml:"database" toml:"database"`
+	LLM       LLM       `yaml:"llm" toml:"llm"`
+	CORS      CORS      `yaml:"cors" toml:"cors"`
+	Auth      Auth      `yaml:"auth" toml:"auth"`
+	RateLimit RateLimit `yaml:"rate_limit" toml:"rate_limit"`
+	Tools     Tools     `yaml:"tools" toml:"tools"`
+	Mongo     Mongo     `yaml:"mongo" toml:"mongo"`
+	Redis     Redis     `yaml:"redis" toml:"redis"`
+}
+
+// Server holds listener settings.
+type Server struct {
+	Port     int  `yaml:"port" toml:"port"`           // PORT
+	GRPCPort *int `yaml:"grpc_port" toml:"grpc_port"` // GRPC_PORT; 0 disables gRPC
+	Demo     bool `yaml:"demo" toml:"demo"`           // DEMO_MODE
+	TLS      TLS  `yaml:"tls" toml:"tls"`
+
+	MaxBodyBytes   int    `yaml:"max_body_bytes" toml:"max_body_bytes"`   // MAX_REQUEST_BODY_BYTES
+	RequestTimeout string `yaml:"request_timeout" toml:"request_timeout"` // REQUEST_TIMEOUT
+}
+
+// TLS holds the certificate, HSTS, and redirect settings of a server that
+// terminates TLS itself.
+type TLS struct {
+	CertFile       string   `yaml:"cert_file" toml:"cert_file"`                             // TLS_CERT_FILE
+	KeyFile        string   `yaml:"key_file" toml:"key_file"`                               // TLS_KEY_FILE
+	Domains        []string `yaml:"domains" toml:"domains"`                                 // TLS_DOMAINS
+	CacheDir       string   `yaml:"cache_dir" toml:"cache_dir"`                             // TLS_CACHE_DIR
+	Email          string   `yaml:"email" toml:"email"`                                     // TLS_EMAIL
+	ACMEDirectory  string   `yaml:"acme_directory" toml:"acme_directory"`                   // TLS_ACME_DIRECTORY
+	HSTSMaxAge     string   `yaml:"hsts_max_age" toml:"hsts_max_age"`                       // HSTS_MAX_AGE
+	HSTSSubdomains bool     `yaml:"hsts_include_subdomains" toml:"hsts_include_subdomains"` // HSTS_INCLUDE_SUBDOMAINS
+	RedirectPort   int      `yaml:"redirect_port" toml:"redirect_port"`                     // HTTP_REDIRECT_PORT
+}
+
+// Database holds the connection settings.
+type Database struct {
+	Type          string `yaml:"type" toml:"type"`                       // DB_TYPE
+	File          string `yaml:"file" toml:"file"`                       // DB_FILE
+	Host          string `yaml:"host" toml:"host"`                       // DB_HOST
+	Port          int    `yaml:"port" toml:"port"`                       // DB_PORT
+	User          string `yaml:"user" toml:"user"`                       // DB_USER
+	Password      string `yaml:"password" toml:"password"`               // DB_PASSWORD
+	Name          string `yaml:"name" toml:"name"`                       // DB_NAME
+	SSLMode       string `yaml:"sslmode" toml:"sslmode"`                 // DB_SSLMODE
+	MaxConns      int    `yaml:"max_conns" toml:"max_conns"`             // DB_MAX_CONNS
+	MaxIdle       int    `yaml:"max_idle" toml:"max_idle"`               // DB_MAX_IDLE
+	MaxResultRows int    `yaml:"max_result_rows" toml:"max_result_rows"` // DB_MAX_RESULT_ROWS
+
+	SchemaSampleRows int    `yaml:"schema_sample_rows" toml:"schema_sample_rows"` // SCHEMA_SAMPLE_ROWS
+	SchemaWorkers    int    `yaml:"schema_workers" toml:"schema_workers"`         // SCHEMA_WORKERS
+	SchemaCacheTTL   string `yaml:"schema_cache_ttl" toml:"schema_cache_ttl"`     // SCHEMA_CACHE_TTL
+
+	SchemaNotes []dictionary.Note `yaml:"schema_notes" toml:"schema_notes"` // SCHEMA_NOTES, as a JSON array
+	ColumnRules []dictionary.Rule `yaml:"column_rules" toml:"column_rules"` // COLUMN_RULES, as a JSON array
+
+	MaskColumns []string `yaml:"mask_columns" toml:"mask_columns"` // PII_MASK_COLUMNS
+
+	DuckDBAllowedDirs []string `yaml:"duckdb_allowed_dirs" toml:"duckdb_allowed_dirs"` // DUCKDB_ALLOWED_DIRS
+
+	APISources []external.APISource `yaml:"api_sources" toml:"api_sources"` // API_SOURCES, as a JSON array
+
+	BusinessCalendars []calendar.Calendar `yaml:"business_calendars" toml:"business_calendars"` // BUSINESS_CALENDARS, as a JSON array
+}
+
+// LLM holds the provider settings. The model and key go to ANTHROPIC_MODEL
+// and ANTHROPIC_API_KEY for Anthropic, otherwise to LLM_MODEL and LLM_API_KEY.
+type LLM struct {
+	Provider         string            `yaml:"provider" toml:"provider"`                     // LLM_PROVIDER
+	Model            string            `yaml:"model" toml:"model"`                           // ANTHROPIC_MODEL or LLM_MODEL
+	APIKey           string            `yaml:"api_key" toml:"api_key"`                       // ANTHROPIC_API_KEY or LLM_API_KEY
+	BaseURL          string            `yaml:"base_url" toml:"base_url"`                     // LLM_BASE_URL
+	Headers          map[string]string `yaml:"headers" toml:"headers"`                       // LLM_HEADERS, as a JSON object
+	Models           []string          `yaml:"models" toml:"models"`                         // LLM_MODELS
+	RequestTimeout   string            `yaml:"request_timeout" toml:"request_timeout"`       // LLM_REQUEST_TIMEOUT
+	TurnTimeout      string            `yaml:"turn_timeout" toml:"turn_timeout"`             // LLM_TURN_TIMEOUT
+	KeyCheckInterval string            `yaml:"key_check_interval" toml:"key_check_interval"` // LLM_KEY_CHECK_INTERVAL
+	MaxAttempts      int               `yaml:"max_attempts" toml:"max_attempts"`             // ANTHROPIC_MAX_ATTEMPTS
+	RetryBackoff     string            `yaml:"retry_backoff" toml:"retry_backoff"`           // ANTHROPIC_RETRY_BACKOFF
+	ResultRows       int               `yaml:"result_rows" toml:"result_rows"`               // LLM_RESULT_ROWS
+	Deterministic    *bool             `yaml:"deterministic" toml:"deterministic"`           // LLM_DETERMINISTIC
+	Seed             int               `yaml:"seed" toml:"seed"`                             // LLM_SEED
+}
+
+// CORS holds cross-origin settings.
+type CORS struct {
+	AllowedOrigins []string `yaml:"allowed_origins" toml:"allowed_origins"` // CORS_ALLOWED_ORIGINS
+}
+
+// Auth holds JWT verification settings.
+type Auth struct {
+	JWTSecret        string `yaml:"jwt_secret" toml:"jwt_secret"`                   // JWT_SECRET
+	JWTAlgorithm     string `yaml:"jwt_algorithm" toml:"jwt_algorithm"`             // JWT_ALGORITHM
+	JWTPublicKeyFile string `yaml:"jwt_public_key_file" toml:"jwt_public_key_file"` // JWT_PUBLIC_KEY_FILE
+	JWTIssuer        string `yaml:"jwt_issuer" toml:"jwt_issuer"`                   // JWT_ISSUER
+	JWTAudience      string `yaml:"jwt_audience" toml:"jwt_audience"`               // JWT_AUDIENCE
+	Required         *bool  `yaml:"required" toml:"required"`                       // AUTH_REQUIRED
+}
+
+// RateLimit holds per-client request limits.
+type RateLimit struct {
+	RPS   float64 `yaml:"rps" toml:"rps"`     // RATE_LIMIT_RPS
+	Burst int     `yaml:"burst" toml:"burst"` // RATE_LIMIT_BURST
+	ByIP  bool    `yaml:"by_ip" toml:"by_ip"` // RATE_LIMIT_BY_IP
+}
+
+// Tools holds tool enablement, retry and batch execution settings, any
+// external tools backed by REST services, remote metrics, and the dbt
+// manifest whose metrics become tools.
+type Tools struct {
+	Enabled       []string               `yaml:"enabled" toml:"enabled"`               // TOOLS_ENABLED
+	RetryAttempts int                    `yaml:"retry_attempts" toml:"retry_attempts"` // TOOL_RETRY_ATTEMPTS
+	RetryBackoff  string                 `yaml:"retry_backoff" toml:"retry_backoff"`   // TOOL_RETRY_BACKOFF
+	RewriteSQL    bool                   `yaml:"rewrite_sql" toml:"rewrite_sql"`       // SQL_REWRITE_ON_ERROR
+	Parallelism   int                    `yaml:"parallelism" toml:"parallelism"`       // TOOL_PARALLELISM
+	CallTimeout   string                 `yaml:"call_timeout" toml:"call_timeout"`     // TOOL_CALL_TIMEOUT
+	HTTP          []tools.HTTPToolConfig `yaml:"http" toml:"http"`                     // HTTP_TOOLS, as a JSON array
+	DBTManifest   string                 `yaml:"dbt_manifest" toml:"dbt_manifest"`     // DBT_MANIFEST_PATH
+
+	RemoteMetrics []tools.RemoteMetricConfig `yaml:"remote_metrics" toml:"remote_metrics"` // REMOTE_METRICS, as a JSON array
+}
+
+// Mongo holds the MongoDB connection behind the mongo_find and
+// mongo_aggregate tools.
+type Mongo struct {
+	URI          string   `yaml:"uri" toml:"uri"`                     // MONGO_URI
+	Database     string   `yaml:"database" toml:"database"`           // MONGO_DATABASE
+	Collections  []string `yaml:"collections" toml:"collections"`     // MONGO_COLLECTIONS
+	MaxTime      string   `yaml:"max_time" toml:"max_time"`           // MONGO_MAX_TIME
+	MaxDocuments int      `yaml:"max_documents" toml:"max_documents"` // MONGO_MAX_DOCUMENTS
+}
+
+// Redis holds the Redis replicas share conversations, rate limits, schemas,
+// and cached query results in.
+type Redis struct {
+	Addr     string `yaml:"addr" toml:"addr"`         // REDIS_ADDR
+	Password string `yaml:"password" toml:"password"` // REDIS_PASSWORD
+}
+
+// Load reads a configuration file, choosing the format by extension
+// (.yaml, .yml, or .toml). Unknown keys are an error so typos are caught.
+func Load(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var file File
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&file); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	case ".toml":
+		metadata, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("failed to parse %s: unknown key %s", path, undecoded[0])
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file %s: use .yaml, .yml, or .toml", path)
+	}
+
+	if provider := file.LLM.Provider; provider != "" && !llm.ValidProvider(provider) {
+		return nil, fmt.Errorf("unsupported llm provider %q: use %s, %s, or %s", provider, llm.ProviderAnthropic, llm.ProviderOpenAI, llm.ProviderOpenAICompatible)
+	}
+	return &file, nil
+}
+
+// Apply sets the environment variable for every value in the file unless it
+// is already set, and returns the names of the variables it set.
+func (f *File) Apply() ([]string, error) {
+	env, err := f.env()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []string
+	for key, value := range env {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return applied, fmt.Errorf("failed to set %s: %w", key, err)
+		}
+		applied = append(applied, key)
+	}
+	sort.Strings(applied)
+	return applied, nil
+}
+
+// env maps the file's non-zero values to environment variables.
+func (f *File) env() (map[string]string, error) {
+	env := make(map[string]string)
+	setString := func(key, value string) {
+		if value != "" {
+			env[key] = value
+		}
+	}
+	setInt := func(key string, value int) {
+		if value != 0 {
+			env[key] = strconv.Itoa(value)
+		}
+	}
+	setList := func(key string, values []string) {
+		if len(values) > 0 {
+			env[key] = strings.Join(values, ",")
+		}
+	}
+
+	setInt("PORT", f.Server.Port)
+	if f.Server.GRPCPort != nil {
+		env["GRPC_PORT"] = strconv.Itoa(*f.Server.GRPCPort)
+	}
+	if f.Server.Demo {
+		env["DEMO_MODE"] = "true"
+	}
+	setInt("MAX_REQUEST_BODY_BYTES", f.Server.MaxBodyBytes)
+	setString("REQUEST_TIMEOUT", f.Server.RequestTimeout)
+	setString("TLS_CERT_FILE", f.Server.TLS.CertFile)
+	setString("TLS_KEY_FILE", f.Server.TLS.KeyFile)
+	setList("TLS_DOMAINS", f.Server.TLS.Domains)
+	setString("TLS_CACHE_DIR", f.Server.TLS.CacheDir)
+	setString("TLS_EMAIL", f.Server.TLS.Email)
+	setString("TLS_ACME_DIRECTORY", f.Server.TLS.ACMEDirectory)
+	setString("HSTS_MAX_AGE", f.Server.TLS.HSTSMaxAge)
+	if f.Server.TLS.HSTSSubdomains {
+		env["HSTS_INCLUDE_SUBDOMAINS"] = "true"
+	}
+	setInt("HTTP_REDIRECT_PORT", f.Server.TLS.RedirectPort)
+
+	setString("DB_TYPE", f.Database.Type)
+	setString("DB_FILE", f.Database.File)
+	setString("DB_HOST", f.Database.Host)
+	setInt("DB_PORT", f.Database.Port)
+	setString("DB_USER", f.Database.User)
+	setString("DB_PASSWORD", f.Database.Password)
+	setString("DB_NAME", f.Database.Name)
+	setString("DB_SSLMODE", f.Database.SSLMode)
+	setInt("DB_MAX_CONNS", f.Database.MaxConns)
+	setInt("DB_MAX_IDLE", f.Database.MaxIdle)
+	setInt("DB_MAX_RESULT_ROWS", f.Database.MaxResultRows)
+	setInt("SCHEMA_SAMPLE_ROWS", f.Database.SchemaSampleRows)
+	setInt("SCHEMA_WORKERS", f.Database.SchemaWorkers)
+	setString("SCHEMA_CACHE_TTL", f.Database.SchemaCacheTTL)
+	setList("DUCKDB_ALLOWED_DIRS", f.Database.DuckDBAllowedDirs)
+	if len(f.Database.SchemaNotes) > 0 {
+		encoded, err := json.Marshal(f.Database.SchemaNotes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode database.schema_notes: %w", err)
+		}
+		env["SCHEMA_NOTES"] = string(encoded)
+	}
+	if len(f.Database.ColumnRules) > 0 {
+		encoded, err := json.Marshal(f.Database.ColumnRules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode database.column_rules: %w", err)
+		}
+		env["COLUMN_RULES"] = string(encoded)
+	}
+	setList("PII_MASK_COLUMNS", f.Database.MaskColumns)
+	if len(f.Database.APISources) > 0 {
+		encoded, err := json.Marshal(f.Database.APISources)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode database.api_sources: %w", err)
+		}
+		env["API_SOURCES"] = string(encoded)
+	}
+	if len(f.Database.BusinessCalendars) > 0 {
+		encoded, err := json.Marshal(f.Database.BusinessCalendars)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode database.business_calendars: %w", err)
+		}
+		env["BUSINESS_CALENDARS"] = string(encoded)
+	}
+
+	setString("LLM_PROVIDER", f.LLM.Provider)
+	if f.LLM.Provider == "" || f.LLM.Provider == llm.ProviderAnthropic {
+		setString("ANTHROPIC_MODEL", f.LLM.Model)
+		setString("ANTHROPIC_API_KEY", f.LLM.APIKey)
+	} else {
+		setString("LLM_MODEL", f.LLM.Model)
+		setString("LLM_API_KEY", f.LLM.APIKey)
+	}
+	setString("LLM_BASE_URL", f.LLM.BaseURL)
+	if len(f.LLM.Headers) > 0 {
+		encoded, err := json.Marshal(f.LLM.Headers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode llm.headers: %w", err)
+		}
+		env["LLM_HEADERS"] = string(encoded)
+	}
+	setList("LLM_MODELS", f.LLM.Models)
+	setString("LLM_REQUEST_TIMEOUT", f.LLM.RequestTimeout)
+	setString("LLM_TURN_TIMEOUT", f.LLM.TurnTimeout)
+	setString("LLM_KEY_CHECK_INTERVAL", f.LLM.KeyCheckInterval)
+	setInt("ANTHROPIC_MAX_ATTEMPTS", f.LLM.MaxAttempts)
+	setString("ANTHROPIC_RETRY_BACKOFF", f.LLM.RetryBackoff)
+	setInt("LLM_RESULT_ROWS", f.LLM.ResultRows)
+	if f.LLM.Deterministic != nil {
+		env["LLM_DETERMINISTIC"] = strconv.FormatBool(*f.LLM.Deterministic)
+	}
+	setInt("LLM_SEED", f.LLM.Seed)
+
+	setList("CORS_ALLOWED_ORIGINS", f.CORS.AllowedOrigins)
+
+	setString("JWT_SECRET", f.Auth.JWTSecret)
+	setString("JWT_ALGORITHM", f.Auth.JWTAlgorithm)
+	setString("JWT_PUBLIC_KEY_FILE", f.Auth.JWTPublicKeyFile)
+	setString("JWT_ISSUER", f.Auth.JWTIssuer)
+	setString("JWT_AUDIENCE", f.Auth.JWTAudience)
+	if f.Auth.Required != nil {
+		env["AUTH_REQUIRED"] = strconv.FormatBool(*f.Auth.Required)
+	}
+
+	if f.RateLimit.RPS != 0 {
+		env["RATE_LIMIT_RPS"] = strconv.FormatFloat(f.RateLimit.RPS, 'f', -1, 64)
+	}
+	setInt("RATE_LIMIT_BURST", f.RateLimit.Burst)
+	if f.RateLimit.ByIP {
+		env["RATE_LIMIT_BY_IP"] = "true"
+	}
+
+	setList("TOOLS_ENABLED", f.Tools.Enabled)
+	setInt("TOOL_RETRY_ATTEMPTS", f.Tools.RetryAttempts)
+	setString("TOOL_RETRY_BACKOFF", f.Tools.RetryBackoff)
+	if f.Tools.RewriteSQL {
+		env["SQL_REWRITE_ON_ERROR"] = "true"
+	}
+	setInt("TOOL_PARALLELISM", f.Tools.Parallelism)
+	setString("TOOL_CALL_TIMEOUT", f.Tools.CallTimeout)
+	setString("DBT_MANIFEST_PATH", f.Tools.DBTManifest)
+	if len(f.Tools.HTTP) > 0 {
+		encoded, err := json.Marshal(f.Tools.HTTP)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode tools.http: %w", err)
+		}
+		env["HTTP_TOOLS"] = string(encoded)
+	}
+	if len(f.Tools.RemoteMetrics) > 0 {
+		encoded, err := json.Marshal(f.Tools.RemoteMetrics)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode tools.remote_metrics: %w", err)
+		}
+		env["REMOTE_METRICS"] = string(encoded)
+	}
+
+	setString("MONGO_URI", f.Mongo.URI)
+	setString("MONGO_DATABASE", f.Mongo.Database)
+	setList("MONGO_COLLECTIONS", f.Mongo.Collections)
+	setString("MONGO_MAX_TIME", f.Mongo.MaxTime)
+	setInt("MONGO_MAX_DOCUMENTS", f.Mongo.MaxDocuments)
+
+	setString("REDIS_ADDR", f.Redis.Addr)
+	setString("REDIS_PASSWORD", f.Redis.Password)
+
+	return env, nil
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+// demoDefaults are the demo profile's settings that the environment may
+// still override: the bundled sample database and strict limits.
+var demoDefaults = map[string]string{
+	"DB_FILE":                 "./contacts.db",
+	"RATE_LIMIT_RPS":          "0.1",
+	"RATE_LIMIT_BURST":        "5",
+	"DB_MAX_RESULT_ROWS":      "1000",
+	"QUERY_AUTO_LIMIT":        "1000",
+	"LLM_BATCH_MAX_QUESTIONS": "5",
+	"QUERY_COST_GUARD":        "reject",
+	"SCHEMA_SAMPLE_ROWS":      "3",
+}
+
+// demoForced are the demo profile's settings that keep a public playground
+// safe, so they override the environment: a SQLite database opened
+// read-only and immutable, and rate limits visitors cannot escape by sending new API keys.
+var demoForced = map[string]string{
+	"DB_TYPE":          "sqlite",
+	"SQLITE_READ_ONLY": "true",
+	"SQLITE_IMMUTABLE": "true",
+	"RATE_LIMIT_BY_IP": "true",
+}
+
+// demoCleared are unset in the demo profile: everything visitors create is
+// kept in memory only, and no other databases or remote sources are reached.
+var demoCleared = []string{
+	"QUERY_HISTORY_FILE",
+	"SAVED_QUERIES_FILE",
+	"ORG_CONTEXT_FILE",
+	"SUGGESTIONS_FILE",
+	"NOTIFICATION_PREFS_FILE",
+	"TENANTS_FILE",
+	"AUDIT_LOG_FILE",
+	"ARTIFACT_STORE",
+	"DATABASES_FILE",
+	"MONGO_URI",
+	"API_SOURCES",
+	"HTTP_TOOLS",
+	"REMOTE_METRICS",
+	"DBT_MANIFEST_PATH",
+	"UNIT_RATES_URL",
+	"EMBEDDING_PROVIDER",
+	"SMTP_ADDR",
+	"ANTHROPIC_API_KEY",
+	"LLM_BASE_URL",
+}
+
+// DemoMode reports whether DEMO_MODE=true asks for the demo profile.
+func DemoMode() bool {
+	return os.Getenv("DEMO_MODE") == "true"
+}
+
+// ApplyDemo applies the demo profile when DEMO_MODE=true, for hosting the
+// server as a public playground, and returns the names of the variables it
+// set or cleared. The LLM only uses the key in DEMO_API_KEY, a canned key
+// meant for the playground alone; without one, chat answers from rules.
+func ApplyDemo() ([]string, error) {
+	if !DemoMode() {
+		return nil, nil
+	}
+	apiKey := os.Getenv("DEMO_API_KEY")
+	var applied []string
+	for key, value := range demoDefaults {
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return applied, fmt.Errorf("failed to set %s: %w", key, err)
+		}
+		applied = append(applied, key)
+	}
+	for key, value := range demoForced {
+		if err := os.Setenv(key, value); err != nil {
+			return applied, fmt.Errorf("failed to set %s: %w", key, err)
+		}
+		applied = append(applied, key)
+	}
+	for _, key := range demoCleared {
+		if _, set := os.LookupEnv(key); !set {
+			continue
+		}
+		if err := os.Unsetenv(key); err != nil {
+			return applied, fmt.Errorf("failed to clear %s: %w", key, err)
+		}
+		applied = append(applied, key)
+	}
+	if apiKey != "" {
+		if err := os.Setenv("LLM_API_KEY", apiKey); err != nil {
+			return applied, fmt.Errorf("failed to set LLM_API_KEY: %w", err)
+		}
+		applied = append(applied, "LLM_API_KEY")
+	} else if _, set := os.LookupEnv("LLM_API_KEY"); set {
+		if err := os.Unsetenv("LLM_API_KEY"); err != nil {
+			return applied, fmt.Errorf("failed to clear LLM_API_KEY: %w", err)
+		}
+		applied = append(applied, "LLM_API_KEY")
+	}
+	sort.Strings(applied)
+	return applied, nil
+}
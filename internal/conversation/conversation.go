@@ -0,0 +1,390 @@
+// Package conversation keeps chat conversations, in memory or in a Redis
+// shared by every replica: the turns asked and answered in each thread,
+// comments left on their results, and the parent/child links created when
+// a conversation is forked to explore an alternative line of questioning.
+package conversation
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+)
+
+// conversationLimit bounds how many conversations are kept; the least
+// recently updated are evicted first.
+const conversationLimit = 1000
+
+// ErrNotFound is returned for unknown conversations and turns.
+var ErrNotFound = errors.New("not found")
+
+// Turn is one question and its answer.
+type Turn struct {
+	TurnID    string    `json:"turn_id"`
+	Message   string    `json:"message"`
+	Reply     string    `json:"reply,omitempty"`
+	Status    int       `json:"status"` // HTTP status of the answer
+	Author    string    `json:"author,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Response is the full /llm/message response, including results and plan.
+	Response json.RawMessage `json:"response,omitempty"`
+
+	// InputTokens and OutputTokens are the LLM tokens spent on the answer;
+	// input includes prompt-cache reads and writes.
+	InputTokens  int `json:"input_tokens,omitempty"`
+	OutputTokens int `json:"output_tokens,omitempty"`
+
+	// Comments are notes left on rows or cells of Response's merged rows.
+	Comments []Comment `json:"comments,omitempty"`
+}
+
+// Comment annotates one row of a turn's merged result rows, or one cell of
+// it when Column is set.
+type Comment struct {
+	ID        string    `json:"id"`
+	Row       int       `json:"row"`
+	Column    string    `json:"column,omitempty"`
+	Text      string    `json:"text"`
+	Author    string    `json:"author"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Conversation is a thread of turns. A fork starts with a copy of its
+// parent's turns up to and including ForkedAtTurnID. SharedWith lists the
+// users besides the owner who may read the conversation and comment on it.
+// Database names the database its turns run on, from DATABASES_FILE, or is
+// empty for the default database.
+type Conversation struct {
+	ID             string    `json:"id"`
+	Owner          string    `json:"owner,omitempty"`
+	SharedWith     []string  `json:"shared_with,omitempty"`
+	ParentID       string    `json:"parent_id,omitempty"`
+	ForkedAtTurnID string    `json:"forked_at_turn_id,omitempty"`
+	Children       []string  `json:"children,omitempty"`
+	Database       string    `json:"database,omitempty"`
+	Turns          []Turn    `json:"turns"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// LastTurnID returns the ID of the most recent turn, or "" if there is none.
+func (c *Conversation) LastTurnID() string {
+	if len(c.Turns) == 0 {
+		return ""
+	}
+	return c.Turns[len(c.Turns)-1].TurnID
+}
+
+// Store holds conversations in memory, or in Redis when created by
+// NewSharedStore so that every replica sees the same conversations.
+type Store struct {
+	backend backend
+}
+
+// backend keeps a store's conversations. Conversations it returns are the
+// caller's to modify.
+type backend interface {
+	// load returns the conversation with id.
+	load(id string) (*Conversation, error)
+	// update applies change to the conversation with id and returns the
+	// result, or leaves it unchanged when change fails.
+	update(id string, change func(c *Conversation) error) (*Conversation, error)
+	// insert adds a conversation, evicting the least recently updated
+	// beyond the limit.
+	insert(c *Conversation) error
+	// all returns every conversation, in no particular order.
+	all() ([]Conversation, error)
+	// replace swaps every conversation for conversations.
+	replace(conversations []Conversation) error
+}
+
+// NewStore creates an empty store keeping conversations in memory.
+func NewStore() *Store {
+	return &Store{backend: &memoryBackend{conversations: make(map[string]*Conversation)}}
+}
+
+// Create starts an empty conversation owned by owner ("" when unauthenticated).
+func (s *Store) Create(owner string) (*Conversation, error) {
+	now := time.Now()
+	c := &Conversation{ID: newID(), Owner: owner, Turns: []Turn{}, CreatedAt: now, UpdatedAt: now}
+	if err := s.backend.insert(c.clone()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Get returns a copy of the conversation with id.
+func (s *Store) Get(id string) (*Conversation, error) {
+	return s.backend.load(id)
+}
+
+// Append adds a turn to the end of a conversation.
+func (s *Store) Append(id string, turn Turn) error {
+	if turn.CreatedAt.IsZero() {
+		turn.CreatedAt = time.Now()
+	}
+	_, err := s.backend.update(id, func(c *Conversation) error {
+		c.Turns = append(c.Turns, turn)
+		c.UpdatedAt = turn.CreatedAt
+		return nil
+	})
+	return err
+}
+
+// SetReply replaces the reply of a turn, such as when its narrative summary
+// arrives after the turn was recorded.
+func (s *Store) SetReply(id, turnID, reply string) error {
+	_, err := s.backend.update(id, func(c *Conversation) error {
+		for i := range c.Turns {
+			if c.Turns[i].TurnID == turnID {
+				c.Turns[i].Reply = reply
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return err
+}
+
+// SetDatabase switches the database a conversation's later turns run on;
+// an empty name goes back to the default database.
+func (s *Store) SetDatabase(id, name string) error {
+	_, err := s.backend.update(id, func(c *Conversation) error {
+		c.Database = name
+		return nil
+	})
+	return err
+}
+
+// Fork creates a child of conversation id holding its turns up to and
+// including turnID, or all of its turns when turnID is empty. The parent is
+// left unchanged apart from listing the child.
+func (s *Store) Fork(id, turnID, owner string) (*Conversation, error) {
+	parent, err := s.backend.load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	end := len(parent.Turns)
+	if turnID != "" {
+		end = -1
+		for i, turn := range parent.Turns {
+			if turn.TurnID == turnID {
+				end = i + 1
+				break
+			}
+		}
+		if end < 0 {
+			return nil, ErrNotFound
+		}
+	}
+
+	now := time.Now()
+	child := &Conversation{
+		ID:             newID(),
+		Owner:          owner,
+		ParentID:       parent.ID,
+		ForkedAtTurnID: turnID,
+		Database:       parent.Database,
+		Turns:          copyTurns(parent.Turns[:end]),
+		CreatedAt:      now,
+		UpdatedAt:      now,
+	}
+	if child.ForkedAtTurnID == "" {
+		child.ForkedAtTurnID = parent.LastTurnID()
+	}
+	if err := s.backend.insert(child.clone()); err != nil {
+		return nil, err
+	}
+	// A parent evicted to make room for the child has no list to update.
+	_, err = s.backend.update(parent.ID, func(c *Conversation) error {
+		c.Children = append(c.Children, child.ID)
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	return child, nil
+}
+
+// Share adds users to the people a conversation is shared with.
+func (s *Store) Share(id string, users []string) (*Conversation, error) {
+	return s.backend.update(id, func(c *Conversation) error {
+		for _, user := range users {
+			if user != "" && user != c.Owner && !slices.Contains(c.SharedWith, user) {
+				c.SharedWith = append(c.SharedWith, user)
+			}
+		}
+		return nil
+	})
+}
+
+// AddComment attaches a comment to a turn, assigning its ID and time.
+func (s *Store) AddComment(id, turnID string, comment Comment) (Comment, error) {
+	comment.ID = newID()
+	comment.CreatedAt = time.Now()
+	_, err := s.backend.update(id, func(c *Conversation) error {
+		for i := range c.Turns {
+			if c.Turns[i].TurnID == turnID {
+				c.Turns[i].Comments = append(c.Turns[i].Comments, comment)
+				c.UpdatedAt = comment.CreatedAt
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	if err != nil {
+		return Comment{}, err
+	}
+	return comment, nil
+}
+
+// DeleteComment removes a comment from whichever turn holds it.
+func (s *Store) DeleteComment(id, commentID string) error {
+	_, err := s.backend.update(id, func(c *Conversation) error {
+		for i := range c.Turns {
+			comments := c.Turns[i].Comments
+			for j := range comments {
+				if comments[j].ID == commentID {
+					c.Turns[i].Comments = slices.Delete(slices.Clone(comments), j, j+1)
+					c.UpdatedAt = time.Now()
+					return nil
+				}
+			}
+		}
+		return ErrNotFound
+	})
+	return err
+}
+
+// All returns a copy of every conversation, least recently updated first.
+func (s *Store) All() ([]Conversation, error) {
+	all, err := s.backend.all()
+	if err != nil {
+		return nil, err
+	}
+	slices.SortFunc(all, func(a, b Conversation) int { return a.UpdatedAt.Compare(b.UpdatedAt) })
+	return all, nil
+}
+
+// Replace swaps every conversation for conversations, as when restoring a
+// backup. Beyond the limit, the least recently updated are dropped.
+func (s *Store) Replace(conversations []Conversation) error {
+	replaced := make([]Conversation, len(conversations))
+	for i, c := range conversations {
+		if c.Turns == nil {
+			c.Turns = []Turn{}
+		}
+		replaced[i] = *c.clone()
+	}
+	return s.backend.replace(replaced)
+}
+
+// memoryBackend keeps conversations in memory, up to conversationLimit.
+type memoryBackend struct {
+	mu            sync.Mutex
+	conversations map[string]*Conversation
+}
+
+func (m *memoryBackend) load(id string) (*Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, exists := m.conversations[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return c.clone(), nil
+}
+
+func (m *memoryBackend) update(id string, change func(c *Conversation) error) (*Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, exists := m.conversations[id]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	changed := c.clone()
+	if err := change(changed); err != nil {
+		return nil, err
+	}
+	m.conversations[id] = changed
+	return changed.clone(), nil
+}
+
+func (m *memoryBackend) insert(c *Conversation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.conversations[c.ID] = c
+	m.evict()
+	return nil
+}
+
+func (m *memoryBackend) all() ([]Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	all := make([]Conversation, 0, len(m.conversations))
+	for _, c := range m.conversations {
+		all = append(all, *c.clone())
+	}
+	return all, nil
+}
+
+func (m *memoryBackend) replace(conversations []Conversation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.conversations = make(map[string]*Conversation, len(conversations))
+	for i := range conversations {
+		m.conversations[conversations[i].ID] = &conversations[i]
+	}
+	m.evict()
+	return nil
+}
+
+// evict drops the least recently updated conversations beyond the limit.
+// Callers must hold m.mu.
+func (m *memoryBackend) evict() {
+	for len(m.conversations) > conversationLimit {
+		var oldest *Conversation
+		for _, c := range m.conversations {
+			if oldest == nil || c.UpdatedAt.Before(oldest.UpdatedAt) {
+				oldest = c
+			}
+		}
+		delete(m.conversations, oldest.ID)
+	}
+}
+
+// clone copies a conversation so callers cannot mutate the store's state.
+func (c *Conversation) clone() *Conversation {
+	copied := *c
+	copied.Children = append([]string(nil), c.Children...)
+	copied.SharedWith = append([]string(nil), c.SharedWith...)
+	copied.Turns = copyTurns(c.Turns)
+	return &copied
+}
+
+// copyTurns copies turns along with their comments, so the copies can be
+// commented on independently.
+func copyTurns(turns []Turn) []Turn {
+	copied := append([]Turn{}, turns...)
+	for i := range copied {
+		copied[i].Comments = append([]Comment(nil), turns[i].Comments...)
+	}
+	return copied
+}
+
+// newID generates a random conversation identifier.
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
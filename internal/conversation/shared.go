@@ -0,0 +1,213 @@
+package conversation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"data-chatter/internal/redis"
+)
+
+const (
+	// conversationKeyPrefix prefixes the key holding each conversation.
+	conversationKeyPrefix = redis.KeyPrefix + "conversation:"
+	// conversationIndexKey is a sorted set of conversation IDs, scored by
+	// when each was last updated, for eviction and listing.
+	conversationIndexKey = redis.KeyPrefix + "conversations"
+	// loadBatch is how many conversations All reads per command.
+	loadBatch = 100
+)
+
+// NewSharedStore creates a store keeping conversations in Redis, so a
+// conversation started on one replica can be continued on any other.
+// Changes to a conversation are applied atomically, retried when another
+// replica changes it at the same time. Beyond the limit, the least recently
+// updated conversations are dropped, as in memory.
+func NewSharedStore(client *redis.Client) *Store {
+	return &Store{backend: redisBackend{client: client}}
+}
+
+// redisBackend keeps each conversation as JSON under its own key.
+type redisBackend struct {
+	client *redis.Client
+}
+
+func conversationKey(id string) string {
+	return conversationKeyPrefix + id
+}
+
+func (r redisBackend) load(id string) (*Conversation, error) {
+	data, ok, err := r.client.Get(context.Background(), conversationKey(id))
+	if err != nil {
+		slog.Warn("failed to read shared conversation", "conversation_id", id, "error", err)
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	var c Conversation
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to decode conversation %s: %w", id, err)
+	}
+	return &c, nil
+}
+
+func (r redisBackend) update(id string, change func(c *Conversation) error) (*Conversation, error) {
+	ctx := context.Background()
+	var changed *Conversation
+	err := r.client.Update(ctx, conversationKey(id), 0, func(data []byte, exists bool) ([]byte, error) {
+		if !exists {
+			return nil, ErrNotFound
+		}
+		var c Conversation
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("failed to decode conversation %s: %w", id, err)
+		}
+		if err := change(&c); err != nil {
+			return nil, err
+		}
+		changed = &c
+		return json.Marshal(&c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := r.index(ctx, changed); err != nil {
+		slog.Warn("failed to index shared conversation", "conversation_id", id, "error", err)
+	}
+	return changed.clone(), nil
+}
+
+func (r redisBackend) insert(c *Conversation) error {
+	ctx := context.Background()
+	if err := r.store(ctx, c); err != nil {
+		slog.Warn("failed to store shared conversation", "conversation_id", c.ID, "error", err)
+		return err
+	}
+	if err := r.evict(ctx); err != nil {
+		slog.Warn("failed to evict shared conversations", "error", err)
+	}
+	return nil
+}
+
+func (r redisBackend) all() ([]Conversation, error) {
+	ctx := context.Background()
+	ids, err := r.ids(ctx)
+	if err != nil {
+		return nil, err
+	}
+	all := make([]Conversation, 0, len(ids))
+	for start := 0; start < len(ids); start += loadBatch {
+		batch := ids[start:min(start+loadBatch, len(ids))]
+		keys := make([]string, len(batch))
+		for i, id := range batch {
+			keys[i] = conversationKey(id)
+		}
+		reply, err := r.client.Do(ctx, append([]string{"MGET"}, keys...)...)
+		if err != nil {
+			return nil, err
+		}
+		values, _ := reply.([]interface{})
+		for i, value := range values {
+			data, ok := value.([]byte)
+			if !ok {
+				continue // Deleted since the index was read
+			}
+			var c Conversation
+			if err := json.Unmarshal(data, &c); err != nil {
+				return nil, fmt.Errorf("failed to decode conversation %s: %w", batch[i], err)
+			}
+			all = append(all, c)
+		}
+	}
+	return all, nil
+}
+
+func (r redisBackend) replace(conversations []Conversation) error {
+	ctx := context.Background()
+	ids, err := r.ids(ctx)
+	if err != nil {
+		return err
+	}
+	keys := []string{conversationIndexKey}
+	for _, id := range ids {
+		keys = append(keys, conversationKey(id))
+	}
+	if err := r.client.Del(ctx, keys...); err != nil {
+		return err
+	}
+	for i := range conversations {
+		if err := r.store(ctx, &conversations[i]); err != nil {
+			return err
+		}
+	}
+	return r.evict(ctx)
+}
+
+// store writes c and indexes it.
+func (r redisBackend) store(ctx context.Context, c *Conversation) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Set(ctx, conversationKey(c.ID), data, 0); err != nil {
+		return err
+	}
+	return r.index(ctx, c)
+}
+
+// index records when c was last updated.
+func (r redisBackend) index(ctx context.Context, c *Conversation) error {
+	_, err := r.client.Do(ctx, "ZADD", conversationIndexKey, strconv.FormatInt(c.UpdatedAt.UnixMilli(), 10), c.ID)
+	return err
+}
+
+// ids returns the ID of every conversation, least recently updated first.
+func (r redisBackend) ids(ctx context.Context) ([]string, error) {
+	reply, err := r.client.Do(ctx, "ZRANGE", conversationIndexKey, "0", "-1")
+	if err != nil {
+		return nil, err
+	}
+	members, _ := reply.([]interface{})
+	ids := make([]string, 0, len(members))
+	for _, member := range members {
+		if id, ok := member.([]byte); ok {
+			ids = append(ids, string(id))
+		}
+	}
+	return ids, nil
+}
+
+// evict drops the least recently updated conversations beyond the limit.
+func (r redisBackend) evict(ctx context.Context) error {
+	reply, err := r.client.Do(ctx, "ZCARD", conversationIndexKey)
+	if err != nil {
+		return err
+	}
+	count, _ := reply.(int64)
+	if count <= conversationLimit {
+		return nil
+	}
+	reply, err = r.client.Do(ctx, "ZRANGE", conversationIndexKey, "0", strconv.FormatInt(count-conversationLimit-1, 10))
+	if err != nil {
+		return err
+	}
+	members, _ := reply.([]interface{})
+	var ids, keys []string
+	for _, member := range members {
+		if id, ok := member.([]byte); ok {
+			ids = append(ids, string(id))
+			keys = append(keys, conversationKey(string(id)))
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := r.client.Del(ctx, keys...); err != nil {
+		return err
+	}
+	_, err = r.client.Do(ctx, append([]string{"ZREM", conversationIndexKey}, ids...)...)
+	return err
+}
@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"data-chatter/internal/env"
+	"data-chatter/internal/sqlparse"
+)
+
+// defaultSlowQueryLogSize is how many slow queries a SlowQueryLog keeps
+// without SLOW_QUERY_LOG_SIZE.
+const defaultSlowQueryLogSize = 100
+
+// IndexAdvice suggests indexes for the tables plan scans in full, one per
+// column the query's WHERE or JOIN ... ON conditions compare on that table,
+// unless an index already leads with the column: "consider an index on
+// contacts(days_available)". Tables whose columns or indexes cannot be read
+// get no advice, and neither do DuckDB's and ClickHouse's, which have no
+// secondary indexes of the kind advised.
+func (c *Connection) IndexAdvice(ctx context.Context, query string, plan *Plan) []string {
+	if plan == nil || len(plan.Scans) == 0 || c.Config.Type == "duckdb" || c.Config.Type == "clickhouse" {
+		return nil
+	}
+	filters := sqlparse.FilterColumns(query)
+	if len(filters) == 0 {
+		return nil
+	}
+	aliases := sqlparse.TableAliases(query)
+
+	var advice []string
+	seen := make(map[string]bool)
+	for _, scan := range plan.Scans {
+		table := scan.Table
+		bare := strings.ToLower(table[strings.LastIndex(table, ".")+1:])
+		if seen[bare] {
+			continue
+		}
+		seen[bare] = true
+
+		columns, err := c.TableColumns(ctx, bare)
+		if err != nil || len(columns) == 0 {
+			slog.DebugContext(ctx, "no index advice for table", "table", table, "error", err)
+			continue
+		}
+		names := make(map[string]string, len(columns))
+		for _, col := range columns {
+			names[strings.ToLower(col.Name)] = col.Name
+		}
+		indexes, err := c.TableIndexes(ctx, table)
+		if err != nil {
+			slog.DebugContext(ctx, "no index advice for table", "table", table, "error", err)
+			continue
+		}
+		indexed := make(map[string]bool)
+		for _, index := range indexes {
+			if len(index.Columns) > 0 {
+				indexed[strings.ToLower(index.Columns[0])] = true
+			}
+		}
+
+		suggested := make(map[string]bool)
+		for _, ref := range filters {
+			if ref.Qualifier != "" && ref.Qualifier != bare {
+				aliased, ok := aliases[ref.Qualifier]
+				if !ok || !strings.EqualFold(aliased[strings.LastIndex(aliased, ".")+1:], bare) {
+					continue
+				}
+			}
+			name, ok := names[ref.Name]
+			if !ok || indexed[ref.Name] || suggested[ref.Name] {
+				continue
+			}
+			suggested[ref.Name] = true
+			advice = append(advice, fmt.Sprintf("consider an index on %s(%s)", table, name))
+		}
+	}
+	return advice
+}
+
+// SlowQuery is a query that took at least the slow query threshold, with
+// its plan and the indexes that might speed it up.
+type SlowQuery struct {
+	Time           time.Time   `json:"time"`
+	Query          string      `json:"query"`
+	DurationMS     int64       `json:"duration_ms"`
+	Rows           int         `json:"rows"`
+	UserID         string      `json:"user_id,omitempty"`
+	ConversationID string      `json:"conversation_id,omitempty"`
+	Plan           string      `json:"plan,omitempty"`
+	FullScans      []TableScan `json:"full_scans,omitempty"`
+	Advice         []string    `json:"advice,omitempty"`
+}
+
+// SlowQueryLog keeps the most recent slow queries in memory. A nil
+// *SlowQueryLog records nothing.
+type SlowQueryLog struct {
+	mu      sync.Mutex
+	entries []SlowQuery // A ring of up to size entries
+	next    int
+	size    int
+}
+
+// NewSlowQueryLogFromEnv creates a log keeping the last SLOW_QUERY_LOG_SIZE
+// slow queries (default 100).
+func NewSlowQueryLogFromEnv() *SlowQueryLog {
+	size := env.Int("SLOW_QUERY_LOG_SIZE", defaultSlowQueryLogSize)
+	if size <= 0 {
+		size = defaultSlowQueryLogSize
+	}
+	return &SlowQueryLog{size: size}
+}
+
+// Record adds a slow query, dropping the oldest when the log is full.
+func (l *SlowQueryLog) Record(entry SlowQuery) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) < l.size {
+		l.entries = append(l.entries, entry)
+		return
+	}
+	l.entries[l.next] = entry
+	l.next = (l.next + 1) % l.size
+}
+
+// Recent returns up to limit slow queries, newest first; limit 0 returns
+// them all.
+func (l *SlowQueryLog) Recent(limit int) []SlowQuery {
+	if l == nil {
+		return []SlowQuery{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	n := len(l.entries)
+	if limit <= 0 || limit > n {
+		limit = n
+	}
+	recent := make([]SlowQuery, 0, limit)
+	for i := 0; i < limit; i++ {
+		// The newest entry sits just before next once the ring has wrapped
+		recent = append(recent, l.entries[((l.next-1-i)%n+n)%n])
+	}
+	return recent
+}
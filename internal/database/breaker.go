@@ -0,0 +1,108 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// ErrUnavailable is returned without trying the database while the circuit
+// breaker is open.
+var ErrUnavailable = errors.New("database unavailable")
+
+const (
+	// reconnectPingTimeout bounds each background reconnect ping.
+	reconnectPingTimeout = 5 * time.Second
+
+	// maxReconnectBackoff caps the wait between reconnect pings.
+	maxReconnectBackoff = 30 * time.Second
+)
+
+// circuitBreaker counts queries in a row that could not reach the database.
+// At Config.BreakerThreshold it opens: queries fail at once with
+// ErrUnavailable while the database is pinged in the background, and the
+// first successful ping closes it again. The zero value is closed.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	failures int
+	open     bool
+	lastErr  error
+}
+
+// connectionFailed counts a query that could not reach the database, and
+// when that opens the circuit breaker, starts reconnecting in the background.
+func (c *Connection) connectionFailed(err error) {
+	if !c.circuit.fail(err, c.Config.BreakerThreshold) {
+		return
+	}
+	slog.Error("database unavailable, failing queries until it reconnects",
+		"consecutive_failures", c.Config.BreakerThreshold, "error", err)
+	go c.reconnect()
+}
+
+// reconnect pings the database with a doubling backoff, from
+// Config.RetryBackoff up to maxReconnectBackoff, until a ping succeeds and
+// closes the circuit breaker, or the connection is closed.
+func (c *Connection) reconnect() {
+	backoff := max(c.Config.RetryBackoff, 100*time.Millisecond)
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-c.closed:
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), reconnectPingTimeout)
+		err := c.Health(ctx)
+		cancel()
+		if err == nil {
+			slog.Info("database reconnected")
+			return
+		}
+		slog.Debug("database still unavailable", "retry_in", backoff, "error", err)
+		backoff = min(backoff*2, maxReconnectBackoff)
+	}
+}
+
+// check returns ErrUnavailable, with the error that opened the breaker,
+// while the breaker is open.
+func (b *circuitBreaker) check() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.open {
+		return nil
+	}
+	return fmt.Errorf("%w: the last %d queries could not reach it, so queries fail until it answers a ping (last error: %v)",
+		ErrUnavailable, b.failures, b.lastErr)
+}
+
+// fail counts a connection failure and reports whether it opened the
+// breaker. A threshold of 0 never opens it.
+func (b *circuitBreaker) fail(err error, threshold int) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.lastErr = err
+	if b.open || threshold <= 0 || b.failures < threshold {
+		return false
+	}
+	b.open = true
+	return true
+}
+
+// reset closes the breaker and clears the failure count.
+func (b *circuitBreaker) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures, b.open, b.lastErr = 0, false, nil
+}
+
+// isOpen reports whether queries are failing fast.
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
@@ -1,30 +1,137 @@
 // Package database provides database connection management and configuration
-// for SQLite, PostgreSQL, and MySQL databases.
+// for SQLite, PostgreSQL, MySQL, DuckDB, ClickHouse, and SQL Server databases.
 package database
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"data-chatter/internal/querycache"
+	"data-chatter/internal/redact"
+	"data-chatter/internal/sqlparse"
+	"data-chatter/internal/types"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
 	_ "github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
+	_ "github.com/microsoft/go-mssqldb"
 )
 
 // Connection represents an active database connection with configuration.
 type Connection struct {
 	DB     *sql.DB
 	Config *Config
+
+	// Masker masks personal data in the results of tool queries; nil masks
+	// nothing. Set it before the connection is shared.
+	Masker *Masker
+
+	// ResultCache keeps the results of tool queries for a short time; nil
+	// caches nothing. Set it before the connection is shared.
+	ResultCache *querycache.Cache
+
+	// SlowQueries logs tool queries slower than Config.SlowQueryThreshold;
+	// nil logs none. Set it before the connection is shared.
+	SlowQueries *SlowQueryLog
+
+	// Loader fills the tables a query reads before it runs, such as external
+	// tables whose files have not been loaded yet; nil loads nothing. Set it
+	// before the connection is shared.
+	Loader TableLoader
+
+	// SharedSchema shares the schema read by Schema with other replicas
+	// connected to the same database; nil keeps it to this one. Set it
+	// before the connection is shared.
+	SharedSchema SchemaStore
+
+	// Tenant names the tenant this connection serves in multi-tenant mode,
+	// keeping its cached results apart from other tenants'; it is empty for
+	// the default database.
+	Tenant string
+
+	// Name names the database in DATABASES_FILE this connection is to, which
+	// chat sessions may switch to; it is empty for the default database.
+	Name string
+
+	// Generation counts the swaps that led to this connection, keeping the
+	// cached results of databases swapped out apart from its own.
+	Generation int
+
+	active atomic.Pointer[Connection] // Swapped in by Swap; nil for c itself
+	swapMu sync.Mutex
+
+	lastPing atomic.Int64 // Unix nanoseconds of the last successful ping
+	circuit  circuitBreaker
+	closed   chan struct{} // Closed by Close, stopping a background reconnect
+	close    sync.Once
+
+	schemaMu        sync.Mutex
+	schema          *Schema
+	schemaFetchedAt time.Time
+}
+
+// TableLoader fills tables on demand before queries read them.
+type TableLoader interface {
+	// LoadTables loads the tables query reads that are not loaded yet.
+	LoadTables(ctx context.Context, query string) error
+}
+
+// connectionKey is the context key of the connection a request is routed to.
+type connectionKey struct{}
+
+// WithConnection returns a context routing queries to conn instead of the
+// default connection, such as the database of the caller's tenant.
+func WithConnection(ctx context.Context, conn *Connection) context.Context {
+	return context.WithValue(ctx, connectionKey{}, conn)
+}
+
+// ConnectionFromContext returns the connection ctx is routed to, or nil.
+func ConnectionFromContext(ctx context.Context) *Connection {
+	conn, _ := ctx.Value(connectionKey{}).(*Connection)
+	return conn
+}
+
+// For returns the connection ctx is routed to, or when ctx names none,
+// c's active connection (see Swap). Code that holds the default connection
+// calls it before each use so that requests reach their tenant's database
+// or their session's, and the database the default was swapped to.
+func (c *Connection) For(ctx context.Context) *Connection {
+	if conn := ConnectionFromContext(ctx); conn != nil {
+		return conn
+	}
+	return c.Active()
 }
 
 // NewConnection establishes a new database connection using the provided configuration.
 // It configures connection pooling, tests the connection, and logs the successful connection.
+// SQLite connections are opened with the sandbox limits from the configuration,
+// and DuckDB databases may only read files in Config.DuckDBAllowedDirs.
+// The password is registered with the redact package, and errors are
+// redacted, so a driver echoing the DSN does not leak it.
 func NewConnection(config *Config) (*Connection, error) {
-	db, err := sql.Open(config.DriverName(), config.ConnectionString())
-	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %w", err)
+	redact.Secret(config.Password)
+	var db *sql.DB
+	if config.Type == "sqlite" {
+		db = sql.OpenDB(newSQLiteConnector(config))
+	} else if config.Type == "duckdb" && !slices.Contains(sql.Drivers(), "duckdb") {
+		return nil, fmt.Errorf("DB_TYPE=duckdb needs a server built with DuckDB support: go build -tags duckdb")
+	} else {
+		var err error
+		db, err = sql.Open(config.DriverName(), config.ConnectionString())
+		if err != nil {
+			return nil, fmt.Errorf("failed to open database: %w", redact.Error(err))
+		}
 	}
 
 	db.SetMaxOpenConns(config.MaxConns)
@@ -32,30 +139,290 @@ func NewConnection(config *Config) (*Connection, error) {
 	db.SetConnMaxLifetime(time.Hour)
 
 	if err := db.Ping(); err != nil {
-		return nil, fmt.Errorf("failed to ping database: %w", err)
+		return nil, fmt.Errorf("failed to ping database: %w", redact.Error(err))
+	}
+	if config.Type == "duckdb" {
+		if err := restrictDuckDB(db, config.DuckDBAllowedDirs); err != nil {
+			db.Close()
+			return nil, err
+		}
 	}
 
-	if config.Type == "sqlite" {
-		log.Printf("Connected to SQLite database: %s", config.FilePath)
+	if config.Type == "sqlite" || config.Type == "duckdb" {
+		slog.Info("connected to database", "type", config.Type, "file", config.FilePath)
 	} else {
-		log.Printf("Connected to %s database: %s@%s:%d/%s", config.Type, config.User, config.Host, config.Port, config.DBName)
+		slog.Info("connected to database", "type", config.Type, "user", config.User, "host", config.Host, "port", config.Port, "dbname", config.DBName)
 	}
 
-	return &Connection{
+	conn := &Connection{
 		DB:     db,
 		Config: config,
-	}, nil
+		closed: make(chan struct{}),
+	}
+	conn.lastPing.Store(time.Now().UnixNano())
+	return conn, nil
 }
 
 // Close terminates the database connection and releases associated resources.
 func (c *Connection) Close() error {
+	c.close.Do(func() {
+		if c.closed != nil {
+			close(c.closed)
+		}
+	})
 	if c.DB != nil {
-		return c.DB.Close()
+		return errors.Join(c.closeActive(), c.DB.Close())
 	}
 	return nil
 }
 
-// Health performs a ping test to verify the database connection is still active.
-func (c *Connection) Health() error {
-	return c.DB.Ping()
+// Health performs a ping test to verify the database connection is still
+// active. A successful ping closes the circuit breaker.
+func (c *Connection) Health(ctx context.Context) error {
+	if err := c.DB.PingContext(ctx); err != nil {
+		return err
+	}
+	c.lastPing.Store(time.Now().UnixNano())
+	c.circuit.reset()
+	return nil
+}
+
+// Unavailable reports whether the circuit breaker is open, failing queries
+// with ErrUnavailable until the database answers a ping.
+func (c *Connection) Unavailable() bool {
+	return c.circuit.isOpen()
+}
+
+// LastPing returns when the database last answered a ping, at connection
+// or from Health.
+func (c *Connection) LastPing() time.Time {
+	return time.Unix(0, c.lastPing.Load())
+}
+
+// Rows is the result of a sandboxed query. Close must be called to release
+// the connection and its step budget.
+type Rows struct {
+	*sql.Rows
+	maxSteps  int64
+	exhausted func() bool
+	release   func()
+}
+
+// Err returns the iteration error, reporting an exhausted step budget as ErrStepLimit.
+func (r *Rows) Err() error {
+	return r.translate(r.Rows.Err())
+}
+
+// Close closes the rows and releases the connection they were read from.
+func (r *Rows) Close() error {
+	err := r.Rows.Close()
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+	return err
+}
+
+// translate reports an interrupt caused by the step budget as ErrStepLimit.
+func (r *Rows) translate(err error) error {
+	if err == nil || r.exhausted == nil || !r.exhausted() {
+		return err
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrInterrupt {
+		return fmt.Errorf("%w (%d VM steps)", ErrStepLimit, r.maxSteps)
+	}
+	return err
+}
+
+// ErrMultipleStatements is returned when an untrusted query holds more than
+// one statement, since a statement such as COMMIT or PRAGMA query_only = OFF
+// could lift the read-only mode for the ones after it.
+var ErrMultipleStatements = errors.New("only one SQL statement may be run at a time")
+
+// ErrNotReadOnly is returned when SQLite reports that an untrusted query
+// would write to the database.
+var ErrNotReadOnly = errors.New("query would modify the database")
+
+// Query runs an untrusted query, such as LLM-generated SQL, under the
+// connection's sandbox limits. Queries with more than one statement are
+// refused with ErrMultipleStatements. The query runs read-only at the driver
+// level, so a write that slips past SQL validation still fails: in a READ ONLY
+// transaction on Postgres and MySQL, and on SQLite with PRAGMA query_only and
+// a check, before it runs, that SQLite parses it as one statement that does
+// not write.
+// DuckDB has no read-only transactions, so there the query runs in one that
+// is always rolled back, and ClickHouse has no transactions at all, so there
+// the query runs with the readonly=2 setting. On SQLite the statement is also aborted once it
+// executes more than SQLiteMaxSteps VDBE instructions.
+//
+// A query that cannot reach the database is tried up to Config.RetryAttempts
+// times in all, waiting Config.RetryBackoff and then twice as long each time.
+// While the circuit breaker is open, Query fails at once with ErrUnavailable.
+// Otherwise Loader, if set, first loads the tables the query reads.
+func (c *Connection) Query(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	if err := c.circuit.check(); err != nil {
+		return nil, err
+	}
+	if sqlparse.MultipleStatements(query) {
+		return nil, ErrMultipleStatements
+	}
+	if c.Loader != nil {
+		if err := c.Loader.LoadTables(ctx, query); err != nil {
+			return nil, err
+		}
+	}
+
+	backoff := c.Config.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		rows, err := c.query(ctx, query, args...)
+		if err == nil {
+			c.circuit.reset()
+			return rows, nil
+		}
+		if code, _ := ClassifyError(err); code != types.ErrorConnection {
+			if ctx.Err() == nil {
+				c.circuit.reset() // The database answered, if only to refuse the query
+			}
+			return nil, err
+		}
+		if attempt >= c.Config.RetryAttempts {
+			c.connectionFailed(err)
+			return nil, err
+		}
+
+		slog.WarnContext(ctx, "database unreachable, retrying", "attempt", attempt, "backoff", backoff, "error", err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, err
+		}
+		backoff *= 2
+	}
+}
+
+// query makes one attempt at Query.
+func (c *Connection) query(ctx context.Context, query string, args ...interface{}) (*Rows, error) {
+	conn, err := c.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &Rows{release: func() { conn.Close() }}
+
+	if c.Config.Type == "clickhouse" {
+		// readonly=2 still lets the driver set max_execution_time from ctx
+		ctx = clickhouse.Context(ctx, clickhouse.WithSettings(clickhouse.Settings{"readonly": 2}))
+		rows, err := conn.QueryContext(ctx, query, args...)
+		if err != nil {
+			result.release()
+			return nil, err
+		}
+		result.Rows = rows
+		return result, nil
+	}
+
+	if c.Config.Type != "sqlite" {
+		options := &sql.TxOptions{ReadOnly: true}
+		if c.Config.Type == "duckdb" || c.Config.Type == "sqlserver" {
+			options = nil // The rollback below discards any write instead
+		}
+		tx, err := conn.BeginTx(ctx, options)
+		if err != nil {
+			result.release()
+			return nil, fmt.Errorf("failed to start query transaction: %w", err)
+		}
+		result.then(func() { tx.Rollback() })
+
+		rows, err := tx.QueryContext(ctx, query, args...)
+		if err != nil {
+			result.release()
+			return nil, err
+		}
+		result.Rows = rows
+		return result, nil
+	}
+
+	if err := setQueryOnly(ctx, conn, true); err != nil {
+		result.release()
+		return nil, err
+	}
+	result.then(func() {
+		// A connection left query_only would break the app's own writes, so
+		// one that cannot be reset is discarded rather than pooled. With
+		// SQLiteReadOnly it goes back to query_only, as it was connected.
+		if err := setQueryOnly(context.Background(), conn, c.Config.SQLiteReadOnly); err != nil {
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	})
+	if err := checkSQLiteStatement(conn, query); err != nil {
+		result.release()
+		return nil, err
+	}
+
+	if c.Config.SQLiteMaxSteps > 0 {
+		exhausted, releaseBudget, err := installStepBudget(conn, c.Config.SQLiteMaxSteps)
+		if err != nil {
+			result.release()
+			return nil, err
+		}
+		result.maxSteps, result.exhausted = c.Config.SQLiteMaxSteps, exhausted
+		result.then(releaseBudget)
+	}
+
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		err = result.translate(err)
+		result.release()
+		return nil, err
+	}
+	result.Rows = rows
+	return result, nil
+}
+
+// then makes release run cleanup before what it already does, so resources
+// are released in the reverse order they were acquired.
+func (r *Rows) then(cleanup func()) {
+	release := r.release
+	r.release = func() {
+		cleanup()
+		release()
+	}
+}
+
+// restrictDuckDB limits the files DuckDB may read or write to those in
+// dirs, then locks the configuration so queries cannot lift the limit.
+// The settings apply to the whole database, so every pooled connection
+// shares them.
+func restrictDuckDB(db *sql.DB, dirs []string) error {
+	quoted := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("invalid DuckDB allowed directory %s: %w", dir, err)
+		}
+		quoted = append(quoted, "'"+strings.ReplaceAll(abs+string(filepath.Separator), "'", "''")+"'")
+	}
+	for _, statement := range []string{
+		"SET allowed_directories = [" + strings.Join(quoted, ", ") + "]",
+		"SET enable_external_access = false",
+		"SET lock_configuration = true",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("failed to apply %q: %w", statement, err)
+		}
+	}
+	return nil
+}
+
+// setQueryOnly turns SQLite's query_only pragma on or off for conn, which
+// makes every statement that would change the database fail.
+func setQueryOnly(ctx context.Context, conn *sql.Conn, on bool) error {
+	pragma := "PRAGMA query_only = OFF"
+	if on {
+		pragma = "PRAGMA query_only = ON"
+	}
+	if _, err := conn.ExecContext(ctx, pragma); err != nil {
+		return fmt.Errorf("failed to apply %q: %w", pragma, err)
+	}
+	return nil
 }
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DataVersions returns a fingerprint of the contents of each of tables, so
+// that callers can tell whether anything was written to a table since they
+// last looked. The fingerprints come from cheap statistics rather than the
+// rows themselves, so they are best-effort:
+//
+//   - SQLite counts rows and the highest rowid, which catches inserts and
+//     deletes but not updates in place.
+//   - MySQL uses information_schema's update time and row estimate, which
+//     the server may cache for information_schema_stats_expiry.
+//   - PostgreSQL uses pg_stat_user_tables' insert, update, and delete
+//     counters, which lag commits by up to a second.
+//   - ClickHouse uses system.tables' row and byte totals, which change with
+//     inserts and with the mutations behind updates and deletes.
+//   - DuckDB counts rows, which catches inserts and deletes but not
+//     updates, and for views reads their files' row counts.
+//   - SQL Server reads the row count sys.partitions keeps for the table's
+//     heap or clustered index, which likewise misses updates.
+//
+// A table that does not exist or cannot be read is an error.
+func (c *Connection) DataVersions(ctx context.Context, tables []string) (map[string]string, error) {
+	versions := make(map[string]string, len(tables))
+	for _, table := range tables {
+		var query string
+		var args []interface{}
+		switch c.Config.Type {
+		case "sqlite":
+			query = fmt.Sprintf("SELECT COUNT(*) || ':' || COALESCE(MAX(rowid), 0) FROM %s", c.Config.QuoteIdentifier(table))
+		case "clickhouse":
+			query = `SELECT concat(toString(ifNull(total_rows, 0)), ':', toString(ifNull(total_bytes, 0)))
+			         FROM system.tables
+			         WHERE database = currentDatabase() AND name = ?`
+			args = append(args, table)
+		case "duckdb":
+			query = fmt.Sprintf("SELECT COUNT(*)::VARCHAR FROM %s", c.Config.QuoteIdentifier(table))
+		case "mysql":
+			query = `SELECT CONCAT(COALESCE(UPDATE_TIME, ''), ':', COALESCE(TABLE_ROWS, ''))
+			         FROM information_schema.tables
+			         WHERE table_schema = DATABASE() AND table_name = ?`
+			args = append(args, table)
+		case "sqlserver":
+			query = `SELECT CAST(SUM(rows) AS VARCHAR(20))
+			         FROM sys.partitions
+			         WHERE object_id = OBJECT_ID(@p1) AND index_id IN (0, 1)
+			         GROUP BY object_id`
+			args = append(args, table)
+		default:
+			query = `SELECT n_tup_ins || ':' || n_tup_upd || ':' || n_tup_del
+			         FROM pg_stat_user_tables
+			         WHERE relid = to_regclass($1)`
+			args = append(args, table)
+		}
+
+		var version sql.NullString
+		if err := c.DB.QueryRowContext(ctx, query, args...).Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to read data version of %s: %w", table, err)
+		}
+		versions[table] = version.String
+	}
+	return versions, nil
+}
@@ -0,0 +1,45 @@
+//go:build duckdb
+
+package database
+
+import (
+	"errors"
+	"strconv"
+
+	"data-chatter/internal/types"
+
+	"github.com/duckdb/duckdb-go/v2"
+)
+
+// DuckDB needs cgo and a prebuilt library for each platform, so it is only
+// compiled in with the duckdb build tag.
+func init() {
+	classifyDuckDB = func(err error) (string, string, bool) {
+		var duckErr *duckdb.Error
+		if !errors.As(err, &duckErr) {
+			return "", "", false
+		}
+		return classifyDuckDBError(duckErr), strconv.Itoa(int(duckErr.Type)), true
+	}
+}
+
+// classifyDuckDBError maps a DuckDB error type to a tool error code.
+func classifyDuckDBError(err *duckdb.Error) string {
+	switch err.Type {
+	case duckdb.ErrorTypeParser, duckdb.ErrorTypeSyntax:
+		return types.ErrorSyntax
+	case duckdb.ErrorTypeCatalog, duckdb.ErrorTypeBinder:
+		return types.ErrorUndefinedObject
+	case duckdb.ErrorTypePermission:
+		return types.ErrorPermissionDenied
+	case duckdb.ErrorTypeInterrupt:
+		return types.ErrorCancelled
+	case duckdb.ErrorTypeTransaction:
+		return types.ErrorLockConflict
+	case duckdb.ErrorTypeOutOfMemory, duckdb.ErrorTypeObjectSize:
+		return types.ErrorResourceLimit
+	case duckdb.ErrorTypeConnection:
+		return types.ErrorConnection
+	}
+	return types.ErrorQuery
+}
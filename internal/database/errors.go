@@ -0,0 +1,206 @@
+package database
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+
+	"data-chatter/internal/types"
+
+	"github.com/ClickHouse/clickhouse-go/v2"
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// ErrTooManyRows is returned when a query result exceeds Config.MaxResultRows.
+var ErrTooManyRows = errors.New("query returned more rows than allowed")
+
+// classifyDuckDB maps a DuckDB error to a tool error code and DuckDB's
+// error type, reporting false for other errors. It is set in builds with
+// the duckdb tag.
+var classifyDuckDB func(err error) (code, driverCode string, ok bool)
+
+// ClassifyError maps a query error to a stable tool error code, along with
+// the driver's own error code when there is one. Unrecognized errors are
+// types.ErrorQuery.
+func ClassifyError(err error) (code, driverCode string) {
+	switch {
+	case errors.Is(err, ErrTooManyRows):
+		return types.ErrorTooManyRows, ""
+	case errors.Is(err, ErrStepLimit), errors.Is(err, ErrTooExpensive):
+		return types.ErrorResourceLimit, ""
+	case errors.Is(err, ErrMultipleStatements), errors.Is(err, ErrNotReadOnly):
+		return types.ErrorValidation, ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return types.ErrorTimeout, ""
+	case errors.Is(err, context.Canceled):
+		return types.ErrorCancelled, ""
+	case errors.Is(err, ErrUnavailable):
+		return types.ErrorUnavailable, ""
+	case errors.Is(err, driver.ErrBadConn), errors.Is(err, mysql.ErrInvalidConn):
+		return types.ErrorConnection, ""
+	}
+
+	// Refused, reset, and timed-out network connections
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return types.ErrorConnection, ""
+	}
+
+	var pgErr *pq.Error
+	if errors.As(err, &pgErr) {
+		return classifyPostgres(pgErr), string(pgErr.Code)
+	}
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return classifyMySQL(mysqlErr), strconv.Itoa(int(mysqlErr.Number))
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return classifySQLite(sqliteErr), strconv.Itoa(int(sqliteErr.ExtendedCode))
+	}
+	var clickHouseErr *clickhouse.Exception
+	if errors.As(err, &clickHouseErr) {
+		return classifyClickHouse(clickHouseErr), strconv.Itoa(int(clickHouseErr.Code))
+	}
+	var sqlServerErr mssql.Error
+	if errors.As(err, &sqlServerErr) {
+		return classifySQLServer(sqlServerErr), strconv.Itoa(int(sqlServerErr.Number))
+	}
+	if classifyDuckDB != nil {
+		if code, driverCode, ok := classifyDuckDB(err); ok {
+			return code, driverCode
+		}
+	}
+	return types.ErrorQuery, ""
+}
+
+// classifyPostgres maps a SQLSTATE to a tool error code.
+func classifyPostgres(err *pq.Error) string {
+	switch err.Code {
+	case "42601":
+		return types.ErrorSyntax
+	case "42501", "25006":
+		// 25006 is a write attempted in a read-only transaction
+		return types.ErrorPermissionDenied
+	case "42P01", "42703", "42883", "3F000":
+		return types.ErrorUndefinedObject
+	case "57014", "25P03", "55P03":
+		// query_canceled is how statement_timeout surfaces
+		return types.ErrorTimeout
+	case "40001", "40P01":
+		return types.ErrorLockConflict
+	}
+
+	switch err.Code.Class() {
+	case "08", "57":
+		return types.ErrorConnection
+	case "53", "54":
+		return types.ErrorResourceLimit
+	}
+	return types.ErrorQuery
+}
+
+// classifyMySQL maps a MySQL server error number to a tool error code.
+func classifyMySQL(err *mysql.MySQLError) string {
+	switch err.Number {
+	case 1064, 1149:
+		return types.ErrorSyntax
+	case 1044, 1045, 1142, 1143, 1227, 1370, 1792:
+		return types.ErrorPermissionDenied
+	case 1054, 1146, 1305, 1049:
+		return types.ErrorUndefinedObject
+	case 3024, 1317, 1205:
+		// max_execution_time, KILL QUERY, and lock wait timeouts
+		return types.ErrorTimeout
+	case 1213:
+		return types.ErrorLockConflict
+	case 1037, 1038, 1104, 1114, 1153, 3170:
+		return types.ErrorResourceLimit
+	case 1040, 1053, 2006, 2013:
+		return types.ErrorConnection
+	}
+	return types.ErrorQuery
+}
+
+// classifyClickHouse maps a ClickHouse server error code to a tool error code.
+func classifyClickHouse(err *clickhouse.Exception) string {
+	switch err.Code {
+	case 62:
+		return types.ErrorSyntax
+	case 16, 46, 47, 60, 81:
+		// No such column, unknown function, identifier, table, or database
+		return types.ErrorUndefinedObject
+	case 164, 497:
+		// READONLY is a write attempted under the readonly setting
+		return types.ErrorPermissionDenied
+	case 159:
+		return types.ErrorTimeout
+	case 394:
+		return types.ErrorCancelled
+	case 158, 202, 241, 307, 396:
+		return types.ErrorResourceLimit
+	case 473:
+		return types.ErrorLockConflict
+	case 209, 210:
+		return types.ErrorConnection
+	}
+	return types.ErrorQuery
+}
+
+// classifySQLServer maps a SQL Server error number to a tool error code.
+func classifySQLServer(err mssql.Error) string {
+	switch err.Number {
+	case 102, 156:
+		return types.ErrorSyntax
+	case 195, 207, 208, 911, 4121:
+		// Unknown function, column, object, or database
+		return types.ErrorUndefinedObject
+	case 229, 230, 262, 297, 300, 3906:
+		// 3906 is a write to a database that is read-only
+		return types.ErrorPermissionDenied
+	case 1222:
+		return types.ErrorTimeout
+	case 1205:
+		return types.ErrorLockConflict
+	case 701, 1105, 8645:
+		return types.ErrorResourceLimit
+	case 233, 10053, 10054, 40613:
+		return types.ErrorConnection
+	}
+	return types.ErrorQuery
+}
+
+// classifySQLite maps a SQLite result code, and for the generic SQLITE_ERROR
+// its message, to a tool error code.
+func classifySQLite(err sqlite3.Error) string {
+	switch err.Code {
+	case sqlite3.ErrPerm, sqlite3.ErrAuth, sqlite3.ErrReadonly:
+		return types.ErrorPermissionDenied
+	case sqlite3.ErrInterrupt:
+		return types.ErrorCancelled
+	case sqlite3.ErrBusy, sqlite3.ErrLocked:
+		return types.ErrorLockConflict
+	case sqlite3.ErrNomem, sqlite3.ErrTooBig, sqlite3.ErrFull:
+		return types.ErrorResourceLimit
+	case sqlite3.ErrCantOpen, sqlite3.ErrNotADB, sqlite3.ErrCorrupt:
+		return types.ErrorConnection
+	case sqlite3.ErrError:
+		message := err.Error()
+		switch {
+		case strings.Contains(message, "syntax error"), strings.Contains(message, "incomplete input"),
+			strings.Contains(message, "unrecognized token"):
+			return types.ErrorSyntax
+		case strings.Contains(message, "no such "):
+			return types.ErrorUndefinedObject
+		case strings.Contains(message, "not authorized"):
+			return types.ErrorPermissionDenied
+		}
+	}
+	return types.ErrorQuery
+}
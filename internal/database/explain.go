@@ -0,0 +1,472 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"data-chatter/internal/sqlparse"
+)
+
+// Cost guard modes for Config.CostGuard.
+const (
+	CostGuardOff    = "off"
+	CostGuardWarn   = "warn"
+	CostGuardReject = "reject"
+)
+
+// ErrTooExpensive is returned for queries the cost guard rejects.
+var ErrTooExpensive = errors.New("query plan is too expensive")
+
+// Plan is a query's execution plan as estimated by the database.
+type Plan struct {
+	// Text is the plan as the database describes it, one step per line.
+	Text string
+
+	// Cost is the planner's estimated total cost, in the database's own
+	// units. Only PostgreSQL and SQL Server report one; it is 0 elsewhere.
+	Cost float64
+
+	// Scans are the tables the plan reads in full.
+	Scans []TableScan
+}
+
+// TableScan is a full scan of a table, with the table's estimated row count
+// or -1 when it is unknown.
+type TableScan struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+}
+
+// Explain returns the plan of query without running it, using EXPLAIN QUERY
+// PLAN on SQLite, EXPLAIN ESTIMATE on ClickHouse, SHOWPLAN_XML on SQL
+// Server, and EXPLAIN elsewhere. Like Query, it runs read-only under
+// the sandbox limits, since query is untrusted.
+func (c *Connection) Explain(ctx context.Context, query string, args ...interface{}) (*Plan, error) {
+	switch c.Config.Type {
+	case "sqlite":
+		return c.explainSQLite(ctx, query, args)
+	case "mysql":
+		return c.explainMySQL(ctx, query, args)
+	case "duckdb":
+		return c.explainDuckDB(ctx, query, args)
+	case "clickhouse":
+		return c.explainClickHouse(ctx, query, args)
+	case "sqlserver":
+		return c.explainSQLServer(ctx, query, args)
+	default:
+		return c.explainPostgres(ctx, query, args)
+	}
+}
+
+// Problems describes what in the plan exceeds the limits: full scans of
+// tables with more than maxScanRows rows and a cost above maxCost. A zero
+// limit is not checked.
+func (p *Plan) Problems(maxScanRows int64, maxCost float64) []string {
+	var problems []string
+	for _, scan := range p.Scans {
+		if maxScanRows > 0 && scan.Rows > maxScanRows {
+			problems = append(problems, fmt.Sprintf("full scan of %s (about %d rows, limit %d)", scan.Table, scan.Rows, maxScanRows))
+		}
+	}
+	if maxCost > 0 && p.Cost > maxCost {
+		problems = append(problems, fmt.Sprintf("estimated cost %.0f exceeds %.0f", p.Cost, maxCost))
+	}
+	return problems
+}
+
+// explainSQLite reads EXPLAIN QUERY PLAN. Its SCAN steps without an index
+// are full table scans, named by the table's alias when it has one.
+func (c *Connection) explainSQLite(ctx context.Context, query string, args []interface{}) (*Plan, error) {
+	rows, err := c.Query(ctx, "EXPLAIN QUERY PLAN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plan := &Plan{}
+	depth := make(map[int]int)
+	var lines []string
+	var scanned []string
+	for rows.Next() {
+		var id, parent, unused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &unused, &detail); err != nil {
+			return nil, err
+		}
+		depth[id] = depth[parent] + 1
+		lines = append(lines, strings.Repeat("  ", depth[id]-1)+detail)
+
+		fields := strings.Fields(detail)
+		if len(fields) >= 2 && fields[0] == "SCAN" && !strings.Contains(detail, " USING ") {
+			name := fields[1]
+			if name == "TABLE" && len(fields) >= 3 { // SQLite before 3.36
+				name = fields[2]
+			}
+			scanned = append(scanned, name)
+		}
+	}
+	err = rows.Err()
+	rows.Close() // release the connection before sizing the tables
+	if err != nil {
+		return nil, err
+	}
+	plan.Text = strings.Join(lines, "\n")
+
+	aliases := sqlparse.TableAliases(query)
+	for _, name := range scanned {
+		if strings.HasPrefix(name, "(") || name == "CONSTANT" {
+			continue // subqueries and VALUES
+		}
+		if table, ok := aliases[strings.ToLower(name)]; ok {
+			name = table
+		}
+		// The largest rowid approximates the row count without counting
+		var maxRowID sql.NullInt64
+		if err := c.DB.QueryRowContext(ctx, "SELECT MAX(rowid) FROM "+c.Config.QuoteIdentifier(name)).Scan(&maxRowID); err != nil {
+			continue // a CTE, view, or WITHOUT ROWID table
+		}
+		plan.Scans = append(plan.Scans, TableScan{Table: name, Rows: maxRowID.Int64})
+	}
+	return plan, nil
+}
+
+// pgPlanNode is a node of PostgreSQL's EXPLAIN (FORMAT JSON) output.
+type pgPlanNode struct {
+	NodeType     string       `json:"Node Type"`
+	RelationName string       `json:"Relation Name"`
+	Schema       string       `json:"Schema"`
+	TotalCost    float64      `json:"Total Cost"`
+	PlanRows     float64      `json:"Plan Rows"`
+	Plans        []pgPlanNode `json:"Plans"`
+}
+
+// explainPostgres reads EXPLAIN (FORMAT JSON). Seq Scan nodes are full table
+// scans, sized by the table statistics in pg_class.
+func (c *Connection) explainPostgres(ctx context.Context, query string, args []interface{}) (*Plan, error) {
+	rows, err := c.Query(ctx, "EXPLAIN (FORMAT JSON) "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var raw []byte
+	if rows.Next() {
+		err = rows.Scan(&raw)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	var explained []struct {
+		Plan pgPlanNode `json:"Plan"`
+	}
+	if err := json.Unmarshal(raw, &explained); err != nil || len(explained) == 0 {
+		return nil, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+
+	root := explained[0].Plan
+	plan := &Plan{Cost: root.TotalCost}
+	var lines []string
+	var walk func(node pgPlanNode, depth int)
+	walk = func(node pgPlanNode, depth int) {
+		line := strings.Repeat("  ", depth) + node.NodeType
+		if node.RelationName != "" {
+			line += " on " + node.RelationName
+		}
+		lines = append(lines, fmt.Sprintf("%s (cost=%.2f rows=%.0f)", line, node.TotalCost, node.PlanRows))
+
+		if node.NodeType == "Seq Scan" && node.RelationName != "" {
+			name := node.RelationName
+			if node.Schema != "" {
+				name = node.Schema + "." + name
+			}
+			// reltuples is -1 for tables that were never analyzed
+			var rows sql.NullFloat64
+			err := c.DB.QueryRowContext(ctx, `SELECT reltuples FROM pg_class WHERE oid = to_regclass($1)`, name).Scan(&rows)
+			if err != nil || !rows.Valid || rows.Float64 < 0 {
+				rows.Float64 = -1
+			}
+			plan.Scans = append(plan.Scans, TableScan{Table: name, Rows: int64(rows.Float64)})
+		}
+		for _, child := range node.Plans {
+			walk(child, depth+1)
+		}
+	}
+	walk(root, 0)
+	plan.Text = strings.Join(lines, "\n")
+	return plan, nil
+}
+
+// explainMySQL reads the tabular EXPLAIN. Access type ALL is a full table
+// scan, named by the table's alias when it has one, and its rows column
+// estimates the rows examined.
+func (c *Connection) explainMySQL(ctx context.Context, query string, args []interface{}) (*Plan, error) {
+	rows, err := c.Query(ctx, "EXPLAIN "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]sql.NullString, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	plan := &Plan{}
+	aliases := sqlparse.TableAliases(query)
+	var lines []string
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		step := make(map[string]string, len(columns))
+		for i, column := range columns {
+			step[strings.ToLower(column)] = values[i].String
+		}
+		lines = append(lines, fmt.Sprintf("table=%s type=%s key=%s rows=%s extra=%s",
+			step["table"], step["type"], step["key"], step["rows"], step["extra"]))
+
+		if step["type"] == "ALL" && step["table"] != "" && !strings.HasPrefix(step["table"], "<") {
+			examined, err := strconv.ParseInt(step["rows"], 10, 64)
+			if err != nil {
+				examined = -1
+			}
+			name := step["table"]
+			if table, ok := aliases[strings.ToLower(name)]; ok {
+				name = table
+			}
+			plan.Scans = append(plan.Scans, TableScan{Table: name, Rows: examined})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	plan.Text = strings.Join(lines, "\n")
+	return plan, nil
+}
+
+// duckDBPlanNode is a node of DuckDB's EXPLAIN (FORMAT JSON) output.
+type duckDBPlanNode struct {
+	Name      string                 `json:"name"`
+	ExtraInfo map[string]interface{} `json:"extra_info"`
+	Children  []duckDBPlanNode       `json:"children"`
+}
+
+// explainDuckDB reads EXPLAIN (FORMAT JSON). Scan nodes read a table, or a
+// Parquet or CSV file through a function such as READ_PARQUET, in full
+// apart from the row groups their filters skip; their estimated
+// cardinality sizes the scan.
+func (c *Connection) explainDuckDB(ctx context.Context, query string, args []interface{}) (*Plan, error) {
+	rows, err := c.Query(ctx, "EXPLAIN (FORMAT JSON) "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	var key, raw string
+	if rows.Next() {
+		err = rows.Scan(&key, &raw)
+	}
+	if err == nil {
+		err = rows.Err()
+	}
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	var roots []duckDBPlanNode
+	if err := json.Unmarshal([]byte(raw), &roots); err != nil || len(roots) == 0 {
+		return nil, fmt.Errorf("failed to parse query plan: %w", err)
+	}
+
+	plan := &Plan{}
+	var lines []string
+	var walk func(node duckDBPlanNode, depth int)
+	walk = func(node duckDBPlanNode, depth int) {
+		name := strings.TrimSpace(node.Name)
+		table, _ := node.ExtraInfo["Table"].(string)
+		function, _ := node.ExtraInfo["Function"].(string)
+		estimate, _ := node.ExtraInfo["Estimated Cardinality"].(string)
+
+		line := strings.Repeat("  ", depth) + name
+		if table != "" {
+			line += " on " + table
+		} else if function != "" && function != name {
+			line += " " + function
+		}
+		if estimate != "" {
+			line += " (rows=" + strings.TrimPrefix(estimate, "~") + ")"
+		}
+		lines = append(lines, line)
+
+		scanned := table
+		switch {
+		case scanned != "":
+		case strings.HasPrefix(function, "READ_"):
+			scanned = function
+		case strings.HasPrefix(name, "READ_"):
+			scanned = name
+		}
+		if scanned != "" && (name == "SEQ_SCAN" || name == "TABLE_SCAN" || strings.HasPrefix(name, "READ_")) {
+			rows, err := strconv.ParseInt(strings.Map(func(r rune) rune {
+				if r >= '0' && r <= '9' {
+					return r
+				}
+				return -1
+			}, estimate), 10, 64)
+			if err != nil {
+				rows = -1
+			}
+			plan.Scans = append(plan.Scans, TableScan{Table: scanned, Rows: rows})
+		}
+		for _, child := range node.Children {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+	plan.Text = strings.Join(lines, "\n")
+	return plan, nil
+}
+
+// explainClickHouse reads EXPLAIN ESTIMATE, which lists the rows each
+// MergeTree table will read once the primary key has pruned its parts and
+// granules. Every such read counts as a scan, sized by those rows, since
+// ClickHouse always reads whole granules.
+func (c *Connection) explainClickHouse(ctx context.Context, query string, args []interface{}) (*Plan, error) {
+	rows, err := c.Query(ctx, "EXPLAIN ESTIMATE "+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plan := &Plan{}
+	var lines []string
+	for rows.Next() {
+		var database, table string
+		var parts, read, marks uint64
+		if err := rows.Scan(&database, &table, &parts, &read, &marks); err != nil {
+			return nil, err
+		}
+		lines = append(lines, fmt.Sprintf("table=%s.%s parts=%d rows=%d marks=%d", database, table, parts, read, marks))
+		plan.Scans = append(plan.Scans, TableScan{Table: table, Rows: int64(read)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	plan.Text = strings.Join(lines, "\n")
+	return plan, nil
+}
+
+// explainSQLServer reads the estimated plan SQL Server returns in place of
+// results while SHOWPLAN_XML is on, so query is compiled but never run.
+// Table Scan and Clustered Index Scan operators read a table in full and
+// are sized by its cardinality; the statement's subtree cost is the plan's.
+func (c *Connection) explainSQLServer(ctx context.Context, query string, args []interface{}) (*Plan, error) {
+	conn, err := c.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, "SET SHOWPLAN_XML ON"); err != nil {
+		return nil, err
+	}
+	defer func() {
+		// A connection left compiling instead of running would return plans
+		// to whoever borrows it next, so it is discarded if it cannot be reset
+		if _, err := conn.ExecContext(context.Background(), "SET SHOWPLAN_XML OFF"); err != nil {
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+	}()
+
+	var raw string
+	if err := conn.QueryRowContext(ctx, query, args...).Scan(&raw); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+	aliases := sqlparse.TableAliases(query)
+	var lines []string
+	var operators []bool // Whether each open RelOp is a full scan
+	decoder := xml.NewDecoder(strings.NewReader(raw))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse query plan: %w", err)
+		}
+		switch element := token.(type) {
+		case xml.StartElement:
+			attrs := make(map[string]string, len(element.Attr))
+			for _, attr := range element.Attr {
+				attrs[attr.Name.Local] = attr.Value
+			}
+			switch element.Name.Local {
+			case "StmtSimple":
+				if cost, err := strconv.ParseFloat(attrs["StatementSubTreeCost"], 64); err == nil {
+					plan.Cost += cost
+				}
+			case "RelOp":
+				op := attrs["PhysicalOp"]
+				lines = append(lines, fmt.Sprintf("%s%s (cost=%s rows=%s)",
+					strings.Repeat("  ", len(operators)), op, attrs["EstimatedTotalSubtreeCost"], attrs["EstimateRows"]))
+				full := op == "Table Scan" || op == "Clustered Index Scan"
+				operators = append(operators, full)
+				if full {
+					rows, err := strconv.ParseFloat(attrs["TableCardinality"], 64)
+					if err != nil {
+						rows = -1
+					}
+					// Named by the Object element inside the operator
+					plan.Scans = append(plan.Scans, TableScan{Rows: int64(rows)})
+				}
+			case "Object":
+				// The table an operator reads, such as Table="[orders]"
+				if len(operators) == 0 || !operators[len(operators)-1] || attrs["Table"] == "" {
+					break
+				}
+				name := strings.Trim(attrs["Table"], "[]")
+				if alias := strings.Trim(attrs["Alias"], "[]"); alias != "" {
+					if table, ok := aliases[strings.ToLower(alias)]; ok {
+						name = table
+					}
+				} else if schema := strings.Trim(attrs["Schema"], "[]"); schema != "" {
+					name = schema + "." + name
+				}
+				lines[len(lines)-1] += " on " + name
+				if scan := &plan.Scans[len(plan.Scans)-1]; scan.Table == "" {
+					scan.Table = name
+				}
+			}
+		case xml.EndElement:
+			if element.Name.Local == "RelOp" && len(operators) > 0 {
+				operators = operators[:len(operators)-1]
+			}
+		}
+	}
+	// Scans of work tables and the like name no table
+	scans := plan.Scans[:0]
+	for _, scan := range plan.Scans {
+		if scan.Table != "" {
+			scans = append(scans, scan)
+		}
+	}
+	plan.Scans = scans
+	plan.Text = strings.Join(lines, "\n")
+	return plan, nil
+}
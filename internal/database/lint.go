@@ -0,0 +1,432 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"data-chatter/internal/sqlparse"
+)
+
+// fromEnders are the keywords that end a FROM clause, besides those that may
+// follow a single-table FROM.
+var fromEnders = map[string]bool{
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "MINUS": true, "PREWHERE": true,
+	"SETTINGS": true, "FORMAT": true,
+}
+
+// joinModifiers may come before JOIN, as part of the join.
+var joinModifiers = map[string]bool{
+	"INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "OUTER": true, "CROSS": true,
+	"NATURAL": true, "ANY": true, "ALL": true, "ASOF": true, "SEMI": true, "ANTI": true,
+	"ARRAY": true, "GLOBAL": true,
+}
+
+// Lint is what Connection.Lint made of a query.
+type Lint struct {
+	Query    string   // The query to run, with any rewrites applied
+	Rewrites []string // What was changed, and why
+	Warnings []string
+	Limit    int // The row limit added, or 0
+}
+
+// Lint checks a validated tool query before it runs. With Config.AutoLimit
+// set, a query that may return many rows but has no LIMIT, TOP, or FETCH is
+// given one, so a forgotten LIMIT returns the first rows rather than failing
+// with too_many_rows; queries returning one aggregate row are left alone.
+// With Config.Lint set, it warns about SELECT * from a table with at least
+// WideTableColumns columns, and about tables joined without a condition
+// relating them, whose rows multiply. Rewrites and warnings are meant for
+// the result, so users can see why its rows are capped.
+func (c *Connection) Lint(ctx context.Context, query string) Lint {
+	lint := Lint{Query: query}
+	if n := c.Config.AutoLimit; n > 0 {
+		if limited, clause := c.autoLimit(query, n); clause != "" {
+			lint.Query, lint.Limit = limited, n
+			lint.Rewrites = append(lint.Rewrites, fmt.Sprintf("added %s since the query had no limit, so at most %d rows are returned", clause, n))
+		}
+	}
+	if c.Config.Lint {
+		lint.Warnings = append(lint.Warnings, c.wideStars(ctx, query)...)
+		lint.Warnings = append(lint.Warnings, cartesianJoins(query)...)
+	}
+	if len(lint.Rewrites) > 0 || len(lint.Warnings) > 0 {
+		slog.DebugContext(ctx, "linted query", "query", lint.Query, "rewrites", lint.Rewrites, "warnings", lint.Warnings)
+	}
+	return lint
+}
+
+// autoLimit returns query limited to n rows, with the clause it added, or
+// query and "" when it already has a limit, reads no table, returns one
+// aggregate row, or cannot be limited as a whole, such as a compound query
+// on SQL Server.
+func (c *Connection) autoLimit(query string, n int) (string, string) {
+	body := strings.TrimRightFunc(query, func(r rune) bool { return unicode.IsSpace(r) || r == ';' })
+	s := scanStatement(body)
+	if s == nil || s.limited || (s.aggregate && s.groupBy < 0 && !s.compound) || !s.readsTable() {
+		return query, ""
+	}
+
+	if c.Config.Type == "sqlserver" {
+		if s.compound || s.offset {
+			return query, "" // TOP would limit only the first SELECT, or clash with OFFSET
+		}
+		clause := "TOP " + strconv.Itoa(n)
+		return body[:s.topAt] + " " + clause + body[s.topAt:] + query[len(body):], clause
+	}
+
+	clause := "LIMIT " + strconv.Itoa(n)
+	head := strings.TrimRightFunc(body[:s.insertAt], unicode.IsSpace)
+	tail := strings.TrimLeftFunc(body[s.insertAt:], unicode.IsSpace)
+	if tail != "" {
+		tail = " " + tail
+	}
+	return head + " " + clause + tail + query[len(body):], clause
+}
+
+// readsTable reports whether the statement has a FROM outside parentheses.
+func (s *statement) readsTable() bool {
+	for k := range s.top {
+		if s.keywordAt(k, "FROM") {
+			return true
+		}
+	}
+	return false
+}
+
+// wideStars warns about each table with at least WideTableColumns columns
+// that a query reading * also reads.
+func (c *Connection) wideStars(ctx context.Context, query string) []string {
+	if c.Config.WideTableColumns <= 0 || !sqlparse.HasSelectStar(query) {
+		return nil
+	}
+	schema, err := c.Schema(ctx)
+	if err != nil {
+		return nil
+	}
+	var warnings []string
+	for _, table := range sqlparse.ReferencedTables(query) {
+		bare := table[strings.LastIndex(table, ".")+1:]
+		for name, columns := range schema.Columns {
+			if !strings.EqualFold(name, table) && !strings.EqualFold(name, bare) {
+				continue
+			}
+			if len(columns) >= c.Config.WideTableColumns {
+				warnings = append(warnings, fmt.Sprintf("SELECT * reads all %d columns of %s; select only the columns needed", len(columns), table))
+			}
+			break
+		}
+	}
+	return warnings
+}
+
+// cartesianJoins warns about joins that pair every row of one table with
+// every row of another: a JOIN without ON or USING, and tables listed in a
+// FROM with commas that no WHERE comparison relates. CROSS JOIN, which says
+// so, is not flagged, nor are lateral and table-function items, which are
+// correlated with the tables before them, nor subqueries returning one
+// aggregate row.
+func cartesianJoins(sql string) []string {
+	tokens := sqlparse.Tokenize(sql)
+	var warnings []string
+	depth := 0
+	for i, tok := range tokens {
+		switch {
+		case tok.Kind == sqlparse.Symbol && tok.Value == "(":
+			depth++
+		case tok.Kind == sqlparse.Symbol && tok.Value == ")":
+			depth--
+		case tok.IsKeyword("FROM"):
+			warnings = append(warnings, lintFrom(sql, tokens, i+1, depth)...)
+		}
+	}
+	return warnings
+}
+
+// fromItem is one comma-separated item of a FROM list: a table or subquery
+// with the tables joined to it.
+type fromItem struct {
+	names   []string // Its tables' aliases or names, as written
+	single  bool     // A subquery returning one aggregate row
+	lateral bool     // Lateral, or a table function, correlated with earlier items
+}
+
+// lintFrom checks the FROM clause starting at token start, at depth, and the
+// WHERE clause following it.
+func lintFrom(sql string, tokens []sqlparse.Token, start, depth int) []string {
+	var warnings []string
+	items := []fromItem{{}}
+	d := depth
+	i := start
+	joinAt := -1 // Index of the JOIN being read, or -1
+	conditioned := false
+	endJoin := func() {
+		if joinAt >= 0 && !conditioned {
+			name := "a table"
+			if n := len(items[len(items)-1].names); n > 0 {
+				name = items[len(items)-1].names[n-1]
+			}
+			warnings = append(warnings, fmt.Sprintf("JOIN %s has no ON or USING condition, so every row is paired with every row of the tables before it; add the condition, or say CROSS JOIN if that is intended", name))
+		}
+		joinAt = -1
+	}
+	expectItem := true // At the start of a table reference
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.Kind == sqlparse.Symbol && tok.Value == "(" {
+			if d == depth && expectItem {
+				item := &items[len(items)-1]
+				end := closingParen(tokens, i)
+				if i+1 < len(tokens) && tokens[i+1].IsKeyword("SELECT") && len(item.names) == 0 {
+					sub := scanStatement(sql[tokens[i+1].Pos:tokens[min(end, len(tokens)-1)].Pos])
+					item.single = sub != nil && sub.aggregate && sub.groupBy < 0 && !sub.compound
+				}
+				if alias := aliasAfter(tokens, end+1); alias != "" {
+					item.names = append(item.names, alias)
+				}
+				expectItem = false
+			}
+			d++
+			continue
+		}
+		if tok.Kind == sqlparse.Symbol && tok.Value == ")" {
+			if d == depth {
+				break // The end of the enclosing subquery
+			}
+			d--
+			continue
+		}
+		if d > depth {
+			continue
+		}
+
+		upper := strings.ToUpper(tok.Value)
+		switch {
+		case tok.Kind == sqlparse.Symbol && tok.Value == ";":
+		case tok.Kind == sqlparse.Word && (fromFollowers[upper] || fromEnders[upper]):
+		case tok.Kind == sqlparse.Symbol && tok.Value == ",":
+			endJoin()
+			items = append(items, fromItem{})
+			expectItem = true
+			continue
+		case tok.IsKeyword("JOIN"):
+			endJoin()
+			prev := ""
+			if i > 0 {
+				prev = strings.ToUpper(tokens[i-1].Value)
+			}
+			if prev != "CROSS" && prev != "ARRAY" && prev != "NATURAL" {
+				joinAt, conditioned = i, false
+			}
+			expectItem = true
+			continue
+		case tok.IsKeyword("ON") || tok.IsKeyword("USING"):
+			conditioned = true
+			expectItem = false
+			continue
+		case tok.Kind == sqlparse.Word && joinModifiers[upper]:
+			continue
+		case tok.IsKeyword("LATERAL") || tok.IsKeyword("UNNEST"):
+			items[len(items)-1].lateral = true
+			continue
+		default:
+			if expectItem && tok.IsIdentifier() {
+				item := &items[len(items)-1]
+				name := tok.Value
+				j := i + 1
+				for j+1 < len(tokens) && tokens[j].Value == "." && tokens[j+1].IsIdentifier() {
+					name = tokens[j+1].Value
+					j += 2
+				}
+				if j < len(tokens) && tokens[j].Value == "(" {
+					item.lateral = true // A table function
+				}
+				if alias := aliasAfter(tokens, j); alias != "" {
+					name = alias
+				}
+				item.names = append(item.names, name)
+				expectItem = false
+			}
+			continue
+		}
+		break
+	}
+	endJoin()
+
+	if len(items) < 2 {
+		return warnings
+	}
+	var where []sqlparse.Token
+	if i < len(tokens) && tokens[i].IsKeyword("WHERE") {
+		where = clauseTokens(tokens, i+1)
+	}
+	return append(warnings, unrelatedItems(items, where)...)
+}
+
+// unrelatedItems warns about FROM items that no comparison in where relates
+// to the first item, directly or through others. Comparisons whose columns
+// are not qualified cannot be placed, so any such comparison between two
+// columns silences the warning.
+func unrelatedItems(items []fromItem, where []sqlparse.Token) []string {
+	group := make([]int, len(items))
+	owner := make(map[string]int)
+	for i, item := range items {
+		group[i] = i
+		for _, name := range item.names {
+			owner[strings.ToLower(name)] = i
+		}
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if group[i] != i {
+			group[i] = find(group[i])
+		}
+		return group[i]
+	}
+	for i, item := range items {
+		if item.single || item.lateral {
+			group[find(i)] = find(0) // Adds no rows
+		}
+	}
+
+	for i := 0; i < len(where); i++ {
+		left, next := columnAt(where, i)
+		if next == i {
+			continue
+		}
+		j := next
+		for j < len(where) && where[j].Kind == sqlparse.Symbol && strings.Contains("=<>!", where[j].Value) {
+			j++
+		}
+		if j == next {
+			i = next - 1
+			continue
+		}
+		right, after := columnAt(where, j)
+		if after == j {
+			i = j - 1
+			continue
+		}
+		if left == "" || right == "" {
+			return nil // An unqualified column, which may belong to any table
+		}
+		a, aok := owner[left]
+		b, bok := owner[right]
+		if aok && bok {
+			group[find(a)] = find(b)
+		}
+		i = after - 1
+	}
+
+	var warnings []string
+	first := "the first table"
+	if len(items[0].names) > 0 {
+		first = items[0].names[0]
+	}
+	for i, item := range items[1:] {
+		if find(i+1) == find(0) {
+			continue
+		}
+		name := "a subquery"
+		if len(item.names) > 0 {
+			name = item.names[0]
+		}
+		warnings = append(warnings, fmt.Sprintf("no condition relates %s to %s, so every row of one is paired with every row of the other; compare their matching columns in WHERE, or use JOIN ... ON", name, first))
+	}
+	return warnings
+}
+
+// columnAt reads a column reference at token i and returns its qualifier,
+// lower-cased, or "" when it has none, with the index of the following
+// token; that index is i when there is no column there.
+func columnAt(tokens []sqlparse.Token, i int) (string, int) {
+	if i >= len(tokens) || !tokens[i].IsIdentifier() {
+		return "", i
+	}
+	if i+2 < len(tokens) && tokens[i+1].Value == "." && tokens[i+2].IsIdentifier() {
+		qualifier := tokens[i].Value
+		j := i + 2
+		for j+2 < len(tokens) && tokens[j+1].Value == "." && tokens[j+2].IsIdentifier() {
+			qualifier = tokens[j].Value // schema.table.column
+			j += 2
+		}
+		if j+1 < len(tokens) && tokens[j+1].Value == "(" {
+			return "", i // A qualified function call
+		}
+		return strings.ToLower(qualifier), j + 1
+	}
+	if i+1 < len(tokens) && tokens[i+1].Value == "(" {
+		return "", i // A function call
+	}
+	if tokens[i].Kind == sqlparse.Word && nonColumnWords[strings.ToUpper(tokens[i].Value)] {
+		return "", i
+	}
+	return "", i + 1
+}
+
+// nonColumnWords are keywords that are not column names in a WHERE
+// comparison.
+var nonColumnWords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "NULL": true, "TRUE": true, "FALSE": true,
+	"IS": true, "IN": true, "LIKE": true, "BETWEEN": true, "CASE": true, "WHEN": true,
+	"THEN": true, "ELSE": true, "END": true, "EXISTS": true, "CURRENT_DATE": true,
+	"CURRENT_TIMESTAMP": true, "CURRENT_TIME": true, "SELECT": true,
+}
+
+// clauseTokens returns the tokens of the clause starting at token start, up
+// to the next clause at its depth or the parenthesis closing it.
+func clauseTokens(tokens []sqlparse.Token, start int) []sqlparse.Token {
+	d := 0
+	i := start
+	for ; i < len(tokens); i++ {
+		tok := tokens[i]
+		switch {
+		case tok.Value == "(" && tok.Kind == sqlparse.Symbol:
+			d++
+		case tok.Value == ")" && tok.Kind == sqlparse.Symbol:
+			if d == 0 {
+				return tokens[start:i]
+			}
+			d--
+		case d == 0 && tok.Kind == sqlparse.Word && (fromFollowers[strings.ToUpper(tok.Value)] || fromEnders[strings.ToUpper(tok.Value)]):
+			return tokens[start:i]
+		}
+	}
+	return tokens[start:i]
+}
+
+// closingParen returns the index of the token closing the parenthesis at
+// open, or len(tokens) when it is not closed.
+func closingParen(tokens []sqlparse.Token, open int) int {
+	depth := 0
+	for i := open; i < len(tokens); i++ {
+		switch tokens[i].Value {
+		case "(":
+			depth++
+		case ")":
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(tokens)
+}
+
+// aliasAfter returns the alias given at token i, with or without AS, or "".
+func aliasAfter(tokens []sqlparse.Token, i int) string {
+	if i < len(tokens) && tokens[i].IsKeyword("AS") {
+		i++
+	}
+	if i >= len(tokens) || !tokens[i].IsIdentifier() {
+		return ""
+	}
+	upper := strings.ToUpper(tokens[i].Value)
+	if tokens[i].Kind == sqlparse.Word && (fromFollowers[upper] || fromEnders[upper] || joinModifiers[upper] ||
+		upper == "JOIN" || upper == "ON" || upper == "USING" || upper == "LATERAL") {
+		return ""
+	}
+	return tokens[i].Value
+}
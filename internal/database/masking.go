@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Masker hides personal data in query results. Values in columns whose
+// names match one of its patterns are masked to their shape, as schema
+// samples are, for every caller who may not unmask them.
+type Masker struct {
+	patterns  []string
+	mayUnmask func(ctx context.Context) bool
+}
+
+// NewMasker creates a masker for the columns matching patterns, globs such
+// as "*_ssn" or "phone_number" matched case-insensitively against column
+// names. mayUnmask reports whether the caller in ctx sees values as they
+// are; when it is nil, nobody does.
+func NewMasker(patterns []string, mayUnmask func(ctx context.Context) bool) (*Masker, error) {
+	m := &Masker{mayUnmask: mayUnmask}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid mask pattern %q: %w", pattern, err)
+		}
+		m.patterns = append(m.patterns, pattern)
+	}
+	return m, nil
+}
+
+// unmaskedKey marks a context whose queries see masked values as they are.
+type unmaskedKey struct{}
+
+// WithUnmasked returns a copy of ctx whose queries see masked values as
+// they are, for a re-query an admin approved.
+func WithUnmasked(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unmaskedKey{}, true)
+}
+
+// MaskerFromEnv creates a masker for the comma-separated patterns in
+// PII_MASK_COLUMNS. An unset variable masks nothing.
+func MaskerFromEnv(mayUnmask func(ctx context.Context) bool) (*Masker, error) {
+	masker, err := NewMasker(strings.Split(os.Getenv("PII_MASK_COLUMNS"), ","), mayUnmask)
+	if err != nil {
+		return nil, fmt.Errorf("invalid PII_MASK_COLUMNS: %w", err)
+	}
+	return masker, nil
+}
+
+// Applies reports whether the caller in ctx sees masked values.
+func (m *Masker) Applies(ctx context.Context) bool {
+	if m == nil || len(m.patterns) == 0 {
+		return false
+	}
+	if unmasked, _ := ctx.Value(unmaskedKey{}).(bool); unmasked {
+		return false
+	}
+	return m.mayUnmask == nil || !m.mayUnmask(ctx)
+}
+
+// Masks reports whether column's name matches a pattern.
+func (m *Masker) Masks(column string) bool {
+	if m == nil {
+		return false
+	}
+	column = strings.ToLower(column)
+	for _, pattern := range m.patterns {
+		if matched, _ := path.Match(pattern, column); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// MaskValue reduces a scanned value to its shape, replacing letters with x
+// and digits with 9, so "555-0142" becomes "999-9999". NULL stays NULL.
+func MaskValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return maskValue(string(v))
+	case time.Time:
+		return maskValue(v.Format(time.RFC3339))
+	default:
+		return maskValue(fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,442 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"data-chatter/internal/sqlparse"
+)
+
+// orderFollowers are the clauses an ORDER BY goes before.
+var orderFollowers = map[string]bool{"LIMIT": true, "OFFSET": true, "FETCH": true, "FOR": true}
+
+// fromFollowers are the clauses that may follow a single-table FROM.
+var fromFollowers = map[string]bool{
+	"WHERE": true, "GROUP": true, "HAVING": true, "WINDOW": true, "QUALIFY": true,
+	"ORDER": true, "LIMIT": true, "OFFSET": true, "FETCH": true, "FOR": true,
+}
+
+// aggregateFunctions return one row per group unless followed by OVER.
+var aggregateFunctions = map[string]bool{
+	"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true,
+	"STRING_AGG": true, "GROUP_CONCAT": true, "ARRAY_AGG": true, "LISTAGG": true,
+	"STDDEV": true, "VARIANCE": true, "MEDIAN": true, "BOOL_AND": true, "BOOL_OR": true,
+}
+
+// StableOrder returns query with an ORDER BY that makes the order of its
+// rows the same on every run, when Config.StableOrder is set, so paginated
+// and snapshot-compared results are stable. A query without an ORDER BY is
+// ordered by its GROUP BY keys when it groups, by the primary key of its
+// one table when it reads a single table with one, and by every selected
+// column otherwise, as ORDER BY 1, 2, .... An existing ORDER BY gets the
+// primary key or GROUP BY keys it lacks as tie-breakers. Queries returning
+// one aggregate row, and those whose columns cannot be counted, such as a
+// SELECT * over a join, are left as they are.
+func (c *Connection) StableOrder(ctx context.Context, query string) string {
+	if !c.Config.StableOrder {
+		return query
+	}
+	ordered := c.stableOrder(ctx, query)
+	if ordered != query {
+		slog.DebugContext(ctx, "ordered query for stable results", "query", ordered)
+	}
+	return ordered
+}
+
+// stableOrder adds the ORDER BY or tie-breakers StableOrder describes.
+func (c *Connection) stableOrder(ctx context.Context, query string) string {
+	body := strings.TrimRightFunc(query, func(r rune) bool { return unicode.IsSpace(r) || r == ';' })
+	s := scanStatement(body)
+	if s == nil || s.distinctOn {
+		return query
+	}
+
+	var keys []string
+	if s.orderBy < 0 {
+		switch {
+		case s.aggregate && s.groupBy < 0 && !s.compound:
+			return query // One row
+		case s.groupBy >= 0 && !s.compound:
+			keys = s.groupKeys()
+		default:
+			keys = c.primaryKeyOrder(ctx, s)
+		}
+		if keys == nil && !s.star && s.columns > 0 {
+			for i := range s.columns {
+				keys = append(keys, strconv.Itoa(i+1))
+			}
+		}
+	} else if !s.compound {
+		// Tie-breakers the ORDER BY does not already sort on
+		candidates := s.groupKeys()
+		if s.groupBy < 0 {
+			candidates = c.primaryKeyOrder(ctx, s)
+		}
+		ordered := s.orderKeys()
+		for _, key := range candidates {
+			if !ordered[normalizeKey(key)] {
+				keys = append(keys, key)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return query
+	}
+
+	clause := " ORDER BY "
+	if s.orderBy >= 0 {
+		clause = ", "
+	}
+	head := strings.TrimRightFunc(body[:s.insertAt], unicode.IsSpace)
+	tail := strings.TrimLeftFunc(body[s.insertAt:], unicode.IsSpace)
+	if tail != "" {
+		tail = " " + tail
+	}
+	return head + clause + strings.Join(keys, ", ") + tail + query[len(body):]
+}
+
+// primaryKeyOrder returns the primary key columns of a query's one table,
+// qualified by the table's alias or name, or nil when the query reads more
+// than one table or its rows are not the table's. ClickHouse's primary key
+// is a sorting key that does not identify rows, so it is not used.
+func (c *Connection) primaryKeyOrder(ctx context.Context, s *statement) []string {
+	if s.table == "" || s.compound || s.distinct || s.aggregate || s.groupBy >= 0 || c.Config.Type == "clickhouse" {
+		return nil
+	}
+	schema, err := c.Schema(ctx)
+	if err != nil {
+		return nil
+	}
+	bare := s.table[strings.LastIndex(s.table, ".")+1:]
+	var columns []ColumnInfo
+	for table, tableColumns := range schema.Columns {
+		if strings.EqualFold(table, s.table) || strings.EqualFold(table, bare) {
+			columns = tableColumns
+			break
+		}
+	}
+
+	var keys []string
+	for _, column := range columns {
+		if column.PrimaryKey {
+			keys = append(keys, s.qualifier+"."+c.Config.QuoteIdentifier(column.Name))
+		}
+	}
+	return keys
+}
+
+// statement is what stableOrder and autoLimit need to know of a SELECT.
+type statement struct {
+	sql    string
+	tokens []sqlparse.Token
+	top    []int // Indexes of the tokens outside parentheses, from the main SELECT
+
+	compound   bool // Has UNION, INTERSECT, or EXCEPT
+	distinct   bool
+	distinctOn bool // Uses DISTINCT ON, whose select list is not scanned
+	aggregate  bool // Selects an aggregate without OVER
+	star       bool // Selects * or t.*
+	columns    int  // Number of selected columns of the first SELECT
+
+	table     string // The one table read, with any schema, unquoted
+	qualifier string // Its alias or name as written
+
+	groupBy  int // Position in top of GROUP, or -1
+	orderBy  int // Position in top of the final ORDER, or -1
+	insertAt int // Byte offset the ORDER BY or its tie-breakers go at
+
+	limited bool // Has a final LIMIT or FETCH, or a TOP
+	offset  bool // Has a final OFFSET
+	topAt   int  // Byte offset a TOP goes at, after SELECT and any DISTINCT
+}
+
+// scanStatement reads sql's clauses, or returns nil when it is not a
+// SELECT. The select list of a DISTINCT ON query is not read.
+func scanStatement(sql string) *statement {
+	s := &statement{sql: sql, tokens: sqlparse.Tokenize(sql), groupBy: -1, orderBy: -1}
+	if len(s.tokens) == 0 {
+		return nil
+	}
+	s.insertAt = s.tokenEnd(len(s.tokens) - 1) // Before any trailing comment
+	depth := 0
+	for i, tok := range s.tokens {
+		switch {
+		case tok.Kind == sqlparse.Symbol && tok.Value == "(":
+			depth++
+		case tok.Kind == sqlparse.Symbol && tok.Value == ")":
+			depth--
+		case depth == 0 && (len(s.top) > 0 || tok.IsKeyword("SELECT")):
+			s.top = append(s.top, i)
+		}
+	}
+	if len(s.top) == 0 {
+		return nil
+	}
+
+	// The clauses after the last set operation apply to the whole result
+	tail := 0
+	for k, i := range s.top {
+		tok := s.tokens[i]
+		if tok.IsKeyword("UNION") || tok.IsKeyword("INTERSECT") || tok.IsKeyword("EXCEPT") || tok.IsKeyword("MINUS") {
+			s.compound = true
+			tail = k + 1
+		}
+	}
+	for k := tail; k < len(s.top); k++ {
+		tok := s.tokens[s.top[k]]
+		switch {
+		case tok.IsKeyword("ORDER") && s.keywordAt(k+1, "BY"):
+			s.orderBy = k
+		case tok.Kind == sqlparse.Word && orderFollowers[strings.ToUpper(tok.Value)]:
+			s.insertAt = tok.Pos
+			k = len(s.top)
+		}
+	}
+	for k := tail; k < len(s.top); k++ {
+		tok := s.tokens[s.top[k]]
+		s.limited = s.limited || tok.IsKeyword("LIMIT") || tok.IsKeyword("FETCH")
+		s.offset = s.offset || tok.IsKeyword("OFFSET")
+	}
+
+	// The first SELECT's list, up to its FROM
+	k := 1
+	if s.keywordAt(k, "DISTINCT") {
+		if s.keywordAt(k+1, "ON") {
+			s.distinctOn = true
+			return s
+		}
+		s.distinct = true
+		k++
+	} else if s.keywordAt(k, "ALL") {
+		k++
+	}
+	s.topAt = s.tokenEnd(s.top[k-1])
+	if s.keywordAt(k, "TOP") {
+		s.limited = true
+		if s.tokens[s.top[k]+1].Value == "(" {
+			k++ // TOP (n), whose parentheses hide n
+		} else {
+			k += 2
+		}
+		for s.keywordAt(k, "PERCENT") || s.keywordAt(k, "WITH") || s.keywordAt(k, "TIES") {
+			k++
+		}
+	}
+	listStart := k
+	for ; k < len(s.top); k++ {
+		tok := s.tokens[s.top[k]]
+		if tok.IsKeyword("FROM") || tok.IsKeyword("UNION") || tok.IsKeyword("INTERSECT") || tok.IsKeyword("EXCEPT") ||
+			tok.IsKeyword("MINUS") || s.clauseAt(k) {
+			break
+		}
+	}
+	s.scanSelectList(listStart, k)
+	if s.keywordAt(k, "FROM") && !s.compound {
+		s.scanFrom(k + 1)
+	}
+
+	for k := range s.top {
+		if s.keywordAt(k, "GROUP") && s.keywordAt(k+1, "BY") && !s.compound {
+			s.groupBy = k
+		}
+	}
+	return s
+}
+
+// keywordAt reports whether the kth top-level token is the keyword kw.
+func (s *statement) keywordAt(k int, kw string) bool {
+	return k >= 0 && k < len(s.top) && s.tokens[s.top[k]].IsKeyword(kw)
+}
+
+// clauseAt reports whether the kth top-level token starts a clause that
+// may follow FROM.
+func (s *statement) clauseAt(k int) bool {
+	tok := s.tokens[s.top[k]]
+	return tok.Kind == sqlparse.Word && fromFollowers[strings.ToUpper(tok.Value)]
+}
+
+// scanSelectList counts the columns of the select list between top
+// positions start and end, and notes stars and aggregates.
+func (s *statement) scanSelectList(start, end int) {
+	if start >= end {
+		return
+	}
+	s.columns = 1
+	for k := start; k < end; k++ {
+		i := s.top[k]
+		tok := s.tokens[i]
+		switch {
+		case tok.Kind == sqlparse.Symbol && tok.Value == ",":
+			s.columns++
+		case tok.Kind == sqlparse.Symbol && tok.Value == "*":
+			s.star = true
+		case tok.Kind == sqlparse.Word && aggregateFunctions[strings.ToUpper(tok.Value)] &&
+			i+1 < len(s.tokens) && s.tokens[i+1].Value == "(":
+			// An aggregate unless its call is followed by OVER
+			after := s.closing(i+1) + 1
+			if after >= len(s.tokens) || !s.tokens[after].IsKeyword("OVER") {
+				s.aggregate = true
+			}
+		}
+	}
+}
+
+// closing returns the index of the token closing the parenthesis at open.
+func (s *statement) closing(open int) int {
+	depth := 0
+	for i := open; i < len(s.tokens); i++ {
+		switch s.tokens[i].Value {
+		case "(":
+			depth++
+		case ")":
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(s.tokens)
+}
+
+// scanFrom reads a FROM list starting at top position k, keeping the table
+// when it is the only one.
+func (s *statement) scanFrom(k int) {
+	if k >= len(s.top) || !s.tokens[s.top[k]].IsIdentifier() || s.tokens[s.top[k-1]+1].Value == "(" {
+		return // A subquery
+	}
+	start := k
+	name := s.tokens[s.top[k]].Value
+	for k+2 < len(s.top) && s.tokens[s.top[k+1]].Value == "." && s.tokens[s.top[k+2]].IsIdentifier() {
+		name += "." + s.tokens[s.top[k+2]].Value
+		k += 2
+	}
+	if i := s.top[k] + 1; i < len(s.tokens) && s.tokens[i].Value == "(" {
+		return // A table function
+	}
+	k++
+	qualifier := s.span(start, k)
+	if s.keywordAt(k, "AS") {
+		k++
+	}
+	if k < len(s.top) && s.tokens[s.top[k]].IsIdentifier() && !s.clauseAt(k) {
+		qualifier = s.span(k, k+1)
+		k++
+	}
+	if k < len(s.top) && !s.clauseAt(k) {
+		return // Another table, a join, or a dialect's table clause
+	}
+	s.table, s.qualifier = name, qualifier
+}
+
+// span returns the text of top positions start up to end, as written,
+// without comments around it.
+func (s *statement) span(start, end int) string {
+	last := len(s.tokens) - 1
+	if end < len(s.top) {
+		last = s.top[end] - 1
+	}
+	return s.sql[s.tokens[s.top[start]].Pos:s.tokenEnd(last)]
+}
+
+// tokenEnd returns the byte offset just past the ith token.
+func (s *statement) tokenEnd(i int) int {
+	tok := s.tokens[i]
+	if tok.Kind != sqlparse.Quoted {
+		return tok.Pos + len(tok.Value)
+	}
+	// The value of a quoted identifier has lost its quotes and escapes
+	opener := s.sql[tok.Pos]
+	closer := opener
+	if opener == '[' {
+		closer = ']'
+	}
+	for j := tok.Pos + 1; j < len(s.sql); j++ {
+		if s.sql[j] != closer {
+			continue
+		}
+		if closer != ']' && j+1 < len(s.sql) && s.sql[j+1] == closer {
+			j++
+			continue
+		}
+		return j + 1
+	}
+	return len(s.sql)
+}
+
+// items splits the clause starting at top position start, up to the first
+// of the keywords in enders, at its commas.
+func (s *statement) items(start int, enders func(sqlparse.Token) bool) []string {
+	var items []string
+	from := start
+	k := start
+	for ; k < len(s.top); k++ {
+		tok := s.tokens[s.top[k]]
+		if enders(tok) {
+			break
+		}
+		if tok.Kind == sqlparse.Symbol && tok.Value == "," {
+			items = append(items, s.span(from, k))
+			from = k + 1
+		}
+	}
+	if from < k {
+		items = append(items, s.span(from, k))
+	}
+	return items
+}
+
+// groupKeys returns the GROUP BY expressions, or nil when there is none or
+// it uses ROLLUP, CUBE, GROUPING SETS, or ALL, whose keys are not simple.
+func (s *statement) groupKeys() []string {
+	if s.groupBy < 0 {
+		return nil
+	}
+	keys := s.items(s.groupBy+2, func(tok sqlparse.Token) bool {
+		upper := strings.ToUpper(tok.Value)
+		return tok.Kind == sqlparse.Word && (fromFollowers[upper] || upper == "UNION" || upper == "INTERSECT" || upper == "EXCEPT")
+	})
+	for _, key := range keys {
+		first := sqlparse.Tokenize(key)[0]
+		if first.IsKeyword("ROLLUP") || first.IsKeyword("CUBE") || first.IsKeyword("GROUPING") || first.IsKeyword("ALL") {
+			return nil
+		}
+	}
+	return keys
+}
+
+// orderKeys returns the normalized expressions the ORDER BY sorts on.
+func (s *statement) orderKeys() map[string]bool {
+	keys := make(map[string]bool)
+	items := s.items(s.orderBy+2, func(tok sqlparse.Token) bool {
+		return tok.Kind == sqlparse.Word && orderFollowers[strings.ToUpper(tok.Value)]
+	})
+	for _, item := range items {
+		fields := strings.Fields(item)
+		for len(fields) > 1 {
+			last := strings.ToUpper(fields[len(fields)-1])
+			if last != "ASC" && last != "DESC" && last != "NULLS" && last != "FIRST" && last != "LAST" {
+				break
+			}
+			fields = fields[:len(fields)-1]
+		}
+		keys[normalizeKey(strings.Join(fields, " "))] = true
+	}
+	return keys
+}
+
+// normalizeKey lowercases an ORDER BY or GROUP BY expression and drops its
+// quotes, spacing, and any column qualifier, so the same column written two
+// ways compares equal.
+func normalizeKey(key string) string {
+	tokens := sqlparse.Tokenize(key)
+	if len(tokens) == 3 && tokens[0].IsIdentifier() && tokens[1].Value == "." && tokens[2].IsIdentifier() {
+		tokens = tokens[2:]
+	}
+	var b strings.Builder
+	for _, tok := range tokens {
+		b.WriteString(strings.ToLower(tok.Value))
+	}
+	return b.String()
+}
@@ -0,0 +1,810 @@
+package database
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ColumnInfo describes a single table column.
+type ColumnInfo struct {
+	Name       string `json:"name"`
+	DataType   string `json:"data_type"`
+	Nullable   bool   `json:"nullable"`
+	PrimaryKey bool   `json:"primary_key"`
+}
+
+// QuoteIdentifier quotes a table or column name for the configured dialect.
+func (c *Config) QuoteIdentifier(name string) string {
+	if c.Type == "mysql" {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	if c.Type == "sqlserver" {
+		return "[" + strings.ReplaceAll(name, "]", "]]") + "]"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// Placeholder returns the dialect's bind parameter for the nth argument, counting from 1.
+func (c *Config) Placeholder(n int) string {
+	if c.Type == "postgres" {
+		return fmt.Sprintf("$%d", n)
+	}
+	if c.Type == "sqlserver" {
+		return fmt.Sprintf("@p%d", n)
+	}
+	return "?"
+}
+
+// Limit caps query, a SELECT, at n rows: with TOP after its leading SELECT
+// on SQL Server, which has no LIMIT clause, and with LIMIT elsewhere.
+func (c *Config) Limit(query string, n int) string {
+	if c.Type == "sqlserver" {
+		trimmed := strings.TrimLeftFunc(query, unicode.IsSpace)
+		if len(trimmed) >= len("SELECT") && strings.EqualFold(trimmed[:len("SELECT")], "SELECT") {
+			return fmt.Sprintf("SELECT TOP %d%s", n, trimmed[len("SELECT"):])
+		}
+	}
+	return fmt.Sprintf("%s LIMIT %d", query, n)
+}
+
+// TimeGrains are the grains TruncateTime accepts.
+var TimeGrains = []string{"day", "week", "month", "quarter", "year"}
+
+// TruncateTime returns SQL truncating the date or timestamp expression expr
+// to the start of its day, week (from Monday), month, quarter, or year, as
+// a date on SQLite, MySQL, and ClickHouse and a timestamp on PostgreSQL and
+// DuckDB.
+func (c *Config) TruncateTime(expr, grain string) (string, error) {
+	switch c.Type {
+	case "sqlite":
+		switch grain {
+		case "day":
+			return fmt.Sprintf("date(%s)", expr), nil
+		case "week":
+			return fmt.Sprintf("date(%s, 'weekday 0', '-6 days')", expr), nil
+		case "month":
+			return fmt.Sprintf("date(%s, 'start of month')", expr), nil
+		case "quarter":
+			return fmt.Sprintf("date(%s, 'start of month', '-' || ((CAST(strftime('%%m', %s) AS INTEGER) - 1) %% 3) || ' months')", expr, expr), nil
+		case "year":
+			return fmt.Sprintf("date(%s, 'start of year')", expr), nil
+		}
+	case "mysql":
+		switch grain {
+		case "day":
+			return fmt.Sprintf("DATE(%s)", expr), nil
+		case "week":
+			return fmt.Sprintf("DATE_SUB(DATE(%s), INTERVAL WEEKDAY(%s) DAY)", expr, expr), nil
+		case "month":
+			return fmt.Sprintf("DATE(DATE_FORMAT(%s, '%%Y-%%m-01'))", expr), nil
+		case "quarter":
+			return fmt.Sprintf("MAKEDATE(YEAR(%s), 1) + INTERVAL (QUARTER(%s) - 1) QUARTER", expr, expr), nil
+		case "year":
+			return fmt.Sprintf("MAKEDATE(YEAR(%s), 1)", expr), nil
+		}
+	case "sqlserver":
+		switch grain {
+		case "day":
+			return fmt.Sprintf("CAST(%s AS date)", expr), nil
+		case "week":
+			// Monday whatever the session's DATEFIRST
+			return fmt.Sprintf("DATEADD(day, -((DATEPART(weekday, %s) + @@DATEFIRST - 2) %% 7), CAST(%s AS date))", expr, expr), nil
+		case "month":
+			return fmt.Sprintf("DATEFROMPARTS(YEAR(%s), MONTH(%s), 1)", expr, expr), nil
+		case "quarter":
+			return fmt.Sprintf("DATEFROMPARTS(YEAR(%s), (DATEPART(quarter, %s) - 1) * 3 + 1, 1)", expr, expr), nil
+		case "year":
+			return fmt.Sprintf("DATEFROMPARTS(YEAR(%s), 1, 1)", expr), nil
+		}
+	case "clickhouse":
+		switch grain {
+		case "day":
+			return fmt.Sprintf("toDate(%s)", expr), nil
+		case "week":
+			return fmt.Sprintf("toMonday(%s)", expr), nil
+		case "month":
+			return fmt.Sprintf("toStartOfMonth(%s)", expr), nil
+		case "quarter":
+			return fmt.Sprintf("toStartOfQuarter(%s)", expr), nil
+		case "year":
+			return fmt.Sprintf("toStartOfYear(%s)", expr), nil
+		}
+	default:
+		switch grain {
+		case "day", "week", "month", "quarter", "year":
+			return fmt.Sprintf("date_trunc('%s', %s)", grain, expr), nil
+		}
+	}
+	return "", fmt.Errorf("unknown time grain %q: use one of %s", grain, strings.Join(TimeGrains, ", "))
+}
+
+// MetadataTablePrefix marks tables data-chatter keeps its own metadata in,
+// such as the data dictionary. They are left out of TableNames.
+const MetadataTablePrefix = "dc_"
+
+// CheckMetadataTables reports whether data-chatter can keep metadata tables
+// in the database. ClickHouse cannot: it lacks the transactions, upserts,
+// and row updates they rely on. Nor can SQL Server, whose dialect lacks the
+// CREATE TABLE IF NOT EXISTS, upserts, and TIMESTAMP and BOOLEAN columns
+// they are written with.
+func (c *Config) CheckMetadataTables() error {
+	if c.Type == "clickhouse" {
+		return fmt.Errorf("metadata tables are not supported on ClickHouse")
+	}
+	if c.Type == "sqlserver" {
+		return fmt.Errorf("metadata tables are not supported on SQL Server")
+	}
+	return nil
+}
+
+// TableNames lists the user tables visible on the connection. On DuckDB
+// and ClickHouse this includes views, which is how Parquet and CSV files are
+// usually exposed on DuckDB.
+func (c *Connection) TableNames(ctx context.Context) ([]string, error) {
+	return c.listTables(ctx, false)
+}
+
+// MetadataTableNames lists the tables data-chatter keeps its own metadata in.
+func (c *Connection) MetadataTableNames(ctx context.Context) ([]string, error) {
+	return c.listTables(ctx, true)
+}
+
+// listTables lists the tables on the connection that are metadata tables,
+// or that are not.
+func (c *Connection) listTables(ctx context.Context, metadata bool) ([]string, error) {
+	var query string
+	switch c.Config.Type {
+	case "sqlite":
+		query = `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`
+	case "duckdb":
+		query = `SELECT table_name FROM information_schema.tables
+		         WHERE table_schema = current_schema() AND table_type IN ('BASE TABLE', 'VIEW')
+		         ORDER BY table_name`
+	case "clickhouse":
+		query = `SELECT name FROM system.tables
+		         WHERE database = currentDatabase() AND NOT is_temporary
+		         ORDER BY name`
+	case "mysql":
+		query = `SELECT table_name FROM information_schema.tables
+		         WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'
+		         ORDER BY table_name`
+	case "sqlserver":
+		query = `SELECT table_name FROM information_schema.tables
+		         WHERE table_schema = SCHEMA_NAME() AND table_type = 'BASE TABLE'
+		         ORDER BY table_name`
+	default:
+		query = `SELECT table_name FROM information_schema.tables
+		         WHERE table_schema = current_schema() AND table_type = 'BASE TABLE'
+		         ORDER BY table_name`
+	}
+
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan table name: %w", err)
+		}
+		if strings.HasPrefix(name, MetadataTablePrefix) != metadata {
+			continue
+		}
+		tables = append(tables, name)
+	}
+	return tables, rows.Err()
+}
+
+// HasTable reports whether table is one of the connection's user tables.
+func (c *Connection) HasTable(ctx context.Context, table string) (bool, error) {
+	tables, err := c.TableNames(ctx)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range tables {
+		if name == table {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Schema is a snapshot of the user tables and their columns. Snapshots are
+// shared between callers, which must not modify them.
+type Schema struct {
+	Tables  []string                // Sorted by name
+	Columns map[string][]ColumnInfo // By table
+
+	versions map[string]string // Table definition checksums, by table
+}
+
+// Schema returns the user tables and their columns. Tables are described
+// concurrently by up to Config.SchemaWorkers workers, and the result is
+// reused for Config.SchemaCacheTTL so prompts, tools, and autocomplete do
+// not re-read the catalog on every request. Once the cache expires, only
+// tables whose definition checksum changed are described again. With a
+// SharedSchema store, a schema another replica read is reused too.
+func (c *Connection) Schema(ctx context.Context) (*Schema, error) {
+	c.schemaMu.Lock()
+	defer c.schemaMu.Unlock()
+
+	if c.schema != nil && time.Since(c.schemaFetchedAt) < c.Config.SchemaCacheTTL {
+		return c.schema, nil
+	}
+	if schema, fetchedAt, ok := c.loadSharedSchema(ctx); ok {
+		c.schema, c.schemaFetchedAt = schema, fetchedAt
+		return schema, nil
+	}
+
+	tables, err := c.TableNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := c.tableVersions(ctx)
+	if err != nil {
+		// Without checksums every table is described again.
+		slog.WarnContext(ctx, "failed to read table checksums", "error", err)
+		versions = nil
+	}
+
+	schema := &Schema{Tables: tables, Columns: make(map[string][]ColumnInfo, len(tables)), versions: versions}
+	var changed []string
+	for _, table := range tables {
+		if previous := c.schema; previous != nil && versions[table] != "" && previous.versions[table] == versions[table] {
+			schema.Columns[table] = previous.Columns[table]
+			continue
+		}
+		changed = append(changed, table)
+	}
+
+	columns, err := c.describeTables(ctx, changed)
+	if err != nil {
+		return nil, err
+	}
+	for i, table := range changed {
+		schema.Columns[table] = columns[i]
+	}
+	if c.schema != nil {
+		slog.DebugContext(ctx, "schema refreshed", "tables", len(tables), "described", len(changed))
+	}
+	c.schema, c.schemaFetchedAt = schema, time.Now()
+	c.storeSharedSchema(ctx, schema, c.schemaFetchedAt)
+	return schema, nil
+}
+
+// InvalidateSchema makes the next Schema call read the catalog again, for
+// callers that have just created or dropped a table. Tables whose
+// definition is unchanged are still not described again. The schema
+// shared with other replicas is dropped as well.
+func (c *Connection) InvalidateSchema() {
+	c.schemaMu.Lock()
+	defer c.schemaMu.Unlock()
+	c.schemaFetchedAt = time.Time{}
+	if c.SharedSchema != nil {
+		if err := c.SharedSchema.Del(context.Background(), c.sharedSchemaKey()); err != nil {
+			slog.Warn("failed to drop shared schema", "source", c.Config.SourceName(), "error", err)
+		}
+	}
+}
+
+// SchemaStore holds schemas read by one replica for the others, such as a
+// shared Redis. Get reports a missing or expired key as not found.
+type SchemaStore interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Del(ctx context.Context, keys ...string) error
+}
+
+// sharedSchema is a Schema as kept in a SchemaStore.
+type sharedSchema struct {
+	Tables    []string                `json:"tables"`
+	Columns   map[string][]ColumnInfo `json:"columns"`
+	Versions  map[string]string       `json:"versions,omitempty"`
+	FetchedAt time.Time               `json:"fetched_at"`
+}
+
+// sharedSchemaKey names the connection's schema in the SchemaStore; every
+// replica connected to the same database uses the same key.
+func (c *Connection) sharedSchemaKey() string {
+	sum := sha256.Sum256([]byte(c.Config.SourceName()))
+	return "data-chatter:schema:" + hex.EncodeToString(sum[:])
+}
+
+// loadSharedSchema returns the schema another replica read, with when it was
+// read, if the SchemaStore has one. c.schemaMu is held.
+func (c *Connection) loadSharedSchema(ctx context.Context) (*Schema, time.Time, bool) {
+	if c.SharedSchema == nil || c.Config.SchemaCacheTTL <= 0 {
+		return nil, time.Time{}, false
+	}
+	data, ok, err := c.SharedSchema.Get(ctx, c.sharedSchemaKey())
+	if err != nil {
+		slog.WarnContext(ctx, "failed to read shared schema", "source", c.Config.SourceName(), "error", err)
+	}
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	var shared sharedSchema
+	if err := json.Unmarshal(data, &shared); err != nil {
+		slog.WarnContext(ctx, "ignoring malformed shared schema", "source", c.Config.SourceName(), "error", err)
+		return nil, time.Time{}, false
+	}
+	if time.Since(shared.FetchedAt) >= c.Config.SchemaCacheTTL {
+		return nil, time.Time{}, false
+	}
+	return &Schema{Tables: shared.Tables, Columns: shared.Columns, versions: shared.Versions}, shared.FetchedAt, true
+}
+
+// storeSharedSchema offers schema, read at fetchedAt, to the other replicas
+// for the rest of the cache TTL.
+func (c *Connection) storeSharedSchema(ctx context.Context, schema *Schema, fetchedAt time.Time) {
+	if c.SharedSchema == nil || c.Config.SchemaCacheTTL <= 0 {
+		return
+	}
+	data, err := json.Marshal(sharedSchema{Tables: schema.Tables, Columns: schema.Columns, Versions: schema.versions, FetchedAt: fetchedAt})
+	if err != nil {
+		return
+	}
+	if err := c.SharedSchema.Set(ctx, c.sharedSchemaKey(), data, c.Config.SchemaCacheTTL); err != nil {
+		slog.WarnContext(ctx, "failed to share schema", "source", c.Config.SourceName(), "error", err)
+	}
+}
+
+// tableVersions returns a checksum of each table's definition, read from the
+// catalog in one query, so that a refresh can skip tables that have not
+// changed. The checksum covers column names, types, nullability, and
+// primary keys.
+func (c *Connection) tableVersions(ctx context.Context) (map[string]string, error) {
+	var query string
+	switch c.Config.Type {
+	case "sqlite":
+		// ALTER TABLE rewrites the stored CREATE TABLE statement.
+		query = `SELECT name, sql FROM sqlite_master WHERE type = 'table'`
+	case "mysql":
+		query = `SELECT table_name, CONCAT(COUNT(*), ':', SUM(CRC32(CONCAT_WS(':',
+		             ordinal_position, column_name, column_type, is_nullable, column_key))))
+		         FROM information_schema.columns
+		         WHERE table_schema = DATABASE()
+		         GROUP BY table_name`
+	case "duckdb":
+		query = `SELECT c.table_name, md5(string_agg(
+		             c.column_name || ':' || c.data_type || ':' || c.is_nullable::VARCHAR || ':' ||
+		             list_contains(coalesce(k.constraint_column_names, []), c.column_name)::VARCHAR,
+		             ',' ORDER BY c.column_index))
+		         FROM duckdb_columns() c
+		         LEFT JOIN duckdb_constraints() k
+		           ON k.schema_name = c.schema_name AND k.table_name = c.table_name AND k.constraint_type = 'PRIMARY KEY'
+		         WHERE c.schema_name = current_schema()
+		         GROUP BY c.table_name`
+	case "clickhouse":
+		query = `SELECT table, concat(toString(count()), ':', toString(sum(cityHash64(
+		             position, name, type, is_in_primary_key))))
+		         FROM system.columns
+		         WHERE database = currentDatabase()
+		         GROUP BY table`
+	case "sqlserver":
+		query = `SELECT c.table_name, CONCAT(COUNT(*), ':', SUM(CAST(CHECKSUM(
+		             c.ordinal_position, c.column_name, c.data_type, c.character_maximum_length,
+		             c.is_nullable, k.column_name) AS BIGINT)))
+		         FROM information_schema.columns c
+		         LEFT JOIN (
+		             SELECT kcu.table_name, kcu.column_name
+		             FROM information_schema.table_constraints tc
+		             JOIN information_schema.key_column_usage kcu
+		               ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+		             WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = SCHEMA_NAME()
+		         ) k ON k.table_name = c.table_name AND k.column_name = c.column_name
+		         WHERE c.table_schema = SCHEMA_NAME()
+		         GROUP BY c.table_name`
+	default:
+		query = `SELECT c.table_name, md5(string_agg(
+		             c.column_name || ':' || c.data_type || ':' || c.is_nullable || ':' || (k.column_name IS NOT NULL)::text,
+		             ',' ORDER BY c.ordinal_position))
+		         FROM information_schema.columns c
+		         LEFT JOIN (
+		             SELECT kcu.table_name, kcu.column_name
+		             FROM information_schema.table_constraints tc
+		             JOIN information_schema.key_column_usage kcu
+		               ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+		             WHERE tc.constraint_type = 'PRIMARY KEY' AND tc.table_schema = current_schema()
+		         ) k ON k.table_name = c.table_name AND k.column_name = c.column_name
+		         WHERE c.table_schema = current_schema()
+		         GROUP BY c.table_name`
+	}
+
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table checksums: %w", err)
+	}
+	defer rows.Close()
+
+	versions := make(map[string]string)
+	for rows.Next() {
+		var table string
+		var version sql.NullString
+		if err := rows.Scan(&table, &version); err != nil {
+			return nil, fmt.Errorf("failed to scan table checksum: %w", err)
+		}
+		versions[table] = version.String
+	}
+	return versions, rows.Err()
+}
+
+// describeTables reads the columns of each table with a bounded pool of
+// workers, returning them in the order of tables. The first failure stops
+// the remaining work.
+func (c *Connection) describeTables(ctx context.Context, tables []string) ([][]ColumnInfo, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	workers := min(max(c.Config.SchemaWorkers, 1), len(tables))
+	next := make(chan int)
+	columns := make([][]ColumnInfo, len(tables))
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				described, err := c.TableColumns(ctx, tables[i])
+				if err != nil {
+					cancel(err)
+					continue
+				}
+				columns[i] = described
+			}
+		}()
+	}
+
+feed:
+	for i := range tables {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	if err := context.Cause(ctx); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
+
+// TableColumns returns the columns of table in ordinal order.
+func (c *Connection) TableColumns(ctx context.Context, table string) ([]ColumnInfo, error) {
+	switch c.Config.Type {
+	case "sqlite":
+		return c.sqliteColumns(ctx, table)
+	case "mysql":
+		return c.informationSchemaColumns(ctx, table,
+			`SELECT column_name, column_type, is_nullable, column_key = 'PRI'
+			 FROM information_schema.columns
+			 WHERE table_schema = DATABASE() AND table_name = ?
+			 ORDER BY ordinal_position`)
+	case "duckdb":
+		return c.informationSchemaColumns(ctx, table,
+			`SELECT c.column_name, c.data_type, CASE WHEN c.is_nullable THEN 'YES' ELSE 'NO' END,
+			        EXISTS (
+			            SELECT 1 FROM duckdb_constraints() k
+			            WHERE k.constraint_type = 'PRIMARY KEY'
+			              AND k.schema_name = c.schema_name AND k.table_name = c.table_name
+			              AND list_contains(k.constraint_column_names, c.column_name)
+			        )
+			 FROM duckdb_columns() c
+			 WHERE c.schema_name = current_schema() AND c.table_name = ?
+			 ORDER BY c.column_index`)
+	case "clickhouse":
+		// Columns are only nullable when declared Nullable(...); the primary
+		// key is the sparse sorting index rather than a uniqueness constraint
+		return c.informationSchemaColumns(ctx, table,
+			`SELECT name, type, if(startsWith(type, 'Nullable('), 'YES', 'NO'), toBool(is_in_primary_key)
+			 FROM system.columns
+			 WHERE database = currentDatabase() AND table = ?
+			 ORDER BY position`)
+	case "sqlserver":
+		return c.informationSchemaColumns(ctx, table,
+			`SELECT c.column_name, c.data_type, c.is_nullable,
+			        CAST(CASE WHEN EXISTS (
+			            SELECT 1 FROM information_schema.table_constraints tc
+			            JOIN information_schema.key_column_usage kcu
+			              ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+			            WHERE tc.constraint_type = 'PRIMARY KEY'
+			              AND tc.table_schema = c.table_schema AND tc.table_name = c.table_name
+			              AND kcu.column_name = c.column_name
+			        ) THEN 1 ELSE 0 END AS BIT)
+			 FROM information_schema.columns c
+			 WHERE c.table_schema = SCHEMA_NAME() AND c.table_name = @p1
+			 ORDER BY c.ordinal_position`)
+	default:
+		return c.informationSchemaColumns(ctx, table,
+			`SELECT c.column_name, c.data_type, c.is_nullable,
+			        EXISTS (
+			            SELECT 1 FROM information_schema.table_constraints tc
+			            JOIN information_schema.key_column_usage kcu
+			              ON tc.constraint_name = kcu.constraint_name AND tc.table_schema = kcu.table_schema
+			            WHERE tc.constraint_type = 'PRIMARY KEY'
+			              AND tc.table_schema = c.table_schema AND tc.table_name = c.table_name
+			              AND kcu.column_name = c.column_name
+			        )
+			 FROM information_schema.columns c
+			 WHERE c.table_schema = current_schema() AND c.table_name = $1
+			 ORDER BY c.ordinal_position`)
+	}
+}
+
+// sqliteColumns reads column metadata with PRAGMA table_info.
+func (c *Connection) sqliteColumns(ctx context.Context, table string) ([]ColumnInfo, error) {
+	rows, err := c.DB.QueryContext(ctx, fmt.Sprintf("PRAGMA table_info(%s)", c.Config.QuoteIdentifier(table)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []ColumnInfo
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, dataType string
+		var dfltValue interface{}
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		columns = append(columns, ColumnInfo{
+			Name:       name,
+			DataType:   dataType,
+			Nullable:   notNull == 0,
+			PrimaryKey: pk > 0,
+		})
+	}
+	return columns, rows.Err()
+}
+
+// informationSchemaColumns reads column metadata for MySQL, PostgreSQL,
+// DuckDB, ClickHouse, and SQL Server.
+func (c *Connection) informationSchemaColumns(ctx context.Context, table, query string) ([]ColumnInfo, error) {
+	rows, err := c.DB.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var columns []ColumnInfo
+	for rows.Next() {
+		var name, dataType, isNullable string
+		var primaryKey bool
+		if err := rows.Scan(&name, &dataType, &isNullable, &primaryKey); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		columns = append(columns, ColumnInfo{
+			Name:       name,
+			DataType:   dataType,
+			Nullable:   isNullable == "YES",
+			PrimaryKey: primaryKey,
+		})
+	}
+	return columns, rows.Err()
+}
+
+// IndexInfo describes an index on a table, with its columns in index order.
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Unique  bool     `json:"unique"`
+	Columns []string `json:"columns"`
+}
+
+// TableIndexes returns the indexes on table, including those backing primary
+// keys and unique constraints. table may be schema-qualified on PostgreSQL
+// and SQL Server; elsewhere a qualifier is ignored. DuckDB reports no indexes: it reads
+// columns in bulk and skips row groups by their min/max statistics, so
+// its indexes do not speed up queries the way a B-tree does. ClickHouse
+// reports its primary key, the sparse index that lets filters on its
+// leading columns skip granules.
+func (c *Connection) TableIndexes(ctx context.Context, table string) ([]IndexInfo, error) {
+	var query string
+	switch c.Config.Type {
+	case "duckdb":
+		return nil, nil
+	case "clickhouse":
+		return c.clickHousePrimaryKey(ctx, table[strings.LastIndex(table, ".")+1:])
+	case "sqlite":
+		query = `SELECT il.name, il."unique", ii.name
+			 FROM pragma_index_list(?) il, pragma_index_info(il.name) ii
+			 ORDER BY il.name, ii.seqno`
+	case "mysql":
+		query = `SELECT index_name, non_unique = 0, column_name
+			 FROM information_schema.statistics
+			 WHERE table_schema = DATABASE() AND table_name = ?
+			 ORDER BY index_name, seq_in_index`
+	case "sqlserver":
+		query = `SELECT i.name, i.is_unique, col.name
+			 FROM sys.indexes i
+			 JOIN sys.index_columns ic ON ic.object_id = i.object_id AND ic.index_id = i.index_id
+			 JOIN sys.columns col ON col.object_id = ic.object_id AND col.column_id = ic.column_id
+			 WHERE i.object_id = OBJECT_ID(@p1) AND ic.is_included_column = 0
+			 ORDER BY i.name, ic.key_ordinal`
+	default:
+		query = `SELECT i.relname, ix.indisunique, a.attname
+			 FROM pg_index ix
+			 JOIN pg_class i ON i.oid = ix.indexrelid
+			 JOIN LATERAL unnest(ix.indkey) WITH ORDINALITY AS k(attnum, ord) ON true
+			 JOIN pg_attribute a ON a.attrelid = ix.indrelid AND a.attnum = k.attnum
+			 WHERE ix.indrelid = to_regclass($1)
+			 ORDER BY i.relname, k.ord`
+	}
+	if c.Config.Type != "postgres" && c.Config.Type != "sqlserver" {
+		table = table[strings.LastIndex(table, ".")+1:]
+	}
+
+	rows, err := c.DB.QueryContext(ctx, query, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var indexes []IndexInfo
+	for rows.Next() {
+		var name, column string
+		var unique bool
+		if err := rows.Scan(&name, &unique, &column); err != nil {
+			return nil, fmt.Errorf("failed to scan index: %w", err)
+		}
+		if len(indexes) == 0 || indexes[len(indexes)-1].Name != name {
+			indexes = append(indexes, IndexInfo{Name: name, Unique: unique})
+		}
+		last := &indexes[len(indexes)-1]
+		last.Columns = append(last.Columns, column)
+	}
+	return indexes, rows.Err()
+}
+
+// MaxSampleRows caps the sample rows SampleRows returns per table.
+const MaxSampleRows = 20
+
+// maxSampleValueLength is the longest sample value, in characters, before it is cut.
+const maxSampleValueLength = 40
+
+// sensitiveColumnHints mark columns likely to hold personal data. Their
+// sample values are masked down to their shape, e.g. "(999) 999-9999".
+var sensitiveColumnHints = []string{
+	"name", "mail", "phone", "mobile", "fax", "address", "street", "zip", "postal",
+	"ssn", "social", "birth", "dob", "passw", "secret", "token", "card", "iban", "account",
+}
+
+// SampleRows returns up to limit rows of the given columns of table, so the
+// LLM can see how values are formatted. Values are safe to share: those in
+// columns whose names suggest personal data keep only their shape, with
+// letters replaced by x and digits by 9, and long values are cut short.
+// Rows are read in primary key order when the given columns include the
+// key, so the same rows are sampled each time.
+func (c *Connection) SampleRows(ctx context.Context, table string, columns []ColumnInfo, limit int) ([]map[string]interface{}, error) {
+	if limit <= 0 || len(columns) == 0 {
+		return nil, nil
+	}
+	if limit > MaxSampleRows {
+		limit = MaxSampleRows
+	}
+
+	quoted := make([]string, len(columns))
+	var keys []string
+	for i, col := range columns {
+		quoted[i] = c.Config.QuoteIdentifier(col.Name)
+		if col.PrimaryKey {
+			keys = append(keys, quoted[i])
+		}
+	}
+	query := fmt.Sprintf("SELECT %s FROM %s", strings.Join(quoted, ", "), c.Config.QuoteIdentifier(table))
+	if len(keys) > 0 {
+		query += " ORDER BY " + strings.Join(keys, ", ")
+	}
+	query = c.Config.Limit(query, limit)
+
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sample table %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var samples []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, fmt.Errorf("failed to scan sample row: %w", err)
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			row[col.Name] = sampleValue(col.Name, values[i])
+		}
+		samples = append(samples, row)
+	}
+	return samples, rows.Err()
+}
+
+// sampleValue makes one sample value safe to share.
+func sampleValue(column string, value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if b, ok := value.([]byte); ok {
+		value = string(b)
+	}
+	if SensitiveColumn(column) {
+		return truncateSample(maskValue(fmt.Sprint(value)))
+	}
+	if s, ok := value.(string); ok {
+		return truncateSample(s)
+	}
+	return value
+}
+
+// SensitiveColumn reports whether a column's name suggests personal data,
+// whose sample values are masked.
+func SensitiveColumn(column string) bool {
+	lower := strings.ToLower(column)
+	for _, hint := range sensitiveColumnHints {
+		if strings.Contains(lower, hint) {
+			return true
+		}
+	}
+	return false
+}
+
+// maskValue replaces letters with x and digits with 9, keeping punctuation
+// and spacing so the value's format survives.
+func maskValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsLetter(r):
+			return 'x'
+		case unicode.IsDigit(r):
+			return '9'
+		}
+		return r
+	}, s)
+}
+
+// truncateSample cuts s to maxSampleValueLength characters, marking the cut.
+func truncateSample(s string) string {
+	runes := []rune(s)
+	if len(runes) <= maxSampleValueLength {
+		return s
+	}
+	return string(runes[:maxSampleValueLength]) + "..."
+}
+
+// clickHousePrimaryKey returns a ClickHouse table's primary key as an index
+// named PRIMARY, or none for tables without one.
+func (c *Connection) clickHousePrimaryKey(ctx context.Context, table string) ([]IndexInfo, error) {
+	var key string
+	err := c.DB.QueryRowContext(ctx,
+		`SELECT primary_key FROM system.tables WHERE database = currentDatabase() AND name = ?`, table).Scan(&key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list indexes of %s: %w", table, err)
+	}
+	if key == "" {
+		return nil, nil
+	}
+	index := IndexInfo{Name: "PRIMARY"}
+	for _, column := range strings.Split(key, ",") {
+		index.Columns = append(index.Columns, strings.TrimSpace(column))
+	}
+	return []IndexInfo{index}, nil
+}
@@ -0,0 +1,211 @@
+package database
+
+/*
+#include <stdint.h>
+#include <stdlib.h>
+
+// Declared here rather than included: the symbols come from the SQLite
+// amalgamation compiled into github.com/mattn/go-sqlite3.
+typedef struct sqlite3 sqlite3;
+typedef struct sqlite3_stmt sqlite3_stmt;
+extern void sqlite3_progress_handler(sqlite3*, int, int(*)(void*), void*);
+extern int sqlite3_prepare_v2(sqlite3*, const char*, int, sqlite3_stmt**, const char**);
+extern int sqlite3_stmt_readonly(sqlite3_stmt*);
+extern int sqlite3_finalize(sqlite3_stmt*);
+
+typedef struct {
+	int64_t remaining;
+	int     period;
+} step_budget;
+
+static int step_budget_progress(void *arg) {
+	step_budget *budget = arg;
+	budget->remaining -= budget->period;
+	return budget->remaining < 0;
+}
+
+// check_statement prepares sql without running it and returns 0 when it is
+// one statement that does not write, 1 when the first statement may write,
+// and 2 when another statement follows it. SQL that fails to prepare
+// returns 0, leaving the error to the query itself.
+static int check_statement(void *db, const char *sql, int len) {
+	sqlite3_stmt *stmt = NULL;
+	const char *tail = NULL;
+	if (sqlite3_prepare_v2(db, sql, len, &stmt, &tail) != 0 || stmt == NULL) {
+		return 0;
+	}
+	int readonly = sqlite3_stmt_readonly(stmt);
+	sqlite3_finalize(stmt);
+	if (!readonly) {
+		return 1;
+	}
+	// Whitespace and comments after the statement prepare to no statement
+	while (tail != NULL && tail < sql + len) {
+		const char *rest = tail;
+		stmt = NULL;
+		int rc = sqlite3_prepare_v2(db, rest, len - (int)(rest - sql), &stmt, &tail);
+		if (rc != 0 || stmt != NULL) {
+			sqlite3_finalize(stmt);
+			return 2;
+		}
+		if (tail == rest) {
+			break;
+		}
+	}
+	return 0;
+}
+
+static void set_step_budget(void *db, step_budget *budget) {
+	if (budget == NULL) {
+		sqlite3_progress_handler(db, 0, NULL, NULL);
+		return;
+	}
+	sqlite3_progress_handler(db, budget->period, step_budget_progress, budget);
+}
+*/
+import "C"
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// stepCheckPeriod is how many VDBE instructions run between step-budget checks.
+const stepCheckPeriod = 1000
+
+// ErrStepLimit is returned when a sandboxed SQLite query exceeds its VDBE step budget.
+var ErrStepLimit = errors.New("query exceeded the SQLite step limit")
+
+// sqliteConnector opens SQLite connections with the sandbox limits applied.
+type sqliteConnector struct {
+	driver *sqlite3.SQLiteDriver
+	dsn    string
+}
+
+// newSQLiteConnector returns a connector whose connections enforce the
+// length, memory, and cache limits from config.
+func newSQLiteConnector(config *Config) driver.Connector {
+	return &sqliteConnector{
+		driver: &sqlite3.SQLiteDriver{
+			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+				return applySQLiteLimits(conn, config)
+			},
+		},
+		dsn: config.ConnectionString(),
+	}
+}
+
+// Connect opens a new sandboxed SQLite connection.
+func (c *sqliteConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+// Driver returns the underlying SQLite driver.
+func (c *sqliteConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// applySQLiteLimits caps string/blob size and memory use on a new connection,
+// and makes it read-only when the configuration asks for it.
+// The heap limit is process-wide in SQLite, so every connection sets the same value.
+func applySQLiteLimits(conn *sqlite3.SQLiteConn, config *Config) error {
+	if config.SQLiteMaxLength > 0 {
+		conn.SetLimit(sqlite3.SQLITE_LIMIT_LENGTH, config.SQLiteMaxLength)
+	}
+	conn.SetLimit(sqlite3.SQLITE_LIMIT_ATTACHED, 0)
+
+	pragmas := []string{}
+	if config.SQLiteHeapLimitMB > 0 {
+		pragmas = append(pragmas,
+			fmt.Sprintf("PRAGMA hard_heap_limit = %d", int64(config.SQLiteHeapLimitMB)<<20))
+	}
+	if config.SQLiteCacheSizeMB > 0 {
+		// A negative cache_size is measured in KiB rather than pages.
+		pragmas = append(pragmas, fmt.Sprintf("PRAGMA cache_size = -%d", config.SQLiteCacheSizeMB<<10))
+	}
+	if config.SQLiteReadOnly {
+		pragmas = append(pragmas, "PRAGMA query_only = ON")
+	}
+	for _, pragma := range pragmas {
+		if _, err := conn.Exec(pragma, nil); err != nil {
+			return fmt.Errorf("failed to apply %q: %w", pragma, err)
+		}
+	}
+	return nil
+}
+
+// checkSQLiteStatement refuses query unless SQLite parses it as a single
+// statement that does not write, so nothing stacked after a SELECT runs and
+// a write fails even on a connection whose query_only pragma was turned off.
+func checkSQLiteStatement(conn *sql.Conn, query string) error {
+	cQuery := C.CString(query)
+	defer C.free(unsafe.Pointer(cQuery))
+
+	var result C.int
+	err := conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected SQLite driver connection %T", driverConn)
+		}
+		result = C.check_statement(sqliteHandle(sqliteConn), cQuery, C.int(len(query)))
+		return nil
+	})
+	switch {
+	case err != nil:
+		return err
+	case result == 1:
+		return ErrNotReadOnly
+	case result == 2:
+		return ErrMultipleStatements
+	}
+	return nil
+}
+
+// installStepBudget attaches a progress handler to the connection that aborts
+// the running statement after maxSteps VDBE instructions. The returned function
+// reports whether the budget was exhausted; release removes the handler.
+func installStepBudget(conn *sql.Conn, maxSteps int64) (exhausted func() bool, release func(), err error) {
+	budget := (*C.step_budget)(C.malloc(C.size_t(unsafe.Sizeof(C.step_budget{}))))
+	budget.remaining = C.int64_t(maxSteps)
+	budget.period = stepCheckPeriod
+
+	var handle unsafe.Pointer
+	err = conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected SQLite driver connection %T", driverConn)
+		}
+		handle = sqliteHandle(sqliteConn)
+		C.set_step_budget(handle, budget)
+		return nil
+	})
+	if err != nil {
+		C.free(unsafe.Pointer(budget))
+		return nil, nil, err
+	}
+
+	exhausted = func() bool {
+		return budget.remaining < 0
+	}
+	release = func() {
+		conn.Raw(func(interface{}) error {
+			C.set_step_budget(handle, nil)
+			return nil
+		})
+		C.free(unsafe.Pointer(budget))
+	}
+	return exhausted, release, nil
+}
+
+// sqliteHandle returns the connection's sqlite3* handle, which go-sqlite3 does
+// not export but is needed to register a progress handler.
+func sqliteHandle(conn *sqlite3.SQLiteConn) unsafe.Pointer {
+	return reflect.ValueOf(conn).Elem().FieldByName("db").UnsafePointer()
+}
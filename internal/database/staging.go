@@ -0,0 +1,91 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-chatter/internal/env"
+)
+
+// NewStaging opens an empty in-memory SQLite database to load rows from
+// other databases into and query them together, such as joining the
+// results of two named databases. It has the SQLite sandbox limits of
+// SQLITE_MAX_VM_STEPS, SQLITE_HEAP_LIMIT_MB, SQLITE_CACHE_SIZE_MB, and
+// SQLITE_MAX_LENGTH whatever DB_TYPE is, and base's cap on result rows.
+// The database is discarded when the connection is closed.
+func NewStaging(base *Config) (*Connection, error) {
+	config := &Config{
+		Type:              "sqlite",
+		FilePath:          ":memory:",
+		MaxConns:          1, // Every connection to :memory: opens its own database
+		MaxIdle:           1,
+		MaxResultRows:     base.MaxResultRows,
+		RetryAttempts:     1,
+		SQLiteMaxSteps:    int64(env.Int("SQLITE_MAX_VM_STEPS", 100_000_000)),
+		SQLiteHeapLimitMB: env.Int("SQLITE_HEAP_LIMIT_MB", 256),
+		SQLiteCacheSizeMB: env.Int("SQLITE_CACHE_SIZE_MB", 16),
+		SQLiteMaxLength:   env.Int("SQLITE_MAX_LENGTH", 10_000_000),
+	}
+	db := sql.OpenDB(newSQLiteConnector(config))
+	db.SetMaxOpenConns(config.MaxConns)
+	db.SetMaxIdleConns(config.MaxIdle)
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open staging database: %w", err)
+	}
+	return &Connection{DB: db, Config: config, closed: make(chan struct{})}, nil
+}
+
+// Stage creates table in a staging database with columns, which have no
+// declared types so values keep their own, and inserts rows into it. Times
+// are stored as RFC 3339 text. Byte slices, in which drivers such as MySQL's
+// return numbers, are stored as the integer they spell when they spell one
+// exactly, so keys join whichever database they came from, and otherwise as
+// text.
+func (c *Connection) Stage(ctx context.Context, table string, columns []string, rows [][]interface{}) error {
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = c.Config.QuoteIdentifier(column)
+	}
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	name := c.Config.QuoteIdentifier(table)
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", name, strings.Join(quoted, ", "))); err != nil {
+		return fmt.Errorf("failed to create staging table %s: %w", table, err)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ")
+	insert, err := tx.PrepareContext(ctx, fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", name, strings.Join(quoted, ", "), placeholders))
+	if err != nil {
+		return fmt.Errorf("failed to load staging table %s: %w", table, err)
+	}
+	defer insert.Close()
+
+	values := make([]interface{}, len(columns))
+	for _, row := range rows {
+		for i, value := range row {
+			switch v := value.(type) {
+			case time.Time:
+				values[i] = v.Format(time.RFC3339)
+			case []byte:
+				values[i] = string(v)
+				if n, err := strconv.ParseInt(string(v), 10, 64); err == nil && strconv.FormatInt(n, 10) == string(v) {
+					values[i] = n
+				}
+			default:
+				values[i] = v
+			}
+		}
+		if _, err := insert.ExecContext(ctx, values...); err != nil {
+			return fmt.Errorf("failed to load staging table %s: %w", table, err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// A connection swapped out is left alone for swapSettle, so code that picked
+// it just before the swap can start its query, and is then checked every
+// swapPoll until no query is running on it, when it is closed.
+const (
+	swapSettle = 5 * time.Second
+	swapPoll   = time.Second
+)
+
+// Swap connects to target with c's settings, as Derive does, and from then
+// on routes the queries of code holding c to the new connection: For
+// returns it for contexts not routed to another database. c's own pool,
+// and with it the server's own tables, stay where they are, as do tenants'
+// and named databases. Nothing changes when the connection fails, such as
+// when the database cannot be reached; the database file of SQLite and
+// DuckDB must already exist. The connection swapped out, if not c, is
+// closed once the queries running on it, however long, have finished. It
+// returns the new connection.
+func (c *Connection) Swap(target Target) (*Connection, error) {
+	if target.Port < 0 || target.Port > 65535 {
+		return nil, fmt.Errorf("invalid port %d", target.Port)
+	}
+	if (c.Config.Type == "sqlite" || c.Config.Type == "duckdb") && target.File != "" {
+		if _, err := os.Stat(target.File); err != nil {
+			return nil, fmt.Errorf("database file %s: %w", target.File, err)
+		}
+	}
+
+	c.swapMu.Lock()
+	defer c.swapMu.Unlock()
+	conn, err := c.Derive(target)
+	if err != nil {
+		return nil, err
+	}
+	previous := c.active.Load()
+	conn.Generation = c.Active().Generation + 1
+	c.active.Store(conn)
+
+	slog.Info("swapped default database", "source", conn.Config.SourceName(), "generation", conn.Generation)
+	if previous != nil {
+		go previous.drain()
+	}
+	return conn, nil
+}
+
+// drain closes a connection swapped out once none of its pool's connections
+// is in use, which includes queries still reading their rows.
+func (c *Connection) drain() {
+	time.Sleep(swapSettle)
+	ticker := time.NewTicker(swapPoll)
+	defer ticker.Stop()
+	for c.DB.Stats().InUse > 0 {
+		<-ticker.C
+	}
+	if err := c.Close(); err != nil {
+		slog.Warn("failed to close swapped-out database", "source", c.Config.SourceName(), "error", err)
+		return
+	}
+	slog.Info("closed swapped-out database", "source", c.Config.SourceName())
+}
+
+// Active returns the connection c's queries run on: the one last swapped
+// in by Swap, or c itself.
+func (c *Connection) Active() *Connection {
+	if active := c.active.Load(); active != nil {
+		return active
+	}
+	return c
+}
+
+// closeActive closes the connection swapped in, if any, when c is closed.
+func (c *Connection) closeActive() error {
+	if active := c.active.Load(); active != nil {
+		return active.Close()
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+)
+
+// Target names another database of the same type as a connection's, such
+// as a tenant's database or one a chat session switches to. Fields left
+// empty keep the connection's values; File is the database file of SQLite
+// and DuckDB, and DBName the database of the other types.
+type Target struct {
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	User     string `json:"user,omitempty"`
+	Password string `json:"password,omitempty"`
+	DBName   string `json:"dbname,omitempty"`
+	SSLMode  string `json:"sslmode,omitempty"`
+	File     string `json:"file,omitempty"`
+}
+
+// Derive connects to target with c's settings, so the new connection shares
+// its SQL dialect and limits, and with its PII masking, result cache, and
+// slow query log. It reads and caches its own schema. A DuckDB target reads
+// only the files beside its own.
+func (c *Connection) Derive(target Target) (*Connection, error) {
+	config := *c.Config
+	config.DuckDBAllowedDirs = nil
+	switch config.Type {
+	case "sqlite", "duckdb":
+		if target.File == "" {
+			return nil, errors.New("a database file is required")
+		}
+		config.FilePath = target.File
+		if config.Type == "duckdb" {
+			config.DuckDBAllowedDirs = []string{filepath.Dir(target.File)}
+		}
+	default:
+		if target.DBName == "" {
+			return nil, errors.New("a database name is required")
+		}
+		config.DBName = target.DBName
+		if target.Host != "" {
+			config.Host = target.Host
+		}
+		if target.Port != 0 {
+			config.Port = target.Port
+		}
+		if target.User != "" {
+			config.User = target.User
+		}
+		if target.Password != "" {
+			config.Password = target.Password
+		}
+		if target.SSLMode != "" {
+			config.SSLMode = target.SSLMode
+		}
+	}
+
+	conn, err := NewConnection(&config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	conn.Masker, conn.ResultCache, conn.SlowQueries = c.Masker, c.ResultCache, c.SlowQueries
+	conn.SharedSchema = c.SharedSchema
+	return conn, nil
+}
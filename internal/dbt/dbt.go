@@ -0,0 +1,398 @@
+// Package dbt reads governed metric definitions from a dbt project's
+// manifest.json, so chat answers can compute metrics the way the data team
+// defined them rather than with ad-hoc SQL. It understands MetricFlow
+// semantic models (dbt 1.6 and later) with simple and ratio metrics, and the
+// metrics of dbt 1.3 to 1.5.
+package dbt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Metric is a metric reduced to the SQL that computes it.
+type Metric struct {
+	Name        string
+	Label       string
+	Description string
+
+	// Table is the relation the metric is computed over, as dbt renders it,
+	// e.g. "analytics"."orders".
+	Table string
+
+	// Expression is the aggregate SQL computing the metric over Table, with
+	// the metric's filters folded in, e.g.
+	// SUM(CASE WHEN status = 'paid' THEN amount END).
+	Expression string
+
+	// Dimensions maps the names the metric may be grouped by to their SQL.
+	Dimensions map[string]string
+
+	// Time is the SQL of the metric's time dimension, or "" when it has none.
+	Time string
+}
+
+// DimensionNames returns the metric's dimension names in order.
+func (m Metric) DimensionNames() []string {
+	names := make([]string, 0, len(m.Dimensions))
+	for name := range m.Dimensions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// manifest is the part of manifest.json metrics are read from.
+type manifest struct {
+	Metrics        map[string]manifestMetric `json:"metrics"`
+	SemanticModels map[string]semanticModel  `json:"semantic_models"`
+	Nodes          map[string]manifestNode   `json:"nodes"`
+}
+
+type manifestNode struct {
+	RelationName string `json:"relation_name"`
+	Schema       string `json:"schema"`
+	Alias        string `json:"alias"`
+	Name         string `json:"name"`
+}
+
+type manifestMetric struct {
+	Name        string `json:"name"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+
+	// MetricFlow
+	Type       string `json:"type"`
+	TypeParams struct {
+		Measure     *metricInput `json:"measure"`
+		Numerator   *metricInput `json:"numerator"`
+		Denominator *metricInput `json:"denominator"`
+	} `json:"type_params"`
+	Filter *whereFilter `json:"filter"`
+
+	// dbt 1.3 to 1.5
+	CalculationMethod string         `json:"calculation_method"`
+	Expression        string         `json:"expression"`
+	Timestamp         string         `json:"timestamp"`
+	Dimensions        []string       `json:"dimensions"`
+	Filters           []legacyFilter `json:"filters"`
+	DependsOn         struct {
+		Nodes []string `json:"nodes"`
+	} `json:"depends_on"`
+}
+
+// metricInput names a simple metric's measure, or a ratio's input metric,
+// with its own filter.
+type metricInput struct {
+	Name   string       `json:"name"`
+	Filter *whereFilter `json:"filter"`
+}
+
+type whereFilter struct {
+	WhereFilters []struct {
+		WhereSQLTemplate string `json:"where_sql_template"`
+	} `json:"where_filters"`
+}
+
+type legacyFilter struct {
+	Field    string `json:"field"`
+	Operator string `json:"operator"`
+	Value    string `json:"value"`
+}
+
+type semanticModel struct {
+	Name         string `json:"name"`
+	NodeRelation struct {
+		RelationName string `json:"relation_name"`
+		SchemaName   string `json:"schema_name"`
+		Alias        string `json:"alias"`
+	} `json:"node_relation"`
+	Defaults *struct {
+		AggTimeDimension string `json:"agg_time_dimension"`
+	} `json:"defaults"`
+	Measures []struct {
+		Name             string `json:"name"`
+		Agg              string `json:"agg"`
+		Expr             string `json:"expr"`
+		AggTimeDimension string `json:"agg_time_dimension"`
+	} `json:"measures"`
+	Dimensions []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+		Expr string `json:"expr"`
+	} `json:"dimensions"`
+}
+
+// LoadFromEnv loads the metrics of the manifest at DBT_MANIFEST_PATH, or
+// returns none when it is unset.
+func LoadFromEnv() ([]Metric, error) {
+	path := os.Getenv("DBT_MANIFEST_PATH")
+	if path == "" {
+		return nil, nil
+	}
+	return Load(path)
+}
+
+// Load reads the metrics of a dbt manifest.json, sorted by name. Metrics of
+// kinds that cannot be reduced to one aggregate, such as derived and
+// cumulative metrics, are skipped with a warning.
+func Load(path string) ([]Metric, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read dbt manifest: %w", err)
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse dbt manifest %s: %w", path, err)
+	}
+
+	measures := make(map[string]measure)
+	for _, model := range m.SemanticModels {
+		for _, ms := range model.measures() {
+			measures[ms.name] = ms
+		}
+	}
+
+	byName := make(map[string]manifestMetric, len(m.Metrics))
+	for _, raw := range m.Metrics {
+		byName[raw.Name] = raw
+	}
+
+	var metrics []Metric
+	for _, raw := range m.Metrics {
+		var metric Metric
+		var err error
+		if raw.CalculationMethod != "" {
+			metric, err = m.legacyMetric(raw)
+		} else {
+			metric, err = flowMetric(raw, measures, byName)
+		}
+		if err != nil {
+			slog.Warn("skipping dbt metric", "metric", raw.Name, "error", err)
+			continue
+		}
+		metric.Name, metric.Label, metric.Description = raw.Name, raw.Label, raw.Description
+		metrics = append(metrics, metric)
+	}
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].Name < metrics[j].Name })
+	return metrics, nil
+}
+
+// measure is a semantic model's measure with the model's relation and
+// dimensions.
+type measure struct {
+	name       string
+	agg        string
+	expr       string
+	table      string
+	dimensions map[string]string
+	time       string
+}
+
+// measures returns the model's measures.
+func (s semanticModel) measures() []measure {
+	table := s.NodeRelation.RelationName
+	if table == "" {
+		table = s.NodeRelation.Alias
+		if s.NodeRelation.SchemaName != "" {
+			table = s.NodeRelation.SchemaName + "." + table
+		}
+	}
+	dimensions := make(map[string]string, len(s.Dimensions))
+	for _, dim := range s.Dimensions {
+		dimensions[dim.Name] = orName(dim.Expr, dim.Name)
+	}
+	defaultTime := ""
+	if s.Defaults != nil {
+		defaultTime = s.Defaults.AggTimeDimension
+	}
+
+	measures := make([]measure, 0, len(s.Measures))
+	for _, ms := range s.Measures {
+		timeDim := orName(ms.AggTimeDimension, defaultTime)
+		measures = append(measures, measure{
+			name:       ms.Name,
+			agg:        ms.Agg,
+			expr:       orName(ms.Expr, ms.Name),
+			table:      table,
+			dimensions: dimensions,
+			time:       dimensions[timeDim],
+		})
+	}
+	return measures
+}
+
+// flowMetric reduces a MetricFlow simple or ratio metric. byName holds the
+// manifest's metrics, which ratios name as their inputs.
+func flowMetric(raw manifestMetric, measures map[string]measure, byName map[string]manifestMetric) (Metric, error) {
+	switch raw.Type {
+	case "simple":
+		if raw.TypeParams.Measure == nil {
+			return Metric{}, fmt.Errorf("simple metric has no measure")
+		}
+		ms, ok := measures[raw.TypeParams.Measure.Name]
+		if !ok {
+			return Metric{}, fmt.Errorf("unknown measure %s", raw.TypeParams.Measure.Name)
+		}
+		filter, err := flowFilter(ms.dimensions, raw.Filter, raw.TypeParams.Measure.Filter)
+		if err != nil {
+			return Metric{}, err
+		}
+		expression, err := aggregate(ms.agg, ms.expr, filter)
+		if err != nil {
+			return Metric{}, err
+		}
+		return Metric{Table: ms.table, Expression: expression, Dimensions: ms.dimensions, Time: ms.time}, nil
+
+	case "ratio":
+		num, den := raw.TypeParams.Numerator, raw.TypeParams.Denominator
+		if num == nil || den == nil {
+			return Metric{}, fmt.Errorf("ratio metric needs a numerator and a denominator")
+		}
+		var sides [2]Metric
+		for i, input := range []*metricInput{num, den} {
+			side, ok := byName[input.Name]
+			if !ok || side.Type != "simple" {
+				return Metric{}, fmt.Errorf("ratio input %s must be a simple metric", input.Name)
+			}
+			// The input's own filter applies on top of the simple metric's
+			side.Filter = mergeFilters(side.Filter, raw.Filter, input.Filter)
+			var err error
+			if sides[i], err = flowMetric(side, measures, byName); err != nil {
+				return Metric{}, fmt.Errorf("ratio input %s: %w", input.Name, err)
+			}
+		}
+		if sides[0].Table != sides[1].Table {
+			return Metric{}, fmt.Errorf("ratio inputs from different semantic models are not supported")
+		}
+		return Metric{
+			Table:      sides[0].Table,
+			Expression: fmt.Sprintf("%s * 1.0 / NULLIF(%s, 0)", sides[0].Expression, sides[1].Expression),
+			Dimensions: sides[0].Dimensions,
+			Time:       sides[0].Time,
+		}, nil
+	}
+	return Metric{}, fmt.Errorf("%s metrics are not supported", orName(raw.Type, "untyped"))
+}
+
+// mergeFilters combines where filters into one.
+func mergeFilters(filters ...*whereFilter) *whereFilter {
+	merged := &whereFilter{}
+	for _, filter := range filters {
+		if filter != nil {
+			merged.WhereFilters = append(merged.WhereFilters, filter.WhereFilters...)
+		}
+	}
+	return merged
+}
+
+// templateRef matches the Dimension, TimeDimension, and Entity references
+// of a MetricFlow where filter, e.g. {{ Dimension('order__status') }}.
+var templateRef = regexp.MustCompile(`\{\{\s*(?:Dimension|TimeDimension|Entity)\(\s*'([^']+)'[^)]*\)\s*\}\}`)
+
+// flowFilter renders MetricFlow where filters as one SQL condition over the
+// model's dimensions.
+func flowFilter(dimensions map[string]string, filters ...*whereFilter) (string, error) {
+	var conditions []string
+	for _, filter := range filters {
+		if filter == nil {
+			continue
+		}
+		for _, where := range filter.WhereFilters {
+			var unknown string
+			condition := templateRef.ReplaceAllStringFunc(where.WhereSQLTemplate, func(ref string) string {
+				name := templateRef.FindStringSubmatch(ref)[1]
+				if i := strings.LastIndex(name, "__"); i >= 0 {
+					name = name[i+2:] // drop the entity path
+				}
+				if expr, ok := dimensions[name]; ok {
+					return expr
+				}
+				unknown = name
+				return ref
+			})
+			if unknown != "" {
+				return "", fmt.Errorf("filter refers to unknown dimension %s", unknown)
+			}
+			if strings.Contains(condition, "{{") {
+				return "", fmt.Errorf("unsupported filter %q", where.WhereSQLTemplate)
+			}
+			conditions = append(conditions, "("+condition+")")
+		}
+	}
+	return strings.Join(conditions, " AND "), nil
+}
+
+// legacyMetric reduces a dbt 1.3 to 1.5 metric, which names its model in
+// depends_on and its columns directly.
+func (m manifest) legacyMetric(raw manifestMetric) (Metric, error) {
+	var table string
+	for _, id := range raw.DependsOn.Nodes {
+		if node, ok := m.Nodes[id]; ok {
+			table = node.RelationName
+			if table == "" {
+				table = node.Schema + "." + orName(node.Alias, node.Name)
+			}
+			break
+		}
+	}
+	if table == "" {
+		return Metric{}, fmt.Errorf("model not found in manifest")
+	}
+
+	var conditions []string
+	for _, f := range raw.Filters {
+		conditions = append(conditions, fmt.Sprintf("(%s %s %s)", f.Field, f.Operator, f.Value))
+	}
+	expression, err := aggregate(raw.CalculationMethod, raw.Expression, strings.Join(conditions, " AND "))
+	if err != nil {
+		return Metric{}, err
+	}
+
+	dimensions := make(map[string]string, len(raw.Dimensions))
+	for _, dim := range raw.Dimensions {
+		dimensions[dim] = dim
+	}
+	return Metric{Table: table, Expression: expression, Dimensions: dimensions, Time: raw.Timestamp}, nil
+}
+
+// aggregate renders an aggregation of expr over the rows matching filter,
+// or all rows when filter is "".
+func aggregate(agg, expr, filter string) (string, error) {
+	if expr == "" {
+		return "", fmt.Errorf("measure has no expression")
+	}
+	if filter != "" {
+		expr = fmt.Sprintf("CASE WHEN %s THEN %s END", filter, expr)
+	}
+	switch strings.ToLower(agg) {
+	case "sum":
+		return "SUM(" + expr + ")", nil
+	case "count":
+		return "COUNT(" + expr + ")", nil
+	case "count_distinct":
+		return "COUNT(DISTINCT " + expr + ")", nil
+	case "average", "avg":
+		return "AVG(" + expr + ")", nil
+	case "min":
+		return "MIN(" + expr + ")", nil
+	case "max":
+		return "MAX(" + expr + ")", nil
+	case "sum_boolean":
+		return "SUM(CASE WHEN " + expr + " THEN 1 ELSE 0 END)", nil
+	}
+	return "", fmt.Errorf("%s aggregation is not supported", agg)
+}
+
+// orName returns value, or fallback when value is "".
+func orName(value, fallback string) string {
+	if value != "" {
+		return value
+	}
+	return fallback
+}
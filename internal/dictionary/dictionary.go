@@ -0,0 +1,189 @@
+// Package dictionary keeps the data dictionary: descriptions of tables and
+// columns in business terms, written by admins and added to the LLM's schema
+// prompt so questions phrased in business language map onto the right
+// columns. Descriptions live in the dc_column_descriptions table of the
+// connected database.
+package dictionary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+)
+
+// Table is where descriptions are stored. Its dc_ prefix keeps it out of
+// the schema shown to users and the LLM.
+const Table = database.MetadataTablePrefix + "column_descriptions"
+
+// MaxLength bounds one description.
+const MaxLength = 2000
+
+var (
+	// ErrNotFound is returned when deleting a description that does not exist.
+	ErrNotFound = errors.New("description not found")
+
+	// ErrTooLarge is returned for descriptions longer than MaxLength.
+	ErrTooLarge = errors.New("description too large")
+
+	// ErrUnknownTarget is returned when describing a table or column that is not in the schema.
+	ErrUnknownTarget = errors.New("no such table or column")
+)
+
+// Entry describes a table, or one of its columns when Column is set.
+type Entry struct {
+	Table       string    `json:"table"`
+	Column      string    `json:"column,omitempty"`
+	Description string    `json:"description"`
+	UpdatedBy   string    `json:"updated_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Store reads and writes descriptions in the connected database.
+type Store struct {
+	conn *database.Connection
+}
+
+// NewStore creates the descriptions table if it does not exist yet.
+func NewStore(ctx context.Context, conn *database.Connection) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		table_name  VARCHAR(255) NOT NULL,
+		column_name VARCHAR(255) NOT NULL,
+		description TEXT NOT NULL,
+		updated_by  VARCHAR(255) NOT NULL,
+		updated_at  TIMESTAMP NOT NULL,
+		PRIMARY KEY (table_name, column_name)
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	return &Store{conn: conn}, nil
+}
+
+// List returns every description, or those of one table when table is set,
+// ordered by table with each table's own description before its columns'.
+func (s *Store) List(ctx context.Context, table string) ([]Entry, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	query := `SELECT table_name, column_name, description, updated_by, updated_at FROM ` + s.conn.Config.QuoteIdentifier(Table)
+	var args []interface{}
+	if table != "" {
+		query += ` WHERE table_name = ` + s.conn.Config.Placeholder(1)
+		args = append(args, table)
+	}
+	query += ` ORDER BY table_name, column_name`
+
+	rows, err := s.conn.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data dictionary: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []Entry
+	for rows.Next() {
+		var entry Entry
+		if err := rows.Scan(&entry.Table, &entry.Column, &entry.Description, &entry.UpdatedBy, &entry.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan data dictionary entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// Set saves a description, replacing any earlier one for the same table or
+// column. The table and column must exist.
+func (s *Store) Set(ctx context.Context, entry Entry) (Entry, error) {
+	entry.Description = strings.TrimSpace(entry.Description)
+	if len(entry.Description) > MaxLength {
+		return Entry{}, fmt.Errorf("%w: %d bytes; the limit is %d", ErrTooLarge, len(entry.Description), MaxLength)
+	}
+	if err := s.checkTarget(ctx, entry.Table, entry.Column); err != nil {
+		return Entry{}, err
+	}
+	entry.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+
+	config := s.conn.Config
+	insert := fmt.Sprintf(`INSERT INTO %s (table_name, column_name, description, updated_by, updated_at) VALUES (%s, %s, %s, %s, %s)`,
+		config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3), config.Placeholder(4), config.Placeholder(5))
+	if config.Type == "mysql" {
+		insert += ` ON DUPLICATE KEY UPDATE description = VALUES(description), updated_by = VALUES(updated_by), updated_at = VALUES(updated_at)`
+	} else {
+		insert += ` ON CONFLICT (table_name, column_name) DO UPDATE SET description = excluded.description, updated_by = excluded.updated_by, updated_at = excluded.updated_at`
+	}
+
+	if _, err := s.conn.DB.ExecContext(ctx, insert, entry.Table, entry.Column, entry.Description, entry.UpdatedBy, entry.UpdatedAt); err != nil {
+		return Entry{}, fmt.Errorf("failed to save description: %w", err)
+	}
+	return entry, nil
+}
+
+// Delete removes the description of a table, or of one of its columns when column is set.
+func (s *Store) Delete(ctx context.Context, table, column string) error {
+	config := s.conn.Config
+	result, err := s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE table_name = %s AND column_name = %s`,
+			config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2)),
+		table, column)
+	if err != nil {
+		return fmt.Errorf("failed to delete description: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// checkTarget verifies that table, and column when set, are in the schema.
+func (s *Store) checkTarget(ctx context.Context, table, column string) error {
+	exists, err := s.conn.HasTable(ctx, table)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: table %s", ErrUnknownTarget, table)
+	}
+	if column == "" {
+		return nil
+	}
+
+	columns, err := s.conn.TableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	for _, col := range columns {
+		if col.Name == column {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: column %s.%s", ErrUnknownTarget, table, column)
+}
+
+// Descriptions indexes entries by table and column for building prompts.
+type Descriptions map[string]map[string]string
+
+// Index groups entries by table; a table's own description has the empty column name.
+func Index(entries []Entry) Descriptions {
+	index := make(Descriptions)
+	for _, entry := range entries {
+		if index[entry.Table] == nil {
+			index[entry.Table] = make(map[string]string)
+		}
+		index[entry.Table][entry.Column] = entry.Description
+	}
+	return index
+}
+
+// Describe returns the description of a table, or of one of its columns
+// when column is set, or "".
+func (d Descriptions) Describe(table, column string) string {
+	return d[table][column]
+}
@@ -0,0 +1,57 @@
+package dictionary
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Note is a deployment-specific hint about a table, or one of its columns
+// when Column is set, such as how its values are formatted. Notes are
+// configured with the deployment rather than written by admins, and are
+// added to the schema prompt after any description.
+type Note struct {
+	Table  string `json:"table" yaml:"table" toml:"table"`
+	Column string `json:"column,omitempty" yaml:"column" toml:"column"`
+	Note   string `json:"note" yaml:"note" toml:"note"`
+}
+
+// NotesFromEnv reads the schema notes in SCHEMA_NOTES, a JSON array of
+// objects with table, column, and note fields. An unset variable means no notes.
+func NotesFromEnv() ([]Note, error) {
+	value := os.Getenv("SCHEMA_NOTES")
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var notes []Note
+	if err := json.Unmarshal([]byte(value), &notes); err != nil {
+		return nil, fmt.Errorf("invalid SCHEMA_NOTES: %w", err)
+	}
+	for i, note := range notes {
+		if note.Table == "" || strings.TrimSpace(note.Note) == "" {
+			return nil, fmt.Errorf("invalid SCHEMA_NOTES: entry %d needs a table and a note", i)
+		}
+		if len(note.Note) > MaxLength {
+			return nil, fmt.Errorf("invalid SCHEMA_NOTES: entry %d: %w", i, ErrTooLarge)
+		}
+	}
+	return notes, nil
+}
+
+// AddNotes appends notes to the descriptions of their tables and columns,
+// or uses them as the description where there is none.
+func (d Descriptions) AddNotes(notes []Note) Descriptions {
+	for _, note := range notes {
+		if d[note.Table] == nil {
+			d[note.Table] = make(map[string]string)
+		}
+		text := strings.TrimSpace(note.Note)
+		if description := d[note.Table][note.Column]; description != "" {
+			text = description + " " + text
+		}
+		d[note.Table][note.Column] = text
+	}
+	return d
+}
@@ -0,0 +1,60 @@
+package dictionary
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Rule declares the values a column may hold: one of AcceptedValues, or
+// text matching Pattern, a regular expression. Rules are configured with
+// the deployment, like notes, and the column_validate tool reports the
+// values that break them.
+type Rule struct {
+	Table          string   `json:"table" yaml:"table" toml:"table"`
+	Column         string   `json:"column" yaml:"column" toml:"column"`
+	AcceptedValues []string `json:"accepted_values,omitempty" yaml:"accepted_values" toml:"accepted_values"`
+	Pattern        string   `json:"pattern,omitempty" yaml:"pattern" toml:"pattern"`
+	Description    string   `json:"description,omitempty" yaml:"description" toml:"description"`
+}
+
+// Check validates the rule and compiles its pattern, if it has one.
+func (r Rule) Check() (*regexp.Regexp, error) {
+	if r.Table == "" || r.Column == "" {
+		return nil, fmt.Errorf("a rule needs a table and a column")
+	}
+	if (len(r.AcceptedValues) == 0) == (r.Pattern == "") {
+		return nil, fmt.Errorf("rule for %s.%s needs either accepted_values or a pattern", r.Table, r.Column)
+	}
+	if r.Pattern == "" {
+		return nil, nil
+	}
+	pattern, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("rule for %s.%s has an invalid pattern: %w", r.Table, r.Column, err)
+	}
+	return pattern, nil
+}
+
+// RulesFromEnv reads the column rules in COLUMN_RULES, a JSON array of
+// objects with table, column, and accepted_values or pattern fields. An
+// unset variable means no rules.
+func RulesFromEnv() ([]Rule, error) {
+	value := os.Getenv("COLUMN_RULES")
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var rules []Rule
+	if err := json.Unmarshal([]byte(value), &rules); err != nil {
+		return nil, fmt.Errorf("invalid COLUMN_RULES: %w", err)
+	}
+	for i, rule := range rules {
+		if _, err := rule.Check(); err != nil {
+			return nil, fmt.Errorf("invalid COLUMN_RULES: entry %d: %w", i, err)
+		}
+	}
+	return rules, nil
+}
@@ -0,0 +1,420 @@
+// Package digest keeps statistics on every chat turn and sends admins a
+// daily digest of them: how many questions were asked and how many were
+// answered, the most-queried tables, LLM token spend, and the
+// lowest-rated answers. Statistics live in the dc_turn_stats table of the
+// connected database, so the digest covers every replica's turns, and are
+// rolled up by day into the dc_turn_stats_daily tables, which outlive them
+// and keep summaries of long periods fast.
+package digest
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/encryption"
+	"data-chatter/internal/notify"
+)
+
+const (
+	// Table is where turn statistics are kept. Its dc_ prefix keeps it out
+	// of the schema shown to users and the LLM.
+	Table = database.MetadataTablePrefix + "turn_stats"
+
+	// retention is how long turn statistics are kept.
+	retention = 90 * 24 * time.Hour
+
+	// resealBatch bounds the turns one Reseal encrypts again.
+	resealBatch = 500
+
+	// topTables and lowestRated bound the lists in a digest.
+	topTables   = 10
+	lowestRated = 5
+)
+
+// Turn is the outcome of one chat turn.
+type Turn struct {
+	TurnID         string    `json:"turn_id"`
+	UserID         string    `json:"user_id,omitempty"`
+	ConversationID string    `json:"conversation_id,omitempty"`
+	Question       string    `json:"question"`
+	Status         int       `json:"status"` // HTTP status of the answer
+	Error          string    `json:"error,omitempty"`
+	Tables         []string  `json:"tables,omitempty"`
+	FailedSteps    int       `json:"failed_steps"` // Tool calls that returned an error
+	Retries        int       `json:"retries"`      // Tool call attempts beyond the first
+	InputTokens    int       `json:"input_tokens"`
+	OutputTokens   int       `json:"output_tokens"`
+	AskedAt        time.Time `json:"asked_at"`
+}
+
+// Rating rates the answer a turn got, from 0 for a failed answer through 1
+// for one with failing tool calls and 2 for one whose tool calls had to be
+// retried, to 3 for a clean answer.
+func (t Turn) Rating() int {
+	switch {
+	case t.Status >= 400:
+		return 0
+	case t.FailedSteps > 0:
+		return 1
+	case t.Retries > 0:
+		return 2
+	}
+	return 3
+}
+
+// TableCount is how many turns queried a table.
+type TableCount struct {
+	Table string `json:"table"`
+	Turns int    `json:"turns"`
+}
+
+// Summary describes the turns asked in a period.
+type Summary struct {
+	Since        time.Time    `json:"since"`
+	Until        time.Time    `json:"until"`
+	Questions    int          `json:"questions"`
+	Users        int          `json:"users"`
+	Answered     int          `json:"answered"`
+	Failed       int          `json:"failed"`
+	Tables       []TableCount `json:"tables"`
+	InputTokens  int          `json:"input_tokens"`
+	OutputTokens int          `json:"output_tokens"`
+
+	// LowestRated are the worst-rated answers, worst and then newest first;
+	// answers rated 3 are left out.
+	LowestRated []Turn `json:"lowest_rated"`
+}
+
+// Config selects who receives the digest and when.
+type Config struct {
+	// Recipients are the user IDs sent the digest, through their
+	// notification preferences.
+	Recipients []string
+
+	// At is when the digest is sent, as an offset past midnight UTC. It
+	// covers the 24 hours before.
+	At time.Duration
+}
+
+// ConfigFromEnv reads DIGEST_RECIPIENTS, a comma-separated list of user IDs,
+// and DIGEST_TIME, the "HH:MM" UTC time to send the digest at (default
+// "00:00"). It returns nil when DIGEST_RECIPIENTS is unset.
+func ConfigFromEnv() (*Config, error) {
+	var config Config
+	for _, id := range strings.Split(os.Getenv("DIGEST_RECIPIENTS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			config.Recipients = append(config.Recipients, id)
+		}
+	}
+	if len(config.Recipients) == 0 {
+		return nil, nil
+	}
+	if value := os.Getenv("DIGEST_TIME"); value != "" {
+		at, err := time.Parse("15:04", value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid DIGEST_TIME %q: want HH:MM", value)
+		}
+		config.At = time.Duration(at.Hour())*time.Hour + time.Duration(at.Minute())*time.Minute
+	}
+	return &config, nil
+}
+
+// Store records turn statistics and sends digests of them.
+type Store struct {
+	conn   *database.Connection
+	sender *notify.Sender
+	keys   *encryption.Keyring
+}
+
+// NewStore creates the turn statistics table and its daily rollups if they
+// do not exist yet.
+// Digests are sent through sender. With keys, questions and error messages
+// are encrypted.
+func NewStore(ctx context.Context, conn *database.Connection, sender *notify.Sender, keys *encryption.Keyring) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		turn_id         VARCHAR(64) NOT NULL,
+		user_id         VARCHAR(255) NOT NULL,
+		conversation_id VARCHAR(64) NOT NULL,
+		question        TEXT NOT NULL,
+		status          INTEGER NOT NULL,
+		error_message   TEXT NOT NULL,
+		table_names     TEXT NOT NULL,
+		failed_steps    INTEGER NOT NULL,
+		retries         INTEGER NOT NULL,
+		input_tokens    BIGINT NOT NULL,
+		output_tokens   BIGINT NOT NULL,
+		asked_at        BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	if err := createRollups(ctx, conn); err != nil {
+		return nil, err
+	}
+	return &Store{conn: conn, sender: sender, keys: keys}, nil
+}
+
+// Record saves the statistics of a finished turn. A nil store records
+// nothing.
+func (s *Store) Record(ctx context.Context, turn Turn) error {
+	if s == nil {
+		return nil
+	}
+	if turn.AskedAt.IsZero() {
+		turn.AskedAt = time.Now().UTC()
+	}
+	question, err := s.keys.Seal(turn.Question)
+	if err != nil {
+		return err
+	}
+	message, err := s.keys.Seal(turn.Error)
+	if err != nil {
+		return err
+	}
+
+	config := s.conn.Config
+	placeholders := make([]string, 12)
+	for i := range placeholders {
+		placeholders[i] = config.Placeholder(i + 1)
+	}
+	_, err = s.conn.DB.ExecContext(ctx,
+		`INSERT INTO `+config.QuoteIdentifier(Table)+` (turn_id, user_id, conversation_id, question, status, error_message, table_names, failed_steps, retries, input_tokens, output_tokens, asked_at) VALUES (`+strings.Join(placeholders, ", ")+`)`,
+		turn.TurnID, turn.UserID, turn.ConversationID, question, turn.Status, message, strings.Join(turn.Tables, ","),
+		turn.FailedSteps, turn.Retries, turn.InputTokens, turn.OutputTokens, turn.AskedAt.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to save turn statistics: %w", err)
+	}
+	return nil
+}
+
+// AddTokens adds tokens spent on a turn after it was recorded, such as on a
+// summary streamed once its results were sent. A nil store records nothing.
+func (s *Store) AddTokens(ctx context.Context, turnID string, input, output int) error {
+	if s == nil || input == 0 && output == 0 {
+		return nil
+	}
+	config := s.conn.Config
+	_, err := s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`UPDATE %s SET input_tokens = input_tokens + %s, output_tokens = output_tokens + %s WHERE turn_id = %s`,
+			config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3)),
+		input, output, turnID)
+	if err != nil {
+		return fmt.Errorf("failed to save turn tokens: %w", err)
+	}
+	return nil
+}
+
+// Summarize describes the turns asked from since until until. Whole days
+// already rolled up are read from their rollups, so long periods stay
+// cheap to summarize.
+func (s *Store) Summarize(ctx context.Context, since, until time.Time) (Summary, error) {
+	tally, err := s.tallyPeriod(ctx, since, until)
+	if err != nil {
+		return Summary{}, err
+	}
+	return s.summarize(ctx, tally, since, until)
+}
+
+// summarize describes the turns asked from since until until, tallied in
+// tally, reading the lowest-rated answers from the turns themselves.
+func (s *Store) summarize(ctx context.Context, tally *tally, since, until time.Time) (Summary, error) {
+	summary := Summary{Since: since.UTC(), Until: until.UTC()}
+	tally.summarize(&summary)
+
+	config := s.conn.Config
+	rows, err := s.conn.DB.QueryContext(ctx,
+		config.Limit(fmt.Sprintf(`SELECT turn_id, user_id, conversation_id, question, status, error_message, table_names, failed_steps, retries, input_tokens, output_tokens, asked_at FROM %s
+			WHERE asked_at >= %s AND asked_at < %s AND (status >= 400 OR failed_steps > 0 OR retries > 0)
+			ORDER BY CASE WHEN status >= 400 THEN 0 WHEN failed_steps > 0 THEN 1 ELSE 2 END, asked_at DESC`,
+			config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2)), lowestRated),
+		since.UnixMilli(), until.UnixMilli())
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read turn statistics: %w", err)
+	}
+	defer rows.Close()
+
+	var rated []Turn
+	for rows.Next() {
+		var turn Turn
+		var tableList string
+		var askedAt int64
+		if err := rows.Scan(&turn.TurnID, &turn.UserID, &turn.ConversationID, &turn.Question, &turn.Status, &turn.Error,
+			&tableList, &turn.FailedSteps, &turn.Retries, &turn.InputTokens, &turn.OutputTokens, &askedAt); err != nil {
+			return Summary{}, fmt.Errorf("failed to read turn statistics: %w", err)
+		}
+		turn.AskedAt = time.UnixMilli(askedAt).UTC()
+		if tableList != "" {
+			turn.Tables = strings.Split(tableList, ",")
+		}
+		if turn.Question, err = s.keys.Open(turn.Question); err != nil {
+			return Summary{}, err
+		}
+		if turn.Error, err = s.keys.Open(turn.Error); err != nil {
+			return Summary{}, err
+		}
+		rated = append(rated, turn)
+	}
+	if err := rows.Err(); err != nil {
+		return Summary{}, fmt.Errorf("failed to read turn statistics: %w", err)
+	}
+	summary.LowestRated = rated
+	return summary, nil
+}
+
+// Reseal encrypts the questions and error messages of up to resealBatch
+// turns recorded in plaintext or with a key other than the current one,
+// after encryption is turned on or a key is rotated. It runs as a scheduled
+// task, so a key may be dropped once every turn has been resealed.
+func (s *Store) Reseal(ctx context.Context) error {
+	if !s.keys.Enabled() {
+		return nil
+	}
+	config := s.conn.Config
+	rows, err := s.conn.DB.QueryContext(ctx,
+		config.Limit(fmt.Sprintf(`SELECT turn_id, question, error_message FROM %s WHERE question NOT LIKE %s`,
+			config.QuoteIdentifier(Table), config.Placeholder(1)), resealBatch),
+		s.keys.CurrentPrefix()+"%")
+	if err != nil {
+		return fmt.Errorf("failed to read turn statistics: %w", err)
+	}
+	type stale struct{ turnID, question, message string }
+	var turns []stale
+	for rows.Next() {
+		var turn stale
+		if err := rows.Scan(&turn.turnID, &turn.question, &turn.message); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read turn statistics: %w", err)
+		}
+		turns = append(turns, turn)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read turn statistics: %w", err)
+	}
+
+	for _, turn := range turns {
+		question, err := s.reseal(turn.question)
+		if err != nil {
+			return err
+		}
+		message, err := s.reseal(turn.message)
+		if err != nil {
+			return err
+		}
+		_, err = s.conn.DB.ExecContext(ctx,
+			fmt.Sprintf(`UPDATE %s SET question = %s, error_message = %s WHERE turn_id = %s AND question = %s`,
+				config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3), config.Placeholder(4)),
+			question, message, turn.turnID, turn.question)
+		if err != nil {
+			return fmt.Errorf("failed to reseal turn statistics: %w", err)
+		}
+	}
+	if len(turns) > 0 {
+		slog.InfoContext(ctx, "resealed turn statistics", "turns", len(turns))
+	}
+	return nil
+}
+
+// reseal opens value and seals it again with the current key.
+func (s *Store) reseal(value string) (string, error) {
+	if s.keys.Current(value) {
+		return value, nil
+	}
+	plaintext, err := s.keys.Open(value)
+	if err != nil {
+		return "", err
+	}
+	return s.keys.Seal(plaintext)
+}
+
+// Send sends the digest of the last 24 hours to recipients, then drops
+// statistics past retention. A recipient whose delivery fails is logged and
+// skipped. It runs as a daily scheduled task.
+func (s *Store) Send(ctx context.Context, recipients []string) error {
+	now := time.Now().UTC()
+	summary, err := s.Summarize(ctx, now.Add(-24*time.Hour), now)
+	if err != nil {
+		return err
+	}
+
+	notification := notify.Notification{
+		Kind:    "usage_digest",
+		Subject: fmt.Sprintf("Data Chatter digest for %s", summary.Since.Format("2006-01-02")),
+		Text:    summary.Describe(),
+		Data:    summary,
+		SentAt:  now,
+	}
+	for _, recipient := range recipients {
+		if err := s.sender.Send(ctx, recipient, notification); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.WarnContext(ctx, "digest notification failed", "user_id", recipient, "error", err)
+		}
+	}
+
+	_, err = s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE asked_at < %s`, s.conn.Config.QuoteIdentifier(Table), s.conn.Config.Placeholder(1)),
+		now.Add(-retention).UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to prune turn statistics: %w", err)
+	}
+	return nil
+}
+
+// Describe renders the summary as the plain-text body of a digest.
+func (s Summary) Describe() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d questions from %d users between %s and %s UTC.\n",
+		s.Questions, s.Users, s.Since.Format("2006-01-02 15:04"), s.Until.Format("2006-01-02 15:04"))
+	if s.Questions == 0 {
+		return b.String()
+	}
+	fmt.Fprintf(&b, "Answered: %d (%.1f%%). Failed: %d (%.1f%%).\n",
+		s.Answered, percent(s.Answered, s.Questions), s.Failed, percent(s.Failed, s.Questions))
+	fmt.Fprintf(&b, "LLM tokens: %d input, %d output.\n", s.InputTokens, s.OutputTokens)
+
+	if len(s.Tables) > 0 {
+		b.WriteString("\nMost-queried tables:\n")
+		for _, table := range s.Tables {
+			fmt.Fprintf(&b, "- %s: %d\n", table.Table, table.Turns)
+		}
+	}
+	if len(s.LowestRated) > 0 {
+		b.WriteString("\nLowest-rated answers:\n")
+		for _, turn := range s.LowestRated {
+			fmt.Fprintf(&b, "- %q (%s, turn %s)\n", turn.Question, turn.outcome(), turn.TurnID)
+		}
+	}
+	return b.String()
+}
+
+// outcome says why a turn was rated below a clean answer.
+func (t Turn) outcome() string {
+	switch t.Rating() {
+	case 0:
+		if t.Error != "" {
+			return fmt.Sprintf("failed with status %d: %s", t.Status, t.Error)
+		}
+		return fmt.Sprintf("failed with status %d", t.Status)
+	case 1:
+		return fmt.Sprintf("failing tool calls: %d", t.FailedSteps)
+	case 2:
+		return fmt.Sprintf("retried tool calls: %d", t.Retries)
+	}
+	return "answered"
+}
+
+// percent returns n as a percentage of total.
+func percent(n, total int) float64 {
+	return 100 * float64(n) / float64(total)
+}
@@ -0,0 +1,455 @@
+package digest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+)
+
+const (
+	// DailyTable, DailyUsersTable and DailyTablesTable hold turn statistics
+	// rolled up by UTC day: the day's totals, each user's share of them,
+	// and how many of the day's turns queried each table. Summaries read
+	// them for whole days instead of every turn.
+	DailyTable       = Table + "_daily"
+	DailyUsersTable  = Table + "_daily_users"
+	DailyTablesTable = Table + "_daily_tables"
+
+	// rollupRetention is how long daily rollups are kept, well past the
+	// turns they were rolled up from.
+	rollupRetention = 2 * 365 * 24 * time.Hour
+
+	dayLayout = "2006-01-02"
+)
+
+// Day is the rollup of the turns asked on one UTC day.
+type Day struct {
+	Day          string `json:"day"` // YYYY-MM-DD
+	Questions    int    `json:"questions"`
+	Users        int    `json:"users"`
+	Answered     int    `json:"answered"`
+	Failed       int    `json:"failed"`
+	InputTokens  int    `json:"input_tokens"`
+	OutputTokens int    `json:"output_tokens"`
+}
+
+// Usage is the day-by-day usage over a period, with its summary.
+type Usage struct {
+	Summary Summary `json:"summary"`
+	Days    []Day   `json:"days"`
+}
+
+// counts are turn statistics being added up.
+type counts struct {
+	questions, answered, failed, inputTokens, outputTokens int
+}
+
+// add counts a turn in c.
+func (c *counts) add(status, inputTokens, outputTokens int) {
+	c.questions++
+	if status >= 400 {
+		c.failed++
+	} else {
+		c.answered++
+	}
+	c.inputTokens += inputTokens
+	c.outputTokens += outputTokens
+}
+
+// merge adds other to c.
+func (c *counts) merge(other counts) {
+	c.questions += other.questions
+	c.answered += other.answered
+	c.failed += other.failed
+	c.inputTokens += other.inputTokens
+	c.outputTokens += other.outputTokens
+}
+
+// tally is turn statistics added up by day, user and table.
+type tally struct {
+	days   map[string]*counts
+	users  map[string]map[string]*counts // By day, then user
+	tables map[string]map[string]int     // By day, then table
+}
+
+func newTally() *tally {
+	return &tally{
+		days:   make(map[string]*counts),
+		users:  make(map[string]map[string]*counts),
+		tables: make(map[string]map[string]int),
+	}
+}
+
+// add counts a turn asked on day in t.
+func (t *tally) add(day, userID string, status int, tableList string, inputTokens, outputTokens int) {
+	if t.days[day] == nil {
+		t.days[day] = &counts{}
+		t.users[day] = make(map[string]*counts)
+		t.tables[day] = make(map[string]int)
+	}
+	t.days[day].add(status, inputTokens, outputTokens)
+	if t.users[day][userID] == nil {
+		t.users[day][userID] = &counts{}
+	}
+	t.users[day][userID].add(status, inputTokens, outputTokens)
+	if tableList != "" {
+		for _, table := range strings.Split(tableList, ",") {
+			t.tables[day][table]++
+		}
+	}
+}
+
+// createRollups creates the daily rollup tables if they do not exist yet.
+func createRollups(ctx context.Context, conn *database.Connection) error {
+	quote := conn.Config.QuoteIdentifier
+	statements := map[string]string{
+		DailyTable: `CREATE TABLE IF NOT EXISTS ` + quote(DailyTable) + ` (
+		day           VARCHAR(10) NOT NULL PRIMARY KEY,
+		questions     INTEGER NOT NULL,
+		users         INTEGER NOT NULL,
+		answered      INTEGER NOT NULL,
+		failed        INTEGER NOT NULL,
+		input_tokens  BIGINT NOT NULL,
+		output_tokens BIGINT NOT NULL
+	)`,
+		DailyUsersTable: `CREATE TABLE IF NOT EXISTS ` + quote(DailyUsersTable) + ` (
+		day           VARCHAR(10) NOT NULL,
+		user_id       VARCHAR(255) NOT NULL,
+		questions     INTEGER NOT NULL,
+		answered      INTEGER NOT NULL,
+		failed        INTEGER NOT NULL,
+		input_tokens  BIGINT NOT NULL,
+		output_tokens BIGINT NOT NULL,
+		PRIMARY KEY (day, user_id)
+	)`,
+		DailyTablesTable: `CREATE TABLE IF NOT EXISTS ` + quote(DailyTablesTable) + ` (
+		day        VARCHAR(10) NOT NULL,
+		table_name VARCHAR(255) NOT NULL,
+		turns      INTEGER NOT NULL,
+		PRIMARY KEY (day, table_name)
+	)`,
+	}
+	for _, table := range []string{DailyTable, DailyUsersTable, DailyTablesTable} {
+		if _, err := conn.DB.ExecContext(ctx, statements[table]); err != nil {
+			return fmt.Errorf("failed to create %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// Rollup rolls up the turns of every whole UTC day since the last one
+// rolled up, then drops rollups past their retention. The last day rolled
+// up is rolled up again, to count tokens added to its turns afterwards; on
+// the first run every day still in the turn statistics is. It runs as a
+// scheduled task.
+func (s *Store) Rollup(ctx context.Context) error {
+	config := s.conn.Config
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+
+	start, err := s.rolledUntil(ctx)
+	if err != nil {
+		return err
+	}
+	if !start.IsZero() {
+		start = start.Add(-24 * time.Hour)
+	} else {
+		var first sql.NullInt64
+		err := s.conn.DB.QueryRowContext(ctx, `SELECT MIN(asked_at) FROM `+config.QuoteIdentifier(Table)).Scan(&first)
+		if err != nil {
+			return fmt.Errorf("failed to read turn statistics: %w", err)
+		}
+		start = today.Add(-24 * time.Hour)
+		if first.Valid {
+			if day := time.UnixMilli(first.Int64).UTC().Truncate(24 * time.Hour); day.Before(start) {
+				start = day
+			}
+		}
+	}
+	if !start.Before(today) {
+		return nil
+	}
+
+	tally := newTally()
+	if err := s.tallyTurns(ctx, tally, start, today); err != nil {
+		return err
+	}
+	if err := s.saveRollups(ctx, tally, start, today); err != nil {
+		return err
+	}
+	days := int(today.Sub(start) / (24 * time.Hour))
+	slog.InfoContext(ctx, "rolled up turn statistics", "from", start.Format(dayLayout), "days", days)
+
+	cutoff := today.Add(-rollupRetention).Format(dayLayout)
+	for _, table := range []string{DailyTable, DailyUsersTable, DailyTablesTable} {
+		_, err := s.conn.DB.ExecContext(ctx,
+			fmt.Sprintf(`DELETE FROM %s WHERE day < %s`, config.QuoteIdentifier(table), config.Placeholder(1)), cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to prune usage rollups: %w", err)
+		}
+	}
+	return nil
+}
+
+// tallyTurns adds up the turns asked from since until until in tally.
+func (s *Store) tallyTurns(ctx context.Context, tally *tally, since, until time.Time) error {
+	if !since.Before(until) {
+		return nil
+	}
+	config := s.conn.Config
+	rows, err := s.conn.DB.QueryContext(ctx,
+		fmt.Sprintf(`SELECT user_id, status, table_names, input_tokens, output_tokens, asked_at FROM %s WHERE asked_at >= %s AND asked_at < %s`,
+			config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2)),
+		since.UnixMilli(), until.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to read turn statistics: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var userID, tableList string
+		var status, inputTokens, outputTokens int
+		var askedAt int64
+		if err := rows.Scan(&userID, &status, &tableList, &inputTokens, &outputTokens, &askedAt); err != nil {
+			return fmt.Errorf("failed to read turn statistics: %w", err)
+		}
+		tally.add(time.UnixMilli(askedAt).UTC().Format(dayLayout), userID, status, tableList, inputTokens, outputTokens)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read turn statistics: %w", err)
+	}
+	return nil
+}
+
+// saveRollups replaces the rollups of the days from since until until
+// with tally in one transaction. Days without turns get a row of zeros, so
+// they count as rolled up.
+func (s *Store) saveRollups(ctx context.Context, tally *tally, since, until time.Time) error {
+	config := s.conn.Config
+	p := config.Placeholder
+	tx, err := s.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to save usage rollups: %w", err)
+	}
+	defer tx.Rollback()
+
+	first, end := since.Format(dayLayout), until.Format(dayLayout)
+	for _, table := range []string{DailyTable, DailyUsersTable, DailyTablesTable} {
+		_, err := tx.ExecContext(ctx,
+			fmt.Sprintf(`DELETE FROM %s WHERE day >= %s AND day < %s`, config.QuoteIdentifier(table), p(1), p(2)), first, end)
+		if err != nil {
+			return fmt.Errorf("failed to save usage rollups: %w", err)
+		}
+	}
+
+	for day := since; day.Before(until); day = day.Add(24 * time.Hour) {
+		key := day.Format(dayLayout)
+		total := tally.days[key]
+		if total == nil {
+			total = &counts{}
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO `+config.QuoteIdentifier(DailyTable)+` (day, questions, users, answered, failed, input_tokens, output_tokens) VALUES (`+
+				strings.Join([]string{p(1), p(2), p(3), p(4), p(5), p(6), p(7)}, ", ")+`)`,
+			key, total.questions, len(tally.users[key]), total.answered, total.failed, total.inputTokens, total.outputTokens)
+		if err != nil {
+			return fmt.Errorf("failed to save usage rollups: %w", err)
+		}
+		for userID, c := range tally.users[key] {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO `+config.QuoteIdentifier(DailyUsersTable)+` (day, user_id, questions, answered, failed, input_tokens, output_tokens) VALUES (`+
+					strings.Join([]string{p(1), p(2), p(3), p(4), p(5), p(6), p(7)}, ", ")+`)`,
+				key, userID, c.questions, c.answered, c.failed, c.inputTokens, c.outputTokens)
+			if err != nil {
+				return fmt.Errorf("failed to save usage rollups: %w", err)
+			}
+		}
+		for table, turns := range tally.tables[key] {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO `+config.QuoteIdentifier(DailyTablesTable)+` (day, table_name, turns) VALUES (`+p(1)+`, `+p(2)+`, `+p(3)+`)`,
+				key, table, turns)
+			if err != nil {
+				return fmt.Errorf("failed to save usage rollups: %w", err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save usage rollups: %w", err)
+	}
+	return nil
+}
+
+// rolledUntil returns the end of the last day rolled up, or the zero time
+// when none has been.
+func (s *Store) rolledUntil(ctx context.Context) (time.Time, error) {
+	var last sql.NullString
+	err := s.conn.DB.QueryRowContext(ctx, `SELECT MAX(day) FROM `+s.conn.Config.QuoteIdentifier(DailyTable)).Scan(&last)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to read usage rollups: %w", err)
+	}
+	if !last.Valid {
+		return time.Time{}, nil
+	}
+	day, err := time.Parse(dayLayout, last.String)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid usage rollup day %q: %w", last.String, err)
+	}
+	return day.Add(24 * time.Hour), nil
+}
+
+// tallyPeriod adds up the turns asked from since until until in a new
+// tally: whole days already rolled up from their rollups, and the rest
+// from the turns themselves.
+func (s *Store) tallyPeriod(ctx context.Context, since, until time.Time) (*tally, error) {
+	tally := newTally()
+	rolled, err := s.rolledUntil(ctx)
+	if err != nil {
+		return nil, err
+	}
+	from := since.UTC().Add(24*time.Hour - 1).Truncate(24 * time.Hour)
+	to := until.UTC().Truncate(24 * time.Hour)
+	if rolled.Before(to) {
+		to = rolled
+	}
+	if !from.Before(to) {
+		return tally, s.tallyTurns(ctx, tally, since, until)
+	}
+
+	if err := s.tallyTurns(ctx, tally, since, from); err != nil {
+		return nil, err
+	}
+	if err := s.tallyRollups(ctx, tally, from, to); err != nil {
+		return nil, err
+	}
+	if err := s.tallyTurns(ctx, tally, to, until); err != nil {
+		return nil, err
+	}
+	return tally, nil
+}
+
+// tallyRollups adds the rollups of the days from since until until to
+// tally.
+func (s *Store) tallyRollups(ctx context.Context, tally *tally, since, until time.Time) error {
+	config := s.conn.Config
+	first, end := since.Format(dayLayout), until.Format(dayLayout)
+
+	rows, err := s.conn.DB.QueryContext(ctx,
+		fmt.Sprintf(`SELECT day, user_id, questions, answered, failed, input_tokens, output_tokens FROM %s WHERE day >= %s AND day < %s`,
+			config.QuoteIdentifier(DailyUsersTable), config.Placeholder(1), config.Placeholder(2)),
+		first, end)
+	if err != nil {
+		return fmt.Errorf("failed to read usage rollups: %w", err)
+	}
+	for rows.Next() {
+		var day, userID string
+		var c counts
+		if err := rows.Scan(&day, &userID, &c.questions, &c.answered, &c.failed, &c.inputTokens, &c.outputTokens); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read usage rollups: %w", err)
+		}
+		if tally.days[day] == nil {
+			tally.days[day] = &counts{}
+			tally.users[day] = make(map[string]*counts)
+			tally.tables[day] = make(map[string]int)
+		}
+		tally.days[day].merge(c)
+		tally.users[day][userID] = &c
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read usage rollups: %w", err)
+	}
+
+	rows, err = s.conn.DB.QueryContext(ctx,
+		fmt.Sprintf(`SELECT day, table_name, turns FROM %s WHERE day >= %s AND day < %s`,
+			config.QuoteIdentifier(DailyTablesTable), config.Placeholder(1), config.Placeholder(2)),
+		first, end)
+	if err != nil {
+		return fmt.Errorf("failed to read usage rollups: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var day, table string
+		var turns int
+		if err := rows.Scan(&day, &table, &turns); err != nil {
+			return fmt.Errorf("failed to read usage rollups: %w", err)
+		}
+		if tally.tables[day] == nil {
+			tally.tables[day] = make(map[string]int)
+		}
+		tally.tables[day][table] += turns
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read usage rollups: %w", err)
+	}
+	return nil
+}
+
+// summarize fills in summary's totals, users and top tables from tally.
+func (t *tally) summarize(summary *Summary) {
+	users := make(map[string]bool)
+	tables := make(map[string]int)
+	for day, c := range t.days {
+		summary.Questions += c.questions
+		summary.Answered += c.answered
+		summary.Failed += c.failed
+		summary.InputTokens += c.inputTokens
+		summary.OutputTokens += c.outputTokens
+		for userID := range t.users[day] {
+			users[userID] = true
+		}
+	}
+	for _, byTable := range t.tables {
+		for table, turns := range byTable {
+			tables[table] += turns
+		}
+	}
+	summary.Users = len(users)
+
+	for table, turns := range tables {
+		summary.Tables = append(summary.Tables, TableCount{Table: table, Turns: turns})
+	}
+	sort.Slice(summary.Tables, func(i, j int) bool {
+		a, b := summary.Tables[i], summary.Tables[j]
+		return a.Turns > b.Turns || a.Turns == b.Turns && a.Table < b.Table
+	})
+	if len(summary.Tables) > topTables {
+		summary.Tables = summary.Tables[:topTables]
+	}
+}
+
+// Usage returns the usage from since until until day by day, oldest first,
+// with its summary. Days without turns are included, as zeros.
+func (s *Store) Usage(ctx context.Context, since, until time.Time) (Usage, error) {
+	tally, err := s.tallyPeriod(ctx, since, until)
+	if err != nil {
+		return Usage{}, err
+	}
+	summary, err := s.summarize(ctx, tally, since, until)
+	if err != nil {
+		return Usage{}, err
+	}
+
+	usage := Usage{Summary: summary, Days: []Day{}}
+	for day := since.UTC().Truncate(24 * time.Hour); day.Before(until); day = day.Add(24 * time.Hour) {
+		key := day.Format(dayLayout)
+		c := tally.days[key]
+		if c == nil {
+			c = &counts{}
+		}
+		usage.Days = append(usage.Days, Day{
+			Day:          key,
+			Questions:    c.questions,
+			Users:        len(tally.users[key]),
+			Answered:     c.answered,
+			Failed:       c.failed,
+			InputTokens:  c.inputTokens,
+			OutputTokens: c.outputTokens,
+		})
+	}
+	return usage, nil
+}
@@ -0,0 +1,232 @@
+// Package encryption seals chat history at rest, since prompts and results
+// can hold sensitive row data. Values are encrypted with AES-256-GCM under
+// app-level keys listed in HISTORY_ENCRYPTION_KEYS, each either a data key
+// decrypted by AWS KMS at startup or derived from a passphrase. The first
+// key seals new values; the others only open values sealed before a
+// rotation, until the stores holding them have re-sealed them.
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"data-chatter/internal/awsauth"
+)
+
+// Prefix starts every sealed value, followed by the key ID, a colon, and
+// the base64 nonce and ciphertext. Values without it are plaintext written
+// before encryption was turned on.
+const Prefix = "enc:v1:"
+
+// passphraseIterations is the PBKDF2-SHA256 work factor for passphrase keys.
+const passphraseIterations = 600_000
+
+// kmsTimeout bounds the KMS call that decrypts a data key.
+const kmsTimeout = 30 * time.Second
+
+// keyID is what a key may be called: it is stored in every sealed value.
+var keyID = regexp.MustCompile(`^[A-Za-z0-9-]{1,32}$`)
+
+// ErrNoKey is returned when a value was sealed with a key the keyring does
+// not hold, or at all when encryption is off.
+var ErrNoKey = errors.New("encryption key not configured")
+
+// Keyring seals and opens values. A nil Keyring leaves values as they are.
+type Keyring struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// KeyringFromEnv reads HISTORY_ENCRYPTION_KEYS, a comma-separated list of
+// id=kms:<base64 ciphertext blob> or id=passphrase:<text> keys, newest
+// first. KMS blobs are data keys made with "aws kms generate-data-key
+// --key-spec AES_256", decrypted with the credentials in AWS_* and
+// AWS_ENDPOINT_URL_KMS when set. An unset variable turns encryption off and
+// returns nil.
+func KeyringFromEnv(ctx context.Context) (*Keyring, error) {
+	value := strings.TrimSpace(os.Getenv("HISTORY_ENCRYPTION_KEYS"))
+	if value == "" {
+		return nil, nil
+	}
+
+	k := &Keyring{keys: make(map[string]cipher.AEAD)}
+	for _, spec := range strings.Split(value, ",") {
+		id, source, ok := strings.Cut(strings.TrimSpace(spec), "=")
+		if !ok || !keyID.MatchString(id) {
+			return nil, fmt.Errorf("invalid HISTORY_ENCRYPTION_KEYS entry %q: want id=kms:... or id=passphrase:..., with an id of letters, digits, and dashes", id)
+		}
+		if _, taken := k.keys[id]; taken {
+			return nil, fmt.Errorf("invalid HISTORY_ENCRYPTION_KEYS: key %s is listed twice", id)
+		}
+		key, err := resolveKey(ctx, id, source)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HISTORY_ENCRYPTION_KEYS key %s: %w", id, err)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid HISTORY_ENCRYPTION_KEYS key %s: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		k.keys[id] = aead
+		if k.current == "" {
+			k.current = id
+		}
+	}
+	return k, nil
+}
+
+// resolveKey returns the 32-byte AES key source describes.
+func resolveKey(ctx context.Context, id, source string) ([]byte, error) {
+	kind, secret, _ := strings.Cut(source, ":")
+	switch kind {
+	case "passphrase":
+		if secret == "" {
+			return nil, errors.New("empty passphrase")
+		}
+		// The salt is fixed per key so every replica derives the same key.
+		return pbkdf2.Key(sha256.New, secret, []byte("data-chatter history key "+id), passphraseIterations, 32)
+	case "kms":
+		blob, err := base64.StdEncoding.DecodeString(secret)
+		if err != nil {
+			return nil, fmt.Errorf("KMS ciphertext blob is not base64: %w", err)
+		}
+		key, err := kmsDecrypt(ctx, blob)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("KMS data key is %d bytes, want 32 (--key-spec AES_256)", len(key))
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unknown key source %q: want kms or passphrase", kind)
+	}
+}
+
+// kmsDecrypt decrypts a KMS ciphertext blob with the KMS Decrypt API.
+func kmsDecrypt(ctx context.Context, blob []byte) ([]byte, error) {
+	creds, ok := awsauth.CredentialsFromEnv()
+	if !ok {
+		return nil, errors.New("KMS keys need AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	region := awsauth.Region()
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_KMS")
+	if endpoint == "" {
+		endpoint = "https://kms." + region + ".amazonaws.com"
+	}
+	body, err := json.Marshal(map[string]string{"CiphertextBlob": base64.StdEncoding.EncodeToString(blob)})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, kmsTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid KMS endpoint: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Set("X-Amz-Target", "TrentService.Decrypt")
+	awsauth.Sign(request, creds, "kms", region, awsauth.HashHex(body), time.Now().UTC())
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("KMS decrypt failed: %w", err)
+	}
+	defer response.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("KMS decrypt failed: %w", err)
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("KMS decrypt failed: %s: %s", response.Status, strings.TrimSpace(string(data)))
+	}
+	var decrypted struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	if err := json.Unmarshal(data, &decrypted); err != nil {
+		return nil, fmt.Errorf("KMS decrypt failed: %w", err)
+	}
+	return decrypted.Plaintext, nil
+}
+
+// Enabled reports whether values are sealed.
+func (k *Keyring) Enabled() bool {
+	return k != nil
+}
+
+// CurrentPrefix returns the prefix of values sealed with the current key,
+// so stores can find the values a rotation left behind. It is empty when
+// encryption is off.
+func (k *Keyring) CurrentPrefix() string {
+	if k == nil {
+		return ""
+	}
+	return Prefix + k.current + ":"
+}
+
+// Current reports whether value needs no re-sealing: it is sealed with the
+// current key, or encryption is off.
+func (k *Keyring) Current(value string) bool {
+	return k == nil || strings.HasPrefix(value, k.CurrentPrefix())
+}
+
+// Seal encrypts plaintext with the current key. Without a keyring it
+// returns plaintext as it is.
+func (k *Keyring) Seal(plaintext string) (string, error) {
+	if k == nil {
+		return plaintext, nil
+	}
+	aead := k.keys[k.current]
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to seal value: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), []byte(k.current))
+	return k.CurrentPrefix() + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value made by Seal. Values without Prefix are returned
+// as they are, so data written before encryption was turned on stays
+// readable.
+func (k *Keyring) Open(value string) (string, error) {
+	rest, sealed := strings.CutPrefix(value, Prefix)
+	if !sealed {
+		return value, nil
+	}
+	id, encoded, _ := strings.Cut(rest, ":")
+	if k == nil {
+		return "", fmt.Errorf("%w: a value is sealed with key %s but HISTORY_ENCRYPTION_KEYS is unset", ErrNoKey, id)
+	}
+	aead, ok := k.keys[id]
+	if !ok {
+		return "", fmt.Errorf("%w: a value is sealed with key %s, which HISTORY_ENCRYPTION_KEYS does not list", ErrNoKey, id)
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("sealed value with key %s is corrupt", id)
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to open value sealed with key %s: %w", id, err)
+	}
+	return string(plaintext), nil
+}
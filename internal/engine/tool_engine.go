@@ -2,43 +2,436 @@
 package engine
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-chatter/internal/artifacts"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/calendar"
+	"data-chatter/internal/catalog"
 	"data-chatter/internal/database"
+	"data-chatter/internal/dbt"
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/jobs"
+	"data-chatter/internal/mongodb"
+	"data-chatter/internal/quality"
+	"data-chatter/internal/redact"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/savedqueries"
+	"data-chatter/internal/semantic"
+	"data-chatter/internal/snapshots"
+	"data-chatter/internal/telemetry"
 	"data-chatter/internal/tools"
 	"data-chatter/internal/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = telemetry.Tracer("data-chatter/internal/engine")
+
 // ToolEngine manages tool registration and execution for LLM tool calls.
 type ToolEngine struct {
-	registry *types.ToolRegistry
+	registry     *types.ToolRegistry
+	schema       *tools.DatabaseSchemaTool
+	savedQueries *tools.SavedQueryRunTool
+	columnRules  *tools.ColumnValidateTool
+	quality      *tools.QualityScorecardTool
+	estimate     *tools.DatabaseEstimateTool
+	artifacts    *tools.ArtifactCreateTool
+	diff         *tools.QueryDiffTool
+	semantic     *tools.SemanticSearchTool
+	crossJoin    *tools.CrossDatabaseJoinTool
+	metrics      []*tools.MetricTool
+	stats        *toolStats
 }
 
-// NewToolEngine creates a new tool engine and registers all available tools.
-func NewToolEngine(dbConn *database.Connection) *ToolEngine {
+// NewToolEngine creates a new tool engine and registers all available tools,
+// including date_range over the BUSINESS_CALENDARS, the MongoDB tools when
+// MONGO_URI is set, semantic_search when SEMANTIC_COLUMNS is set,
+// cross_database_join when DATABASES_FILE names databases, any HTTP-backed
+// tools configured in HTTP_TOOLS, and a tool for each metric of the dbt
+// manifest at DBT_MANIFEST_PATH. Batches of tool
+// calls run TOOL_PARALLELISM calls at a time (default 4), each bounded by
+// TOOL_CALL_TIMEOUT when set. Every call is counted in ToolStats.
+func NewToolEngine(dbConn *database.Connection) (*ToolEngine, error) {
 	engine := &ToolEngine{
-		registry: types.NewToolRegistry(),
+		registry:     types.NewToolRegistry(),
+		schema:       tools.NewDatabaseSchemaTool(dbConn),
+		savedQueries: tools.NewSavedQueryRunTool(dbConn),
+		columnRules:  tools.NewColumnValidateTool(dbConn),
+		quality:      tools.NewQualityScorecardTool(),
+		estimate:     tools.NewDatabaseEstimateTool(dbConn),
+		artifacts:    tools.NewArtifactCreateTool(dbConn),
+		diff:         tools.NewQueryDiffTool(dbConn),
+		semantic:     tools.NewSemanticSearchTool(dbConn),
+		crossJoin:    tools.NewCrossDatabaseJoinTool(dbConn),
+		stats:        newToolStats(),
+	}
+
+	parallelism, timeout := 4, time.Duration(0)
+	if value, err := strconv.Atoi(os.Getenv("TOOL_PARALLELISM")); err == nil && value > 0 {
+		parallelism = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("TOOL_CALL_TIMEOUT")); err == nil && value > 0 {
+		timeout = value
 	}
+	engine.registry.SetConcurrency(parallelism, timeout)
+	engine.registry.SetCallContext(func(ctx context.Context, call types.ToolCall) context.Context {
+		return callContext(withMetadata(ctx, call.Metadata))
+	})
+	engine.registry.SetObserver(engine.stats.observe)
 
-	engine.registerTools(dbConn)
+	if err := engine.registerTools(dbConn); err != nil {
+		return nil, err
+	}
 
-	return engine
+	return engine, nil
 }
 
-// registerTools registers all available tools with the tool registry.
-func (te *ToolEngine) registerTools(dbConn *database.Connection) {
-	te.registry.RegisterTool("database_query", tools.NewDatabaseQueryTool(dbConn))
+// registerTools registers the enabled built-in, MongoDB, HTTP-backed,
+// remote metric, and dbt metric tools with the tool registry. No tool may
+// reuse another's name.
+func (te *ToolEngine) registerTools(dbConn *database.Connection) error {
+	available := map[string]types.ToolExecutor{
+		"database_query":    tools.NewDatabaseQueryTool(dbConn),
+		"chart_render":      tools.NewChartRenderTool(dbConn),
+		"table_profile":     tools.NewTableProfileTool(dbConn),
+		"database_explain":  tools.NewDatabaseExplainTool(dbConn),
+		"database_estimate": te.estimate,
+		"database_schema":   te.schema,
+		"saved_query_run":   te.savedQueries,
+		"column_validate":   te.columnRules,
+		"quality_scorecard": te.quality,
+		"artifact_create":   te.artifacts,
+		"query_diff":        te.diff,
+		"calculate":         tools.NewCalculateTool(),
+	}
+
+	calendars, err := calendar.FromEnv()
+	if err != nil {
+		return err
+	}
+	available["date_range"] = tools.NewDateRangeTool(calendars)
+
+	semanticConfig, err := semantic.ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	if semanticConfig != nil {
+		te.semantic.SetColumns(semanticConfig.Columns)
+		available["semantic_search"] = te.semantic
+	}
+
+	databaseConfigs, err := catalog.ConfigsFromEnv()
+	if err != nil {
+		return err
+	}
+	if len(databaseConfigs) > 0 {
+		databases := catalog.Databases(databaseConfigs)
+		maxRows := tools.DefaultStagingRows
+		if value, err := strconv.Atoi(os.Getenv("CROSS_DATABASE_MAX_ROWS")); err == nil && value > 0 {
+			maxRows = value
+		}
+		te.crossJoin.SetDatabases(databases, maxRows)
+		available["cross_database_join"] = te.crossJoin
+	}
+
+	mongoConfig, err := mongodb.ConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	if mongoConfig != nil {
+		client, err := mongodb.Connect(context.Background(), mongoConfig)
+		if err != nil {
+			return err
+		}
+		available["mongo_find"] = tools.NewMongoFindTool(dbConn, client)
+		available["mongo_aggregate"] = tools.NewMongoAggregateTool(dbConn, client)
+	}
+
+	if raw := os.Getenv("HTTP_TOOLS"); raw != "" {
+		configs, err := tools.ParseHTTPTools(raw)
+		if err != nil {
+			return err
+		}
+		for _, config := range configs {
+			if _, exists := available[config.Name]; exists {
+				return fmt.Errorf("http tool %s: a tool with that name is already registered", config.Name)
+			}
+			tool, err := tools.NewHTTPTool(config)
+			if err != nil {
+				return err
+			}
+			available[config.Name] = tool
+		}
+	}
+
+	if raw := os.Getenv("REMOTE_METRICS"); raw != "" {
+		configs, err := tools.ParseRemoteMetrics(raw)
+		if err != nil {
+			return err
+		}
+		for _, config := range configs {
+			tool, err := tools.NewRemoteMetricTool(dbConn, config)
+			if err != nil {
+				return err
+			}
+			if _, exists := available[tool.Name()]; exists {
+				return fmt.Errorf("remote metric %s: a tool named %s is already registered", config.Name, tool.Name())
+			}
+			available[tool.Name()] = tool
+		}
+	}
+
+	metrics, err := dbt.LoadFromEnv()
+	if err != nil {
+		return err
+	}
+	for _, metric := range metrics {
+		tool := tools.NewMetricTool(dbConn, metric)
+		if _, exists := available[tool.Name()]; exists {
+			return fmt.Errorf("dbt metric %s: a tool named %s is already registered", metric.Name, tool.Name())
+		}
+		available[tool.Name()] = tool
+		te.metrics = append(te.metrics, tool)
+	}
+
+	for name, executor := range available {
+		if ToolEnabled(name) {
+			if err := te.registry.RegisterTool(name, executor); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ToolEnabled reports whether a tool is listed in TOOLS_ENABLED, a
+// comma-separated list of tool names. Every tool is enabled when it is unset.
+func ToolEnabled(name string) bool {
+	enabled := os.Getenv("TOOLS_ENABLED")
+	if enabled == "" {
+		return true
+	}
+	for _, tool := range strings.Split(enabled, ",") {
+		if strings.TrimSpace(tool) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAuthorizer enforces access control on every tool call made through the
+// engine. An authorizer that can also hide tables and columns filters what
+// database_schema describes.
+func (te *ToolEngine) SetAuthorizer(authorizer types.Authorizer) {
+	te.registry.SetAuthorizer(authorizer)
+	te.savedQueries.SetAuthorizer(authorizer)
+	te.crossJoin.SetAuthorizer(authorizer)
+	te.diff.SetAuthorizer(authorizer)
+	for _, metric := range te.metrics {
+		metric.SetAuthorizer(authorizer)
+	}
+	if filter, ok := authorizer.(types.SchemaFilter); ok {
+		te.schema.SetFilter(filter)
+		te.quality.SetFilter(filter)
+		te.semantic.SetFilter(filter)
+	}
+}
+
+// SetSavedQueries sets the store saved_query_run looks queries up in.
+func (te *ToolEngine) SetSavedQueries(store *savedqueries.Store) {
+	te.savedQueries.SetStore(store)
+}
+
+// SetColumnRules sets the column rules column_validate checks by default.
+func (te *ToolEngine) SetColumnRules(rules []dictionary.Rule) {
+	te.columnRules.SetRules(rules)
 }
 
-// ExecuteTools executes multiple tool calls and returns their results.
-func (te *ToolEngine) ExecuteTools(toolCalls []types.ToolCall) []types.ToolResult {
-	return te.registry.ExecuteTools(toolCalls)
+// SetQualityRules sets the store quality_scorecard reads rule results from.
+func (te *ToolEngine) SetQualityRules(store *quality.Store) {
+	te.quality.SetStore(store)
+}
+
+// SetJobs sets the manager database_estimate queues exact queries with.
+func (te *ToolEngine) SetJobs(manager *jobs.Manager) {
+	te.estimate.SetJobs(manager)
+}
+
+// SetArtifacts sets the store artifact_create saves files in and
+// query_diff reads snapshots from.
+func (te *ToolEngine) SetArtifacts(store *artifacts.Store) {
+	te.artifacts.SetStore(store)
+	te.diff.SetStore(store)
+}
+
+// SetSnapshots sets the store of snapshot tables query_diff compares
+// with.
+func (te *ToolEngine) SetSnapshots(store *snapshots.Store) {
+	te.diff.SetSnapshots(store)
+}
+
+// SetDatabases sets the named databases cross_database_join queries.
+func (te *ToolEngine) SetDatabases(c *catalog.Catalog) {
+	te.crossJoin.SetCatalog(c)
+}
+
+// SetSemanticIndex sets the index semantic_search searches.
+func (te *ToolEngine) SetSemanticIndex(index *semantic.Index) {
+	te.semantic.SetIndex(index)
+}
+
+// ExecuteTools executes multiple tool calls and returns their results, each
+// stamped with the request ID from ctx.
+func (te *ToolEngine) ExecuteTools(ctx context.Context, toolCalls []types.ToolCall) []types.ToolResult {
+	ctx, span := tracer.Start(ctx, "tool.execute_batch", trace.WithAttributes(
+		attribute.Int("tool.count", len(toolCalls)),
+	))
+	defer span.End()
+
+	results := te.registry.ExecuteTools(ctx, toolCalls)
+	for i := range results {
+		results[i].RequestID = requestid.FromContext(ctx)
+		redactResult(&results[i])
+	}
+	return results
+}
+
+// ExecuteCall executes a tool call like ExecuteTool, adding the call's
+// metadata (conversation, turn, and locale) to the CallContext the tool sees.
+func (te *ToolEngine) ExecuteCall(ctx context.Context, call types.ToolCall) (*types.ToolResult, error) {
+	return te.ExecuteTool(withMetadata(ctx, call.Metadata), call.Name, call.Input)
 }
 
 // ExecuteTool executes a single tool by name with the provided input parameters.
-func (te *ToolEngine) ExecuteTool(name string, input map[string]interface{}) (*types.ToolResult, error) {
-	return te.registry.ExecuteTool(name, input)
+// Each execution is traced as a "tool.execute" span, and the result is stamped
+// with the request ID from ctx. Secrets are redacted from errors.
+func (te *ToolEngine) ExecuteTool(ctx context.Context, name string, input map[string]interface{}) (*types.ToolResult, error) {
+	ctx, span := tracer.Start(ctx, "tool.execute", trace.WithAttributes(
+		attribute.String("tool.name", name),
+	))
+	ctx = callContext(ctx)
+	cc := types.CallContextFrom(ctx)
+	span.SetAttributes(attribute.String("enduser.id", cc.UserID))
+	if cc.ConversationID != "" {
+		span.SetAttributes(attribute.String("chat.conversation_id", cc.ConversationID))
+	}
+	if cc.TurnID != "" {
+		span.SetAttributes(attribute.String("chat.turn_id", cc.TurnID))
+	}
+	result, err := te.registry.ExecuteTool(ctx, name, input)
+	err = redact.Error(err)
+	if result != nil {
+		result.RequestID = requestid.FromContext(ctx)
+		redactResult(result)
+	}
+
+	// Tool errors are results, not Go errors, but still mark the span as failed
+	spanErr := err
+	if spanErr == nil && result != nil && result.IsError && result.Error != nil {
+		span.SetAttributes(attribute.String("tool.error_type", result.Error.Code))
+		spanErr = errors.New(result.Error.Message)
+	}
+	telemetry.EndSpan(span, spanErr)
+	return result, err
+}
+
+// CheckTool validates a tool call without executing it, returning the error
+// result ExecuteTool would give for a disabled, forbidden, or invalid call,
+// or nil when the call would run.
+func (te *ToolEngine) CheckTool(ctx context.Context, name string, input map[string]interface{}) (*types.ToolResult, error) {
+	result, err := te.registry.CheckTool(callContext(ctx), name, input)
+	if result != nil {
+		result.RequestID = requestid.FromContext(ctx)
+	}
+	return result, err
+}
+
+// withMetadata returns ctx with the non-empty values of a tool call's
+// metadata in its CallContext. The caller's identity and trace are not
+// taken from metadata; callContext sets them.
+func withMetadata(ctx context.Context, metadata map[string]interface{}) context.Context {
+	cc, md := types.CallContextFrom(ctx), types.CallContextFromMetadata(metadata)
+	if md.ConversationID != "" {
+		cc.ConversationID = md.ConversationID
+	}
+	if md.TurnID != "" {
+		cc.TurnID = md.TurnID
+	}
+	if md.Locale != "" {
+		cc.Locale = md.Locale
+	}
+	if md.CacheControl != "" {
+		cc.CacheControl = md.CacheControl
+	}
+	if md.Database != "" {
+		cc.Database = md.Database
+	}
+	if md.TraceID != "" && cc.TraceID == "" {
+		cc.TraceID = md.TraceID
+	}
+	return types.WithCallContext(ctx, cc)
 }
 
-// GetAvailableTools returns definitions for all registered tools.
+// callContext completes the CallContext in ctx with the authenticated caller
+// and the active trace. Identity always comes from authentication, so a
+// call cannot claim to be made by someone else.
+func callContext(ctx context.Context) context.Context {
+	cc := types.CallContextFrom(ctx)
+	cc.UserID, cc.Roles = auth.UserID(ctx), nil
+	if user := auth.UserFromContext(ctx); user != nil {
+		cc.Roles = user.Roles
+	}
+	if span := trace.SpanContextFromContext(ctx); span.HasTraceID() {
+		cc.TraceID = span.TraceID().String()
+	}
+	return types.WithCallContext(ctx, cc)
+}
+
+// GetAvailableTools returns definitions for all enabled tools.
 func (te *ToolEngine) GetAvailableTools() []types.ToolDefinition {
 	return te.registry.ListTools()
 }
+
+// SetToolEnabled enables or disables a registered tool at runtime.
+func (te *ToolEngine) SetToolEnabled(name string, enabled bool) error {
+	return te.registry.SetEnabled(name, enabled)
+}
+
+// IsToolEnabled reports whether a tool is registered and not disabled.
+func (te *ToolEngine) IsToolEnabled(name string) bool {
+	return te.registry.Enabled(name)
+}
+
+// ToolStatuses lists every registered tool and whether it is enabled.
+func (te *ToolEngine) ToolStatuses() []types.ToolStatus {
+	return te.registry.Statuses()
+}
+
+// ToolStats reports the calls made to each tool since the server started:
+// how many, how many failed, their latency percentiles, and the rows they
+// returned. Registered tools not called yet are listed with zero calls.
+func (te *ToolEngine) ToolStats() []ToolStats {
+	return te.stats.snapshot(te.registry.Statuses())
+}
+
+// redactResult removes secrets, such as a connection string echoed by a
+// driver, from the text of an error result.
+func redactResult(result *types.ToolResult) {
+	if !result.IsError {
+		return
+	}
+	for i := range result.Content {
+		result.Content[i].Text = redact.String(result.Content[i].Text)
+	}
+	if result.Error != nil {
+		result.Error.Message = redact.String(result.Error.Message)
+	}
+}
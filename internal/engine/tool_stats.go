@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"bytes"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"data-chatter/internal/types"
+)
+
+// latencySamples bounds the latencies kept per tool for its percentiles.
+const latencySamples = 1024
+
+// ToolStats describes the calls made to one tool since the server started.
+// Rows sums the row_count its results report, which for the query tools is
+// the rows they returned.
+type ToolStats struct {
+	Name      string  `json:"name"`
+	Calls     int64   `json:"calls"`
+	Errors    int64   `json:"errors"`
+	ErrorRate float64 `json:"error_rate"`
+	Rows      int64   `json:"rows"`
+
+	// P50Ms and P95Ms are latency percentiles in milliseconds, over the
+	// tool's last 1024 calls.
+	P50Ms float64 `json:"p50_ms"`
+	P95Ms float64 `json:"p95_ms"`
+}
+
+// toolStats counts calls to each tool, as the tool registry's observer.
+type toolStats struct {
+	mu    sync.Mutex
+	tools map[string]*toolCounter
+}
+
+// toolCounter holds one tool's counts, and its latest latencies in a ring.
+type toolCounter struct {
+	calls, errors, rows int64
+	latencies           []time.Duration
+	next                int
+}
+
+func newToolStats() *toolStats {
+	return &toolStats{tools: make(map[string]*toolCounter)}
+}
+
+// observe counts a call to the tool called name. A Go error or an error
+// result counts as an error.
+func (s *toolStats) observe(name string, result *types.ToolResult, err error, elapsed time.Duration) {
+	failed := err != nil || result == nil || result.IsError
+	var rows int64
+	if !failed {
+		rows = resultRows(result)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counter := s.tools[name]
+	if counter == nil {
+		counter = &toolCounter{}
+		s.tools[name] = counter
+	}
+	counter.calls++
+	if failed {
+		counter.errors++
+	}
+	counter.rows += rows
+	if len(counter.latencies) < latencySamples {
+		counter.latencies = append(counter.latencies, elapsed)
+	} else {
+		counter.latencies[counter.next] = elapsed
+		counter.next = (counter.next + 1) % latencySamples
+	}
+}
+
+// snapshot returns the stats of the registered tools, sorted by name.
+func (s *toolStats) snapshot(registered []types.ToolStatus) []ToolStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := make([]ToolStats, 0, len(registered))
+	for _, tool := range registered {
+		name, counter := tool.Name, s.tools[tool.Name]
+		if counter == nil {
+			stats = append(stats, ToolStats{Name: name})
+			continue
+		}
+		latencies := slices.Clone(counter.latencies)
+		slices.Sort(latencies)
+		stats = append(stats, ToolStats{
+			Name:      name,
+			Calls:     counter.calls,
+			Errors:    counter.errors,
+			ErrorRate: float64(counter.errors) / float64(counter.calls),
+			Rows:      counter.rows,
+			P50Ms:     percentile(latencies, 0.50),
+			P95Ms:     percentile(latencies, 0.95),
+		})
+	}
+	return stats
+}
+
+// percentile returns the nearest-rank percentile p of sorted latencies in
+// milliseconds, or 0 when there are none.
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(float64(len(sorted))*p+0.5) - 1
+	rank = min(max(rank, 0), len(sorted)-1)
+	return float64(sorted[rank].Microseconds()) / 1000
+}
+
+// resultRows returns the row_count of a tool's tabular result, or 0 for a
+// result without one. Tools write row_count after the rows, so it is found
+// from the end rather than by decoding what may be a large result.
+func resultRows(result *types.ToolResult) int64 {
+	var rows int64
+	for _, content := range result.Content {
+		text := []byte(content.Text)
+		i := bytes.LastIndex(text, []byte(`"row_count":`))
+		if i < 0 {
+			continue
+		}
+		digits := bytes.TrimLeft(text[i+len(`"row_count":`):], " ")
+		end := 0
+		for end < len(digits) && digits[end] >= '0' && digits[end] <= '9' {
+			end++
+		}
+		if n, err := strconv.ParseInt(string(digits[:end]), 10, 64); err == nil {
+			rows += n
+		}
+	}
+	return rows
+}
@@ -0,0 +1,66 @@
+// Package env reads settings from environment variables with fallback
+// defaults. Unset and empty variables use the default, as do values that
+// do not parse.
+package env
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Get retrieves an environment variable with a fallback default value.
+func Get(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// Int retrieves an environment variable as an integer with a fallback default value.
+func Int(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+// Float retrieves an environment variable as a float with a fallback default value.
+func Float(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(value, 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
+
+// Duration retrieves an environment variable as a duration (e.g. "30s"),
+// falling back to the default when unset or invalid.
+func Duration(key string, defaultValue time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// List retrieves a comma-separated environment variable as a list,
+// skipping empty items, with a fallback default value.
+func List(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,263 @@
+// Package eval runs golden-query suites: natural-language questions paired
+// with the SQL, or the rows, that answer them. Each question is put through
+// the full chat pipeline and its answer is scored against the expected
+// result, so prompt and model changes can be regression-tested by accuracy.
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Case outcomes.
+const (
+	StatusPass  = "pass"  // The answer's results include the expected rows
+	StatusFail  = "fail"  // The answer's results do not
+	StatusError = "error" // The question or the expected SQL could not be run
+)
+
+// Case is one golden question. The expected result is given as rows, or as
+// SQL that is run to get them; when both are set, rows are used and the SQL
+// only counts towards exact SQL matches.
+type Case struct {
+	ID       string          `json:"id" yaml:"id"`
+	Question string          `json:"question" yaml:"question"`
+	SQL      string          `json:"sql,omitempty" yaml:"sql"`
+	Rows     [][]interface{} `json:"rows,omitempty" yaml:"rows"`
+
+	// Ordered requires the rows in the expected order, for questions such as
+	// "top 5 customers by revenue".
+	Ordered bool     `json:"ordered,omitempty" yaml:"ordered"`
+	Tags    []string `json:"tags,omitempty" yaml:"tags"`
+}
+
+// Suite is a named list of cases.
+type Suite struct {
+	Name  string `json:"name" yaml:"name"`
+	Cases []Case `json:"cases" yaml:"cases"`
+}
+
+// Load reads a suite from a .json, .yaml, or .yml file. Cases without an ID
+// are numbered from 1.
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suite: %w", err)
+	}
+
+	var suite Suite
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&suite)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&suite)
+	default:
+		return nil, fmt.Errorf("unsupported suite file %s: use .json, .yaml, or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if suite.Name == "" {
+		suite.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	seen := make(map[string]bool)
+	for i := range suite.Cases {
+		c := &suite.Cases[i]
+		if c.ID == "" {
+			c.ID = fmt.Sprint(i + 1)
+		}
+		switch {
+		case seen[c.ID]:
+			return nil, fmt.Errorf("%s: case %s is defined twice", path, c.ID)
+		case strings.TrimSpace(c.Question) == "":
+			return nil, fmt.Errorf("%s: case %s has no question", path, c.ID)
+		case strings.TrimSpace(c.SQL) == "" && c.Rows == nil:
+			return nil, fmt.Errorf("%s: case %s needs sql or rows", path, c.ID)
+		}
+		for _, row := range c.Rows {
+			if len(row) != len(c.Rows[0]) {
+				return nil, fmt.Errorf("%s: the rows of case %s differ in length", path, c.ID)
+			}
+		}
+		seen[c.ID] = true
+	}
+	return &suite, nil
+}
+
+// Result is a query's result set, with each row's values in column order.
+type Result struct {
+	SQL     string          `json:"sql,omitempty"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// Answer is the pipeline's answer to a question.
+type Answer struct {
+	Message string   `json:"message"`
+	Results []Result `json:"results"`
+}
+
+// Pipeline answers questions and runs the expected SQL of cases.
+type Pipeline interface {
+	// Ask answers question through the chat agent.
+	Ask(ctx context.Context, question string) (Answer, error)
+
+	// Query runs sql directly, without the agent.
+	Query(ctx context.Context, sql string) (Result, error)
+}
+
+// Outcome is how one case fared.
+type Outcome struct {
+	ID         string   `json:"id"`
+	Question   string   `json:"question"`
+	Tags       []string `json:"tags,omitempty"`
+	Status     string   `json:"status"`
+	Reason     string   `json:"reason,omitempty"` // Why the case failed or errored
+	SQLMatch   bool     `json:"sql_match"`        // Some query of the answer is the expected SQL, ignoring case and spacing
+	SQL        []string `json:"sql,omitempty"`    // The queries the answer ran
+	Message    string   `json:"message,omitempty"`
+	DurationMs int64    `json:"duration_ms"`
+}
+
+// Score counts the outcomes of a group of cases.
+type Score struct {
+	Total      int     `json:"total"`
+	Passed     int     `json:"passed"`
+	Failed     int     `json:"failed"`
+	Errors     int     `json:"errors"`
+	SQLMatches int     `json:"sql_matches"`
+	Accuracy   float64 `json:"accuracy"` // Passed over total, from 0 to 1
+}
+
+// add counts outcome.
+func (s *Score) add(outcome Outcome) {
+	s.Total++
+	switch outcome.Status {
+	case StatusPass:
+		s.Passed++
+	case StatusFail:
+		s.Failed++
+	default:
+		s.Errors++
+	}
+	if outcome.SQLMatch {
+		s.SQLMatches++
+	}
+	s.Accuracy = float64(s.Passed) / float64(s.Total)
+}
+
+// Report is the result of running a suite.
+type Report struct {
+	Suite      string           `json:"suite"`
+	StartedAt  time.Time        `json:"started_at"`
+	DurationMs int64            `json:"duration_ms"`
+	Score                       // Over every case
+	Tags       map[string]Score `json:"tags,omitempty"`
+	Cases      []Outcome        `json:"cases"`
+}
+
+// Run puts every case of suite through pipeline, parallel cases at a time,
+// and reports the outcomes in suite order.
+func Run(ctx context.Context, suite *Suite, pipeline Pipeline, parallel int) *Report {
+	report := &Report{Suite: suite.Name, StartedAt: time.Now().UTC(), Cases: make([]Outcome, len(suite.Cases))}
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, parallel)
+	for i, c := range suite.Cases {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			start := time.Now()
+			outcome := runCase(ctx, c, pipeline)
+			outcome.DurationMs = time.Since(start).Milliseconds()
+			report.Cases[i] = outcome
+		}()
+	}
+	wg.Wait()
+
+	for _, outcome := range report.Cases {
+		report.Score.add(outcome)
+		for _, tag := range outcome.Tags {
+			if report.Tags == nil {
+				report.Tags = make(map[string]Score)
+			}
+			score := report.Tags[tag]
+			score.add(outcome)
+			report.Tags[tag] = score
+		}
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report
+}
+
+// runCase asks c's question and scores the answer.
+func runCase(ctx context.Context, c Case, pipeline Pipeline) Outcome {
+	outcome := Outcome{ID: c.ID, Question: c.Question, Tags: c.Tags}
+
+	expected := c.Rows
+	if expected == nil {
+		result, err := pipeline.Query(ctx, c.SQL)
+		if err != nil {
+			outcome.Status = StatusError
+			outcome.Reason = fmt.Sprintf("expected SQL failed: %v", err)
+			return outcome
+		}
+		expected = result.Rows
+	}
+
+	answer, err := pipeline.Ask(ctx, c.Question)
+	if err != nil {
+		outcome.Status = StatusError
+		outcome.Reason = err.Error()
+		return outcome
+	}
+	outcome.Message = answer.Message
+	for _, result := range answer.Results {
+		outcome.SQL = append(outcome.SQL, result.SQL)
+		if c.SQL != "" && normalizeSQL(result.SQL) == normalizeSQL(c.SQL) {
+			outcome.SQLMatch = true
+		}
+	}
+
+	outcome.Status = StatusFail
+	if len(answer.Results) == 0 {
+		outcome.Reason = "the answer ran no queries"
+		return outcome
+	}
+	var reasons []string
+	for _, result := range answer.Results {
+		reason := match(expected, result, c.Ordered)
+		if reason == "" {
+			outcome.Status = StatusPass
+			return outcome
+		}
+		reasons = append(reasons, reason)
+	}
+	outcome.Reason = strings.Join(reasons, "; ")
+	return outcome
+}
+
+// normalizeSQL lowercases sql and collapses its whitespace, dropping a
+// trailing semicolon.
+func normalizeSQL(sql string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.Join(strings.Fields(sql), " ")), ";")
+}
@@ -0,0 +1,159 @@
+package eval
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// match reports why result does not hold the expected rows, or "" when it
+// does. Column names are ignored and the result may have extra columns, as
+// long as each expected column's values are in a column of its own; rows are
+// compared as a multiset unless ordered is set. Values match by their
+// canonical form, so 42, 42.0, and "42" are equal.
+func match(expected [][]interface{}, result Result, ordered bool) string {
+	if len(result.Rows) != len(expected) {
+		return fmt.Sprintf("%d rows, expected %d", len(result.Rows), len(expected))
+	}
+	if len(expected) == 0 {
+		return ""
+	}
+	width := len(expected[0])
+	if len(result.Columns) < width {
+		return fmt.Sprintf("%d columns, expected at least %d", len(result.Columns), width)
+	}
+
+	want := canonicalRows(expected)
+	got := canonicalRows(result.Rows)
+
+	// Candidate result columns for each expected column: those holding the
+	// same values, whatever their order
+	candidates := make([][]int, width)
+	for i := range width {
+		wantValues := sortedColumn(want, i)
+		for j := range result.Columns {
+			if slices.Equal(wantValues, sortedColumn(got, j)) {
+				candidates[i] = append(candidates[i], j)
+			}
+		}
+		if len(candidates[i]) == 0 {
+			return fmt.Sprintf("no column has the values of expected column %d", i+1)
+		}
+	}
+
+	wantKeys := rowKeys(want, identity(width), ordered)
+	assigned := make([]int, width)
+	used := make(map[int]bool)
+	var assign func(i int) bool
+	assign = func(i int) bool {
+		if i == width {
+			return slices.Equal(wantKeys, rowKeys(got, assigned, ordered))
+		}
+		for _, j := range candidates[i] {
+			if used[j] {
+				continue
+			}
+			used[j] = true
+			assigned[i] = j
+			if assign(i + 1) {
+				return true
+			}
+			used[j] = false
+		}
+		return false
+	}
+	if assign(0) {
+		return ""
+	}
+	if ordered {
+		return "the rows differ or are out of order"
+	}
+	return "the rows differ"
+}
+
+// canonicalRows returns rows with every value in canonical form.
+func canonicalRows(rows [][]interface{}) [][]string {
+	canonical := make([][]string, len(rows))
+	for i, row := range rows {
+		canonical[i] = make([]string, len(row))
+		for j, value := range row {
+			canonical[i][j] = canonicalValue(value)
+		}
+	}
+	return canonical
+}
+
+// canonicalValue formats value so equal values of different types, as
+// decoded from JSON, YAML, and drivers, compare equal. Numbers keep 10
+// significant digits, so computed averages match across databases.
+func canonicalValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		return strconv.FormatBool(v)
+	case int:
+		return canonicalNumber(float64(v))
+	case int64:
+		return canonicalNumber(float64(v))
+	case float64:
+		return canonicalNumber(v)
+	case time.Time:
+		if v.Equal(v.Truncate(24 * time.Hour)) {
+			return v.Format(time.DateOnly)
+		}
+		return v.UTC().Format(time.RFC3339)
+	}
+	text := strings.TrimSpace(fmt.Sprint(value))
+	if number, err := strconv.ParseFloat(text, 64); err == nil && !math.IsInf(number, 0) && !math.IsNaN(number) {
+		return canonicalNumber(number)
+	}
+	return text
+}
+
+// canonicalNumber formats n with 10 significant digits.
+func canonicalNumber(n float64) string {
+	if n == 0 {
+		return "0" // Not -0
+	}
+	return strconv.FormatFloat(n, 'g', 10, 64)
+}
+
+// sortedColumn returns the values of column j of rows, sorted.
+func sortedColumn(rows [][]string, j int) []string {
+	values := make([]string, len(rows))
+	for i, row := range rows {
+		values[i] = row[j]
+	}
+	slices.Sort(values)
+	return values
+}
+
+// rowKeys returns a key for each row made of its values in columns, sorted
+// unless ordered is set.
+func rowKeys(rows [][]string, columns []int, ordered bool) []string {
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		values := make([]string, len(columns))
+		for k, j := range columns {
+			values[k] = strconv.Quote(row[j])
+		}
+		keys[i] = strings.Join(values, ",")
+	}
+	if !ordered {
+		slices.Sort(keys)
+	}
+	return keys
+}
+
+// identity returns the column indexes 0 to width-1.
+func identity(width int) []int {
+	columns := make([]int, width)
+	for i := range columns {
+		columns[i] = i
+	}
+	return columns
+}
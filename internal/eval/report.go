@@ -0,0 +1,81 @@
+package eval
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// LoadReport reads a report saved as JSON, such as the baseline run a new
+// one is compared with.
+func LoadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if report.Cases == nil {
+		return nil, errors.New(path + " is not an eval report")
+	}
+	return &report, nil
+}
+
+// Regressions returns the IDs of cases that passed in baseline but not in
+// report, in report order.
+func Regressions(baseline, report *Report) []string {
+	passed := make(map[string]bool)
+	for _, outcome := range baseline.Cases {
+		passed[outcome.ID] = outcome.Status == StatusPass
+	}
+	var regressed []string
+	for _, outcome := range report.Cases {
+		if passed[outcome.ID] && outcome.Status != StatusPass {
+			regressed = append(regressed, outcome.ID)
+		}
+	}
+	return regressed
+}
+
+// WriteText writes the report for reading in a terminal: a line for each
+// case, then the score for each tag and for the suite.
+func WriteText(w io.Writer, report *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, outcome := range report.Cases {
+		fmt.Fprintf(tw, "%s\t%s\t%.1fs\t%s\n", strings.ToUpper(outcome.Status), outcome.ID, float64(outcome.DurationMs)/1000, outcome.Reason)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.Tags) > 0 {
+		fmt.Fprintln(w)
+		tags := make([]string, 0, len(report.Tags))
+		for tag := range report.Tags {
+			tags = append(tags, tag)
+		}
+		sort.Strings(tags)
+		for _, tag := range tags {
+			fmt.Fprintf(tw, "%s\t%s\n", tag, formatScore(report.Tags[tag]))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "\n%s: %s\n", report.Suite, formatScore(report.Score))
+	return err
+}
+
+// formatScore describes a score in one line.
+func formatScore(score Score) string {
+	return fmt.Sprintf("%.1f%% accuracy (%d/%d passed, %d failed, %d errors), %d exact SQL matches",
+		score.Accuracy*100, score.Passed, score.Total, score.Failed, score.Errors, score.SQLMatches)
+}
@@ -0,0 +1,252 @@
+// Package events provides an in-process publish/subscribe bus for chat turn
+// progress, used to stream tool execution status to clients.
+package events
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Event types published during a chat turn. The summary events follow
+// turn_finished on turns that asked for a narrative summary.
+const (
+	TurnStarted     = "turn_started"
+	ToolStarted     = "tool_started"
+	RowsFetched     = "rows_fetched"
+	ToolFinished    = "tool_finished"
+	TurnFinished    = "turn_finished"
+	SummaryDelta    = "summary_delta"
+	SummaryFinished = "summary_finished"
+)
+
+// historyLimit bounds how many events are kept per turn for late subscribers.
+const historyLimit = 100
+
+// Event is a single progress update for a chat turn.
+type Event struct {
+	Type       string    `json:"type"`
+	TurnID     string    `json:"turn_id"`
+	ToolCallID string    `json:"tool_call_id,omitempty"`
+	Tool       string    `json:"tool,omitempty"`
+	Rows       int       `json:"rows,omitempty"`
+	DurationMs int64     `json:"duration_ms,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Text       string    `json:"text,omitempty"` // summary_delta: the next piece; summary_finished: the whole summary
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// pendingTimeout is how long a subscriber waits for a turn that has not
+// started before its channel is closed.
+const pendingTimeout = 30 * time.Second
+
+// ErrNotOwner is returned when subscribing to a turn started by another user.
+var ErrNotOwner = errors.New("turn belongs to another user")
+
+// topic holds the subscribers and recent history of one turn. A topic is
+// pending until its turn starts, holding only the subscribers waiting for
+// it, each with the user it subscribed for. While holds are outstanding,
+// closing the topic is put off until the last is released.
+type topic struct {
+	started     bool
+	owner       string
+	history     []Event
+	subscribers map[chan Event]string
+	holds       int
+	closing     bool
+}
+
+// Bus fans out turn events to subscribers.
+type Bus struct {
+	mu      sync.Mutex
+	topics  map[string]*topic
+	pending time.Duration
+}
+
+// NewBus creates an empty event bus.
+func NewBus() *Bus {
+	return &Bus{
+		topics:  make(map[string]*topic),
+		pending: pendingTimeout,
+	}
+}
+
+// Start opens turnID for owner and publishes turn_started. Only started
+// turns keep history and receive events, so made-up turn IDs cannot grow
+// the bus. Subscribers waiting for the turn on behalf of another user are
+// dropped. Close must be called when the turn ends.
+func (b *Bus) Start(turnID, owner string) {
+	if turnID == "" {
+		return
+	}
+	b.mu.Lock()
+	t, exists := b.topics[turnID]
+	if !exists {
+		t = &topic{subscribers: make(map[chan Event]string)}
+		b.topics[turnID] = t
+	}
+	if !t.started {
+		t.started, t.owner = true, owner
+		for ch, user := range t.subscribers {
+			if user != owner {
+				delete(t.subscribers, ch)
+				close(ch)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	b.Publish(Event{Type: TurnStarted, TurnID: turnID})
+}
+
+// Publish delivers an event to every subscriber of its turn. Events of
+// turns that have not started are dropped. Slow subscribers drop events
+// rather than blocking the publisher.
+func (b *Bus) Publish(event Event) {
+	if event.TurnID == "" {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, exists := b.topics[event.TurnID]
+	if !exists || !t.started {
+		return
+	}
+	if len(t.history) < historyLimit {
+		t.history = append(t.history, event)
+	}
+	for ch := range t.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel of events for turnID on behalf of user,
+// starting with any events already published. A turn that has not started
+// yet is waited for, so clients can subscribe before sending their message,
+// but the channel is closed if it does not start within the pending timeout
+// or is started by another user. The channel is also closed when the turn
+// is closed or the returned cancel function is called. Subscribing to a
+// turn another user started returns ErrNotOwner.
+func (b *Bus) Subscribe(turnID, user string) (<-chan Event, func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, exists := b.topics[turnID]
+	switch {
+	case !exists:
+		t = &topic{subscribers: make(map[chan Event]string)}
+		b.topics[turnID] = t
+	case t.started && t.owner != user:
+		return nil, nil, ErrNotOwner
+	}
+	ch := make(chan Event, historyLimit+16)
+	for _, event := range t.history {
+		ch <- event
+	}
+	t.subscribers[ch] = user
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.unsubscribe(turnID, t, ch)
+	}
+	if !t.started {
+		time.AfterFunc(b.pending, func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if !t.started {
+				b.unsubscribe(turnID, t, ch)
+			}
+		})
+	}
+	return ch, cancel, nil
+}
+
+// unsubscribe closes ch and removes it from turnID's topic t, dropping the
+// topic if it is pending and no one else waits for it. Callers must hold
+// b.mu.
+func (b *Bus) unsubscribe(turnID string, t *topic, ch chan Event) {
+	if _, ok := t.subscribers[ch]; !ok {
+		return
+	}
+	delete(t.subscribers, ch)
+	close(ch)
+	if !t.started && len(t.subscribers) == 0 && b.topics[turnID] == t {
+		delete(b.topics, turnID)
+	}
+}
+
+// Hold keeps a started turn open past Close, for work that publishes after
+// the turn's request has ended. The returned function releases the hold,
+// closing the turn if Close was called meanwhile; it must be called exactly
+// once.
+func (b *Bus) Hold(turnID string) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, exists := b.topics[turnID]
+	if !exists || !t.started {
+		return func() {}
+	}
+	t.holds++
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		t.holds--
+		if t.holds == 0 && t.closing {
+			b.close(turnID, t)
+		}
+	}
+}
+
+// Close ends a turn, closing all subscriber channels and discarding its
+// history, once any holds on it are released.
+func (b *Bus) Close(turnID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	t, exists := b.topics[turnID]
+	if !exists || !t.started {
+		return
+	}
+	if t.holds > 0 {
+		t.closing = true
+		return
+	}
+	b.close(turnID, t)
+}
+
+// close closes the subscribers of turnID's topic t and drops it. Callers
+// must hold b.mu.
+func (b *Bus) close(turnID string, t *topic) {
+	for ch := range t.subscribers {
+		delete(t.subscribers, ch)
+		close(ch)
+	}
+	if b.topics[turnID] == t {
+		delete(b.topics, turnID)
+	}
+}
+
+type rowReporterKey struct{}
+
+// WithRowReporter returns a context that reports fetched row counts to fn.
+func WithRowReporter(ctx context.Context, fn func(rows int)) context.Context {
+	return context.WithValue(ctx, rowReporterKey{}, fn)
+}
+
+// ReportRows reports the number of rows fetched so far, if ctx carries a reporter.
+func ReportRows(ctx context.Context, rows int) {
+	if fn, ok := ctx.Value(rowReporterKey{}).(func(rows int)); ok {
+		fn(rows)
+	}
+}
@@ -0,0 +1,372 @@
+package external
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatAPI marks tables loaded from a paginated JSON REST endpoint rather
+// than a file. They are declared in API_SOURCES instead of registered.
+const FormatAPI = "api"
+
+const (
+	defaultAPIMaxPages = 100
+	defaultAPIRefresh  = 15 * time.Minute
+	maxAPIPageSize     = 32 << 20
+)
+
+// apiClient fetches API pages.
+var apiClient = &http.Client{Timeout: 30 * time.Second}
+
+// linkNext matches the next page's URL in a Link header.
+var linkNext = regexp.MustCompile(`<([^>]+)>\s*;[^,]*rel="?next"?`)
+
+// APISource maps a paginated JSON REST endpoint, such as a ticketing
+// system's issue list, to a table. Header values may reference environment
+// variables as ${NAME}, so tokens can stay out of the configuration file.
+type APISource struct {
+	Table   string            `json:"table" yaml:"table" toml:"table"`
+	URL     string            `json:"url" yaml:"url" toml:"url"`
+	Headers map[string]string `json:"headers,omitempty" yaml:"headers" toml:"headers"`
+
+	// Records is the dotted path to each page's array of records, such as
+	// "data.issues"; empty when the page is the array itself.
+	Records string `json:"records,omitempty" yaml:"records" toml:"records"`
+
+	// Next is the dotted path to the next page's URL, or with CursorParam to
+	// a cursor sent as that query parameter. PageParam numbers the pages from
+	// 1 instead, stopping at the first empty page. With neither, a Link
+	// header with rel="next" is followed. At most MaxPages pages are read.
+	Next        string `json:"next,omitempty" yaml:"next" toml:"next"`
+	CursorParam string `json:"cursor_param,omitempty" yaml:"cursor_param" toml:"cursor_param"`
+	PageParam   string `json:"page_param,omitempty" yaml:"page_param" toml:"page_param"`
+	MaxPages    int    `json:"max_pages,omitempty" yaml:"max_pages" toml:"max_pages"`
+
+	// Refresh is how long loaded rows are used before a query reads the
+	// endpoint again, such as "1h"; "0" loads them once.
+	Refresh string `json:"refresh,omitempty" yaml:"refresh" toml:"refresh"`
+
+	Fields []APIField `json:"fields" yaml:"fields" toml:"fields"`
+}
+
+// APIField maps a value of each record to a column.
+type APIField struct {
+	Column string `json:"column" yaml:"column" toml:"column"`
+
+	// Path is the dotted path to the value in the record, such as
+	// "fields.status.name" or "labels.0"; the column name when empty.
+	Path string `json:"path,omitempty" yaml:"path" toml:"path"`
+
+	// Type is integer, real, boolean, timestamp, or text, the default.
+	// Objects and arrays are stored as JSON text.
+	Type string `json:"type,omitempty" yaml:"type" toml:"type"`
+}
+
+// APISourcesFromEnv reads the API sources in API_SOURCES, a JSON array.
+func APISourcesFromEnv() ([]APISource, error) {
+	value := os.Getenv("API_SOURCES")
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var sources []APISource
+	if err := json.Unmarshal([]byte(value), &sources); err != nil {
+		return nil, fmt.Errorf("invalid API_SOURCES: %w", err)
+	}
+	return sources, nil
+}
+
+// columns validates the source and returns the columns of its table.
+func (a APISource) columns() ([]Column, error) {
+	if !tableName.MatchString(a.Table) || strings.HasPrefix(strings.ToLower(a.Table), "dc_") {
+		return nil, fmt.Errorf("%w: API source table %q must be letters, digits, and underscores, not starting with a digit or \"dc_\"", ErrInvalid, a.Table)
+	}
+	if !strings.HasPrefix(a.URL, "http://") && !strings.HasPrefix(a.URL, "https://") {
+		return nil, fmt.Errorf("%w: API source %s: url must be an http or https URL", ErrInvalid, a.Table)
+	}
+	if a.CursorParam != "" && a.Next == "" {
+		return nil, fmt.Errorf("%w: API source %s: cursor_param needs next, the path to the cursor", ErrInvalid, a.Table)
+	}
+	if a.PageParam != "" && a.Next != "" {
+		return nil, fmt.Errorf("%w: API source %s: use either page_param or next", ErrInvalid, a.Table)
+	}
+	if _, err := a.refresh(); err != nil {
+		return nil, err
+	}
+	if len(a.Fields) == 0 {
+		return nil, fmt.Errorf("%w: API source %s needs fields", ErrInvalid, a.Table)
+	}
+
+	columns := make([]Column, len(a.Fields))
+	seen := make(map[string]bool)
+	for i, field := range a.Fields {
+		name := strings.ToLower(field.Column)
+		if !tableName.MatchString(name) || seen[name] {
+			return nil, fmt.Errorf("%w: API source %s: column %q must be a unique name of letters, digits, and underscores", ErrInvalid, a.Table, field.Column)
+		}
+		seen[name] = true
+		switch field.Type {
+		case "":
+			field.Type = TypeText
+		case TypeInteger, TypeReal, TypeBoolean, TypeTimestamp, TypeText:
+		default:
+			return nil, fmt.Errorf("%w: API source %s: column %s has unknown type %q", ErrInvalid, a.Table, field.Column, field.Type)
+		}
+		columns[i] = Column{Name: name, Type: field.Type}
+	}
+	return columns, nil
+}
+
+// refresh returns how long loaded rows are used, 0 meaning for good.
+func (a APISource) refresh() (time.Duration, error) {
+	if a.Refresh == "" {
+		return defaultAPIRefresh, nil
+	}
+	refresh, err := time.ParseDuration(a.Refresh)
+	if err != nil || refresh < 0 {
+		return 0, fmt.Errorf("%w: API source %s: invalid refresh %q", ErrInvalid, a.Table, a.Refresh)
+	}
+	return refresh, nil
+}
+
+// apiReader reads an API source's records a page at a time.
+type apiReader struct {
+	ctx     context.Context
+	source  APISource
+	columns []Column
+	headers map[string]string
+
+	next    string // The next page's URL, or empty after the last page
+	page    int    // Number of the page in next, with PageParam
+	fetched int
+	records []interface{}
+}
+
+// openAPI fetches the first page of an API source.
+func openAPI(ctx context.Context, source APISource) (*apiReader, error) {
+	columns, err := source.columns()
+	if err != nil {
+		return nil, err
+	}
+	r := &apiReader{ctx: ctx, source: source, columns: columns, next: source.URL, page: 1,
+		headers: make(map[string]string, len(source.Headers))}
+	for key, value := range source.Headers {
+		r.headers[key] = os.ExpandEnv(value)
+	}
+	if source.PageParam != "" {
+		r.next = r.withParam(source.URL, source.PageParam, "1")
+	}
+	if err := r.fetch(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Columns returns the columns the source's fields map to.
+func (r *apiReader) Columns() []Column {
+	return r.columns
+}
+
+// Next returns the next record's mapped values, fetching pages as needed.
+func (r *apiReader) Next() ([]interface{}, error) {
+	for len(r.records) == 0 {
+		if r.next == "" {
+			return nil, io.EOF
+		}
+		if err := r.fetch(); err != nil {
+			return nil, err
+		}
+	}
+	record := r.records[0]
+	r.records = r.records[1:]
+
+	row := make([]interface{}, len(r.columns))
+	for i, field := range r.source.Fields {
+		path := field.Path
+		if path == "" {
+			path = field.Column
+		}
+		row[i] = apiValue(lookup(record, path), r.columns[i].Type)
+	}
+	return row, nil
+}
+
+// Close does nothing; each page's response is closed once read.
+func (r *apiReader) Close() error {
+	return nil
+}
+
+// fetch reads the page at r.next and works out the page after it.
+func (r *apiReader) fetch() error {
+	current := r.next
+	request, err := http.NewRequestWithContext(r.ctx, http.MethodGet, current, nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Accept", "application/json")
+	for key, value := range r.headers {
+		request.Header.Set(key, value)
+	}
+	response, err := apiClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("fetching %s returned %s: %s", request.URL.Redacted(), response.Status, strings.TrimSpace(string(body)))
+	}
+
+	decoder := json.NewDecoder(io.LimitReader(response.Body, maxAPIPageSize))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return fmt.Errorf("failed to read %s as JSON: %w", request.URL.Redacted(), err)
+	}
+	records := lookup(body, r.source.Records)
+	if records != nil {
+		list, ok := records.([]interface{})
+		if !ok {
+			return fmt.Errorf("%q in %s is not an array of records", r.source.Records, request.URL.Redacted())
+		}
+		r.records = list
+	}
+	r.fetched++
+
+	r.next = ""
+	switch {
+	case r.source.Next != "":
+		next, _ := apiValue(lookup(body, r.source.Next), TypeText).(string)
+		if next == "" {
+			break
+		}
+		if r.source.CursorParam != "" {
+			r.next = r.withParam(r.source.URL, r.source.CursorParam, next)
+		} else {
+			r.next = resolve(current, next)
+		}
+	case r.source.PageParam != "":
+		if len(r.records) > 0 {
+			r.page++
+			r.next = r.withParam(r.source.URL, r.source.PageParam, strconv.Itoa(r.page))
+		}
+	default:
+		if match := linkNext.FindStringSubmatch(response.Header.Get("Link")); match != nil {
+			r.next = resolve(current, match[1])
+		}
+	}
+
+	maxPages := r.source.MaxPages
+	if maxPages <= 0 {
+		maxPages = defaultAPIMaxPages
+	}
+	if r.next != "" && r.fetched >= maxPages {
+		slog.WarnContext(r.ctx, "API source has more pages than max_pages", "table", r.source.Table, "max_pages", maxPages)
+		r.next = ""
+	}
+	return nil
+}
+
+// withParam returns rawURL with the query parameter name set to value.
+func (r *apiReader) withParam(rawURL, name, value string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := parsed.Query()
+	query.Set(name, value)
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// resolve resolves a next-page reference, which may be relative, against
+// the page it came from.
+func resolve(base, reference string) string {
+	baseURL, err := url.Parse(base)
+	if err != nil {
+		return reference
+	}
+	resolved, err := baseURL.Parse(reference)
+	if err != nil {
+		return reference
+	}
+	return resolved.String()
+}
+
+// lookup follows a dotted path through JSON objects and arrays, returning
+// nil when any step is missing.
+func lookup(value interface{}, path string) interface{} {
+	if path == "" {
+		return value
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value = v[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// apiValue turns a decoded JSON value into one for a column of type typ.
+// Strings are left for Column.convert to parse, apart from RFC 3339
+// timestamps, which are rewritten in the layout every database reads;
+// numbers in timestamp columns are Unix seconds.
+func apiValue(value interface{}, typ string) interface{} {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		if typ == TypeTimestamp {
+			if v == "" {
+				return nil
+			}
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t.UTC().Format(timestampLayout)
+			}
+		}
+		return v
+	case json.Number:
+		switch typ {
+		case TypeInteger:
+			if i, err := v.Int64(); err == nil {
+				return i
+			}
+			f, _ := v.Float64()
+			return int64(f)
+		case TypeReal:
+			f, _ := v.Float64()
+			return f
+		case TypeBoolean:
+			return v.String() != "0"
+		case TypeTimestamp:
+			f, _ := v.Float64()
+			return time.Unix(int64(f), 0).UTC().Format(timestampLayout)
+		}
+		return v.String()
+	case bool:
+		if typ == TypeText {
+			return strconv.FormatBool(v)
+		}
+		return v
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
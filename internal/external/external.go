@@ -0,0 +1,568 @@
+// Package external registers CSV, Parquet, and XLSX files, local or on S3
+// or HTTP, as tables of the connected database, so chat can query and join
+// them like any other table. A registered table is created empty with the columns of
+// the file's header or schema, so it appears in the schema at once, and its
+// rows are loaded the first time a query reads it. The registrations live in
+// the dc_external_tables table, so every replica sees the same tables.
+//
+// Paginated JSON REST endpoints are mapped to tables the same way, declared
+// in API_SOURCES rather than registered, and read again once their refresh
+// interval has passed.
+//
+// Files uploaded with POST /data/upload become tables too, loaded at once
+// since the file is not kept, and dropped after UPLOAD_TTL.
+package external
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/sqlparse"
+)
+
+// Table is where registrations are stored. Its dc_ prefix keeps it out of
+// the schema shown to users and the LLM.
+const Table = database.MetadataTablePrefix + "external_tables"
+
+// insertBatchValues caps the bind values of one multi-row INSERT, below
+// SQLite's oldest limit of 999.
+const insertBatchValues = 900
+
+var (
+	// ErrNotFound is returned for tables that are not registered.
+	ErrNotFound = errors.New("external table not found")
+
+	// ErrInvalid is returned for registrations that fail validation.
+	ErrInvalid = errors.New("invalid external table")
+)
+
+// tableName is what a table may be called: an unquoted identifier on every
+// supported database.
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ExternalTable is a file registered as a table.
+type ExternalTable struct {
+	Name string `json:"name"`
+
+	// Source is a path under EXTERNAL_FILES_DIR, an http(s) URL, or an
+	// s3://bucket/key URL; for an API source, the endpoint's URL; and for
+	// an uploaded file, "upload:" and the file's name.
+	Source string `json:"source"`
+
+	// Format is FormatCSV, FormatParquet, FormatXLSX, or FormatAPI.
+	Format string `json:"format"`
+
+	Columns   []Column  `json:"columns"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// LoadedAt is when the rows were last loaded, or nil before the first
+	// query that reads the table.
+	LoadedAt *time.Time `json:"loaded_at,omitempty"`
+	Rows     int64      `json:"rows"`
+
+	// Error is why the last load failed.
+	Error string `json:"error,omitempty"`
+
+	// ExpiresAt is when an uploaded file's table is dropped.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Store registers external tables and loads their rows into the connected
+// database.
+type Store struct {
+	conn *database.Connection
+
+	mu     sync.Mutex           // Held while loading, so a table loads once at a time
+	loaded map[string]time.Time // When tables known to be loaded were, by lower-cased name
+	apis   map[string]APISource // API sources from API_SOURCES, by lower-cased table name
+
+	uploadTTL time.Duration // How long uploaded files' tables are kept
+}
+
+// NewStore creates the registrations table if it does not exist yet.
+func NewStore(ctx context.Context, conn *database.Connection) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		name          VARCHAR(255) NOT NULL PRIMARY KEY,
+		source        TEXT NOT NULL,
+		format        VARCHAR(32) NOT NULL,
+		columns_json  TEXT NOT NULL,
+		created_by    VARCHAR(255) NOT NULL,
+		created_at    TIMESTAMP NOT NULL,
+		loaded_at     TIMESTAMP NULL,
+		row_count     BIGINT,
+		error_message TEXT
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	return &Store{conn: conn, loaded: make(map[string]time.Time), apis: make(map[string]APISource), uploadTTL: defaultUploadTTL}, nil
+}
+
+// List returns every registered table, ordered by name.
+func (s *Store) List(ctx context.Context) ([]ExternalTable, error) {
+	return s.list(ctx, nil)
+}
+
+// Get returns the registered table called name.
+func (s *Store) Get(ctx context.Context, name string) (ExternalTable, error) {
+	tables, err := s.list(ctx, []string{name})
+	if err != nil {
+		return ExternalTable{}, err
+	}
+	if len(tables) == 0 {
+		return ExternalTable{}, ErrNotFound
+	}
+	return tables[0], nil
+}
+
+// list returns the registered tables, or those called one of names when
+// names is not nil.
+func (s *Store) list(ctx context.Context, names []string) ([]ExternalTable, error) {
+	config := s.conn.Config
+	query := `SELECT name, source, format, columns_json, created_by, created_at, loaded_at, row_count, error_message
+		FROM ` + config.QuoteIdentifier(Table)
+	var args []interface{}
+	if names != nil {
+		placeholders := make([]string, len(names))
+		for i, name := range names {
+			placeholders[i] = config.Placeholder(i + 1)
+			args = append(args, name)
+		}
+		query += ` WHERE name IN (` + strings.Join(placeholders, ", ") + `)`
+	}
+	query += ` ORDER BY name`
+
+	rows, err := s.conn.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read external tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []ExternalTable
+	for rows.Next() {
+		var table ExternalTable
+		var columns string
+		var loadedAt sql.NullTime
+		var rowCount sql.NullInt64
+		var loadErr sql.NullString
+		if err := rows.Scan(&table.Name, &table.Source, &table.Format, &columns, &table.CreatedBy, &table.CreatedAt,
+			&loadedAt, &rowCount, &loadErr); err != nil {
+			return nil, fmt.Errorf("failed to scan external table: %w", err)
+		}
+		if err := json.Unmarshal([]byte(columns), &table.Columns); err != nil {
+			return nil, fmt.Errorf("failed to read columns of external table %s: %w", table.Name, err)
+		}
+		if loadedAt.Valid {
+			table.LoadedAt = &loadedAt.Time
+		}
+		table.Rows, table.Error = rowCount.Int64, loadErr.String
+		if isUpload(table.Source) {
+			expiresAt := table.CreatedAt.Add(s.uploadTTL)
+			table.ExpiresAt = &expiresAt
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// Register reads the columns of a file's header or schema, creates an empty
+// table with them, and saves the registration. The format is taken from the
+// source's extension when not given. The name may not be taken by another
+// table.
+func (s *Store) Register(ctx context.Context, table ExternalTable) (ExternalTable, error) {
+	table.Name, table.Source = strings.TrimSpace(table.Name), strings.TrimSpace(table.Source)
+	table.Format = strings.ToLower(strings.TrimSpace(table.Format))
+	if err := checkName(table.Name); err != nil {
+		return ExternalTable{}, err
+	}
+	if table.Source == "" {
+		return ExternalTable{}, fmt.Errorf("%w: source is required", ErrInvalid)
+	}
+	if isUpload(table.Source) {
+		return ExternalTable{}, fmt.Errorf("%w: files are uploaded with POST /data/upload", ErrInvalid)
+	}
+	if table.Format == "" {
+		table.Format = formatOf(table.Source)
+	}
+	if table.Format != FormatCSV && table.Format != FormatParquet && table.Format != FormatXLSX {
+		return ExternalTable{}, fmt.Errorf("%w: format must be %s, %s, or %s", ErrInvalid, FormatCSV, FormatParquet, FormatXLSX)
+	}
+
+	exists, err := s.conn.HasTable(ctx, table.Name)
+	if err != nil {
+		return ExternalTable{}, err
+	}
+	if exists {
+		return ExternalTable{}, fmt.Errorf("%w: a table named %s already exists", ErrInvalid, table.Name)
+	}
+
+	file, err := open(ctx, table.Source, table.Format)
+	if err != nil {
+		return ExternalTable{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	table.Columns = file.Columns()
+	file.Close()
+	return s.create(ctx, table)
+}
+
+// checkName checks a table name needs no quoting and is not a metadata
+// table's.
+func checkName(name string) error {
+	if !tableName.MatchString(name) || strings.HasPrefix(strings.ToLower(name), database.MetadataTablePrefix) {
+		return fmt.Errorf("%w: name must be letters, digits, and underscores, not starting with a digit or %q", ErrInvalid, database.MetadataTablePrefix)
+	}
+	return nil
+}
+
+// create creates an empty table with the table's columns and saves the
+// registration.
+func (s *Store) create(ctx context.Context, table ExternalTable) (ExternalTable, error) {
+	columns, err := json.Marshal(table.Columns)
+	if err != nil {
+		return ExternalTable{}, err
+	}
+	table.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	table.LoadedAt, table.Rows, table.Error = nil, 0, ""
+
+	config := s.conn.Config
+	if _, err := s.conn.DB.ExecContext(ctx, s.createTable(table)); err != nil {
+		return ExternalTable{}, fmt.Errorf("failed to create table %s: %w", table.Name, err)
+	}
+	_, err = s.conn.DB.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (name, source, format, columns_json, created_by, created_at) VALUES (%s, %s, %s, %s, %s, %s)`,
+		config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3),
+		config.Placeholder(4), config.Placeholder(5), config.Placeholder(6)),
+		table.Name, table.Source, table.Format, string(columns), table.CreatedBy, table.CreatedAt)
+	if err != nil {
+		s.dropTable(ctx, table.Name)
+		return ExternalTable{}, fmt.Errorf("failed to save external table: %w", err)
+	}
+	s.conn.InvalidateSchema()
+	return table, nil
+}
+
+// SyncAPISources makes the API source tables match sources, the contents
+// of API_SOURCES, at startup: new sources get a table, sources whose URL or
+// fields changed get theirs recreated, and tables of sources no longer
+// listed are dropped. Their rows load on the first query that reads them.
+func (s *Store) SyncAPISources(ctx context.Context, sources []APISource) error {
+	apis := make(map[string]APISource, len(sources))
+	for _, source := range sources {
+		columns, err := source.columns()
+		if err != nil {
+			return err
+		}
+		key := strings.ToLower(source.Table)
+		if _, ok := apis[key]; ok {
+			return fmt.Errorf("%w: API source table %s is listed twice", ErrInvalid, source.Table)
+		}
+		apis[key] = source
+
+		existing, err := s.Get(ctx, source.Table)
+		switch {
+		case errors.Is(err, ErrNotFound):
+		case err != nil:
+			return err
+		case existing.Format != FormatAPI:
+			return fmt.Errorf("%w: API source table %s is already registered for %s", ErrInvalid, source.Table, existing.Source)
+		case existing.Source == source.URL && slices.Equal(existing.Columns, columns):
+			continue
+		default:
+			if err := s.Delete(ctx, existing.Name); err != nil {
+				return err
+			}
+		}
+
+		exists, err := s.conn.HasTable(ctx, source.Table)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%w: API source table %s: a table with that name already exists", ErrInvalid, source.Table)
+		}
+		if _, err := s.create(ctx, ExternalTable{Name: source.Table, Source: source.URL, Format: FormatAPI,
+			Columns: columns, CreatedBy: "API_SOURCES"}); err != nil {
+			return err
+		}
+		slog.InfoContext(ctx, "API source table created", "table", source.Table, "url", source.URL)
+	}
+
+	tables, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	for _, table := range tables {
+		if _, ok := apis[strings.ToLower(table.Name)]; table.Format == FormatAPI && !ok {
+			if err := s.Delete(ctx, table.Name); err != nil {
+				return err
+			}
+			slog.InfoContext(ctx, "API source table dropped", "table", table.Name)
+		}
+	}
+
+	s.mu.Lock()
+	s.apis = apis
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete drops an external table and its registration. Tables of API
+// sources are removed from API_SOURCES instead.
+func (s *Store) Delete(ctx context.Context, name string) error {
+	table, err := s.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.apis[strings.ToLower(table.Name)]; ok {
+		return fmt.Errorf("%w: %s is an API source; remove it from API_SOURCES instead", ErrInvalid, table.Name)
+	}
+	config := s.conn.Config
+	if _, err := s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE name = %s`, config.QuoteIdentifier(Table), config.Placeholder(1)), table.Name); err != nil {
+		return fmt.Errorf("failed to delete external table: %w", err)
+	}
+	delete(s.loaded, strings.ToLower(table.Name))
+	if err := s.dropTable(ctx, table.Name); err != nil {
+		return err
+	}
+	s.conn.InvalidateSchema()
+	return nil
+}
+
+// Refresh loads an external table's rows again now, picking up changes to
+// its file or endpoint, and returns the updated registration. Uploaded
+// files are not kept, so their tables cannot be refreshed.
+func (s *Store) Refresh(ctx context.Context, name string) (ExternalTable, error) {
+	table, err := s.Get(ctx, name)
+	if err != nil {
+		return ExternalTable{}, err
+	}
+	if isUpload(table.Source) {
+		return ExternalTable{}, fmt.Errorf("%w: %s was uploaded; upload the file again instead", ErrInvalid, table.Name)
+	}
+
+	s.mu.Lock()
+	err = s.load(ctx, table, nil)
+	s.mu.Unlock()
+	if err != nil {
+		return ExternalTable{}, err
+	}
+	return s.Get(ctx, name)
+}
+
+// LoadTables loads the rows of the external tables query reads that have
+// not been loaded yet, or whose API source's refresh interval has passed.
+// It runs before every tool query, as the connection's
+// database.TableLoader. An API source that fails to refresh keeps serving
+// the rows of its last load.
+func (s *Store) LoadTables(ctx context.Context, query string) error {
+	var names []string
+	for _, name := range sqlparse.ReferencedTables(query) {
+		name = name[strings.LastIndex(name, ".")+1:]
+		if !s.isLoaded(name) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	tables, err := s.list(ctx, names)
+	if err != nil || len(tables) == 0 {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, table := range tables {
+		key := strings.ToLower(table.Name)
+		if table.LoadedAt != nil && table.Error == "" && s.fresh(key, *table.LoadedAt) {
+			// Loaded by another replica or an earlier query
+			s.loaded[key] = *table.LoadedAt
+			continue
+		}
+		if loadedAt, ok := s.loaded[key]; ok && s.fresh(key, loadedAt) {
+			continue
+		}
+		if err := s.load(ctx, table, nil); err != nil {
+			if table.Format != FormatAPI || table.Rows == 0 {
+				return err
+			}
+			// Retried once the refresh interval passes again
+			s.loaded[key] = time.Now()
+		}
+	}
+	return nil
+}
+
+// isLoaded reports whether name is an external table this process knows
+// to be loaded and fresh.
+func (s *Store) isLoaded(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(name)
+	loadedAt, ok := s.loaded[key]
+	return ok && s.fresh(key, loadedAt)
+}
+
+// fresh reports whether rows loaded at loadedAt are still to be used: always
+// for files, and within the refresh interval for API sources. The caller
+// holds s.mu.
+func (s *Store) fresh(key string, loadedAt time.Time) bool {
+	source, ok := s.apis[key]
+	if !ok {
+		return true
+	}
+	refresh, _ := source.refresh()
+	return refresh == 0 || time.Since(loadedAt) < refresh
+}
+
+// load replaces the table's rows with the file's in one transaction, so
+// queries see either the old rows or the new, and records the outcome in
+// the registration. The rows are read from file when it is not nil, and
+// from the table's source otherwise. The caller holds s.mu.
+func (s *Store) load(ctx context.Context, table ExternalTable, file rowReader) error {
+	started := time.Now()
+	rows, err := s.copyRows(ctx, table, file)
+
+	config := s.conn.Config
+	update := fmt.Sprintf(`UPDATE %s SET loaded_at = %s, row_count = %s, error_message = %s WHERE name = %s`,
+		config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3), config.Placeholder(4))
+	loadedAt := time.Now().UTC().Truncate(time.Second)
+	if err != nil {
+		slog.WarnContext(ctx, "external table could not be loaded", "table", table.Name, "source", table.Source, "error", err)
+		if _, saveErr := s.conn.DB.ExecContext(ctx, update, loadedAt, table.Rows, err.Error(), table.Name); saveErr != nil {
+			slog.WarnContext(ctx, "failed to save external table load error", "table", table.Name, "error", saveErr)
+		}
+		return fmt.Errorf("failed to load external table %s: %w", table.Name, err)
+	}
+	if _, err := s.conn.DB.ExecContext(ctx, update, loadedAt, rows, "", table.Name); err != nil {
+		return fmt.Errorf("failed to save external table load: %w", err)
+	}
+	s.loaded[strings.ToLower(table.Name)] = time.Now()
+	slog.InfoContext(ctx, "external table loaded", "table", table.Name, "rows", rows, "duration", time.Since(started))
+	return nil
+}
+
+// copyRows reads file, or the table's file or endpoint when it is nil, into
+// the table, replacing its rows, and returns how many it copied. The caller
+// holds s.mu.
+func (s *Store) copyRows(ctx context.Context, table ExternalTable, file rowReader) (int64, error) {
+	var err error
+	switch {
+	case file != nil:
+	case isUpload(table.Source):
+		return 0, fmt.Errorf("the uploaded file is no longer available; upload it again")
+	case table.Format == FormatAPI:
+		source, ok := s.apis[strings.ToLower(table.Name)]
+		if !ok {
+			return 0, fmt.Errorf("%s is no longer in API_SOURCES", table.Name)
+		}
+		file, err = openAPI(ctx, source)
+	default:
+		file, err = open(ctx, table.Source, table.Format)
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	if err := sameColumns(table.Columns, file.Columns()); err != nil {
+		return 0, err
+	}
+
+	tx, err := s.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	config := s.conn.Config
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+config.QuoteIdentifier(table.Name)); err != nil {
+		return 0, err
+	}
+
+	quoted := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		quoted[i] = config.QuoteIdentifier(column.Name)
+	}
+	insert := fmt.Sprintf(`INSERT INTO %s (%s) VALUES `, config.QuoteIdentifier(table.Name), strings.Join(quoted, ", "))
+	batchRows := max(1, insertBatchValues/len(table.Columns))
+
+	var copied int64
+	var values []string
+	var args []interface{}
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+		_, err := tx.ExecContext(ctx, insert+strings.Join(values, ", "), args...)
+		values, args = values[:0], args[:0]
+		return err
+	}
+	for {
+		row, err := file.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		copied++
+
+		placeholders := make([]string, len(row))
+		for i, value := range row {
+			converted, err := table.Columns[i].convert(value)
+			if err != nil {
+				return 0, fmt.Errorf("row %d: %w", copied, err)
+			}
+			args = append(args, converted)
+			placeholders[i] = config.Placeholder(len(args))
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+		if len(values) == batchRows {
+			if err := flush(); err != nil {
+				return 0, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return 0, err
+	}
+	return copied, tx.Commit()
+}
+
+// createTable returns the CREATE TABLE statement for the table's columns.
+func (s *Store) createTable(table ExternalTable) string {
+	config := s.conn.Config
+	columns := make([]string, len(table.Columns))
+	for i, column := range table.Columns {
+		columns[i] = config.QuoteIdentifier(column.Name) + " " + column.sqlType(config.Type)
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s)", config.QuoteIdentifier(table.Name), strings.Join(columns, ", "))
+}
+
+// dropTable drops the table holding an external table's rows.
+func (s *Store) dropTable(ctx context.Context, name string) error {
+	if _, err := s.conn.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+s.conn.Config.QuoteIdentifier(name)); err != nil {
+		return fmt.Errorf("failed to drop table %s: %w", name, err)
+	}
+	return nil
+}
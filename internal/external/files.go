@@ -0,0 +1,545 @@
+package external
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	"github.com/apache/arrow-go/v18/parquet/file"
+	"github.com/apache/arrow-go/v18/parquet/pqarrow"
+	"github.com/xuri/excelize/v2"
+)
+
+// File formats.
+const (
+	// FormatCSV is comma-separated values with a header row.
+	FormatCSV = "csv"
+
+	// FormatParquet is Apache Parquet.
+	FormatParquet = "parquet"
+
+	// FormatXLSX is an Excel workbook, of which the first sheet is read
+	// like a CSV file.
+	FormatXLSX = "xlsx"
+)
+
+// Column types.
+const (
+	TypeInteger   = "integer"
+	TypeReal      = "real"
+	TypeBoolean   = "boolean"
+	TypeTimestamp = "timestamp"
+	TypeText      = "text"
+)
+
+// csvInferRows is how many CSV or spreadsheet rows are read to infer column
+// types.
+const csvInferRows = 1000
+
+// timestampLayout is how timestamps are written to the database, a format
+// SQLite, PostgreSQL, MySQL, and DuckDB all read.
+const timestampLayout = "2006-01-02 15:04:05.999999"
+
+// nonIdentifier matches runs of characters that may not appear in a column
+// name.
+var nonIdentifier = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// Column is a column of an external table.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// sqlType returns the column's type on a database of the given type.
+func (c Column) sqlType(dbType string) string {
+	switch c.Type {
+	case TypeInteger:
+		return "BIGINT"
+	case TypeReal:
+		switch dbType {
+		case "postgres":
+			return "DOUBLE PRECISION"
+		case "mysql", "duckdb":
+			return "DOUBLE"
+		}
+		return "REAL"
+	case TypeBoolean:
+		return "BOOLEAN"
+	case TypeTimestamp:
+		if dbType == "mysql" {
+			return "DATETIME(6)"
+		}
+		return "TIMESTAMP"
+	}
+	return "TEXT"
+}
+
+// convert turns a value read from a file into one for the column. CSV
+// values arrive as strings, where an empty value is NULL except in text
+// columns.
+func (c Column) convert(value interface{}) (interface{}, error) {
+	s, ok := value.(string)
+	if !ok || c.Type == TypeText || c.Type == TypeTimestamp {
+		return value, nil
+	}
+	if s == "" {
+		return nil, nil
+	}
+	var converted interface{}
+	var err error
+	switch c.Type {
+	case TypeInteger:
+		converted, err = strconv.ParseInt(s, 10, 64)
+	case TypeReal:
+		converted, err = strconv.ParseFloat(s, 64)
+	case TypeBoolean:
+		converted, err = strconv.ParseBool(strings.ToLower(s))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("column %s: %q is not %s", c.Name, s, c.Type)
+	}
+	return converted, nil
+}
+
+// sameColumns checks a file still has the columns it was registered with.
+func sameColumns(registered, current []Column) error {
+	if len(registered) != len(current) {
+		return fmt.Errorf("the file has %d columns but was registered with %d; delete and register the table again", len(current), len(registered))
+	}
+	for i := range registered {
+		if registered[i].Name != current[i].Name {
+			return fmt.Errorf("the file's column %d is %s but was registered as %s; delete and register the table again",
+				i+1, current[i].Name, registered[i].Name)
+		}
+	}
+	return nil
+}
+
+// formatOf guesses a source's format from its extension.
+func formatOf(source string) string {
+	switch strings.ToLower(path.Ext(strings.SplitN(source, "?", 2)[0])) {
+	case ".parquet", ".pq":
+		return FormatParquet
+	case ".csv":
+		return FormatCSV
+	case ".xlsx":
+		return FormatXLSX
+	}
+	return ""
+}
+
+// columnName turns a header into a column name that needs no quoting on any
+// supported database: "Order Date" becomes order_date.
+func columnName(header string, i int) string {
+	name := strings.Trim(nonIdentifier.ReplaceAllString(strings.ToLower(strings.TrimSpace(header)), "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = fmt.Sprintf("column_%d", i+1)
+	}
+	return name
+}
+
+// uniqueNames suffixes repeated column names with _2, _3, and so on.
+func uniqueNames(columns []Column) {
+	seen := make(map[string]int)
+	for i := range columns {
+		name := columns[i].Name
+		seen[name]++
+		if n := seen[name]; n > 1 {
+			columns[i].Name = fmt.Sprintf("%s_%d", name, n)
+		}
+	}
+}
+
+// rowReader reads the rows of a file.
+type rowReader interface {
+	// Columns returns the file's columns.
+	Columns() []Column
+
+	// Next returns the next row, one value per column, or io.EOF after the
+	// last.
+	Next() ([]interface{}, error)
+
+	Close() error
+}
+
+// open fetches source and opens it as format.
+func open(ctx context.Context, source, format string) (rowReader, error) {
+	f, err := fetch(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	return openFile(ctx, f, source, format, false)
+}
+
+// openFile opens a fetched file as format, closing it on failure. Text
+// formats start with a header row unless detectHeader is set and the first
+// row does not look like one.
+func openFile(ctx context.Context, f *fetchedFile, source, format string, detectHeader bool) (rowReader, error) {
+	var reader rowReader
+	var err error
+	switch format {
+	case FormatParquet:
+		reader, err = openParquet(ctx, f)
+	case FormatXLSX:
+		reader, err = openXLSX(f, detectHeader)
+	default:
+		reader, err = openCSV(f, detectHeader)
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read %s as %s: %w", source, format, err)
+	}
+	return reader, nil
+}
+
+// textReader reads rows of text values, such as a CSV file's records or a
+// spreadsheet's rows. Column types are inferred from the first
+// csvInferRows rows, which are kept to be returned first.
+type textReader struct {
+	read     func() ([]string, error)
+	close    func() error
+	columns  []Column
+	buffered [][]string
+}
+
+// openCSV reads a CSV file, as newTextReader describes.
+func openCSV(f *fetchedFile, detectHeader bool) (*textReader, error) {
+	reader := csv.NewReader(bufio.NewReader(f))
+	return newTextReader(reader.Read, f.Close, detectHeader)
+}
+
+// openXLSX reads the first sheet of an Excel workbook, as newTextReader
+// describes. Cells are read as they are displayed, so dates keep their
+// number format, and empty rows are skipped.
+func openXLSX(f *fetchedFile, detectHeader bool) (*textReader, error) {
+	workbook, err := excelize.OpenReader(f)
+	if err != nil {
+		return nil, err
+	}
+	sheets := workbook.GetSheetList()
+	if len(sheets) == 0 {
+		workbook.Close()
+		return nil, fmt.Errorf("the workbook has no sheets")
+	}
+	rows, err := workbook.Rows(sheets[0])
+	if err != nil {
+		workbook.Close()
+		return nil, err
+	}
+
+	// Rows end at their last non-empty cell, so short rows are padded to
+	// the width of the first
+	width, line := -1, 0
+	read := func() ([]string, error) {
+		for rows.Next() {
+			line++
+			cells, err := rows.Columns()
+			if err != nil {
+				return nil, err
+			}
+			if strings.TrimSpace(strings.Join(cells, "")) == "" {
+				continue
+			}
+			if width < 0 {
+				width = len(cells)
+			}
+			if len(cells) > width {
+				return nil, fmt.Errorf("row %d has %d cells but the first row has %d", line, len(cells), width)
+			}
+			for len(cells) < width {
+				cells = append(cells, "")
+			}
+			return cells, nil
+		}
+		if err := rows.Error(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+	closeAll := func() error {
+		rows.Close()
+		workbook.Close()
+		return f.Close()
+	}
+	r, err := newTextReader(read, closeAll, detectHeader)
+	if err != nil {
+		rows.Close()
+		workbook.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// newTextReader reads the header row and infers each column's type: integer
+// or real when every non-empty value parses as one, boolean when they are
+// all true or false, and text otherwise. With detectHeader, a first row that
+// does not look like a header is kept as data and the columns are named
+// column_1, column_2, and so on.
+func newTextReader(read func() ([]string, error), close func() error, detectHeader bool) (*textReader, error) {
+	header, err := read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("the file is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	header[0] = strings.TrimPrefix(header[0], "\ufeff") // A byte order mark
+
+	r := &textReader{read: read, close: close, columns: make([]Column, len(header))}
+	for len(r.buffered) < csvInferRows {
+		record, err := read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		r.buffered = append(r.buffered, record)
+	}
+	if detectHeader && !hasHeader(header, r.buffered) {
+		r.buffered = append([][]string{header}, r.buffered...)
+		header = make([]string, len(header))
+	}
+
+	for i, h := range header {
+		r.columns[i] = Column{Name: columnName(h, i), Type: inferType(r.buffered, i)}
+	}
+	uniqueNames(r.columns)
+	return r, nil
+}
+
+// hasHeader guesses whether first is a header above rows. It is when one of
+// its values does not fit the type of the values below it, such as
+// "amount" above numbers. When every column is text, it is a header if its
+// values are all present and distinct.
+func hasHeader(first []string, rows [][]string) bool {
+	typed := false
+	for i, value := range first {
+		typ := inferType(rows, i)
+		if typ == TypeText || value == "" {
+			continue
+		}
+		typed = true
+		if !fits(value, typ) {
+			return true
+		}
+	}
+	if typed {
+		return false
+	}
+	seen := make(map[string]bool)
+	for _, value := range first {
+		if value == "" || seen[value] {
+			return false
+		}
+		seen[value] = true
+	}
+	return true
+}
+
+// fits reports whether value would leave a column of type typ that type.
+func fits(value, typ string) bool {
+	narrowest := inferType([][]string{{value}}, 0)
+	return narrowest == typ || typ == TypeReal && narrowest == TypeInteger
+}
+
+// inferType returns the narrowest type every non-empty value of column i
+// parses as.
+func inferType(records [][]string, i int) string {
+	isInteger, isReal, isBoolean, seen := true, true, true, false
+	for _, record := range records {
+		value := record[i]
+		if value == "" {
+			continue
+		}
+		seen = true
+		if _, err := strconv.ParseInt(value, 10, 64); err != nil {
+			isInteger = false
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			isReal = false
+		}
+		if !strings.EqualFold(value, "true") && !strings.EqualFold(value, "false") {
+			isBoolean = false
+		}
+	}
+	switch {
+	case !seen:
+		return TypeText
+	case isInteger:
+		return TypeInteger
+	case isReal:
+		return TypeReal
+	case isBoolean:
+		return TypeBoolean
+	}
+	return TypeText
+}
+
+// Columns returns the file's columns.
+func (r *textReader) Columns() []Column {
+	return r.columns
+}
+
+// Next returns the next row's values as strings.
+func (r *textReader) Next() ([]interface{}, error) {
+	var record []string
+	if len(r.buffered) > 0 {
+		record, r.buffered = r.buffered[0], r.buffered[1:]
+	} else {
+		var err error
+		if record, err = r.read(); err != nil {
+			return nil, err
+		}
+	}
+	row := make([]interface{}, len(record))
+	for i, value := range record {
+		row[i] = value
+	}
+	return row, nil
+}
+
+// Close closes the file.
+func (r *textReader) Close() error {
+	return r.close()
+}
+
+// parquetReader reads a Parquet file a record batch at a time.
+type parquetReader struct {
+	file    *fetchedFile
+	reader  *file.Reader
+	records pqarrow.RecordReader
+	columns []Column
+	record  arrow.Record
+	row     int
+}
+
+// openParquet reads the file's schema.
+func openParquet(ctx context.Context, f *fetchedFile) (*parquetReader, error) {
+	reader, err := file.NewParquetReader(f)
+	if err != nil {
+		return nil, err
+	}
+	arrowReader, err := pqarrow.NewFileReader(reader, pqarrow.ArrowReadProperties{BatchSize: 4096}, memory.DefaultAllocator)
+	if err != nil {
+		return nil, err
+	}
+	records, err := arrowReader.GetRecordReader(ctx, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &parquetReader{file: f, reader: reader, records: records}
+	for i, field := range records.Schema().Fields() {
+		r.columns = append(r.columns, Column{Name: columnName(field.Name, i), Type: arrowType(field.Type)})
+	}
+	uniqueNames(r.columns)
+	return r, nil
+}
+
+// arrowType maps an Arrow type to a column type.
+func arrowType(t arrow.DataType) string {
+	switch t.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return TypeInteger
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64, arrow.DECIMAL128, arrow.DECIMAL256:
+		return TypeReal
+	case arrow.BOOL:
+		return TypeBoolean
+	case arrow.TIMESTAMP, arrow.DATE32, arrow.DATE64:
+		return TypeTimestamp
+	}
+	return TypeText
+}
+
+// Columns returns the Parquet file's columns.
+func (r *parquetReader) Columns() []Column {
+	return r.columns
+}
+
+// Next returns the next row's values.
+func (r *parquetReader) Next() ([]interface{}, error) {
+	for r.record == nil || r.row >= int(r.record.NumRows()) {
+		if !r.records.Next() {
+			if err := r.records.Err(); err != nil && err != io.EOF {
+				return nil, err
+			}
+			return nil, io.EOF
+		}
+		r.record, r.row = r.records.Record(), 0
+	}
+
+	row := make([]interface{}, len(r.columns))
+	for i, column := range r.record.Columns() {
+		row[i] = arrowValue(column, r.row)
+	}
+	r.row++
+	return row, nil
+}
+
+// arrowValue returns the value at row i of an Arrow array as a Go value the
+// database drivers accept.
+func arrowValue(column arrow.Array, i int) interface{} {
+	if column.IsNull(i) {
+		return nil
+	}
+	switch a := column.(type) {
+	case *array.Int8:
+		return int64(a.Value(i))
+	case *array.Int16:
+		return int64(a.Value(i))
+	case *array.Int32:
+		return int64(a.Value(i))
+	case *array.Int64:
+		return a.Value(i)
+	case *array.Uint8:
+		return int64(a.Value(i))
+	case *array.Uint16:
+		return int64(a.Value(i))
+	case *array.Uint32:
+		return int64(a.Value(i))
+	case *array.Uint64:
+		return int64(a.Value(i))
+	case *array.Float32:
+		return float64(a.Value(i))
+	case *array.Float64:
+		return a.Value(i)
+	case *array.Decimal128:
+		f, _ := strconv.ParseFloat(a.ValueStr(i), 64)
+		return f
+	case *array.Decimal256:
+		f, _ := strconv.ParseFloat(a.ValueStr(i), 64)
+		return f
+	case *array.Boolean:
+		return a.Value(i)
+	case *array.String:
+		return a.Value(i)
+	case *array.LargeString:
+		return a.Value(i)
+	case *array.Timestamp:
+		unit := a.DataType().(*arrow.TimestampType).Unit
+		return a.Value(i).ToTime(unit).UTC().Format(timestampLayout)
+	case *array.Date32:
+		return a.Value(i).ToTime().Format(time.DateOnly)
+	case *array.Date64:
+		return a.Value(i).ToTime().Format(time.DateOnly)
+	}
+	return column.ValueStr(i)
+}
+
+// Close closes the file; the Parquet reader closes it.
+func (r *parquetReader) Close() error {
+	r.records.Release()
+	return r.reader.Close()
+}
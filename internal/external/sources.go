@@ -0,0 +1,173 @@
+package external
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"data-chatter/internal/awsauth"
+	"data-chatter/internal/env"
+	"data-chatter/internal/safehttp"
+)
+
+// defaultFetchTimeout bounds downloading a remote source when
+// EXTERNAL_FETCH_TIMEOUT is unset.
+const defaultFetchTimeout = 5 * time.Minute
+
+// defaultMaxFetchBytes caps a remote source's size when EXTERNAL_MAX_BYTES
+// is unset.
+const defaultMaxFetchBytes = 1 << 30
+
+// sourceClient downloads remote sources. Sources are given by API callers,
+// so it refuses loopback, private, and link-local addresses, except for the
+// hosts in EXTERNAL_ALLOWED_HOSTS and that of AWS_ENDPOINT_URL, and does not
+// follow redirects.
+var sourceClient = sync.OnceValue(func() *http.Client {
+	allowed := env.List("EXTERNAL_ALLOWED_HOSTS", nil)
+	if endpoint, err := url.Parse(os.Getenv("AWS_ENDPOINT_URL")); err == nil && endpoint.Hostname() != "" {
+		allowed = append(allowed, endpoint.Hostname())
+	}
+	return safehttp.NewClient(env.Duration("EXTERNAL_FETCH_TIMEOUT", defaultFetchTimeout), allowed)
+})
+
+// fetchedFile is a source's contents in a local file. Files downloaded from
+// S3 or HTTP are temporary and removed on Close.
+type fetchedFile struct {
+	*os.File
+	temporary bool
+}
+
+// Close closes the file, removing it if it was downloaded.
+func (f *fetchedFile) Close() error {
+	err := f.File.Close()
+	if f.temporary {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// fetch opens a source: an s3://bucket/key URL, an http(s) URL, or a path
+// under EXTERNAL_FILES_DIR. Remote files are downloaded first, since Parquet
+// is read from the end.
+func fetch(ctx context.Context, source string) (*fetchedFile, error) {
+	switch {
+	case strings.HasPrefix(source, "s3://"):
+		request, err := s3Request(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		return download(request)
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		return download(request)
+	}
+
+	path, err := localPath(source)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &fetchedFile{File: f}, nil
+}
+
+// localPath resolves a local source against EXTERNAL_FILES_DIR, refusing
+// paths outside it so registrations cannot read arbitrary server files.
+func localPath(source string) (string, error) {
+	dir := os.Getenv("EXTERNAL_FILES_DIR")
+	if dir == "" {
+		return "", fmt.Errorf("local files are disabled: set EXTERNAL_FILES_DIR to the directory they may be read from")
+	}
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	path := source
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+	if rel, err := filepath.Rel(root, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside EXTERNAL_FILES_DIR", source)
+	}
+	return path, nil
+}
+
+// download saves a GET response's body to a temporary file. Bodies larger
+// than EXTERNAL_MAX_BYTES are refused, and the body of an error response is
+// not reported, since the source may be a server the caller cannot reach.
+func download(request *http.Request) (*fetchedFile, error) {
+	response, err := sourceClient().Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s returned %s", request.URL.Redacted(), response.Status)
+	}
+
+	maxBytes := int64(env.Int("EXTERNAL_MAX_BYTES", defaultMaxFetchBytes))
+	fetched, err := save(io.LimitReader(response.Body, maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", request.URL.Redacted(), err)
+	}
+	if info, err := fetched.Stat(); err == nil && info.Size() > maxBytes {
+		fetched.Close()
+		return nil, fmt.Errorf("%s is larger than EXTERNAL_MAX_BYTES (%d bytes)", request.URL.Redacted(), maxBytes)
+	}
+	return fetched, nil
+}
+
+// save copies body to a temporary file, ready to be read from the start.
+func save(body io.Reader) (*fetchedFile, error) {
+	f, err := os.CreateTemp("", "data-chatter-external-*")
+	if err != nil {
+		return nil, err
+	}
+	fetched := &fetchedFile{File: f, temporary: true}
+	if _, err := io.Copy(f, body); err != nil {
+		fetched.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		fetched.Close()
+		return nil, err
+	}
+	return fetched, nil
+}
+
+// s3Request builds the GET request for an s3://bucket/key URL, at the
+// object's awsauth.S3ObjectURL. With AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY set, and
+// AWS_SESSION_TOKEN for temporary credentials, the request is signed;
+// without them only public objects can be read.
+func s3Request(ctx context.Context, source string) (*http.Request, error) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(source, "s3://"), "/")
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("%s is not an s3://bucket/key URL", source)
+	}
+	target, err := awsauth.S3ObjectURL(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if creds, ok := awsauth.CredentialsFromEnv(); ok {
+		awsauth.Sign(request, creds, "s3", awsauth.Region(), awsauth.UnsignedPayload, time.Now().UTC())
+	}
+	return request, nil
+}
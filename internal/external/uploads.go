@@ -0,0 +1,151 @@
+package external
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+)
+
+// uploadPrefix starts the source of an uploaded file's table, followed by
+// the file's name.
+const uploadPrefix = "upload:"
+
+// defaultUploadTTL is how long uploaded files' tables are kept when
+// UPLOAD_TTL is unset.
+const defaultUploadTTL = 24 * time.Hour
+
+// maxUploadNameLength bounds a table name taken from a file name.
+const maxUploadNameLength = 60
+
+// isUpload reports whether source is an uploaded file's.
+func isUpload(source string) bool {
+	return strings.HasPrefix(source, uploadPrefix)
+}
+
+// UploadTTLFromEnv reads UPLOAD_TTL, how long an uploaded file's table is
+// kept before it is dropped (default 24h).
+func UploadTTLFromEnv() (time.Duration, error) {
+	value := os.Getenv("UPLOAD_TTL")
+	if value == "" {
+		return defaultUploadTTL, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid UPLOAD_TTL %q", value)
+	}
+	return ttl, nil
+}
+
+// SetUploadTTL sets how long uploaded files' tables are kept.
+func (s *Store) SetUploadTTL(ttl time.Duration) {
+	s.uploadTTL = ttl
+}
+
+// Upload creates a table from an uploaded CSV or XLSX file and loads its
+// rows at once, since the file itself is not kept. Column types are
+// inferred, and a first row that does not look like a header is kept as
+// data. Without a name the table is named after the file, suffixed with _2,
+// _3, and so on when that name is taken. The format is taken from the file
+// name's extension when not given.
+func (s *Store) Upload(ctx context.Context, table ExternalTable, filename string, body io.Reader) (ExternalTable, error) {
+	filename = path.Base(strings.ReplaceAll(strings.TrimSpace(filename), `\`, "/"))
+	table.Name = strings.TrimSpace(table.Name)
+	table.Source = uploadPrefix + filename
+	table.Format = strings.ToLower(strings.TrimSpace(table.Format))
+	if table.Format == "" {
+		table.Format = formatOf(filename)
+	}
+	if table.Format != FormatCSV && table.Format != FormatXLSX {
+		return ExternalTable{}, fmt.Errorf("%w: uploads must be %s or %s files", ErrInvalid, FormatCSV, FormatXLSX)
+	}
+
+	tables, err := s.conn.TableNames(ctx)
+	if err != nil {
+		return ExternalTable{}, err
+	}
+	taken := make(map[string]bool, len(tables))
+	for _, name := range tables {
+		taken[strings.ToLower(name)] = true
+	}
+	if table.Name == "" {
+		table.Name = uploadName(filename, taken)
+	}
+	if err := checkName(table.Name); err != nil {
+		return ExternalTable{}, err
+	}
+	if taken[strings.ToLower(table.Name)] {
+		return ExternalTable{}, fmt.Errorf("%w: a table named %s already exists", ErrInvalid, table.Name)
+	}
+
+	f, err := save(body)
+	if err != nil {
+		return ExternalTable{}, fmt.Errorf("failed to receive %s: %w", filename, err)
+	}
+	file, err := openFile(ctx, f, filename, table.Format, true)
+	if err != nil {
+		return ExternalTable{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	table.Columns = file.Columns()
+	table, err = s.create(ctx, table)
+	if err != nil {
+		file.Close()
+		return ExternalTable{}, err
+	}
+
+	s.mu.Lock()
+	err = s.load(ctx, table, file)
+	s.mu.Unlock()
+	if err != nil {
+		if deleteErr := s.Delete(ctx, table.Name); deleteErr != nil {
+			slog.WarnContext(ctx, "failed to drop table of failed upload", "table", table.Name, "error", deleteErr)
+		}
+		return ExternalTable{}, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	return s.Get(ctx, table.Name)
+}
+
+// uploadName names a table after an uploaded file: "Q3 Sales.xlsx" becomes
+// q3_sales, suffixed with _2, _3, and so on when taken has the name.
+func uploadName(filename string, taken map[string]bool) string {
+	base := strings.TrimSuffix(filename, path.Ext(filename))
+	name := strings.Trim(nonIdentifier.ReplaceAllString(strings.ToLower(base), "_"), "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') || strings.HasPrefix(name, database.MetadataTablePrefix) {
+		name = "upload_" + name
+	}
+	name = strings.TrimSuffix(name[:min(len(name), maxUploadNameLength)], "_")
+
+	candidate := name
+	for n := 2; taken[candidate]; n++ {
+		candidate = fmt.Sprintf("%s_%d", name, n)
+	}
+	return candidate
+}
+
+// PruneUploads drops the tables of uploaded files older than the upload
+// TTL. It runs as a scheduled task.
+func (s *Store) PruneUploads(ctx context.Context) error {
+	tables, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, table := range tables {
+		if table.ExpiresAt == nil || time.Now().Before(*table.ExpiresAt) {
+			continue
+		}
+		if err := s.Delete(ctx, table.Name); err != nil && !errors.Is(err, ErrNotFound) {
+			errs = append(errs, err)
+			continue
+		}
+		slog.InfoContext(ctx, "uploaded table expired", "table", table.Name, "source", table.Source)
+	}
+	return errors.Join(errs...)
+}
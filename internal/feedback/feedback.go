@@ -0,0 +1,409 @@
+// Package feedback keeps users' ratings of chat answers, with the question
+// and the SQL each answer ran, so wrong queries can be measured and
+// collected into an eval set. Feedback lives in the dc_feedback table of
+// the connected database, so every replica's ratings are aggregated
+// together.
+package feedback
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/encryption"
+)
+
+const (
+	// Table is where feedback is kept. Its dc_ prefix keeps it out of the
+	// schema shown to users and the LLM.
+	Table = database.MetadataTablePrefix + "feedback"
+
+	// maxCommentLength bounds a comment's text.
+	maxCommentLength = 2000
+
+	// resealBatch bounds the entries one Reseal encrypts again.
+	resealBatch = 500
+)
+
+// Ratings.
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// ErrInvalid is returned for feedback that fails validation.
+var ErrInvalid = errors.New("invalid feedback")
+
+// Feedback is one user's rating of the answer to one turn.
+type Feedback struct {
+	ID             string    `json:"id"`
+	ConversationID string    `json:"conversation_id"`
+	TurnID         string    `json:"turn_id"`
+	UserID         string    `json:"user_id,omitempty"`
+	Rating         string    `json:"rating"`
+	Comment        string    `json:"comment,omitempty"`
+	Question       string    `json:"question"`
+	Queries        []string  `json:"queries"` // SQL the answer ran, in plan order
+	Tables         []string  `json:"tables,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Filter narrows List. Zero fields match everything.
+type Filter struct {
+	Rating string
+	Since  time.Time
+	Until  time.Time
+}
+
+// Counts tallies ratings.
+type Counts struct {
+	Up   int `json:"up"`
+	Down int `json:"down"`
+}
+
+// TableCounts tallies the ratings of answers that queried a table.
+type TableCounts struct {
+	Table string `json:"table"`
+	Counts
+}
+
+// DayCounts tallies the ratings given on a UTC day.
+type DayCounts struct {
+	Day string `json:"day"` // YYYY-MM-DD
+	Counts
+}
+
+// Summary aggregates the feedback given in a period.
+type Summary struct {
+	Since time.Time `json:"since"`
+	Until time.Time `json:"until"`
+	Total int       `json:"total"`
+	Counts
+
+	// DownRate is the share of ratings that were down, from 0 to 1.
+	DownRate float64 `json:"down_rate"`
+
+	// Tables are the tables queried by rated answers, most down-rated first.
+	Tables []TableCounts `json:"tables"`
+
+	// Days are the days feedback was given on, oldest first.
+	Days []DayCounts `json:"days"`
+}
+
+// Store reads and writes feedback.
+type Store struct {
+	conn *database.Connection
+	keys *encryption.Keyring
+}
+
+// NewStore creates the feedback table if it does not exist yet. With keys,
+// questions, comments, and queries are encrypted.
+func NewStore(ctx context.Context, conn *database.Connection, keys *encryption.Keyring) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		id              VARCHAR(64) NOT NULL PRIMARY KEY,
+		conversation_id VARCHAR(64) NOT NULL,
+		turn_id         VARCHAR(64) NOT NULL,
+		user_id         VARCHAR(255) NOT NULL,
+		rating          VARCHAR(16) NOT NULL,
+		comment         TEXT NOT NULL,
+		question        TEXT NOT NULL,
+		queries         TEXT NOT NULL,
+		table_names     TEXT NOT NULL,
+		created_at      BIGINT NOT NULL,
+		updated_at      BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	return &Store{conn: conn, keys: keys}, nil
+}
+
+// Put saves a user's feedback on a turn. A user has one rating per turn, so
+// rating a turn again replaces the earlier rating and comment.
+func (s *Store) Put(ctx context.Context, f Feedback) (Feedback, error) {
+	f.Rating = strings.ToLower(strings.TrimSpace(f.Rating))
+	f.Comment = strings.TrimSpace(f.Comment)
+	switch {
+	case f.ConversationID == "" || f.TurnID == "":
+		return Feedback{}, fmt.Errorf("%w: conversation_id and turn_id are required", ErrInvalid)
+	case f.Rating != RatingUp && f.Rating != RatingDown:
+		return Feedback{}, fmt.Errorf("%w: rating must be %q or %q", ErrInvalid, RatingUp, RatingDown)
+	case len(f.Comment) > maxCommentLength:
+		return Feedback{}, fmt.Errorf("%w: comment must be at most %d characters", ErrInvalid, maxCommentLength)
+	}
+	if f.Queries == nil {
+		f.Queries = []string{}
+	}
+
+	comment, err := s.keys.Seal(f.Comment)
+	if err != nil {
+		return Feedback{}, err
+	}
+	question, err := s.keys.Seal(f.Question)
+	if err != nil {
+		return Feedback{}, err
+	}
+	encoded, err := json.Marshal(f.Queries)
+	if err != nil {
+		return Feedback{}, fmt.Errorf("failed to encode feedback queries: %w", err)
+	}
+	queries, err := s.keys.Seal(string(encoded))
+	if err != nil {
+		return Feedback{}, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	config := s.conn.Config
+	p := config.Placeholder
+	result, err := s.conn.DB.ExecContext(ctx, `UPDATE `+config.QuoteIdentifier(Table)+`
+		SET rating = `+p(1)+`, comment = `+p(2)+`, question = `+p(3)+`, queries = `+p(4)+`, table_names = `+p(5)+`, updated_at = `+p(6)+`
+		WHERE turn_id = `+p(7)+` AND user_id = `+p(8),
+		f.Rating, comment, question, queries, strings.Join(f.Tables, ","), now.UnixMilli(), f.TurnID, f.UserID)
+	if err != nil {
+		return Feedback{}, fmt.Errorf("failed to save feedback: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n > 0 {
+		existing, err := s.query(ctx, " WHERE turn_id = "+p(1)+" AND user_id = "+p(2), f.TurnID, f.UserID)
+		if err != nil {
+			return Feedback{}, err
+		}
+		if len(existing) > 0 {
+			return existing[0], nil
+		}
+	}
+
+	f.ID = newID()
+	f.CreatedAt, f.UpdatedAt = now, now
+	placeholders := make([]string, 11)
+	for i := range placeholders {
+		placeholders[i] = p(i + 1)
+	}
+	_, err = s.conn.DB.ExecContext(ctx, `INSERT INTO `+config.QuoteIdentifier(Table)+` (id, conversation_id, turn_id, user_id, rating, comment, question, queries, table_names, created_at, updated_at) VALUES (`+strings.Join(placeholders, ", ")+`)`,
+		f.ID, f.ConversationID, f.TurnID, f.UserID, f.Rating, comment, question, queries, strings.Join(f.Tables, ","), now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return Feedback{}, fmt.Errorf("failed to save feedback: %w", err)
+	}
+	return f, nil
+}
+
+// List returns the feedback matching filter, newest first.
+func (s *Store) List(ctx context.Context, filter Filter) ([]Feedback, error) {
+	p := s.conn.Config.Placeholder
+	var conditions []string
+	var args []interface{}
+	if filter.Rating != "" {
+		args = append(args, filter.Rating)
+		conditions = append(conditions, "rating = "+p(len(args)))
+	}
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since.UnixMilli())
+		conditions = append(conditions, "updated_at >= "+p(len(args)))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until.UnixMilli())
+		conditions = append(conditions, "updated_at < "+p(len(args)))
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+	return s.query(ctx, where, args...)
+}
+
+// query reads the feedback matching where, newest first.
+func (s *Store) query(ctx context.Context, where string, args ...interface{}) ([]Feedback, error) {
+	rows, err := s.conn.DB.QueryContext(ctx,
+		`SELECT id, conversation_id, turn_id, user_id, rating, comment, question, queries, table_names, created_at, updated_at FROM `+
+			s.conn.Config.QuoteIdentifier(Table)+where+` ORDER BY updated_at DESC, id`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read feedback: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []Feedback{}
+	for rows.Next() {
+		var f Feedback
+		var queries, tables string
+		var createdAt, updatedAt int64
+		if err := rows.Scan(&f.ID, &f.ConversationID, &f.TurnID, &f.UserID, &f.Rating, &f.Comment, &f.Question,
+			&queries, &tables, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read feedback: %w", err)
+		}
+		if f.Comment, err = s.keys.Open(f.Comment); err != nil {
+			return nil, err
+		}
+		if f.Question, err = s.keys.Open(f.Question); err != nil {
+			return nil, err
+		}
+		if queries, err = s.keys.Open(queries); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(queries), &f.Queries); err != nil {
+			return nil, fmt.Errorf("failed to decode feedback queries: %w", err)
+		}
+		if tables != "" {
+			f.Tables = strings.Split(tables, ",")
+		}
+		f.CreatedAt = time.UnixMilli(createdAt).UTC()
+		f.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+		entries = append(entries, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read feedback: %w", err)
+	}
+	return entries, nil
+}
+
+// Summarize aggregates the feedback given from since until until, overall,
+// by queried table, and by day.
+func (s *Store) Summarize(ctx context.Context, since, until time.Time) (Summary, error) {
+	config := s.conn.Config
+	rows, err := s.conn.DB.QueryContext(ctx,
+		fmt.Sprintf(`SELECT rating, table_names, updated_at FROM %s WHERE updated_at >= %s AND updated_at < %s`,
+			config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2)),
+		since.UnixMilli(), until.UnixMilli())
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read feedback: %w", err)
+	}
+	defer rows.Close()
+
+	summary := Summary{Since: since.UTC(), Until: until.UTC(), Tables: []TableCounts{}, Days: []DayCounts{}}
+	tables := make(map[string]*Counts)
+	days := make(map[string]*Counts)
+	for rows.Next() {
+		var rating, tableList string
+		var updatedAt int64
+		if err := rows.Scan(&rating, &tableList, &updatedAt); err != nil {
+			return Summary{}, fmt.Errorf("failed to read feedback: %w", err)
+		}
+
+		summary.Total++
+		summary.Counts.add(rating)
+		day := time.UnixMilli(updatedAt).UTC().Format("2006-01-02")
+		if days[day] == nil {
+			days[day] = &Counts{}
+		}
+		days[day].add(rating)
+		if tableList == "" {
+			continue
+		}
+		for _, table := range strings.Split(tableList, ",") {
+			if tables[table] == nil {
+				tables[table] = &Counts{}
+			}
+			tables[table].add(rating)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return Summary{}, fmt.Errorf("failed to read feedback: %w", err)
+	}
+	if summary.Total > 0 {
+		summary.DownRate = float64(summary.Down) / float64(summary.Total)
+	}
+
+	for table, counts := range tables {
+		summary.Tables = append(summary.Tables, TableCounts{Table: table, Counts: *counts})
+	}
+	sort.Slice(summary.Tables, func(i, j int) bool {
+		a, b := summary.Tables[i], summary.Tables[j]
+		if a.Down != b.Down {
+			return a.Down > b.Down
+		}
+		return a.Up+a.Down > b.Up+b.Down || a.Up+a.Down == b.Up+b.Down && a.Table < b.Table
+	})
+	for day, counts := range days {
+		summary.Days = append(summary.Days, DayCounts{Day: day, Counts: *counts})
+	}
+	sort.Slice(summary.Days, func(i, j int) bool { return summary.Days[i].Day < summary.Days[j].Day })
+	return summary, nil
+}
+
+// Reseal encrypts the comments, questions, and queries of up to
+// resealBatch entries saved in plaintext or with a key other than the
+// current one, after encryption is turned on or a key is rotated. It runs
+// as a scheduled task, so a key may be dropped once every entry has been
+// resealed.
+func (s *Store) Reseal(ctx context.Context) error {
+	if !s.keys.Enabled() {
+		return nil
+	}
+	config := s.conn.Config
+	rows, err := s.conn.DB.QueryContext(ctx,
+		config.Limit(fmt.Sprintf(`SELECT id, comment, question, queries FROM %s WHERE queries NOT LIKE %s`,
+			config.QuoteIdentifier(Table), config.Placeholder(1)), resealBatch),
+		s.keys.CurrentPrefix()+"%")
+	if err != nil {
+		return fmt.Errorf("failed to read feedback: %w", err)
+	}
+	type stale struct{ id, comment, question, queries string }
+	var entries []stale
+	for rows.Next() {
+		var entry stale
+		if err := rows.Scan(&entry.id, &entry.comment, &entry.question, &entry.queries); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read feedback: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read feedback: %w", err)
+	}
+
+	for _, entry := range entries {
+		values := []string{entry.comment, entry.question, entry.queries}
+		for i, value := range values {
+			if s.keys.Current(value) {
+				continue
+			}
+			plaintext, err := s.keys.Open(value)
+			if err != nil {
+				return err
+			}
+			if values[i], err = s.keys.Seal(plaintext); err != nil {
+				return err
+			}
+		}
+		p := config.Placeholder
+		_, err = s.conn.DB.ExecContext(ctx,
+			`UPDATE `+config.QuoteIdentifier(Table)+` SET comment = `+p(1)+`, question = `+p(2)+`, queries = `+p(3)+` WHERE id = `+p(4)+` AND queries = `+p(5),
+			values[0], values[1], values[2], entry.id, entry.queries)
+		if err != nil {
+			return fmt.Errorf("failed to reseal feedback: %w", err)
+		}
+	}
+	if len(entries) > 0 {
+		slog.InfoContext(ctx, "resealed feedback", "entries", len(entries))
+	}
+	return nil
+}
+
+// add counts one rating.
+func (c *Counts) add(rating string) {
+	switch rating {
+	case RatingUp:
+		c.Up++
+	case RatingDown:
+		c.Down++
+	}
+}
+
+// newID returns a random feedback ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
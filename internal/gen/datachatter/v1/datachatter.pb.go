@@ -0,0 +1,958 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: datachatter/v1/datachatter.proto
+
+// Package datachatter.v1 is the gRPC API to the data-chatter tool engine and
+// chat agent. It mirrors the REST endpoints under /tools and /llm/message.
+
+package datachatterv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ListToolsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListToolsRequest) Reset() {
+	*x = ListToolsRequest{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListToolsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListToolsRequest) ProtoMessage() {}
+
+func (x *ListToolsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListToolsRequest.ProtoReflect.Descriptor instead.
+func (*ListToolsRequest) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{0}
+}
+
+type ListToolsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tools         []*ToolDefinition      `protobuf:"bytes,1,rep,name=tools,proto3" json:"tools,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListToolsResponse) Reset() {
+	*x = ListToolsResponse{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListToolsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListToolsResponse) ProtoMessage() {}
+
+func (x *ListToolsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListToolsResponse.ProtoReflect.Descriptor instead.
+func (*ListToolsResponse) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *ListToolsResponse) GetTools() []*ToolDefinition {
+	if x != nil {
+		return x.Tools
+	}
+	return nil
+}
+
+// ToolDefinition describes a tool and its JSON Schema input.
+type ToolDefinition struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Description   string                 `protobuf:"bytes,2,opt,name=description,proto3" json:"description,omitempty"`
+	InputSchema   *structpb.Struct       `protobuf:"bytes,3,opt,name=input_schema,json=inputSchema,proto3" json:"input_schema,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolDefinition) Reset() {
+	*x = ToolDefinition{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolDefinition) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolDefinition) ProtoMessage() {}
+
+func (x *ToolDefinition) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolDefinition.ProtoReflect.Descriptor instead.
+func (*ToolDefinition) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ToolDefinition) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ToolDefinition) GetDescription() string {
+	if x != nil {
+		return x.Description
+	}
+	return ""
+}
+
+func (x *ToolDefinition) GetInputSchema() *structpb.Struct {
+	if x != nil {
+		return x.InputSchema
+	}
+	return nil
+}
+
+// ToolCall is a request to run one tool.
+type ToolCall struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name  string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Input *structpb.Struct       `protobuf:"bytes,3,opt,name=input,proto3" json:"input,omitempty"`
+	// Optional context such as turn_id, used for progress events and auditing.
+	Metadata      *structpb.Struct `protobuf:"bytes,4,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolCall) Reset() {
+	*x = ToolCall{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolCall) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolCall) ProtoMessage() {}
+
+func (x *ToolCall) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolCall.ProtoReflect.Descriptor instead.
+func (*ToolCall) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *ToolCall) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ToolCall) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *ToolCall) GetInput() *structpb.Struct {
+	if x != nil {
+		return x.Input
+	}
+	return nil
+}
+
+func (x *ToolCall) GetMetadata() *structpb.Struct {
+	if x != nil {
+		return x.Metadata
+	}
+	return nil
+}
+
+// ToolResult is the outcome of a tool call.
+type ToolResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Content       []*ToolContent         `protobuf:"bytes,2,rep,name=content,proto3" json:"content,omitempty"`
+	IsError       bool                   `protobuf:"varint,3,opt,name=is_error,json=isError,proto3" json:"is_error,omitempty"`
+	Error         *ToolError             `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	RequestId     string                 `protobuf:"bytes,5,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolResult) Reset() {
+	*x = ToolResult{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolResult) ProtoMessage() {}
+
+func (x *ToolResult) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolResult.ProtoReflect.Descriptor instead.
+func (*ToolResult) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ToolResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ToolResult) GetContent() []*ToolContent {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+func (x *ToolResult) GetIsError() bool {
+	if x != nil {
+		return x.IsError
+	}
+	return false
+}
+
+func (x *ToolResult) GetError() *ToolError {
+	if x != nil {
+		return x.Error
+	}
+	return nil
+}
+
+func (x *ToolResult) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+// ToolContent is one block of tool output. Query results are JSON in text.
+type ToolContent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Text          string                 `protobuf:"bytes,2,opt,name=text,proto3" json:"text,omitempty"`
+	Data          *structpb.Value        `protobuf:"bytes,3,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolContent) Reset() {
+	*x = ToolContent{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolContent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolContent) ProtoMessage() {}
+
+func (x *ToolContent) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolContent.ProtoReflect.Descriptor instead.
+func (*ToolContent) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ToolContent) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ToolContent) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *ToolContent) GetData() *structpb.Value {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// ToolError carries a stable error code such as "syntax_error" or "timeout".
+type ToolError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	DriverCode    string                 `protobuf:"bytes,3,opt,name=driver_code,json=driverCode,proto3" json:"driver_code,omitempty"`
+	Retryable     bool                   `protobuf:"varint,4,opt,name=retryable,proto3" json:"retryable,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ToolError) Reset() {
+	*x = ToolError{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ToolError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ToolError) ProtoMessage() {}
+
+func (x *ToolError) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ToolError.ProtoReflect.Descriptor instead.
+func (*ToolError) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ToolError) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *ToolError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ToolError) GetDriverCode() string {
+	if x != nil {
+		return x.DriverCode
+	}
+	return ""
+}
+
+func (x *ToolError) GetRetryable() bool {
+	if x != nil {
+		return x.Retryable
+	}
+	return false
+}
+
+type ExecuteToolsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tools         []*ToolCall            `protobuf:"bytes,1,rep,name=tools,proto3" json:"tools,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteToolsRequest) Reset() {
+	*x = ExecuteToolsRequest{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteToolsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteToolsRequest) ProtoMessage() {}
+
+func (x *ExecuteToolsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteToolsRequest.ProtoReflect.Descriptor instead.
+func (*ExecuteToolsRequest) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ExecuteToolsRequest) GetTools() []*ToolCall {
+	if x != nil {
+		return x.Tools
+	}
+	return nil
+}
+
+type ExecuteToolsResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Results       []*ToolResult          `protobuf:"bytes,1,rep,name=results,proto3" json:"results,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExecuteToolsResponse) Reset() {
+	*x = ExecuteToolsResponse{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExecuteToolsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExecuteToolsResponse) ProtoMessage() {}
+
+func (x *ExecuteToolsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExecuteToolsResponse.ProtoReflect.Descriptor instead.
+func (*ExecuteToolsResponse) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ExecuteToolsResponse) GetResults() []*ToolResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+// ChatMessage is a natural-language request for the chat agent.
+type ChatMessage struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Message        string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	TurnId         string                 `protobuf:"bytes,2,opt,name=turn_id,json=turnId,proto3" json:"turn_id,omitempty"`
+	PreviousTurnId string                 `protobuf:"bytes,3,opt,name=previous_turn_id,json=previousTurnId,proto3" json:"previous_turn_id,omitempty"`
+	// How NULLs appear in rows: "null" (default), "empty", or "na".
+	Nulls         string `protobuf:"bytes,4,opt,name=nulls,proto3" json:"nulls,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatMessage) Reset() {
+	*x = ChatMessage{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatMessage) ProtoMessage() {}
+
+func (x *ChatMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatMessage.ProtoReflect.Descriptor instead.
+func (*ChatMessage) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ChatMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetTurnId() string {
+	if x != nil {
+		return x.TurnId
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetPreviousTurnId() string {
+	if x != nil {
+		return x.PreviousTurnId
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetNulls() string {
+	if x != nil {
+		return x.Nulls
+	}
+	return ""
+}
+
+// ChatReply is the agent's answer to a ChatMessage.
+type ChatReply struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	TurnId  string                 `protobuf:"bytes,1,opt,name=turn_id,json=turnId,proto3" json:"turn_id,omitempty"`
+	Message string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Results []*ToolResult          `protobuf:"bytes,3,rep,name=results,proto3" json:"results,omitempty"`
+	Plan    []*PlanStep            `protobuf:"bytes,4,rep,name=plan,proto3" json:"plan,omitempty"`
+	// Result rows merged across tool calls, each with a "_source" field.
+	Rows          []*structpb.Struct `protobuf:"bytes,5,rep,name=rows,proto3" json:"rows,omitempty"`
+	Error         string             `protobuf:"bytes,6,opt,name=error,proto3" json:"error,omitempty"`
+	RequestId     string             `protobuf:"bytes,7,opt,name=request_id,json=requestId,proto3" json:"request_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatReply) Reset() {
+	*x = ChatReply{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatReply) ProtoMessage() {}
+
+func (x *ChatReply) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatReply.ProtoReflect.Descriptor instead.
+func (*ChatReply) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ChatReply) GetTurnId() string {
+	if x != nil {
+		return x.TurnId
+	}
+	return ""
+}
+
+func (x *ChatReply) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ChatReply) GetResults() []*ToolResult {
+	if x != nil {
+		return x.Results
+	}
+	return nil
+}
+
+func (x *ChatReply) GetPlan() []*PlanStep {
+	if x != nil {
+		return x.Plan
+	}
+	return nil
+}
+
+func (x *ChatReply) GetRows() []*structpb.Struct {
+	if x != nil {
+		return x.Rows
+	}
+	return nil
+}
+
+func (x *ChatReply) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *ChatReply) GetRequestId() string {
+	if x != nil {
+		return x.RequestId
+	}
+	return ""
+}
+
+// PlanStep records one tool call the agent made.
+type PlanStep struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Step          int32                  `protobuf:"varint,1,opt,name=step,proto3" json:"step,omitempty"`
+	ToolCallId    string                 `protobuf:"bytes,2,opt,name=tool_call_id,json=toolCallId,proto3" json:"tool_call_id,omitempty"`
+	Tool          string                 `protobuf:"bytes,3,opt,name=tool,proto3" json:"tool,omitempty"`
+	Sql           string                 `protobuf:"bytes,4,opt,name=sql,proto3" json:"sql,omitempty"`
+	DurationMs    int64                  `protobuf:"varint,5,opt,name=duration_ms,json=durationMs,proto3" json:"duration_ms,omitempty"`
+	Status        string                 `protobuf:"bytes,6,opt,name=status,proto3" json:"status,omitempty"`
+	Attempts      int32                  `protobuf:"varint,7,opt,name=attempts,proto3" json:"attempts,omitempty"`
+	Error         string                 `protobuf:"bytes,8,opt,name=error,proto3" json:"error,omitempty"`
+	ErrorType     string                 `protobuf:"bytes,9,opt,name=error_type,json=errorType,proto3" json:"error_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PlanStep) Reset() {
+	*x = PlanStep{}
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PlanStep) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PlanStep) ProtoMessage() {}
+
+func (x *PlanStep) ProtoReflect() protoreflect.Message {
+	mi := &file_datachatter_v1_datachatter_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PlanStep.ProtoReflect.Descriptor instead.
+func (*PlanStep) Descriptor() ([]byte, []int) {
+	return file_datachatter_v1_datachatter_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *PlanStep) GetStep() int32 {
+	if x != nil {
+		return x.Step
+	}
+	return 0
+}
+
+func (x *PlanStep) GetToolCallId() string {
+	if x != nil {
+		return x.ToolCallId
+	}
+	return ""
+}
+
+func (x *PlanStep) GetTool() string {
+	if x != nil {
+		return x.Tool
+	}
+	return ""
+}
+
+func (x *PlanStep) GetSql() string {
+	if x != nil {
+		return x.Sql
+	}
+	return ""
+}
+
+func (x *PlanStep) GetDurationMs() int64 {
+	if x != nil {
+		return x.DurationMs
+	}
+	return 0
+}
+
+func (x *PlanStep) GetStatus() string {
+	if x != nil {
+		return x.Status
+	}
+	return ""
+}
+
+func (x *PlanStep) GetAttempts() int32 {
+	if x != nil {
+		return x.Attempts
+	}
+	return 0
+}
+
+func (x *PlanStep) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *PlanStep) GetErrorType() string {
+	if x != nil {
+		return x.ErrorType
+	}
+	return ""
+}
+
+var File_datachatter_v1_datachatter_proto protoreflect.FileDescriptor
+
+const file_datachatter_v1_datachatter_proto_rawDesc = "" +
+	"\n" +
+	" datachatter/v1/datachatter.proto\x12\x0edatachatter.v1\x1a\x1cgoogle/protobuf/struct.proto\"\x12\n" +
+	"\x10ListToolsRequest\"I\n" +
+	"\x11ListToolsResponse\x124\n" +
+	"\x05tools\x18\x01 \x03(\v2\x1e.datachatter.v1.ToolDefinitionR\x05tools\"\x82\x01\n" +
+	"\x0eToolDefinition\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12 \n" +
+	"\vdescription\x18\x02 \x01(\tR\vdescription\x12:\n" +
+	"\finput_schema\x18\x03 \x01(\v2\x17.google.protobuf.StructR\vinputSchema\"\x92\x01\n" +
+	"\bToolCall\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12-\n" +
+	"\x05input\x18\x03 \x01(\v2\x17.google.protobuf.StructR\x05input\x123\n" +
+	"\bmetadata\x18\x04 \x01(\v2\x17.google.protobuf.StructR\bmetadata\"\xbe\x01\n" +
+	"\n" +
+	"ToolResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x125\n" +
+	"\acontent\x18\x02 \x03(\v2\x1b.datachatter.v1.ToolContentR\acontent\x12\x19\n" +
+	"\bis_error\x18\x03 \x01(\bR\aisError\x12/\n" +
+	"\x05error\x18\x04 \x01(\v2\x19.datachatter.v1.ToolErrorR\x05error\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\x05 \x01(\tR\trequestId\"a\n" +
+	"\vToolContent\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x12\n" +
+	"\x04text\x18\x02 \x01(\tR\x04text\x12*\n" +
+	"\x04data\x18\x03 \x01(\v2\x16.google.protobuf.ValueR\x04data\"x\n" +
+	"\tToolError\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1f\n" +
+	"\vdriver_code\x18\x03 \x01(\tR\n" +
+	"driverCode\x12\x1c\n" +
+	"\tretryable\x18\x04 \x01(\bR\tretryable\"E\n" +
+	"\x13ExecuteToolsRequest\x12.\n" +
+	"\x05tools\x18\x01 \x03(\v2\x18.datachatter.v1.ToolCallR\x05tools\"L\n" +
+	"\x14ExecuteToolsResponse\x124\n" +
+	"\aresults\x18\x01 \x03(\v2\x1a.datachatter.v1.ToolResultR\aresults\"\x80\x01\n" +
+	"\vChatMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x17\n" +
+	"\aturn_id\x18\x02 \x01(\tR\x06turnId\x12(\n" +
+	"\x10previous_turn_id\x18\x03 \x01(\tR\x0epreviousTurnId\x12\x14\n" +
+	"\x05nulls\x18\x04 \x01(\tR\x05nulls\"\x84\x02\n" +
+	"\tChatReply\x12\x17\n" +
+	"\aturn_id\x18\x01 \x01(\tR\x06turnId\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x124\n" +
+	"\aresults\x18\x03 \x03(\v2\x1a.datachatter.v1.ToolResultR\aresults\x12,\n" +
+	"\x04plan\x18\x04 \x03(\v2\x18.datachatter.v1.PlanStepR\x04plan\x12+\n" +
+	"\x04rows\x18\x05 \x03(\v2\x17.google.protobuf.StructR\x04rows\x12\x14\n" +
+	"\x05error\x18\x06 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"request_id\x18\a \x01(\tR\trequestId\"\xf0\x01\n" +
+	"\bPlanStep\x12\x12\n" +
+	"\x04step\x18\x01 \x01(\x05R\x04step\x12 \n" +
+	"\ftool_call_id\x18\x02 \x01(\tR\n" +
+	"toolCallId\x12\x12\n" +
+	"\x04tool\x18\x03 \x01(\tR\x04tool\x12\x10\n" +
+	"\x03sql\x18\x04 \x01(\tR\x03sql\x12\x1f\n" +
+	"\vduration_ms\x18\x05 \x01(\x03R\n" +
+	"durationMs\x12\x16\n" +
+	"\x06status\x18\x06 \x01(\tR\x06status\x12\x1a\n" +
+	"\battempts\x18\a \x01(\x05R\battempts\x12\x14\n" +
+	"\x05error\x18\b \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"error_type\x18\t \x01(\tR\terrorType2\xc6\x02\n" +
+	"\vDataChatter\x12P\n" +
+	"\tListTools\x12 .datachatter.v1.ListToolsRequest\x1a!.datachatter.v1.ListToolsResponse\x12C\n" +
+	"\vExecuteTool\x12\x18.datachatter.v1.ToolCall\x1a\x1a.datachatter.v1.ToolResult\x12Y\n" +
+	"\fExecuteTools\x12#.datachatter.v1.ExecuteToolsRequest\x1a$.datachatter.v1.ExecuteToolsResponse\x12E\n" +
+	"\vSendMessage\x12\x1b.datachatter.v1.ChatMessage\x1a\x19.datachatter.v1.ChatReplyB8Z6data-chatter/internal/gen/datachatter/v1;datachatterv1b\x06proto3"
+
+var (
+	file_datachatter_v1_datachatter_proto_rawDescOnce sync.Once
+	file_datachatter_v1_datachatter_proto_rawDescData []byte
+)
+
+func file_datachatter_v1_datachatter_proto_rawDescGZIP() []byte {
+	file_datachatter_v1_datachatter_proto_rawDescOnce.Do(func() {
+		file_datachatter_v1_datachatter_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_datachatter_v1_datachatter_proto_rawDesc), len(file_datachatter_v1_datachatter_proto_rawDesc)))
+	})
+	return file_datachatter_v1_datachatter_proto_rawDescData
+}
+
+var file_datachatter_v1_datachatter_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_datachatter_v1_datachatter_proto_goTypes = []any{
+	(*ListToolsRequest)(nil),     // 0: datachatter.v1.ListToolsRequest
+	(*ListToolsResponse)(nil),    // 1: datachatter.v1.ListToolsResponse
+	(*ToolDefinition)(nil),       // 2: datachatter.v1.ToolDefinition
+	(*ToolCall)(nil),             // 3: datachatter.v1.ToolCall
+	(*ToolResult)(nil),           // 4: datachatter.v1.ToolResult
+	(*ToolContent)(nil),          // 5: datachatter.v1.ToolContent
+	(*ToolError)(nil),            // 6: datachatter.v1.ToolError
+	(*ExecuteToolsRequest)(nil),  // 7: datachatter.v1.ExecuteToolsRequest
+	(*ExecuteToolsResponse)(nil), // 8: datachatter.v1.ExecuteToolsResponse
+	(*ChatMessage)(nil),          // 9: datachatter.v1.ChatMessage
+	(*ChatReply)(nil),            // 10: datachatter.v1.ChatReply
+	(*PlanStep)(nil),             // 11: datachatter.v1.PlanStep
+	(*structpb.Struct)(nil),      // 12: google.protobuf.Struct
+	(*structpb.Value)(nil),       // 13: google.protobuf.Value
+}
+var file_datachatter_v1_datachatter_proto_depIdxs = []int32{
+	2,  // 0: datachatter.v1.ListToolsResponse.tools:type_name -> datachatter.v1.ToolDefinition
+	12, // 1: datachatter.v1.ToolDefinition.input_schema:type_name -> google.protobuf.Struct
+	12, // 2: datachatter.v1.ToolCall.input:type_name -> google.protobuf.Struct
+	12, // 3: datachatter.v1.ToolCall.metadata:type_name -> google.protobuf.Struct
+	5,  // 4: datachatter.v1.ToolResult.content:type_name -> datachatter.v1.ToolContent
+	6,  // 5: datachatter.v1.ToolResult.error:type_name -> datachatter.v1.ToolError
+	13, // 6: datachatter.v1.ToolContent.data:type_name -> google.protobuf.Value
+	3,  // 7: datachatter.v1.ExecuteToolsRequest.tools:type_name -> datachatter.v1.ToolCall
+	4,  // 8: datachatter.v1.ExecuteToolsResponse.results:type_name -> datachatter.v1.ToolResult
+	4,  // 9: datachatter.v1.ChatReply.results:type_name -> datachatter.v1.ToolResult
+	11, // 10: datachatter.v1.ChatReply.plan:type_name -> datachatter.v1.PlanStep
+	12, // 11: datachatter.v1.ChatReply.rows:type_name -> google.protobuf.Struct
+	0,  // 12: datachatter.v1.DataChatter.ListTools:input_type -> datachatter.v1.ListToolsRequest
+	3,  // 13: datachatter.v1.DataChatter.ExecuteTool:input_type -> datachatter.v1.ToolCall
+	7,  // 14: datachatter.v1.DataChatter.ExecuteTools:input_type -> datachatter.v1.ExecuteToolsRequest
+	9,  // 15: datachatter.v1.DataChatter.SendMessage:input_type -> datachatter.v1.ChatMessage
+	1,  // 16: datachatter.v1.DataChatter.ListTools:output_type -> datachatter.v1.ListToolsResponse
+	4,  // 17: datachatter.v1.DataChatter.ExecuteTool:output_type -> datachatter.v1.ToolResult
+	8,  // 18: datachatter.v1.DataChatter.ExecuteTools:output_type -> datachatter.v1.ExecuteToolsResponse
+	10, // 19: datachatter.v1.DataChatter.SendMessage:output_type -> datachatter.v1.ChatReply
+	16, // [16:20] is the sub-list for method output_type
+	12, // [12:16] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_datachatter_v1_datachatter_proto_init() }
+func file_datachatter_v1_datachatter_proto_init() {
+	if File_datachatter_v1_datachatter_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_datachatter_v1_datachatter_proto_rawDesc), len(file_datachatter_v1_datachatter_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_datachatter_v1_datachatter_proto_goTypes,
+		DependencyIndexes: file_datachatter_v1_datachatter_proto_depIdxs,
+		MessageInfos:      file_datachatter_v1_datachatter_proto_msgTypes,
+	}.Build()
+	File_datachatter_v1_datachatter_proto = out.File
+	file_datachatter_v1_datachatter_proto_goTypes = nil
+	file_datachatter_v1_datachatter_proto_depIdxs = nil
+}
@@ -0,0 +1,256 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: datachatter/v1/datachatter.proto
+
+// Package datachatter.v1 is the gRPC API to the data-chatter tool engine and
+// chat agent. It mirrors the REST endpoints under /tools and /llm/message.
+
+package datachatterv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	DataChatter_ListTools_FullMethodName    = "/datachatter.v1.DataChatter/ListTools"
+	DataChatter_ExecuteTool_FullMethodName  = "/datachatter.v1.DataChatter/ExecuteTool"
+	DataChatter_ExecuteTools_FullMethodName = "/datachatter.v1.DataChatter/ExecuteTools"
+	DataChatter_SendMessage_FullMethodName  = "/datachatter.v1.DataChatter/SendMessage"
+)
+
+// DataChatterClient is the client API for DataChatter service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// DataChatter runs tools and chat turns. Calls accept the same bearer token
+// as the REST API in the "authorization" metadata key, and an optional
+// "x-request-id" that is echoed in the response header metadata.
+type DataChatterClient interface {
+	// ListTools returns the tools available to the LLM.
+	ListTools(ctx context.Context, in *ListToolsRequest, opts ...grpc.CallOption) (*ListToolsResponse, error)
+	// ExecuteTool runs a single tool call. Tool failures are reported in the
+	// result's error, not as gRPC errors.
+	ExecuteTool(ctx context.Context, in *ToolCall, opts ...grpc.CallOption) (*ToolResult, error)
+	// ExecuteTools runs several tool calls in order.
+	ExecuteTools(ctx context.Context, in *ExecuteToolsRequest, opts ...grpc.CallOption) (*ExecuteToolsResponse, error)
+	// SendMessage answers a natural-language message, like POST /llm/message.
+	SendMessage(ctx context.Context, in *ChatMessage, opts ...grpc.CallOption) (*ChatReply, error)
+}
+
+type dataChatterClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDataChatterClient(cc grpc.ClientConnInterface) DataChatterClient {
+	return &dataChatterClient{cc}
+}
+
+func (c *dataChatterClient) ListTools(ctx context.Context, in *ListToolsRequest, opts ...grpc.CallOption) (*ListToolsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListToolsResponse)
+	err := c.cc.Invoke(ctx, DataChatter_ListTools_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataChatterClient) ExecuteTool(ctx context.Context, in *ToolCall, opts ...grpc.CallOption) (*ToolResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ToolResult)
+	err := c.cc.Invoke(ctx, DataChatter_ExecuteTool_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataChatterClient) ExecuteTools(ctx context.Context, in *ExecuteToolsRequest, opts ...grpc.CallOption) (*ExecuteToolsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExecuteToolsResponse)
+	err := c.cc.Invoke(ctx, DataChatter_ExecuteTools_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *dataChatterClient) SendMessage(ctx context.Context, in *ChatMessage, opts ...grpc.CallOption) (*ChatReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChatReply)
+	err := c.cc.Invoke(ctx, DataChatter_SendMessage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// DataChatterServer is the server API for DataChatter service.
+// All implementations must embed UnimplementedDataChatterServer
+// for forward compatibility.
+//
+// DataChatter runs tools and chat turns. Calls accept the same bearer token
+// as the REST API in the "authorization" metadata key, and an optional
+// "x-request-id" that is echoed in the response header metadata.
+type DataChatterServer interface {
+	// ListTools returns the tools available to the LLM.
+	ListTools(context.Context, *ListToolsRequest) (*ListToolsResponse, error)
+	// ExecuteTool runs a single tool call. Tool failures are reported in the
+	// result's error, not as gRPC errors.
+	ExecuteTool(context.Context, *ToolCall) (*ToolResult, error)
+	// ExecuteTools runs several tool calls in order.
+	ExecuteTools(context.Context, *ExecuteToolsRequest) (*ExecuteToolsResponse, error)
+	// SendMessage answers a natural-language message, like POST /llm/message.
+	SendMessage(context.Context, *ChatMessage) (*ChatReply, error)
+	mustEmbedUnimplementedDataChatterServer()
+}
+
+// UnimplementedDataChatterServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDataChatterServer struct{}
+
+func (UnimplementedDataChatterServer) ListTools(context.Context, *ListToolsRequest) (*ListToolsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTools not implemented")
+}
+func (UnimplementedDataChatterServer) ExecuteTool(context.Context, *ToolCall) (*ToolResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecuteTool not implemented")
+}
+func (UnimplementedDataChatterServer) ExecuteTools(context.Context, *ExecuteToolsRequest) (*ExecuteToolsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ExecuteTools not implemented")
+}
+func (UnimplementedDataChatterServer) SendMessage(context.Context, *ChatMessage) (*ChatReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendMessage not implemented")
+}
+func (UnimplementedDataChatterServer) mustEmbedUnimplementedDataChatterServer() {}
+func (UnimplementedDataChatterServer) testEmbeddedByValue()                     {}
+
+// UnsafeDataChatterServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DataChatterServer will
+// result in compilation errors.
+type UnsafeDataChatterServer interface {
+	mustEmbedUnimplementedDataChatterServer()
+}
+
+func RegisterDataChatterServer(s grpc.ServiceRegistrar, srv DataChatterServer) {
+	// If the following call pancis, it indicates UnimplementedDataChatterServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&DataChatter_ServiceDesc, srv)
+}
+
+func _DataChatter_ListTools_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListToolsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataChatterServer).ListTools(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataChatter_ListTools_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataChatterServer).ListTools(ctx, req.(*ListToolsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataChatter_ExecuteTool_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ToolCall)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataChatterServer).ExecuteTool(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataChatter_ExecuteTool_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataChatterServer).ExecuteTool(ctx, req.(*ToolCall))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataChatter_ExecuteTools_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ExecuteToolsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataChatterServer).ExecuteTools(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataChatter_ExecuteTools_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataChatterServer).ExecuteTools(ctx, req.(*ExecuteToolsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _DataChatter_SendMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChatMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DataChatterServer).SendMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: DataChatter_SendMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DataChatterServer).SendMessage(ctx, req.(*ChatMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// DataChatter_ServiceDesc is the grpc.ServiceDesc for DataChatter service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var DataChatter_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "datachatter.v1.DataChatter",
+	HandlerType: (*DataChatterServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListTools",
+			Handler:    _DataChatter_ListTools_Handler,
+		},
+		{
+			MethodName: "ExecuteTool",
+			Handler:    _DataChatter_ExecuteTool_Handler,
+		},
+		{
+			MethodName: "ExecuteTools",
+			Handler:    _DataChatter_ExecuteTools_Handler,
+		},
+		{
+			MethodName: "SendMessage",
+			Handler:    _DataChatter_SendMessage_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "datachatter/v1/datachatter.proto",
+}
@@ -0,0 +1,155 @@
+// Package grpcapi serves the DataChatter gRPC API with the same
+// authentication, tenant routing, request IDs, and logging as the REST
+// server.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"data-chatter/internal/auth"
+	datachatterv1 "data-chatter/internal/gen/datachatter/v1"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/tenant"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDKey is the metadata key carrying the request ID; gRPC metadata keys are lowercase.
+var requestIDKey = strings.ToLower(requestid.Header)
+
+// publicServices are reachable without a token even when authentication is required.
+var publicServices = []string{
+	"/grpc.health.v1.Health/",
+}
+
+// NewServer creates a gRPC server with the DataChatter service, the standard
+// health service, and server reflection registered. Reflection is a streaming
+// service, so it only describes the API and is not subject to the interceptors.
+// A non-nil tenants routes each call to its tenant, as on the REST server.
+func NewServer(authConfig *auth.Config, tenants *tenant.Registry, service datachatterv1.DataChatterServer) *grpc.Server {
+	server := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		requestIDInterceptor,
+		loggingInterceptor,
+		authInterceptor(authConfig),
+		tenantInterceptor(tenants),
+	))
+	datachatterv1.RegisterDataChatterServer(server, service)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	reflection.Register(server)
+	return server
+}
+
+// requestIDInterceptor accepts the caller's x-request-id or generates one,
+// stores it in the context, and returns it in the response header metadata.
+func requestIDInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if !requestid.Valid(id) {
+		id = requestid.New()
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDKey, id))
+	return handler(requestid.NewContext(ctx, id), req)
+}
+
+// loggingInterceptor logs each call with its status code and duration.
+func loggingInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	slog.InfoContext(ctx, "grpc request",
+		"method", info.FullMethod,
+		"code", status.Code(err).String(),
+		"duration", time.Since(start))
+	return resp, err
+}
+
+// authInterceptor verifies the bearer token in the "authorization" metadata,
+// mirroring auth.Middleware: invalid tokens are always rejected, and missing
+// tokens only when authentication is required.
+func authInterceptor(config *auth.Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !config.Enabled() {
+			return handler(ctx, req)
+		}
+
+		token := bearerToken(ctx)
+		if token == "" {
+			if config.Required && !isPublic(info.FullMethod) {
+				return nil, status.Error(codes.Unauthenticated, "authentication required")
+			}
+			return handler(ctx, req)
+		}
+
+		user, err := config.Verify(token)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		return handler(auth.WithUser(ctx, user, token), req)
+	}
+}
+
+// tenantInterceptor resolves each call to its tenant from the token's tenant
+// claim or the "x-api-key" metadata, mirroring tenant.Middleware.
+func tenantInterceptor(tenants *tenant.Registry) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if tenants == nil || isPublic(info.FullMethod) {
+			return handler(ctx, req)
+		}
+
+		key := ""
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(strings.ToLower(tenant.APIKeyHeader)); len(values) > 0 {
+				key = values[0]
+			}
+		}
+		routed, err := tenants.Resolve(ctx, key)
+		switch {
+		case errors.Is(err, tenant.ErrForbidden):
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		case errors.Is(err, tenant.ErrUnauthorized):
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		case err != nil:
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return handler(routed, req)
+	}
+}
+
+// bearerToken extracts the token from the "authorization" metadata.
+func bearerToken(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return ""
+	}
+	if scheme, token, ok := strings.Cut(values[0], " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
+
+// isPublic reports whether a method belongs to a service that needs no token.
+func isPublic(fullMethod string) bool {
+	for _, prefix := range publicServices {
+		if strings.HasPrefix(fullMethod, prefix) {
+			return true
+		}
+	}
+	return false
+}
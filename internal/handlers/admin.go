@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/orgcontext"
+	"data-chatter/internal/requestid"
+)
+
+// AdminToolsHandler lists every registered tool and whether it is enabled.
+func AdminToolsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	response := APIResponse{
+		Message: "Tool status",
+		Data:    toolEngine.ToolStatuses(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ToolStatsHandler reports each tool's calls since the server started,
+// errors, error rate, p50 and p95 latency, and rows returned, so operators
+// can see which tools the LLM leans on and which keep failing.
+func ToolStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	response := APIResponse{
+		Message: "Tool stats",
+		Data:    toolEngine.ToolStats(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// EnableToolHandler turns a disabled tool back on.
+func EnableToolHandler(w http.ResponseWriter, r *http.Request) {
+	setToolEnabled(w, r, true)
+}
+
+// DisableToolHandler turns a tool off without restarting the server. A
+// disabled tool is hidden from /tools and the LLM, and calls to it fail with
+// a tool_disabled error.
+func DisableToolHandler(w http.ResponseWriter, r *http.Request) {
+	setToolEnabled(w, r, false)
+}
+
+// setToolEnabled applies an enable or disable request and records it in the audit log.
+func setToolEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := toolEngine.SetToolEnabled(name, enabled); err != nil {
+		response := APIResponse{
+			Message:   "Tool not found",
+			Error:     apierror.New(apierror.NotFound, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	action, message := "tool_disabled", "Tool disabled"
+	if enabled {
+		action, message = "tool_enabled", "Tool enabled"
+	}
+	auditLog.Record(r.Context(), audit.Entry{Action: action, Tool: name, Status: "ok"})
+
+	response := APIResponse{
+		Message: message,
+		Data:    toolEngine.ToolStatuses(),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// OrgContextRequest replaces the organization-wide context document.
+type OrgContextRequest struct {
+	Content string `json:"content"`
+}
+
+// OrgContextHandler returns the current context document on GET and saves a
+// new version on PUT. Version 0 means no document has been set.
+func OrgContextHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		current, _ := orgContext.Current()
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Org context", Data: current})
+
+	case http.MethodPut:
+		var request OrgContextRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		version, err := orgContext.Set(request.Content, auth.UserID(r.Context()))
+		if err != nil {
+			writeOrgContextError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{
+			Action:  "org_context_updated",
+			Status:  "ok",
+			Details: map[string]interface{}{"version": version.Version},
+		})
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Org context updated", Data: version})
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// OrgContextVersionsHandler lists every version of the context document, oldest first.
+func OrgContextVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Org context versions", Data: orgContext.Versions()})
+}
+
+// RollbackOrgContextHandler restores an earlier version's content as a new version.
+func RollbackOrgContextHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	target, err := strconv.Atoi(r.PathValue("version"))
+	if err != nil {
+		writeOrgContextError(w, r, orgcontext.ErrNotFound)
+		return
+	}
+	version, err := orgContext.Rollback(target, auth.UserID(r.Context()))
+	if err != nil {
+		writeOrgContextError(w, r, err)
+		return
+	}
+	auditLog.Record(r.Context(), audit.Entry{
+		Action:  "org_context_rolled_back",
+		Status:  "ok",
+		Details: map[string]interface{}{"version": version.Version, "rolled_back_from": target},
+	})
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Org context rolled back", Data: version})
+}
+
+// writeOrgContextError reports a failed change to the context document.
+func writeOrgContextError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Failed to save org context"
+	switch {
+	case errors.Is(err, orgcontext.ErrNotFound):
+		status, message = http.StatusNotFound, "Version not found"
+	case errors.Is(err, orgcontext.ErrTooLarge):
+		status, message = http.StatusBadRequest, "Org context too large"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// DictionaryRequest describes a table or column.
+type DictionaryRequest struct {
+	Description string `json:"description"`
+}
+
+// DictionaryHandler lists the data dictionary, or one table's entries with
+// ?table=.
+func DictionaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if dataDictionary == nil {
+		writeDictionaryUnavailable(w, r)
+		return
+	}
+
+	entries, err := dataDictionary.List(r.Context(), r.URL.Query().Get("table"))
+	if err != nil {
+		writeDictionaryError(w, r, err)
+		return
+	}
+	if entries == nil {
+		entries = []dictionary.Entry{}
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Data dictionary", Data: entries})
+}
+
+// DictionaryEntryHandler saves (PUT) or removes (DELETE) the description of
+// a table, or of a column when the path names one.
+func DictionaryEntryHandler(w http.ResponseWriter, r *http.Request) {
+	if dataDictionary == nil {
+		writeDictionaryUnavailable(w, r)
+		return
+	}
+	table, column := r.PathValue("table"), r.PathValue("column")
+	details := map[string]interface{}{"table": table}
+	if column != "" {
+		details["column"] = column
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var request DictionaryRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		if strings.TrimSpace(request.Description) == "" {
+			writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+				Message:   "Invalid description",
+				Error:     apierror.New(apierror.InvalidRequest, "description is required; use DELETE to remove one"),
+				RequestID: requestid.FromContext(r.Context()),
+			})
+			return
+		}
+		entry, err := dataDictionary.Set(r.Context(), dictionary.Entry{
+			Table:       table,
+			Column:      column,
+			Description: request.Description,
+			UpdatedBy:   auth.UserID(r.Context()),
+		})
+		if err != nil {
+			writeDictionaryError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "dictionary_updated", Status: "ok", Details: details})
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Description saved", Data: entry})
+
+	case http.MethodDelete:
+		if err := dataDictionary.Delete(r.Context(), table, column); err != nil {
+			writeDictionaryError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "dictionary_deleted", Status: "ok", Details: details})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// writeDictionaryError reports a failed data dictionary request.
+func writeDictionaryError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Failed to update data dictionary"
+	switch {
+	case errors.Is(err, dictionary.ErrNotFound):
+		status, message = http.StatusNotFound, "Description not found"
+	case errors.Is(err, dictionary.ErrUnknownTarget):
+		status, message = http.StatusNotFound, "Table or column not found"
+	case errors.Is(err, dictionary.ErrTooLarge):
+		status, message = http.StatusBadRequest, "Description too large"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeDictionaryUnavailable reports that the dictionary table could not be created at startup.
+func writeDictionaryUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Message:   "Data dictionary unavailable",
+		Error:     apierror.New(apierror.FeatureUnavailable, "the "+dictionary.Table+" table could not be created; check the database user's permissions"),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeAdminResponse writes an admin endpoint's JSON response.
+func writeAdminResponse(w http.ResponseWriter, status int, response APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
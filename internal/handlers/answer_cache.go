@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+
+	"data-chatter/internal/answercache"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/sqlparse"
+)
+
+// CachedAnswer labels a response served from the answer cache: the earlier
+// question it answered, when, and how similar that question is to this one.
+type CachedAnswer struct {
+	Question   string    `json:"question"`
+	TurnID     string    `json:"turn_id"`
+	AnsweredAt time.Time `json:"answered_at"`
+	AgeSeconds int64     `json:"age_seconds"`
+	Similarity float64   `json:"similarity"`
+}
+
+// answerScope keys cached answers by the user who asked, since access rules
+// may differ between users, by the session's database and the swaps of the
+// default one, and by how NULLs were rendered in the rows and the results
+// presented in the message.
+func (lh *LLMHandler) answerScope(ctx context.Context, request MessageRequest) string {
+	format, _ := llm.ParseResponseFormat(request.ResponseFormat)
+	database := fmt.Sprintf("%s\x00%d", sessionDatabase(ctx), lh.db.For(ctx).Generation)
+	return auth.UserID(ctx) + "\x00" + database + "\x00" + request.Nulls + "\x00" + string(format)
+}
+
+// writeCachedAnswer answers the request from the answer cache when the
+// caller recently asked a similar enough question, the tables its answer read
+// are unchanged, and the caller may still run its queries. It reports whether
+// it wrote a response.
+func (lh *LLMHandler) writeCachedAnswer(ctx context.Context, w http.ResponseWriter, request MessageRequest) bool {
+	if request.NoCache || request.DryRun || !answerCache.Enabled() {
+		return false
+	}
+
+	entry, similarity, ok := answerCache.Lookup(lh.answerScope(ctx, request), request.Message, func(entry answercache.Entry) bool {
+		for _, query := range entry.Queries {
+			if accessControl.AuthorizeQuery(ctx, query) != nil {
+				return false
+			}
+		}
+		versions, err := lh.db.For(ctx).DataVersions(ctx, slices.Collect(maps.Keys(entry.Tables)))
+		if err != nil {
+			slog.DebugContext(ctx, "cached answer not served", "turn_id", entry.TurnID, "error", err)
+			return false
+		}
+		return maps.Equal(versions, entry.Tables)
+	})
+	if !ok {
+		return false
+	}
+
+	var response MessageResponse
+	var cached struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	if err := json.Unmarshal(entry.Response, &response); err != nil {
+		return false
+	}
+	json.Unmarshal(entry.Response, &cached)
+
+	age := entry.Age()
+	response.TurnID = request.TurnID
+	response.ConversationID = conversationIDFromContext(ctx)
+	response.Message = fmt.Sprintf("%s (cached answer to %q from %s ago)", response.Message, entry.Question, age.Round(time.Second))
+	response.SummaryPending = false
+	response.Cached = &CachedAnswer{
+		Question:   entry.Question,
+		TurnID:     entry.TurnID,
+		AnsweredAt: entry.AnsweredAt,
+		AgeSeconds: int64(age.Seconds()),
+		Similarity: similarity,
+	}
+	lh.recentResults.Put(request.TurnID, cached.Results)
+
+	slog.InfoContext(ctx, "answering from cache", "turn_id", request.TurnID, "cached_turn_id", entry.TurnID, "similarity", similarity, "age", age)
+	writeMessageResponse(w, http.StatusOK, response)
+	return true
+}
+
+// cacheAnswer caches a turn's answer for similar questions. Only answers
+// whose every step ran SQL successfully are cached, so the tables they
+// depend on are known, and not those converted to a unit the user asked
+// for, since a similar question may ask for another unit.
+func (lh *LLMHandler) cacheAnswer(ctx context.Context, request MessageRequest, recorder *turnRecorder) {
+	if request.DryRun || recorder.status != http.StatusOK || !answerCache.Enabled() {
+		return
+	}
+	if _, ok := lh.converter.ParseTarget(request.Message); ok {
+		return
+	}
+
+	var response MessageResponse
+	if err := json.Unmarshal(recorder.body.Bytes(), &response); err != nil || response.Pending || len(response.Plan) == 0 {
+		return
+	}
+	var queries, tables []string
+	for _, step := range response.Plan {
+		if step.Status != "ok" || step.SQL == "" {
+			return
+		}
+		queries = append(queries, step.SQL)
+		tables = append(tables, sqlparse.ReferencedTables(step.SQL)...)
+	}
+
+	versions, err := lh.db.For(ctx).DataVersions(ctx, tables)
+	if err != nil {
+		slog.DebugContext(ctx, "answer not cached", "turn_id", request.TurnID, "error", err)
+		return
+	}
+	answerCache.Put(answercache.Entry{
+		Scope:    lh.answerScope(ctx, request),
+		Question: request.Message,
+		TurnID:   request.TurnID,
+		Queries:  queries,
+		Tables:   versions,
+		Response: json.RawMessage(append([]byte(nil), recorder.body.Bytes()...)),
+	})
+}
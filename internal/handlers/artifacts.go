@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/artifacts"
+	"data-chatter/internal/conversation"
+	"data-chatter/internal/requestid"
+)
+
+// collectArtifacts returns the files the artifact_create calls in plan
+// attached to the turn, in plan order.
+func collectArtifacts(plan []PlanStep, results []map[string]interface{}) []artifacts.Artifact {
+	var attached []artifacts.Artifact
+	for _, step := range plan {
+		if step.Tool != "artifact_create" || step.Status != "ok" {
+			continue
+		}
+		for _, result := range results {
+			if id, _ := result["id"].(string); id != step.ToolCallID {
+				continue
+			}
+			content, _ := result["content"].([]interface{})
+			if len(content) == 0 {
+				break
+			}
+			block, _ := content[0].(map[string]interface{})
+			text, _ := block["text"].(string)
+			var payload struct {
+				Artifact *artifacts.Artifact `json:"artifact"`
+			}
+			if json.Unmarshal([]byte(text), &payload) == nil && payload.Artifact != nil {
+				attached = append(attached, *payload.Artifact)
+			}
+			break
+		}
+	}
+	return attached
+}
+
+// conversationArtifacts returns the files attached to c's turns, oldest
+// turn first.
+func conversationArtifacts(c *conversation.Conversation) []artifacts.Artifact {
+	attached := []artifacts.Artifact{}
+	for _, turn := range c.Turns {
+		var response struct {
+			Artifacts []artifacts.Artifact `json:"artifacts"`
+		}
+		json.Unmarshal(turn.Response, &response)
+		attached = append(attached, response.Artifacts...)
+	}
+	return attached
+}
+
+// ArtifactsHandler lists the files attached to a conversation's turns.
+// Readable by everyone the conversation is visible to.
+func (lh *LLMHandler) ArtifactsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	c, err := lh.conversations.Get(r.PathValue("id"))
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(conversationArtifacts(c))
+}
+
+// ArtifactHandler downloads a file attached to one of a conversation's
+// turns. Readable by everyone the conversation is visible to.
+func (lh *LLMHandler) ArtifactHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if turnArtifacts == nil {
+		writeConversationError(w, r, http.StatusServiceUnavailable, "Artifacts unavailable", "no artifact store is configured")
+		return
+	}
+
+	c, err := lh.conversations.Get(r.PathValue("id"))
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+	var artifact *artifacts.Artifact
+	for _, attached := range conversationArtifacts(c) {
+		if attached.ID == r.PathValue("artifact") {
+			artifact = &attached
+			break
+		}
+	}
+	if artifact == nil {
+		writeConversationNotFound(w, r, "No artifact with that ID in the conversation")
+		return
+	}
+
+	data, err := turnArtifacts.Open(r.Context(), artifact.ID)
+	if errors.Is(err, artifacts.ErrNotFound) {
+		writeConversationNotFound(w, r, "The artifact's contents are no longer kept")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to read artifact", "artifact_id", artifact.ID, "error", err)
+		writeAdminResponse(w, http.StatusInternalServerError, APIResponse{
+			Message:   "Failed to read artifact",
+			Error:     apierror.New(apierror.Internal, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", artifact.ContentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, artifact.Name))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
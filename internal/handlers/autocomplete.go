@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/database"
+	"data-chatter/internal/requestid"
+)
+
+const (
+	defaultAutocompleteLimit = 20
+	maxAutocompleteLimit     = 100
+)
+
+// Suggestion is one autocomplete candidate. Kind is "table" or "column";
+// column suggestions also name their table and data type.
+type Suggestion struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Table    string `json:"table,omitempty"`
+	DataType string `json:"data_type,omitempty"`
+}
+
+// AutocompleteResponse lists the suggestions for a prefix.
+type AutocompleteResponse struct {
+	Prefix      string       `json:"prefix"`
+	Suggestions []Suggestion `json:"suggestions"`
+}
+
+// AutocompleteHandler suggests table and column names from the database schema.
+type AutocompleteHandler struct {
+	db *database.Connection
+}
+
+// NewAutocompleteHandler creates an autocomplete handler over the database.
+func NewAutocompleteHandler(db *database.Connection) *AutocompleteHandler {
+	return &AutocompleteHandler{db: db}
+}
+
+// SuggestHandler serves GET /autocomplete?prefix=&limit=. Matching is a
+// case-insensitive prefix match; tables come before columns, each sorted by
+// name. A prefix of the form "table.col" suggests only that table's columns.
+// Tables and columns the caller's roles cannot read are never suggested.
+func (ah *AutocompleteHandler) SuggestHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	limit := defaultAutocompleteLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			apierror.WriteInvalidRequest(w, r, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxAutocompleteLimit)
+	}
+
+	schema, err := ah.db.For(r.Context()).Schema(r.Context())
+	if err != nil {
+		response := APIResponse{
+			Message:   "Failed to read schema",
+			Error:     apierror.New(apierror.Internal, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	response := AutocompleteResponse{
+		Prefix:      prefix,
+		Suggestions: suggest(r.Context(), schema.Tables, schema.Columns, prefix, limit),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// suggest matches prefix against the schema, filtered by access control.
+func suggest(ctx context.Context, tables []string, schema map[string][]database.ColumnInfo, prefix string, limit int) []Suggestion {
+	suggestions := []Suggestion{}
+	needle := strings.ToLower(prefix)
+
+	// "orders.cu" narrows to columns of orders starting with "cu".
+	if table, column, ok := strings.Cut(needle, "."); ok {
+		for _, name := range tables {
+			if strings.ToLower(name) != table || !accessControl.TableVisible(ctx, name) {
+				continue
+			}
+			for _, col := range schema[name] {
+				if len(suggestions) >= limit {
+					return suggestions
+				}
+				if strings.HasPrefix(strings.ToLower(col.Name), column) && accessControl.ColumnVisible(ctx, name, col.Name) {
+					suggestions = append(suggestions, Suggestion{Kind: "column", Name: col.Name, Table: name, DataType: col.DataType})
+				}
+			}
+		}
+		return suggestions
+	}
+
+	var columns []Suggestion
+	for _, name := range tables {
+		if !accessControl.TableVisible(ctx, name) {
+			continue
+		}
+		if strings.HasPrefix(strings.ToLower(name), needle) {
+			suggestions = append(suggestions, Suggestion{Kind: "table", Name: name})
+		}
+		for _, col := range schema[name] {
+			if strings.HasPrefix(strings.ToLower(col.Name), needle) && accessControl.ColumnVisible(ctx, name, col.Name) {
+				columns = append(columns, Suggestion{Kind: "column", Name: col.Name, Table: name, DataType: col.DataType})
+			}
+		}
+	}
+	sort.SliceStable(columns, func(i, j int) bool {
+		return strings.ToLower(columns[i].Name) < strings.ToLower(columns[j].Name)
+	})
+
+	suggestions = append(suggestions, columns...)
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+	return suggestions
+}
@@ -0,0 +1,227 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/backup"
+	"data-chatter/internal/requestid"
+)
+
+// maxBackupBytes bounds the size of a restored backup.
+const maxBackupBytes = 256 << 20
+
+// RestoreReport says how much of each section of a backup was restored,
+// and which sections or tables were not.
+type RestoreReport struct {
+	Conversations int            `json:"conversations"`
+	History       int            `json:"history"`
+	SavedQueries  int            `json:"saved_queries"`
+	Suggestions   int            `json:"suggestions"`
+	OrgContext    int            `json:"org_context"`
+	Notifications int            `json:"notifications"`
+	Audit         int            `json:"audit"` // Entries added to the log
+	Tables        map[string]int `json:"tables"`
+	Skipped       []string       `json:"skipped,omitempty"`
+}
+
+// BackupHandler downloads a backup of the data the app keeps for itself,
+// independent of the analytical data it queries: conversations, query
+// history, saved queries, suggested questions, the org context,
+// notification preferences, the audit log, and the metadata tables. The
+// backup is sealed with HISTORY_ENCRYPTION_KEYS when they are set.
+func (lh *LLMHandler) BackupHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	archive, err := lh.backup(r.Context())
+	var data []byte
+	if err == nil {
+		data, err = backup.Seal(archive, backupKeys)
+	}
+	if err != nil {
+		auditLog.Record(r.Context(), audit.Entry{Action: "backup_created", Status: "error", Details: map[string]interface{}{"error": err.Error()}})
+		writeBackupError(w, r, http.StatusInternalServerError, "Backup failed", err)
+		return
+	}
+	auditLog.Record(r.Context(), audit.Entry{
+		Action: "backup_created",
+		Status: "ok",
+		Details: map[string]interface{}{
+			"conversations": len(archive.Conversations),
+			"audit":         len(archive.Audit),
+			"tables":        len(archive.Tables),
+			"bytes":         len(data),
+		},
+	})
+
+	contentType, extension := "application/json", "json"
+	if backupKeys.Enabled() {
+		contentType, extension = "application/octet-stream", "enc"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="data-chatter-backup-%s.%s"`, archive.CreatedAt.Format("20060102-150405"), extension))
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// backup collects an archive of every store.
+func (lh *LLMHandler) backup(ctx context.Context) (*backup.Archive, error) {
+	archive := backup.New(auth.UserID(ctx))
+	conversations, err := lh.conversations.All()
+	if err != nil {
+		return nil, err
+	}
+	archive.Conversations = conversations
+	archive.History = queryHistory.All()
+	archive.SavedQueries = savedQueries.All()
+	archive.Suggestions = suggestedQuestions.List()
+	archive.OrgContext = orgContext.Versions()
+	archive.Notifications = notificationPrefs.All()
+
+	entries, err := auditLog.Entries()
+	if err != nil && !errors.Is(err, audit.ErrNoFile) {
+		return nil, err
+	}
+	archive.Audit = entries
+
+	if backupConn != nil {
+		tables, err := backup.DumpTables(ctx, backupConn)
+		if err != nil {
+			return nil, err
+		}
+		archive.Tables = tables
+	}
+	return archive, nil
+}
+
+// RestoreHandler replaces the app's data with a backup from BackupHandler.
+// The metadata tables are restored together, or not at all; every other
+// section is restored on its own, and a section that fails is reported
+// without stopping the rest. Audit entries are added to the current log
+// rather than replacing it, so nothing recorded since the backup is lost.
+func (lh *LLMHandler) RestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBackupBytes))
+	if err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+	archive, err := backup.Open(data, backupKeys)
+	if err != nil {
+		auditLog.Record(r.Context(), audit.Entry{Action: "backup_restored", Status: "denied", Details: map[string]interface{}{"error": err.Error()}})
+		writeBackupError(w, r, http.StatusBadRequest, "Invalid backup", err)
+		return
+	}
+
+	report, err := lh.restore(r.Context(), archive)
+	if err != nil {
+		auditLog.Record(r.Context(), audit.Entry{Action: "backup_restored", Status: "error", Details: map[string]interface{}{"error": err.Error()}})
+		writeBackupError(w, r, http.StatusInternalServerError, "Restore failed", err)
+		return
+	}
+	auditLog.Record(r.Context(), audit.Entry{
+		Action: "backup_restored",
+		Status: "ok",
+		Details: map[string]interface{}{
+			"created_at":    archive.CreatedAt,
+			"created_by":    archive.CreatedBy,
+			"conversations": report.Conversations,
+			"audit":         report.Audit,
+			"tables":        len(report.Tables),
+			"skipped":       report.Skipped,
+		},
+	})
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Backup restored", Data: report})
+}
+
+// restore replaces every store's contents with the archive's. It fails only
+// when the metadata tables cannot be restored, before anything else is.
+func (lh *LLMHandler) restore(ctx context.Context, archive *backup.Archive) (RestoreReport, error) {
+	report := RestoreReport{Tables: make(map[string]int)}
+
+	if len(archive.Tables) > 0 {
+		if backupConn == nil {
+			return report, errors.New("no database is configured for the metadata tables")
+		}
+		tables, skipped, err := backup.RestoreTables(ctx, backupConn, archive.Tables)
+		if err != nil {
+			return report, err
+		}
+		report.Tables = tables
+		for _, name := range skipped {
+			report.skip("table "+name, errors.New("not created on this server"))
+		}
+	}
+
+	if err := lh.conversations.Replace(archive.Conversations); err != nil {
+		report.skip("conversations", err)
+	} else {
+		report.Conversations = len(archive.Conversations)
+	}
+
+	if err := queryHistory.Replace(archive.History); err != nil {
+		report.skip("history", err)
+	} else {
+		for _, entries := range archive.History {
+			report.History += len(entries)
+		}
+	}
+	if err := savedQueries.Replace(archive.SavedQueries); err != nil {
+		report.skip("saved_queries", err)
+	} else {
+		for _, queries := range archive.SavedQueries {
+			report.SavedQueries += len(queries)
+		}
+	}
+	if err := suggestedQuestions.Replace(archive.Suggestions); err != nil {
+		report.skip("suggestions", err)
+	} else {
+		report.Suggestions = len(archive.Suggestions)
+	}
+	if err := orgContext.Replace(archive.OrgContext); err != nil {
+		report.skip("org_context", err)
+	} else {
+		report.OrgContext = len(archive.OrgContext)
+	}
+	if err := notificationPrefs.Replace(archive.Notifications); err != nil {
+		report.skip("notifications", err)
+	} else {
+		report.Notifications = len(archive.Notifications)
+	}
+
+	if len(archive.Audit) > 0 {
+		added, err := auditLog.Restore(archive.Audit)
+		if err != nil {
+			report.skip("audit", err)
+		}
+		report.Audit = added
+	}
+	return report, nil
+}
+
+// skip records a section that was not restored and why.
+func (r *RestoreReport) skip(section string, err error) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf("%s: %v", section, err))
+}
+
+// writeBackupError reports a failed backup or restore.
+func writeBackupError(w http.ResponseWriter, r *http.Request, status int, message string, err error) {
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
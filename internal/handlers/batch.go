@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/middleware"
+	"data-chatter/internal/requestid"
+)
+
+// batchPolicy bounds batches of questions.
+type batchPolicy struct {
+	MaxQuestions int           // Questions a batch may hold
+	Concurrency  int           // Questions answered at once
+	Timeout      time.Duration // Time to answer a whole batch
+}
+
+// batchPolicyFromEnv reads LLM_BATCH_MAX_QUESTIONS (default 100),
+// LLM_BATCH_CONCURRENCY (default 4), and LLM_BATCH_TIMEOUT (default 10m).
+func batchPolicyFromEnv() batchPolicy {
+	policy := batchPolicy{MaxQuestions: 100, Concurrency: 4, Timeout: 10 * time.Minute}
+	if value, err := strconv.Atoi(os.Getenv("LLM_BATCH_MAX_QUESTIONS")); err == nil && value > 0 {
+		policy.MaxQuestions = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("LLM_BATCH_CONCURRENCY")); err == nil && value > 0 {
+		policy.Concurrency = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("LLM_BATCH_TIMEOUT")); err == nil && value > 0 {
+		policy.Timeout = value
+	}
+	return policy
+}
+
+// BatchRequest asks several independent questions at once. Each question
+// is a MessageRequest, answered as if posted to /llm/message on its own.
+// Concurrency lowers how many are answered at once.
+type BatchRequest struct {
+	Questions   []MessageRequest `json:"questions"`
+	Concurrency int              `json:"concurrency,omitempty"`
+}
+
+// BatchAnswer is the answer to one question of a batch: the status and
+// body /llm/message would have responded with.
+type BatchAnswer struct {
+	Index    int             `json:"index"`
+	Status   int             `json:"status"`
+	Response json.RawMessage `json:"response"`
+}
+
+// BatchResponse holds the answers to a batch, in the order the questions
+// were asked. Succeeded counts answers with a 2xx status.
+type BatchResponse struct {
+	Message    string          `json:"message"`
+	Answers    []BatchAnswer   `json:"answers,omitempty"`
+	Succeeded  int             `json:"succeeded"`
+	Failed     int             `json:"failed"`
+	DurationMs int64           `json:"duration_ms"`
+	Error      *apierror.Error `json:"error,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+}
+
+// BatchMessageHandler answers a batch of independent questions with
+// bounded concurrency, for jobs such as nightly reports that reuse the chat
+// pipeline. Each question is its own turn, with its own conversation unless
+// it names one, turn budget, access checks, and history entry; a failed
+// question does not stop the others. The response waits for every answer.
+// Each question takes a rate limit token when it starts, as a request to
+// /llm/message would: the batch is refused with 429 when the first is
+// denied, and later questions that are denied are answered with 429.
+func (lh *LLMHandler) BatchMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var request BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeBatchError(w, r, "Invalid request format", err.Error())
+		return
+	}
+	if len(request.Questions) == 0 {
+		writeBatchError(w, r, "Questions are required", "questions must hold at least one question")
+		return
+	}
+	if len(request.Questions) > lh.batch.MaxQuestions {
+		writeBatchError(w, r, "Too many questions", fmt.Sprintf("a batch may hold at most %d questions", lh.batch.MaxQuestions))
+		return
+	}
+	turnIDs := make(map[string]bool, len(request.Questions))
+	for i, question := range request.Questions {
+		switch {
+		case question.TurnID != "" && turnIDs[question.TurnID]:
+			writeBatchError(w, r, "Invalid question", fmt.Sprintf("questions[%d]: turn_id %q is used by another question", i, question.TurnID))
+			return
+		case question.DryRun:
+			writeBatchError(w, r, "Invalid question", fmt.Sprintf("questions[%d]: dry_run is not supported in batches", i))
+			return
+		case question.Summary:
+			writeBatchError(w, r, "Invalid question", fmt.Sprintf(`questions[%d]: summary is streamed after the response and is not supported in batches; use "response_format": "summary"`, i))
+			return
+		}
+		turnIDs[question.TurnID] = true
+	}
+	concurrency := lh.batch.Concurrency
+	if request.Concurrency > 0 {
+		concurrency = min(concurrency, request.Concurrency)
+	}
+
+	if allowed, wait := allowBatchQuestion(r); !allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(middleware.RetryAfterSeconds(wait)))
+		apierror.Write(w, r, http.StatusTooManyRequests, "Too Many Requests", middleware.RateLimitedError(wait))
+		return
+	}
+
+	// Batches take longer to answer than the server's write timeout and
+	// REQUEST_TIMEOUT, so LLM_BATCH_TIMEOUT bounds them instead
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	ctx, cancel := context.WithTimeout(r.Context(), lh.batch.Timeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+
+	start := time.Now()
+	answers := make([]BatchAnswer, len(request.Questions))
+	slots := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, question := range request.Questions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			if i > 0 {
+				if allowed, wait := allowBatchQuestion(r); !allowed {
+					answers[i] = rateLimitedAnswer(r, i, wait)
+					return
+				}
+			}
+			answers[i] = lh.answerBatchQuestion(r, i, question)
+		}()
+	}
+	wg.Wait()
+
+	response := BatchResponse{
+		Answers:    answers,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	for _, answer := range answers {
+		if answer.Status >= 200 && answer.Status < 300 {
+			response.Succeeded++
+		} else {
+			response.Failed++
+		}
+	}
+	response.Message = fmt.Sprintf("Answered %d of %d questions", response.Succeeded, len(answers))
+	slog.InfoContext(r.Context(), "answered question batch", "questions", len(answers), "failed", response.Failed, "concurrency", concurrency, "duration_ms", response.DurationMs)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
+
+// answerBatchQuestion answers one question of a batch through
+// ProcessMessageHandler, with the caller's identity and request ID.
+func (lh *LLMHandler) answerBatchQuestion(r *http.Request, index int, question MessageRequest) BatchAnswer {
+	answer := BatchAnswer{Index: index}
+	body, _ := json.Marshal(question)
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodPost, "/llm/message", bytes.NewReader(body))
+	if err != nil {
+		answer.Status = http.StatusInternalServerError
+		answer.Response, _ = json.Marshal(MessageResponse{
+			Message:   "Failed to build chat request",
+			Error:     apierror.New(apierror.Internal, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return answer
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := &responseBuffer{header: make(http.Header)}
+	lh.ProcessMessageHandler(recorder, req)
+	answer.Status = recorder.status
+	answer.Response = json.RawMessage(bytes.TrimSpace(recorder.body.Bytes()))
+	if answer.Status == 0 || !json.Valid(answer.Response) {
+		answer.Status = max(answer.Status, http.StatusInternalServerError)
+		answer.Response, _ = json.Marshal(MessageResponse{
+			Message:   "The chat handler gave no JSON response",
+			Error:     apierror.New(apierror.Internal, string(answer.Response)),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+	}
+	return answer
+}
+
+// allowBatchQuestion takes a rate limit token for one question of a batch.
+func allowBatchQuestion(r *http.Request) (bool, time.Duration) {
+	if batchLimiter == nil {
+		return true, 0
+	}
+	return batchLimiter.AllowRequest(r)
+}
+
+// rateLimitedAnswer answers a question of a batch denied a rate limit token.
+func rateLimitedAnswer(r *http.Request, index int, wait time.Duration) BatchAnswer {
+	response, _ := json.Marshal(MessageResponse{
+		Message:   "Too Many Requests",
+		Error:     middleware.RateLimitedError(wait),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+	return BatchAnswer{Index: index, Status: http.StatusTooManyRequests, Response: response}
+}
+
+// writeBatchError rejects a batch request with 400.
+func writeBatchError(w http.ResponseWriter, r *http.Request, message, detail string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(BatchResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.InvalidRequest, detail),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
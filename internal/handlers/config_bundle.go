@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/bundle"
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/rbac"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/suggestions"
+)
+
+// maxConfigBundleBytes bounds the size of an imported bundle.
+const maxConfigBundleBytes = 16 << 20
+
+// ConfigImportReport says, for each section of an imported bundle, how many
+// items were applied and why any were skipped.
+type ConfigImportReport struct {
+	Dictionary   ConfigImportSection `json:"dictionary"`
+	OrgContext   ConfigImportSection `json:"org_context"`
+	SavedQueries ConfigImportSection `json:"saved_queries"`
+	Suggestions  ConfigImportSection `json:"suggestions"`
+	Policy       ConfigImportSection `json:"policy"`
+}
+
+// ConfigImportSection is the outcome of importing one section of a bundle.
+type ConfigImportSection struct {
+	Imported int      `json:"imported"`
+	Skipped  []string `json:"skipped,omitempty"`
+}
+
+// skip records an item that was not imported and why.
+func (s *ConfigImportSection) skip(format string, args ...interface{}) {
+	s.Skipped = append(s.Skipped, fmt.Sprintf(format, args...))
+}
+
+// ConfigExportHandler downloads the chat setup, that is the data
+// dictionary, org context, every user's saved queries, the suggested
+// questions, and the access policy, as a bundle signed with
+// CONFIG_BUNDLE_KEY for importing into another environment.
+func ConfigExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	key, err := bundle.KeyFromEnv()
+	if err != nil {
+		writeConfigBundleUnavailable(w, r, err)
+		return
+	}
+
+	entries, err := dataDictionary.List(r.Context(), "")
+	if err != nil {
+		writeConfigBundleError(w, r, http.StatusInternalServerError, "Failed to export config", err)
+		return
+	}
+	contents := bundle.Contents{
+		Dictionary:   entries,
+		SavedQueries: savedQueries.All(),
+		Suggestions:  suggestedQuestions.List(),
+		Policy:       accessControl.Policy(),
+	}
+	if current, ok := orgContext.Current(); ok {
+		contents.OrgContext = current.Content
+	}
+
+	sealed, err := bundle.Seal(contents, auth.UserID(r.Context()), key)
+	if err != nil {
+		writeConfigBundleError(w, r, http.StatusInternalServerError, "Failed to export config", err)
+		return
+	}
+	saved := 0
+	for _, queries := range contents.SavedQueries {
+		saved += len(queries)
+	}
+	auditLog.Record(r.Context(), audit.Entry{
+		Action: "config_exported",
+		Status: "ok",
+		Details: map[string]interface{}{
+			"dictionary":    len(contents.Dictionary),
+			"saved_queries": saved,
+			"suggestions":   len(contents.Suggestions),
+		},
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="data-chatter-config.json"`)
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(sealed)
+}
+
+// ConfigImportHandler applies a bundle from ConfigExportHandler, signed with
+// the same CONFIG_BUNDLE_KEY. Items are merged into the current setup by
+// name: dictionary entries by table and column, saved queries by owner and
+// name, and suggestions by question, replacing those that exist. Queries
+// get the same checks as when they are saved through the API, so items
+// that do not work against this environment's database are skipped and
+// reported rather than imported.
+func ConfigImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	key, err := bundle.KeyFromEnv()
+	if err != nil {
+		writeConfigBundleUnavailable(w, r, err)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigBundleBytes))
+	if err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+	sealed, contents, err := bundle.Open(data, key)
+	if err != nil {
+		auditLog.Record(r.Context(), audit.Entry{Action: "config_imported", Status: "denied", Details: map[string]interface{}{"error": err.Error()}})
+		status := http.StatusBadRequest
+		if errors.Is(err, bundle.ErrBadSignature) {
+			status = http.StatusForbidden
+		}
+		writeConfigBundleError(w, r, status, "Invalid config bundle", err)
+		return
+	}
+
+	report := importConfig(r.Context(), contents)
+	auditLog.Record(r.Context(), audit.Entry{
+		Action: "config_imported",
+		Status: "ok",
+		Details: map[string]interface{}{
+			"exported_at":   sealed.ExportedAt,
+			"exported_by":   sealed.ExportedBy,
+			"dictionary":    report.Dictionary.Imported,
+			"org_context":   report.OrgContext.Imported,
+			"saved_queries": report.SavedQueries.Imported,
+			"suggestions":   report.Suggestions.Imported,
+			"policy":        report.Policy.Imported,
+		},
+	})
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Config imported", Data: report})
+}
+
+// importConfig merges contents into the current setup. The policy is
+// applied first, so the imported queries are checked under the policy they
+// will run under.
+func importConfig(ctx context.Context, contents bundle.Contents) ConfigImportReport {
+	var report ConfigImportReport
+	importer := auth.UserID(ctx)
+
+	if contents.Policy != nil {
+		if err := rbac.SavePolicyToEnv(contents.Policy); err != nil {
+			report.Policy.skip("%v", err)
+		} else {
+			accessControl.SetPolicy(contents.Policy)
+			report.Policy.Imported++
+		}
+	}
+
+	for _, entry := range contents.Dictionary {
+		name := entry.Table
+		if entry.Column != "" {
+			name += "." + entry.Column
+		}
+		if dataDictionary == nil {
+			report.Dictionary.skip("%s: the %s table could not be created", name, dictionary.Table)
+			continue
+		}
+		entry.UpdatedBy = importer
+		if _, err := dataDictionary.Set(ctx, entry); err != nil {
+			report.Dictionary.skip("%s: %v", name, err)
+			continue
+		}
+		report.Dictionary.Imported++
+	}
+
+	if contents.OrgContext != "" {
+		current, _ := orgContext.Current()
+		if current.Content != contents.OrgContext {
+			if _, err := orgContext.Set(contents.OrgContext, importer); err != nil {
+				report.OrgContext.skip("%v", err)
+			} else {
+				report.OrgContext.Imported++
+			}
+		}
+	}
+
+	for _, userID := range slices.Sorted(maps.Keys(contents.SavedQueries)) {
+		for _, query := range contents.SavedQueries[userID] {
+			if err := checkSavedQuery(ctx, query.SQL); err != nil {
+				report.SavedQueries.skip("%s/%s: %v", userID, query.Name, err)
+				continue
+			}
+			if _, err := savedQueries.Put(userID, query); err != nil {
+				report.SavedQueries.skip("%s/%s: %v", userID, query.Name, err)
+				continue
+			}
+			report.SavedQueries.Imported++
+		}
+	}
+
+	existing := make(map[string]string)
+	for _, suggestion := range suggestedQuestions.List() {
+		existing[strings.ToLower(strings.TrimSpace(suggestion.Question))] = suggestion.ID
+	}
+	for _, suggestion := range contents.Suggestions {
+		if err := checkSuggestionQuery(ctx, suggestion.SQL); err != nil {
+			report.Suggestions.skip("%q: %v", suggestion.Question, err)
+			continue
+		}
+		var err error
+		if id, ok := existing[strings.ToLower(strings.TrimSpace(suggestion.Question))]; ok {
+			_, err = suggestedQuestions.Update(id, suggestion)
+		} else {
+			_, err = suggestedQuestions.Add(suggestions.Suggestion{
+				Question:    suggestion.Question,
+				Description: suggestion.Description,
+				SQL:         suggestion.SQL,
+				CreatedBy:   suggestion.CreatedBy,
+			})
+		}
+		if err != nil {
+			report.Suggestions.skip("%q: %v", suggestion.Question, err)
+			continue
+		}
+		report.Suggestions.Imported++
+	}
+
+	return report
+}
+
+// writeConfigBundleUnavailable reports that bundles cannot be signed or
+// checked because no key is configured.
+func writeConfigBundleUnavailable(w http.ResponseWriter, r *http.Request, err error) {
+	writeConfigBundleError(w, r, http.StatusServiceUnavailable, "Config bundles unavailable", err)
+}
+
+// writeConfigBundleError reports a failed export or import.
+func writeConfigBundleError(w http.ResponseWriter, r *http.Request, status int, message string, err error) {
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
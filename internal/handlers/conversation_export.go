@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/conversation"
+	"data-chatter/internal/render"
+)
+
+// Transcript is a shareable record of a conversation: each question, the
+// SQL run to answer it with a summary of what came back, the answer, and
+// the tokens spent.
+type Transcript struct {
+	ConversationID string            `json:"conversation_id"`
+	Database       string            `json:"database,omitempty"`
+	ExportedAt     time.Time         `json:"exported_at"`
+	Turns          []TranscriptTurn  `json:"turns"`
+	InputTokens    int               `json:"input_tokens"`
+	OutputTokens   int               `json:"output_tokens"`
+	Watermark      *render.Watermark `json:"watermark,omitempty"`
+}
+
+// TranscriptTurn is one question and its answer in a transcript.
+type TranscriptTurn struct {
+	Turn         int               `json:"turn"` // Position in the conversation, from 1
+	TurnID       string            `json:"turn_id"`
+	Author       string            `json:"author,omitempty"`
+	AskedAt      time.Time         `json:"asked_at"`
+	Question     string            `json:"question"`
+	Answer       string            `json:"answer,omitempty"`
+	Status       int               `json:"status"`
+	Error        *apierror.Error   `json:"error,omitempty"`
+	Queries      []TranscriptQuery `json:"queries"`
+	InputTokens  int               `json:"input_tokens"`
+	OutputTokens int               `json:"output_tokens"`
+}
+
+// TranscriptQuery summarizes one tool call of a turn: its SQL and the shape
+// of its result, without the rows.
+type TranscriptQuery struct {
+	Tool       string   `json:"tool"`
+	SQL        string   `json:"sql,omitempty"`
+	Status     string   `json:"status"`
+	DurationMs int64    `json:"duration_ms"`
+	Columns    []string `json:"columns,omitempty"`
+	RowCount   *int     `json:"row_count,omitempty"`
+	Error      string   `json:"error,omitempty"`
+}
+
+// ExportConversationHandler downloads a conversation's transcript as
+// markdown (default) or JSON, for attaching an analysis to a ticket. It is
+// readable by the conversation's readers and watermarked like turn exports.
+func (lh *LLMHandler) ExportConversationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	format := render.Format(strings.ToLower(r.URL.Query().Get("format")))
+	if format == "" {
+		format = render.FormatMarkdown
+	}
+	if format != render.FormatMarkdown && format != render.FormatJSON {
+		apierror.WriteInvalidRequest(w, r, fmt.Sprintf("unsupported transcript format %q (use markdown or json)", format))
+		return
+	}
+
+	c, err := lh.conversations.Get(r.PathValue("id"))
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+
+	transcript := buildTranscript(c)
+	transcript.Watermark = lh.exportWatermark(r, c, "")
+
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	if format == render.FormatJSON {
+		err = json.NewEncoder(w).Encode(transcript)
+	} else {
+		err = writeTranscriptMarkdown(w, transcript)
+	}
+	if err != nil {
+		slog.WarnContext(r.Context(), "failed to export transcript", "conversation_id", c.ID, "error", err)
+	}
+}
+
+// buildTranscript summarizes c's turns from their recorded responses.
+func buildTranscript(c *conversation.Conversation) Transcript {
+	transcript := Transcript{
+		ConversationID: c.ID,
+		Database:       c.Database,
+		ExportedAt:     time.Now().UTC(),
+		Turns:          []TranscriptTurn{},
+	}
+	for i, turn := range c.Turns {
+		var response struct {
+			Plan    []PlanStep               `json:"plan"`
+			Results []map[string]interface{} `json:"results"`
+			Error   *apierror.Error          `json:"error"`
+		}
+		json.Unmarshal(turn.Response, &response)
+
+		entry := TranscriptTurn{
+			Turn:         i + 1,
+			TurnID:       turn.TurnID,
+			Author:       turn.Author,
+			AskedAt:      turn.CreatedAt,
+			Question:     turn.Message,
+			Answer:       turn.Reply,
+			Status:       turn.Status,
+			Error:        response.Error,
+			Queries:      []TranscriptQuery{},
+			InputTokens:  turn.InputTokens,
+			OutputTokens: turn.OutputTokens,
+		}
+		for _, step := range response.Plan {
+			query := TranscriptQuery{
+				Tool:       step.Tool,
+				SQL:        step.SQL,
+				Status:     step.Status,
+				DurationMs: step.DurationMs,
+				Error:      step.Error,
+			}
+			query.Columns, query.RowCount = resultShape(response.Results, step.ToolCallID)
+			entry.Queries = append(entry.Queries, query)
+		}
+		transcript.Turns = append(transcript.Turns, entry)
+		transcript.InputTokens += turn.InputTokens
+		transcript.OutputTokens += turn.OutputTokens
+	}
+	return transcript
+}
+
+// resultShape returns the columns and row count of the tabular result from
+// toolCallID, or nil ones when it has none.
+func resultShape(results []map[string]interface{}, toolCallID string) ([]string, *int) {
+	text, ok := exportedResult(results, toolCallID)
+	if !ok || toolCallID == "" {
+		return nil, nil
+	}
+	var payload struct {
+		Columns  []string      `json:"columns"`
+		Data     []interface{} `json:"data"`
+		RowCount *int          `json:"row_count"`
+	}
+	json.Unmarshal([]byte(text), &payload)
+	if payload.RowCount == nil {
+		rows := len(payload.Data)
+		payload.RowCount = &rows
+	}
+	return payload.Columns, payload.RowCount
+}
+
+// writeTranscriptMarkdown writes a transcript as a markdown document, with
+// a section per turn.
+func writeTranscriptMarkdown(w io.Writer, t Transcript) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Conversation %s\n\n", t.ConversationID)
+	if t.Database != "" {
+		fmt.Fprintf(&b, "- Database: %s\n", t.Database)
+	}
+	fmt.Fprintf(&b, "- Exported: %s\n", t.ExportedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Turns: %d\n", len(t.Turns))
+	fmt.Fprintf(&b, "- Tokens: %d input, %d output\n", t.InputTokens, t.OutputTokens)
+
+	for _, turn := range t.Turns {
+		fmt.Fprintf(&b, "\n## Turn %d\n\n", turn.Turn)
+		asked := "Asked " + turn.AskedAt.UTC().Format(time.RFC3339)
+		if turn.Author != "" {
+			asked += " by " + turn.Author
+		}
+		fmt.Fprintf(&b, "_%s_\n\n", asked)
+		b.WriteString("> " + strings.ReplaceAll(strings.TrimSpace(turn.Question), "\n", "\n> ") + "\n")
+
+		for i, query := range turn.Queries {
+			fmt.Fprintf(&b, "\n**Step %d: %s** (%s, %d ms)", i+1, query.Tool, query.Status, query.DurationMs)
+			switch {
+			case query.Error != "":
+				fmt.Fprintf(&b, ": %s", query.Error)
+			case query.RowCount != nil:
+				fmt.Fprintf(&b, ": %d rows", *query.RowCount)
+				if len(query.Columns) > 0 {
+					fmt.Fprintf(&b, " of %s", strings.Join(query.Columns, ", "))
+				}
+			}
+			b.WriteString("\n")
+			if query.SQL != "" {
+				fmt.Fprintf(&b, "\n```sql\n%s\n```\n", strings.TrimSpace(query.SQL))
+			}
+		}
+
+		if turn.Answer != "" {
+			fmt.Fprintf(&b, "\n%s\n", strings.TrimSpace(turn.Answer))
+		}
+		if turn.Error != nil {
+			fmt.Fprintf(&b, "\n**Error** (`%s`): %s\n", turn.Error.Code, turn.Error.Message)
+		}
+		fmt.Fprintf(&b, "\n_Tokens: %d input, %d output_\n", turn.InputTokens, turn.OutputTokens)
+	}
+
+	if _, err := io.WriteString(w, b.String()); err != nil || t.Watermark == nil {
+		return err
+	}
+	return render.WriteMarkdownFooter(w, *t.Watermark)
+}
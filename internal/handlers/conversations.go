@@ -0,0 +1,409 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/conversation"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/presence"
+	"data-chatter/internal/requestid"
+)
+
+type conversationKey struct{}
+
+// withConversationID returns a copy of ctx carrying the turn's conversation.
+func withConversationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, conversationKey{}, id)
+}
+
+// conversationIDFromContext returns the turn's conversation ID, or "".
+func conversationIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(conversationKey{}).(string)
+	return id
+}
+
+// conversationOwner identifies the caller as a conversation owner; it is
+// empty when authentication is disabled, unless the caller belongs to a
+// tenant, whose conversations stay its own.
+func conversationOwner(ctx context.Context) string {
+	if auth.UserFromContext(ctx) != nil || auth.TenantID(ctx) != "" {
+		return auth.UserID(ctx)
+	}
+	return ""
+}
+
+// visibleTo reports whether the caller in ctx may read c, comment on it, and
+// add turns to it: its owner and the users it is shared with.
+func visibleTo(ctx context.Context, c *conversation.Conversation) bool {
+	caller := conversationOwner(ctx)
+	return ownedBy(ctx, c) || (caller != "" && slices.Contains(c.SharedWith, caller))
+}
+
+// ownedBy reports whether the caller in ctx may share c and delete others' comments.
+func ownedBy(ctx context.Context, c *conversation.Conversation) bool {
+	return c.Owner == "" || c.Owner == conversationOwner(ctx)
+}
+
+// resolveConversation returns the conversation a message belongs to,
+// starting a new one when the request names none.
+func (lh *LLMHandler) resolveConversation(ctx context.Context, request MessageRequest) (*conversation.Conversation, error) {
+	if request.ConversationID == "" {
+		return lh.conversations.Create(conversationOwner(ctx))
+	}
+	c, err := lh.conversations.Get(request.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+	if !visibleTo(ctx, c) {
+		return nil, conversation.ErrNotFound
+	}
+	return c, nil
+}
+
+// recordTurn appends a finished turn, with the response it produced, to its
+// conversation, its queries to the caller's history, and its statistics to
+// the usage digest's.
+func (lh *LLMHandler) recordTurn(ctx context.Context, conversationID string, request MessageRequest, recorder *turnRecorder) {
+	var response MessageResponse
+	json.Unmarshal(recorder.body.Bytes(), &response)
+
+	usage := llm.MeteredUsage(ctx)
+	turn := conversation.Turn{
+		TurnID:       request.TurnID,
+		Message:      request.Message,
+		Reply:        response.Message,
+		Status:       recorder.status,
+		Author:       auth.UserID(ctx),
+		Response:     json.RawMessage(bytes.TrimSpace(recorder.body.Bytes())),
+		InputTokens:  usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens,
+		OutputTokens: usage.OutputTokens,
+	}
+	if err := lh.conversations.Append(conversationID, turn); err != nil {
+		slog.WarnContext(ctx, "failed to record turn", "conversation_id", conversationID, "turn_id", request.TurnID, "error", err)
+	}
+	lh.recordTrace(ctx, conversationID, request, recorder.status, response)
+	recordHistory(ctx, request, recorder.status, response)
+	recordStats(ctx, request, recorder.status, response)
+	lh.presence.Broadcast(presence.Event{
+		Type:           presence.TurnFinished,
+		ConversationID: conversationID,
+		UserID:         turn.Author,
+		TurnID:         turn.TurnID,
+		Message:        turn.Reply,
+		Status:         turn.Status,
+	})
+}
+
+// announceTurn tells everyone watching the conversation that the caller asked a question.
+func (lh *LLMHandler) announceTurn(ctx context.Context, request MessageRequest) {
+	lh.presence.Broadcast(presence.Event{
+		Type:           presence.TurnStarted,
+		ConversationID: request.ConversationID,
+		UserID:         auth.UserID(ctx),
+		TurnID:         request.TurnID,
+		Message:        request.Message,
+	})
+}
+
+// turnRecorder passes a chat response through while keeping a copy for the
+// conversation store.
+type turnRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (tr *turnRecorder) WriteHeader(code int) {
+	if tr.status == 0 {
+		tr.status = code
+	}
+	tr.ResponseWriter.WriteHeader(code)
+}
+
+func (tr *turnRecorder) Write(p []byte) (int, error) {
+	if tr.status == 0 {
+		tr.status = http.StatusOK
+	}
+	tr.body.Write(p)
+	return tr.ResponseWriter.Write(p)
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (tr *turnRecorder) Unwrap() http.ResponseWriter {
+	return tr.ResponseWriter
+}
+
+// ForkRequest selects where to fork a conversation. Without a turn ID the
+// fork copies every turn.
+type ForkRequest struct {
+	TurnID string `json:"turn_id,omitempty"`
+}
+
+// ConversationHandler returns a conversation's turns and its parent and child links.
+func (lh *LLMHandler) ConversationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	c, err := lh.conversations.Get(r.PathValue("id"))
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c)
+}
+
+// ForkConversationHandler starts a new conversation from a conversation's
+// turns up to and including the requested turn, leaving the original intact.
+// Messages sent with the fork's ID continue from that turn.
+func (lh *LLMHandler) ForkConversationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var request ForkRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+	}
+
+	id := r.PathValue("id")
+	parent, err := lh.conversations.Get(id)
+	if err != nil || !visibleTo(r.Context(), parent) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+
+	fork, err := lh.conversations.Fork(id, request.TurnID, conversationOwner(r.Context()))
+	if errors.Is(err, conversation.ErrNotFound) {
+		writeConversationNotFound(w, r, "No turn with that ID in the conversation")
+		return
+	} else if err != nil {
+		apierror.Write(w, r, http.StatusInternalServerError, "Failed to fork conversation", apierror.New(apierror.Internal, err.Error()))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fork)
+}
+
+// ShareRequest lists users to share a conversation with.
+type ShareRequest struct {
+	Users []string `json:"users"`
+}
+
+// ShareConversationHandler lets a conversation's owner share it with other
+// users, who can then read it and comment on its results.
+func (lh *LLMHandler) ShareConversationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var request ShareRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+	if len(request.Users) == 0 {
+		apierror.WriteInvalidRequest(w, r, "users is required")
+		return
+	}
+
+	id := r.PathValue("id")
+	c, err := lh.conversations.Get(id)
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+	if !ownedBy(r.Context(), c) {
+		writeConversationError(w, r, http.StatusForbidden, "Forbidden", "Only the conversation's owner can share it")
+		return
+	}
+
+	// Conversations are only shared within the caller's tenant
+	users := make([]string, len(request.Users))
+	for i, user := range request.Users {
+		users[i] = auth.TenantUserID(r.Context(), user)
+	}
+	shared, err := lh.conversations.Share(id, users)
+	if err != nil {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(shared)
+}
+
+// CommentRequest annotates a row of a turn's merged result rows, or a single
+// cell when Column is set.
+type CommentRequest struct {
+	Row    *int   `json:"row"`
+	Column string `json:"column,omitempty"`
+	Text   string `json:"text"`
+}
+
+// maxCommentLength bounds a comment's text.
+const maxCommentLength = 2000
+
+// CommentHandler attaches a comment to a row or cell of a turn's results.
+// Rows are numbered as in the turn's "rows", starting at 0.
+func (lh *LLMHandler) CommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var request CommentRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+	request.Text = strings.TrimSpace(request.Text)
+	if request.Row == nil || request.Text == "" || len(request.Text) > maxCommentLength {
+		writeConversationError(w, r, http.StatusBadRequest, "Invalid comment",
+			fmt.Sprintf("row and text are required; text is limited to %d characters", maxCommentLength))
+		return
+	}
+
+	id, turnID := r.PathValue("id"), r.PathValue("turn")
+	c, err := lh.conversations.Get(id)
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+	turn, ok := findTurn(c, turnID)
+	if !ok || turnID == "" {
+		writeConversationNotFound(w, r, "No turn with that ID in the conversation")
+		return
+	}
+	if detail := checkCommentTarget(turn, *request.Row, request.Column); detail != "" {
+		writeConversationError(w, r, http.StatusBadRequest, "Invalid comment", detail)
+		return
+	}
+
+	comment, err := lh.conversations.AddComment(id, turnID, conversation.Comment{
+		Row:    *request.Row,
+		Column: request.Column,
+		Text:   request.Text,
+		Author: auth.UserID(r.Context()),
+	})
+	if err != nil {
+		writeConversationNotFound(w, r, "No turn with that ID in the conversation")
+		return
+	}
+
+	lh.presence.Broadcast(presence.Event{
+		Type:           presence.CommentAdded,
+		ConversationID: id,
+		UserID:         comment.Author,
+		TurnID:         turnID,
+		Data:           comment,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// DeleteCommentHandler removes a comment. Only its author and the
+// conversation's owner may delete it.
+func (lh *LLMHandler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	id, commentID := r.PathValue("id"), r.PathValue("comment")
+	c, err := lh.conversations.Get(id)
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+
+	var comment *conversation.Comment
+	for _, turn := range c.Turns {
+		for i := range turn.Comments {
+			if turn.Comments[i].ID == commentID {
+				comment = &turn.Comments[i]
+			}
+		}
+	}
+	if comment == nil {
+		writeConversationNotFound(w, r, "No comment with that ID in the conversation")
+		return
+	}
+	if comment.Author != auth.UserID(r.Context()) && !ownedBy(r.Context(), c) {
+		writeConversationError(w, r, http.StatusForbidden, "Forbidden", "Only the comment's author or the conversation's owner can delete it")
+		return
+	}
+
+	if err := lh.conversations.DeleteComment(id, commentID); err != nil {
+		writeConversationNotFound(w, r, "No comment with that ID in the conversation")
+		return
+	}
+	lh.presence.Broadcast(presence.Event{
+		Type:           presence.CommentDeleted,
+		ConversationID: id,
+		UserID:         auth.UserID(r.Context()),
+		Data:           map[string]string{"comment_id": commentID},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkCommentTarget returns why row and column do not name a row or cell of
+// the turn's merged result rows, or "" if they do.
+func checkCommentTarget(turn conversation.Turn, row int, column string) string {
+	var recorded struct {
+		Rows []map[string]interface{} `json:"rows"`
+	}
+	json.Unmarshal(turn.Response, &recorded)
+
+	if row < 0 || row >= len(recorded.Rows) {
+		return fmt.Sprintf("row must be between 0 and %d", len(recorded.Rows)-1)
+	}
+	if column == "" {
+		return ""
+	}
+	if _, exists := recorded.Rows[row][column]; !exists || column == "_source" {
+		return fmt.Sprintf("row %d has no column %q", row, column)
+	}
+	return ""
+}
+
+// writeConversationNotFound reports an unknown or inaccessible conversation, turn, or comment.
+func writeConversationNotFound(w http.ResponseWriter, r *http.Request, detail string) {
+	writeConversationError(w, r, http.StatusNotFound, "Conversation not found", detail)
+}
+
+// writeConversationError writes a JSON error for a conversation endpoint.
+func writeConversationError(w http.ResponseWriter, r *http.Request, status int, message, detail string) {
+	response := APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), detail),
+		RequestID: requestid.FromContext(r.Context()),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"data-chatter/internal/units"
+)
+
+// recentTurnLimit bounds how many turns' results are kept for follow-up questions.
+const recentTurnLimit = 100
+
+// turnResultCache keeps the tool results of recent turns so follow-ups such as
+// "in EUR" can be answered without another LLM or database round-trip.
+type turnResultCache struct {
+	mu      sync.Mutex
+	order   []string
+	entries map[string][]map[string]interface{}
+}
+
+// newTurnResultCache creates an empty cache.
+func newTurnResultCache() *turnResultCache {
+	return &turnResultCache{
+		entries: make(map[string][]map[string]interface{}),
+	}
+}
+
+// Put stores the results of a turn, evicting the oldest turn when full.
+func (c *turnResultCache) Put(turnID string, results []map[string]interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[turnID]; !exists {
+		c.order = append(c.order, turnID)
+	}
+	c.entries[turnID] = results
+
+	for len(c.order) > recentTurnLimit {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// Get returns the results stored for a turn.
+func (c *turnResultCache) Get(turnID string) ([]map[string]interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	results, exists := c.entries[turnID]
+	return results, exists
+}
+
+// convertToolResults applies a unit conversion to every query result in results,
+// returning converted copies and the conversions that were applied.
+// Results that are not tabular query output are passed through unchanged.
+func convertToolResults(ctx context.Context, converter *units.Converter, results []map[string]interface{}, target string) ([]map[string]interface{}, []units.Conversion, error) {
+	converted := make([]map[string]interface{}, 0, len(results))
+	var allConversions []units.Conversion
+
+	for _, result := range results {
+		content, _ := result["content"].([]interface{})
+		if len(content) == 0 {
+			converted = append(converted, result)
+			continue
+		}
+		block, _ := content[0].(map[string]interface{})
+		text, _ := block["text"].(string)
+
+		var payload struct {
+			Query    string                   `json:"query"`
+			Database string                   `json:"database"`
+			Columns  []string                 `json:"columns"`
+			RowCount int                      `json:"row_count"`
+			Data     []map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(text), &payload); err != nil || payload.Columns == nil {
+			converted = append(converted, result)
+			continue
+		}
+
+		columns, conversions, err := converter.ConvertRows(ctx, payload.Columns, payload.Data, target)
+		if err != nil {
+			return nil, nil, err
+		}
+		allConversions = append(allConversions, conversions...)
+
+		newText, _ := json.MarshalIndent(map[string]interface{}{
+			"query":       payload.Query,
+			"database":    payload.Database,
+			"columns":     columns,
+			"row_count":   payload.RowCount,
+			"data":        payload.Data,
+			"conversions": conversions,
+		}, "", "  ")
+
+		copied := make(map[string]interface{}, len(result))
+		for k, v := range result {
+			copied[k] = v
+		}
+		copied["content"] = []interface{}{map[string]interface{}{"type": "text", "text": string(newText)}}
+		converted = append(converted, copied)
+	}
+
+	return converted, allConversions, nil
+}
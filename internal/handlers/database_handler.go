@@ -4,75 +4,272 @@ package handlers
 import (
 	"encoding/json"
 	"net/http"
+	"strings"
 
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
 	"data-chatter/internal/database"
+	"data-chatter/internal/render"
 	"data-chatter/internal/tools"
+	"data-chatter/internal/types"
 )
 
 // DatabaseHandler provides direct database query access for API clients.
 type DatabaseHandler struct {
 	queryTool *tools.DatabaseQueryTool
+	export    exportPolicy
 }
 
 // NewDatabaseHandler creates a new database handler with query tool.
 func NewDatabaseHandler(conn *database.Connection) *DatabaseHandler {
 	return &DatabaseHandler{
 		queryTool: tools.NewDatabaseQueryTool(conn),
+		export:    exportPolicyFromEnv(),
 	}
 }
 
-// QueryRequest represents a database query request.
+// QueryRequest represents a database query request. Format selects json
+// (default), csv, or markdown output; Nulls selects how NULLs appear
+// (null, empty, or na).
 type QueryRequest struct {
-	Query string `json:"query"`
+	Query  string `json:"query"`
+	Format string `json:"format,omitempty"`
+	Nulls  string `json:"nulls,omitempty"`
 }
 
-// QueryHandler executes direct database queries and returns results as JSON.
+// QueryHandler executes direct database queries and returns results as JSON,
+// CSV, or markdown.
 func (dh *DatabaseHandler) QueryHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.WriteMethodNotAllowed(w, r)
 		return
 	}
 
 	var request QueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		http.Error(w, "Invalid request format", http.StatusBadRequest)
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
 		return
 	}
 
 	if request.Query == "" {
-		http.Error(w, "Query is required", http.StatusBadRequest)
+		apierror.WriteInvalidRequest(w, r, "query is required")
+		return
+	}
+
+	format, err := render.ParseFormat(request.Format)
+	if err != nil {
+		apierror.WriteInvalidRequest(w, r, err.Error())
+		return
+	}
+	nulls, err := render.ParseNullStyle(request.Nulls)
+	if err != nil {
+		apierror.WriteInvalidRequest(w, r, err.Error())
 		return
 	}
 
 	input := map[string]interface{}{
 		"query": request.Query,
 	}
+	if err := dh.queryTool.Validate(input); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid query", apierror.New(types.ErrorValidation, err.Error()))
+		return
+	}
 
-	result, err := dh.queryTool.Execute(input)
+	if err := accessControl.AuthorizeQuery(r.Context(), request.Query); err != nil {
+		auditLog.Record(r.Context(), audit.Entry{
+			Action:  "db_query",
+			Status:  "denied",
+			Details: map[string]interface{}{"query": request.Query, "error": err.Error()},
+		})
+		apierror.Write(w, r, http.StatusForbidden, "Query not permitted", apierror.New(apierror.QueryForbidden, err.Error()))
+		return
+	}
+
+	result, err := dh.queryTool.Execute(r.Context(), input)
+	auditLog.Record(r.Context(), audit.Entry{
+		Action:  "db_query",
+		Status:  queryStatus(result, err),
+		Details: map[string]interface{}{"query": request.Query},
+	})
 	if err != nil {
-		http.Error(w, "Query execution failed", http.StatusInternalServerError)
+		apierror.Write(w, r, http.StatusInternalServerError, "Query failed", apierror.New(apierror.Internal, "Query execution failed"))
+		return
+	}
+
+	if result.IsError && result.Error != nil {
+		apierror.Write(w, r, toolErrorStatus(result.Error.Code), "Query failed", toolAPIError(result.Error))
 		return
 	}
 
 	if len(result.Content) > 0 {
-		var data interface{}
-		if err := json.Unmarshal([]byte(result.Content[0].Text), &data); err != nil {
-			http.Error(w, "Failed to parse query result", http.StatusInternalServerError)
-			return
+		if err := writeQueryResult(w, result.Content[0].Text, format, nulls, nil); err != nil {
+			apierror.Write(w, r, http.StatusInternalServerError, "Query failed", apierror.New(apierror.Internal, "Failed to parse query result"))
 		}
+	} else {
+		apierror.Write(w, r, http.StatusInternalServerError, "Query failed", apierror.New(apierror.Internal, "No data returned"))
+	}
+}
 
+// toolAPIError returns a tool's error as the error of an API response, with
+// its driver code and whether it is retryable as details.
+func toolAPIError(toolError *types.ToolError) *apierror.Error {
+	details := map[string]interface{}{"retryable": toolError.Retryable}
+	if toolError.DriverCode != "" {
+		details["driver_code"] = toolError.DriverCode
+	}
+	return apierror.New(toolError.Code, toolError.Message).WithDetails(details)
+}
+
+// toolErrorStatus maps a tool error code to the HTTP status for direct API calls.
+func toolErrorStatus(code string) int {
+	switch code {
+	case types.ErrorValidation, types.ErrorSyntax, types.ErrorUndefinedObject:
+		return http.StatusBadRequest
+	case types.ErrorPermissionDenied:
+		return http.StatusForbidden
+	case types.ErrorTimeout:
+		return http.StatusGatewayTimeout
+	case types.ErrorCancelled:
+		return statusClientClosedRequest
+	case types.ErrorTooManyRows, types.ErrorResourceLimit:
+		return http.StatusUnprocessableEntity
+	case types.ErrorLockConflict:
+		return http.StatusConflict
+	case types.ErrorConnection, types.ErrorUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// writeQueryResult renders a database_query payload in the requested format.
+// Payloads without columns, such as query errors, are always returned as JSON.
+// A watermark, when given, is added as a "watermark" field in JSON and as a
+// footer in CSV and markdown.
+func writeQueryResult(w http.ResponseWriter, text string, format render.Format, nulls render.NullStyle, watermark *render.Watermark) error {
+	var data map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return err
+	}
+
+	var rows []map[string]interface{}
+	values, _ := data["data"].([]interface{})
+	for _, value := range values {
+		if row, ok := value.(map[string]interface{}); ok {
+			rows = append(rows, row)
+		}
+	}
+	var columns []string
+	values, hasColumns := data["columns"].([]interface{})
+	for _, value := range values {
+		column, _ := value.(string)
+		columns = append(columns, column)
+	}
+
+	if format == render.FormatJSON || !hasColumns {
+		render.ApplyNulls(rows, nulls)
+		if watermark != nil {
+			data["watermark"] = watermark
+		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(data)
-	} else {
-		http.Error(w, "No data returned", http.StatusInternalServerError)
+		return json.NewEncoder(w).Encode(data)
+	}
+
+	cells := render.Cells(columns, rows, nulls)
+	w.Header().Set("Content-Type", format.ContentType())
+	w.WriteHeader(http.StatusOK)
+	if format == render.FormatCSV {
+		if err := render.WriteCSV(w, columns, cells); err != nil || watermark == nil {
+			return err
+		}
+		return render.WriteCSVFooter(w, *watermark)
+	}
+	if err := render.WriteMarkdown(w, columns, cells); err != nil || watermark == nil {
+		return err
 	}
+	return render.WriteMarkdownFooter(w, *watermark)
+}
+
+// ArrowQueryHandler executes a direct database query and streams the result
+// as an Arrow IPC stream for analytics clients. Errors before any data is
+// sent are returned as HTTP errors; a failure mid-stream aborts the
+// connection so the client sees a truncated stream rather than a partial result.
+func (dh *DatabaseHandler) ArrowQueryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var request QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+
+	input := map[string]interface{}{
+		"query": request.Query,
+	}
+	if err := dh.queryTool.Validate(input); err != nil {
+		apierror.Write(w, r, http.StatusBadRequest, "Invalid query", apierror.New(types.ErrorValidation, err.Error()))
+		return
+	}
+
+	if err := accessControl.AuthorizeQuery(r.Context(), request.Query); err != nil {
+		auditLog.Record(r.Context(), audit.Entry{
+			Action:  "db_query_arrow",
+			Status:  "denied",
+			Details: map[string]interface{}{"query": request.Query, "error": err.Error()},
+		})
+		apierror.Write(w, r, http.StatusForbidden, "Query not permitted", apierror.New(apierror.QueryForbidden, err.Error()))
+		return
+	}
+
+	stream := &startedWriter{ResponseWriter: w}
+	rowCount, err := dh.queryTool.StreamArrow(r.Context(), request.Query, stream)
+
+	entry := audit.Entry{
+		Action:  "db_query_arrow",
+		Status:  "ok",
+		Details: map[string]interface{}{"query": request.Query, "row_count": rowCount},
+	}
+	if err != nil {
+		entry.Status = "error"
+		entry.Details["error"] = err.Error()
+	}
+	auditLog.Record(r.Context(), entry)
+
+	if err != nil {
+		if stream.started {
+			panic(http.ErrAbortHandler)
+		}
+		code, _ := database.ClassifyError(err)
+		apierror.Write(w, r, toolErrorStatus(code), "Query failed", apierror.New(code, err.Error()))
+	}
+}
+
+// startedWriter sets the Arrow content type on the first write and records
+// that the response has begun.
+type startedWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (sw *startedWriter) Write(p []byte) (int, error) {
+	if !sw.started {
+		sw.started = true
+		sw.ResponseWriter.Header().Set("Content-Type", tools.ArrowStreamContentType)
+		sw.ResponseWriter.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(p)
 }
 
 // SchemaHandler returns a simple message since schema is now handled by LLM client.
 func (dh *DatabaseHandler) SchemaHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.WriteMethodNotAllowed(w, r)
 		return
 	}
 
@@ -85,3 +282,11 @@ func (dh *DatabaseHandler) SchemaHandler(w http.ResponseWriter, r *http.Request)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
+
+// queryStatus summarizes a query outcome for the audit log.
+func queryStatus(result *types.ToolResult, err error) string {
+	if err != nil || (result != nil && result.IsError) {
+		return "error"
+	}
+	return "ok"
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/catalog"
+	"data-chatter/internal/conversation"
+	"data-chatter/internal/database"
+	"data-chatter/internal/types"
+)
+
+// errDatabaseSelection is wrapped by requests for a database a session
+// cannot switch to.
+var errDatabaseSelection = errors.New("cannot select database")
+
+// DatabasesHandler lists the databases a chat session may switch to with the
+// database field of /llm/message.
+func DatabasesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	databases := namedDatabases.List()
+	if auth.TenantID(r.Context()) != "" {
+		databases = databases[:1]
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIResponse{Message: "Databases", Data: databases})
+}
+
+// routeSession switches conv to the database named by selection, when set,
+// and returns ctx routed to the database conv's turns run on. The switch
+// holds for the conversation's later turns; "default" switches back.
+// Tenants have only their own database.
+func (lh *LLMHandler) routeSession(ctx context.Context, conv *conversation.Conversation, selection string) (context.Context, error) {
+	previous := conv.Database
+	if selection != "" {
+		if auth.TenantID(ctx) != "" && selection != catalog.Default {
+			return nil, fmt.Errorf("%w: database selection is not available in multi-tenant mode", errDatabaseSelection)
+		}
+		if _, err := namedDatabases.Lookup(selection); err != nil {
+			return nil, fmt.Errorf("%w: %v", errDatabaseSelection, err)
+		}
+		if selection == catalog.Default {
+			selection = ""
+		}
+		if selection != conv.Database {
+			if err := lh.conversations.SetDatabase(conv.ID, selection); err != nil {
+				return nil, err
+			}
+			conv.Database = selection
+		}
+	}
+
+	conn, err := namedDatabases.Lookup(conv.Database)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDatabaseSelection, err)
+	}
+	if conn != nil {
+		ctx = database.WithConnection(ctx, conn)
+	}
+	if conv.Database != previous {
+		auditLog.Record(ctx, audit.Entry{Action: "database_selected", ConversationID: conv.ID, Status: "ok", Details: map[string]interface{}{
+			"previous": previous,
+		}})
+	}
+	return ctx, nil
+}
+
+// routeToolCall returns ctx routed to the named database in toolCall's
+// metadata, which a chat turn's tool calls carry from their session.
+func routeToolCall(ctx context.Context, toolCall types.ToolCall) (context.Context, error) {
+	return routeDatabase(ctx, types.CallContextFromMetadata(toolCall.Metadata).Database)
+}
+
+// routeDatabase returns ctx routed to the named database, or ctx itself for
+// the default database.
+func routeDatabase(ctx context.Context, name string) (context.Context, error) {
+	if name == "" || name == catalog.Default {
+		return ctx, nil
+	}
+	if auth.TenantID(ctx) != "" {
+		return nil, fmt.Errorf("%w: database selection is not available in multi-tenant mode", errDatabaseSelection)
+	}
+	conn, err := namedDatabases.Lookup(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errDatabaseSelection, err)
+	}
+	return database.WithConnection(ctx, conn), nil
+}
+
+// sessionDatabase returns the name of the database ctx is routed to by its
+// session, or "" for the default database.
+func sessionDatabase(ctx context.Context) string {
+	if conn := database.ConnectionFromContext(ctx); conn != nil {
+		return conn.Name
+	}
+	return ""
+}
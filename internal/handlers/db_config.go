@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/database"
+)
+
+// DatabaseConfigRequest names the database to point the default connection
+// at. Type, when set, must be the current database type; fields of Target
+// left empty keep the values the server started with.
+type DatabaseConfigRequest struct {
+	Type string `json:"type,omitempty"`
+	database.Target
+}
+
+// DatabaseConfig describes the database the default connection's queries
+// run on, without its password. Generation counts the swaps so far.
+type DatabaseConfig struct {
+	Type       string `json:"type"`
+	Host       string `json:"host,omitempty"`
+	Port       int    `json:"port,omitempty"`
+	User       string `json:"user,omitempty"`
+	DBName     string `json:"dbname,omitempty"`
+	SSLMode    string `json:"sslmode,omitempty"`
+	File       string `json:"file,omitempty"`
+	Generation int    `json:"generation"`
+}
+
+// DatabaseConfigHandler shows the database chat turns, tools, and direct
+// queries run on (GET), and points them at another database without a
+// restart (POST). The new connection is made and pinged before anything
+// changes, then swapped in at once; queries already running finish on the
+// old one. The server's own tables, tenants' databases, and named databases
+// stay where they are.
+func (lh *LLMHandler) DatabaseConfigHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Database config", Data: describeDatabase(lh.db.Active())})
+
+	case http.MethodPost:
+		var request DatabaseConfigRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		if request.Type != "" && request.Type != lh.db.Config.Type {
+			apierror.WriteInvalidRequest(w, r, "type "+request.Type+" differs from the server's "+lh.db.Config.Type+"; changing the database type needs a restart")
+			return
+		}
+		if request.Target == (database.Target{}) {
+			apierror.WriteInvalidRequest(w, r, "a database to connect to is required")
+			return
+		}
+
+		conn, err := lh.db.Swap(request.Target)
+		if err != nil {
+			auditLog.Record(r.Context(), audit.Entry{Action: "database_swapped", Status: "error", Details: map[string]interface{}{"error": err.Error()}})
+			apierror.Write(w, r, http.StatusBadRequest, "Database config not applied", apierror.New(apierror.InvalidRequest, err.Error()))
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{
+			Action: "database_swapped",
+			Status: "ok",
+			Details: map[string]interface{}{
+				"source":     conn.Config.SourceName(),
+				"generation": conn.Generation,
+			},
+		})
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Database config applied", Data: describeDatabase(conn)})
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// describeDatabase describes the database conn is connected to.
+func describeDatabase(conn *database.Connection) DatabaseConfig {
+	config := DatabaseConfig{Type: conn.Config.Type, Generation: conn.Generation}
+	switch conn.Config.Type {
+	case "sqlite", "duckdb":
+		config.File = conn.Config.FilePath
+	default:
+		config.Host, config.Port, config.User = conn.Config.Host, conn.Config.Port, conn.Config.User
+		config.DBName, config.SSLMode = conn.Config.DBName, conn.Config.SSLMode
+	}
+	return config
+}
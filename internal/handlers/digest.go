@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/digest"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/sqlparse"
+)
+
+// recordStats saves a finished turn's statistics for the usage digest, with
+// the LLM tokens metered on ctx. Turns waiting for confirmation are left
+// out; they are recorded once confirmed.
+func recordStats(ctx context.Context, request MessageRequest, status int, response MessageResponse) {
+	if response.Pending {
+		return
+	}
+
+	usage := llm.MeteredUsage(ctx)
+	turn := digest.Turn{
+		TurnID:         request.TurnID,
+		UserID:         auth.UserID(ctx),
+		ConversationID: request.ConversationID,
+		Question:       request.Message,
+		Status:         status,
+		InputTokens:    usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens,
+		OutputTokens:   usage.OutputTokens,
+	}
+	if response.Error != nil {
+		turn.Error = response.Error.Message
+	}
+	for _, step := range response.Plan {
+		if step.Status != "ok" {
+			turn.FailedSteps++
+		}
+		if step.Attempts > 1 {
+			turn.Retries += step.Attempts - 1
+		}
+		for _, table := range sqlparse.ReferencedTables(step.SQL) {
+			table = strings.ToLower(table)
+			if !slices.Contains(turn.Tables, table) {
+				turn.Tables = append(turn.Tables, table)
+			}
+		}
+	}
+	if err := turnStats.Record(ctx, turn); err != nil {
+		slog.WarnContext(ctx, "failed to record turn statistics", "turn_id", request.TurnID, "error", err)
+	}
+}
+
+// recordSummaryStats adds the LLM tokens metered on ctx while summarizing a
+// turn's results to its statistics.
+func recordSummaryStats(ctx context.Context, turnID string) {
+	usage := llm.MeteredUsage(ctx)
+	input := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	if err := turnStats.AddTokens(ctx, turnID, input, usage.OutputTokens); err != nil {
+		slog.WarnContext(ctx, "failed to record summary tokens", "turn_id", turnID, "error", err)
+	}
+}
+
+const (
+	// defaultUsageWindow and maxUsageWindow are the default and longest
+	// periods GET /admin/usage covers.
+	defaultUsageWindow = 30 * 24 * time.Hour
+	maxUsageWindow     = 2 * 365 * 24 * time.Hour
+)
+
+// UsageHandler reports usage day by day over ?since= (default 720h, at
+// most two years), with the period's digest summary. Whole days are read
+// from the daily rollups, so long periods stay fast.
+func UsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if turnStats == nil {
+		writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+			Message:   "Usage unavailable",
+			Error:     apierror.New(apierror.FeatureUnavailable, "the "+digest.Table+" table could not be created; check the database user's permissions"),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+
+	window := defaultUsageWindow
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 || parsed > maxUsageWindow {
+			writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+				Message:   "Invalid since",
+				Error:     apierror.New(apierror.InvalidRequest, "since must be a positive duration like \"720h\", at most \"17520h\""),
+				RequestID: requestid.FromContext(r.Context()),
+			})
+			return
+		}
+		window = parsed
+	}
+
+	now := time.Now()
+	usage, err := turnStats.Usage(r.Context(), now.Add(-window), now)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "failed to read usage", "error", err)
+		writeAdminResponse(w, http.StatusInternalServerError, APIResponse{
+			Message:   "Failed to read usage",
+			Error:     apierror.New(apierror.Internal, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Usage", Data: usage})
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/knowledge"
+	"data-chatter/internal/requestid"
+)
+
+// DocumentsHandler lists the business documentation on GET and uploads a
+// document on POST, as the "file" field of a multipart form. An optional
+// "name" field names the document, which is otherwise named after the
+// file, and an optional "format" field (markdown, text, or pdf) overrides
+// the format the file's extension implies. Uploading a name already in use
+// replaces that document.
+func DocumentsHandler(w http.ResponseWriter, r *http.Request) {
+	if documents == nil {
+		writeDocumentsUnavailable(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := documents.List(r.Context())
+		if err != nil {
+			writeDocumentError(w, r, err)
+			return
+		}
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Documents", Data: list})
+
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, knowledge.MaxBytes+1<<20)
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			if errors.As(err, new(*http.MaxBytesError)) {
+				writeDocumentError(w, r, err)
+				return
+			}
+			writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+				Message:   "Invalid upload",
+				Error:     apierror.New(apierror.InvalidRequest, "a multipart form with a file field is required: "+err.Error()),
+				RequestID: requestid.FromContext(r.Context()),
+			})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			writeDocumentError(w, r, err)
+			return
+		}
+
+		format, err := knowledge.DetectFormat(r.FormValue("format"), header.Filename, data)
+		if err != nil {
+			writeDocumentError(w, r, err)
+			return
+		}
+		name := r.FormValue("name")
+		if name == "" {
+			name = strings.TrimSuffix(header.Filename, filepath.Ext(header.Filename))
+		}
+		doc, err := documents.Add(r.Context(), knowledge.Document{
+			Name:       name,
+			Format:     format,
+			UploadedBy: auth.UserID(r.Context()),
+		}, data)
+		if err != nil {
+			writeDocumentError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "document_uploaded", Status: "ok", Details: map[string]interface{}{
+			"id": doc.ID, "name": doc.Name, "format": doc.Format, "chunks": doc.Chunks,
+		}})
+		writeAdminResponse(w, http.StatusCreated, APIResponse{Message: "Document uploaded", Data: doc})
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// DocumentHandler returns a document with its chunks on GET and removes it
+// on DELETE.
+func DocumentHandler(w http.ResponseWriter, r *http.Request) {
+	if documents == nil {
+		writeDocumentsUnavailable(w, r)
+		return
+	}
+
+	id := r.PathValue("id")
+	switch r.Method {
+	case http.MethodGet:
+		doc, err := documents.Get(r.Context(), id)
+		if err != nil {
+			writeDocumentError(w, r, err)
+			return
+		}
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Document", Data: doc})
+
+	case http.MethodDelete:
+		if err := documents.Delete(r.Context(), id); err != nil {
+			writeDocumentError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "document_deleted", Status: "ok", Details: map[string]interface{}{"id": id}})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// writeDocumentError reports a failed documentation request.
+func writeDocumentError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Document request failed"
+	switch {
+	case errors.Is(err, knowledge.ErrNotFound):
+		status, message = http.StatusNotFound, "Document not found"
+	case errors.Is(err, knowledge.ErrInvalid):
+		status, message = http.StatusBadRequest, "Invalid document"
+	case errors.As(err, new(*http.MaxBytesError)):
+		status, message = http.StatusRequestEntityTooLarge, "File too large"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeDocumentsUnavailable reports that the documents tables could not be
+// created at startup.
+func writeDocumentsUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Message:   "Documents unavailable",
+		Error:     apierror.New(apierror.FeatureUnavailable, "the "+knowledge.DocumentsTable+" table could not be created; check the database user's permissions"),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
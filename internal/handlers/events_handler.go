@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/events"
+	"data-chatter/internal/redact"
+	"data-chatter/internal/types"
+)
+
+// progressBus carries tool execution progress for in-flight chat turns.
+var progressBus = events.NewBus()
+
+// sseKeepAlive is how often an idle event stream sends a comment to keep proxies from closing it.
+const sseKeepAlive = 15 * time.Second
+
+// TurnEventsHandler streams progress events for a chat turn as Server-Sent Events.
+// Clients subscribe before posting their message with the same turn_id; the
+// stream ends if the turn does not start within 30s or is started by
+// another user.
+func TurnEventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	turnID := r.PathValue("id")
+	if turnID == "" {
+		apierror.WriteInvalidRequest(w, r, "turn ID is required")
+		return
+	}
+
+	// Only the user who started the turn may follow it; other users get the
+	// same answer as for a turn that does not exist
+	ch, cancel, err := progressBus.Subscribe(turnID, auth.UserID(r.Context()))
+	if err != nil {
+		apierror.Write(w, r, http.StatusNotFound, "Turn not found", apierror.New(apierror.NotFound, "turn not found"))
+		return
+	}
+	defer cancel()
+
+	// Event streams outlive the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	rc.Flush()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			rc.Flush()
+		case event, ok := <-ch:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(event)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+			rc.Flush()
+		}
+	}
+}
+
+// newTurnID generates a random identifier for a chat turn.
+func newTurnID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// turnIDFromMetadata extracts the chat turn a tool call belongs to, if any.
+func turnIDFromMetadata(toolCall types.ToolCall) string {
+	turnID, _ := toolCall.Metadata[types.MetadataTurnID].(string)
+	return turnID
+}
+
+// withToolProgress publishes tool_started and wires row progress reporting into ctx.
+// The returned function publishes tool_finished and must be called once the tool returns.
+func withToolProgress(ctx context.Context, toolCall types.ToolCall) (context.Context, func(result *types.ToolResult, err error)) {
+	turnID := turnIDFromMetadata(toolCall)
+	if turnID == "" {
+		return ctx, func(*types.ToolResult, error) {}
+	}
+
+	start := time.Now()
+	progressBus.Publish(events.Event{
+		Type:       events.ToolStarted,
+		TurnID:     turnID,
+		ToolCallID: toolCall.ID,
+		Tool:       toolCall.Name,
+	})
+
+	ctx = events.WithRowReporter(ctx, func(rows int) {
+		progressBus.Publish(events.Event{
+			Type:       events.RowsFetched,
+			TurnID:     turnID,
+			ToolCallID: toolCall.ID,
+			Tool:       toolCall.Name,
+			Rows:       rows,
+		})
+	})
+
+	return ctx, func(result *types.ToolResult, err error) {
+		event := events.Event{
+			Type:       events.ToolFinished,
+			TurnID:     turnID,
+			ToolCallID: toolCall.ID,
+			Tool:       toolCall.Name,
+			DurationMs: time.Since(start).Milliseconds(),
+		}
+		if err != nil {
+			event.Error = redact.String(err.Error())
+		} else if result != nil && result.Error != nil {
+			event.Error = redact.String(result.Error.Message)
+		}
+		progressBus.Publish(event)
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/conversation"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/render"
+)
+
+// Export watermark modes, from EXPORT_WATERMARK.
+const (
+	watermarkOff    = "off"    // No watermark (default)
+	watermarkShared = "shared" // Only exports by users a conversation is shared with
+	watermarkAll    = "all"    // Every export
+)
+
+// watermarkModeFromEnv reads EXPORT_WATERMARK, treating unknown values as off.
+func watermarkModeFromEnv() string {
+	switch mode := strings.ToLower(os.Getenv("EXPORT_WATERMARK")); mode {
+	case watermarkShared, watermarkAll:
+		return mode
+	}
+	return watermarkOff
+}
+
+// exportLink points the LLM at where the full results of a turn's tool calls
+// can be downloaded once the turn is recorded in its conversation, so that
+// answers written from cut-down results can say where the rest is.
+func exportLink(ctx context.Context, turnID string) llm.ExportLink {
+	conversationID := conversationIDFromContext(ctx)
+	if conversationID == "" || turnID == "" {
+		return nil
+	}
+	return func(toolCallID string) string {
+		link := fmt.Sprintf("/conversations/%s/turns/%s/export?format=csv", url.PathEscape(conversationID), url.PathEscape(turnID))
+		if toolCallID != "" {
+			link += "&tool_call_id=" + url.QueryEscape(toolCallID)
+		}
+		return link
+	}
+}
+
+// ExportTurnHandler downloads the full rows of one of a turn's query
+// results: the one from tool_call_id, or the turn's first. format (json,
+// csv, or markdown) and nulls work as on /db/query. With EXPORT_WATERMARK
+// set, the export is stamped with who downloaded it, when, and how it was
+// filtered.
+func (lh *LLMHandler) ExportTurnHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	format, err := render.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		apierror.WriteInvalidRequest(w, r, err.Error())
+		return
+	}
+	nulls, err := render.ParseNullStyle(r.URL.Query().Get("nulls"))
+	if err != nil {
+		apierror.WriteInvalidRequest(w, r, err.Error())
+		return
+	}
+
+	c, err := lh.conversations.Get(r.PathValue("id"))
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+	turn, ok := findTurn(c, r.PathValue("turn"))
+	if !ok {
+		writeConversationNotFound(w, r, "No turn with that ID in this conversation")
+		return
+	}
+
+	var response struct {
+		Results []map[string]interface{} `json:"results"`
+	}
+	json.Unmarshal(turn.Response, &response)
+	text, ok := exportedResult(response.Results, r.URL.Query().Get("tool_call_id"))
+	if !ok {
+		writeConversationNotFound(w, r, "The turn has no query result to export")
+		return
+	}
+
+	if err := writeQueryResult(w, text, format, nulls, lh.exportWatermark(r, c, text)); err != nil {
+		slog.WarnContext(r.Context(), "failed to export turn results", "conversation_id", c.ID, "turn_id", turn.TurnID, "error", err)
+	}
+}
+
+// exportWatermark returns the watermark for an export of c's result text by
+// the caller, or nil when the watermark mode leaves this export unstamped.
+// Its filters are the query behind the result and the export's options.
+func (lh *LLMHandler) exportWatermark(r *http.Request, c *conversation.Conversation, text string) *render.Watermark {
+	switch {
+	case lh.watermark == watermarkAll:
+	case lh.watermark == watermarkShared && !ownedBy(r.Context(), c):
+	default:
+		return nil
+	}
+
+	var payload struct {
+		Query string `json:"query"`
+	}
+	json.Unmarshal([]byte(text), &payload)
+
+	watermark := &render.Watermark{ExportedBy: auth.UserID(r.Context()), ExportedAt: time.Now().UTC()}
+	if payload.Query != "" {
+		watermark.Filters = append(watermark.Filters, "query: "+payload.Query)
+	}
+	for _, option := range []string{"tool_call_id", "nulls"} {
+		if value := r.URL.Query().Get(option); value != "" {
+			watermark.Filters = append(watermark.Filters, option+"="+value)
+		}
+	}
+	return watermark
+}
+
+// exportedResult returns the payload of the successful query result from
+// toolCallID, or of the first one when toolCallID is empty.
+func exportedResult(results []map[string]interface{}, toolCallID string) (string, bool) {
+	for _, result := range results {
+		if id, _ := result["id"].(string); toolCallID != "" && id != toolCallID {
+			continue
+		}
+		if isError, _ := result["is_error"].(bool); isError {
+			continue
+		}
+		content, _ := result["content"].([]interface{})
+		if len(content) == 0 {
+			continue
+		}
+		block, _ := content[0].(map[string]interface{})
+		text, _ := block["text"].(string)
+
+		var payload struct {
+			Columns []string `json:"columns"`
+		}
+		if json.Unmarshal([]byte(text), &payload) == nil && payload.Columns != nil {
+			return text, true
+		}
+	}
+	return "", false
+}
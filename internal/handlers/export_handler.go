@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+	"data-chatter/internal/jobs"
+	"data-chatter/internal/tools"
+	"data-chatter/internal/types"
+)
+
+// exportPolicy bounds how export jobs page through results and ride out
+// lost connections.
+type exportPolicy struct {
+	PartRows int           // Default rows per stored part
+	Retries  int           // Retries of a page that failed with a retryable error
+	Backoff  time.Duration // Wait before the first retry; doubles for each retry after
+}
+
+// exportPolicyFromEnv reads EXPORT_PART_ROWS (default 100000) and
+// EXPORT_RETRIES (default 5).
+func exportPolicyFromEnv() exportPolicy {
+	policy := exportPolicy{PartRows: 100000, Retries: 5, Backoff: time.Second}
+	if value, err := strconv.Atoi(os.Getenv("EXPORT_PART_ROWS")); err == nil && value > 0 {
+		policy.PartRows = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("EXPORT_RETRIES")); err == nil && value >= 0 {
+		policy.Retries = value
+	}
+	return policy
+}
+
+// ExportRequest submits a query whose whole result is written to the
+// artifact store in the background. Key names the result columns the rows
+// are paged by, which together must identify a row and hold no NULLs, such
+// as a primary key. Format is csv (default) or jsonl.
+type ExportRequest struct {
+	Query       string   `json:"query"`
+	Key         []string `json:"key"`
+	Format      string   `json:"format,omitempty"`
+	PartRows    int      `json:"part_rows,omitempty"`
+	CallbackURL string   `json:"callback_url,omitempty"`
+}
+
+// ExportHandler validates and authorizes a query, then queues its export as
+// a job and responds 202 with the job at once. Poll GET /jobs/{id} for its
+// progress and download the result from GET /jobs/{id}/export once it has
+// succeeded.
+func (dh *DatabaseHandler) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var request ExportRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+
+	if err := dh.queryTool.Validate(map[string]interface{}{"query": request.Query}); err != nil {
+		writeJobError(w, r, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+	if len(request.Key) == 0 {
+		writeJobError(w, r, http.StatusBadRequest, "Invalid export", errors.New("key must name the columns that identify a row"))
+		return
+	}
+	for i, column := range request.Key {
+		if column == "" {
+			writeJobError(w, r, http.StatusBadRequest, "Invalid export", fmt.Errorf("key[%d] must be a non-empty string", i))
+			return
+		}
+	}
+	switch request.Format {
+	case "":
+		request.Format = tools.ExportCSV
+	case tools.ExportCSV, tools.ExportJSONL:
+	default:
+		writeJobError(w, r, http.StatusBadRequest, "Invalid export", fmt.Errorf("unknown format %q: use csv or jsonl", request.Format))
+		return
+	}
+	if request.PartRows < 0 {
+		writeJobError(w, r, http.StatusBadRequest, "Invalid export", errors.New("part_rows must be positive"))
+		return
+	}
+	if request.PartRows == 0 {
+		request.PartRows = dh.export.PartRows
+	}
+
+	if turnArtifacts == nil {
+		writeJobError(w, r, http.StatusServiceUnavailable, "Exports unavailable", errors.New("no artifact store is configured"))
+		return
+	}
+
+	if err := accessControl.AuthorizeQuery(r.Context(), request.Query); err != nil {
+		auditLog.Record(r.Context(), audit.Entry{
+			Action:  "db_export",
+			Status:  "denied",
+			Details: map[string]interface{}{"query": request.Query, "error": err.Error()},
+		})
+		writeJobError(w, r, http.StatusForbidden, "Query not permitted", err)
+		return
+	}
+
+	job, err := backgroundJobs.Submit(r.Context(), auth.UserID(r.Context()), jobs.Job{
+		Kind:        jobs.KindExport,
+		Query:       request.Query,
+		Export:      &jobs.Export{Key: request.Key, Format: request.Format, PartRows: request.PartRows},
+		CallbackURL: request.CallbackURL,
+	})
+	if err != nil {
+		writeJobSubmitError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJobResponse(w, http.StatusAccepted, APIResponse{Message: "Export accepted", Data: job})
+}
+
+// ExportDownloadHandler serves GET /jobs/{id}/export: the result of one of
+// the caller's finished exports, its parts streamed in order as one file.
+func ExportDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	job, err := backgroundJobs.Get(r.Context(), auth.UserID(r.Context()), r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) || (err == nil && job.Kind != jobs.KindExport) {
+		writeJobError(w, r, http.StatusNotFound, "Export not found", jobs.ErrNotFound)
+		return
+	}
+	if err != nil {
+		writeJobError(w, r, http.StatusInternalServerError, "Failed to read job", err)
+		return
+	}
+	if job.Status != jobs.Succeeded {
+		writeJobError(w, r, http.StatusConflict, "Export not available", fmt.Errorf("export is %s, not succeeded", job.Status))
+		return
+	}
+	if turnArtifacts == nil {
+		writeJobError(w, r, http.StatusServiceUnavailable, "Exports unavailable", errors.New("no artifact store is configured"))
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if job.Export.Format == tools.ExportJSONL {
+		contentType = "application/x-ndjson"
+	}
+	// Large exports take longer to send than the server's write timeout
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	for n := 0; n < job.Export.Parts; n++ {
+		data, err := turnArtifacts.OpenPart(r.Context(), job.ID, n)
+		if err != nil {
+			if n == 0 {
+				writeJobError(w, r, http.StatusGone, "Export expired", err)
+				return
+			}
+			slog.ErrorContext(r.Context(), "export part missing", "job_id", job.ID, "part", n, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		if n == 0 {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.%s"`, job.ID, job.Export.Format))
+			w.WriteHeader(http.StatusOK)
+		}
+		if _, err := w.Write(data); err != nil {
+			return
+		}
+	}
+}
+
+// runExport pages through an export job's query by its key, storing each
+// page as a part and checkpointing the job after it, so a resumed job starts
+// after the last part stored. Pages that fail with a retryable error, such
+// as a lost connection, are retried with backoff.
+func (dh *DatabaseHandler) runExport(ctx context.Context, job jobs.Job) jobs.Outcome {
+	if turnArtifacts == nil || job.Export == nil {
+		return jobs.Outcome{Error: &types.ToolError{Code: types.ErrorUnavailable, Message: "no artifact store is configured"}}
+	}
+	progress := *job.Export
+	if progress.Parts > 0 {
+		slog.InfoContext(ctx, "resuming export", "job_id", job.ID, "parts", progress.Parts, "rows", progress.Rows)
+	}
+
+	var page bytes.Buffer
+	for {
+		var (
+			rows int
+			last json.RawMessage
+			err  error
+		)
+		backoff := dh.export.Backoff
+		for attempt := 0; ; attempt++ {
+			page.Reset()
+			rows, last, err = dh.queryTool.ExportPage(ctx, job.Query, progress.Key, progress.After, progress.PartRows, progress.Format, progress.Parts == 0, &page)
+			if err == nil || attempt >= dh.export.Retries || ctx.Err() != nil {
+				break
+			}
+			if code, _ := database.ClassifyError(err); !types.IsRetryable(code) {
+				break
+			}
+			progress.Retries++
+			slog.WarnContext(ctx, "retrying export page", "job_id", job.ID, "part", progress.Parts, "attempt", attempt+1, "backoff", backoff, "error", err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+		if err != nil {
+			return dh.exportFailed(ctx, job, progress, err)
+		}
+
+		// Every export has a part, if only the CSV header
+		if rows > 0 || progress.Parts == 0 {
+			if err := turnArtifacts.SavePart(ctx, job.ID, progress.Parts, page.Bytes()); err != nil {
+				return dh.exportFailed(ctx, job, progress, err)
+			}
+			progress.Parts++
+			progress.Rows += int64(rows)
+			progress.Bytes += int64(page.Len())
+			progress.After = last
+			backgroundJobs.Checkpoint(ctx, job.ID, progress)
+		}
+		if rows < progress.PartRows {
+			break
+		}
+	}
+
+	auditLog.Record(ctx, audit.Entry{
+		Action:  "db_export",
+		Status:  "ok",
+		Details: map[string]interface{}{"query": job.Query, "row_count": progress.Rows, "parts": progress.Parts},
+	})
+	result, _ := json.Marshal(map[string]interface{}{
+		"rows":     progress.Rows,
+		"parts":    progress.Parts,
+		"bytes":    progress.Bytes,
+		"format":   progress.Format,
+		"download": "/jobs/" + job.ID + "/export",
+	})
+	return jobs.Outcome{Result: result}
+}
+
+// exportFailed audits a failed export and returns its outcome.
+func (dh *DatabaseHandler) exportFailed(ctx context.Context, job jobs.Job, progress jobs.Export, err error) jobs.Outcome {
+	auditLog.Record(ctx, audit.Entry{
+		Action:  "db_export",
+		Status:  "error",
+		Details: map[string]interface{}{"query": job.Query, "row_count": progress.Rows, "parts": progress.Parts, "error": err.Error()},
+	})
+	code, driverCode := database.ClassifyError(err)
+	return jobs.Outcome{Error: &types.ToolError{
+		Code:       code,
+		Message:    err.Error(),
+		DriverCode: driverCode,
+		Retryable:  types.IsRetryable(code),
+	}}
+}
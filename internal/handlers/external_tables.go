@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/external"
+	"data-chatter/internal/requestid"
+)
+
+// ExternalTableRequest registers a file as a table.
+type ExternalTableRequest struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+	Format string `json:"format,omitempty"`
+}
+
+// ExternalTablesHandler lists the external tables on GET and registers a
+// file as one on POST. A new table's rows are loaded by the first query that
+// reads it.
+func ExternalTablesHandler(w http.ResponseWriter, r *http.Request) {
+	if externalTables == nil {
+		writeExternalTablesUnavailable(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		tables, err := externalTables.List(r.Context())
+		if err != nil {
+			writeExternalTableError(w, r, err)
+			return
+		}
+		if tables == nil {
+			tables = []external.ExternalTable{}
+		}
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "External tables", Data: tables})
+
+	case http.MethodPost:
+		var request ExternalTableRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		table, err := externalTables.Register(r.Context(), external.ExternalTable{
+			Name:      request.Name,
+			Source:    request.Source,
+			Format:    request.Format,
+			CreatedBy: auth.UserID(r.Context()),
+		})
+		if err != nil {
+			writeExternalTableError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "external_table_registered", Status: "ok", Details: map[string]interface{}{
+			"name": table.Name, "source": table.Source, "format": table.Format,
+		}})
+		writeAdminResponse(w, http.StatusCreated, APIResponse{Message: "External table registered", Data: table})
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// ExternalTableHandler drops (DELETE) an external table.
+func ExternalTableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if externalTables == nil {
+		writeExternalTablesUnavailable(w, r)
+		return
+	}
+
+	name := r.PathValue("name")
+	if err := externalTables.Delete(r.Context(), name); err != nil {
+		writeExternalTableError(w, r, err)
+		return
+	}
+	auditLog.Record(r.Context(), audit.Entry{Action: "external_table_deleted", Status: "ok", Details: map[string]interface{}{"name": name}})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ExternalTableRefreshHandler loads an external table's file again now,
+// picking up changes to it.
+func ExternalTableRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if externalTables == nil {
+		writeExternalTablesUnavailable(w, r)
+		return
+	}
+
+	table, err := externalTables.Refresh(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeExternalTableError(w, r, err)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "External table loaded", Data: table})
+}
+
+// defaultMaxUploadBytes caps uploaded files when UPLOAD_MAX_BYTES is unset.
+const defaultMaxUploadBytes = 50 << 20
+
+// UploadHandler creates a table from a CSV or XLSX file posted as the "file"
+// field of a multipart form, so the caller can ask about it at once. An
+// optional "name" field names the table, which is otherwise named after the
+// file. Files larger than UPLOAD_MAX_BYTES (default 50 MB) are refused, and
+// the table is dropped once UPLOAD_TTL has passed. Tenants cannot upload,
+// since uploads are loaded into the default database, not theirs.
+func UploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if externalTables == nil {
+		writeExternalTablesUnavailable(w, r)
+		return
+	}
+	if auth.TenantID(r.Context()) != "" {
+		writeExternalTableError(w, r, fmt.Errorf("%w: uploads are not available in multi-tenant mode", external.ErrInvalid))
+		return
+	}
+
+	maxBytes := int64(defaultMaxUploadBytes)
+	if value, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_BYTES"), 10, 64); err == nil && value > 0 {
+		maxBytes = value
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		if errors.As(err, new(*http.MaxBytesError)) {
+			writeExternalTableError(w, r, err)
+			return
+		}
+		writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+			Message:   "Invalid upload",
+			Error:     apierror.New(apierror.InvalidRequest, "a multipart form with a file field is required: "+err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+	defer file.Close()
+
+	table, err := externalTables.Upload(r.Context(), external.ExternalTable{
+		Name:      r.FormValue("name"),
+		Format:    r.FormValue("format"),
+		CreatedBy: auth.UserID(r.Context()),
+	}, header.Filename, file)
+	if err != nil {
+		writeExternalTableError(w, r, err)
+		return
+	}
+	auditLog.Record(r.Context(), audit.Entry{Action: "file_uploaded", Status: "ok", Details: map[string]interface{}{
+		"name": table.Name, "source": table.Source, "format": table.Format, "rows": table.Rows,
+	}})
+	writeAdminResponse(w, http.StatusCreated, APIResponse{Message: "File uploaded", Data: table})
+}
+
+// writeExternalTableError reports a failed external table request.
+func writeExternalTableError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "External table request failed"
+	switch {
+	case errors.Is(err, external.ErrNotFound):
+		status, message = http.StatusNotFound, "External table not found"
+	case errors.Is(err, external.ErrInvalid):
+		status, message = http.StatusBadRequest, "Invalid external table"
+	case errors.As(err, new(*http.MaxBytesError)):
+		status, message = http.StatusRequestEntityTooLarge, "File too large"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeExternalTablesUnavailable reports that the registrations table could
+// not be created at startup.
+func writeExternalTablesUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Message:   "External tables unavailable",
+		Error:     apierror.New(apierror.FeatureUnavailable, "the "+external.Table+" table could not be created; check the database user's permissions"),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
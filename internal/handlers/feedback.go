@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/feedback"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/sqlparse"
+)
+
+// defaultFeedbackWindow is how far back the feedback endpoints read when
+// no ?since= is given.
+const defaultFeedbackWindow = 30 * 24 * time.Hour
+
+// FeedbackRequest rates the answer to one turn of a conversation "up" or
+// "down", with an optional comment saying what was wrong.
+type FeedbackRequest struct {
+	ConversationID string `json:"conversation_id"`
+	TurnID         string `json:"turn_id"`
+	Rating         string `json:"rating"`
+	Comment        string `json:"comment,omitempty"`
+}
+
+// FeedbackHandler saves the caller's rating of a turn's answer, along with
+// the turn's question and the SQL its answer ran, so a down-rated answer
+// can be replayed as an eval case. Rating a turn again replaces the
+// caller's earlier rating.
+func (lh *LLMHandler) FeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if answerFeedback == nil {
+		writeFeedbackUnavailable(w, r)
+		return
+	}
+
+	var request FeedbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+	if request.ConversationID == "" || request.TurnID == "" {
+		writeFeedbackError(w, r, fmt.Errorf("%w: conversation_id and turn_id are required", feedback.ErrInvalid))
+		return
+	}
+
+	c, err := lh.conversations.Get(request.ConversationID)
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+	turn, ok := findTurn(c, request.TurnID)
+	if !ok {
+		writeConversationNotFound(w, r, "No turn with that ID in the conversation")
+		return
+	}
+
+	var response struct {
+		Plan []PlanStep `json:"plan"`
+	}
+	json.Unmarshal(turn.Response, &response)
+	entry := feedback.Feedback{
+		ConversationID: c.ID,
+		TurnID:         turn.TurnID,
+		UserID:         auth.UserID(r.Context()),
+		Rating:         request.Rating,
+		Comment:        request.Comment,
+		Question:       turn.Message,
+	}
+	for _, step := range response.Plan {
+		if step.SQL == "" {
+			continue
+		}
+		entry.Queries = append(entry.Queries, step.SQL)
+		for _, table := range sqlparse.ReferencedTables(step.SQL) {
+			table = strings.ToLower(table)
+			if !slices.Contains(entry.Tables, table) {
+				entry.Tables = append(entry.Tables, table)
+			}
+		}
+	}
+
+	saved, err := answerFeedback.Put(r.Context(), entry)
+	if err != nil {
+		writeFeedbackError(w, r, err)
+		return
+	}
+	auditLog.Record(r.Context(), audit.Entry{Action: "feedback_given", Status: "ok", Details: map[string]interface{}{
+		"conversation_id": saved.ConversationID, "turn_id": saved.TurnID, "rating": saved.Rating,
+	}})
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Feedback saved", Data: saved})
+}
+
+// AdminFeedbackHandler lists the feedback given in the last ?since= (a
+// duration like "168h", default 30 days), newest first, optionally only
+// that rated ?rating=up or down. Down-rated entries carry the question and
+// SQL to build an eval set from.
+func AdminFeedbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if answerFeedback == nil {
+		writeFeedbackUnavailable(w, r)
+		return
+	}
+
+	window, ok := feedbackWindow(w, r)
+	if !ok {
+		return
+	}
+	rating := r.URL.Query().Get("rating")
+	switch rating {
+	case "", feedback.RatingUp, feedback.RatingDown:
+	default:
+		writeFeedbackError(w, r, fmt.Errorf("%w: rating must be %s or %s", feedback.ErrInvalid, feedback.RatingUp, feedback.RatingDown))
+		return
+	}
+
+	entries, err := answerFeedback.List(r.Context(), feedback.Filter{Rating: rating, Since: time.Now().Add(-window)})
+	if err != nil {
+		writeFeedbackError(w, r, err)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Feedback", Data: entries})
+}
+
+// FeedbackSummaryHandler aggregates the feedback given in the last ?since=
+// (default 30 days): up and down counts overall, by queried table, and by
+// day.
+func FeedbackSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if answerFeedback == nil {
+		writeFeedbackUnavailable(w, r)
+		return
+	}
+
+	window, ok := feedbackWindow(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	summary, err := answerFeedback.Summarize(r.Context(), now.Add(-window), now)
+	if err != nil {
+		writeFeedbackError(w, r, err)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Feedback summary", Data: summary})
+}
+
+// feedbackWindow reads ?since=, reporting a bad value and returning false.
+func feedbackWindow(w http.ResponseWriter, r *http.Request) (time.Duration, bool) {
+	raw := r.URL.Query().Get("since")
+	if raw == "" {
+		return defaultFeedbackWindow, true
+	}
+	window, err := time.ParseDuration(raw)
+	if err != nil || window <= 0 {
+		writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+			Message:   "Invalid since",
+			Error:     apierror.New(apierror.InvalidRequest, "since must be a positive duration like \"168h\""),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return 0, false
+	}
+	return window, true
+}
+
+// writeFeedbackError reports a failed feedback request.
+func writeFeedbackError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Feedback request failed"
+	if errors.Is(err, feedback.ErrInvalid) {
+		status, message = http.StatusBadRequest, "Invalid feedback"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeFeedbackUnavailable reports that the feedback table could not be
+// created at startup.
+func writeFeedbackUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Message:   "Feedback unavailable",
+		Error:     apierror.New(apierror.FeatureUnavailable, "the "+feedback.Table+" table could not be created; check the database user's permissions"),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	datachatterv1 "data-chatter/internal/gen/datachatter/v1"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/types"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// GRPCService implements the DataChatter gRPC service on the same tool
+// engine, access control, and audit log as the REST handlers.
+type GRPCService struct {
+	datachatterv1.UnimplementedDataChatterServer
+
+	// chat serves POST /llm/message; SendMessage runs turns through it so
+	// both APIs share turn handling, rate limits, and cancellation.
+	chat http.Handler
+}
+
+// NewGRPCService creates the gRPC service. chat must route /llm/message.
+func NewGRPCService(chat http.Handler) *GRPCService {
+	return &GRPCService{chat: chat}
+}
+
+// ListTools returns the tools available to the LLM.
+func (s *GRPCService) ListTools(ctx context.Context, _ *datachatterv1.ListToolsRequest) (*datachatterv1.ListToolsResponse, error) {
+	var response datachatterv1.ListToolsResponse
+	for _, definition := range toolRunner.GetAvailableTools() {
+		schema, err := jsonStruct(definition.InputSchema)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to encode schema for %s: %v", definition.Name, err)
+		}
+		response.Tools = append(response.Tools, &datachatterv1.ToolDefinition{
+			Name:        definition.Name,
+			Description: definition.Description,
+			InputSchema: schema,
+		})
+	}
+	return &response, nil
+}
+
+// ExecuteTool runs a single tool call, like POST /tools/single.
+func (s *GRPCService) ExecuteTool(ctx context.Context, call *datachatterv1.ToolCall) (*datachatterv1.ToolResult, error) {
+	if call.GetName() == "" {
+		return nil, status.Error(codes.InvalidArgument, "tool name cannot be empty")
+	}
+
+	toolCall := toolCallFromProto(call)
+	ctx, finish := withToolProgress(ctx, toolCall)
+	result, err := toolRunner.ExecuteCall(ctx, toolCall)
+	finish(result, err)
+	auditToolCall(ctx, toolCall, result, err)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "tool execution failed: %v", err)
+	}
+	if result.ID == "" {
+		result.ID = toolCall.ID
+	}
+	return toolResultToProto(result)
+}
+
+// ExecuteTools runs several tool calls in order, like POST /tools/execute.
+func (s *GRPCService) ExecuteTools(ctx context.Context, request *datachatterv1.ExecuteToolsRequest) (*datachatterv1.ExecuteToolsResponse, error) {
+	if len(request.GetTools()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one tool must be provided")
+	}
+
+	toolCalls := make([]types.ToolCall, len(request.GetTools()))
+	for i, call := range request.GetTools() {
+		toolCalls[i] = toolCallFromProto(call)
+	}
+
+	results := toolRunner.ExecuteTools(ctx, toolCalls)
+	response := &datachatterv1.ExecuteToolsResponse{}
+	for i := range results {
+		auditToolCall(ctx, toolCalls[i], &results[i], nil)
+		result, err := toolResultToProto(&results[i])
+		if err != nil {
+			return nil, err
+		}
+		response.Results = append(response.Results, result)
+	}
+	return response, nil
+}
+
+// SendMessage answers a natural-language message, like POST /llm/message.
+// Turns that fail outright are returned as gRPC errors with the matching code;
+// tool failures within a turn are reported in the reply's plan and results.
+func (s *GRPCService) SendMessage(ctx context.Context, message *datachatterv1.ChatMessage) (*datachatterv1.ChatReply, error) {
+	body, _ := json.Marshal(MessageRequest{
+		Message:        message.GetMessage(),
+		TurnID:         message.GetTurnId(),
+		PreviousTurnID: message.GetPreviousTurnId(),
+		Nulls:          message.GetNulls(),
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "/llm/message", bytes.NewReader(body))
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "failed to build chat request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	recorder := &responseBuffer{header: make(http.Header)}
+	s.chat.ServeHTTP(recorder, req)
+
+	var response struct {
+		TurnID    string                   `json:"turn_id"`
+		Message   string                   `json:"message"`
+		Results   []types.ToolResult       `json:"results"`
+		Plan      []PlanStep               `json:"plan"`
+		Rows      []map[string]interface{} `json:"rows"`
+		Error     *apierror.Error          `json:"error"`
+		RequestID string                   `json:"request_id"`
+	}
+	if err := json.Unmarshal(recorder.body.Bytes(), &response); err != nil {
+		return nil, status.Errorf(httpStatusCode(recorder.status), "%s", bytes.TrimSpace(recorder.body.Bytes()))
+	}
+	if recorder.status >= http.StatusBadRequest {
+		if response.Error == nil {
+			return nil, status.Error(httpStatusCode(recorder.status), response.Message)
+		}
+		return nil, status.Errorf(httpStatusCode(recorder.status), "%s: %s (%s)", response.Message, response.Error.Message, response.Error.Code)
+	}
+
+	reply := &datachatterv1.ChatReply{
+		TurnId:    response.TurnID,
+		Message:   response.Message,
+		RequestId: requestid.FromContext(ctx),
+	}
+	if response.Error != nil {
+		reply.Error = response.Error.Message
+	}
+	for i := range response.Results {
+		result, err := toolResultToProto(&response.Results[i])
+		if err != nil {
+			return nil, err
+		}
+		reply.Results = append(reply.Results, result)
+	}
+	for _, step := range response.Plan {
+		reply.Plan = append(reply.Plan, &datachatterv1.PlanStep{
+			Step:       int32(step.Step),
+			ToolCallId: step.ToolCallID,
+			Tool:       step.Tool,
+			Sql:        step.SQL,
+			DurationMs: step.DurationMs,
+			Status:     step.Status,
+			Attempts:   int32(step.Attempts),
+			Error:      step.Error,
+			ErrorType:  step.ErrorType,
+		})
+	}
+	for _, row := range response.Rows {
+		encoded, err := jsonStruct(row)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "failed to encode result row: %v", err)
+		}
+		reply.Rows = append(reply.Rows, encoded)
+	}
+	return reply, nil
+}
+
+// toolCallFromProto converts a gRPC tool call to the engine's type.
+func toolCallFromProto(call *datachatterv1.ToolCall) types.ToolCall {
+	toolCall := types.ToolCall{
+		ID:    call.GetId(),
+		Type:  "tool_use",
+		Name:  call.GetName(),
+		Input: call.GetInput().AsMap(),
+	}
+	if call.GetMetadata() != nil {
+		toolCall.Metadata = call.GetMetadata().AsMap()
+	}
+	return toolCall
+}
+
+// toolResultToProto converts an engine tool result to its gRPC message.
+func toolResultToProto(result *types.ToolResult) (*datachatterv1.ToolResult, error) {
+	message := &datachatterv1.ToolResult{
+		Id:        result.ID,
+		IsError:   result.IsError,
+		RequestId: result.RequestID,
+	}
+	for _, content := range result.Content {
+		block := &datachatterv1.ToolContent{Type: content.Type, Text: content.Text}
+		if content.Data != nil {
+			data, err := jsonValue(content.Data)
+			if err != nil {
+				return nil, status.Errorf(codes.Internal, "failed to encode tool output: %v", err)
+			}
+			block.Data = data
+		}
+		message.Content = append(message.Content, block)
+	}
+	if result.Error != nil {
+		message.Error = &datachatterv1.ToolError{
+			Type:       result.Error.Code,
+			Message:    result.Error.Message,
+			DriverCode: result.Error.DriverCode,
+			Retryable:  result.Error.Retryable,
+		}
+	}
+	return message, nil
+}
+
+// jsonValue converts any JSON-encodable value to a protobuf Value, going
+// through JSON so typed slices and structs are accepted.
+func jsonValue(v interface{}) (*structpb.Value, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil, err
+	}
+	return structpb.NewValue(decoded)
+}
+
+// jsonStruct converts a JSON-encodable object to a protobuf Struct.
+func jsonStruct(v interface{}) (*structpb.Struct, error) {
+	value, err := jsonValue(v)
+	if err != nil {
+		return nil, err
+	}
+	if value.GetStructValue() == nil {
+		return &structpb.Struct{}, nil
+	}
+	return value.GetStructValue(), nil
+}
+
+// httpStatusCode maps an HTTP status from the chat handler to a gRPC code.
+func httpStatusCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case statusClientClosedRequest:
+		return codes.Canceled
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Internal
+	}
+}
+
+// responseBuffer captures a handler's response in memory.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(code int) {
+	if b.status == 0 {
+		b.status = code
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
@@ -2,71 +2,425 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
+	"data-chatter/internal/answercache"
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/apiversion"
+	"data-chatter/internal/artifacts"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/calendar"
+	"data-chatter/internal/catalog"
+	"data-chatter/internal/conversation"
 	"data-chatter/internal/database"
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/digest"
+	"data-chatter/internal/encryption"
 	"data-chatter/internal/engine"
+	"data-chatter/internal/external"
+	"data-chatter/internal/feedback"
+	"data-chatter/internal/history"
+	"data-chatter/internal/jobs"
+	"data-chatter/internal/knowledge"
+	"data-chatter/internal/metrics"
+	"data-chatter/internal/middleware"
+	"data-chatter/internal/notify"
+	"data-chatter/internal/orgcontext"
+	"data-chatter/internal/quality"
+	"data-chatter/internal/querycache"
+	"data-chatter/internal/rbac"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/reveal"
+	"data-chatter/internal/savedqueries"
+	"data-chatter/internal/semantic"
+	"data-chatter/internal/snapshots"
+	"data-chatter/internal/suggestions"
+	"data-chatter/internal/tenant"
 	"data-chatter/internal/types"
-)
+	"data-chatter/internal/version"
 
-// HealthResponse contains health check status information.
-type HealthResponse struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Uptime    string    `json:"uptime"`
-}
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
 
 // APIResponse represents a standardized API response format.
+// Error responses carry an apierror.Error with a stable code, and the
+// request ID so failures can be matched to logs.
 type APIResponse struct {
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	Message   string          `json:"message"`
+	Data      interface{}     `json:"data,omitempty"`
+	Error     *apierror.Error `json:"error,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
 }
 
 var startTime = time.Now()
 
 var toolEngine *engine.ToolEngine
 
+var toolRunner ToolRunner
+
+var auditLog *audit.Recorder
+
+var accessControl *rbac.Authorizer
+
+var orgContext *orgcontext.Store
+
+var notificationPrefs *notify.Store
+
+var dataDictionary *dictionary.Store
+
+var schemaNotes []dictionary.Note
+
+var businessCalendars *calendar.Set
+
+var qualityRules *quality.Store
+
+var externalTables *external.Store
+
+var querySnapshots *snapshots.Store
+
+var scheduledMetrics *metrics.Store
+
+var revealRequests *reveal.Store
+
+var suggestedQuestions *suggestions.Store
+
+var queryHistory *history.Store
+
+var savedQueries *savedqueries.Store
+
+var backgroundJobs *jobs.Manager
+
+var answerCache *answercache.Cache
+
+var queryCache *querycache.Cache
+
+var slowQueries *database.SlowQueryLog
+
+var turnStats *digest.Store
+
+var tenantProviders *tenant.ProviderStore
+
+var namedDatabases *catalog.Catalog
+
+var backupConn *database.Connection
+
+var backupKeys *encryption.Keyring
+
+var answerFeedback *feedback.Store
+
+var turnArtifacts *artifacts.Store
+
+var semanticIndex *semantic.Index
+
+var documents *knowledge.Store
+
+var conversationStore *conversation.Store
+
+var batchLimiter *middleware.RateLimiter
+
 // InitializeToolEngine initializes the global tool engine with database connection.
-func InitializeToolEngine(dbConn *database.Connection) {
-	toolEngine = engine.NewToolEngine(dbConn)
+func InitializeToolEngine(dbConn *database.Connection) error {
+	te, err := engine.NewToolEngine(dbConn)
+	if err != nil {
+		return err
+	}
+	toolEngine = te
+	toolRunner = te
+	return nil
 }
 
-// HealthHandler provides server health status and uptime information.
-func HealthHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// InitializeToolRunner replaces the runner the handlers list and execute
+// tools with, such as with a fake in tests. The tool engine is still the
+// one configured by the other Initialize functions and the admin tool
+// switches.
+func InitializeToolRunner(runner ToolRunner) {
+	toolRunner = runner
+}
+
+// InitializeAuditLog sets the recorder used to audit tool executions and queries.
+func InitializeAuditLog(recorder *audit.Recorder) {
+	auditLog = recorder
+}
+
+// InitializeAccessControl enforces the RBAC authorizer on tool calls and direct queries.
+func InitializeAccessControl(authorizer *rbac.Authorizer) {
+	accessControl = authorizer
+	if toolEngine != nil {
+		toolEngine.SetAuthorizer(authorizer)
 	}
+}
+
+// InitializeOrgContext sets the organization-wide context added to every prompt.
+func InitializeOrgContext(store *orgcontext.Store) {
+	orgContext = store
+}
 
-	uptime := time.Since(startTime)
-	response := HealthResponse{
-		Status:    "healthy",
-		Timestamp: time.Now(),
-		Uptime:    uptime.String(),
+// InitializeDictionary sets the data dictionary admins describe tables and
+// columns in. Its endpoints report 503 when store is nil.
+func InitializeDictionary(store *dictionary.Store) {
+	dataDictionary = store
+}
+
+// InitializeSchemaNotes sets the configured hints about tables and columns
+// added to the schema in every system prompt.
+func InitializeSchemaNotes(notes []dictionary.Note) {
+	schemaNotes = notes
+}
+
+// InitializeCalendars sets the business calendars described in every
+// system prompt.
+func InitializeCalendars(calendars *calendar.Set) {
+	businessCalendars = calendars
+}
+
+// InitializeColumnRules sets the configured accepted values and patterns
+// the column_validate tool checks columns against.
+func InitializeColumnRules(rules []dictionary.Rule) {
+	if toolEngine != nil {
+		toolEngine.SetColumnRules(rules)
+	}
+}
+
+// InitializeQuality sets the store of data-quality rules and their results,
+// which the quality_scorecard tool also reads. Its endpoints report 503 when
+// store is nil.
+func InitializeQuality(store *quality.Store) {
+	qualityRules = store
+	if toolEngine != nil {
+		toolEngine.SetQualityRules(store)
+	}
+}
+
+// InitializeArtifacts sets the store of files attached to turns, which the
+// artifact_create tool saves to. Downloads report 503 when store is nil.
+func InitializeArtifacts(store *artifacts.Store) {
+	turnArtifacts = store
+	if toolEngine != nil {
+		toolEngine.SetArtifacts(store)
+	}
+}
+
+// InitializeSemanticSearch sets the index the semantic_search tool
+// searches. Refreshing it reports 503 when index is nil.
+func InitializeSemanticSearch(index *semantic.Index) {
+	semanticIndex = index
+	if toolEngine != nil {
+		toolEngine.SetSemanticIndex(index)
+	}
+}
+
+// InitializeDocuments sets the business documentation retrieved into
+// prompts. Its endpoints report 503 when store is nil.
+func InitializeDocuments(store *knowledge.Store) {
+	documents = store
+}
+
+// InitializeExternalTables sets the store of registered external files. Its
+// endpoints report 503 when store is nil.
+func InitializeExternalTables(store *external.Store) {
+	externalTables = store
+}
+
+// InitializeSnapshots sets the store of snapshot tables, which query_diff
+// also compares with. Its endpoints report 503 when store is nil.
+func InitializeSnapshots(store *snapshots.Store) {
+	querySnapshots = store
+	if toolEngine != nil {
+		toolEngine.SetSnapshots(store)
+	}
+}
+
+// InitializeMetrics sets the store of scheduled metrics and their samples.
+// Its endpoints report 503 when store is nil.
+func InitializeMetrics(store *metrics.Store) {
+	scheduledMetrics = store
+}
+
+// InitializeReveal sets the store of requests to reveal masked values. Its
+// endpoints report 503 when store is nil.
+func InitializeReveal(store *reveal.Store) {
+	revealRequests = store
+}
+
+// InitializeSuggestions sets the catalog of admin-published suggested questions.
+func InitializeSuggestions(store *suggestions.Store) {
+	suggestedQuestions = store
+}
+
+// InitializeHistory sets the store of each user's past questions and queries.
+func InitializeHistory(store *history.Store) {
+	queryHistory = store
+}
+
+// InitializeSavedQueries sets the store of each user's saved queries, which
+// the saved_query_run tool also reads.
+func InitializeSavedQueries(store *savedqueries.Store) {
+	savedQueries = store
+	if toolEngine != nil {
+		toolEngine.SetSavedQueries(store)
+	}
+}
+
+// InitializeJobs sets the worker pool that runs async queries, tool calls,
+// and exports, and how it runs each kind of job, including those it
+// recovers after a restart. Exports run on EXPORT_WORKERS workers of their
+// own (default 1) for up to EXPORT_TIMEOUT (default 6h).
+func InitializeJobs(manager *jobs.Manager, dbConn *database.Connection) {
+	dh := NewDatabaseHandler(dbConn)
+	manager.Handle(jobs.KindQuery, func(ctx context.Context, job jobs.Job) jobs.Outcome {
+		return jobs.QueryOutcome(dh.runJob(ctx, job.Query))
+	})
+	manager.Handle(jobs.KindTools, func(ctx context.Context, job jobs.Job) jobs.Outcome {
+		return jobs.Outcome{Results: executeToolCalls(ctx, job.Tools)}
+	})
+	manager.Handle(jobs.KindExport, dh.runExport)
+	workers, timeout := 1, 6*time.Hour
+	if value, err := strconv.Atoi(os.Getenv("EXPORT_WORKERS")); err == nil && value > 0 {
+		workers = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("EXPORT_TIMEOUT")); err == nil && value > 0 {
+		timeout = value
+	}
+	manager.Dedicate(jobs.KindExport, workers, timeout)
+	backgroundJobs = manager
+	if toolEngine != nil {
+		toolEngine.SetJobs(manager)
+	}
+}
+
+// InitializeAnswerCache sets the cache of recent answers served to similar
+// questions.
+func InitializeAnswerCache(cache *answercache.Cache) {
+	answerCache = cache
+}
+
+// InitializeConversations sets the store LLM handlers keep conversations
+// in, such as one shared by every replica. Without it each handler keeps
+// its own in memory.
+func InitializeConversations(store *conversation.Store) {
+	conversationStore = store
+}
+
+// InitializeBatchLimiter sets the limiter each question of a batch takes a
+// token from, as a request to /llm/message would. Without it batches are
+// not limited.
+func InitializeBatchLimiter(limiter *middleware.RateLimiter) {
+	batchLimiter = limiter
+}
+
+// InitializeQueryCache sets the query result cache whose counters
+// GET /admin/query-cache reports. A nil cache reports as off.
+func InitializeQueryCache(cache *querycache.Cache) {
+	queryCache = cache
+}
+
+// InitializeSlowQueries sets the log of slow tool queries that
+// GET /admin/slow-queries reads.
+func InitializeSlowQueries(log *database.SlowQueryLog) {
+	slowQueries = log
+}
+
+// InitializeDigest sets the store every finished turn's statistics are
+// recorded in for the usage digest. Nothing is recorded when store is nil.
+func InitializeDigest(store *digest.Store) {
+	turnStats = store
+}
+
+// InitializeFeedback sets the store users' ratings of answers are saved
+// in. Feedback is unavailable when store is nil.
+func InitializeFeedback(store *feedback.Store) {
+	answerFeedback = store
+}
+
+// InitializeNotifications sets the store of per-user notification preferences.
+func InitializeNotifications(store *notify.Store) {
+	notificationPrefs = store
+}
+
+// InitializeDatabases sets the named databases chat sessions may switch to
+// and the cross_database_join tool queries. With a nil catalog sessions
+// stay on the default database.
+func InitializeDatabases(c *catalog.Catalog) {
+	namedDatabases = c
+	if toolEngine != nil {
+		toolEngine.SetDatabases(c)
+	}
+}
+
+// InitializeTenantProviders sets the store of tenants' own LLM provider
+// settings. Its endpoints report 503 when store is nil.
+func InitializeTenantProviders(store *tenant.ProviderStore) {
+	tenantProviders = store
+}
+
+// InitializeBackups sets the database whose metadata tables backups hold,
+// and the keys backups are sealed with, if any.
+func InitializeBackups(dbConn *database.Connection, keys *encryption.Keyring) {
+	backupConn = dbConn
+	backupKeys = keys
+}
+
+// auditToolCall records a tool execution with the caller's identity and outcome.
+func auditToolCall(ctx context.Context, toolCall types.ToolCall, result *types.ToolResult, err error) {
+	entry := audit.Entry{
+		Action:         "tool_execute",
+		Tool:           toolCall.Name,
+		ToolCallID:     toolCall.ID,
+		TurnID:         turnIDFromMetadata(toolCall),
+		Status:         "ok",
+		ConversationID: types.CallContextFromMetadata(toolCall.Metadata).ConversationID,
+		Details:        map[string]interface{}{"input": toolCall.Input},
+	}
+	if err != nil {
+		entry.Status = "error"
+		entry.Details["error"] = err.Error()
+	} else if result != nil && result.IsError {
+		entry.Status = "error"
+		if result.Error != nil {
+			entry.Details["error"] = result.Error.Message
+		}
+	}
+	auditLog.Record(ctx, entry)
+}
+
+// VersionHandler reports the running build's version, commit, and build time.
+func VersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(version.Get())
 }
 
 // HomeHandler serves the root endpoint with API information.
 func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.WriteMethodNotAllowed(w, r)
 		return
 	}
 
 	response := APIResponse{
 		Message: "Welcome to Data Chatter API",
 		Data: map[string]interface{}{
-			"version": "1.0.0",
+			"version":      version.Version,
+			"api_versions": apiversion.Supported,
 			"endpoints": map[string]string{
-				"health": "/health",
-				"api":    "/api/",
+				"health":  "/health",
+				"version": "/version",
+				"api":     "/api/",
+				"ui":      "/ui/",
+				"v1":      "/v1/",
 			},
 		},
 	}
@@ -95,11 +449,11 @@ func APIHandler(w http.ResponseWriter, r *http.Request) {
 // ToolsHandler returns a list of all available tools for LLM integration.
 func ToolsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.WriteMethodNotAllowed(w, r)
 		return
 	}
 
-	tools := toolEngine.GetAvailableTools()
+	tools := toolRunner.GetAvailableTools()
 	response := APIResponse{
 		Message: "Available tools",
 		Data:    tools,
@@ -113,15 +467,16 @@ func ToolsHandler(w http.ResponseWriter, r *http.Request) {
 // ToolCallHandler executes multiple tool calls in batch and returns results.
 func ToolCallHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.WriteMethodNotAllowed(w, r)
 		return
 	}
 
 	var request types.ToolExecutionRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		response := APIResponse{
-			Message: "Invalid request format",
-			Error:   err.Error(),
+			Message:   "Invalid request format",
+			Error:     apierror.New(apierror.InvalidRequest, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -131,8 +486,9 @@ func ToolCallHandler(w http.ResponseWriter, r *http.Request) {
 
 	if len(request.Tools) == 0 {
 		response := APIResponse{
-			Message: "No tools provided",
-			Error:   "At least one tool must be provided",
+			Message:   "No tools provided",
+			Error:     apierror.New(apierror.InvalidRequest, "At least one tool must be provided"),
+			RequestID: requestid.FromContext(r.Context()),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -140,7 +496,22 @@ func ToolCallHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	results := toolEngine.ExecuteTools(request.Tools)
+	if request.Async {
+		job, err := backgroundJobs.Submit(r.Context(), auth.UserID(r.Context()), jobs.Job{
+			Kind:        jobs.KindTools,
+			Tools:       request.Tools,
+			CallbackURL: request.CallbackURL,
+		})
+		if err != nil {
+			writeJobSubmitError(w, r, err)
+			return
+		}
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJobResponse(w, http.StatusAccepted, APIResponse{Message: "Tool calls accepted", Data: job})
+		return
+	}
+
+	results := executeToolCalls(r.Context(), request.Tools)
 	response := types.ToolExecutionResponse{
 		Results: results,
 	}
@@ -150,18 +521,28 @@ func ToolCallHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// executeToolCalls runs a batch of tool calls and audits each one.
+func executeToolCalls(ctx context.Context, toolCalls []types.ToolCall) []types.ToolResult {
+	results := toolRunner.ExecuteTools(ctx, toolCalls)
+	for i, toolCall := range toolCalls {
+		auditToolCall(ctx, toolCall, &results[i], nil)
+	}
+	return results
+}
+
 // SingleToolHandler executes a single tool call and returns the result.
 func SingleToolHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.WriteMethodNotAllowed(w, r)
 		return
 	}
 
 	var toolCall types.ToolCall
 	if err := json.NewDecoder(r.Body).Decode(&toolCall); err != nil {
 		response := APIResponse{
-			Message: "Invalid request format",
-			Error:   err.Error(),
+			Message:   "Invalid request format",
+			Error:     apierror.New(apierror.InvalidRequest, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -171,8 +552,9 @@ func SingleToolHandler(w http.ResponseWriter, r *http.Request) {
 
 	if toolCall.Name == "" {
 		response := APIResponse{
-			Message: "Tool name is required",
-			Error:   "Tool name cannot be empty",
+			Message:   "Tool name is required",
+			Error:     apierror.New(apierror.InvalidRequest, "Tool name cannot be empty"),
+			RequestID: requestid.FromContext(r.Context()),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -180,11 +562,28 @@ func SingleToolHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, err := toolEngine.ExecuteTool(toolCall.Name, toolCall.Input)
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("tool.call_id", toolCall.ID),
+		attribute.String("chat.turn_id", turnIDFromMetadata(toolCall)),
+	)
+
+	result, err := runToolCall(r.Context(), toolCall)
+	if errors.Is(err, errDatabaseSelection) {
+		response := APIResponse{
+			Message:   "Invalid database",
+			Error:     apierror.New(apierror.InvalidRequest, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
 	if err != nil {
 		response := APIResponse{
-			Message: "Tool execution failed",
-			Error:   err.Error(),
+			Message:   "Tool execution failed",
+			Error:     apierror.New(apierror.Internal, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -196,3 +595,25 @@ func SingleToolHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(result)
 }
+
+// runToolCall runs one tool call on the database its metadata names,
+// publishing its progress and auditing it. An unknown or unavailable
+// database is reported as errDatabaseSelection.
+func runToolCall(ctx context.Context, toolCall types.ToolCall) (*types.ToolResult, error) {
+	routed, err := routeToolCall(ctx, toolCall)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, finish := withToolProgress(routed, toolCall)
+	result, err := toolRunner.ExecuteCall(ctx, toolCall)
+	finish(result, err)
+	auditToolCall(ctx, toolCall, result, err)
+	if err != nil {
+		return nil, err
+	}
+	if result.ID == "" {
+		result.ID = toolCall.ID
+	}
+	return result, nil
+}
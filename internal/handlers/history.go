@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/events"
+	"data-chatter/internal/history"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/render"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 500
+)
+
+// HistoryRerunRequest runs a history entry again. Without ConversationID a
+// new conversation is started. TurnID and Nulls work as in MessageRequest.
+type HistoryRerunRequest struct {
+	ConversationID string `json:"conversation_id,omitempty"`
+	TurnID         string `json:"turn_id,omitempty"`
+	Nulls          string `json:"nulls,omitempty"`
+}
+
+// HistoryHandler serves GET /history?q=&limit=: the caller's past questions
+// and the queries that answered them, newest first. q keeps only entries
+// whose question or SQL contains it.
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	limit := defaultHistoryLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 {
+			apierror.WriteInvalidRequest(w, r, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxHistoryLimit)
+	}
+
+	entries := queryHistory.List(auth.UserID(r.Context()), r.URL.Query().Get("q"), limit)
+	if entries == nil {
+		entries = []history.Entry{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(APIResponse{Message: "Query history", Data: entries})
+}
+
+// HistoryRerunHandler runs the queries of a history entry again as a new
+// turn, without asking the LLM. The queries go through the same tools as
+// before, so they are validated, authorized, and audited against the
+// caller's current roles.
+func (lh *LLMHandler) HistoryRerunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var rerun HistoryRerunRequest
+	if err := json.NewDecoder(r.Body).Decode(&rerun); err != nil && !errors.Is(err, io.EOF) {
+		writeRerunError(w, r, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+	if _, err := render.ParseNullStyle(rerun.Nulls); err != nil {
+		writeRerunError(w, r, http.StatusBadRequest, "Invalid null style", err.Error())
+		return
+	}
+
+	entry, err := queryHistory.Get(auth.UserID(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeRerunError(w, r, http.StatusNotFound, "History entry not found", "No history entry with that ID")
+		return
+	}
+
+	request := MessageRequest{
+		Message:        entry.Prompt,
+		TurnID:         rerun.TurnID,
+		ConversationID: rerun.ConversationID,
+		Nulls:          rerun.Nulls,
+	}
+	if request.TurnID == "" {
+		request.TurnID = newTurnID()
+	}
+	conv, err := lh.resolveConversation(r.Context(), request)
+	if err != nil {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+	request.ConversationID = conv.ID
+	request.PreviousTurnID = conv.LastTurnID()
+	routed, err := lh.routeSession(r.Context(), conv, "")
+	if err != nil {
+		writeRerunError(w, r, http.StatusBadRequest, "Invalid database", err.Error())
+		return
+	}
+	r = r.WithContext(llm.WithTranscript(llm.WithUsageMeter(withConversationID(routed, conv.ID))))
+
+	recorder := &turnRecorder{ResponseWriter: w}
+	w = recorder
+	defer lh.recordTurn(r.Context(), conv.ID, request, recorder)
+	lh.announceTurn(r.Context(), request)
+
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("chat.turn_id", request.TurnID),
+		attribute.String("chat.history_entry", entry.ID),
+	)
+	progressBus.Start(request.TurnID, auth.UserID(r.Context()))
+	defer progressBus.Close(request.TurnID)
+	defer progressBus.Publish(events.Event{Type: events.TurnFinished, TurnID: request.TurnID})
+
+	ctx, endTurn := lh.beginTurn(r.Context(), request.TurnID)
+	defer endTurn()
+
+	saved := &llm.AnthropicResponse{StopReason: "tool_use"}
+	for i, query := range entry.Queries {
+		saved.Content = append(saved.Content, toolCallContent{
+			Type:  "tool_use",
+			ID:    fmt.Sprintf("history_%d", i+1),
+			Name:  query.Tool,
+			Input: query.Input,
+		})
+	}
+	lh.writeAnswer(ctx, w, request, saved, false)
+}
+
+// recordHistory adds a finished turn's successful tool calls to the caller's
+// query history. Turns that ran no tools, failed, or are waiting for
+// confirmation are left out.
+func recordHistory(ctx context.Context, request MessageRequest, status int, response MessageResponse) {
+	if status != http.StatusOK || response.Pending {
+		return
+	}
+
+	var queries []history.Query
+	for _, step := range response.Plan {
+		if step.Status == "ok" {
+			queries = append(queries, history.Query{Tool: step.Tool, SQL: step.SQL, Input: step.Input})
+		}
+	}
+	if len(queries) == 0 {
+		return
+	}
+
+	_, err := queryHistory.Add(auth.UserID(ctx), history.Entry{
+		Prompt:         request.Message,
+		Queries:        queries,
+		ConversationID: request.ConversationID,
+		TurnID:         request.TurnID,
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "failed to record query history", "turn_id", request.TurnID, "error", err)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+
+	"data-chatter/internal/llm"
+	"data-chatter/internal/sqlrewrite"
+	"data-chatter/internal/types"
+)
+
+// MessageProcessor is the LLM the chat handlers answer with. The server
+// uses *llm.AnthropicClient, which talks to every configured provider;
+// tests and alternate implementations pass their own to NewLLMHandlerWith.
+type MessageProcessor interface {
+	// Configured reports whether the provider requests made with ctx are
+	// sent to can be called.
+	Configured(ctx context.Context) bool
+
+	// FallbackResponse answers simple requests such as "show tables"
+	// without the LLM, for running in direct mode.
+	FallbackResponse(ctx context.Context, message string) (*llm.AnthropicResponse, bool)
+
+	// ProcessMessage asks the LLM which tools to call for message.
+	ProcessMessage(ctx context.Context, message string) (*llm.AnthropicResponse, error)
+
+	// PreviewMessage renders the request ProcessMessage would send.
+	PreviewMessage(ctx context.Context, message string) *llm.PromptPreview
+
+	// Summarize, SummarizeStream, and Format write the answer to question
+	// from the SQL run and its results.
+	Summarize(ctx context.Context, question, sql string, results interface{}, export llm.ExportLink) (string, error)
+	SummarizeStream(ctx context.Context, question, sql string, results interface{}, export llm.ExportLink, onText func(text string)) (string, error)
+	Format(ctx context.Context, format llm.ResponseFormat, question, sql string, results interface{}, export llm.ExportLink) (string, error)
+
+	// RewriteSQL rewrites query, which failed with failure, for dialect.
+	RewriteSQL(ctx context.Context, dialect, query, failure string, hints []sqlrewrite.Hint) (string, error)
+}
+
+// ToolRunner runs the tools the handlers call. The server uses
+// *engine.ToolEngine; InitializeToolRunner replaces it, such as with a fake
+// in tests.
+type ToolRunner interface {
+	// GetAvailableTools returns the definitions of the enabled tools.
+	GetAvailableTools() []types.ToolDefinition
+
+	// IsToolEnabled reports whether the tool called name may be called.
+	IsToolEnabled(name string) bool
+
+	// CheckTool validates a call without running it, returning the error
+	// result of a disabled, forbidden, or invalid call, or nil.
+	CheckTool(ctx context.Context, name string, input map[string]interface{}) (*types.ToolResult, error)
+
+	// ExecuteTool, ExecuteCall, and ExecuteTools run calls.
+	ExecuteTool(ctx context.Context, name string, input map[string]interface{}) (*types.ToolResult, error)
+	ExecuteCall(ctx context.Context, call types.ToolCall) (*types.ToolResult, error)
+	ExecuteTools(ctx context.Context, calls []types.ToolCall) []types.ToolResult
+}
@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/jobs"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/types"
+)
+
+// AsyncQueryRequest submits a query to run in the background. When
+// CallbackURL is set, the finished job is POSTed to it.
+type AsyncQueryRequest struct {
+	Query       string `json:"query"`
+	CallbackURL string `json:"callback_url,omitempty"`
+}
+
+// AsyncQueryHandler validates and authorizes a query, then queues it as a job
+// and responds 202 with the job at once. Poll GET /jobs/{id} or wait for the
+// callback for the result.
+func (dh *DatabaseHandler) AsyncQueryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var request AsyncQueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+
+	if err := dh.queryTool.Validate(map[string]interface{}{"query": request.Query}); err != nil {
+		writeJobError(w, r, http.StatusBadRequest, "Invalid query", err)
+		return
+	}
+
+	if err := accessControl.AuthorizeQuery(r.Context(), request.Query); err != nil {
+		auditLog.Record(r.Context(), audit.Entry{
+			Action:  "db_query_async",
+			Status:  "denied",
+			Details: map[string]interface{}{"query": request.Query, "error": err.Error()},
+		})
+		writeJobError(w, r, http.StatusForbidden, "Query not permitted", err)
+		return
+	}
+
+	job, err := backgroundJobs.Submit(r.Context(), auth.UserID(r.Context()), jobs.Job{
+		Kind:        jobs.KindQuery,
+		Query:       request.Query,
+		CallbackURL: request.CallbackURL,
+	})
+	if err != nil {
+		writeJobSubmitError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJobResponse(w, http.StatusAccepted, APIResponse{Message: "Query accepted", Data: job})
+}
+
+// JobHandler serves GET /jobs/{id}: the status of one of the caller's async
+// queries or tool call batches, with its result once it has finished.
+func JobHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	job, err := backgroundJobs.Get(r.Context(), auth.UserID(r.Context()), r.PathValue("id"))
+	if errors.Is(err, jobs.ErrNotFound) {
+		writeJobError(w, r, http.StatusNotFound, "Job not found", err)
+		return
+	}
+	if err != nil {
+		writeJobError(w, r, http.StatusInternalServerError, "Failed to read job", err)
+		return
+	}
+	writeJobResponse(w, http.StatusOK, APIResponse{Message: "Job", Data: job})
+}
+
+// runJob executes a job's query, auditing it like a direct query.
+func (dh *DatabaseHandler) runJob(ctx context.Context, query string) *types.ToolResult {
+	result, err := dh.queryTool.Execute(ctx, map[string]interface{}{"query": query})
+	auditLog.Record(ctx, audit.Entry{
+		Action:  "db_query_async",
+		Status:  queryStatus(result, err),
+		Details: map[string]interface{}{"query": query},
+	})
+	if err != nil {
+		return &types.ToolResult{
+			Content: []types.ToolContent{{Type: "text", Text: err.Error()}},
+			IsError: true,
+			Error:   &types.ToolError{Code: types.ErrorExecution, Message: err.Error()},
+		}
+	}
+	return result
+}
+
+// writeJobSubmitError reports a job that could not be queued: 503 with a
+// Retry-After header when the queue is full, 400 otherwise.
+func writeJobSubmitError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, jobs.ErrQueueFull) {
+		w.Header().Set("Retry-After", "5")
+		writeJobError(w, r, http.StatusServiceUnavailable, "Too many queued jobs", err)
+		return
+	}
+	writeJobError(w, r, http.StatusBadRequest, "Invalid job", err)
+}
+
+// writeJobError reports a failed job request.
+func writeJobError(w http.ResponseWriter, r *http.Request, status int, message string, err error) {
+	writeJobResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeJobResponse writes a job endpoint's JSON response.
+func writeJobResponse(w http.ResponseWriter, status int, response APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"data-chatter/internal/auth"
+
+	"golang.org/x/net/websocket"
+)
+
+// LiveConversationHandler streams a conversation's activity over a WebSocket
+// to the owner and the users it is shared with: who else has it open, the
+// questions they ask and the answers they get, and comments on results.
+// Browsers cannot set headers on WebSocket requests, so the token may be
+// passed as the access_token query parameter.
+func (lh *LLMHandler) LiveConversationHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	c, err := lh.conversations.Get(id)
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+
+	ctx := r.Context()
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		// Live connections outlive the server's read and write timeouts
+		ws.SetDeadline(time.Time{})
+
+		member, leave := lh.presence.Join(id, auth.UserID(ctx))
+		defer leave()
+
+		// Clients only listen; reading detects when they go away.
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			var discard string
+			for websocket.Message.Receive(ws, &discard) == nil {
+			}
+		}()
+
+		for {
+			select {
+			case event := <-member.Events:
+				if err := websocket.JSON.Send(ws, event); err != nil {
+					slog.DebugContext(ctx, "live conversation closed", "conversation_id", id, "error", err)
+					return
+				}
+			case <-closed:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}}
+	server.ServeHTTP(w, r)
+}
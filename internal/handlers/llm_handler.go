@@ -1,53 +1,326 @@
 package handlers
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
+	"sync"
+	"time"
 
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/artifacts"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/conversation"
 	"data-chatter/internal/database"
+	"data-chatter/internal/events"
 	"data-chatter/internal/llm"
+	"data-chatter/internal/presence"
+	"data-chatter/internal/render"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/suggestions"
+	"data-chatter/internal/types"
+	"data-chatter/internal/units"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// errTurnCancelled is the cancellation cause for turns aborted via the cancel endpoint.
+var errTurnCancelled = errors.New("turn cancelled by user")
+
+// statusClientClosedRequest is the conventional status for requests abandoned on the client's behalf.
+const statusClientClosedRequest = 499
+
 // LLMHandler handles LLM integration requests
 type LLMHandler struct {
-	anthropicClient *llm.AnthropicClient
+	processor   MessageProcessor
+	db          *database.Connection
+	turnTimeout time.Duration
+
+	converter     *units.Converter
+	recentResults *turnResultCache
+	traces        *turnTraceCache
+	toolRetry     toolRetryPolicy
+	rewriteSQL    bool
+	batch         batchPolicy
+	watermark     string
+	conversations *conversation.Store
+	presence      *presence.Hub
+	pendingTurns  *pendingTurnStore
+
+	turnsMu     sync.Mutex
+	activeTurns map[string]context.CancelCauseFunc
 }
 
-// NewLLMHandler creates a new LLM handler
+// NewLLMHandler creates a new LLM handler answering with the configured
+// providers over db.
 func NewLLMHandler(db *database.Connection) *LLMHandler {
+	client := llm.NewAnthropicClient(db)
+	client.ToolAvailable = func(name string) bool {
+		return toolRunner == nil || toolRunner.IsToolEnabled(name)
+	}
+	client.OrgContext = orgContext
+	client.Dictionary = dataDictionary
+	client.SchemaNotes = schemaNotes
+	client.SavedQueries = savedQueries
+	client.Documents = documents
+	client.Calendars = businessCalendars
+	client.ColumnVisible = func(ctx context.Context, table, column string) bool {
+		return accessControl.ColumnVisible(ctx, table, column)
+	}
+	client.ToolDefinitions = func(ctx context.Context) []types.ToolDefinition {
+		if toolRunner == nil {
+			return nil
+		}
+		var definitions []types.ToolDefinition
+		for _, definition := range toolRunner.GetAvailableTools() {
+			if accessControl.ToolAllowed(ctx, definition.Name) {
+				definitions = append(definitions, definition)
+			}
+		}
+		return definitions
+	}
+	return NewLLMHandlerWith(client, db, client.TurnTimeout)
+}
+
+// NewLLMHandlerWith creates an LLM handler answering with processor over
+// db, giving each turn turnTimeout to finish. Tool calls run in-process
+// through runToolCall, as /tools/single runs them, rather than over HTTP.
+func NewLLMHandlerWith(processor MessageProcessor, db *database.Connection, turnTimeout time.Duration) *LLMHandler {
+	conversations := conversationStore
+	if conversations == nil {
+		conversations = conversation.NewStore()
+	}
 	return &LLMHandler{
-		anthropicClient: llm.NewAnthropicClient(db),
+		processor:     processor,
+		db:            db,
+		turnTimeout:   turnTimeout,
+		converter:     units.NewConverter(units.RateSourceFromEnv()),
+		recentResults: newTurnResultCache(),
+		traces:        newTurnTraceCache(),
+		toolRetry:     toolRetryPolicyFromEnv(),
+		rewriteSQL:    sqlRewriteFromEnv(),
+		batch:         batchPolicyFromEnv(),
+		watermark:     watermarkModeFromEnv(),
+		conversations: conversations,
+		presence:      presence.NewHub(),
+		pendingTurns:  newPendingTurnStore(),
+		activeTurns:   make(map[string]context.CancelCauseFunc),
 	}
 }
 
-// MessageRequest represents a message from the UI
+// beginTurn registers a cancellable turn and returns its context and cleanup function.
+func (lh *LLMHandler) beginTurn(parent context.Context, turnID string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	ctx, cancelTimeout := context.WithTimeout(ctx, lh.turnTimeout)
+
+	lh.turnsMu.Lock()
+	lh.activeTurns[turnID] = cancel
+	lh.turnsMu.Unlock()
+
+	return ctx, func() {
+		lh.turnsMu.Lock()
+		delete(lh.activeTurns, turnID)
+		lh.turnsMu.Unlock()
+		cancelTimeout()
+		cancel(nil)
+	}
+}
+
+// CancelTurnHandler aborts an in-progress chat turn, cancelling the LLM call
+// and any tool calls it is running.
+func (lh *LLMHandler) CancelTurnHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	turnID := r.PathValue("id")
+
+	lh.turnsMu.Lock()
+	cancel, exists := lh.activeTurns[turnID]
+	lh.turnsMu.Unlock()
+
+	if !exists {
+		response := APIResponse{
+			Message:   "Turn not found",
+			Error:     apierror.New(apierror.NotFound, "No in-progress turn with that ID"),
+			RequestID: requestid.FromContext(r.Context()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	cancel(errTurnCancelled)
+
+	response := APIResponse{
+		Message: "Turn cancellation requested",
+		Data:    map[string]string{"turn_id": turnID},
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeTurnCancelled reports that a chat turn was aborted by the user.
+func writeTurnCancelled(ctx context.Context, w http.ResponseWriter, turnID string) {
+	writeMessageResponse(w, statusClientClosedRequest, turnCancelledResponse(ctx, turnID))
+}
+
+// turnCancelledResponse describes a chat turn aborted by the user.
+func turnCancelledResponse(ctx context.Context, turnID string) MessageResponse {
+	return MessageResponse{
+		ConversationID: conversationIDFromContext(ctx),
+		TurnID:         turnID,
+		Message:        "Request cancelled",
+		Error:          apierror.New(apierror.TurnCancelled, errTurnCancelled.Error()),
+		RequestID:      requestid.FromContext(ctx),
+	}
+}
+
+// MessageRequest represents a message from the UI.
+// TurnID is optional; clients that want progress events generate it up front
+// and subscribe to /llm/message/{id}/events before posting.
+// PreviousTurnID lets follow-ups such as "in EUR" reuse the prior turn's results.
+// ConversationID adds the turn to an existing conversation; without it a new
+// conversation is started. Within a conversation PreviousTurnID defaults to
+// its last turn.
+// Nulls selects how NULLs appear in the merged rows (null, empty, or na).
 type MessageRequest struct {
-	Message string `json:"message"`
+	Message        string `json:"message"`
+	TurnID         string `json:"turn_id,omitempty"`
+	PreviousTurnID string `json:"previous_turn_id,omitempty"`
+	ConversationID string `json:"conversation_id,omitempty"`
+	Nulls          string `json:"nulls,omitempty"`
+
+	// SuggestionID asks a suggested question from /suggestions in place of
+	// Message; it is answered by the suggestion's saved query.
+	SuggestionID string `json:"suggestion_id,omitempty"`
+
+	// DryRun returns the tool calls the LLM plans to make, validated but not
+	// executed; POST /llm/confirm/{turn_id} runs them.
+	DryRun bool `json:"dry_run,omitempty"`
+
+	// Summary asks for a narrative summary of the results from the LLM. The
+	// results are returned at once and the summary is streamed afterwards
+	// on /llm/message/{id}/events, so slow summaries do not hold up the rows.
+	Summary bool `json:"summary,omitempty"`
+
+	// ResponseFormat is how results are presented in the message: "raw"
+	// (the default) leaves them to the client, while "summary" and
+	// "markdown_table" have the LLM write a short answer or a table from
+	// them before the response is sent.
+	ResponseFormat string `json:"response_format,omitempty"`
+
+	// NoCache skips the answer cache, so the question is sent to the LLM
+	// even when a similar one was answered recently, and the query result
+	// cache, so its queries read current data.
+	NoCache bool `json:"no_cache,omitempty"`
+
+	// Database switches the conversation to a database from DATABASES_FILE,
+	// or back to "default", for this turn and the ones after it.
+	Database string `json:"database,omitempty"`
+
+	// Deterministic sends the turn's LLM requests in determinism mode, so
+	// the same question over the same data gets the same answer.
+	Deterministic bool `json:"deterministic,omitempty"`
 }
 
 // MessageResponse represents the response to the UI
 type MessageResponse struct {
-	Message string      `json:"message"`
-	Results interface{} `json:"results,omitempty"`
-	Error   string      `json:"error,omitempty"`
+	TurnID         string          `json:"turn_id,omitempty"`
+	ConversationID string          `json:"conversation_id,omitempty"`
+	Message        string          `json:"message"`
+	Results        interface{}     `json:"results,omitempty"`
+	Plan           []PlanStep      `json:"plan,omitempty"`
+	Error          *apierror.Error `json:"error,omitempty"`
+
+	// RequestID is set on errors so a failed turn can be matched to its logs,
+	// tool results, and audit entries.
+	RequestID string `json:"request_id,omitempty"`
+
+	// Rows merges the rows of every tabular result, each tagged with a
+	// "_source" RowSource so any value can be traced to its tool call and SQL.
+	Rows []map[string]interface{} `json:"rows,omitempty"`
+
+	// Conversions lists result columns converted to the unit the user asked for.
+	Conversions []units.Conversion `json:"conversions,omitempty"`
+
+	// Artifacts lists the files the agent attached to the turn, downloadable
+	// from /conversations/{id}/artifacts/{artifact}.
+	Artifacts []artifacts.Artifact `json:"artifacts,omitempty"`
+
+	// Pending is set on dry-run answers whose plan is waiting for confirmation.
+	Pending bool `json:"pending,omitempty"`
+
+	// SuggestionID names the suggested question whose saved query answered
+	// the turn, whether it was asked by ID or matched the user's question.
+	SuggestionID string `json:"suggestion_id,omitempty"`
+
+	// SummaryPending is set when a requested summary of the results will
+	// follow as summary_delta and summary_finished events.
+	SummaryPending bool `json:"summary_pending,omitempty"`
+
+	// ResponseFormat is set when the LLM wrote the message from the results
+	// in the requested format.
+	ResponseFormat llm.ResponseFormat `json:"response_format,omitempty"`
+
+	// Cached is set when the answer was given earlier to a similar question
+	// and served from the answer cache.
+	Cached *CachedAnswer `json:"cached,omitempty"`
+
+	// LLMRetries is set when the LLM provider was rate limiting or
+	// overloaded and the request had to be sent more than once.
+	LLMRetries *llm.RetryInfo `json:"llm_retries,omitempty"`
+
+	// Mode is "direct" when no LLM provider is configured, so the turn was
+	// answered by rules, with SQL built from the question's keywords, or,
+	// with an llm_unavailable error, was beyond them.
+	Mode string `json:"mode,omitempty"`
+}
+
+// directMode labels answers given without an LLM.
+const directMode = "direct"
+
+// PlanStep records one tool call the agent made while answering a turn,
+// so users can audit how the answer was derived.
+type PlanStep struct {
+	Step       int                    `json:"step"`
+	ToolCallID string                 `json:"tool_call_id"`
+	Tool       string                 `json:"tool"`
+	SQL        string                 `json:"sql,omitempty"`
+	Input      map[string]interface{} `json:"input,omitempty"`
+	DurationMs int64                  `json:"duration_ms"`
+	Status     string                 `json:"status"`
+	Attempts   int                    `json:"attempts"` // More than 1 when retryable errors were retried
+	Error      string                 `json:"error,omitempty"`
+	ErrorType  string                 `json:"error_type,omitempty"` // Stable tool error code, e.g. "syntax_error"
+
+	// RewrittenFrom is the query the model first wrote, when it failed for
+	// the database's dialect and SQL holds the rewrite that was run instead.
+	RewrittenFrom string `json:"rewritten_from,omitempty"`
 }
 
 // ProcessMessageHandler handles message processing with LLM
 func (lh *LLMHandler) ProcessMessageHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		apierror.WriteMethodNotAllowed(w, r)
 		return
 	}
 
 	var request MessageRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		response := MessageResponse{
-			Message: "Invalid request format",
-			Error:   err.Error(),
+			Message:   "Invalid request format",
+			Error:     apierror.New(apierror.InvalidRequest, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -55,10 +328,47 @@ func (lh *LLMHandler) ProcessMessageHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if request.NoCache {
+		cc := types.CallContextFrom(r.Context())
+		cc.CacheControl = "no-cache"
+		r = r.WithContext(types.WithCallContext(r.Context(), cc))
+	}
+
+	var suggestion *suggestions.Suggestion
+	if request.SuggestionID != "" {
+		found, err := suggestedQuestions.Get(request.SuggestionID)
+		if err != nil {
+			response := MessageResponse{
+				Message:   "Suggestion not found",
+				Error:     apierror.New(apierror.NotFound, "No suggested question with that ID"),
+				RequestID: requestid.FromContext(r.Context()),
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		suggestion = &found
+		request.Message = found.Question
+	}
+
 	if request.Message == "" {
 		response := MessageResponse{
-			Message: "Message is required",
-			Error:   "Message cannot be empty",
+			Message:   "Message is required",
+			Error:     apierror.New(apierror.InvalidRequest, "Message cannot be empty"),
+			RequestID: requestid.FromContext(r.Context()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if _, err := render.ParseNullStyle(request.Nulls); err != nil {
+		response := MessageResponse{
+			Message:   "Invalid null style",
+			Error:     apierror.New(apierror.InvalidRequest, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusBadRequest)
@@ -66,24 +376,140 @@ func (lh *LLMHandler) ProcessMessageHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	if _, err := llm.ParseResponseFormat(request.ResponseFormat); err != nil {
+		response := MessageResponse{
+			Message:   "Invalid response format",
+			Error:     apierror.New(apierror.InvalidRequest, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if request.TurnID == "" {
+		request.TurnID = newTurnID()
+	}
+
+	conv, err := lh.resolveConversation(r.Context(), request)
+	if err != nil {
+		response := MessageResponse{
+			TurnID:    request.TurnID,
+			Message:   "Conversation not found",
+			Error:     apierror.New(apierror.NotFound, "No conversation with that ID"),
+			RequestID: requestid.FromContext(r.Context()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	request.ConversationID = conv.ID
+	if request.PreviousTurnID == "" {
+		request.PreviousTurnID = conv.LastTurnID()
+	}
+	routed, err := lh.routeSession(r.Context(), conv, request.Database)
+	if err != nil {
+		response := MessageResponse{
+			TurnID:         request.TurnID,
+			ConversationID: conv.ID,
+			Message:        "Invalid database",
+			Error:          apierror.New(apierror.InvalidRequest, err.Error()),
+			RequestID:      requestid.FromContext(r.Context()),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	if request.Deterministic {
+		routed = llm.WithDeterminism(routed)
+	}
+	r = r.WithContext(llm.WithTranscript(llm.WithUsageMeter(withConversationID(routed, conv.ID))))
+
+	// Keep a copy of the answer for the conversation history
+	recorder := &turnRecorder{ResponseWriter: w}
+	w = recorder
+	defer lh.recordTurn(r.Context(), conv.ID, request, recorder)
+	lh.announceTurn(r.Context(), request)
+
+	trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("chat.turn_id", request.TurnID))
+	progressBus.Start(request.TurnID, auth.UserID(r.Context()))
+	defer progressBus.Close(request.TurnID)
+	defer progressBus.Publish(events.Event{Type: events.TurnFinished, TurnID: request.TurnID})
+
+	// The turn budget bounds the LLM call and every tool call it triggers
+	ctx, endTurn := lh.beginTurn(r.Context(), request.TurnID)
+	defer endTurn()
+
+	// Suggested questions are answered by their saved query
+	if suggestion != nil {
+		lh.writeSuggestion(ctx, w, request, *suggestion)
+		return
+	}
+
+	// Slash commands such as /tables and /sql skip the LLM entirely
+	if isSlashCommand(request.Message) {
+		lh.writeSlashCommand(ctx, w, request)
+		return
+	}
+
+	// Unit conversion follow-ups reuse the previous turn's results
+	if request.PreviousTurnID != "" && lh.converter.IsFollowUp(request.Message) {
+		if previous, ok := lh.recentResults.Get(request.PreviousTurnID); ok {
+			lh.writeConvertedFollowUp(ctx, w, request, previous)
+			return
+		}
+	}
+
+	// Questions close to a suggested question get its vetted saved query
+	if match, similarity, ok := suggestedQuestions.Match(request.Message, func(suggestion suggestions.Suggestion) bool {
+		return accessControl.AuthorizeQuery(ctx, suggestion.SQL) == nil
+	}); ok {
+		slog.InfoContext(ctx, "answering with matching suggestion", "turn_id", request.TurnID, "suggestion_id", match.ID, "similarity", similarity)
+		lh.writeSuggestion(ctx, w, request, match)
+		return
+	}
+
+	// Without a provider, answer simple requests from rules or explain how to set one up
+	if !lh.processor.Configured(ctx) {
+		fallback, ok := lh.processor.FallbackResponse(ctx, request.Message)
+		if !ok {
+			writeLLMUnavailable(ctx, w, request.TurnID)
+			return
+		}
+		lh.writeAnswer(ctx, w, request, fallback, true)
+		return
+	}
+
+	// Questions close to one the caller asked recently get its answer while the tables are unchanged
+	if lh.writeCachedAnswer(ctx, w, request) {
+		return
+	}
+
 	// Process message with Anthropic
-	anthropicResponse, err := lh.anthropicClient.ProcessMessage(request.Message)
+	anthropicResponse, err := lh.processor.ProcessMessage(ctx, request.Message)
 	if err != nil {
-		// Check if it's an API key error
-		if strings.Contains(err.Error(), "ANTHROPIC_API_KEY") {
-			response := MessageResponse{
-				Message: "❌ Anthropic API key not configured",
-				Error:   err.Error(),
-			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(response)
+		if errors.Is(context.Cause(ctx), errTurnCancelled) {
+			writeTurnCancelled(ctx, w, request.TurnID)
+			return
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			writeTurnTimeout(ctx, w, err)
+			return
+		}
+		var apiErr *llm.APIError
+		if errors.As(err, &apiErr) && apiErr.Retryable() {
+			writeLLMBusy(ctx, w, request.TurnID, apiErr)
 			return
 		}
 
 		response := MessageResponse{
-			Message: "Failed to process message with LLM",
-			Error:   err.Error(),
+			ConversationID: conversationIDFromContext(ctx),
+			Message:        "Failed to process message with LLM",
+			Error:          apierror.New(apierror.LLMError, err.Error()),
+			RequestID:      requestid.FromContext(ctx),
 		}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusInternalServerError)
@@ -91,88 +517,311 @@ func (lh *LLMHandler) ProcessMessageHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	lh.writeAnswer(ctx, w, request, anthropicResponse, false)
+	lh.cacheAnswer(ctx, request, recorder)
+}
+
+// writeAnswer executes the tool calls in an LLM response and writes their
+// results, or writes the response text when no tools were called. Degraded
+// answers come from direct mode's rules and are labelled as such.
+// Dry-run requests get a preview of the tool calls instead. A requested
+// summary of the results follows on the turn's event stream.
+func (lh *LLMHandler) writeAnswer(ctx context.Context, w http.ResponseWriter, request MessageRequest, anthropicResponse *llm.AnthropicResponse, degraded bool) {
+	if request.DryRun && len(anthropicResponse.Content) > 0 && anthropicResponse.Content[0].Type == "tool_use" {
+		lh.writePreview(ctx, w, request, anthropicResponse, degraded)
+		return
+	}
+	status, response := lh.answer(ctx, request, anthropicResponse, degraded)
+	if degraded {
+		response.Mode = directMode
+	}
+	if anthropicResponse.Retries.Attempts > 1 {
+		response.LLMRetries = &anthropicResponse.Retries
+	}
+	lh.formatAnswer(ctx, request, status, &response, degraded)
+	queries, summarize := lh.summaryQueries(ctx, request, status, response, degraded)
+	response.SummaryPending = summarize
+	writeMessageResponse(w, status, response)
+	if summarize {
+		lh.summarizeLater(ctx, request, queries, response.Results)
+	}
+}
+
+// answer runs the tool calls in an LLM response and builds the turn's
+// response and HTTP status.
+func (lh *LLMHandler) answer(ctx context.Context, request MessageRequest, anthropicResponse *llm.AnthropicResponse, degraded bool) (int, MessageResponse) {
 	// Check if LLM wants to use tools
 	if len(anthropicResponse.Content) > 0 && anthropicResponse.Content[0].Type == "tool_use" {
-		// Debug: Log how many tool calls we received
-		fmt.Printf("DEBUG: Received %d tool calls from LLM\n", len(anthropicResponse.Content))
+		slog.DebugContext(ctx, "received tool calls from LLM", "turn_id", request.TurnID, "count", len(anthropicResponse.Content))
 
 		// Execute all tool calls in sequence
-		var allResults []interface{}
+		var allResults []map[string]interface{}
+		var plan []PlanStep
 		var lastError error
 
 		for i, content := range anthropicResponse.Content {
 			if content.Type == "tool_use" {
-				fmt.Printf("DEBUG: Executing tool call %d: %s\n", i+1, content.Name)
-				results, err := lh.executeToolCall(content)
+				slog.DebugContext(ctx, "executing tool call", "turn_id", request.TurnID, "index", i+1, "tool", content.Name)
+				step := PlanStep{
+					Step:       len(plan) + 1,
+					ToolCallID: content.ID,
+					Tool:       content.Name,
+					Input:      content.Input,
+					Status:     "ok",
+				}
+				step.SQL, _ = content.Input["query"].(string)
+
+				start := time.Now()
+				results, attempts, err := lh.executeWithRetry(ctx, request.TurnID, content)
+				if err == nil {
+					if rewritten, ok := lh.rewriteFailedQuery(ctx, request.TurnID, content, results); ok {
+						step.RewrittenFrom = step.SQL
+						step.SQL, _ = rewritten.Input["query"].(string)
+						step.Input = rewritten.Input
+						var more int
+						results, more, err = lh.executeWithRetry(ctx, request.TurnID, rewritten)
+						attempts += more
+					}
+				}
+				step.DurationMs = time.Since(start).Milliseconds()
+				step.Attempts = attempts
 				if err != nil {
+					step.Status = "error"
+					step.Error = err.Error()
+					plan = append(plan, step)
 					lastError = err
 					break
 				}
+				if isError, _ := results["is_error"].(bool); isError {
+					step.Status = "error"
+					step.ErrorType, step.Error = toolErrorFields(results)
+				}
+				plan = append(plan, step)
 				allResults = append(allResults, results)
 			}
 		}
 
 		if lastError != nil {
+			if errors.Is(context.Cause(ctx), errTurnCancelled) {
+				return statusClientClosedRequest, turnCancelledResponse(ctx, request.TurnID)
+			}
+			if errors.Is(lastError, context.DeadlineExceeded) {
+				return http.StatusGatewayTimeout, turnTimeoutResponse(ctx, lastError)
+			}
+
 			response := MessageResponse{
-				Message: "Failed to execute tool call",
-				Error:   lastError.Error(),
+				ConversationID: conversationIDFromContext(ctx),
+				TurnID:         request.TurnID,
+				Message:        "Failed to execute tool call",
+				Plan:           plan,
+				Error:          apierror.New(apierror.Internal, lastError.Error()),
+				RequestID:      requestid.FromContext(ctx),
 			}
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(response)
-			return
+			return http.StatusInternalServerError, response
 		}
 
+		lh.recentResults.Put(request.TurnID, allResults)
+
 		// Return results directly to UI
 		response := MessageResponse{
-			Message: "Query executed successfully",
-			Results: allResults,
+			ConversationID: conversationIDFromContext(ctx),
+			TurnID:         request.TurnID,
+			Message:        "Query executed successfully",
+			Results:        allResults,
+			Plan:           plan,
+			Artifacts:      collectArtifacts(plan, allResults),
+		}
+		if degraded {
+			response.Message = "Query executed successfully (direct mode: no LLM is configured, so the SQL was built from the question's keywords; check it in the plan)"
+		}
+		for _, step := range plan {
+			if step.Status == "error" {
+				response.Message = explainToolFailure(step)
+				break
+			}
+		}
+
+		finalResults := allResults
+		if target, ok := lh.converter.ParseTarget(request.Message); ok {
+			converted, conversions, err := convertToolResults(ctx, lh.converter, allResults, target)
+			if err != nil {
+				response.Message = fmt.Sprintf("Query executed successfully, but unit conversion failed: %v", err)
+			} else if len(conversions) > 0 {
+				finalResults = converted
+				response.Results = converted
+				response.Conversions = conversions
+			}
+		}
+		response.Rows = mergeResultRows(finalResults, plan)
+		nulls, _ := render.ParseNullStyle(request.Nulls)
+		render.ApplyNulls(response.Rows, nulls)
+		return http.StatusOK, response
+	}
+
+	// If no tool use, return the text response
+	response := MessageResponse{
+		ConversationID: conversationIDFromContext(ctx),
+		TurnID:         request.TurnID,
+		Message:        anthropicResponse.Content[0].Text,
+	}
+	return http.StatusOK, response
+}
+
+// writeMessageResponse writes a chat response with its HTTP status.
+func writeMessageResponse(w http.ResponseWriter, status int, response MessageResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// writeSlashCommand answers a slash command directly from the schema or tools.
+func (lh *LLMHandler) writeSlashCommand(ctx context.Context, w http.ResponseWriter, request MessageRequest) {
+	answer, err := slashCommandResponse(ctx, lh.db.For(ctx), request.Message)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "Failed to run command"
+		var invalid commandError
+		if errors.As(err, &invalid) {
+			status = http.StatusBadRequest
+			message = "Invalid command"
+		}
+
+		response := MessageResponse{
+			ConversationID: conversationIDFromContext(ctx),
+			TurnID:         request.TurnID,
+			Message:        message,
+			Error:          apierror.New(apierror.ForStatus(status), err.Error()),
+			RequestID:      requestid.FromContext(ctx),
 		}
 		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
+		w.WriteHeader(status)
 		json.NewEncoder(w).Encode(response)
 		return
 	}
 
-	// If no tool use, return the text response
+	lh.writeAnswer(ctx, w, request, answer, false)
+}
+
+// writeConvertedFollowUp answers a unit conversion follow-up from a previous turn's results.
+func (lh *LLMHandler) writeConvertedFollowUp(ctx context.Context, w http.ResponseWriter, request MessageRequest, previous []map[string]interface{}) {
+	target, _ := lh.converter.ParseTarget(request.Message)
+	converted, conversions, err := convertToolResults(ctx, lh.converter, previous, target)
+	if err != nil {
+		response := MessageResponse{
+			ConversationID: conversationIDFromContext(ctx),
+			TurnID:         request.TurnID,
+			Message:        "Failed to convert previous results",
+			Error:          apierror.New(apierror.InvalidRequest, err.Error()),
+			RequestID:      requestid.FromContext(ctx),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	message := fmt.Sprintf("Converted previous results to %s (no new query was run)", target)
+	if len(conversions) == 0 {
+		message = fmt.Sprintf("No columns in the previous results could be converted to %s", target)
+	}
+
+	lh.recentResults.Put(request.TurnID, converted)
+
 	response := MessageResponse{
-		Message: anthropicResponse.Content[0].Text,
+		ConversationID: conversationIDFromContext(ctx),
+		TurnID:         request.TurnID,
+		Message:        message,
+		Results:        converted,
+		Conversions:    conversions,
+		Rows:           mergeResultRows(converted, nil),
 	}
+	nulls, _ := render.ParseNullStyle(request.Nulls)
+	render.ApplyNulls(response.Rows, nulls)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-// executeToolCall executes a tool call and returns the results
-func (lh *LLMHandler) executeToolCall(toolUseContent struct {
-	Type  string                 `json:"type"`
-	Text  string                 `json:"text,omitempty"`
-	ID    string                 `json:"id,omitempty"`
-	Name  string                 `json:"name,omitempty"`
-	Input map[string]interface{} `json:"input,omitempty"`
-}) (interface{}, error) {
-	// Convert Anthropic tool use to our tool call format
-	toolCall := map[string]interface{}{
-		"id":    toolUseContent.ID,
-		"type":  "tool_use",
-		"name":  toolUseContent.Name,
-		"input": toolUseContent.Input,
+// writeLLMUnavailable reports that no LLM provider is configured and the
+// request is beyond what direct mode handles.
+func writeLLMUnavailable(ctx context.Context, w http.ResponseWriter, turnID string) {
+	response := MessageResponse{
+		ConversationID: conversationIDFromContext(ctx),
+		TurnID:         turnID,
+		RequestID:      requestid.FromContext(ctx),
+		Message:        "❌ LLM provider not configured",
+		Error: apierror.New(apierror.LLMUnavailable, "Set ANTHROPIC_API_KEY, or LLM_PROVIDER and its settings, and restart the server to enable chat. "+
+			"Until then, /db/query and /tools/* remain available, and direct mode answers simple questions about one table without an LLM, "+
+			`such as "show tables", "how many contacts", "average salary of employees by department", or "top 5 products by price".`),
+		Mode: directMode,
 	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(response)
+}
 
-	// Execute the tool call using our existing tool system
-	jsonData, _ := json.Marshal(toolCall)
+// writeLLMBusy reports that the LLM provider was still rate limiting or
+// overloaded after every retry, passing on how long it asked clients to wait.
+func writeLLMBusy(ctx context.Context, w http.ResponseWriter, turnID string, apiErr *llm.APIError) {
+	response := MessageResponse{
+		ConversationID: conversationIDFromContext(ctx),
+		TurnID:         turnID,
+		Message:        "The LLM provider is busy; try again shortly",
+		Error:          apierror.New(apierror.LLMRateLimited, apiErr.Error()),
+		RequestID:      requestid.FromContext(ctx),
+		LLMRetries:     &llm.RetryInfo{Attempts: apiErr.Attempts, LastStatus: apiErr.StatusCode},
+	}
+	retryAfter := max(int(math.Ceil(apiErr.RetryAfter.Seconds())), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	writeMessageResponse(w, http.StatusServiceUnavailable, response)
+}
+
+// writeTurnTimeout reports that a chat turn exhausted its deadline budget.
+func writeTurnTimeout(ctx context.Context, w http.ResponseWriter, err error) {
+	writeMessageResponse(w, http.StatusGatewayTimeout, turnTimeoutResponse(ctx, err))
+}
+
+// turnTimeoutResponse describes a chat turn that exhausted its deadline budget.
+func turnTimeoutResponse(ctx context.Context, err error) MessageResponse {
+	return MessageResponse{
+		ConversationID: conversationIDFromContext(ctx),
+		Message:        "Request timed out before the answer was ready",
+		Error:          apierror.New(apierror.TurnTimeout, err.Error()),
+		RequestID:      requestid.FromContext(ctx),
+	}
+}
 
-	// Make HTTP call to our own tool execution endpoint
-	resp, err := http.Post("http://localhost:8081/tools/single", "application/json", bytes.NewBuffer(jsonData))
+// executeToolCall runs a tool call in process, with the caller's identity,
+// tenant, and session database, and returns its result as a JSON object.
+func (lh *LLMHandler) executeToolCall(ctx context.Context, turnID string, toolUseContent toolCallContent) (map[string]interface{}, error) {
+	// Convert Anthropic tool use to our tool call format
+	toolCall := types.ToolCall{
+		ID:    toolUseContent.ID,
+		Type:  "tool_use",
+		Name:  toolUseContent.Name,
+		Input: toolUseContent.Input,
+		Metadata: types.CallContext{
+			UserID:         auth.UserID(ctx),
+			ConversationID: conversationIDFromContext(ctx),
+			TurnID:         turnID,
+			Locale:         types.CallContextFrom(ctx).Locale,
+			CacheControl:   types.CallContextFrom(ctx).CacheControl,
+			Database:       sessionDatabase(ctx),
+		}.Metadata(),
+	}
+
+	toolResult, err := runToolCall(ctx, toolCall)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute tool call: %w", err)
 	}
-	defer resp.Body.Close()
-
-	body, _ := io.ReadAll(resp.Body)
 
+	// Callers read the result as the tool endpoint returns it
+	jsonData, err := json.Marshal(toolResult)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode tool result: %w", err)
+	}
 	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
+	if err := json.Unmarshal(jsonData, &result); err != nil {
 		return nil, fmt.Errorf("failed to parse tool result: %w", err)
 	}
 
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/metrics"
+	"data-chatter/internal/requestid"
+)
+
+// defaultSamplesWindow is how far back GET /admin/metrics/{id}/samples reads
+// without ?since=.
+const defaultSamplesWindow = 7 * 24 * time.Hour
+
+// MetricRequest defines a metric.
+type MetricRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Query       string   `json:"query"`
+	Interval    string   `json:"interval"`
+	Seasonality string   `json:"seasonality,omitempty"`
+	Threshold   float64  `json:"threshold,omitempty"`
+	Subscribers []string `json:"subscribers,omitempty"`
+}
+
+// MetricsHandler lists the metrics on GET and adds one on POST. The new
+// metric's query is run once and must return a number.
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if scheduledMetrics == nil {
+		writeMetricsUnavailable(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := scheduledMetrics.List(r.Context())
+		if err != nil {
+			writeMetricError(w, r, err)
+			return
+		}
+		if list == nil {
+			list = []metrics.Metric{}
+		}
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Metrics", Data: list})
+
+	case http.MethodPost:
+		var request MetricRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		metric, err := scheduledMetrics.Add(r.Context(), metrics.Metric{
+			Name:        request.Name,
+			Description: request.Description,
+			Query:       request.Query,
+			Interval:    request.Interval,
+			Seasonality: request.Seasonality,
+			Threshold:   request.Threshold,
+			Subscribers: request.Subscribers,
+			CreatedBy:   auth.UserID(r.Context()),
+		})
+		if err != nil {
+			writeMetricError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "metric_added", Status: "ok", Details: map[string]interface{}{"id": metric.ID, "name": metric.Name}})
+		writeAdminResponse(w, http.StatusCreated, APIResponse{Message: "Metric added", Data: metric})
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// MetricHandler returns (GET) or removes (DELETE) a metric. Removing a
+// metric removes its samples.
+func MetricHandler(w http.ResponseWriter, r *http.Request) {
+	if scheduledMetrics == nil {
+		writeMetricsUnavailable(w, r)
+		return
+	}
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		metric, err := scheduledMetrics.Get(r.Context(), id)
+		if err != nil {
+			writeMetricError(w, r, err)
+			return
+		}
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Metric", Data: metric})
+
+	case http.MethodDelete:
+		if err := scheduledMetrics.Delete(r.Context(), id); err != nil {
+			writeMetricError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "metric_deleted", Status: "ok", Details: map[string]interface{}{"id": id}})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// MetricSamplesHandler returns a metric's samples, oldest first, from the
+// last ?since= (a duration like "72h", default a week).
+func MetricSamplesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if scheduledMetrics == nil {
+		writeMetricsUnavailable(w, r)
+		return
+	}
+
+	window := defaultSamplesWindow
+	if raw := r.URL.Query().Get("since"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+				Message:   "Invalid since",
+				Error:     apierror.New(apierror.InvalidRequest, "since must be a positive duration like \"72h\""),
+				RequestID: requestid.FromContext(r.Context()),
+			})
+			return
+		}
+		window = parsed
+	}
+
+	id := r.PathValue("id")
+	if _, err := scheduledMetrics.Get(r.Context(), id); err != nil {
+		writeMetricError(w, r, err)
+		return
+	}
+	samples, err := scheduledMetrics.Samples(r.Context(), id, time.Now().Add(-window))
+	if err != nil {
+		writeMetricError(w, r, err)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Metric samples", Data: samples})
+}
+
+// writeMetricError reports a failed metrics request.
+func writeMetricError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Metrics request failed"
+	switch {
+	case errors.Is(err, metrics.ErrNotFound):
+		status, message = http.StatusNotFound, "Metric not found"
+	case errors.Is(err, metrics.ErrInvalid):
+		status, message = http.StatusBadRequest, "Invalid metric"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeMetricsUnavailable reports that the metrics tables could not be created at startup.
+func writeMetricsUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Message:   "Metrics unavailable",
+		Error:     apierror.New(apierror.FeatureUnavailable, "the "+metrics.Table+" tables could not be created; check the database user's permissions"),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
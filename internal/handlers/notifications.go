@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/notify"
+	"data-chatter/internal/requestid"
+)
+
+// NotificationPreferencesHandler reads and changes the caller's notification
+// preferences: GET returns them, PUT replaces them, and DELETE turns the
+// caller's notifications off.
+func NotificationPreferencesHandler(w http.ResponseWriter, r *http.Request) {
+	user := auth.UserID(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		prefs, _ := notificationPrefs.Get(user)
+		writeNotificationResponse(w, http.StatusOK, APIResponse{Message: "Notification preferences", Data: prefs})
+
+	case http.MethodPut:
+		var request notify.Preferences
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		prefs, err := notificationPrefs.Set(user, request)
+		if err != nil {
+			status, message := http.StatusInternalServerError, "Failed to save notification preferences"
+			if errors.Is(err, notify.ErrInvalid) {
+				status, message = http.StatusBadRequest, "Invalid notification preferences"
+			}
+			writeNotificationResponse(w, status, APIResponse{
+				Message:   message,
+				Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+				RequestID: requestid.FromContext(r.Context()),
+			})
+			return
+		}
+		writeNotificationResponse(w, http.StatusOK, APIResponse{Message: "Notification preferences updated", Data: prefs})
+
+	case http.MethodDelete:
+		if err := notificationPrefs.Delete(user); err != nil {
+			writeNotificationResponse(w, http.StatusInternalServerError, APIResponse{
+				Message:   "Failed to save notification preferences",
+				Error:     apierror.New(apierror.Internal, err.Error()),
+				RequestID: requestid.FromContext(r.Context()),
+			})
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// writeNotificationResponse writes a notification preferences response.
+func writeNotificationResponse(w http.ResponseWriter, status int, response APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/events"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/render"
+	"data-chatter/internal/requestid"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// pendingTurnTTL bounds how long a previewed plan waits for confirmation.
+	pendingTurnTTL = 15 * time.Minute
+
+	// pendingTurnLimit bounds how many previewed plans are kept.
+	pendingTurnLimit = 100
+)
+
+// pendingTurn is a dry-run turn whose tool calls were validated but not run.
+type pendingTurn struct {
+	request  MessageRequest
+	response *llm.AnthropicResponse
+	degraded bool
+	owner    string
+	expires  time.Time
+}
+
+// pendingTurnStore keeps previewed plans until they are confirmed or expire.
+type pendingTurnStore struct {
+	mu      sync.Mutex
+	order   []string
+	entries map[string]pendingTurn
+}
+
+// newPendingTurnStore creates an empty store.
+func newPendingTurnStore() *pendingTurnStore {
+	return &pendingTurnStore{
+		entries: make(map[string]pendingTurn),
+	}
+}
+
+// Put stores a previewed plan under its turn ID, dropping expired plans and
+// evicting the oldest when full.
+func (s *pendingTurnStore) Put(turnID string, turn pendingTurn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	kept := s.order[:0]
+	for _, id := range s.order {
+		if entry, ok := s.entries[id]; ok && now.Before(entry.expires) && id != turnID {
+			kept = append(kept, id)
+		} else {
+			delete(s.entries, id)
+		}
+	}
+	s.order = append(kept, turnID)
+	s.entries[turnID] = turn
+
+	for len(s.order) > pendingTurnLimit {
+		delete(s.entries, s.order[0])
+		s.order = s.order[1:]
+	}
+}
+
+// Take removes and returns the unexpired plan stored under turnID, so each
+// plan is confirmed at most once.
+func (s *pendingTurnStore) Take(turnID string) (pendingTurn, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	turn, ok := s.entries[turnID]
+	delete(s.entries, turnID)
+	if !ok || time.Now().After(turn.expires) {
+		return pendingTurn{}, false
+	}
+	return turn, true
+}
+
+// writePreview answers a dry-run turn with the tool calls the LLM planned,
+// each validated and authorized but not executed. A plan that passes every
+// check is kept so the caller can run it with POST /llm/confirm/{id}.
+func (lh *LLMHandler) writePreview(ctx context.Context, w http.ResponseWriter, request MessageRequest, anthropicResponse *llm.AnthropicResponse, degraded bool) {
+	response := MessageResponse{
+		ConversationID: conversationIDFromContext(ctx),
+		TurnID:         request.TurnID,
+		Message:        "Review the planned queries, then confirm the turn to run them",
+		Pending:        true,
+	}
+	if degraded {
+		response.Mode = directMode
+	}
+
+	for _, content := range anthropicResponse.Content {
+		if content.Type != "tool_use" {
+			continue
+		}
+		step := PlanStep{
+			Step:       len(response.Plan) + 1,
+			ToolCallID: content.ID,
+			Tool:       content.Name,
+			Input:      content.Input,
+			Status:     "pending",
+		}
+		step.SQL, _ = content.Input["query"].(string)
+
+		if toolRunner != nil {
+			failed, err := toolRunner.CheckTool(ctx, content.Name, content.Input)
+			switch {
+			case err != nil:
+				step.Status = "error"
+				step.Error = err.Error()
+			case failed != nil && failed.Error != nil:
+				step.Status = "error"
+				step.ErrorType = failed.Error.Code
+				step.Error = failed.Error.Message
+			}
+		}
+		if step.Status == "error" && response.Pending {
+			response.Pending = false
+			response.Message = explainToolFailure(step)
+		}
+		response.Plan = append(response.Plan, step)
+	}
+
+	if response.Pending {
+		lh.pendingTurns.Put(request.TurnID, pendingTurn{
+			request:  request,
+			response: anthropicResponse,
+			degraded: degraded,
+			owner:    auth.UserID(ctx),
+			expires:  time.Now().Add(pendingTurnTTL),
+		})
+	}
+	writeMessageResponse(w, http.StatusOK, response)
+}
+
+// ConfirmRequest runs a previewed turn. TurnID and Nulls work as in
+// MessageRequest; Nulls defaults to the style of the dry-run request.
+type ConfirmRequest struct {
+	TurnID string `json:"turn_id,omitempty"`
+	Nulls  string `json:"nulls,omitempty"`
+}
+
+// ConfirmHandler runs the plan of a dry-run turn as a new turn in the same
+// conversation. Plans can be confirmed once, by the user who previewed them,
+// within pendingTurnTTL. Each tool call is checked again as it runs, so a
+// plan confirmed after the caller lost access to a table still fails.
+func (lh *LLMHandler) ConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var confirm ConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&confirm); err != nil && !errors.Is(err, io.EOF) {
+		writeConfirmError(w, r, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+	if _, err := render.ParseNullStyle(confirm.Nulls); err != nil {
+		writeConfirmError(w, r, http.StatusBadRequest, "Invalid null style", err.Error())
+		return
+	}
+
+	pendingID := r.PathValue("id")
+	pending, ok := lh.pendingTurns.Take(pendingID)
+	if ok && pending.owner != auth.UserID(r.Context()) {
+		// Leave it for its owner
+		lh.pendingTurns.Put(pendingID, pending)
+		ok = false
+	}
+	if !ok {
+		writeConfirmError(w, r, http.StatusNotFound, "Pending turn not found", "No pending turn with that ID; it may have expired or already been confirmed")
+		return
+	}
+	conv, err := lh.conversations.Get(pending.request.ConversationID)
+	if err != nil || !visibleTo(r.Context(), conv) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+
+	request := MessageRequest{
+		Message:        pending.request.Message,
+		TurnID:         confirm.TurnID,
+		PreviousTurnID: pendingID,
+		ConversationID: conv.ID,
+		Nulls:          pending.request.Nulls,
+	}
+	if confirm.Nulls != "" {
+		request.Nulls = confirm.Nulls
+	}
+	if request.TurnID == "" {
+		request.TurnID = newTurnID()
+	}
+	routed, err := lh.routeSession(r.Context(), conv, "")
+	if err != nil {
+		writeConfirmError(w, r, http.StatusBadRequest, "Invalid database", err.Error())
+		return
+	}
+	r = r.WithContext(llm.WithTranscript(llm.WithUsageMeter(withConversationID(routed, conv.ID))))
+
+	recorder := &turnRecorder{ResponseWriter: w}
+	w = recorder
+	defer lh.recordTurn(r.Context(), conv.ID, request, recorder)
+	lh.announceTurn(r.Context(), request)
+
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("chat.turn_id", request.TurnID),
+		attribute.String("chat.confirms", pendingID),
+	)
+	progressBus.Start(request.TurnID, auth.UserID(r.Context()))
+	defer progressBus.Close(request.TurnID)
+	defer progressBus.Publish(events.Event{Type: events.TurnFinished, TurnID: request.TurnID})
+
+	ctx, endTurn := lh.beginTurn(r.Context(), request.TurnID)
+	defer endTurn()
+
+	slog.DebugContext(ctx, "running confirmed plan", "turn_id", request.TurnID, "pending_turn_id", pendingID)
+	lh.writeAnswer(ctx, w, request, pending.response, pending.degraded)
+}
+
+// writeConfirmError writes a failed confirmation in the chat response shape.
+func writeConfirmError(w http.ResponseWriter, r *http.Request, status int, message, detail string) {
+	writeMessageResponse(w, status, MessageResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), detail),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
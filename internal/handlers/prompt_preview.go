@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/requestid"
+)
+
+// PromptPreviewRequest names the question whose prompt is rendered and,
+// optionally, the database and user it is rendered for.
+type PromptPreviewRequest struct {
+	Message       string `json:"message"`
+	Database      string `json:"database,omitempty"`
+	Deterministic bool   `json:"deterministic,omitempty"`
+
+	// User previews the prompt as this user sees it, with their roles'
+	// column access and their saved queries. Default: the caller.
+	User *PreviewUser `json:"user,omitempty"`
+}
+
+// PreviewUser is the identity a prompt is previewed as.
+type PreviewUser struct {
+	ID    string   `json:"id"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// PromptPreviewHandler renders the exact request /llm/message would send to
+// the LLM for a question, with the schema, data dictionary, org context,
+// saved queries, and sample-row redactions applied, without calling it.
+// Previews are audited as prompt_previewed.
+func (lh *LLMHandler) PromptPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var request PromptPreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+	if request.Message == "" {
+		writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+			Message:   "Invalid prompt preview",
+			Error:     apierror.New(apierror.InvalidRequest, "message is required"),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+	if request.User != nil && request.User.ID == "" {
+		writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+			Message:   "Invalid prompt preview",
+			Error:     apierror.New(apierror.InvalidRequest, "user.id is required when previewing as a user"),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+
+	ctx, err := routeDatabase(r.Context(), request.Database)
+	if err != nil {
+		writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+			Message:   "Invalid database",
+			Error:     apierror.New(apierror.InvalidRequest, err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+	details := map[string]interface{}{"database": request.Database}
+	if request.User != nil {
+		user := &auth.User{ID: request.User.ID, Roles: request.User.Roles, Tenant: auth.TenantID(ctx)}
+		ctx = auth.WithUser(ctx, user, "")
+		details["previewed_user"] = request.User.ID
+	}
+	if request.Deterministic {
+		ctx = llm.WithDeterminism(ctx)
+	}
+
+	preview := lh.processor.PreviewMessage(ctx, request.Message)
+	auditLog.Record(r.Context(), audit.Entry{Action: "prompt_previewed", Status: "ok", Details: details})
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Prompt preview", Data: preview})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import "encoding/json"
+
+// sourceKey is the field added to each merged row to record where it came from.
+const sourceKey = "_source"
+
+// RowSource traces a merged row back to the tool call and statement that produced it.
+type RowSource struct {
+	ToolCallID string `json:"tool_call_id"`
+	Tool       string `json:"tool,omitempty"`
+	Database   string `json:"database,omitempty"`
+	SQL        string `json:"sql,omitempty"`
+	Row        int    `json:"row"` // Zero-based position in the tool's own result set
+}
+
+// mergeResultRows flattens the rows of every tabular tool result into one list,
+// tagging each row with its RowSource. Tool names are taken from plan when it
+// is available; non-tabular results such as charts and profiles are skipped.
+func mergeResultRows(results []map[string]interface{}, plan []PlanStep) []map[string]interface{} {
+	tools := make(map[string]string, len(plan))
+	for _, step := range plan {
+		tools[step.ToolCallID] = step.Tool
+	}
+
+	var merged []map[string]interface{}
+	for _, result := range results {
+		if isError, _ := result["is_error"].(bool); isError {
+			continue
+		}
+		content, _ := result["content"].([]interface{})
+		if len(content) == 0 {
+			continue
+		}
+		block, _ := content[0].(map[string]interface{})
+		text, _ := block["text"].(string)
+
+		var payload struct {
+			Query    string                   `json:"query"`
+			Database string                   `json:"database"`
+			Columns  []string                 `json:"columns"`
+			Data     []map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(text), &payload); err != nil || payload.Columns == nil {
+			continue
+		}
+
+		toolCallID, _ := result["id"].(string)
+		for i, row := range payload.Data {
+			tagged := make(map[string]interface{}, len(row)+1)
+			for column, value := range row {
+				tagged[column] = value
+			}
+			tagged[sourceKey] = RowSource{
+				ToolCallID: toolCallID,
+				Tool:       tools[toolCallID],
+				Database:   payload.Database,
+				SQL:        payload.Query,
+				Row:        i,
+			}
+			merged = append(merged, tagged)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/quality"
+	"data-chatter/internal/requestid"
+)
+
+// QualityRuleRequest defines a data-quality rule.
+type QualityRuleRequest struct {
+	Table       string `json:"table"`
+	Column      string `json:"column"`
+	Kind        string `json:"kind"`
+	References  string `json:"references,omitempty"`
+	MaxAge      string `json:"max_age,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// QualityScorecardHandler returns the data-quality scorecard, or one
+// table's with ?table=, leaving out rules on tables and columns the
+// caller's roles cannot read.
+func QualityScorecardHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if qualityRules == nil {
+		writeQualityUnavailable(w, r)
+		return
+	}
+
+	rules, err := qualityRules.List(r.Context(), r.URL.Query().Get("table"))
+	if err != nil {
+		writeQualityError(w, r, err)
+		return
+	}
+	scorecard := quality.NewScorecard(quality.Visible(r.Context(), rules, accessControl))
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Data-quality scorecard", Data: scorecard})
+}
+
+// QualityRulesHandler lists the rules with their latest results on GET and
+// adds a rule on POST. A new rule is pending until the next evaluation.
+func QualityRulesHandler(w http.ResponseWriter, r *http.Request) {
+	if qualityRules == nil {
+		writeQualityUnavailable(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := qualityRules.List(r.Context(), r.URL.Query().Get("table"))
+		if err != nil {
+			writeQualityError(w, r, err)
+			return
+		}
+		if rules == nil {
+			rules = []quality.Rule{}
+		}
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Data-quality rules", Data: rules})
+
+	case http.MethodPost:
+		var request QualityRuleRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		rule, err := qualityRules.Add(r.Context(), quality.Rule{
+			Table:       request.Table,
+			Column:      request.Column,
+			Kind:        request.Kind,
+			References:  request.References,
+			MaxAge:      request.MaxAge,
+			Description: request.Description,
+			CreatedBy:   auth.UserID(r.Context()),
+		})
+		if err != nil {
+			writeQualityError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "quality_rule_added", Status: "ok", Details: map[string]interface{}{
+			"id": rule.ID, "table": rule.Table, "column": rule.Column, "kind": rule.Kind,
+		}})
+		writeAdminResponse(w, http.StatusCreated, APIResponse{Message: "Rule added", Data: rule})
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// QualityRuleHandler removes (DELETE) a rule.
+func QualityRuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if qualityRules == nil {
+		writeQualityUnavailable(w, r)
+		return
+	}
+
+	id := r.PathValue("id")
+	if err := qualityRules.Delete(r.Context(), id); err != nil {
+		writeQualityError(w, r, err)
+		return
+	}
+	auditLog.Record(r.Context(), audit.Entry{Action: "quality_rule_deleted", Status: "ok", Details: map[string]interface{}{"id": id}})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// QualityEvaluateHandler evaluates every rule now, rather than at the next
+// scheduled run, and returns the updated scorecard.
+func QualityEvaluateHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if qualityRules == nil {
+		writeQualityUnavailable(w, r)
+		return
+	}
+
+	if err := qualityRules.Evaluate(r.Context()); err != nil {
+		writeQualityError(w, r, err)
+		return
+	}
+	rules, err := qualityRules.List(r.Context(), "")
+	if err != nil {
+		writeQualityError(w, r, err)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Data-quality scorecard", Data: quality.NewScorecard(rules)})
+}
+
+// writeQualityError reports a failed data-quality request.
+func writeQualityError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Data-quality request failed"
+	switch {
+	case errors.Is(err, quality.ErrNotFound):
+		status, message = http.StatusNotFound, "Rule not found"
+	case errors.Is(err, quality.ErrInvalid):
+		status, message = http.StatusBadRequest, "Invalid rule"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeQualityUnavailable reports that the rules table could not be created at startup.
+func writeQualityUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Message:   "Data-quality rules unavailable",
+		Error:     apierror.New(apierror.FeatureUnavailable, "the "+quality.Table+" table could not be created; check the database user's permissions"),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
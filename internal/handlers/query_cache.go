@@ -0,0 +1,17 @@
+package handlers
+
+import (
+	"net/http"
+
+	"data-chatter/internal/apierror"
+)
+
+// QueryCacheStatsHandler reports the query result cache's backend, TTL,
+// and hit and miss counts since the server started.
+func QueryCacheStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Query cache", Data: queryCache.Stats()})
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/database"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/version"
+)
+
+// healthPingTimeout bounds the database ping of a health or readiness
+// check, so a hung database fails the check instead of hanging it.
+const healthPingTimeout = 2 * time.Second
+
+// HealthResponse contains health check status information.
+type HealthResponse struct {
+	Status    string         `json:"status"`
+	Timestamp time.Time      `json:"timestamp"`
+	Uptime    string         `json:"uptime"`
+	Version   string         `json:"version"`
+	Commit    string         `json:"commit,omitempty"`
+	Database  DatabaseHealth `json:"database"`
+	LLM       ReadinessCheck `json:"llm"`
+}
+
+// DatabaseHealth reports the database ping and the connection pool.
+type DatabaseHealth struct {
+	Status             string    `json:"status"`
+	Message            string    `json:"message,omitempty"`
+	LastPing           time.Time `json:"last_successful_ping"`
+	MaxOpenConnections int       `json:"max_open_connections"`
+	OpenConnections    int       `json:"open_connections"`
+	InUse              int       `json:"in_use"`
+	Idle               int       `json:"idle"`
+	WaitCount          int64     `json:"wait_count"`      // Connections waited for, in total
+	WaitDuration       string    `json:"wait_duration"`   // Time spent waiting for connections, in total
+	MaxIdleClosed      int64     `json:"max_idle_closed"` // Connections closed by the idle limit
+	MaxLifetimeClosed  int64     `json:"max_lifetime_closed"`
+}
+
+// ReadinessCheck is the result of one dependency check.
+type ReadinessCheck struct {
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ReadinessResponse reports whether the server can serve chat requests.
+type ReadinessResponse struct {
+	Status string                    `json:"status"`
+	Checks map[string]ReadinessCheck `json:"checks"`
+}
+
+// ReadinessHandler serves the health and readiness checks over the database
+// and the LLM credential monitor.
+type ReadinessHandler struct {
+	db          *database.Connection
+	credentials *llm.CredentialMonitor
+}
+
+// NewReadinessHandler creates a readiness handler over the database and credential monitor.
+func NewReadinessHandler(db *database.Connection, credentials *llm.CredentialMonitor) *ReadinessHandler {
+	return &ReadinessHandler{db: db, credentials: credentials}
+}
+
+// ReadyzHandler returns 200 when the database is reachable and the LLM key is
+// usable, and 503 otherwise, with the state of each check. Without a key the
+// server runs in degraded mode and reports "degraded" with 200, since direct
+// queries and tools still work. The LLM check reflects the monitor's last
+// periodic result rather than calling the provider.
+func (rh *ReadinessHandler) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	ready, degraded := true, false
+
+	dbCheck := ReadinessCheck{Status: "ok", CheckedAt: time.Now()}
+	if err := rh.ping(r.Context()); err != nil {
+		dbCheck.Status = "error"
+		dbCheck.Message = err.Error()
+		ready = false
+	}
+
+	credentials := rh.credentials.Status()
+	if credentials.Status == llm.CredentialsMissing {
+		degraded = true
+	} else if !credentials.Usable() {
+		ready = false
+	}
+
+	response := ReadinessResponse{
+		Status: "ready",
+		Checks: map[string]ReadinessCheck{
+			"database": dbCheck,
+			"llm": {
+				Status:    credentials.Status,
+				Message:   credentials.Message,
+				CheckedAt: credentials.CheckedAt,
+			},
+		},
+	}
+	statusCode := http.StatusOK
+	if degraded {
+		response.Status = "degraded"
+	}
+	if !ready {
+		response.Status = "not_ready"
+		statusCode = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// HealthHandler reports uptime, the database ping and connection pool
+// stats, and whether the LLM provider was reachable at its last credential
+// check. It returns 503 with "unhealthy" when the database does not answer
+// the ping; the LLM's state is reported but does not fail the check, as
+// /readyz covers the key.
+func (rh *ReadinessHandler) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	build := version.Get()
+	response := HealthResponse{
+		Status:    "healthy",
+		Timestamp: time.Now(),
+		Uptime:    time.Since(startTime).String(),
+		Version:   build.Version,
+		Commit:    build.Commit,
+		Database:  DatabaseHealth{Status: "ok"},
+	}
+	statusCode := http.StatusOK
+
+	if err := rh.ping(r.Context()); err != nil {
+		response.Status = "unhealthy"
+		response.Database.Status = "error"
+		response.Database.Message = err.Error()
+		statusCode = http.StatusServiceUnavailable
+	}
+	stats := rh.db.Active().DB.Stats()
+	response.Database.LastPing = rh.db.Active().LastPing()
+	response.Database.MaxOpenConnections = stats.MaxOpenConnections
+	response.Database.OpenConnections = stats.OpenConnections
+	response.Database.InUse = stats.InUse
+	response.Database.Idle = stats.Idle
+	response.Database.WaitCount = stats.WaitCount
+	response.Database.WaitDuration = stats.WaitDuration.String()
+	response.Database.MaxIdleClosed = stats.MaxIdleClosed
+	response.Database.MaxLifetimeClosed = stats.MaxLifetimeClosed
+
+	credentials := rh.credentials.Status()
+	response.LLM = ReadinessCheck{Status: "reachable", Message: credentials.Message, CheckedAt: credentials.CheckedAt}
+	switch credentials.Status {
+	case llm.CredentialsUnreachable:
+		response.LLM.Status = "unreachable"
+	case llm.CredentialsMissing, llm.CredentialsPending:
+		response.LLM.Status = "unknown"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(response)
+}
+
+// ping checks the database within healthPingTimeout.
+func (rh *ReadinessHandler) ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthPingTimeout)
+	defer cancel()
+	return rh.db.Active().Health(ctx)
+}
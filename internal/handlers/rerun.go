@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/conversation"
+	"data-chatter/internal/events"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/render"
+	"data-chatter/internal/requestid"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RerunRequest re-runs a turn's query with SQL edited by the user.
+// SourceTurnID defaults to the conversation's last turn, and ToolCallID to
+// the first step of that turn that ran SQL. TurnID and Nulls work as in
+// MessageRequest.
+type RerunRequest struct {
+	ConversationID string `json:"conversation_id"`
+	SourceTurnID   string `json:"source_turn_id,omitempty"`
+	ToolCallID     string `json:"tool_call_id,omitempty"`
+	SQL            string `json:"sql"`
+	TurnID         string `json:"turn_id,omitempty"`
+	Nulls          string `json:"nulls,omitempty"`
+}
+
+// RerunHandler runs user-edited SQL in place of the SQL a turn generated,
+// as a new turn in the same conversation. The edited query goes through the
+// same tool as the original step, so it is validated, authorized, and
+// audited like any other tool call, and the LLM then summarizes the new
+// results against the original question.
+func (lh *LLMHandler) RerunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var rerun RerunRequest
+	if err := json.NewDecoder(r.Body).Decode(&rerun); err != nil {
+		writeRerunError(w, r, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+	if rerun.ConversationID == "" || rerun.SQL == "" {
+		writeRerunError(w, r, http.StatusBadRequest, "Invalid rerun request", "conversation_id and sql are required")
+		return
+	}
+	if _, err := render.ParseNullStyle(rerun.Nulls); err != nil {
+		writeRerunError(w, r, http.StatusBadRequest, "Invalid null style", err.Error())
+		return
+	}
+
+	conv, err := lh.conversations.Get(rerun.ConversationID)
+	if err != nil || !visibleTo(r.Context(), conv) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+	source, ok := findTurn(conv, rerun.SourceTurnID)
+	if !ok {
+		writeConversationNotFound(w, r, "No turn with that ID in the conversation")
+		return
+	}
+	step, ok := editableStep(source, rerun.ToolCallID)
+	if !ok {
+		writeRerunError(w, r, http.StatusBadRequest, "Nothing to re-run", "That turn has no SQL step to edit")
+		return
+	}
+
+	input := make(map[string]interface{}, len(step.Input))
+	for key, value := range step.Input {
+		input[key] = value
+	}
+	input["query"] = rerun.SQL
+
+	request := MessageRequest{
+		Message:        source.Message,
+		TurnID:         rerun.TurnID,
+		PreviousTurnID: source.TurnID,
+		ConversationID: conv.ID,
+		Nulls:          rerun.Nulls,
+	}
+	if request.TurnID == "" {
+		request.TurnID = newTurnID()
+	}
+	routed, err := lh.routeSession(r.Context(), conv, "")
+	if err != nil {
+		writeRerunError(w, r, http.StatusBadRequest, "Invalid database", err.Error())
+		return
+	}
+	r = r.WithContext(llm.WithTranscript(llm.WithUsageMeter(withConversationID(routed, conv.ID))))
+
+	recorder := &turnRecorder{ResponseWriter: w}
+	w = recorder
+	defer lh.recordTurn(r.Context(), conv.ID, request, recorder)
+	lh.announceTurn(r.Context(), request)
+
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("chat.turn_id", request.TurnID),
+		attribute.String("chat.rerun_of", source.TurnID),
+	)
+	progressBus.Start(request.TurnID, auth.UserID(r.Context()))
+	defer progressBus.Close(request.TurnID)
+	defer progressBus.Publish(events.Event{Type: events.TurnFinished, TurnID: request.TurnID})
+
+	ctx, endTurn := lh.beginTurn(r.Context(), request.TurnID)
+	defer endTurn()
+
+	edited := &llm.AnthropicResponse{StopReason: "tool_use"}
+	edited.Content = append(edited.Content, toolCallContent{
+		Type:  "tool_use",
+		ID:    "rerun_1",
+		Name:  step.Tool,
+		Input: input,
+	})
+
+	status, response := lh.answer(ctx, request, edited, false)
+	if status == http.StatusOK && response.Plan[0].Status == "ok" && lh.processor.Configured(ctx) {
+		summary, err := lh.processor.Summarize(ctx, source.Message, rerun.SQL, response.Results, exportLink(ctx, request.TurnID))
+		if err != nil {
+			slog.WarnContext(ctx, "failed to summarize rerun", "turn_id", request.TurnID, "error", err)
+		} else {
+			response.Message = summary
+		}
+	}
+	writeMessageResponse(w, status, response)
+}
+
+// findTurn returns the turn with turnID, or the last turn when turnID is empty.
+func findTurn(c *conversation.Conversation, turnID string) (conversation.Turn, bool) {
+	if turnID == "" {
+		turnID = c.LastTurnID()
+	}
+	for _, turn := range c.Turns {
+		if turn.TurnID == turnID && turnID != "" {
+			return turn, true
+		}
+	}
+	return conversation.Turn{}, false
+}
+
+// editableStep returns the plan step of a recorded turn whose SQL can be
+// edited: the step with toolCallID, or the first step that ran SQL.
+func editableStep(turn conversation.Turn, toolCallID string) (PlanStep, bool) {
+	var recorded MessageResponse
+	if err := json.Unmarshal(turn.Response, &recorded); err != nil {
+		return PlanStep{}, false
+	}
+	for _, step := range recorded.Plan {
+		if step.SQL == "" {
+			continue
+		}
+		if toolCallID == "" || step.ToolCallID == toolCallID {
+			return step, true
+		}
+	}
+	return PlanStep{}, false
+}
+
+// writeRerunError reports a rerun request that could not be started.
+func writeRerunError(w http.ResponseWriter, r *http.Request, status int, message, detail string) {
+	writeMessageResponse(w, status, MessageResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), detail),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+
+	"data-chatter/internal/types"
+)
+
+// toolRetryPolicy bounds how the agent loop repeats tool calls that failed
+// with a retryable error.
+type toolRetryPolicy struct {
+	Attempts int           // Total attempts per tool call, including the first
+	Backoff  time.Duration // Wait before the first retry; doubles for each retry after
+}
+
+// toolRetryPolicyFromEnv reads TOOL_RETRY_ATTEMPTS (default 3) and
+// TOOL_RETRY_BACKOFF (default 250ms).
+func toolRetryPolicyFromEnv() toolRetryPolicy {
+	policy := toolRetryPolicy{Attempts: 3, Backoff: 250 * time.Millisecond}
+	if value, err := strconv.Atoi(os.Getenv("TOOL_RETRY_ATTEMPTS")); err == nil && value > 0 {
+		policy.Attempts = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("TOOL_RETRY_BACKOFF")); err == nil && value >= 0 {
+		policy.Backoff = value
+	}
+	return policy
+}
+
+// toolCallContent is a tool_use block from the LLM response.
+type toolCallContent = struct {
+	Type  string                 `json:"type"`
+	Text  string                 `json:"text,omitempty"`
+	ID    string                 `json:"id,omitempty"`
+	Name  string                 `json:"name,omitempty"`
+	Input map[string]interface{} `json:"input,omitempty"`
+}
+
+// executeWithRetry runs a tool call, repeating it with exponential backoff
+// while it fails with a retryable error and the turn still has time left.
+// It returns the last result and how many attempts were made.
+func (lh *LLMHandler) executeWithRetry(ctx context.Context, turnID string, content toolCallContent) (map[string]interface{}, int, error) {
+	backoff := lh.toolRetry.Backoff
+	for attempt := 1; ; attempt++ {
+		results, err := lh.executeToolCall(ctx, turnID, content)
+		if err != nil || attempt >= lh.toolRetry.Attempts || ctx.Err() != nil {
+			return results, attempt, err
+		}
+
+		code, _ := toolErrorFields(results)
+		if !types.IsRetryable(code) {
+			return results, attempt, nil
+		}
+
+		slog.WarnContext(ctx, "retrying tool call",
+			"turn_id", turnID,
+			"tool", content.Name,
+			"error_type", code,
+			"attempt", attempt,
+			"backoff", backoff)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return results, attempt, nil
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// toolErrorFields returns the error code and message of a failed tool
+// result, or empty strings when the call succeeded.
+func toolErrorFields(results map[string]interface{}) (code, message string) {
+	if isError, _ := results["is_error"].(bool); !isError {
+		return "", ""
+	}
+	toolErr, _ := results["error"].(map[string]interface{})
+	code, _ = toolErr["code"].(string)
+	message, _ = toolErr["message"].(string)
+	return code, message
+}
+
+// explainToolFailure turns a failed plan step into a message for the user,
+// saying what went wrong and what they can do about it.
+func explainToolFailure(step PlanStep) string {
+	switch step.ErrorType {
+	case types.ErrorPermissionDenied:
+		return fmt.Sprintf("You don't have permission to run this query: %s. Ask an administrator for access to the tables involved.", step.Error)
+	case types.ErrorSyntax:
+		return fmt.Sprintf("The generated SQL was invalid: %s. Try rephrasing the question.", step.Error)
+	case types.ErrorUndefinedObject:
+		return fmt.Sprintf("The query referred to a table or column that doesn't exist: %s. Check the schema or rephrase the question.", step.Error)
+	case types.ErrorTooManyRows:
+		return fmt.Sprintf("The query matched too many rows to return: %s. Narrow the question or ask for a summary instead.", step.Error)
+	case types.ErrorResourceLimit:
+		return fmt.Sprintf("The query needed more resources than allowed: %s. Narrow the question and try again.", step.Error)
+	case types.ErrorToolDisabled:
+		return fmt.Sprintf("This tool is currently turned off: %s. Ask an administrator to enable it.", step.Error)
+	case types.ErrorUnavailable:
+		return fmt.Sprintf("The database is down: %s. Try again once it is back.", step.Error)
+	case types.ErrorTimeout, types.ErrorLockConflict, types.ErrorConnection:
+		return fmt.Sprintf("The database was unavailable or busy, and the query still failed after %d attempts: %s. Try again shortly.", step.Attempts, step.Error)
+	default:
+		return fmt.Sprintf("The query failed: %s", step.Error)
+	}
+}
@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/reveal"
+	"data-chatter/internal/types"
+)
+
+// RevealRequest asks an admin to let the caller run Query with masked
+// values revealed, for Reason.
+type RevealRequest struct {
+	Query  string `json:"query"`
+	Reason string `json:"reason"`
+}
+
+// RevealDecisionRequest carries an admin's optional note to the requester.
+type RevealDecisionRequest struct {
+	Note string `json:"note,omitempty"`
+}
+
+// RevealRequestsHandler lists the caller's reveal requests on GET and files
+// a new one on POST. The query gets the same read-only and access checks as
+// LLM-generated SQL before it is filed, so an approver never reviews a query
+// that could not run.
+func RevealRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if revealRequests == nil {
+		writeRevealUnavailable(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		requests, err := revealRequests.ListFor(r.Context(), auth.UserID(r.Context()))
+		if err != nil {
+			writeRevealError(w, r, err)
+			return
+		}
+		if requests == nil {
+			requests = []reveal.Request{}
+		}
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Reveal requests", Data: requests})
+
+	case http.MethodPost:
+		var body RevealRequest
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		if body.Query != "" {
+			failed, err := toolRunner.CheckTool(r.Context(), "database_query", map[string]interface{}{"query": body.Query})
+			if err != nil {
+				writeRevealError(w, r, fmt.Errorf("%w: %v", reveal.ErrInvalid, err))
+				return
+			}
+			if failed != nil && failed.Error != nil {
+				writeRevealError(w, r, fmt.Errorf("%w: query: %s", reveal.ErrInvalid, failed.Error.Message))
+				return
+			}
+		}
+		request, err := revealRequests.Add(r.Context(), auth.UserID(r.Context()), body.Query, body.Reason)
+		if err != nil {
+			writeRevealError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "reveal_requested", Status: "ok", Details: map[string]interface{}{
+			"id": request.ID, "query": request.Query, "reason": request.Reason,
+		}})
+		writeAdminResponse(w, http.StatusCreated, APIResponse{Message: "Reveal requested", Data: request})
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// RevealRunHandler runs an approved reveal request's query with masked
+// values revealed. Only the requester may run it, and only until the
+// approval expires. Every run is audited.
+func RevealRunHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if revealRequests == nil {
+		writeRevealUnavailable(w, r)
+		return
+	}
+
+	request, err := revealRequests.Use(r.Context(), r.PathValue("id"), auth.UserID(r.Context()))
+	if err != nil {
+		writeRevealError(w, r, err)
+		return
+	}
+
+	ctx := database.WithUnmasked(r.Context())
+	call := types.ToolCall{
+		ID:    "reveal_" + request.ID,
+		Name:  "database_query",
+		Input: map[string]interface{}{"query": request.Query},
+	}
+	result, err := toolRunner.ExecuteCall(ctx, call)
+	auditToolCall(ctx, call, result, err)
+	entry := audit.Entry{Action: "masked_values_revealed", Status: "ok", Details: map[string]interface{}{
+		"id": request.ID, "query": request.Query, "approved_by": request.DecidedBy, "run": request.Runs,
+	}}
+	if err != nil || result.IsError {
+		entry.Status = "error"
+	}
+	auditLog.Record(ctx, entry)
+	if err != nil {
+		writeRevealError(w, r, err)
+		return
+	}
+	if result.ID == "" {
+		result.ID = call.ID
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Unmasked results", Data: result})
+}
+
+// AdminRevealRequestsHandler lists reveal requests, optionally filtered by
+// ?status=pending, approved, or denied.
+func AdminRevealRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if revealRequests == nil {
+		writeRevealUnavailable(w, r)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", reveal.StatusPending, reveal.StatusApproved, reveal.StatusDenied:
+	default:
+		writeRevealError(w, r, fmt.Errorf("%w: status must be %s, %s, or %s", reveal.ErrInvalid, reveal.StatusPending, reveal.StatusApproved, reveal.StatusDenied))
+		return
+	}
+	requests, err := revealRequests.List(r.Context(), status)
+	if err != nil {
+		writeRevealError(w, r, err)
+		return
+	}
+	if requests == nil {
+		requests = []reveal.Request{}
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Reveal requests", Data: requests})
+}
+
+// RevealDecisionHandler approves or denies a pending reveal request,
+// depending on whether the path ends in /approve or /deny. Signed-in admins
+// may not decide their own requests.
+func RevealDecisionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if revealRequests == nil {
+		writeRevealUnavailable(w, r)
+		return
+	}
+
+	var approve bool
+	switch r.PathValue("decision") {
+	case "approve":
+		approve = true
+	case "deny":
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	var body RevealDecisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+
+	id, adminID := r.PathValue("id"), auth.UserID(r.Context())
+	if auth.UserFromContext(r.Context()) != nil {
+		request, err := revealRequests.Get(r.Context(), id)
+		if err != nil {
+			writeRevealError(w, r, err)
+			return
+		}
+		if request.UserID == adminID {
+			writeRevealError(w, r, fmt.Errorf("%w: another admin must decide your own request", reveal.ErrInvalid))
+			return
+		}
+	}
+	request, err := revealRequests.Decide(r.Context(), id, adminID, approve, body.Note)
+	if err != nil {
+		writeRevealError(w, r, err)
+		return
+	}
+	auditLog.Record(r.Context(), audit.Entry{Action: "reveal_" + request.Status, Status: "ok", Details: map[string]interface{}{
+		"id": request.ID, "user_id": request.UserID, "query": request.Query,
+	}})
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Reveal request " + request.Status, Data: request})
+}
+
+// writeRevealError reports a failed reveal request.
+func writeRevealError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Reveal request failed"
+	switch {
+	case errors.Is(err, reveal.ErrNotFound):
+		status, message = http.StatusNotFound, "Reveal request not found"
+	case errors.Is(err, reveal.ErrInvalid):
+		status, message = http.StatusBadRequest, "Invalid reveal request"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeRevealUnavailable reports that the requests table could not be
+// created at startup.
+func writeRevealUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Message:   "Reveal requests unavailable",
+		Error:     apierror.New(apierror.FeatureUnavailable, "the "+reveal.Table+" table could not be created; check the database user's permissions"),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/events"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/render"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/savedqueries"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SavedQueryRequest saves a query.
+type SavedQueryRequest struct {
+	Name        string                   `json:"name"`
+	Description string                   `json:"description,omitempty"`
+	SQL         string                   `json:"sql"`
+	Parameters  []savedqueries.Parameter `json:"parameters,omitempty"`
+}
+
+// SavedQueryRunRequest runs a saved query with parameter values. Without
+// ConversationID a new conversation is started. TurnID and Nulls work as in
+// MessageRequest.
+type SavedQueryRunRequest struct {
+	Parameters     map[string]interface{} `json:"parameters,omitempty"`
+	ConversationID string                 `json:"conversation_id,omitempty"`
+	TurnID         string                 `json:"turn_id,omitempty"`
+	Nulls          string                 `json:"nulls,omitempty"`
+}
+
+// SavedQueriesHandler lists the caller's saved queries on GET and saves a new
+// one on POST. The SQL gets the same read-only and access checks as
+// LLM-generated SQL before it is saved.
+func SavedQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeSavedQueryResponse(w, http.StatusOK, APIResponse{Message: "Saved queries", Data: savedQueries.List(auth.UserID(r.Context()))})
+
+	case http.MethodPost:
+		var request SavedQueryRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		query := savedqueries.Query{
+			Name:        request.Name,
+			Description: request.Description,
+			SQL:         request.SQL,
+			Parameters:  request.Parameters,
+		}
+		if err := query.Validate(); err != nil {
+			writeSavedQueryError(w, r, err)
+			return
+		}
+		if err := checkSavedQuery(r.Context(), query.SQL); err != nil {
+			writeSavedQueryError(w, r, err)
+			return
+		}
+		saved, err := savedQueries.Add(auth.UserID(r.Context()), query)
+		if err != nil {
+			writeSavedQueryError(w, r, err)
+			return
+		}
+		writeSavedQueryResponse(w, http.StatusCreated, APIResponse{Message: "Query saved", Data: saved})
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// SavedQueryHandler returns (GET) or deletes (DELETE) one of the caller's
+// saved queries.
+func SavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, id := auth.UserID(r.Context()), r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodGet:
+		query, err := savedQueries.Get(userID, id)
+		if err != nil {
+			writeSavedQueryError(w, r, err)
+			return
+		}
+		writeSavedQueryResponse(w, http.StatusOK, APIResponse{Message: "Saved query", Data: query})
+
+	case http.MethodDelete:
+		if err := savedQueries.Delete(userID, id); err != nil {
+			writeSavedQueryError(w, r, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// RunSavedQueryHandler runs one of the caller's saved queries as a new turn,
+// without asking the LLM. The query runs through the saved_query_run tool,
+// so it is validated, authorized, and audited like any other tool call.
+func (lh *LLMHandler) RunSavedQueryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	var run SavedQueryRunRequest
+	if err := json.NewDecoder(r.Body).Decode(&run); err != nil && !errors.Is(err, io.EOF) {
+		writeRerunError(w, r, http.StatusBadRequest, "Invalid request format", err.Error())
+		return
+	}
+	if _, err := render.ParseNullStyle(run.Nulls); err != nil {
+		writeRerunError(w, r, http.StatusBadRequest, "Invalid null style", err.Error())
+		return
+	}
+
+	saved, err := savedQueries.Get(auth.UserID(r.Context()), r.PathValue("id"))
+	if err != nil {
+		writeRerunError(w, r, http.StatusNotFound, "Saved query not found", "No saved query with that ID")
+		return
+	}
+
+	request := MessageRequest{
+		Message:        saved.Name,
+		TurnID:         run.TurnID,
+		ConversationID: run.ConversationID,
+		Nulls:          run.Nulls,
+	}
+	if request.TurnID == "" {
+		request.TurnID = newTurnID()
+	}
+	conv, err := lh.resolveConversation(r.Context(), request)
+	if err != nil {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+	request.ConversationID = conv.ID
+	request.PreviousTurnID = conv.LastTurnID()
+	r = r.WithContext(llm.WithTranscript(llm.WithUsageMeter(withConversationID(r.Context(), conv.ID))))
+
+	recorder := &turnRecorder{ResponseWriter: w}
+	w = recorder
+	defer lh.recordTurn(r.Context(), conv.ID, request, recorder)
+	lh.announceTurn(r.Context(), request)
+
+	trace.SpanFromContext(r.Context()).SetAttributes(
+		attribute.String("chat.turn_id", request.TurnID),
+		attribute.String("chat.saved_query", saved.ID),
+	)
+	progressBus.Start(request.TurnID, auth.UserID(r.Context()))
+	defer progressBus.Close(request.TurnID)
+	defer progressBus.Publish(events.Event{Type: events.TurnFinished, TurnID: request.TurnID})
+
+	ctx, endTurn := lh.beginTurn(r.Context(), request.TurnID)
+	defer endTurn()
+
+	input := map[string]interface{}{"name": saved.Name}
+	if run.Parameters != nil {
+		input["parameters"] = run.Parameters
+	}
+	call := &llm.AnthropicResponse{StopReason: "tool_use"}
+	call.Content = append(call.Content, toolCallContent{
+		Type:  "tool_use",
+		ID:    "saved_query_1",
+		Name:  "saved_query_run",
+		Input: input,
+	})
+	lh.writeAnswer(ctx, w, request, call, false)
+}
+
+// checkSavedQuery validates SQL as a database_query call without running
+// it, since its parameters have no values yet.
+func checkSavedQuery(ctx context.Context, query string) error {
+	failed, err := toolRunner.CheckTool(ctx, "database_query", map[string]interface{}{"query": query})
+	if err != nil {
+		return fmt.Errorf("%w: %v", savedqueries.ErrInvalid, err)
+	}
+	if failed != nil && failed.Error != nil {
+		return fmt.Errorf("%w: sql: %s", savedqueries.ErrInvalid, failed.Error.Message)
+	}
+	return nil
+}
+
+// writeSavedQueryError reports a failed saved query request.
+func writeSavedQueryError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Failed to save query"
+	switch {
+	case errors.Is(err, savedqueries.ErrNotFound):
+		status, message = http.StatusNotFound, "Saved query not found"
+	case errors.Is(err, savedqueries.ErrInvalid):
+		status, message = http.StatusBadRequest, "Invalid saved query"
+	case errors.Is(err, savedqueries.ErrConflict):
+		status, message = http.StatusConflict, "Saved query name taken"
+	}
+	writeSavedQueryResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeSavedQueryResponse writes a saved query endpoint's JSON response.
+func writeSavedQueryResponse(w http.ResponseWriter, status int, response APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
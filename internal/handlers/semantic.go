@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/requestid"
+)
+
+// SemanticRefreshHandler handles POST /admin/semantic/refresh, bringing the
+// semantic search index up to date now rather than at its next scheduled
+// refresh, such as after a bulk load.
+func SemanticRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if semanticIndex == nil {
+		writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+			Message:   "Semantic search unavailable",
+			Error:     apierror.New(apierror.FeatureUnavailable, "set SEMANTIC_COLUMNS to the text columns to index; see the server log if it is set"),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+
+	if err := semanticIndex.Refresh(r.Context()); err != nil {
+		writeAdminResponse(w, http.StatusInternalServerError, APIResponse{
+			Message:   "Semantic index refresh failed",
+			Error:     apierror.New(apierror.ForStatus(http.StatusInternalServerError), err.Error()),
+			RequestID: requestid.FromContext(r.Context()),
+		})
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{
+		Message: "Semantic index refreshed",
+		Data: map[string]interface{}{
+			"model":   semanticIndex.Model(),
+			"columns": semanticIndex.Columns(),
+		},
+	})
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/llm"
+)
+
+// slashCommandHelp lists the commands answered without the LLM.
+const slashCommandHelp = `Commands answered without the LLM:
+/tables - list tables
+/schema <table> - list a table's columns
+/sql <select statement> - run a read-only query
+/profile <table> - profile a table's columns
+/help - show this help`
+
+// commandError reports an unknown command or a command used incorrectly.
+type commandError struct {
+	message string
+}
+
+func (e commandError) Error() string {
+	return e.message
+}
+
+// isSlashCommand reports whether a message is a slash command such as "/tables".
+func isSlashCommand(message string) bool {
+	return strings.HasPrefix(strings.TrimSpace(message), "/")
+}
+
+// slashCommandResponse turns a slash command into the response the LLM would
+// have given: /sql and /profile become tool calls, so they are authorized,
+// audited, and streamed like any other, while /tables, /schema, and /help are
+// answered as text from the schema. Tables and columns the user cannot read
+// are left out of listings.
+func slashCommandResponse(ctx context.Context, db *database.Connection, message string) (*llm.AnthropicResponse, error) {
+	command, arg, _ := strings.Cut(strings.TrimSpace(message), " ")
+	arg = strings.TrimSpace(arg)
+
+	switch strings.ToLower(command) {
+	case "/help":
+		return textResponse(slashCommandHelp), nil
+
+	case "/tables":
+		tables, err := db.TableNames(ctx)
+		if err != nil {
+			return nil, err
+		}
+		var visible []string
+		for _, table := range tables {
+			if accessControl.TableVisible(ctx, table) {
+				visible = append(visible, table)
+			}
+		}
+		if len(visible) == 0 {
+			return textResponse("No tables are available."), nil
+		}
+		return textResponse("Available tables: " + strings.Join(visible, ", ")), nil
+
+	case "/schema":
+		if arg == "" {
+			return nil, commandError{"usage: /schema <table>"}
+		}
+		exists, err := db.HasTable(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		if !exists || !accessControl.TableVisible(ctx, arg) {
+			return nil, commandError{fmt.Sprintf("table %q does not exist", arg)}
+		}
+		columns, err := db.TableColumns(ctx, arg)
+		if err != nil {
+			return nil, err
+		}
+		var lines []string
+		for _, col := range columns {
+			if !accessControl.ColumnVisible(ctx, arg, col.Name) {
+				continue
+			}
+			line := fmt.Sprintf("- %s %s", col.Name, col.DataType)
+			if col.PrimaryKey {
+				line += " (primary key)"
+			} else if !col.Nullable {
+				line += " (not null)"
+			}
+			lines = append(lines, line)
+		}
+		return textResponse(fmt.Sprintf("Columns of %s:\n%s", arg, strings.Join(lines, "\n"))), nil
+
+	case "/sql":
+		if arg == "" {
+			return nil, commandError{"usage: /sql <select statement>"}
+		}
+		return toolResponse("database_query", map[string]interface{}{"query": arg}), nil
+
+	case "/profile":
+		if arg == "" {
+			return nil, commandError{"usage: /profile <table>"}
+		}
+		return toolResponse("table_profile", map[string]interface{}{"table": arg}), nil
+
+	default:
+		return nil, commandError{fmt.Sprintf("unknown command %s; try /help", command)}
+	}
+}
+
+// textResponse wraps text as an LLM text answer.
+func textResponse(text string) *llm.AnthropicResponse {
+	response := &llm.AnthropicResponse{StopReason: "end_turn"}
+	response.Content = append(response.Content, toolCallContent{Type: "text", Text: text})
+	return response
+}
+
+// toolResponse wraps a single tool call as an LLM tool_use answer.
+func toolResponse(tool string, input map[string]interface{}) *llm.AnthropicResponse {
+	response := &llm.AnthropicResponse{StopReason: "tool_use"}
+	response.Content = append(response.Content, toolCallContent{
+		Type:  "tool_use",
+		ID:    "command_1",
+		Name:  tool,
+		Input: input,
+	})
+	return response
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/requestid"
+)
+
+// SlowQueriesHandler lists the most recent tool queries that ran past
+// SLOW_QUERY_THRESHOLD, newest first, with their plans and index advice.
+// ?limit= caps how many are returned.
+func SlowQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	limit := 0
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			writeAdminResponse(w, http.StatusBadRequest, APIResponse{
+				Message:   "Invalid limit",
+				Error:     apierror.New(apierror.InvalidRequest, "limit must be a positive integer"),
+				RequestID: requestid.FromContext(r.Context()),
+			})
+			return
+		}
+		limit = parsed
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Slow queries", Data: slowQueries.Recent(limit)})
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/snapshots"
+)
+
+// SnapshotRequest keeps a query's result as a named table. Retention is a
+// duration such as "72h", defaulting to SNAPSHOT_RETENTION; Replace takes
+// an existing snapshot of the same name again.
+type SnapshotRequest struct {
+	Query     string `json:"query"`
+	Name      string `json:"name"`
+	Retention string `json:"retention,omitempty"`
+	Replace   bool   `json:"replace,omitempty"`
+}
+
+// SnapshotHandler runs a validated and authorized SELECT and keeps its
+// result as a snapshot table, which later chats can query by name and
+// query_diff can compare with. The table is described in the data
+// dictionary, so the LLM's schema says what it holds and when it was taken.
+// Tenants cannot take snapshots, since they are kept in the default
+// database, not theirs.
+func (dh *DatabaseHandler) SnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if querySnapshots == nil {
+		writeSnapshotsUnavailable(w, r)
+		return
+	}
+	if auth.TenantID(r.Context()) != "" {
+		writeSnapshotError(w, r, fmt.Errorf("%w: snapshots are not available in multi-tenant mode", snapshots.ErrInvalid))
+		return
+	}
+
+	var request SnapshotRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return
+	}
+	if err := dh.queryTool.Validate(map[string]interface{}{"query": request.Query}); err != nil {
+		writeSnapshotError(w, r, fmt.Errorf("%w: %v", snapshots.ErrInvalid, err))
+		return
+	}
+	var retention time.Duration
+	if request.Retention != "" {
+		parsed, err := time.ParseDuration(request.Retention)
+		if err != nil {
+			writeSnapshotError(w, r, fmt.Errorf("%w: retention %q is not a duration such as 72h", snapshots.ErrInvalid, request.Retention))
+			return
+		}
+		retention = parsed
+	}
+
+	if err := accessControl.AuthorizeQuery(r.Context(), request.Query); err != nil {
+		auditLog.Record(r.Context(), audit.Entry{
+			Action:  "db_query_snapshot",
+			Status:  "denied",
+			Details: map[string]interface{}{"query": request.Query, "name": request.Name, "error": err.Error()},
+		})
+		apierror.Write(w, r, http.StatusForbidden, "Query not permitted", apierror.New(apierror.QueryForbidden, err.Error()))
+		return
+	}
+
+	columns, rows, err := dh.queryTool.QueryRows(r.Context(), request.Query)
+	if err != nil {
+		auditLog.Record(r.Context(), audit.Entry{
+			Action:  "db_query_snapshot",
+			Status:  "error",
+			Details: map[string]interface{}{"query": request.Query, "name": request.Name, "error": err.Error()},
+		})
+		code, _ := database.ClassifyError(err)
+		apierror.Write(w, r, toolErrorStatus(code), "Query failed", apierror.New(code, err.Error()))
+		return
+	}
+
+	snapshot, err := querySnapshots.Create(r.Context(), snapshots.Snapshot{
+		Name:      request.Name,
+		Query:     request.Query,
+		CreatedBy: auth.UserID(r.Context()),
+	}, retention, request.Replace, columns, rows)
+	if err != nil {
+		writeSnapshotError(w, r, err)
+		return
+	}
+	if dataDictionary != nil {
+		_, err := dataDictionary.Set(r.Context(), dictionary.Entry{
+			Table: snapshot.Name,
+			Description: fmt.Sprintf("Snapshot of a query result taken %s, kept until %s. Query: %s",
+				snapshot.CreatedAt.Format(time.RFC3339), snapshot.ExpiresAt.Format(time.RFC3339), snapshot.Query),
+			UpdatedBy: snapshot.CreatedBy,
+		})
+		if err != nil {
+			slog.WarnContext(r.Context(), "failed to describe snapshot", "snapshot", snapshot.Name, "error", err)
+		}
+	}
+	auditLog.Record(r.Context(), audit.Entry{
+		Action:  "db_query_snapshot",
+		Status:  "ok",
+		Details: map[string]interface{}{"query": request.Query, "name": snapshot.Name, "row_count": snapshot.Rows, "expires_at": snapshot.ExpiresAt},
+	})
+	writeAdminResponse(w, http.StatusCreated, APIResponse{Message: "Snapshot taken", Data: snapshot})
+}
+
+// SnapshotsHandler lists the snapshots on GET.
+func SnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if querySnapshots == nil {
+		writeSnapshotsUnavailable(w, r)
+		return
+	}
+
+	list, err := querySnapshots.List(r.Context())
+	if err != nil {
+		writeSnapshotError(w, r, err)
+		return
+	}
+	if list == nil {
+		list = []snapshots.Snapshot{}
+	}
+	writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Snapshots", Data: list})
+}
+
+// SnapshotDeleteHandler drops (DELETE) a snapshot before its retention
+// ends. Only the user who took it and admins may.
+func SnapshotDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+	if querySnapshots == nil {
+		writeSnapshotsUnavailable(w, r)
+		return
+	}
+
+	snapshot, err := querySnapshots.Get(r.Context(), r.PathValue("name"))
+	if err != nil {
+		writeSnapshotError(w, r, err)
+		return
+	}
+	if user := auth.UserFromContext(r.Context()); user != nil && user.ID != snapshot.CreatedBy && !user.HasRole("admin") {
+		apierror.Write(w, r, http.StatusForbidden, "Forbidden", apierror.New(apierror.Forbidden, "only the user who took a snapshot or an admin may delete it"))
+		return
+	}
+	if err := querySnapshots.Delete(r.Context(), snapshot.Name); err != nil {
+		writeSnapshotError(w, r, err)
+		return
+	}
+	if dataDictionary != nil {
+		if err := dataDictionary.Delete(r.Context(), snapshot.Name, ""); err != nil && !errors.Is(err, dictionary.ErrNotFound) {
+			slog.WarnContext(r.Context(), "failed to remove snapshot description", "snapshot", snapshot.Name, "error", err)
+		}
+	}
+	auditLog.Record(r.Context(), audit.Entry{Action: "snapshot_deleted", Status: "ok", Details: map[string]interface{}{"name": snapshot.Name}})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeSnapshotError reports a failed snapshot request.
+func writeSnapshotError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Snapshot request failed"
+	switch {
+	case errors.Is(err, snapshots.ErrNotFound):
+		status, message = http.StatusNotFound, "Snapshot not found"
+	case errors.Is(err, snapshots.ErrInvalid):
+		status, message = http.StatusBadRequest, "Invalid snapshot"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeSnapshotsUnavailable reports that the registrations table could not
+// be created at startup.
+func writeSnapshotsUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Message:   "Snapshots unavailable",
+		Error:     apierror.New(apierror.FeatureUnavailable, "the "+snapshots.Table+" table could not be created; check the database user's permissions"),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+
+	"data-chatter/internal/sqlrewrite"
+)
+
+// sqlRewriteFromEnv reads SQL_REWRITE_ON_ERROR, which lets the agent loop
+// ask the model to rewrite a query that failed because it was written for
+// another SQL dialect.
+func sqlRewriteFromEnv() bool {
+	return os.Getenv("SQL_REWRITE_ON_ERROR") == "true"
+}
+
+// rewriteFailedQuery returns the tool call to run instead of content when
+// its query failed with dialect hints, such as strftime run against
+// PostgreSQL: the same call with the query rewritten by the model for the
+// database's dialect. It returns false when rewriting is off, the LLM is
+// not configured, the failure carries no hints, or the model gives no
+// usable query.
+func (lh *LLMHandler) rewriteFailedQuery(ctx context.Context, turnID string, content toolCallContent, results map[string]interface{}) (toolCallContent, bool) {
+	if !lh.rewriteSQL || !lh.processor.Configured(ctx) {
+		return content, false
+	}
+	query, _ := content.Input["query"].(string)
+	code, message := toolErrorFields(results)
+	if query == "" || !sqlrewrite.Applies(code) {
+		return content, false
+	}
+	dialect, hints := dialectHints(results)
+	if len(hints) == 0 {
+		return content, false
+	}
+
+	rewritten, err := lh.processor.RewriteSQL(ctx, dialect, query, message, hints)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to rewrite query for dialect", "turn_id", turnID, "tool", content.Name, "dialect", dialect, "error", err)
+		return content, false
+	}
+	if rewritten == query {
+		return content, false
+	}
+	slog.InfoContext(ctx, "rewrote query for dialect", "turn_id", turnID, "tool", content.Name, "dialect", dialect, "query", query, "rewritten", rewritten)
+
+	input := make(map[string]interface{}, len(content.Input))
+	for key, value := range content.Input {
+		input[key] = value
+	}
+	input["query"] = rewritten
+	content.Input = input
+	return content, true
+}
+
+// dialectHints returns the dialect and hints a failed query tool result
+// carries in its error's details.
+func dialectHints(results map[string]interface{}) (string, []sqlrewrite.Hint) {
+	toolErr, _ := results["error"].(map[string]interface{})
+	encoded, err := json.Marshal(toolErr["details"])
+	if err != nil {
+		return "", nil
+	}
+	var details struct {
+		Dialect string            `json:"dialect"`
+		Hints   []sqlrewrite.Hint `json:"hints"`
+	}
+	if json.Unmarshal(encoded, &details) != nil {
+		return "", nil
+	}
+	return details.Dialect, details.Hints
+}
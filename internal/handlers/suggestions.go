@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/suggestions"
+)
+
+// SuggestionSummary is a suggested question as shown to users; the saved
+// query stays server-side.
+type SuggestionSummary struct {
+	ID          string `json:"id"`
+	Question    string `json:"question"`
+	Description string `json:"description,omitempty"`
+}
+
+// SuggestionRequest publishes or edits a suggested question.
+type SuggestionRequest struct {
+	Question    string `json:"question"`
+	Description string `json:"description,omitempty"`
+	SQL         string `json:"sql"`
+}
+
+// SuggestionsHandler lists the suggested questions the caller may ask,
+// leaving out those whose saved query reads tables or columns the caller's
+// roles cannot. Send one to /llm/message as suggestion_id to answer it.
+func SuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	summaries := []SuggestionSummary{}
+	for _, suggestion := range suggestedQuestions.List() {
+		if accessControl.AuthorizeQuery(r.Context(), suggestion.SQL) != nil {
+			continue
+		}
+		summaries = append(summaries, SuggestionSummary{
+			ID:          suggestion.ID,
+			Question:    suggestion.Question,
+			Description: suggestion.Description,
+		})
+	}
+	writeSuggestionResponse(w, http.StatusOK, APIResponse{Message: "Suggested questions", Data: summaries})
+}
+
+// AdminSuggestionsHandler lists the catalog with its saved queries on GET and
+// publishes a new suggestion on POST. The query is run once before it is
+// saved, so only read-only queries that succeed are published.
+func AdminSuggestionsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeSuggestionResponse(w, http.StatusOK, APIResponse{Message: "Suggested questions", Data: suggestedQuestions.List()})
+
+	case http.MethodPost:
+		request, ok := decodeSuggestion(w, r)
+		if !ok {
+			return
+		}
+		suggestion, err := suggestedQuestions.Add(suggestions.Suggestion{
+			Question:    request.Question,
+			Description: request.Description,
+			SQL:         request.SQL,
+			CreatedBy:   auth.UserID(r.Context()),
+		})
+		if err != nil {
+			writeSuggestionError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "suggestion_published", Status: "ok", Details: map[string]interface{}{"id": suggestion.ID}})
+		writeSuggestionResponse(w, http.StatusCreated, APIResponse{Message: "Suggestion published", Data: suggestion})
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// AdminSuggestionHandler edits (PUT) or withdraws (DELETE) a suggestion.
+func AdminSuggestionHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+
+	switch r.Method {
+	case http.MethodPut:
+		request, ok := decodeSuggestion(w, r)
+		if !ok {
+			return
+		}
+		suggestion, err := suggestedQuestions.Update(id, suggestions.Suggestion{
+			Question:    request.Question,
+			Description: request.Description,
+			SQL:         request.SQL,
+		})
+		if err != nil {
+			writeSuggestionError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "suggestion_updated", Status: "ok", Details: map[string]interface{}{"id": id}})
+		writeSuggestionResponse(w, http.StatusOK, APIResponse{Message: "Suggestion updated", Data: suggestion})
+
+	case http.MethodDelete:
+		if err := suggestedQuestions.Delete(id); err != nil {
+			writeSuggestionError(w, r, err)
+			return
+		}
+		auditLog.Record(r.Context(), audit.Entry{Action: "suggestion_deleted", Status: "ok", Details: map[string]interface{}{"id": id}})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// decodeSuggestion reads a suggestion request and checks its query by
+// running it, writing the error response when either fails.
+func decodeSuggestion(w http.ResponseWriter, r *http.Request) (SuggestionRequest, bool) {
+	var request SuggestionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+		return request, false
+	}
+	if request.SQL != "" {
+		if err := checkSuggestionQuery(r.Context(), request.SQL); err != nil {
+			writeSuggestionError(w, r, err)
+			return request, false
+		}
+	}
+	return request, true
+}
+
+// checkSuggestionQuery runs a saved query through the database_query tool,
+// so it gets the same validation as LLM-generated SQL.
+func checkSuggestionQuery(ctx context.Context, query string) error {
+	result, err := toolRunner.ExecuteTool(ctx, "database_query", map[string]interface{}{"query": query})
+	if err != nil {
+		return fmt.Errorf("%w: %v", suggestions.ErrInvalid, err)
+	}
+	if result.IsError {
+		message := "query failed"
+		if result.Error != nil {
+			message = result.Error.Message
+		} else if len(result.Content) > 0 {
+			message = result.Content[0].Text
+		}
+		return fmt.Errorf("%w: sql: %s", suggestions.ErrInvalid, message)
+	}
+	return nil
+}
+
+// writeSuggestion answers a suggested question from its saved query instead
+// of the LLM, as a database_query step, so the answer is the same every time.
+func (lh *LLMHandler) writeSuggestion(ctx context.Context, w http.ResponseWriter, request MessageRequest, suggestion suggestions.Suggestion) {
+	saved := &llm.AnthropicResponse{StopReason: "tool_use"}
+	saved.Content = append(saved.Content, toolCallContent{
+		Type:  "tool_use",
+		ID:    "suggestion_1",
+		Name:  "database_query",
+		Input: map[string]interface{}{"query": suggestion.SQL},
+	})
+	if request.DryRun {
+		lh.writePreview(ctx, w, request, saved, false)
+		return
+	}
+
+	status, response := lh.answer(ctx, request, saved, false)
+	response.SuggestionID = suggestion.ID
+	writeMessageResponse(w, status, response)
+}
+
+// writeSuggestionError reports a failed suggestion request.
+func writeSuggestionError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Failed to save suggestion"
+	switch {
+	case errors.Is(err, suggestions.ErrNotFound):
+		status, message = http.StatusNotFound, "Suggestion not found"
+	case errors.Is(err, suggestions.ErrInvalid):
+		status, message = http.StatusBadRequest, "Invalid suggestion"
+	}
+	writeSuggestionResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeSuggestionResponse writes a suggestion endpoint's JSON response.
+func writeSuggestionResponse(w http.ResponseWriter, status int, response APIResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
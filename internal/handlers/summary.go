@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"data-chatter/internal/events"
+	"data-chatter/internal/llm"
+)
+
+// summaryQueries reports whether a turn's results can get a narrative
+// summary, returning the SQL they came from. The turn must have asked for one,
+// and every step must have succeeded with a configured LLM.
+func (lh *LLMHandler) summaryQueries(ctx context.Context, request MessageRequest, status int, response MessageResponse, degraded bool) ([]string, bool) {
+	if !request.Summary {
+		return nil, false
+	}
+	return lh.resultQueries(ctx, status, response, degraded)
+}
+
+// resultQueries reports whether the LLM can write about a turn's results,
+// returning the SQL they came from: every step must have succeeded with a
+// configured LLM.
+func (lh *LLMHandler) resultQueries(ctx context.Context, status int, response MessageResponse, degraded bool) ([]string, bool) {
+	if status != http.StatusOK || degraded || response.Pending || len(response.Plan) == 0 || !lh.processor.Configured(ctx) {
+		return nil, false
+	}
+	var queries []string
+	for _, step := range response.Plan {
+		if step.Status != "ok" {
+			return nil, false
+		}
+		if step.SQL != "" {
+			queries = append(queries, step.SQL)
+		}
+	}
+	return queries, true
+}
+
+// formatAnswer has the LLM rewrite a turn's message from its results in the
+// requested response format. The results are still returned as they are,
+// and when formatting fails the message is left unchanged.
+func (lh *LLMHandler) formatAnswer(ctx context.Context, request MessageRequest, status int, response *MessageResponse, degraded bool) {
+	format, _ := llm.ParseResponseFormat(request.ResponseFormat)
+	if format == llm.FormatRaw {
+		return
+	}
+	queries, ok := lh.resultQueries(ctx, status, *response, degraded)
+	if !ok {
+		return
+	}
+
+	text, err := lh.processor.Format(ctx, format, request.Message, strings.Join(queries, ";\n\n"), response.Results, exportLink(ctx, request.TurnID))
+	if err != nil {
+		slog.WarnContext(ctx, "failed to format results", "turn_id", request.TurnID, "response_format", format, "error", err)
+		return
+	}
+	response.Message = text
+	response.ResponseFormat = format
+}
+
+// summarizeLater runs the second phase of a turn whose results have been
+// written: the LLM summarizes them and the text is streamed to the turn's
+// event stream as summary_delta events, ending with summary_finished. The
+// event stream stays open until the summary is done, which may be after the
+// turn's request has ended, and the summary becomes the turn's reply in its
+// conversation. Its tokens are added to the turn's statistics.
+func (lh *LLMHandler) summarizeLater(ctx context.Context, request MessageRequest, queries []string, results interface{}) {
+	release := progressBus.Hold(request.TurnID)
+	ctx, cancel := context.WithTimeout(llm.WithUsageMeter(context.WithoutCancel(ctx)), lh.turnTimeout)
+	go func() {
+		defer release()
+		defer cancel()
+
+		summary, err := lh.processor.SummarizeStream(ctx, request.Message, strings.Join(queries, ";\n\n"), results, exportLink(ctx, request.TurnID), func(text string) {
+			progressBus.Publish(events.Event{Type: events.SummaryDelta, TurnID: request.TurnID, Text: text})
+		})
+		finished := events.Event{Type: events.SummaryFinished, TurnID: request.TurnID, Text: summary}
+		if err != nil {
+			slog.WarnContext(ctx, "failed to summarize results", "turn_id", request.TurnID, "error", err)
+			finished.Error = err.Error()
+		}
+		progressBus.Publish(finished)
+		recordSummaryStats(ctx, request.TurnID)
+
+		if err == nil && request.ConversationID != "" {
+			if err := lh.conversations.SetReply(request.ConversationID, request.TurnID, summary); err != nil {
+				slog.WarnContext(ctx, "failed to record summary", "conversation_id", request.ConversationID, "turn_id", request.TurnID, "error", err)
+			}
+		}
+	}()
+}
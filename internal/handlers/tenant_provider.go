@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/tenant"
+)
+
+// TenantProviderHandler reads and changes the LLM provider the caller's
+// tenant sends its requests to: GET returns the settings, PUT saves them
+// with the tenant's own API key, and DELETE goes back to the server's
+// provider. API keys are never returned.
+func TenantProviderHandler(w http.ResponseWriter, r *http.Request) {
+	if tenantProviders == nil {
+		writeTenantProviderUnavailable(w, r)
+		return
+	}
+	ctx := r.Context()
+	tenantID := auth.TenantID(ctx)
+	if tenantID == "" {
+		writeTenantProviderError(w, r, errors.New("provider settings are per tenant; send the request as a tenant"))
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := tenantProviders.Get(ctx, tenantID)
+		if err != nil {
+			writeTenantProviderError(w, r, err)
+			return
+		}
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Provider settings", Data: settings})
+
+	case http.MethodPut:
+		var update tenant.ProviderUpdate
+		if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+			apierror.WriteInvalidRequest(w, r, "Invalid request format: "+err.Error())
+			return
+		}
+		settings, err := tenantProviders.Set(ctx, tenantID, update, auth.UserID(ctx))
+		if err != nil {
+			writeTenantProviderError(w, r, err)
+			return
+		}
+		auditLog.Record(ctx, audit.Entry{Action: "tenant_provider_updated", Status: "ok", Details: map[string]interface{}{
+			"provider": settings.Provider, "model": settings.Model, "key_hint": settings.KeyHint,
+		}})
+		writeAdminResponse(w, http.StatusOK, APIResponse{Message: "Provider settings updated", Data: settings})
+
+	case http.MethodDelete:
+		if err := tenantProviders.Delete(ctx, tenantID); err != nil {
+			writeTenantProviderError(w, r, err)
+			return
+		}
+		auditLog.Record(ctx, audit.Entry{Action: "tenant_provider_deleted", Status: "ok"})
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		apierror.WriteMethodNotAllowed(w, r)
+	}
+}
+
+// writeTenantProviderError reports a failed provider settings request.
+// Requests outside multi-tenant mode are invalid.
+func writeTenantProviderError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusInternalServerError, "Provider settings request failed"
+	switch {
+	case errors.Is(err, tenant.ErrNotFound):
+		status, message = http.StatusNotFound, "Provider settings not found"
+	case errors.Is(err, tenant.ErrInvalid), auth.TenantID(r.Context()) == "":
+		status, message = http.StatusBadRequest, "Invalid provider settings"
+	}
+	writeAdminResponse(w, status, APIResponse{
+		Message:   message,
+		Error:     apierror.New(apierror.ForStatus(status), err.Error()),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
+
+// writeTenantProviderUnavailable reports that tenant provider settings are
+// off: multi-tenant mode or encryption is not configured, or the settings
+// table could not be created at startup.
+func writeTenantProviderUnavailable(w http.ResponseWriter, r *http.Request) {
+	writeAdminResponse(w, http.StatusServiceUnavailable, APIResponse{
+		Message:   "Provider settings unavailable",
+		Error:     apierror.New(apierror.FeatureUnavailable, "tenant provider settings need TENANTS_FILE, HISTORY_ENCRYPTION_KEYS, and the "+tenant.ProviderTable+" table"),
+		RequestID: requestid.FromContext(r.Context()),
+	})
+}
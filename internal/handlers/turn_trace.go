@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/llm"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// turnTraceLimit bounds how many turns' traces are kept.
+const turnTraceLimit = 500
+
+// TurnTrace is what happened while a turn was answered, for debugging a bad
+// answer: every request sent to the LLM with the prompt and the model's
+// output, the tools run with their SQL and timings, and the tokens used.
+type TurnTrace struct {
+	ConversationID string          `json:"conversation_id"`
+	TurnID         string          `json:"turn_id"`
+	Turn           int             `json:"turn"` // Position in the conversation, from 1
+	TraceID        string          `json:"trace_id,omitempty"`
+	Message        string          `json:"message"`
+	Reply          string          `json:"reply,omitempty"`
+	Status         int             `json:"status"`
+	Error          *apierror.Error `json:"error,omitempty"`
+	StartedAt      time.Time       `json:"started_at"`
+	DurationMs     int64           `json:"duration_ms"`
+	LLM            []llm.Exchange  `json:"llm"`
+	Tools          []PlanStep      `json:"tools"`
+	Usage          llm.Usage       `json:"usage"`
+}
+
+// turnTrace is a kept trace with the transcript its LLM requests are read
+// from, which grows when a summary is streamed after the turn was answered.
+type turnTrace struct {
+	trace      TurnTrace
+	transcript *llm.Transcript
+}
+
+// turnTraceCache keeps the traces of recent turns.
+type turnTraceCache struct {
+	mu      sync.Mutex
+	order   []string
+	entries map[string]*turnTrace
+}
+
+// newTurnTraceCache creates an empty cache.
+func newTurnTraceCache() *turnTraceCache {
+	return &turnTraceCache{
+		entries: make(map[string]*turnTrace),
+	}
+}
+
+// Put stores the trace of a turn, evicting the oldest turn when full.
+func (c *turnTraceCache) Put(turnID string, entry *turnTrace) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.entries[turnID]; !exists {
+		c.order = append(c.order, turnID)
+	}
+	c.entries[turnID] = entry
+
+	for len(c.order) > turnTraceLimit {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+}
+
+// Get returns the trace stored for a turn.
+func (c *turnTraceCache) Get(turnID string) (*turnTrace, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, exists := c.entries[turnID]
+	return entry, exists
+}
+
+// recordTrace keeps the trace of a finished turn, with the LLM requests in
+// ctx's transcript.
+func (lh *LLMHandler) recordTrace(ctx context.Context, conversationID string, request MessageRequest, status int, response MessageResponse) {
+	entry := &turnTrace{
+		trace: TurnTrace{
+			ConversationID: conversationID,
+			TurnID:         request.TurnID,
+			Message:        request.Message,
+			Reply:          response.Message,
+			Status:         status,
+			Error:          response.Error,
+			Tools:          response.Plan,
+		},
+		transcript: llm.TranscriptOf(ctx),
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+		entry.trace.TraceID = spanContext.TraceID().String()
+	}
+	if entry.transcript != nil {
+		entry.trace.StartedAt = entry.transcript.Started()
+		entry.trace.DurationMs = time.Since(entry.trace.StartedAt).Milliseconds()
+	}
+	lh.traces.Put(request.TurnID, entry)
+}
+
+// TurnTraceHandler returns the trace of a turn, named by its ID or its
+// position in the conversation from 1, to readers of the conversation.
+// Traces are kept for the most recent turns only.
+func (lh *LLMHandler) TurnTraceHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		apierror.WriteMethodNotAllowed(w, r)
+		return
+	}
+
+	c, err := lh.conversations.Get(r.PathValue("id"))
+	if err != nil || !visibleTo(r.Context(), c) {
+		writeConversationNotFound(w, r, "No conversation with that ID")
+		return
+	}
+	selector := r.PathValue("turn")
+	position := 0
+	for i, turn := range c.Turns {
+		if turn.TurnID == selector {
+			position = i + 1
+			break
+		}
+	}
+	if position == 0 {
+		if n, err := strconv.Atoi(selector); err == nil && n >= 1 && n <= len(c.Turns) {
+			position = n
+		}
+	}
+	if position == 0 {
+		writeConversationNotFound(w, r, "No turn with that ID or number in this conversation")
+		return
+	}
+	entry, ok := lh.traces.Get(c.Turns[position-1].TurnID)
+	if !ok {
+		writeConversationNotFound(w, r, "The turn's trace is no longer kept")
+		return
+	}
+
+	turnTrace := entry.trace
+	turnTrace.ConversationID = c.ID
+	turnTrace.Turn = position
+	turnTrace.LLM = []llm.Exchange{}
+	if entry.transcript != nil {
+		turnTrace.LLM = entry.transcript.Exchanges()
+	}
+	for _, exchange := range turnTrace.LLM {
+		turnTrace.Usage.InputTokens += exchange.Usage.InputTokens
+		turnTrace.Usage.OutputTokens += exchange.Usage.OutputTokens
+		turnTrace.Usage.CacheCreationInputTokens += exchange.Usage.CacheCreationInputTokens
+		turnTrace.Usage.CacheReadInputTokens += exchange.Usage.CacheReadInputTokens
+	}
+	if turnTrace.Tools == nil {
+		turnTrace.Tools = []PlanStep{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(turnTrace)
+}
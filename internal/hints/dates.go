@@ -0,0 +1,280 @@
+package hints
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// monthPattern matches English month names and their abbreviations.
+const monthPattern = `jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:tember|t)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?`
+
+// Patterns of the expressions findDates reads, all case-insensitive.
+var (
+	relativeDayPattern    = regexp.MustCompile(`(?i)\b(today|yesterday|tomorrow)\b`)
+	calendarPeriodPattern = regexp.MustCompile(`(?i)\b(this|current|last|previous|next)\s+(week|month|quarter|year)\b`)
+	rollingPeriodPattern  = regexp.MustCompile(`(?i)\b(last|past|previous|next|coming)\s+(\d{1,4})\s+(day|week|month|quarter|year)s?\b`)
+	agoPattern            = regexp.MustCompile(`(?i)\b(\d{1,4})\s+(day|week|month|year)s?\s+ago\b`)
+	weekdayPattern        = regexp.MustCompile(`(?i)\b(this|last|previous|next|coming)\s+(monday|tuesday|wednesday|thursday|friday|saturday|sunday)\b`)
+	toDatePattern         = regexp.MustCompile(`(?i)\b(?:(year|quarter|month)[\s-]to[\s-]date|(ytd|qtd|mtd))\b`)
+	quarterPattern        = regexp.MustCompile(`(?i)\bq([1-4])(?:[\s/-]*((?:19|20)\d{2}))?\b`)
+	yearQuarterPattern    = regexp.MustCompile(`(?i)\b((?:19|20)\d{2})[\s/-]*q([1-4])\b`)
+	monthDayPattern       = regexp.MustCompile(`(?i)\b(` + monthPattern + `)\.?\s+(\d{1,2})(?:st|nd|rd|th)?\b(?:,?\s+((?:19|20)\d{2})\b)?`)
+	dayMonthPattern       = regexp.MustCompile(`(?i)\b(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?(` + monthPattern + `)\b\.?(?:,?\s+((?:19|20)\d{2})\b)?`)
+	monthYearPattern      = regexp.MustCompile(`(?i)\b(` + monthPattern + `)\.?,?\s+((?:19|20)\d{2})\b`)
+	numericDatePattern    = regexp.MustCompile(`\b(\d{1,4})([./-])(\d{1,2})([./-])(\d{2,4})\b`)
+)
+
+// weekdays are the days of the week by name.
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// findDates returns the dates and periods in question, most specific
+// patterns first, for Find to drop those overlapping an earlier one.
+func findDates(question string, l locale, today time.Time) []Hint {
+	var hints []Hint
+	each := func(pattern *regexp.Regexp, read func(m []string) (Hint, bool)) {
+		for _, loc := range pattern.FindAllStringSubmatchIndex(question, -1) {
+			m := make([]string, len(loc)/2)
+			for i := range m {
+				if loc[2*i] >= 0 {
+					m[i] = strings.ToLower(question[loc[2*i]:loc[2*i+1]])
+				}
+			}
+			if h, ok := read(m); ok {
+				h.pos, h.end = loc[0], loc[1]
+				hints = append(hints, h)
+			}
+		}
+	}
+
+	each(numericDatePattern, func(m []string) (Hint, bool) {
+		return numericDate(m, l, today)
+	})
+	each(monthDayPattern, func(m []string) (Hint, bool) {
+		return calendarDate(m[3], m[1], m[2], today)
+	})
+	each(dayMonthPattern, func(m []string) (Hint, bool) {
+		return calendarDate(m[3], m[2], m[1], today)
+	})
+	each(monthYearPattern, func(m []string) (Hint, bool) {
+		year, _ := strconv.Atoi(m[2])
+		start := time.Date(year, monthNumber(m[1]), 1, 0, 0, 0, 0, time.UTC)
+		return period(start, start.AddDate(0, 1, -1), ""), true
+	})
+	each(yearQuarterPattern, func(m []string) (Hint, bool) {
+		return quarter(m[1], m[2], today), true
+	})
+	each(quarterPattern, func(m []string) (Hint, bool) {
+		return quarter(m[2], m[1], today), true
+	})
+	each(toDatePattern, func(m []string) (Hint, bool) {
+		unit := m[1]
+		switch m[2] {
+		case "ytd":
+			unit = "year"
+		case "qtd":
+			unit = "quarter"
+		case "mtd":
+			unit = "month"
+		}
+		return period(periodStart(unit, today, l), today, ""), true
+	})
+	each(rollingPeriodPattern, func(m []string) (Hint, bool) {
+		n, _ := strconv.Atoi(m[2])
+		if n == 0 {
+			return Hint{}, false
+		}
+		if m[1] == "next" || m[1] == "coming" {
+			return period(today.AddDate(0, 0, 1), addUnits(today, m[3], n), fmt.Sprintf("the %d %ss after today", n, m[3])), true
+		}
+		return period(addUnits(today, m[3], -n).AddDate(0, 0, 1), today, fmt.Sprintf("the %d %ss up to and including today", n, m[3])), true
+	})
+	each(agoPattern, func(m []string) (Hint, bool) {
+		n, _ := strconv.Atoi(m[1])
+		return date(addUnits(today, m[2], -n), ""), true
+	})
+	each(weekdayPattern, func(m []string) (Hint, bool) {
+		day := weekdays[m[2]]
+		switch m[1] {
+		case "this":
+			start := periodStart("week", today, l)
+			return date(start.AddDate(0, 0, (int(day)-int(start.Weekday())+7)%7), ""), true
+		case "next", "coming":
+			return date(today.AddDate(0, 0, (int(day)-int(today.Weekday())+6)%7+1), fmt.Sprintf("the first %s after today", day)), true
+		default:
+			return date(today.AddDate(0, 0, -((int(today.Weekday())-int(day)+6)%7+1)), fmt.Sprintf("the last %s before today", day)), true
+		}
+	})
+	each(calendarPeriodPattern, func(m []string) (Hint, bool) {
+		start := periodStart(m[2], today, l)
+		switch m[1] {
+		case "last", "previous":
+			start = addUnits(start, m[2], -1)
+		case "next":
+			start = addUnits(start, m[2], 1)
+		}
+		return period(start, addUnits(start, m[2], 1).AddDate(0, 0, -1), ""), true
+	})
+	each(relativeDayPattern, func(m []string) (Hint, bool) {
+		switch m[1] {
+		case "yesterday":
+			return date(today.AddDate(0, 0, -1), ""), true
+		case "tomorrow":
+			return date(today.AddDate(0, 0, 1), ""), true
+		}
+		return date(today, ""), true
+	})
+	return hints
+}
+
+// numericDate reads a date of three numbers, year first or last. Day and
+// month are in the locale's order unless only one reading is a valid date;
+// dates with dots, as in 5.3.2024, are always day first.
+func numericDate(m []string, l locale, today time.Time) (Hint, bool) {
+	if m[2] != m[4] {
+		return Hint{}, false
+	}
+	if len(m[1]) == 4 {
+		// Year first is always year, month, day
+		if len(m[5]) > 2 {
+			return Hint{}, false
+		}
+		year, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[3])
+		day, _ := strconv.Atoi(m[5])
+		t, ok := validDate(year, month, day)
+		if !ok || (m[2] == "-" && len(m[3]) == 2 && len(m[5]) == 2) {
+			return Hint{}, false // Already ISO 8601
+		}
+		return date(t, ""), true
+	}
+	if len(m[1]) > 2 || len(m[5]) == 3 {
+		return Hint{}, false
+	}
+
+	year, _ := strconv.Atoi(m[5])
+	if len(m[5]) == 2 {
+		year += 2000
+		if year > today.Year()+10 {
+			year -= 100
+		}
+	}
+	first, _ := strconv.Atoi(m[1])
+	second, _ := strconv.Atoi(m[3])
+
+	dayFirst, dayFirstOK := validDate(year, second, first)
+	monthFirst, monthFirstOK := validDate(year, first, second)
+	monthFirstLocale := l.monthFirst && m[2] != "."
+	switch {
+	case dayFirstOK && monthFirstOK && first != second:
+		if monthFirstLocale {
+			return date(monthFirst, "month/day/year in "+l.tag), true
+		}
+		return date(dayFirst, "day/month/year in "+l.tag), true
+	case monthFirstOK && (monthFirstLocale || !dayFirstOK):
+		return date(monthFirst, ""), true
+	case dayFirstOK:
+		return date(dayFirst, ""), true
+	}
+	return Hint{}, false
+}
+
+// calendarDate reads a date written with the month's name. Without a year,
+// the date is in the current year.
+func calendarDate(yearText, monthText, dayText string, today time.Time) (Hint, bool) {
+	year := today.Year()
+	note := ""
+	if yearText != "" {
+		year, _ = strconv.Atoi(yearText)
+	} else {
+		note = "in the current year"
+	}
+	day, _ := strconv.Atoi(dayText)
+	t, ok := validDate(year, int(monthNumber(monthText)), day)
+	if !ok {
+		return Hint{}, false
+	}
+	return date(t, note), true
+}
+
+// quarter reads a calendar quarter, in the current year when yearText is
+// empty.
+func quarter(yearText, quarterText string, today time.Time) Hint {
+	year := today.Year()
+	note := ""
+	if yearText != "" {
+		year, _ = strconv.Atoi(yearText)
+	} else {
+		note = "in the current year"
+	}
+	q, _ := strconv.Atoi(quarterText)
+	start := time.Date(year, time.Month(3*(q-1)+1), 1, 0, 0, 0, 0, time.UTC)
+	return period(start, start.AddDate(0, 3, -1), note)
+}
+
+// periodStart returns the first day of the week, month, quarter, or year
+// holding today.
+func periodStart(unit string, today time.Time, l locale) time.Time {
+	switch unit {
+	case "week":
+		return today.AddDate(0, 0, -((int(today.Weekday()) - int(l.weekStart) + 7) % 7))
+	case "month":
+		return time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case "quarter":
+		return time.Date(today.Year(), (today.Month()-1)/3*3+1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	return time.Date(today.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// addUnits adds n days, weeks, months, quarters, or years to t.
+func addUnits(t time.Time, unit string, n int) time.Time {
+	switch unit {
+	case "day":
+		return t.AddDate(0, 0, n)
+	case "week":
+		return t.AddDate(0, 0, 7*n)
+	case "month":
+		return t.AddDate(0, n, 0)
+	case "quarter":
+		return t.AddDate(0, 3*n, 0)
+	}
+	return t.AddDate(n, 0, 0)
+}
+
+// monthNumber returns the month named by a name or abbreviation matched
+// by monthPattern.
+func monthNumber(name string) time.Month {
+	for month := time.January; month <= time.December; month++ {
+		if strings.HasPrefix(strings.ToLower(month.String()), name[:3]) {
+			return month
+		}
+	}
+	return 0
+}
+
+// validDate returns the date, if year, month, and day make one.
+func validDate(year, month, day int) (time.Time, bool) {
+	t := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	return t, t.Year() == year && int(t.Month()) == month && t.Day() == day
+}
+
+// date is a KindDate hint for t.
+func date(t time.Time, note string) Hint {
+	return Hint{Kind: KindDate, Value: t.Format(time.DateOnly), Note: note}
+}
+
+// period is a KindPeriod hint from start to end, inclusive.
+func period(start, end time.Time, note string) Hint {
+	return Hint{
+		Kind:  KindPeriod,
+		Value: start.Format(time.DateOnly) + "/" + end.Format(time.DateOnly),
+		Start: start.Format(time.DateOnly),
+		End:   end.Format(time.DateOnly),
+		Note:  note,
+	}
+}
@@ -0,0 +1,175 @@
+// Package hints finds dates, periods, and numbers in users' questions and
+// normalizes them for the LLM: "last quarter" becomes the dates it spans,
+// "03/05/2024" a date read in the user's locale, and "1.234,56" the number
+// 1234.56. The model is given the values as hints, so it filters on what
+// the user meant rather than guessing at the calendar or the locale's
+// separators. Relative expressions are recognized in English.
+package hints
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of values.
+const (
+	KindDate   = "date"
+	KindPeriod = "period"
+	KindNumber = "number"
+)
+
+// DefaultLocale is assumed for questions that come without one.
+const DefaultLocale = "en-US"
+
+// Hint is a value in a question, normalized.
+type Hint struct {
+	Text  string `json:"text"`            // As written in the question
+	Kind  string `json:"kind"`            // KindDate, KindPeriod, or KindNumber
+	Value string `json:"value"`           // YYYY-MM-DD, the period's dates, or a plain decimal number
+	Start string `json:"start,omitempty"` // First day of a period
+	End   string `json:"end,omitempty"`   // Last day of a period, inclusive
+	Note  string `json:"note,omitempty"`  // How an ambiguous value was read
+
+	pos, end int // Byte offsets in the question
+}
+
+// Find returns the values in question, in the order they appear, read for
+// locale, a BCP 47 tag such as "de-DE" (DefaultLocale when empty), with
+// relative expressions counted from now. Values already in normal form,
+// such as 2024-03-05 or 42, are left out.
+func Find(question, locale string, now time.Time) []Hint {
+	if locale == "" {
+		locale = DefaultLocale
+	}
+	l := parseLocale(locale)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var found []Hint
+	taken := func(pos, end int) bool {
+		for _, h := range found {
+			if pos < h.end && h.pos < end {
+				return true
+			}
+		}
+		return false
+	}
+	add := func(h Hint) {
+		if !taken(h.pos, h.end) {
+			h.Text = question[h.pos:h.end]
+			found = append(found, h)
+		}
+	}
+
+	// Dates first, so their digits are not read as numbers
+	for _, h := range findDates(question, l, today) {
+		add(h)
+	}
+	for _, h := range findNumbers(question, l) {
+		add(h)
+	}
+
+	sort.Slice(found, func(i, j int) bool { return found[i].pos < found[j].pos })
+	return found
+}
+
+// Prompt describes hints for the system prompt, or returns "" when there
+// are none.
+func Prompt(hints []Hint, locale string, now time.Time) string {
+	if len(hints) == 0 {
+		return ""
+	}
+	if locale == "" {
+		locale = DefaultLocale
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "The question contains these values, read for the user's locale %s; today is %s (%s). Use them when filtering:\n",
+		locale, now.Format(time.DateOnly), now.Weekday())
+	for _, h := range hints {
+		switch h.Kind {
+		case KindPeriod:
+			fmt.Fprintf(&b, "- %q is the period from %s to %s, inclusive", h.Text, h.Start, h.End)
+		default:
+			fmt.Fprintf(&b, "- %q is the %s %s", h.Text, h.Kind, h.Value)
+		}
+		if h.Note != "" {
+			fmt.Fprintf(&b, " (%s)", h.Note)
+		}
+		b.WriteByte('\n')
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// locale holds the conventions values are read by.
+type locale struct {
+	tag        string
+	decimal    byte // '.' or ','
+	monthFirst bool // Numeric dates are month/day/year
+	weekStart  time.Weekday
+}
+
+// commaDecimal lists the languages that write decimals with a comma.
+var commaDecimal = map[string]bool{
+	"az": true, "be": true, "bg": true, "ca": true, "cs": true, "da": true,
+	"de": true, "el": true, "es": true, "et": true, "eu": true, "fi": true,
+	"fr": true, "gl": true, "hr": true, "hu": true, "id": true, "it": true,
+	"kk": true, "lt": true, "lv": true, "nb": true, "nl": true, "nn": true,
+	"no": true, "pl": true, "pt": true, "ro": true, "ru": true, "sk": true,
+	"sl": true, "sr": true, "sv": true, "tr": true, "uk": true, "vi": true,
+}
+
+// dotDecimalRegions write decimals with a dot whatever the language, as in
+// de-CH or es-MX.
+var dotDecimalRegions = map[string]bool{"CH": true, "LI": true, "MX": true, "US": true, "PR": true}
+
+// monthFirstRegions write numeric dates month first.
+var monthFirstRegions = map[string]bool{"US": true, "PH": true, "FM": true}
+
+// sundayRegions start the week on Sunday.
+var sundayRegions = map[string]bool{"US": true, "CA": true, "JP": true, "BR": true, "MX": true, "IL": true, "PH": true}
+
+// parseLocale reads the conventions of a BCP 47 tag from its language and
+// region subtags, and the first day of the week from a Unicode "fw"
+// extension such as "en-GB-u-fw-sun".
+func parseLocale(tag string) locale {
+	parts := strings.FieldsFunc(tag, func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 {
+		parts = []string{"en"}
+	}
+	language, region, firstDay := strings.ToLower(parts[0]), "", ""
+	for i := 1; i < len(parts); i++ {
+		part := strings.ToLower(parts[i])
+		if len(part) == 1 {
+			// Extensions follow the language, script, and region
+			for ; i < len(parts)-1; i++ {
+				if strings.EqualFold(parts[i], "fw") {
+					firstDay = strings.ToLower(parts[i+1])
+				}
+			}
+			break
+		}
+		if len(part) == 2 && region == "" {
+			region = strings.ToUpper(part)
+		}
+	}
+
+	l := locale{tag: tag, decimal: '.', weekStart: time.Monday}
+	if commaDecimal[language] && !dotDecimalRegions[region] {
+		l.decimal = ','
+	}
+	if region == "" && language == "en" {
+		region = "US"
+	}
+	l.monthFirst = monthFirstRegions[region]
+	if sundayRegions[region] {
+		l.weekStart = time.Sunday
+	}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if firstDay == strings.ToLower(day.String()[:3]) {
+			l.weekStart = day
+		}
+	}
+	return l
+}
@@ -0,0 +1,120 @@
+package hints
+
+import (
+	"regexp"
+	"strings"
+)
+
+// numberPattern matches digits with separators between them: dots,
+// commas, apostrophes, and no-break spaces. Plain numbers need no hint.
+var numberPattern = regexp.MustCompile(`[-+]?\d[\d.,'’\x{00A0}\x{202F}]*\d`)
+
+// findNumbers returns the numbers in question written with grouping or a
+// decimal comma.
+func findNumbers(question string, l locale) []Hint {
+	var hints []Hint
+	for _, loc := range numberPattern.FindAllStringIndex(question, -1) {
+		// Skip digits that are part of a word, version, or address
+		if loc[0] > 0 && isNumberRune(question[loc[0]-1]) || loc[1] < len(question) && isWordByte(question[loc[1]]) {
+			continue
+		}
+		text := question[loc[0]:loc[1]]
+		value, ok := parseNumber(text, l)
+		if !ok || value == strings.TrimPrefix(text, "+") {
+			continue
+		}
+		hints = append(hints, Hint{Kind: KindNumber, Value: value, pos: loc[0], end: loc[1]})
+	}
+	return hints
+}
+
+// parseNumber reads text as a number in the locale's notation and returns
+// it as a plain decimal. When both a dot and a comma appear, the last is
+// the decimal separator. A lone separator is the locale's decimal
+// separator, or otherwise groups thousands when three digits follow it; a
+// lone comma in a dot-decimal locale is more likely a list than a decimal.
+func parseNumber(text string, l locale) (string, bool) {
+	sign := ""
+	switch text[0] {
+	case '-':
+		sign, text = "-", text[1:]
+	case '+':
+		text = text[1:]
+	}
+
+	// Apostrophes and spaces only ever group digits
+	grouped := strings.NewReplacer("'", "_", "’", "_", "\u00a0", "_", "\u202f", "_").Replace(text)
+	var group, decimal string
+	dots, commas := strings.Count(grouped, "."), strings.Count(grouped, ",")
+	switch {
+	case grouped != text:
+		group = "_"
+		if dots+commas > 1 {
+			return "", false
+		}
+		if dots == 1 {
+			decimal = "."
+		} else if commas == 1 {
+			decimal = ","
+		}
+	case dots > 0 && commas > 0:
+		decimal, group = ",", "."
+		if strings.LastIndex(grouped, ".") > strings.LastIndex(grouped, ",") {
+			decimal, group = ".", ","
+		}
+	case dots+commas > 1:
+		group = "."
+		if commas > 0 {
+			group = ","
+		}
+	case dots+commas == 1:
+		separator := "."
+		if commas > 0 {
+			separator = ","
+		}
+		after := len(grouped) - strings.Index(grouped, separator) - 1
+		switch {
+		case separator == string(l.decimal):
+			decimal = separator
+		case after == 3:
+			group = separator
+		default:
+			return "", false
+		}
+	}
+
+	integer, fraction := grouped, ""
+	if decimal != "" {
+		i := strings.LastIndex(grouped, decimal)
+		integer, fraction = grouped[:i], grouped[i+1:]
+	}
+	if strings.ContainsAny(fraction, "._,") {
+		return "", false
+	}
+	groups := []string{integer}
+	if group != "" {
+		groups = strings.Split(integer, group)
+	}
+	for i, g := range groups {
+		if g == "" || strings.ContainsAny(g, "._,") || (i == 0 && len(groups) > 1 && len(g) > 3) || (i > 0 && len(g) != 3) {
+			return "", false
+		}
+	}
+
+	value := sign + strings.Join(groups, "")
+	if fraction != "" {
+		value += "." + fraction
+	}
+	return value, true
+}
+
+// isNumberRune reports whether b continues a word or number, so digits
+// after it are not a number of their own.
+func isNumberRune(b byte) bool {
+	return isWordByte(b) || b == '.' || b == ','
+}
+
+// isWordByte reports whether b is an ASCII letter, digit, or underscore.
+func isWordByte(b byte) bool {
+	return b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || b == '_'
+}
@@ -0,0 +1,226 @@
+// Package history keeps each user's query history: the questions they asked
+// in chat and the queries that answered them, so past questions can be
+// revisited and run again without asking the LLM.
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"data-chatter/internal/encryption"
+)
+
+// entryLimit bounds how many entries are kept per user; the oldest are
+// dropped first.
+const entryLimit = 500
+
+// ErrNotFound is returned for unknown entry IDs, including those of other users.
+var ErrNotFound = errors.New("history entry not found")
+
+// Query is one tool call that helped answer a question.
+type Query struct {
+	Tool  string                 `json:"tool"`
+	SQL   string                 `json:"sql,omitempty"`
+	Input map[string]interface{} `json:"input"`
+}
+
+// Entry is a question and the queries that answered it.
+type Entry struct {
+	ID             string    `json:"id"`
+	Prompt         string    `json:"prompt"`
+	Queries        []Query   `json:"queries"`
+	ConversationID string    `json:"conversation_id,omitempty"`
+	TurnID         string    `json:"turn_id,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Store holds every user's history, optionally persisted to a JSON file so
+// it survives restarts.
+type Store struct {
+	mu    sync.RWMutex
+	path  string
+	keys  *encryption.Keyring
+	users map[string][]Entry // oldest first
+}
+
+// NewStoreFromEnv creates a store persisted to QUERY_HISTORY_FILE, loading
+// any history already in the file. The store is kept in memory only when the
+// variable is unset. With keys the file is encrypted, and a file written
+// in plaintext or with an older key is rewritten with the current key.
+func NewStoreFromEnv(keys *encryption.Keyring) (*Store, error) {
+	store := &Store{path: os.Getenv("QUERY_HISTORY_FILE"), keys: keys, users: make(map[string][]Entry)}
+	if store.path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read query history: %w", err)
+	}
+	plaintext, err := keys.Open(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt query history: %w", err)
+	}
+	if err := json.Unmarshal([]byte(plaintext), &store.users); err != nil {
+		return nil, fmt.Errorf("failed to parse query history: %w", err)
+	}
+	if !keys.Current(string(data)) {
+		if err := store.save(); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+// Add records an entry in userID's history, dropping their oldest entry when
+// the history is full.
+func (s *Store) Add(userID string, entry Entry) (Entry, error) {
+	if s == nil {
+		return Entry{}, nil
+	}
+	entry.ID = newID()
+	entry.CreatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.users[userID]
+	entries := append(append([]Entry{}, previous...), entry)
+	if len(entries) > entryLimit {
+		entries = entries[len(entries)-entryLimit:]
+	}
+	s.users[userID] = entries
+	if err := s.save(); err != nil {
+		s.users[userID] = previous
+		return Entry{}, err
+	}
+	return entry, nil
+}
+
+// List returns up to limit of userID's entries, newest first. A non-empty
+// search keeps only entries whose prompt or SQL contains it, ignoring case.
+func (s *Store) List(userID, search string, limit int) []Entry {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	search = strings.ToLower(search)
+	entries := s.users[userID]
+	var listed []Entry
+	for i := len(entries) - 1; i >= 0 && len(listed) < limit; i-- {
+		if search == "" || entries[i].matches(search) {
+			listed = append(listed, entries[i])
+		}
+	}
+	return listed
+}
+
+// Get returns the entry with id from userID's history.
+func (s *Store) Get(userID, id string) (Entry, error) {
+	if s == nil {
+		return Entry{}, ErrNotFound
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, entry := range s.users[userID] {
+		if entry.ID == id {
+			return entry, nil
+		}
+	}
+	return Entry{}, ErrNotFound
+}
+
+// All returns every user's history, oldest first, keyed by user ID.
+func (s *Store) All() map[string][]Entry {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make(map[string][]Entry, len(s.users))
+	for userID, entries := range s.users {
+		if len(entries) > 0 {
+			all[userID] = append([]Entry{}, entries...)
+		}
+	}
+	return all
+}
+
+// Replace swaps every user's history for all, as when restoring a backup.
+func (s *Store) Replace(all map[string][]Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.users
+	s.users = make(map[string][]Entry, len(all))
+	for userID, entries := range all {
+		if len(entries) > entryLimit {
+			entries = entries[len(entries)-entryLimit:]
+		}
+		s.users[userID] = append([]Entry{}, entries...)
+	}
+	if err := s.save(); err != nil {
+		s.users = previous
+		return err
+	}
+	return nil
+}
+
+// matches reports whether the lowercase search appears in the entry's
+// prompt or SQL.
+func (e Entry) matches(search string) bool {
+	if strings.Contains(strings.ToLower(e.Prompt), search) {
+		return true
+	}
+	for _, query := range e.Queries {
+		if strings.Contains(strings.ToLower(query.SQL), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// save writes every user's history to the store's file, if it has one,
+// replacing the file atomically. Callers must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(s.users)
+	if err != nil {
+		return fmt.Errorf("failed to encode query history: %w", err)
+	}
+	sealed, err := s.keys.Seal(string(data))
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sealed), 0o600); err != nil {
+		return fmt.Errorf("failed to write query history: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write query history: %w", err)
+	}
+	return nil
+}
+
+// newID returns a random entry ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,681 @@
+// Package jobs runs direct database queries, tool calls, and exports in the
+// background on a bounded pool of workers, for analytical queries that take
+// longer than an HTTP request may and for bursts of tool calls that would
+// otherwise saturate database connections. Each job's status and result are
+// kept for polling, and the finished job is POSTed to the caller's callback
+// URL, if it gave one. With a Store, jobs are persisted and leased, so those
+// left unfinished by a restart or a crashed instance are run again, and
+// exports resume from their last checkpoint.
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"data-chatter/internal/auth"
+	"data-chatter/internal/env"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/safehttp"
+	"data-chatter/internal/types"
+)
+
+// Job kinds.
+const (
+	KindQuery  = "query"
+	KindTools  = "tools"
+	KindExport = "export"
+)
+
+// Job statuses.
+const (
+	Queued    = "queued"
+	Running   = "running"
+	Succeeded = "succeeded"
+	Failed    = "failed"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of a callback body, keyed with
+// JOB_CALLBACK_SECRET, as "sha256=<hex>".
+const SignatureHeader = "X-Signature"
+
+// callbackAttempts is how many times a callback is sent before giving up;
+// only connection failures and 5xx responses are retried.
+const callbackAttempts = 3
+
+var (
+	// ErrNotFound is returned for unknown job IDs, including those of other
+	// users and jobs past their retention.
+	ErrNotFound = errors.New("job not found")
+
+	// ErrInvalid is returned for jobs with an unusable callback URL or a
+	// kind no runner handles.
+	ErrInvalid = errors.New("invalid job")
+
+	// ErrQueueFull is returned when every worker is busy and the queue holds
+	// JOB_QUEUE_SIZE jobs already.
+	ErrQueueFull = errors.New("job queue is full")
+)
+
+// Job is a query or a batch of tool calls run in the background.
+type Job struct {
+	ID          string             `json:"id"`
+	Kind        string             `json:"kind"`
+	Status      string             `json:"status"`
+	Query       string             `json:"query,omitempty"`  // KindQuery and KindExport
+	Tools       []types.ToolCall   `json:"tools,omitempty"`  // KindTools
+	Export      *Export            `json:"export,omitempty"` // KindExport
+	CallbackURL string             `json:"callback_url,omitempty"`
+	Result      json.RawMessage    `json:"result,omitempty"`  // KindQuery: database_query payload
+	Results     []types.ToolResult `json:"results,omitempty"` // KindTools: one per call
+	Error       *types.ToolError   `json:"error,omitempty"`
+	Callback    *Delivery          `json:"callback,omitempty"`
+	RequestID   string             `json:"request_id,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	StartedAt   *time.Time         `json:"started_at,omitempty"`
+	FinishedAt  *time.Time         `json:"finished_at,omitempty"`
+
+	owner  string
+	user   *auth.User
+	tenant string
+	locale string
+}
+
+// Export is what an export job writes and how far it has got. It is
+// checkpointed after each part is stored, so its progress can be polled and
+// an export interrupted by a restart resumes after its last stored part.
+type Export struct {
+	Key      []string `json:"key"`       // Columns the rows are paged by, in order
+	Format   string   `json:"format"`    // csv or jsonl
+	PartRows int      `json:"part_rows"` // Rows per stored part
+
+	Rows    int64           `json:"rows"`              // Rows stored so far
+	Parts   int             `json:"parts"`             // Parts stored so far
+	Bytes   int64           `json:"bytes"`             // Bytes stored so far
+	After   json.RawMessage `json:"after,omitempty"`   // Key of the last row stored, as a JSON array
+	Retries int             `json:"retries,omitempty"` // Pages retried after losing the connection
+}
+
+// Delivery is the outcome of posting a finished job to its callback URL.
+type Delivery struct {
+	Attempts    int        `json:"attempts"`
+	StatusCode  int        `json:"status_code,omitempty"`
+	Error       string     `json:"error,omitempty"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// Outcome is what a job's work produced: Result for a query, Results for
+// tool calls, or Error when the job failed as a whole.
+type Outcome struct {
+	Result  json.RawMessage
+	Results []types.ToolResult
+	Error   *types.ToolError
+}
+
+// Runner performs a job of one kind from its Query, Tools, or Export. It
+// must honor ctx, which carries the job's timeout and the submitter's user
+// and request ID.
+type Runner func(ctx context.Context, job Job) Outcome
+
+// task is a queued job with the context it runs in.
+type task struct {
+	ctx context.Context
+	job *Job
+}
+
+// Manager runs jobs on a fixed pool of workers, and jobs of dedicated kinds
+// on pools of their own, and keeps them until their retention ends. Jobs
+// live in memory only and are lost on restart, unless Persist gives the
+// manager a store.
+type Manager struct {
+	timeout   time.Duration
+	timeouts  map[string]time.Duration
+	queues    map[string]chan task
+	retention time.Duration
+	lease     time.Duration
+	secret    []byte
+	backoff   time.Duration
+	client    *http.Client
+	allowed   []string
+	queue     chan task
+	holder    string
+	store     *Store
+	route     func(ctx context.Context, tenant string) (context.Context, error)
+	stop      chan struct{}
+	done      chan struct{}
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	runners map[string]Runner
+}
+
+// NewManagerFromEnv creates a manager and starts its workers. It reads
+// JOB_WORKERS (concurrent jobs, default 4), JOB_QUEUE_SIZE (jobs waiting
+// for a worker, default 100), JOB_TIMEOUT (per job, default 10m),
+// JOB_RETENTION (how long finished jobs are kept, default 1h),
+// JOB_LEASE (how long a persisted job stays claimed by an instance that
+// stops renewing it, default 30s), JOB_CALLBACK_SECRET (signs callbacks
+// when set), and JOB_CALLBACK_ALLOWED_HOSTS (private hosts callbacks may be
+// sent to).
+func NewManagerFromEnv() *Manager {
+	m := &Manager{
+		timeout:   10 * time.Minute,
+		retention: time.Hour,
+		lease:     30 * time.Second,
+		secret:    []byte(os.Getenv("JOB_CALLBACK_SECRET")),
+		backoff:   time.Second,
+		allowed:   env.List("JOB_CALLBACK_ALLOWED_HOSTS", nil),
+		holder:    newID(),
+		timeouts:  make(map[string]time.Duration),
+		queues:    make(map[string]chan task),
+		jobs:      make(map[string]*Job),
+		runners:   make(map[string]Runner),
+	}
+	m.client = safehttp.NewClient(10*time.Second, m.allowed)
+	workers, queueSize := 4, 100
+	if value, err := strconv.Atoi(os.Getenv("JOB_WORKERS")); err == nil && value > 0 {
+		workers = value
+	}
+	if value, err := strconv.Atoi(os.Getenv("JOB_QUEUE_SIZE")); err == nil && value >= 0 {
+		queueSize = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("JOB_TIMEOUT")); err == nil && value > 0 {
+		m.timeout = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("JOB_RETENTION")); err == nil && value > 0 {
+		m.retention = value
+	}
+	if value, err := time.ParseDuration(os.Getenv("JOB_LEASE")); err == nil && value > 0 {
+		m.lease = value
+	}
+
+	m.queue = make(chan task, queueSize)
+	for range workers {
+		go m.worker()
+	}
+	return m
+}
+
+// Handle sets the runner for jobs of kind. Runners must be set before jobs
+// of their kind are submitted or recovered.
+func (m *Manager) Handle(kind string, run Runner) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runners[kind] = run
+}
+
+// Dedicate runs jobs of kind on workers of their own, with a queue as long
+// as the shared one, so long jobs such as exports neither wait behind nor
+// hold up queries and tool calls. They time out after timeout instead of
+// JOB_TIMEOUT. Call it before jobs of kind are submitted or recovered.
+func (m *Manager) Dedicate(kind string, workers int, timeout time.Duration) {
+	queue := make(chan task, cap(m.queue))
+	m.mu.Lock()
+	m.queues[kind] = queue
+	m.timeouts[kind] = timeout
+	m.mu.Unlock()
+	for range workers {
+		go func() {
+			for t := range queue {
+				m.execute(t)
+			}
+		}()
+	}
+}
+
+// Checkpoint records how far the running export job with id has got, and
+// saves it when jobs are persisted.
+func (m *Manager) Checkpoint(ctx context.Context, id string, export Export) {
+	m.mu.Lock()
+	job, ok := m.jobs[id]
+	m.mu.Unlock()
+	if ok {
+		m.update(ctx, job, func(j *Job) { j.Export = &export })
+	}
+}
+
+// Persist keeps jobs in store from now on, so they can be polled on any
+// instance and survive restarts, and starts leasing: this instance renews
+// the leases on its unfinished jobs and claims jobs whose leases expired,
+// such as those of an instance that crashed or was redeployed, to run them
+// again, from the start or, for exports, from their last checkpoint. Call
+// Close on shutdown to hand back its jobs.
+func (m *Manager) Persist(store *Store) {
+	m.store = store
+	m.stop, m.done = make(chan struct{}), make(chan struct{})
+	go m.maintain()
+}
+
+// RouteTenants sets how a recovered job submitted by a tenant's user is
+// routed back to that tenant, such as to its database. Without it such jobs
+// fail rather than run against the default database. Call it before Persist.
+func (m *Manager) RouteTenants(route func(ctx context.Context, tenant string) (context.Context, error)) {
+	m.route = route
+}
+
+// Close stops leasing and releases this instance's unfinished jobs, so
+// other instances, or this one after a restart, pick them up at once.
+func (m *Manager) Close(ctx context.Context) error {
+	if m.store == nil {
+		return nil
+	}
+	close(m.stop)
+	<-m.done
+	return m.store.release(ctx, m.holder)
+}
+
+// Submit queues job, with its Kind and Query, Tools, or Export set, for
+// owner and returns it at once; the runner for its kind runs it when a
+// worker is free. The job keeps ctx's values, such as the request ID and
+// caller, but not its cancellation, so it outlives the request that
+// submitted it. When the queue is full the job is rejected with
+// ErrQueueFull.
+func (m *Manager) Submit(ctx context.Context, owner string, job Job) (Job, error) {
+	if err := checkCallbackURL(job.CallbackURL, m.allowed); err != nil {
+		return Job{}, err
+	}
+	if m.runner(job.Kind) == nil {
+		return Job{}, fmt.Errorf("%w: unknown kind %q", ErrInvalid, job.Kind)
+	}
+
+	queued := &job
+	queued.ID = newID()
+	queued.Status = Queued
+	queued.RequestID = requestid.FromContext(ctx)
+	queued.CreatedAt = time.Now().UTC()
+	queued.owner = owner
+	queued.user = auth.UserFromContext(ctx)
+	queued.tenant = auth.TenantID(ctx)
+	queued.locale = types.CallContextFrom(ctx).Locale
+
+	// The job is saved before it is queued so a worker never updates a job
+	// the store does not have yet
+	if m.store != nil {
+		if err := m.store.insert(ctx, queued, m.holder, time.Now().Add(m.lease)); err != nil {
+			return Job{}, err
+		}
+	}
+
+	if !m.enqueue(task{ctx: context.WithoutCancel(ctx), job: queued}) {
+		if m.store != nil {
+			if err := m.store.delete(ctx, queued.ID); err != nil {
+				slog.WarnContext(ctx, "failed to remove rejected job", "job_id", queued.ID, "error", err)
+			}
+		}
+		return Job{}, ErrQueueFull
+	}
+	return *queued, nil
+}
+
+// Get returns owner's job with id. Persisted jobs are read from the store,
+// which has the latest state of jobs running on any instance.
+func (m *Manager) Get(ctx context.Context, owner, id string) (Job, error) {
+	if m.store != nil {
+		job, err := m.store.get(ctx, id)
+		if err != nil {
+			return Job{}, err
+		}
+		if job.owner != owner {
+			return Job{}, ErrNotFound
+		}
+		return *job, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.prune()
+	job, ok := m.jobs[id]
+	if !ok || job.owner != owner {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// Prune deletes persisted jobs past their retention. Every replica sees the
+// same jobs, so it need only run on one of them at a time.
+func (m *Manager) Prune(ctx context.Context) error {
+	if m.store == nil {
+		return nil
+	}
+	return m.store.prune(ctx, time.Now().Add(-m.retention))
+}
+
+// enqueue hands t to the workers and tracks its job, reporting false when
+// the queue is full.
+func (m *Manager) enqueue(t task) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queue, ok := m.queues[t.job.Kind]
+	if !ok {
+		queue = m.queue
+	}
+	select {
+	case queue <- t:
+	default:
+		return false
+	}
+	m.prune()
+	m.jobs[t.job.ID] = t.job
+	return true
+}
+
+// runner returns the runner for kind, or nil.
+func (m *Manager) runner(kind string) Runner {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.runners[kind]
+}
+
+// worker runs queued jobs one at a time.
+func (m *Manager) worker() {
+	for t := range m.queue {
+		m.execute(t)
+	}
+}
+
+// execute runs a job's work and delivers the finished job to its callback
+// URL. Delivery happens off the worker, so slow callbacks do not hold up the
+// queue.
+func (m *Manager) execute(t task) {
+	m.update(t.ctx, t.job, func(j *Job) {
+		started := time.Now().UTC()
+		j.Status, j.StartedAt = Running, &started
+	})
+
+	m.mu.Lock()
+	timeout, ok := m.timeouts[t.job.Kind]
+	m.mu.Unlock()
+	if !ok {
+		timeout = m.timeout
+	}
+	ctx, cancel := context.WithTimeout(t.ctx, timeout)
+	outcome := m.runner(t.job.Kind)(ctx, *t.job)
+	cancel()
+
+	finished := m.update(t.ctx, t.job, func(j *Job) {
+		now := time.Now().UTC()
+		j.FinishedAt = &now
+		j.Status = Succeeded
+		if outcome.Error != nil {
+			j.Status = Failed
+		}
+		j.Result, j.Results, j.Error = outcome.Result, outcome.Results, outcome.Error
+	})
+	slog.InfoContext(t.ctx, "job finished", "job_id", finished.ID, "kind", finished.Kind, "status", finished.Status)
+
+	if finished.CallbackURL != "" {
+		go func() {
+			delivery := m.deliver(t.ctx, finished)
+			m.update(t.ctx, t.job, func(j *Job) { j.Callback = &delivery })
+		}()
+	}
+}
+
+// QueryOutcome converts a database_query tool result into a job outcome.
+func QueryOutcome(result *types.ToolResult) Outcome {
+	switch {
+	case result == nil:
+		return Outcome{Error: &types.ToolError{Code: types.ErrorExecution, Message: "query returned no result"}}
+	case result.IsError:
+		if result.Error == nil && len(result.Content) > 0 {
+			return Outcome{Error: &types.ToolError{Code: types.ErrorExecution, Message: result.Content[0].Text}}
+		}
+		return Outcome{Error: result.Error}
+	case len(result.Content) > 0:
+		return Outcome{Result: json.RawMessage(result.Content[0].Text)}
+	}
+	return Outcome{}
+}
+
+// deliver POSTs the finished job to its callback URL, retrying connection
+// failures and 5xx responses with a doubling backoff until ctx is done.
+func (m *Manager) deliver(ctx context.Context, job Job) Delivery {
+	body, err := json.Marshal(job)
+	if err != nil {
+		return Delivery{Error: err.Error()}
+	}
+
+	var delivery Delivery
+	backoff := m.backoff
+	for delivery.Attempts < callbackAttempts {
+		if delivery.Attempts > 0 {
+			if err := wait(ctx, backoff); err != nil {
+				delivery.Error = err.Error()
+				break
+			}
+			backoff *= 2
+		}
+		delivery.Attempts++
+
+		status, err := m.post(ctx, job.CallbackURL, body)
+		delivery.StatusCode, delivery.Error = status, ""
+		switch {
+		case err != nil:
+			delivery.Error = err.Error()
+			continue
+		case status >= 500:
+			delivery.Error = fmt.Sprintf("callback returned status %d", status)
+			continue
+		case status < 200 || status > 299:
+			delivery.Error = fmt.Sprintf("callback returned status %d", status)
+		default:
+			now := time.Now().UTC()
+			delivery.DeliveredAt = &now
+		}
+		break
+	}
+
+	if delivery.DeliveredAt == nil {
+		slog.WarnContext(ctx, "job callback failed", "job_id", job.ID, "attempts", delivery.Attempts, "error", delivery.Error)
+	}
+	return delivery
+}
+
+// wait pauses for d, returning early with ctx's error once ctx is done.
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// post sends one callback request and returns the response status. The
+// client refuses loopback, private, and link-local addresses, other than
+// JOB_CALLBACK_ALLOWED_HOSTS, and returns redirects as they are, so a
+// callback is never sent anywhere but the URL the caller gave.
+func (m *Manager) post(ctx context.Context, callbackURL string, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	if len(m.secret) > 0 {
+		mac := hmac.New(sha256.New, m.secret)
+		mac.Write(body)
+		req.Header.Set(SignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// update applies change to job under the lock, saves it when jobs are
+// persisted, and returns a copy.
+func (m *Manager) update(ctx context.Context, job *Job, change func(*Job)) Job {
+	m.mu.Lock()
+	change(job)
+	updated := *job
+	m.mu.Unlock()
+
+	if m.store != nil {
+		if err := m.store.save(ctx, &updated); err != nil {
+			slog.WarnContext(ctx, "failed to persist job", "job_id", updated.ID, "error", err)
+		}
+	}
+	return updated
+}
+
+// maintain renews this instance's leases and claims abandoned jobs every
+// third of a lease until Close.
+func (m *Manager) maintain() {
+	defer close(m.done)
+
+	ticker := time.NewTicker(m.lease / 3)
+	defer ticker.Stop()
+	for {
+		ctx := context.Background()
+		if err := m.store.renew(ctx, m.holder, time.Now().Add(m.lease)); err != nil {
+			slog.Warn("job lease renewal failed", "error", err)
+		}
+		m.recover(ctx)
+
+		select {
+		case <-m.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recover claims unfinished jobs whose leases expired, as many as the queues
+// have room for, and queues them to run again.
+func (m *Manager) recover(ctx context.Context) {
+	room := cap(m.queue) - len(m.queue)
+	m.mu.Lock()
+	for _, queue := range m.queues {
+		room += cap(queue) - len(queue)
+	}
+	m.mu.Unlock()
+	if room <= 0 {
+		return
+	}
+	abandoned, holders, err := m.store.expired(ctx, time.Now(), room)
+	if err != nil {
+		slog.Warn("job recovery failed", "error", err)
+		return
+	}
+
+	for i, job := range abandoned {
+		claimed, err := m.store.claim(ctx, job.ID, holders[i], m.holder, time.Now().Add(m.lease))
+		if err != nil {
+			slog.Warn("job recovery failed", "job_id", job.ID, "error", err)
+			continue
+		}
+		if !claimed {
+			continue // another instance got there first
+		}
+
+		t := task{ctx: job.context(), job: job}
+		failure := ""
+		if m.runner(job.Kind) == nil {
+			failure = fmt.Sprintf("no runner for job kind %q", job.Kind)
+		} else if job.tenant != "" {
+			if m.route == nil {
+				failure = fmt.Sprintf("tenant %q is not configured", job.tenant)
+			} else if t.ctx, err = m.route(t.ctx, job.tenant); err != nil {
+				failure = err.Error()
+			}
+		}
+		if failure != "" {
+			m.update(t.ctx, job, func(j *Job) {
+				now := time.Now().UTC()
+				j.Status, j.FinishedAt = Failed, &now
+				j.Error = &types.ToolError{Code: types.ErrorExecution, Message: failure}
+			})
+			continue
+		}
+		m.update(t.ctx, job, func(j *Job) { j.Status, j.StartedAt = Queued, nil })
+		if !m.enqueue(t) {
+			// Hand the job back for whichever instance has room first
+			if _, err := m.store.claim(ctx, job.ID, m.holder, m.holder, time.UnixMilli(0)); err != nil {
+				slog.Warn("failed to release job", "job_id", job.ID, "error", err)
+			}
+			return
+		}
+		slog.InfoContext(t.ctx, "job recovered", "job_id", job.ID, "kind", job.Kind, "previous_holder", holders[i])
+	}
+}
+
+// context rebuilds the values a recovered job was submitted with: its
+// request ID, user, tenant, and locale.
+func (j *Job) context() context.Context {
+	ctx := requestid.NewContext(context.Background(), j.RequestID)
+	if j.user != nil {
+		ctx = auth.WithUser(ctx, j.user, "")
+	}
+	if j.tenant != "" {
+		ctx = auth.WithTenant(ctx, j.tenant)
+	}
+	if j.locale != "" {
+		ctx = types.WithCallContext(ctx, types.CallContext{Locale: j.locale})
+	}
+	return ctx
+}
+
+// prune drops finished jobs past their retention. Callers must hold m.mu.
+func (m *Manager) prune() {
+	cutoff := time.Now().Add(-m.retention)
+	for id, job := range m.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(m.jobs, id)
+		}
+	}
+}
+
+// checkCallbackURL requires an https URL for the callback, if one is set,
+// whose host is not localhost or a loopback, private, or link-local address
+// unless it is one of allowed. Host names resolving to such addresses are
+// refused when the callback is sent.
+func checkCallbackURL(raw string, allowed []string) error {
+	if raw == "" {
+		return nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme != "https" || parsed.Hostname() == "" {
+		return fmt.Errorf("%w: callback_url must be an https URL", ErrInvalid)
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if slices.ContainsFunc(allowed, func(a string) bool { return strings.EqualFold(a, host) }) {
+		return nil
+	}
+	if ip := net.ParseIP(host); host == "localhost" || strings.HasSuffix(host, ".localhost") || (ip != nil && safehttp.Blocked(ip)) {
+		return fmt.Errorf("%w: callback_url must not point to a local or private address", ErrInvalid)
+	}
+	return nil
+}
+
+// newID returns a random job ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,227 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+	"data-chatter/internal/encryption"
+)
+
+// Table is where jobs are persisted. Its dc_ prefix keeps it out of the
+// schema shown to users and the LLM.
+const Table = database.MetadataTablePrefix + "jobs"
+
+// Store persists jobs in the connected database so they survive restarts
+// and can be polled on any instance. Every unfinished job is leased by the
+// instance that will run it; an instance that stops renewing its leases,
+// because it crashed or was redeployed, loses its jobs to the next instance
+// that claims them. Lease times are Unix milliseconds so every dialect
+// compares them the same way.
+type Store struct {
+	conn *database.Connection
+	keys *encryption.Keyring
+}
+
+// record is a job as persisted, with the fields kept from clients.
+type record struct {
+	Job
+	Owner  string     `json:"owner"`
+	User   *auth.User `json:"user,omitempty"`
+	Tenant string     `json:"tenant,omitempty"`
+	Locale string     `json:"locale,omitempty"`
+}
+
+// NewStore creates the jobs table if it does not exist yet. With keys, job
+// bodies, which hold prompts and results, are encrypted.
+func NewStore(ctx context.Context, conn *database.Connection, keys *encryption.Keyring) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	body := "TEXT"
+	if conn.Config.Type == "mysql" {
+		body = "LONGTEXT" // results can exceed TEXT's 64 KB
+	}
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		id           VARCHAR(64) NOT NULL PRIMARY KEY,
+		owner        VARCHAR(255) NOT NULL,
+		status       VARCHAR(16) NOT NULL,
+		body         `+body+` NOT NULL,
+		lease_holder VARCHAR(64) NOT NULL,
+		lease_until  BIGINT NOT NULL,
+		finished_at  BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	return &Store{conn: conn, keys: keys}, nil
+}
+
+// insert saves a new job leased to holder until until.
+func (s *Store) insert(ctx context.Context, job *Job, holder string, until time.Time) error {
+	body, err := s.encodeJob(job)
+	if err != nil {
+		return err
+	}
+	_, err = s.exec(ctx, `INSERT INTO %s (id, owner, status, body, lease_holder, lease_until, finished_at) VALUES (?, ?, ?, ?, ?, ?, 0)`,
+		job.ID, job.owner, job.Status, body, holder, until.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+// save writes a job's current state. A finished job gives up its lease.
+func (s *Store) save(ctx context.Context, job *Job) error {
+	body, err := s.encodeJob(job)
+	if err != nil {
+		return err
+	}
+	var finishedAt int64
+	query := `UPDATE %s SET status = ?, body = ?, finished_at = ? WHERE id = ?`
+	if job.FinishedAt != nil {
+		finishedAt = job.FinishedAt.UnixMilli()
+		query = `UPDATE %s SET status = ?, body = ?, finished_at = ?, lease_holder = '', lease_until = 0 WHERE id = ?`
+	}
+	if _, err := s.exec(ctx, query, job.Status, body, finishedAt, job.ID); err != nil {
+		return fmt.Errorf("failed to save job: %w", err)
+	}
+	return nil
+}
+
+// delete removes the job with id.
+func (s *Store) delete(ctx context.Context, id string) error {
+	if _, err := s.exec(ctx, `DELETE FROM %s WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete job: %w", err)
+	}
+	return nil
+}
+
+// get returns the job with id.
+func (s *Store) get(ctx context.Context, id string) (*Job, error) {
+	var body string
+	err := s.conn.DB.QueryRowContext(ctx, s.statement(`SELECT body FROM %s WHERE id = ?`), id).Scan(&body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job: %w", err)
+	}
+	return s.decodeJob(body)
+}
+
+// claim leases the job with id to holder until until, if it is unfinished
+// and still leased to previous, reporting whether it was. Only one instance
+// can win a claim, since previous no longer matches once one has.
+func (s *Store) claim(ctx context.Context, id, previous, holder string, until time.Time) (bool, error) {
+	result, err := s.exec(ctx, `UPDATE %s SET lease_holder = ?, lease_until = ? WHERE id = ? AND lease_holder = ? AND finished_at = 0`,
+		holder, until.UnixMilli(), id, previous)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim job: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// renew extends every lease holder has on unfinished jobs until until.
+func (s *Store) renew(ctx context.Context, holder string, until time.Time) error {
+	if _, err := s.exec(ctx, `UPDATE %s SET lease_until = ? WHERE lease_holder = ? AND finished_at = 0`, until.UnixMilli(), holder); err != nil {
+		return fmt.Errorf("failed to renew job leases: %w", err)
+	}
+	return nil
+}
+
+// release ends holder's leases at once, so other instances may claim its
+// unfinished jobs without waiting for the leases to expire.
+func (s *Store) release(ctx context.Context, holder string) error {
+	if _, err := s.exec(ctx, `UPDATE %s SET status = ?, lease_until = 0 WHERE lease_holder = ? AND finished_at = 0`, Queued, holder); err != nil {
+		return fmt.Errorf("failed to release job leases: %w", err)
+	}
+	return nil
+}
+
+// expired returns up to limit unfinished jobs whose leases ended before now,
+// each with the instance that held it.
+func (s *Store) expired(ctx context.Context, now time.Time, limit int) ([]*Job, []string, error) {
+	rows, err := s.conn.DB.QueryContext(ctx, s.statement(`SELECT body, lease_holder FROM %s WHERE finished_at = 0 AND lease_until < ? ORDER BY lease_until LIMIT `+fmt.Sprint(limit)), now.UnixMilli())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find abandoned jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []*Job
+	var holders []string
+	for rows.Next() {
+		var body, holder string
+		if err := rows.Scan(&body, &holder); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		job, err := s.decodeJob(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		jobs = append(jobs, job)
+		holders = append(holders, holder)
+	}
+	return jobs, holders, rows.Err()
+}
+
+// prune deletes jobs that finished before cutoff.
+func (s *Store) prune(ctx context.Context, cutoff time.Time) error {
+	if _, err := s.exec(ctx, `DELETE FROM %s WHERE finished_at > 0 AND finished_at < ?`, cutoff.UnixMilli()); err != nil {
+		return fmt.Errorf("failed to prune jobs: %w", err)
+	}
+	return nil
+}
+
+// exec runs a statement written with %s for the table and ? placeholders.
+func (s *Store) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.conn.DB.ExecContext(ctx, s.statement(query), args...)
+}
+
+// statement fills in the table name and the dialect's placeholders.
+func (s *Store) statement(query string) string {
+	query = fmt.Sprintf(query, s.conn.Config.QuoteIdentifier(Table))
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString(s.conn.Config.Placeholder(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// encodeJob serializes a job with its owner, user, tenant, and locale.
+func (s *Store) encodeJob(job *Job) (string, error) {
+	body, err := json.Marshal(record{Job: *job, Owner: job.owner, User: job.user, Tenant: job.tenant, Locale: job.locale})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode job: %w", err)
+	}
+	return s.keys.Seal(string(body))
+}
+
+// decodeJob restores a job serialized by encodeJob.
+func (s *Store) decodeJob(body string) (*Job, error) {
+	body, err := s.keys.Open(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	var r record
+	if err := json.Unmarshal([]byte(body), &r); err != nil {
+		return nil, fmt.Errorf("failed to decode job: %w", err)
+	}
+	job := r.Job
+	job.owner, job.user, job.tenant, job.locale = r.Owner, r.User, r.Tenant, r.Locale
+	return &job, nil
+}
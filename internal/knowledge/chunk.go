@@ -0,0 +1,160 @@
+package knowledge
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxChunkLength bounds a chunk's text, in bytes, so a handful of snippets
+// fit in the prompt next to the schema.
+const maxChunkLength = 1200
+
+// Chunk is a passage of a document, embedded and retrieved on its own.
+type Chunk struct {
+	Position int    `json:"position"`
+	Heading  string `json:"heading,omitempty"` // The headings it is under, e.g. "Contacts > Status"
+	Text     string `json:"text"`
+}
+
+// section is text under one heading.
+type section struct {
+	heading string
+	lines   []string
+}
+
+// chunkMarkdown splits a markdown or plain text document into chunks of
+// whole paragraphs under their headings. Headings inside fenced code blocks
+// are text.
+func chunkMarkdown(text string) []Chunk {
+	var sections []section
+	var path []string // Headings by level, from level 1
+	current := section{}
+	fenced := false
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fenced = !fenced
+		}
+		if level, title := markdownHeading(trimmed); !fenced && level > 0 {
+			sections = append(sections, current)
+			if len(path) >= level {
+				path = path[:level-1]
+			}
+			for len(path) < level-1 {
+				path = append(path, "")
+			}
+			path = append(path, title)
+			current = section{heading: joinHeadings(path)}
+			continue
+		}
+		current.lines = append(current.lines, line)
+	}
+	sections = append(sections, current)
+
+	var chunks []Chunk
+	for _, s := range sections {
+		chunks = appendChunks(chunks, s.heading, paragraphs(s.lines))
+	}
+	return chunks
+}
+
+// chunkPages splits the text of a PDF's pages into chunks, with the page
+// number as each chunk's heading.
+func chunkPages(pages []string) []Chunk {
+	var chunks []Chunk
+	for i, page := range pages {
+		chunks = appendChunks(chunks, "Page "+strconv.Itoa(i+1), paragraphs(strings.Split(page, "\n")))
+	}
+	return chunks
+}
+
+// markdownHeading returns the level and title of an ATX heading such as
+// "## Status", or 0 when line is not one.
+func markdownHeading(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(line) && line[level] != ' ' && line[level] != '\t') {
+		return 0, ""
+	}
+	return level, strings.TrimSpace(strings.TrimRight(strings.TrimSpace(line[level:]), "#"))
+}
+
+// joinHeadings joins the non-empty headings of a path with " > ".
+func joinHeadings(path []string) string {
+	var parts []string
+	for _, heading := range path {
+		if heading != "" {
+			parts = append(parts, heading)
+		}
+	}
+	return strings.Join(parts, " > ")
+}
+
+// paragraphs groups lines into paragraphs separated by blank lines.
+func paragraphs(lines []string) []string {
+	var result []string
+	var current []string
+	flush := func() {
+		if len(current) > 0 {
+			result = append(result, strings.Join(current, "\n"))
+			current = nil
+		}
+	}
+	for _, line := range lines {
+		line = strings.TrimRightFunc(line, unicode.IsSpace)
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		current = append(current, line)
+	}
+	flush()
+	return result
+}
+
+// appendChunks packs paragraphs into chunks of up to maxChunkLength bytes,
+// splitting paragraphs longer than that between words.
+func appendChunks(chunks []Chunk, heading string, paragraphs []string) []Chunk {
+	var b strings.Builder
+	flush := func() {
+		if text := strings.TrimSpace(b.String()); text != "" {
+			chunks = append(chunks, Chunk{Position: len(chunks), Heading: heading, Text: text})
+		}
+		b.Reset()
+	}
+	for _, paragraph := range paragraphs {
+		for _, piece := range splitLong(paragraph) {
+			if b.Len() > 0 && b.Len()+2+len(piece) > maxChunkLength {
+				flush()
+			}
+			if b.Len() > 0 {
+				b.WriteString("\n\n")
+			}
+			b.WriteString(piece)
+		}
+	}
+	flush()
+	return chunks
+}
+
+// splitLong splits text longer than maxChunkLength at the last space
+// before the limit, or at the limit when there is none.
+func splitLong(text string) []string {
+	var pieces []string
+	for len(text) > maxChunkLength {
+		cut := strings.LastIndexAny(text[:maxChunkLength], " \n\t")
+		if cut <= 0 {
+			cut = maxChunkLength
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		pieces = append(pieces, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	return append(pieces, text)
+}
@@ -0,0 +1,508 @@
+// Package knowledge keeps business documentation, such as what makes a
+// contact "active" or how revenue is recognized, and retrieves the passages
+// relevant to each question for the LLM's system prompt. Uploaded markdown,
+// text, and PDF documents are split into chunks under their headings or
+// pages, and each chunk is embedded; a question gets the chunks most
+// similar to it. Documents and their chunks live in the dc_documents and
+// dc_document_chunks tables of the connected database, so every replica
+// retrieves from the same documents.
+package knowledge
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/semantic"
+)
+
+const (
+	// DocumentsTable and ChunksTable are where documents and their chunks
+	// are stored. Their dc_ prefix keeps them out of the schema shown to
+	// users and the LLM.
+	DocumentsTable = database.MetadataTablePrefix + "documents"
+	ChunksTable    = database.MetadataTablePrefix + "document_chunks"
+
+	// MaxBytes bounds an uploaded document.
+	MaxBytes = 10 << 20
+
+	// batchSize bounds the chunks embedded in one request.
+	batchSize = 64
+
+	// defaultLimit and defaultMinSimilarity are used without DOCS_TOP_K and
+	// DOCS_MIN_SIMILARITY.
+	defaultLimit         = 3
+	defaultMinSimilarity = 0.2
+)
+
+// Document formats.
+const (
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+	FormatPDF      = "pdf"
+)
+
+var (
+	// ErrNotFound is returned for unknown documents.
+	ErrNotFound = errors.New("document not found")
+
+	// ErrInvalid is returned for documents that cannot be read.
+	ErrInvalid = errors.New("invalid document")
+)
+
+// Document is an uploaded document. Content holds its chunks when it is
+// read with Get.
+type Document struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Format     string    `json:"format"`
+	Size       int64     `json:"size"`
+	Chunks     int       `json:"chunks"`
+	UploadedBy string    `json:"uploaded_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	Content    []Chunk   `json:"content,omitempty"`
+}
+
+// Snippet is a chunk retrieved for a question.
+type Snippet struct {
+	DocumentID string  `json:"document_id"`
+	Document   string  `json:"document"`
+	Heading    string  `json:"heading,omitempty"`
+	Text       string  `json:"text"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Store keeps documents and retrieves their chunks.
+type Store struct {
+	conn          *database.Connection
+	embedder      semantic.Embedder
+	limit         int
+	minSimilarity float64
+}
+
+// NewStore creates the documents and chunks tables if they do not exist
+// yet. Questions get up to DOCS_TOP_K snippets (default 3; 0 turns
+// retrieval off) at least DOCS_MIN_SIMILARITY similar to them (default
+// 0.2).
+func NewStore(ctx context.Context, conn *database.Connection, embedder semantic.Embedder) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	store := &Store{conn: conn, embedder: embedder, limit: defaultLimit, minSimilarity: defaultMinSimilarity}
+	if value := os.Getenv("DOCS_TOP_K"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid DOCS_TOP_K %q", value)
+		}
+		store.limit = limit
+	}
+	if value := os.Getenv("DOCS_MIN_SIMILARITY"); value != "" {
+		minSimilarity, err := strconv.ParseFloat(value, 64)
+		if err != nil || minSimilarity < 0 || minSimilarity > 1 {
+			return nil, fmt.Errorf("invalid DOCS_MIN_SIMILARITY %q", value)
+		}
+		store.minSimilarity = minSimilarity
+	}
+
+	quote := conn.Config.QuoteIdentifier
+	if _, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+quote(DocumentsTable)+` (
+		id          VARCHAR(64) NOT NULL PRIMARY KEY,
+		name        VARCHAR(255) NOT NULL,
+		format      VARCHAR(16) NOT NULL,
+		size        BIGINT NOT NULL,
+		chunks      INTEGER NOT NULL,
+		uploaded_by VARCHAR(255) NOT NULL,
+		created_at  TIMESTAMP NOT NULL
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", DocumentsTable, err)
+	}
+	if _, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+quote(ChunksTable)+` (
+		document_id VARCHAR(64) NOT NULL,
+		seq         INTEGER NOT NULL,
+		heading     TEXT NOT NULL,
+		content     TEXT NOT NULL,
+		model       VARCHAR(255) NOT NULL,
+		embedding   TEXT NOT NULL,
+		PRIMARY KEY (document_id, seq)
+	)`); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", ChunksTable, err)
+	}
+	return store, nil
+}
+
+// List returns every document, ordered by name.
+func (s *Store) List(ctx context.Context) ([]Document, error) {
+	rows, err := s.conn.DB.QueryContext(ctx, `SELECT id, name, format, size, chunks, uploaded_by, created_at FROM `+
+		s.conn.Config.QuoteIdentifier(DocumentsTable)+` ORDER BY name, id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read documents: %w", err)
+	}
+	defer rows.Close()
+
+	documents := []Document{}
+	for rows.Next() {
+		var doc Document
+		if err := rows.Scan(&doc.ID, &doc.Name, &doc.Format, &doc.Size, &doc.Chunks, &doc.UploadedBy, &doc.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan document: %w", err)
+		}
+		documents = append(documents, doc)
+	}
+	return documents, rows.Err()
+}
+
+// Get returns a document with its chunks.
+func (s *Store) Get(ctx context.Context, id string) (Document, error) {
+	config := s.conn.Config
+	var doc Document
+	err := s.conn.DB.QueryRowContext(ctx, `SELECT id, name, format, size, chunks, uploaded_by, created_at FROM `+
+		config.QuoteIdentifier(DocumentsTable)+` WHERE id = `+config.Placeholder(1), id).
+		Scan(&doc.ID, &doc.Name, &doc.Format, &doc.Size, &doc.Chunks, &doc.UploadedBy, &doc.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Document{}, ErrNotFound
+	}
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to read document: %w", err)
+	}
+
+	rows, err := s.conn.DB.QueryContext(ctx, `SELECT seq, heading, content FROM `+config.QuoteIdentifier(ChunksTable)+
+		` WHERE document_id = `+config.Placeholder(1)+` ORDER BY seq`, id)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to read document chunks: %w", err)
+	}
+	defer rows.Close()
+	doc.Content = []Chunk{}
+	for rows.Next() {
+		var chunk Chunk
+		if err := rows.Scan(&chunk.Position, &chunk.Heading, &chunk.Text); err != nil {
+			return Document{}, fmt.Errorf("failed to scan document chunk: %w", err)
+		}
+		doc.Content = append(doc.Content, chunk)
+	}
+	return doc, rows.Err()
+}
+
+// DetectFormat returns the format of a document from format, when set, or
+// else from the file name's extension and the data.
+func DetectFormat(format, filename string, data []byte) (string, error) {
+	switch strings.ToLower(format) {
+	case FormatMarkdown, "md":
+		return FormatMarkdown, nil
+	case FormatText, "txt":
+		return FormatText, nil
+	case FormatPDF:
+		return FormatPDF, nil
+	case "":
+	default:
+		return "", fmt.Errorf("%w: unsupported format %q (use %s, %s, or %s)", ErrInvalid, format, FormatMarkdown, FormatText, FormatPDF)
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".md", ".markdown":
+		return FormatMarkdown, nil
+	case ".txt", ".text":
+		return FormatText, nil
+	case ".pdf":
+		return FormatPDF, nil
+	}
+	if strings.HasPrefix(string(data), "%PDF-") {
+		return FormatPDF, nil
+	}
+	if filepath.Ext(filename) == "" && utf8.Valid(data) {
+		return FormatMarkdown, nil
+	}
+	return "", fmt.Errorf("%w: cannot tell the format of %q; upload a .md, .txt, or .pdf file", ErrInvalid, filename)
+}
+
+// Add reads, chunks, and embeds a document and saves it, replacing any
+// document of the same name. doc names the document and its format and
+// uploader.
+func (s *Store) Add(ctx context.Context, doc Document, data []byte) (Document, error) {
+	doc.Name = strings.TrimSpace(doc.Name)
+	if doc.Name == "" {
+		return Document{}, fmt.Errorf("%w: a name is required", ErrInvalid)
+	}
+	if len(doc.Name) > 255 {
+		return Document{}, fmt.Errorf("%w: the name is longer than 255 bytes", ErrInvalid)
+	}
+	if len(data) > MaxBytes {
+		return Document{}, fmt.Errorf("%w: the document is larger than %d bytes", ErrInvalid, MaxBytes)
+	}
+
+	var chunks []Chunk
+	switch doc.Format {
+	case FormatPDF:
+		pages, err := extractPDF(data)
+		if err != nil {
+			return Document{}, err
+		}
+		chunks = chunkPages(pages)
+	case FormatMarkdown, FormatText:
+		if !utf8.Valid(data) {
+			return Document{}, fmt.Errorf("%w: %s documents must be UTF-8", ErrInvalid, doc.Format)
+		}
+		chunks = chunkMarkdown(string(data))
+	default:
+		return Document{}, fmt.Errorf("%w: unsupported format %q", ErrInvalid, doc.Format)
+	}
+	if len(chunks) == 0 {
+		return Document{}, fmt.Errorf("%w: the document has no text", ErrInvalid)
+	}
+
+	vectors, err := s.embed(ctx, chunks)
+	if err != nil {
+		return Document{}, err
+	}
+
+	doc.ID = newID()
+	doc.Size = int64(len(data))
+	doc.Chunks = len(chunks)
+	doc.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	doc.Content = nil
+
+	config := s.conn.Config
+	tx, err := s.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to save document: %w", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM `+config.QuoteIdentifier(DocumentsTable)+` WHERE name = `+config.Placeholder(1), doc.Name)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to save document: %w", err)
+	}
+	var replaced []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return Document{}, fmt.Errorf("failed to save document: %w", err)
+		}
+		replaced = append(replaced, id)
+	}
+	rows.Close()
+	for _, id := range replaced {
+		if err := deleteDocument(ctx, tx, config, id); err != nil {
+			return Document{}, err
+		}
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, name, format, size, chunks, uploaded_by, created_at) VALUES (%s)`,
+		config.QuoteIdentifier(DocumentsTable), placeholders(config, 7)),
+		doc.ID, doc.Name, doc.Format, doc.Size, doc.Chunks, doc.UploadedBy, doc.CreatedAt); err != nil {
+		return Document{}, fmt.Errorf("failed to save document: %w", err)
+	}
+	model := s.embedder.Model()
+	insert := fmt.Sprintf(`INSERT INTO %s (document_id, seq, heading, content, model, embedding) VALUES (%s)`,
+		config.QuoteIdentifier(ChunksTable), placeholders(config, 6))
+	for i, chunk := range chunks {
+		if _, err := tx.ExecContext(ctx, insert, doc.ID, chunk.Position, chunk.Heading, chunk.Text, model, semantic.FormatVector(vectors[i])); err != nil {
+			return Document{}, fmt.Errorf("failed to save document chunk: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return Document{}, fmt.Errorf("failed to save document: %w", err)
+	}
+	return doc, nil
+}
+
+// Delete removes a document and its chunks.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	tx, err := s.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	defer tx.Rollback()
+	if err := deleteDocument(ctx, tx, s.conn.Config, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	return nil
+}
+
+// deleteDocument removes a document and its chunks in tx.
+func deleteDocument(ctx context.Context, tx *sql.Tx, config *database.Config, id string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM `+config.QuoteIdentifier(ChunksTable)+` WHERE document_id = `+config.Placeholder(1), id); err != nil {
+		return fmt.Errorf("failed to delete document chunks: %w", err)
+	}
+	result, err := tx.ExecContext(ctx, `DELETE FROM `+config.QuoteIdentifier(DocumentsTable)+` WHERE id = `+config.Placeholder(1), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Reembed embeds again the chunks whose embeddings were made with another
+// model, as after EMBEDDING_PROVIDER or EMBEDDING_MODEL changed. Until then
+// those chunks are not retrieved.
+func (s *Store) Reembed(ctx context.Context) error {
+	config := s.conn.Config
+	model := s.embedder.Model()
+	rows, err := s.conn.DB.QueryContext(ctx, `SELECT document_id, seq, heading, content FROM `+config.QuoteIdentifier(ChunksTable)+
+		` WHERE model <> `+config.Placeholder(1), model)
+	if err != nil {
+		return fmt.Errorf("failed to read document chunks: %w", err)
+	}
+	type stale struct {
+		documentID string
+		chunk      Chunk
+	}
+	var chunks []stale
+	for rows.Next() {
+		var c stale
+		if err := rows.Scan(&c.documentID, &c.chunk.Position, &c.chunk.Heading, &c.chunk.Text); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan document chunk: %w", err)
+		}
+		chunks = append(chunks, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read document chunks: %w", err)
+	}
+
+	update := fmt.Sprintf(`UPDATE %s SET model = %s, embedding = %s WHERE document_id = %s AND seq = %s`,
+		config.QuoteIdentifier(ChunksTable), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3), config.Placeholder(4))
+	for start := 0; start < len(chunks); start += batchSize {
+		batch := chunks[start:min(start+batchSize, len(chunks))]
+		texts := make([]Chunk, len(batch))
+		for i, c := range batch {
+			texts[i] = c.chunk
+		}
+		vectors, err := s.embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		for i, c := range batch {
+			if _, err := s.conn.DB.ExecContext(ctx, update, model, semantic.FormatVector(vectors[i]), c.documentID, c.chunk.Position); err != nil {
+				return fmt.Errorf("failed to save document chunk: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// Retrieve returns the chunks most similar to question, most similar
+// first. It returns nothing when there are no documents or retrieval is
+// off.
+func (s *Store) Retrieve(ctx context.Context, question string) ([]Snippet, error) {
+	if s == nil || s.limit == 0 || strings.TrimSpace(question) == "" {
+		return nil, nil
+	}
+	config := s.conn.Config
+	rows, err := s.conn.DB.QueryContext(ctx, `SELECT c.document_id, d.name, c.heading, c.content, c.embedding FROM `+
+		config.QuoteIdentifier(ChunksTable)+` c JOIN `+config.QuoteIdentifier(DocumentsTable)+` d ON d.id = c.document_id WHERE c.model = `+
+		config.Placeholder(1), s.embedder.Model())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document chunks: %w", err)
+	}
+	defer rows.Close()
+
+	type candidate struct {
+		snippet Snippet
+		vector  []float32
+	}
+	var candidates []candidate
+	for rows.Next() {
+		var c candidate
+		var embedding string
+		if err := rows.Scan(&c.snippet.DocumentID, &c.snippet.Document, &c.snippet.Heading, &c.snippet.Text, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan document chunk: %w", err)
+		}
+		if c.vector, err = semantic.ParseVector(embedding); err != nil {
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read document chunks: %w", err)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+
+	vectors, err := s.embedder.Embed(ctx, []string{question})
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed question: %w", err)
+	}
+	var snippets []Snippet
+	for _, c := range candidates {
+		c.snippet.Similarity = semantic.Similarity(vectors[0], c.vector)
+		if c.snippet.Similarity >= s.minSimilarity {
+			snippets = append(snippets, c.snippet)
+		}
+	}
+	sort.SliceStable(snippets, func(i, j int) bool { return snippets[i].Similarity > snippets[j].Similarity })
+	if len(snippets) > s.limit {
+		snippets = snippets[:s.limit]
+	}
+	return snippets, nil
+}
+
+// Prompt presents snippets for the system prompt, or returns "" when there
+// are none.
+func Prompt(snippets []Snippet) string {
+	if len(snippets) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("These excerpts from the organization's documentation may define terms and business rules in the request. Follow them where they apply:")
+	for _, snippet := range snippets {
+		source := snippet.Document
+		if snippet.Heading != "" {
+			source += " > " + snippet.Heading
+		}
+		fmt.Fprintf(&b, "\n\n[%s]\n%s", source, snippet.Text)
+	}
+	return b.String()
+}
+
+// embed embeds chunks with their headings, in batches.
+func (s *Store) embed(ctx context.Context, chunks []Chunk) ([][]float32, error) {
+	vectors := make([][]float32, 0, len(chunks))
+	for start := 0; start < len(chunks); start += batchSize {
+		batch := chunks[start:min(start+batchSize, len(chunks))]
+		texts := make([]string, len(batch))
+		for i, chunk := range batch {
+			texts[i] = strings.TrimSpace(chunk.Heading + "\n" + chunk.Text)
+		}
+		embedded, err := s.embedder.Embed(ctx, texts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to embed document: %w", err)
+		}
+		vectors = append(vectors, embedded...)
+	}
+	return vectors, nil
+}
+
+// placeholders returns n comma-separated bind placeholders.
+func placeholders(config *database.Config, n int) string {
+	list := make([]string, n)
+	for i := range list {
+		list[i] = config.Placeholder(i + 1)
+	}
+	return strings.Join(list, ", ")
+}
+
+// newID returns a random document ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
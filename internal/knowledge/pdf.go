@@ -0,0 +1,830 @@
+package knowledge
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// PDF text is read without a PDF library: the page tree is walked from the
+// document's catalog, each page's content streams are decompressed, and the
+// text drawn by their text operators is decoded through the font's ToUnicode
+// map or its single-byte encoding. That covers the PDFs word processors and
+// typesetters produce; scanned pages, which are images, have no text.
+
+// maxFormDepth bounds form XObjects drawn inside each other.
+const maxFormDepth = 8
+
+var (
+	objectPattern = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	rootPattern   = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+)
+
+// pdf values, as the lexer reads them. Dictionaries are
+// map[string]interface{} keyed by name without the slash, arrays are
+// []interface{}, and numbers are float64.
+type (
+	pdfName    string
+	pdfString  string // Raw bytes
+	pdfRef     int    // Object number
+	pdfKeyword string // An operator, or true, false, and null
+)
+
+// pdfDocument is a parsed PDF's objects by number.
+type pdfDocument struct {
+	data    []byte
+	objects map[int][]byte // Raw object bodies, between obj and endobj
+	fonts   map[int]*pdfFont
+}
+
+// extractPDF returns the text of each page of the PDF in data.
+func extractPDF(data []byte) ([]string, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return nil, fmt.Errorf("%w: not a PDF file", ErrInvalid)
+	}
+	doc := &pdfDocument{data: data, objects: make(map[int][]byte), fonts: make(map[int]*pdfFont)}
+	doc.readObjects()
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil, fmt.Errorf("%w: encrypted PDFs are not supported", ErrInvalid)
+	}
+
+	matches := rootPattern.FindAllSubmatch(data, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("%w: the PDF has no document catalog", ErrInvalid)
+	}
+	root, _ := strconv.Atoi(string(matches[len(matches)-1][1]))
+	catalog, _ := doc.dict(pdfRef(root))
+
+	var pages []string
+	doc.walkPages(catalog["Pages"], nil, make(map[pdfRef]bool), func(page map[string]interface{}, resources map[string]interface{}) {
+		var text strings.Builder
+		for _, content := range doc.contents(page["Contents"]) {
+			doc.drawText(&text, content, resources, 0)
+		}
+		pages = append(pages, strings.TrimSpace(text.String()))
+	})
+
+	for _, page := range pages {
+		if page != "" {
+			return pages, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: the PDF has no text to read; scanned PDFs are not supported", ErrInvalid)
+}
+
+// readObjects indexes the objects in the file and in its object streams.
+// When an object is defined more than once, as after an incremental
+// update, the last definition wins.
+func (d *pdfDocument) readObjects() {
+	for _, loc := range objectPattern.FindAllSubmatchIndex(d.data, -1) {
+		number, err := strconv.Atoi(string(d.data[loc[2]:loc[3]]))
+		if err != nil {
+			continue
+		}
+		body := d.data[loc[1]:]
+		end := len(body)
+		if i := bytes.Index(body, []byte("endobj")); i >= 0 {
+			end = i
+		}
+		if i := bytes.Index(body[:end], []byte("stream")); i >= 0 {
+			if j := bytes.Index(body[i:], []byte("endstream")); j >= 0 {
+				if k := bytes.Index(body[i+j:], []byte("endobj")); k >= 0 {
+					end = i + j + k
+				}
+			}
+		}
+		d.objects[number] = body[:end]
+	}
+
+	for number, body := range d.objects {
+		dict, ok := parseValue(newLexer(body)).(map[string]interface{})
+		if !ok || dict["Type"] != pdfName("ObjStm") {
+			continue
+		}
+		content, err := d.stream(body, dict)
+		if err != nil {
+			continue
+		}
+		count, _ := dict["N"].(float64)
+		first, _ := dict["First"].(float64)
+		if int(first) > len(content) {
+			continue
+		}
+		header := newLexer(content[:int(first)])
+		var numbers, offsets []int
+		for i := 0; i < int(count); i++ {
+			n, ok1 := header.next().(float64)
+			offset, ok2 := header.next().(float64)
+			if !ok1 || !ok2 {
+				break
+			}
+			numbers, offsets = append(numbers, int(n)), append(offsets, int(first)+int(offset))
+		}
+		for i, n := range numbers {
+			end := len(content)
+			if i+1 < len(offsets) {
+				end = offsets[i+1]
+			}
+			if _, defined := d.objects[n]; !defined && offsets[i] <= end && end <= len(content) && n != number {
+				d.objects[n] = content[offsets[i]:end]
+			}
+		}
+	}
+}
+
+// resolve follows a reference to the value of its object.
+func (d *pdfDocument) resolve(value interface{}) interface{} {
+	for i := 0; i < 8; i++ {
+		ref, ok := value.(pdfRef)
+		if !ok {
+			return value
+		}
+		body, ok := d.objects[int(ref)]
+		if !ok {
+			return nil
+		}
+		value = parseValue(newLexer(body))
+	}
+	return nil
+}
+
+// dict resolves value to a dictionary.
+func (d *pdfDocument) dict(value interface{}) (map[string]interface{}, bool) {
+	dict, ok := d.resolve(value).(map[string]interface{})
+	return dict, ok
+}
+
+// stream returns the decoded data of a stream object. Only unfiltered and
+// FlateDecode streams can be read.
+func (d *pdfDocument) stream(body []byte, dict map[string]interface{}) ([]byte, error) {
+	i := bytes.Index(body, []byte("stream"))
+	if i < 0 {
+		return nil, errors.New("not a stream")
+	}
+	raw := body[i+len("stream"):]
+	raw = bytes.TrimPrefix(raw, []byte("\r"))
+	raw = bytes.TrimPrefix(raw, []byte("\n"))
+	if length, ok := d.resolve(dict["Length"]).(float64); ok && int(length) <= len(raw) && length >= 0 {
+		raw = raw[:int(length)]
+	} else if j := bytes.LastIndex(raw, []byte("endstream")); j >= 0 {
+		raw = bytes.TrimRight(raw[:j], "\r\n")
+	}
+
+	var filters []interface{}
+	switch filter := d.resolve(dict["Filter"]).(type) {
+	case pdfName:
+		filters = []interface{}{filter}
+	case []interface{}:
+		filters = filter
+	}
+	for _, filter := range filters {
+		if filter != pdfName("FlateDecode") {
+			return nil, fmt.Errorf("unsupported filter %v", filter)
+		}
+		r, err := zlib.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		// Truncated streams are common; keep what decompressed
+		decoded, err := io.ReadAll(r)
+		if err != nil && len(decoded) == 0 {
+			return nil, err
+		}
+		raw = decoded
+	}
+	return raw, nil
+}
+
+// streamOf resolves value to a stream and returns its dictionary and data.
+func (d *pdfDocument) streamOf(value interface{}) (map[string]interface{}, []byte, bool) {
+	ref, ok := value.(pdfRef)
+	if !ok {
+		return nil, nil, false
+	}
+	body, ok := d.objects[int(ref)]
+	if !ok {
+		return nil, nil, false
+	}
+	dict, ok := parseValue(newLexer(body)).(map[string]interface{})
+	if !ok {
+		return nil, nil, false
+	}
+	data, err := d.stream(body, dict)
+	return dict, data, err == nil
+}
+
+// walkPages calls visit for each page under node, in order, with the
+// resources it inherits.
+func (d *pdfDocument) walkPages(node interface{}, resources map[string]interface{}, seen map[pdfRef]bool, visit func(page, resources map[string]interface{})) {
+	if ref, ok := node.(pdfRef); ok {
+		if seen[ref] {
+			return
+		}
+		seen[ref] = true
+	}
+	dict, ok := d.dict(node)
+	if !ok {
+		return
+	}
+	if own, ok := d.dict(dict["Resources"]); ok {
+		resources = own
+	}
+	if kids, ok := d.resolve(dict["Kids"]).([]interface{}); ok {
+		for _, kid := range kids {
+			d.walkPages(kid, resources, seen, visit)
+		}
+		return
+	}
+	visit(dict, resources)
+}
+
+// contents returns the decoded content streams of a page.
+func (d *pdfDocument) contents(value interface{}) [][]byte {
+	var refs []interface{}
+	switch contents := value.(type) {
+	case pdfRef:
+		if array, ok := d.resolve(contents).([]interface{}); ok {
+			refs = array
+		} else {
+			refs = []interface{}{contents}
+		}
+	case []interface{}:
+		refs = contents
+	}
+	var streams [][]byte
+	for _, ref := range refs {
+		if _, data, ok := d.streamOf(ref); ok {
+			streams = append(streams, data)
+		}
+	}
+	return streams
+}
+
+// drawText writes the text content draws to b. Lines become line breaks,
+// and gaps between lines taller than a line a blank line, so paragraphs
+// stay apart.
+func (d *pdfDocument) drawText(b *strings.Builder, content []byte, resources map[string]interface{}, depth int) {
+	fonts, _ := d.dict(resources["Font"])
+	xobjects, _ := d.dict(resources["XObject"])
+
+	var font *pdfFont
+	size, leading, y := 10.0, 0.0, 0.0
+	newLine := func(dy float64) {
+		if b.Len() == 0 {
+			return
+		}
+		if size > 0 && math.Abs(dy) > 1.6*size {
+			b.WriteString("\n\n")
+		} else {
+			b.WriteString("\n")
+		}
+	}
+	space := func() {
+		if s := b.String(); len(s) > 0 && !strings.ContainsAny(s[len(s)-1:], " \n") {
+			b.WriteByte(' ')
+		}
+	}
+
+	lex := newLexer(content)
+	var operands []interface{}
+	// operand returns the operand n places before the operator's last one
+	operand := func(n int) interface{} {
+		if i := len(operands) - 1 - n; i >= 0 {
+			return operands[i]
+		}
+		return nil
+	}
+	number := func(n int) float64 {
+		value, _ := operand(n).(float64)
+		return value
+	}
+	for {
+		value := parseValue(lex)
+		if value == nil && lex.done() {
+			return
+		}
+		op, ok := value.(pdfKeyword)
+		if !ok {
+			operands = append(operands, value)
+			continue
+		}
+		switch op {
+		case "Tf":
+			if name, ok := operand(1).(pdfName); ok {
+				font = d.font(fonts[string(name)])
+			}
+			size = math.Abs(number(0))
+		case "TL":
+			leading = number(0)
+		case "Td", "TD":
+			dy := number(0)
+			if op == "TD" {
+				leading = -dy
+			}
+			if dy != 0 {
+				newLine(dy)
+			} else {
+				space()
+			}
+			y += dy
+		case "T*":
+			newLine(leading)
+			y -= leading
+		case "Tm":
+			dy := number(0) - y
+			if dy != 0 {
+				newLine(dy)
+			} else {
+				space()
+			}
+			y = number(0)
+		case "Tj", "'", `"`:
+			if op != "Tj" {
+				newLine(leading)
+			}
+			if s, ok := operand(0).(pdfString); ok {
+				b.WriteString(font.decode(s))
+			}
+		case "TJ":
+			array, _ := operand(0).([]interface{})
+			for _, item := range array {
+				switch item := item.(type) {
+				case pdfString:
+					b.WriteString(font.decode(item))
+				case float64:
+					// Moving right by more than 0.15 em is a space between words
+					if item < -150 {
+						space()
+					}
+				}
+			}
+		case "Do":
+			name, _ := operand(0).(pdfName)
+			if dict, data, ok := d.streamOf(xobjects[string(name)]); ok && depth < maxFormDepth && dict["Subtype"] == pdfName("Form") {
+				formResources := resources
+				if own, ok := d.dict(dict["Resources"]); ok {
+					formResources = own
+				}
+				d.drawText(b, data, formResources, depth+1)
+			}
+		case "ID":
+			// Inline image data runs to EI
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+}
+
+// pdfFont maps a font's character codes to text.
+type pdfFont struct {
+	codeLength int               // Bytes per character code
+	toUnicode  map[uint32]string // From the ToUnicode CMap
+	encoding   map[byte]string   // From the encoding's Differences
+}
+
+// font reads and caches the font a resource names.
+func (d *pdfDocument) font(value interface{}) *pdfFont {
+	ref, isRef := value.(pdfRef)
+	if isRef {
+		if font, ok := d.fonts[int(ref)]; ok {
+			return font
+		}
+	}
+	font := &pdfFont{codeLength: 1}
+	if dict, ok := d.dict(value); ok {
+		if _, cmap, ok := d.streamOf(dict["ToUnicode"]); ok {
+			font.toUnicode, font.codeLength = parseCMap(cmap)
+		} else if dict["Subtype"] == pdfName("Type0") {
+			font.codeLength = 2
+		}
+		if encoding, ok := d.dict(dict["Encoding"]); ok {
+			font.encoding = differences(d.resolve(encoding["Differences"]))
+		}
+	}
+	if isRef {
+		d.fonts[int(ref)] = font
+	}
+	return font
+}
+
+// decode returns the text of a string drawn in the font. A nil font reads
+// bytes as Latin-1.
+func (f *pdfFont) decode(s pdfString) string {
+	if f == nil {
+		f = &pdfFont{codeLength: 1}
+	}
+	var b strings.Builder
+	for i := 0; i+f.codeLength <= len(s); i += f.codeLength {
+		var code uint32
+		for j := 0; j < f.codeLength; j++ {
+			code = code<<8 | uint32(s[i+j])
+		}
+		if text, ok := f.toUnicode[code]; ok {
+			b.WriteString(text)
+		} else if f.toUnicode != nil || f.codeLength > 1 {
+			continue
+		} else if text, ok := f.encoding[byte(code)]; ok {
+			b.WriteString(text)
+		} else if code >= 0x20 {
+			b.WriteRune(rune(code))
+		}
+	}
+	return b.String()
+}
+
+// parseCMap reads the bfchar and bfrange mappings of a ToUnicode CMap and
+// the length of its codes.
+func parseCMap(data []byte) (map[uint32]string, int) {
+	mapping := make(map[uint32]string)
+	codeLength := 1
+	lex := newLexer(data)
+	var operands []interface{}
+	for {
+		value := parseValue(lex)
+		if value == nil && lex.done() {
+			break
+		}
+		op, ok := value.(pdfKeyword)
+		if !ok {
+			operands = append(operands, value)
+			continue
+		}
+		switch op {
+		case "endcodespacerange":
+			if len(operands) > 0 {
+				if s, ok := operands[0].(pdfString); ok && len(s) > 0 {
+					codeLength = len(s)
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				code, ok1 := operands[i].(pdfString)
+				text, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 {
+					mapping[codeOf(code)] = utf16Text(text)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].(pdfString)
+				high, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || codeOf(high) < codeOf(low) || codeOf(high)-codeOf(low) > 0xFFFF {
+					continue
+				}
+				switch target := operands[i+2].(type) {
+				case pdfString:
+					units := utf16.Decode(utf16Units(target))
+					for code := codeOf(low); code <= codeOf(high) && len(units) > 0; code++ {
+						mapping[code] = string(units)
+						units[len(units)-1]++
+					}
+				case []interface{}:
+					for j, item := range target {
+						if text, ok := item.(pdfString); ok {
+							mapping[codeOf(low)+uint32(j)] = utf16Text(text)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return mapping, codeLength
+}
+
+// codeOf reads a big-endian character code.
+func codeOf(s pdfString) uint32 {
+	var code uint32
+	for i := 0; i < len(s); i++ {
+		code = code<<8 | uint32(s[i])
+	}
+	return code
+}
+
+// utf16Units reads big-endian UTF-16 code units.
+func utf16Units(s pdfString) []uint16 {
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return units
+}
+
+// utf16Text decodes big-endian UTF-16 text.
+func utf16Text(s pdfString) string {
+	return string(utf16.Decode(utf16Units(s)))
+}
+
+// glyphs are the text of common glyph names that are not a single
+// character, for encodings' Differences.
+var glyphs = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": `"`, "numbersign": "#", "dollar": "$", "percent": "%",
+	"ampersand": "&", "quotesingle": "'", "quoteright": "’", "quoteleft": "‘", "parenleft": "(", "parenright": ")",
+	"asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-", "period": ".", "slash": "/",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4", "five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+	"colon": ":", "semicolon": ";", "less": "<", "equal": "=", "greater": ">", "question": "?", "at": "@",
+	"bracketleft": "[", "backslash": `\`, "bracketright": "]", "underscore": "_", "braceleft": "{", "bar": "|", "braceright": "}",
+	"asciitilde": "~", "asciicircum": "^", "grave": "`", "quotedblleft": "“", "quotedblright": "”",
+	"endash": "–", "emdash": "—", "bullet": "•", "ellipsis": "…", "minus": "−",
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl", "dotlessi": "ı",
+}
+
+// differences reads an encoding's Differences array: a code followed by
+// the glyph names of it and the codes after it.
+func differences(value interface{}) map[byte]string {
+	array, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	encoding := make(map[byte]string)
+	code := 0
+	for _, item := range array {
+		switch item := item.(type) {
+		case float64:
+			code = int(item)
+		case pdfName:
+			if code >= 0 && code < 256 {
+				if text, ok := glyphText(string(item)); ok {
+					encoding[byte(code)] = text
+				}
+			}
+			code++
+		}
+	}
+	return encoding
+}
+
+// glyphText returns the text of a glyph name: a letter, a known name, or
+// uniXXXX.
+func glyphText(name string) (string, bool) {
+	if len(name) == 1 {
+		return name, true
+	}
+	if text, ok := glyphs[name]; ok {
+		return text, true
+	}
+	if strings.HasPrefix(name, "uni") && len(name) == 7 {
+		if r, err := strconv.ParseUint(name[3:], 16, 16); err == nil {
+			return string(rune(r)), true
+		}
+	}
+	return "", false
+}
+
+// pdfLexer reads PDF tokens from object bodies and content streams.
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func newLexer(data []byte) *pdfLexer {
+	return &pdfLexer{data: data}
+}
+
+// done reports whether the lexer reached the end of its data.
+func (l *pdfLexer) done() bool {
+	l.skipSpace()
+	return l.pos >= len(l.data)
+}
+
+// skipSpace skips whitespace and comments.
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case isPDFSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// skipInlineImage skips the data of an inline image, up to its EI.
+func (l *pdfLexer) skipInlineImage() {
+	for l.pos+2 < len(l.data) {
+		if isPDFSpace(l.data[l.pos]) && l.data[l.pos+1] == 'E' && l.data[l.pos+2] == 'I' &&
+			(l.pos+3 == len(l.data) || isPDFSpace(l.data[l.pos+3])) {
+			l.pos += 3
+			return
+		}
+		l.pos++
+	}
+	l.pos = len(l.data)
+}
+
+// delimiter tokens returned by next.
+const (
+	tokenDictStart  = pdfKeyword("<<")
+	tokenDictEnd    = pdfKeyword(">>")
+	tokenArrayStart = pdfKeyword("[")
+	tokenArrayEnd   = pdfKeyword("]")
+)
+
+// next returns the next token, or nil at the end of the data.
+func (l *pdfLexer) next() interface{} {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil
+	}
+	c := l.data[l.pos]
+	switch {
+	case c == '/':
+		l.pos++
+		start := l.pos
+		for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+			l.pos++
+		}
+		return pdfName(unescapeName(string(l.data[start:l.pos])))
+	case c == '(':
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return tokenDictStart
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return tokenDictEnd
+	case c == '<':
+		return l.hexString()
+	case c == '[':
+		l.pos++
+		return tokenArrayStart
+	case c == ']':
+		l.pos++
+		return tokenArrayEnd
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		start := l.pos
+		l.pos++
+		for l.pos < len(l.data) && (l.data[l.pos] == '.' || (l.data[l.pos] >= '0' && l.data[l.pos] <= '9')) {
+			l.pos++
+		}
+		n, _ := strconv.ParseFloat(string(l.data[start:l.pos]), 64)
+		return n
+	case isPDFDelimiter(c):
+		l.pos++
+		return pdfKeyword(string(c))
+	}
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFSpace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return pdfKeyword(l.data[start:l.pos])
+}
+
+// literalString reads a (string), with its escapes and balanced
+// parentheses.
+func (l *pdfLexer) literalString() pdfString {
+	l.pos++
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return pdfString(b)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				break
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(n)
+				} else {
+					c = e
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return pdfString(b)
+}
+
+// hexString reads a <hex string>.
+func (l *pdfLexer) hexString() pdfString {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; isHexDigit(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	b := make([]byte, len(digits)/2)
+	for i := range b {
+		n, _ := strconv.ParseUint(string(digits[2*i:2*i+2]), 16, 8)
+		b[i] = byte(n)
+	}
+	return pdfString(b)
+}
+
+// parseValue reads the next value: a dictionary, array, reference, or
+// single token.
+func parseValue(l *pdfLexer) interface{} {
+	token := l.next()
+	switch token {
+	case tokenDictStart:
+		dict := make(map[string]interface{})
+		for {
+			key := l.next()
+			name, ok := key.(pdfName)
+			if !ok {
+				return dict
+			}
+			dict[string(name)] = parseValue(l)
+		}
+	case tokenArrayStart:
+		var array []interface{}
+		for {
+			save := l.pos
+			if l.next() == tokenArrayEnd || l.done() {
+				return array
+			}
+			l.pos = save
+			array = append(array, parseValue(l))
+		}
+	}
+	if n, ok := token.(float64); ok {
+		save := l.pos
+		if generation, ok := l.next().(float64); ok && generation >= 0 {
+			if l.next() == pdfKeyword("R") {
+				return pdfRef(int(n))
+			}
+		}
+		l.pos = save
+	}
+	return token
+}
+
+// unescapeName decodes the #xx escapes of a name.
+func unescapeName(name string) string {
+	if !strings.Contains(name, "#") {
+		return name
+	}
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '#' && i+2 < len(name) && isHexDigit(name[i+1]) && isHexDigit(name[i+2]) {
+			n, _ := strconv.ParseUint(name[i+1:i+3], 16, 8)
+			b.WriteByte(byte(n))
+			i += 2
+			continue
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+func isPDFSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
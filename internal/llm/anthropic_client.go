@@ -1,32 +1,155 @@
 package llm
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
+	"data-chatter/internal/auth"
+	"data-chatter/internal/calendar"
 	"data-chatter/internal/database"
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/engine"
+	"data-chatter/internal/env"
+	"data-chatter/internal/hints"
+	"data-chatter/internal/knowledge"
+	"data-chatter/internal/orgcontext"
+	"data-chatter/internal/savedqueries"
+	"data-chatter/internal/sqlrewrite"
+	"data-chatter/internal/telemetry"
+	"data-chatter/internal/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = telemetry.Tracer("data-chatter/internal/llm")
+
 // AnthropicClient handles communication with Anthropic API
 type AnthropicClient struct {
 	APIKey     string
 	BaseURL    string
+	Model      string
 	HTTPClient *http.Client
 	DB         *database.Connection
+
+	// Provider is the provider requests are sent to, Anthropic when empty,
+	// and Gateway the self-hosted gateway of ProviderOpenAICompatible.
+	Provider string
+	Gateway  Gateway
+
+	// Deterministic sends every request in determinism mode, as
+	// WithDeterminism does for one request, with Seed as the seed.
+	Deterministic bool
+	Seed          int
+
+	// TurnTimeout is the overall deadline budget for one chat turn, shared
+	// between the LLM call and any tool executions it triggers.
+	TurnTimeout time.Duration
+
+	// MaxAttempts bounds how many times a request is sent when the provider
+	// is rate limiting or overloaded, and RetryBackoff is the first wait
+	// between attempts, doubling after each.
+	MaxAttempts  int
+	RetryBackoff time.Duration
+
+	// ToolAvailable, when set, reports whether a tool may be offered to the
+	// model; tools disabled at runtime are left out of requests.
+	ToolAvailable func(name string) bool
+
+	// ToolDefinitions, when set, returns the definitions of the tools to
+	// offer the model for the request in ctx: the enabled tools, built-in
+	// and HTTP-backed, that the caller may use.
+	ToolDefinitions func(ctx context.Context) []types.ToolDefinition
+
+	tools *ToolConverter
+
+	// OrgContext, when set, supplies the organization-wide context document
+	// added to every system prompt.
+	OrgContext *orgcontext.Store
+
+	// Dictionary, when set, supplies admin-written descriptions of tables and
+	// columns added to the schema in every system prompt.
+	Dictionary *dictionary.Store
+
+	// SchemaNotes are deployment-specific hints about tables and columns,
+	// added to the schema after their descriptions.
+	SchemaNotes []dictionary.Note
+
+	// ColumnVisible, when set, reports whether the caller may read a column;
+	// sample rows in the system prompt leave out columns it rejects.
+	ColumnVisible func(ctx context.Context, table, column string) bool
+
+	// SavedQueries, when set, supplies the caller's saved queries, listed in
+	// the system prompt so the model can run them with saved_query_run.
+	SavedQueries *savedqueries.Store
+
+	// Documents, when set, supplies the business documentation passages
+	// relevant to each question, added to its system prompt.
+	Documents *knowledge.Store
+
+	// Calendars, when configured, are described in the system prompt, and
+	// the default calendar's week start applies to periods in value hints.
+	Calendars *calendar.Set
 }
 
 // MessageRequest represents a request to Anthropic
 type MessageRequest struct {
-	Model     string    `json:"model"`
-	MaxTokens int       `json:"max_tokens"`
-	System    string    `json:"system,omitempty"`
-	Messages  []Message `json:"messages"`
-	Tools     []Tool    `json:"tools,omitempty"`
+	Model       string        `json:"model"`
+	MaxTokens   int           `json:"max_tokens"`
+	System      []SystemBlock `json:"system,omitempty"`
+	Messages    []Message     `json:"messages"`
+	Tools       []Tool        `json:"tools,omitempty"`
+	Stream      bool          `json:"stream,omitempty"`
+	Temperature *float64      `json:"temperature,omitempty"`
+
+	// Seed is sent to providers that take one; Anthropic does not.
+	Seed *int `json:"-"`
+}
+
+// SystemBlock is one text block of a system prompt. Blocks with
+// CacheControl end a prefix of the request (tools, then system blocks) that
+// Anthropic caches, so later requests starting with the same prefix reuse it
+// instead of processing it again.
+type SystemBlock struct {
+	Type         string        `json:"type"`
+	Text         string        `json:"text"`
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
+}
+
+// CacheControl marks a prompt cache breakpoint.
+type CacheControl struct {
+	Type string `json:"type"` // "ephemeral", cached for five minutes after its last use
+}
+
+// systemText returns a system block holding text.
+func systemText(text string) SystemBlock {
+	return SystemBlock{Type: "text", Text: text}
+}
+
+// cachedSystemText returns a system block holding text that ends a cached prefix.
+func cachedSystemText(text string) SystemBlock {
+	return SystemBlock{Type: "text", Text: text, CacheControl: &CacheControl{Type: "ephemeral"}}
+}
+
+// systemPrompt returns the text of a system prompt's blocks.
+func systemPrompt(system []SystemBlock) string {
+	texts := make([]string, len(system))
+	for i, block := range system {
+		texts[i] = block.Text
+	}
+	return strings.Join(texts, "\n\n")
 }
 
 // Message represents a conversation message
@@ -60,67 +183,193 @@ type AnthropicResponse struct {
 		Input map[string]interface{} `json:"input,omitempty"`
 	} `json:"content"`
 	StopReason string `json:"stop_reason"`
+	Usage      Usage  `json:"usage"`
+
+	// Retries records how the request was retried before it succeeded.
+	Retries RetryInfo `json:"-"`
 }
 
-// NewAnthropicClient creates a new Anthropic client
+// Usage counts the tokens of a request. Input read from the prompt cache is
+// counted in CacheReadInputTokens, and input written to it in
+// CacheCreationInputTokens, rather than in InputTokens.
+type Usage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// maxSummaryResultBytes bounds how much of a result is sent to be summarized.
+const maxSummaryResultBytes = 16 * 1024
+
+// defaultModel is the model used when ANTHROPIC_MODEL is unset.
+const defaultModel = "claude-3-5-sonnet-20241022"
+
+// NewAnthropicClient creates a new client for the provider configured by
+// ProviderConfigFromEnv. Without an API key the client handles requests
+// gracefully, in degraded mode; the server refuses to start with an invalid
+// provider configuration, so here it falls back to Anthropic.
 func NewAnthropicClient(db *database.Connection) *AnthropicClient {
-	apiKey := os.Getenv("ANTHROPIC_API_KEY")
-	if apiKey == "" {
-		// Return a client that will handle the error gracefully
-		return &AnthropicClient{
-			APIKey:     "",
-			BaseURL:    "https://api.anthropic.com/v1/messages",
-			HTTPClient: &http.Client{},
-			DB:         db,
-		}
+	requestTimeout := env.Duration("LLM_REQUEST_TIMEOUT", 10*time.Second)
+	turnTimeout := env.Duration("LLM_TURN_TIMEOUT", 14*time.Second)
+	maxAttempts := 3
+	if value, err := strconv.Atoi(os.Getenv("ANTHROPIC_MAX_ATTEMPTS")); err == nil && value > 0 {
+		maxAttempts = value
+	}
+	retryBackoff := env.Duration("ANTHROPIC_RETRY_BACKOFF", time.Second)
+	deterministic, _ := strconv.ParseBool(os.Getenv("LLM_DETERMINISTIC"))
+	seed, _ := strconv.Atoi(os.Getenv("LLM_SEED"))
+
+	config, err := ProviderConfigFromEnv()
+	if err != nil {
+		config = ProviderConfig{Provider: ProviderAnthropic, APIKey: os.Getenv("ANTHROPIC_API_KEY"), Model: env.Get("ANTHROPIC_MODEL", defaultModel)}
+	}
+
+	client := &AnthropicClient{
+		APIKey:        config.APIKey,
+		Model:         config.Model,
+		HTTPClient:    newHTTPClient(requestTimeout),
+		DB:            db,
+		Provider:      config.Provider,
+		Gateway:       config.Gateway,
+		Deterministic: deterministic,
+		Seed:          seed,
+		TurnTimeout:   turnTimeout,
+		MaxAttempts:   maxAttempts,
+		RetryBackoff:  retryBackoff,
+		tools:         NewToolConverter(),
 	}
+	client.BaseURL = client.providerURL(config.Provider)
+	return client
+}
 
-	return &AnthropicClient{
-		APIKey:     apiKey,
-		BaseURL:    "https://api.anthropic.com/v1/messages",
-		HTTPClient: &http.Client{},
-		DB:         db,
+// newHTTPClient creates an HTTP client with an overall request timeout and
+// bounded connection setup, so a stalled provider can never hang a turn.
+func newHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   5 * time.Second,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: timeout,
+			IdleConnTimeout:       90 * time.Second,
+			MaxIdleConns:          10,
+		},
 	}
 }
 
-// ProcessMessage processes a user message and returns tool calls
-func (c *AnthropicClient) ProcessMessage(userMessage string) (*AnthropicResponse, error) {
+// duckDBNotes tells the model how DuckDB's SQL differs from what it might
+// otherwise write.
+const duckDBNotes = `DuckDB SQL notes:
+- The syntax is PostgreSQL-like: use date_trunc('month', ts), ts::DATE casts, ILIKE, and string_agg.
+- Query tables and views by name rather than reading files with read_parquet or read_csv.
+- QUALIFY filters on window functions, e.g. QUALIFY row_number() OVER (PARTITION BY customer_id ORDER BY created_at DESC) = 1.
+- GROUP BY ALL and ORDER BY ALL group and order by every non-aggregate column.
+- LIST and STRUCT columns are read with list_contains(col, x), unnest(col), and col.field.
+- / always returns a DOUBLE, even for integers; use // for integer division.`
+
+// clickHouseNotes tells the model how ClickHouse's SQL differs from what it
+// might otherwise write, and what validation refuses there.
+const clickHouseNotes = `ClickHouse SQL notes:
+- Truncate dates with toStartOfMonth(ts), toMonday(ts), toStartOfQuarter(ts), toStartOfYear(ts), or toDate(ts); format them with formatDateTime.
+- Use count() and countIf(cond), sumIf, avgIf, uniq(col) for approximate distinct counts, and argMax(value, ts) for the latest value.
+- Columns are not nullable unless their type is Nullable(...); missing values are often empty strings or 0.
+- String comparison is case-sensitive; use ILIKE or lower() to ignore case.
+- Do not use table functions such as url, file, s3, or remote, the system database, or a SETTINGS clause; such queries are refused.`
+
+// sqlServerNotes tells the model how SQL Server's T-SQL differs from what it
+// might otherwise write, and what validation refuses there.
+const sqlServerNotes = `SQL Server SQL notes:
+- There is no LIMIT clause: write SELECT TOP 10 ... ORDER BY ..., or ORDER BY ... OFFSET 0 ROWS FETCH NEXT 10 ROWS ONLY.
+- Quote identifiers with square brackets, e.g. [order], not double quotes or backticks.
+- Truncate dates with CAST(ts AS date), DATEFROMPARTS(YEAR(ts), MONTH(ts), 1), or DATETRUNC on SQL Server 2022; use DATEADD, DATEDIFF, and FORMAT(ts, 'yyyy-MM').
+- Use LEN, CONCAT or +, STRING_AGG, and GETDATE(); ISNULL or COALESCE replaces NULL.
+- GROUP BY repeats the expressions, not column positions or select list aliases.
+- Do not use OPENROWSET, OPENQUERY, EXEC, stored procedures, or SELECT ... INTO; such queries are refused.`
+
+// keyVariable names the environment variable holding the API key of the
+// client's provider.
+func (c *AnthropicClient) keyVariable() string {
+	if c.provider() == ProviderAnthropic {
+		return "ANTHROPIC_API_KEY"
+	}
+	return "LLM_API_KEY"
+}
+
+// ProcessMessage processes a user message and returns tool calls.
+// The request is bound to ctx, so it is aborted when the turn's deadline expires.
+// The provider call is traced as an "llm.messages" span, whose duration is the model latency.
+func (c *AnthropicClient) ProcessMessage(ctx context.Context, userMessage string) (*AnthropicResponse, error) {
 	// Check if API key is set
-	if c.APIKey == "" {
-		return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable is not set. Please set your Anthropic API key: export ANTHROPIC_API_KEY=your_api_key_here")
+	if !c.Configured(ctx) {
+		return nil, fmt.Errorf("%s environment variable is not set. Please set your API key: export %s=your_api_key_here", c.keyVariable(), c.keyVariable())
 	}
 
-	// Get database schema information
-	schemaInfo := c.getDatabaseSchema()
+	request, contextVersion := c.messageRequest(ctx, userMessage)
+	slog.DebugContext(ctx, "sending message to LLM", "system_prompt", systemPrompt(request.System), "message", userMessage)
 
-	// Debug: Print the schema information from database
-	fmt.Printf("DEBUG: Schema info from database:\n%s\n\n", schemaInfo)
+	return c.send(ctx, request, attribute.Int("org_context.version", contextVersion))
+}
+
+// messageRequest builds the request ProcessMessage sends for userMessage,
+// and returns it with the version of the org context in its system prompt.
+func (c *AnthropicClient) messageRequest(ctx context.Context, userMessage string) (MessageRequest, int) {
+	// Get database schema information
+	schemaInfo := c.getDatabaseSchema(ctx)
 
 	// Get available tools from your server
-	tools := c.getAvailableTools()
+	tools := c.getAvailableTools(ctx)
 
 	// Get database type for system prompt
 	dbType := "SQLite" // Default
-	if c.DB != nil && c.DB.Config != nil {
-		switch c.DB.Config.Type {
-		case "postgres":
-			dbType = "PostgreSQL"
-		case "sqlite":
-			dbType = "SQLite"
-		case "mysql":
-			dbType = "MySQL"
-		}
+	if c.db(ctx) != nil && c.db(ctx).Config != nil {
+		dbType = sqlrewrite.DialectName(c.db(ctx).Config.Type)
+	}
+
+	// The instructions and schema rarely change, so they come first and are
+	// cached along with the tools; org context is shared by every user and
+	// cached as a second prefix, and only the caller's saved queries follow.
+	instructions := fmt.Sprintf("You are a database query assistant for a %s database. You have access to the following database schema:\n\n%s\n\nYou MUST use the database_query tool to execute SQL queries based on user requests. When the user asks for a chart or visualization, use the chart_render tool instead. When the user asks for a file, export, download, or report, use the artifact_create tool. When the user asks what a table looks like or about its data quality, use the table_profile tool. When you need to see how a column's values are formatted before filtering on it, use the database_schema tool with sample_rows. When the user asks for rows by what their free text is about rather than by exact words, use the semantic_search tool if it is available. When the user asks about fiscal periods, weeks, or business days, use the date_range tool to resolve the dates before querying. When the user asks for a percentage, ratio, growth rate, or date difference of figures already known, such as from the question or earlier answers, use the calculate tool rather than working it out yourself. When a question spans several databases, use the cross_database_join tool if it is available. When the user asks what changed between two dates or since an earlier export or snapshot, use the query_diff tool; tables described as snapshots can be passed as its snapshot. Never respond with text - only execute tools.", dbType, schemaInfo)
+	switch dbType {
+	case "DuckDB":
+		instructions += "\n\n" + duckDBNotes
+	case "ClickHouse":
+		instructions += "\n\n" + clickHouseNotes
+	case "SQL Server":
+		instructions += "\n\n" + sqlServerNotes
+	}
+	system := []SystemBlock{cachedSystemText(instructions)}
+
+	contextVersion := 0
+	if current, ok := c.OrgContext.Current(); ok && current.Content != "" {
+		system = append(system, cachedSystemText("Follow these organization rules and conventions when interpreting requests and writing SQL:\n\n"+current.Content))
+		contextVersion = current.Version
+	}
+
+	if documents := c.documentsPrompt(ctx, userMessage); documents != "" {
+		system = append(system, systemText(documents))
+	}
+
+	if saved := c.savedQueriesPrompt(ctx, tools); saved != "" {
+		system = append(system, systemText(saved))
 	}
 
-	systemPrompt := fmt.Sprintf("You are a database query assistant for a %s database. You have access to the following database schema:\n\n%s\n\nYou MUST use the database_query tool to execute SQL queries based on user requests. Never respond with text - only execute tools.", dbType, schemaInfo)
+	if calendars := c.Calendars.Prompt(); calendars != "" {
+		system = append(system, systemText(calendars))
+	}
 
-	// Debug: Print the system prompt being sent to LLM
-	fmt.Printf("DEBUG: System prompt sent to LLM:\n%s\n\n", systemPrompt)
+	if _, prompt := c.valueHints(ctx, userMessage); prompt != "" {
+		system = append(system, systemText(prompt))
+	}
 
 	request := MessageRequest{
-		Model:     "claude-3-5-sonnet-20241022",
+		Model:     c.Model,
 		MaxTokens: 1000,
-		System:    systemPrompt,
+		System:    system,
 		Messages: []Message{
 			{
 				Role:    "user",
@@ -129,24 +378,112 @@ func (c *AnthropicClient) ProcessMessage(userMessage string) (*AnthropicResponse
 		},
 		Tools: tools,
 	}
+	return request, contextVersion
+}
 
-	jsonData, err := json.Marshal(request)
+// Summarize asks the model to answer a question in a few sentences from the
+// results of a query that has already run. No tools are offered, so the
+// answer is plain text. Large results are cut down before they are sent,
+// pointing at export for the full data.
+func (c *AnthropicClient) Summarize(ctx context.Context, question, sql string, results interface{}, export ExportLink) (string, error) {
+	request, err := c.summaryRequest(ctx, question, sql, results, export)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal request: %w", err)
+		return "", err
 	}
 
-	req, err := http.NewRequest("POST", c.BaseURL, bytes.NewBuffer(jsonData))
+	response, err := c.send(ctx, request)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return "", err
 	}
+	for _, block := range response.Content {
+		if block.Type == "text" && block.Text != "" {
+			return strings.TrimSpace(block.Text), nil
+		}
+	}
+	return "", fmt.Errorf("model returned no summary")
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", c.APIKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+// SummarizeStream is Summarize with the answer streamed: onText is called
+// with each piece of text as the model produces it, and the whole summary is
+// returned at the end.
+func (c *AnthropicClient) SummarizeStream(ctx context.Context, question, sql string, results interface{}, export ExportLink, onText func(text string)) (string, error) {
+	request, err := c.summaryRequest(ctx, question, sql, results, export)
+	if err != nil {
+		return "", err
+	}
+	request.Stream = true
 
-	resp, err := c.HTTPClient.Do(req)
+	summary, err := c.stream(ctx, request, onText)
 	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+		return "", err
+	}
+	if summary = strings.TrimSpace(summary); summary == "" {
+		return "", fmt.Errorf("model returned no summary")
+	}
+	return summary, nil
+}
+
+// summaryPrompt is the system prompt for summarizing results.
+const summaryPrompt = "You summarize SQL query results for a data analyst. Answer the question in at most three sentences using only the results given. Mention the key numbers, and say so if the results cannot answer the question."
+
+// summaryRequest builds the request asking the model to summarize results.
+func (c *AnthropicClient) summaryRequest(ctx context.Context, question, sql string, results interface{}, export ExportLink) (MessageRequest, error) {
+	return c.resultsRequest(ctx, summaryPrompt, 500, question, sql, results, export)
+}
+
+// resultsRequest builds a request asking the model to present the results
+// of a query that has already run, as system describes. Results are cut
+// down by promptResults, and whatever is still too large is truncated.
+func (c *AnthropicClient) resultsRequest(ctx context.Context, system string, maxTokens int, question, sql string, results interface{}, export ExportLink) (MessageRequest, error) {
+	if !c.Configured(ctx) {
+		return MessageRequest{}, fmt.Errorf("%s environment variable is not set", c.keyVariable())
+	}
+
+	data, err := json.Marshal(promptResults(results, export))
+	if err != nil {
+		return MessageRequest{}, fmt.Errorf("failed to encode results: %w", err)
+	}
+	if len(data) > maxSummaryResultBytes {
+		data = append(data[:maxSummaryResultBytes], "...(truncated)"...)
+	}
+
+	return MessageRequest{
+		Model:     c.Model,
+		MaxTokens: maxTokens,
+		System:    []SystemBlock{systemText(system)},
+		Messages: []Message{{
+			Role:    "user",
+			Content: fmt.Sprintf("Question: %s\n\nSQL:\n%s\n\nResults (JSON):\n%s", question, sql, data),
+		}},
+	}, nil
+}
+
+// send posts a Messages API request, traced as an "llm.messages" span. It is
+// sent to the provider and model ctx calls for, translated as they need.
+func (c *AnthropicClient) send(ctx context.Context, request MessageRequest, attrs ...attribute.KeyValue) (response *AnthropicResponse, err error) {
+	e := c.endpoint(ctx)
+	request.Model = e.model
+	c.determinize(ctx, &request)
+	ctx, span := startMessagesSpan(ctx, e, request, attrs...)
+	ctx, exchange := startExchange(ctx, e, request)
+	defer func() {
+		finishExchange(ctx, exchange, response, "", err)
+		if response != nil {
+			span.SetAttributes(
+				attribute.String("gen_ai.response.stop_reason", response.StopReason),
+				attribute.Int("gen_ai.response.content_blocks", len(response.Content)),
+				attribute.Int("gen_ai.usage.input_tokens", response.Usage.InputTokens),
+				attribute.Int("gen_ai.usage.output_tokens", response.Usage.OutputTokens),
+				attribute.Int("gen_ai.usage.cache_creation_input_tokens", response.Usage.CacheCreationInputTokens),
+				attribute.Int("gen_ai.usage.cache_read_input_tokens", response.Usage.CacheReadInputTokens),
+			)
+		}
+		telemetry.EndSpan(span, err)
+	}()
+
+	resp, retries, err := c.post(ctx, e, request)
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -156,135 +493,365 @@ func (c *AnthropicClient) ProcessMessage(userMessage string) (*AnthropicResponse
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API request failed: %s", string(body))
+		return nil, newAPIError(resp, body, retries)
 	}
 
-	var response AnthropicResponse
-	if err := json.Unmarshal(body, &response); err != nil {
+	parsed, err := e.decode(body)
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse response: %w", err)
 	}
+	parsed.Retries = retries
+	addUsage(ctx, parsed.Usage)
 
-	return &response, nil
-}
-
-// getAvailableTools fetches tool definitions from your server
-func (c *AnthropicClient) getAvailableTools() []Tool {
-	// This would call your /tools endpoint to get the current tool definitions
-	// For now, return the database tools we know about
-	return []Tool{
-		{
-			Name:        "database_query",
-			Description: "Execute a read-only SQL SELECT query on the database (include LIMIT clause if needed)",
-			InputSchema: map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"query": map[string]interface{}{
-						"type":        "string",
-						"description": "SQL SELECT query to execute (include LIMIT clause if needed)",
-					},
-				},
-				"required": []string{"query"},
-			},
-		},
-	}
+	return parsed, nil
 }
 
-// getDatabaseSchema fetches the database schema information directly from the database
-func (c *AnthropicClient) getDatabaseSchema() string {
-	if c.DB == nil {
-		return "Database connection not available"
+// stream posts a streaming Messages API request and passes each text delta
+// to onText, returning the concatenated text. It is traced like send.
+func (c *AnthropicClient) stream(ctx context.Context, request MessageRequest, onText func(text string)) (text string, err error) {
+	e := c.endpoint(ctx)
+	request.Model = e.model
+	c.determinize(ctx, &request)
+	ctx, span := startMessagesSpan(ctx, e, request)
+	ctx, exchange := startExchange(ctx, e, request)
+	defer func() {
+		finishExchange(ctx, exchange, nil, text, err)
+		telemetry.EndSpan(span, err)
+	}()
+
+	resp, retries, err := c.post(ctx, e, request)
+	if err != nil {
+		return "", err
 	}
+	defer resp.Body.Close()
 
-	// Query the database directly for schema information based on database type
-	var query string
-	var schemaInfo strings.Builder
-	schemaInfo.WriteString("Database Schema:\nTable: contacts\nColumns:\n")
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", newAPIError(resp, body, retries)
+	}
+	if e.openAI() {
+		return readOpenAIStream(ctx, span, resp.Body, onText)
+	}
 
-	if c.DB.Config.Type == "sqlite" {
-		query = `PRAGMA table_info(contacts)`
-	} else if c.DB.Config.Type == "mysql" {
-		query = `DESCRIBE contacts`
-	} else {
-		// PostgreSQL
-		query = `SELECT column_name, data_type, is_nullable, column_default 
-		         FROM information_schema.columns 
-		         WHERE table_name = 'contacts' 
-		         ORDER BY ordinal_position`
+	// Each server-sent event carries its type in the data's "type" field.
+	// Input tokens are reported when the message starts and output tokens
+	// when it ends.
+	var full strings.Builder
+	var usage Usage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var event struct {
+			Type    string `json:"type"`
+			Message struct {
+				Usage Usage `json:"usage"`
+			} `json:"message"`
+			Delta struct {
+				Type       string `json:"type"`
+				Text       string `json:"text"`
+				StopReason string `json:"stop_reason"`
+			} `json:"delta"`
+			Usage Usage `json:"usage"`
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &event); err != nil {
+			return "", fmt.Errorf("failed to parse stream event: %w", err)
+		}
+
+		switch event.Type {
+		case "message_start":
+			usage = event.Message.Usage
+		case "content_block_delta":
+			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
+				full.WriteString(event.Delta.Text)
+				onText(event.Delta.Text)
+			}
+		case "message_delta":
+			span.SetAttributes(attribute.String("gen_ai.response.stop_reason", event.Delta.StopReason))
+			usage.OutputTokens = event.Usage.OutputTokens
+		case "error":
+			return "", fmt.Errorf("API stream failed: %s", event.Error.Message)
+		case "message_stop":
+			addUsage(ctx, usage)
+			return full.String(), nil
+		}
 	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read stream: %w", err)
+	}
+	return "", fmt.Errorf("stream ended before the message was complete")
+}
+
+// startMessagesSpan starts the "llm.messages" span for request to e.
+func startMessagesSpan(ctx context.Context, e endpoint, request MessageRequest, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx, span := tracer.Start(ctx, "llm.messages", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("gen_ai.system", e.provider),
+		attribute.String("gen_ai.request.model", request.Model),
+		attribute.Int("gen_ai.request.max_tokens", request.MaxTokens),
+		attribute.Bool("gen_ai.request.stream", request.Stream),
+	))
+	span.SetAttributes(attrs...)
+	return ctx, span
+}
 
-	rows, err := c.DB.DB.Query(query)
+// post sends a Messages API request to e and returns the response, whatever
+// its status; the caller closes the body. Rate-limit (429) and overloaded (529)
+// responses are retried up to MaxAttempts times in all, waiting as the
+// provider's retry-after header asks or with jittered exponential backoff,
+// but never past ctx's deadline; the last response is returned when retries
+// run out.
+func (c *AnthropicClient) post(ctx context.Context, e endpoint, request MessageRequest) (*http.Response, RetryInfo, error) {
+	var retries RetryInfo
+	if !e.gateway.serves(request.Model) {
+		return nil, retries, fmt.Errorf("model %q is not one of the gateway's models", request.Model)
+	}
+	jsonData, err := e.encode(request)
 	if err != nil {
-		return "Failed to get database schema"
+		return nil, retries, fmt.Errorf("failed to marshal request: %w", err)
 	}
-	defer rows.Close()
 
-	if c.DB.Config.Type == "sqlite" {
-		// SQLite schema parsing
-		for rows.Next() {
-			var cid int
-			var name, dataType string
-			var notNull, pk int
-			var dfltValue interface{}
+	for {
+		req, err := http.NewRequestWithContext(ctx, "POST", e.url, bytes.NewReader(jsonData))
+		if err != nil {
+			return nil, retries, fmt.Errorf("failed to create request: %w", err)
+		}
 
-			err := rows.Scan(&cid, &name, &dataType, &notNull, &dfltValue, &pk)
-			if err != nil {
-				continue
-			}
+		req.Header.Set("Content-Type", "application/json")
+		e.authorize(req)
 
-			nullable := "NULL"
-			if notNull == 1 {
-				nullable = "NOT NULL"
-			}
+		retries.Attempts++
+		resp, err := c.HTTPClient.Do(req)
+		if err != nil {
+			return nil, retries, fmt.Errorf("failed to send request: %w", err)
+		}
+		if !retryableStatus(resp.StatusCode) || retries.Attempts >= c.maxAttempts() {
+			return resp, retries, nil
+		}
 
-			primaryKey := ""
-			if pk == 1 {
-				primaryKey = ", PRIMARY KEY"
-			}
+		wait := c.retryDelay(retries.Attempts, resp.Header)
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			return resp, retries, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+
+		slog.WarnContext(ctx, "LLM provider busy, retrying", "status", resp.StatusCode, "attempt", retries.Attempts, "wait", wait)
+		trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(
+			attribute.Int("http.response.status_code", resp.StatusCode),
+			attribute.Int("retry.attempt", retries.Attempts),
+			attribute.Int64("retry.wait_ms", wait.Milliseconds()),
+		))
+		retries.LastStatus = resp.StatusCode
+		retries.WaitedMs += wait.Milliseconds()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, retries, ctx.Err()
+		}
+	}
+}
 
-			schemaInfo.WriteString(fmt.Sprintf("- %s (%s, %s%s)\n", name, dataType, nullable, primaryKey))
+// newAPIError describes a failed response whose body has been read.
+func newAPIError(resp *http.Response, body []byte, retries RetryInfo) *APIError {
+	retryAfter, _ := parseRetryAfter(resp.Header.Get("retry-after"))
+	return &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       string(body),
+		RetryAfter: retryAfter,
+		Attempts:   retries.Attempts,
+	}
+}
+
+// getAvailableTools returns the tools offered for the request in ctx, in
+// Anthropic's format.
+func (c *AnthropicClient) getAvailableTools(ctx context.Context) []Tool {
+	if c.ToolDefinitions == nil {
+		return nil
+	}
+	return c.tools.Anthropic(c.ToolDefinitions(ctx))
+}
+
+// savedQueriesPrompt lists the caller's saved queries with their parameters
+// for the system prompt, or returns "" when they have none or the
+// saved_query_run tool is unavailable or not among the tools offered.
+func (c *AnthropicClient) savedQueriesPrompt(ctx context.Context, tools []Tool) string {
+	if !engine.ToolEnabled("saved_query_run") || (c.ToolAvailable != nil && !c.ToolAvailable("saved_query_run")) {
+		return ""
+	}
+	if c.ToolDefinitions != nil && !slices.ContainsFunc(tools, func(tool Tool) bool { return tool.Name == "saved_query_run" }) {
+		return ""
+	}
+	queries := c.SavedQueries.List(auth.UserID(ctx))
+	if len(queries) == 0 {
+		return ""
+	}
+
+	var prompt strings.Builder
+	prompt.WriteString("The user has saved these vetted queries. When one answers the request, run it with the saved_query_run tool instead of writing new SQL:\n")
+	for _, query := range queries {
+		prompt.WriteString("- " + query.Name)
+		if query.Description != "" {
+			prompt.WriteString(": " + query.Description)
 		}
-	} else if c.DB.Config.Type == "mysql" {
-		// MySQL schema parsing
-		for rows.Next() {
-			var field, dataType, null, key, defaultValue, extra string
-
-			err := rows.Scan(&field, &dataType, &null, &key, &defaultValue, &extra)
-			if err != nil {
-				continue
+		if len(query.Parameters) > 0 {
+			params := make([]string, len(query.Parameters))
+			for i, p := range query.Parameters {
+				params[i] = p.Name + " (" + p.Type
+				if p.Default != nil {
+					params[i] += fmt.Sprintf(", default %v", p.Default)
+				}
+				params[i] += ")"
+				if p.Description != "" {
+					params[i] += " " + p.Description
+				}
 			}
+			prompt.WriteString(" [parameters: " + strings.Join(params, "; ") + "]")
+		}
+		prompt.WriteString("\n")
+	}
+	return prompt.String()
+}
+
+// documentsPrompt retrieves the documentation passages relevant to
+// userMessage for the system prompt, or returns "" when there are none.
+// Retrieval failures leave the passages out rather than failing the
+// request.
+func (c *AnthropicClient) documentsPrompt(ctx context.Context, userMessage string) string {
+	if c.Documents == nil {
+		return ""
+	}
+	snippets, err := c.Documents.Retrieve(ctx, userMessage)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to retrieve documentation", "error", err)
+		return ""
+	}
+	recordSnippets(ctx, snippets)
+	return knowledge.Prompt(snippets)
+}
+
+// valueHints finds the dates, periods, and numbers in userMessage, read for
+// the caller's locale with weeks starting on the default business
+// calendar's week start day, and describes them for the system prompt.
+// The prompt is "" when there are none.
+func (c *AnthropicClient) valueHints(ctx context.Context, userMessage string) ([]hints.Hint, string) {
+	now := time.Now()
+	locale := types.CallContextFrom(ctx).Locale
+	if locale == "" {
+		locale = hints.DefaultLocale
+	}
+	conventions := locale
+	if c.Calendars != nil && c.Calendars.Configured {
+		conventions += "-u-fw-" + strings.ToLower(c.Calendars.Default().WeekStartDay().String()[:3])
+	}
+	found := hints.Find(userMessage, conventions, now)
+	return found, hints.Prompt(found, locale, now)
+}
+
+// getDatabaseSchema describes every user table and its columns for the
+// system prompt, using the connection's dialect-aware catalog queries so it
+// works on SQLite, MySQL, and PostgreSQL alike. Tables and columns carry
+// their data dictionary descriptions and any configured schema notes. With
+// SCHEMA_SAMPLE_ROWS set, each table also shows sample rows so the model
+// sees how values are formatted.
+func (c *AnthropicClient) getDatabaseSchema(ctx context.Context) string {
+	if c.db(ctx) == nil {
+		return "Database connection not available"
+	}
+
+	schema, err := c.db(ctx).Schema(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to read schema for prompt", "error", err)
+		return "Failed to get database schema"
+	}
 
+	entries, err := c.Dictionary.List(ctx, "")
+	if err != nil {
+		slog.WarnContext(ctx, "failed to read data dictionary for prompt", "error", err)
+	}
+	descriptions := dictionary.Index(entries).AddNotes(c.SchemaNotes)
+
+	var schemaInfo strings.Builder
+	schemaInfo.WriteString("Database Schema:\n")
+	for _, table := range schema.Tables {
+		columns := schema.Columns[table]
+		schemaInfo.WriteString(fmt.Sprintf("Table: %s\n", table))
+		if description := descriptions.Describe(table, ""); description != "" {
+			schemaInfo.WriteString(fmt.Sprintf("Description: %s\n", description))
+		}
+		schemaInfo.WriteString("Columns:\n")
+		for _, col := range columns {
 			nullable := "NULL"
-			if null == "NO" {
+			if !col.Nullable {
 				nullable = "NOT NULL"
 			}
-
 			primaryKey := ""
-			if key == "PRI" {
+			if col.PrimaryKey {
 				primaryKey = ", PRIMARY KEY"
 			}
-
-			schemaInfo.WriteString(fmt.Sprintf("- %s (%s, %s%s)\n", field, dataType, nullable, primaryKey))
-		}
-	} else {
-		// PostgreSQL schema parsing
-		for rows.Next() {
-			var columnName, dataType, isNullable, columnDefault string
-
-			err := rows.Scan(&columnName, &dataType, &isNullable, &columnDefault)
-			if err != nil {
-				continue
+			description := ""
+			if text := descriptions.Describe(table, col.Name); text != "" {
+				description = " - " + text
 			}
+			schemaInfo.WriteString(fmt.Sprintf("- %s (%s, %s%s)%s\n", col.Name, col.DataType, nullable, primaryKey, description))
+		}
+		c.writeSampleRows(ctx, &schemaInfo, table, columns)
+		schemaInfo.WriteString("\n")
+	}
 
-			nullable := "NULL"
-			if isNullable == "NO" {
-				nullable = "NOT NULL"
-			}
+	return schemaInfo.String()
+}
 
-			schemaInfo.WriteString(fmt.Sprintf("- %s (%s, %s)\n", columnName, dataType, nullable))
+// writeSampleRows adds up to SCHEMA_SAMPLE_ROWS rows of table to the schema
+// description, one JSON object per row, leaving out columns the caller may
+// not read.
+func (c *AnthropicClient) writeSampleRows(ctx context.Context, schemaInfo *strings.Builder, table string, columns []database.ColumnInfo) {
+	limit := c.sampleRows(ctx)
+	if limit == 0 {
+		return
+	}
+
+	var visible []database.ColumnInfo
+	for _, col := range columns {
+		if c.ColumnVisible == nil || c.ColumnVisible(ctx, table, col.Name) {
+			visible = append(visible, col)
 		}
 	}
+	recordRedactions(ctx, table, columns, visible)
+	samples, err := c.db(ctx).SampleRows(ctx, table, visible, limit)
+	if err != nil {
+		slog.WarnContext(ctx, "failed to sample table for prompt", "table", table, "error", err)
+		return
+	}
+	if len(samples) == 0 {
+		return
+	}
+
+	schemaInfo.WriteString("Sample rows (personal data masked, long values shortened):\n")
+	for _, row := range samples {
+		encoded, _ := json.Marshal(row)
+		schemaInfo.WriteString("- " + string(encoded) + "\n")
+	}
+}
 
-	schemaInfo.WriteString("\nThe days_available column contains comma-separated values like \"Monday, Tuesday, Wednesday\".")
+// db returns the connection ctx is routed to, such as the caller's tenant
+// database, or the client's own.
+func (c *AnthropicClient) db(ctx context.Context) *database.Connection {
+	return c.DB.For(ctx)
+}
 
-	return schemaInfo.String()
+// sampleRows is how many sample rows per table schema descriptions include.
+func (c *AnthropicClient) sampleRows(ctx context.Context) int {
+	if c.db(ctx) == nil || c.db(ctx).Config == nil {
+		return 0
+	}
+	return c.db(ctx).Config.SchemaSampleRows
 }
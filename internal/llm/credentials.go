@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"data-chatter/internal/env"
+)
+
+// Credential states reported by CheckCredentials.
+const (
+	CredentialsPending     = "pending"     // Not checked yet
+	CredentialsOK          = "ok"          // The provider accepted the key
+	CredentialsMissing     = "missing"     // No key is configured
+	CredentialsInvalid     = "invalid"     // The provider rejected the key as invalid or expired
+	CredentialsUnreachable = "unreachable" // The check could not reach the provider
+)
+
+// CredentialStatus is the outcome of the most recent credential check.
+type CredentialStatus struct {
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Usable reports whether chat requests can be expected to authenticate.
+// An unreachable provider is not treated as a credential problem.
+func (s CredentialStatus) Usable() bool {
+	return s.Status == CredentialsOK || s.Status == CredentialsUnreachable || s.Status == CredentialsPending
+}
+
+// CheckCredentials validates the API key by listing the provider's models,
+// which costs no tokens. A gateway is checked the same way, with or without
+// a key.
+func (c *AnthropicClient) CheckCredentials(ctx context.Context) CredentialStatus {
+	status := CredentialStatus{CheckedAt: time.Now()}
+
+	e := c.endpoint(ctx)
+	if !e.configured() {
+		status.Status = CredentialsMissing
+		status.Message = c.keyVariable() + " is not set"
+		return status
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", e.modelsURL(), nil)
+	if err != nil {
+		status.Status = CredentialsUnreachable
+		status.Message = fmt.Sprintf("failed to create request: %v", err)
+		return status
+	}
+	e.authorize(req)
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		status.Status = CredentialsUnreachable
+		status.Message = fmt.Sprintf("failed to reach provider: %v", err)
+		return status
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		status.Status = CredentialsOK
+	case resp.StatusCode == http.StatusUnauthorized:
+		status.Status = CredentialsInvalid
+		status.Message = "API key is invalid or expired"
+	case resp.StatusCode == http.StatusForbidden:
+		status.Status = CredentialsInvalid
+		status.Message = "API key is not permitted to use the API"
+	default:
+		status.Status = CredentialsUnreachable
+		status.Message = fmt.Sprintf("provider returned %s", resp.Status)
+	}
+	return status
+}
+
+// CredentialMonitor periodically checks the client's credentials and keeps
+// the latest result for readiness probes.
+type CredentialMonitor struct {
+	client   *AnthropicClient
+	interval time.Duration
+
+	mu     sync.RWMutex
+	status CredentialStatus
+}
+
+// NewCredentialMonitor creates a monitor that re-checks every interval.
+// The interval is read from LLM_KEY_CHECK_INTERVAL when zero.
+func NewCredentialMonitor(client *AnthropicClient, interval time.Duration) *CredentialMonitor {
+	if interval <= 0 {
+		interval = env.Duration("LLM_KEY_CHECK_INTERVAL", 10*time.Minute)
+	}
+	return &CredentialMonitor{
+		client:   client,
+		interval: interval,
+		status:   CredentialStatus{Status: CredentialsPending},
+	}
+}
+
+// Start checks the credentials immediately and then on every interval until ctx is done.
+func (m *CredentialMonitor) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+		for {
+			m.Check(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Check runs a credential check now and records the result.
+func (m *CredentialMonitor) Check(ctx context.Context) CredentialStatus {
+	status := m.client.CheckCredentials(ctx)
+
+	m.mu.Lock()
+	m.status = status
+	m.mu.Unlock()
+	return status
+}
+
+// Status returns the result of the most recent check.
+func (m *CredentialMonitor) Status() CredentialStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.status
+}
@@ -0,0 +1,38 @@
+package llm
+
+import (
+	"context"
+	"sort"
+)
+
+// deterministicKey is the context key marking requests made in determinism
+// mode.
+type deterministicKey struct{}
+
+// WithDeterminism returns a context whose requests are sent in determinism
+// mode, for reproducible answers such as in evaluations and recurring
+// reports.
+func WithDeterminism(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deterministicKey{}, true)
+}
+
+// deterministic reports whether requests made with ctx are sent in
+// determinism mode, because the client always is or ctx asks for it.
+func (c *AnthropicClient) deterministic(ctx context.Context) bool {
+	on, _ := ctx.Value(deterministicKey{}).(bool)
+	return on || c.Deterministic
+}
+
+// determinize makes request reproducible when ctx is in determinism mode:
+// it is sampled at temperature 0, with the client's Seed for providers that
+// take one, and its tools are offered in name order.
+func (c *AnthropicClient) determinize(ctx context.Context, request *MessageRequest) {
+	if !c.deterministic(ctx) {
+		return
+	}
+	temperature := 0.0
+	seed := c.Seed
+	request.Temperature = &temperature
+	request.Seed = &seed
+	sort.SliceStable(request.Tools, func(i, j int) bool { return request.Tools[i].Name < request.Tools[j].Name })
+}
@@ -0,0 +1,618 @@
+package llm
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"data-chatter/internal/database"
+)
+
+// Direct mode builds SQL for simple questions about one table from their
+// keywords and the schema, so chat keeps working without an LLM: "how many
+// contacts", "average salary of employees by department", "top 5 products
+// by price", or "orders where status is shipped and total over 100". Every
+// word of a question must be understood, so a question with more to it than
+// the builder can express gets no answer rather than a wrong one.
+
+var (
+	// directOperator spaces out comparison operators written against their
+	// operands, as in "price>100".
+	directOperator = regexp.MustCompile(`(>=|<=|!=|<>|=|>|<)`)
+
+	// directWord matches a quoted value or a run of other characters.
+	directWord = regexp.MustCompile(`'[^']*'|"[^"]*"|[^\s]+`)
+)
+
+// directUnsupported marks questions direct mode cannot answer faithfully,
+// such as ones asking for explanation or comparison.
+var directUnsupported = map[string]bool{
+	"why": true, "explain": true, "compare": true, "versus": true, "vs": true,
+	"trend": true, "trends": true, "forecast": true, "predict": true,
+	"correlation": true, "join": true,
+}
+
+// directFiller lists words a question may include without changing what is
+// asked.
+var directFiller = map[string]bool{
+	"show": true, "list": true, "display": true, "get": true, "fetch": true, "give": true, "find": true, "tell": true,
+	"me": true, "us": true, "all": true, "the": true, "a": true, "an": true, "of": true, "in": true, "from": true,
+	"for": true, "are": true, "is": true, "there": true, "what": true, "what's": true, "whats": true, "which": true,
+	"do": true, "does": true, "we": true, "you": true, "have": true, "i": true, "please": true, "table": true,
+	"rows": true, "records": true, "entries": true, "data": true, "value": true, "values": true, "across": true,
+	"overall": true, "current": true, "currently": true, "many": true,
+}
+
+// directAggregates maps aggregate keywords to their SQL functions. COUNT
+// takes no column.
+var directAggregates = map[string]string{
+	"count": "COUNT", "average": "AVG", "avg": "AVG", "mean": "AVG",
+	"total": "SUM", "sum": "SUM", "maximum": "MAX", "max": "MAX", "highest": "MAX", "largest": "MAX", "biggest": "MAX",
+	"minimum": "MIN", "min": "MIN", "lowest": "MIN", "smallest": "MIN",
+}
+
+// directOperators maps comparison phrases, longest first, to SQL operators.
+var directOperators = []struct {
+	phrase []string
+	op     string
+}{
+	{[]string{"is", "greater", "than", "or", "equal", "to"}, ">="},
+	{[]string{"is", "less", "than", "or", "equal", "to"}, "<="},
+	{[]string{"is", "not", "equal", "to"}, "<>"},
+	{[]string{"is", "equal", "to"}, "="},
+	{[]string{"is", "greater", "than"}, ">"},
+	{[]string{"is", "more", "than"}, ">"},
+	{[]string{"is", "less", "than"}, "<"},
+	{[]string{"is", "at", "least"}, ">="},
+	{[]string{"is", "at", "most"}, "<="},
+	{[]string{"greater", "than"}, ">"},
+	{[]string{"more", "than"}, ">"},
+	{[]string{"less", "than"}, "<"},
+	{[]string{"fewer", "than"}, "<"},
+	{[]string{"at", "least"}, ">="},
+	{[]string{"at", "most"}, "<="},
+	{[]string{"is", "not"}, "<>"},
+	{[]string{"is", "above"}, ">"},
+	{[]string{"is", "over"}, ">"},
+	{[]string{"is", "below"}, "<"},
+	{[]string{"is", "under"}, "<"},
+	{[]string{"is", "after"}, ">"},
+	{[]string{"is", "before"}, "<"},
+	{[]string{"is", "between"}, "between"},
+	{[]string{"equal", "to"}, "="},
+	{[]string{"equals"}, "="},
+	{[]string{"is"}, "="},
+	{[]string{"="}, "="},
+	{[]string{"!="}, "<>"},
+	{[]string{"<>"}, "<>"},
+	{[]string{"not"}, "<>"},
+	{[]string{">="}, ">="},
+	{[]string{"<="}, "<="},
+	{[]string{">"}, ">"},
+	{[]string{"<"}, "<"},
+	{[]string{"above"}, ">"},
+	{[]string{"over"}, ">"},
+	{[]string{"exceeding"}, ">"},
+	{[]string{"below"}, "<"},
+	{[]string{"under"}, "<"},
+	{[]string{"after"}, ">"},
+	{[]string{"since"}, ">="},
+	{[]string{"before"}, "<"},
+	{[]string{"between"}, "between"},
+	{[]string{"contains"}, "like"},
+	{[]string{"containing"}, "like"},
+	{[]string{"like"}, "like"},
+}
+
+// directValueEnd lists words that end a multi-word filter value.
+var directValueEnd = map[string]bool{
+	"and": true, "by": true, "per": true, "sorted": true, "ordered": true, "order": true, "sort": true,
+	"where": true, "with": true, "whose": true, "limit": true, "top": true, "or": true,
+}
+
+// directWordOf is a word of a question: its text as written, for values,
+// and lowercased, for matching.
+type directWordOf struct {
+	text, lower string
+	quoted      bool
+}
+
+// directCondition is one filter of a direct-mode query.
+type directCondition struct {
+	column database.ColumnInfo
+	op     string
+	values []string
+}
+
+// directQuestion is a question being read into the parts of a query.
+type directQuestion struct {
+	words []directWordOf
+	used  []bool
+
+	table   string
+	columns []database.ColumnInfo
+
+	aggregate  string // SQL aggregate function, or empty
+	measure    *database.ColumnInfo
+	groupBy    *database.ColumnInfo
+	orderBy    *database.ColumnInfo
+	descending bool
+	limit      int
+	conditions []directCondition
+}
+
+// directQuery builds a SELECT answering a simple question about one table,
+// from the question's keywords and the tables and columns in schema. It
+// returns false for a question it cannot express exactly.
+func directQuery(config *database.Config, schema *database.Schema, message string) (string, bool) {
+	q := &directQuestion{words: directWords(message)}
+	q.used = make([]bool, len(q.words))
+	for _, word := range q.words {
+		if !word.quoted && directUnsupported[word.lower] {
+			return "", false
+		}
+	}
+	if !q.findTable(schema) || !q.read() {
+		return "", false
+	}
+	for i, word := range q.words {
+		if !q.used[i] && !directFiller[word.lower] {
+			return "", false
+		}
+	}
+	if q.aggregate == "" && len(q.conditions) == 0 && q.orderBy == nil && q.limit == 0 {
+		return "", false
+	}
+	return q.sql(config)
+}
+
+// directWords splits message into words, keeping quoted values whole and
+// dropping punctuation at the ends of other words.
+func directWords(message string) []directWordOf {
+	message = directOperator.ReplaceAllString(message, " $1 ")
+	var words []directWordOf
+	for _, raw := range directWord.FindAllString(message, -1) {
+		if len(raw) >= 2 && (raw[0] == '\'' || raw[0] == '"') && raw[len(raw)-1] == raw[0] {
+			words = append(words, directWordOf{text: raw[1 : len(raw)-1], lower: strings.ToLower(raw[1 : len(raw)-1]), quoted: true})
+			continue
+		}
+		text := strings.Trim(raw, ",.?!;:()")
+		if text == "" {
+			continue
+		}
+		words = append(words, directWordOf{text: text, lower: strings.ToLower(text)})
+	}
+	return words
+}
+
+// findTable finds the first table the question names, as one word or as
+// up to three words standing for a name with underscores.
+func (q *directQuestion) findTable(schema *database.Schema) bool {
+	for i := range q.words {
+		for n := 3; n >= 1; n-- {
+			name, ok := q.name(i, n)
+			if !ok {
+				continue
+			}
+			if table, ok := matchTable(name, schema.Tables); ok {
+				q.table, q.columns = table, schema.Columns[table]
+				q.use(i, n)
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// name joins the n unquoted words from i with underscores.
+func (q *directQuestion) name(i, n int) (string, bool) {
+	if i+n > len(q.words) {
+		return "", false
+	}
+	parts := make([]string, n)
+	for j := range parts {
+		word := q.words[i+j]
+		if word.quoted || q.used[i+j] {
+			return "", false
+		}
+		parts[j] = word.lower
+	}
+	return strings.Join(parts, "_"), true
+}
+
+// use marks n words from i as understood.
+func (q *directQuestion) use(i, n int) {
+	for j := i; j < i+n; j++ {
+		q.used[j] = true
+	}
+}
+
+// is reports whether the word at i is one of words.
+func (q *directQuestion) is(i int, words ...string) bool {
+	if i >= len(q.words) || q.words[i].quoted {
+		return false
+	}
+	for _, word := range words {
+		if q.words[i].lower == word {
+			return true
+		}
+	}
+	return false
+}
+
+// column matches a column of the table to the words at i, returning it
+// and how many words it took.
+func (q *directQuestion) column(i int) (*database.ColumnInfo, int) {
+	for n := 3; n >= 1; n-- {
+		name, ok := q.name(i, n)
+		if !ok {
+			continue
+		}
+		for c := range q.columns {
+			lower := strings.ToLower(q.columns[c].Name)
+			if lower == name || lower+"s" == name || lower == name+"s" {
+				return &q.columns[c], n
+			}
+		}
+	}
+	return nil, 0
+}
+
+// columnAfter matches a column at i, skipping "the" and "of".
+func (q *directQuestion) columnAfter(i int) (*database.ColumnInfo, int) {
+	skipped := 0
+	for q.is(i+skipped, "the", "of") {
+		skipped++
+	}
+	column, n := q.column(i + skipped)
+	if column == nil {
+		return nil, 0
+	}
+	return column, skipped + n
+}
+
+// read reads the question's aggregate, grouping, ordering, limit, and
+// filters, returning false for anything it cannot make sense of.
+func (q *directQuestion) read() bool {
+	for i := 0; i < len(q.words); i++ {
+		if q.used[i] {
+			continue
+		}
+		word := q.words[i]
+		if word.quoted {
+			return false
+		}
+
+		switch {
+		case q.is(i, "how") && q.is(i+1, "many"):
+			if !q.setAggregate("COUNT", nil) {
+				return false
+			}
+			q.use(i, 2)
+			i++
+
+		case q.is(i, "number") && q.is(i+1, "of"):
+			if !q.setAggregate("COUNT", nil) {
+				return false
+			}
+			q.use(i, 2)
+			i++
+
+		case q.is(i, "top", "bottom", "first", "last") && i+1 < len(q.words) && isCount(q.words[i+1].lower):
+			q.limit, _ = strconv.Atoi(q.words[i+1].lower)
+			q.descending = q.is(i, "top")
+			q.use(i, 2)
+			i++
+
+		case directAggregates[word.lower] != "":
+			function := directAggregates[word.lower]
+			column, n := q.columnAfter(i + 1)
+			if function == "SUM" && column == nil && q.is(i, "total") {
+				// "total orders" counts them
+				function = "COUNT"
+			}
+			if function != "COUNT" && (column == nil || !isNumeric(column.DataType) && function != "MAX" && function != "MIN") {
+				return false
+			}
+			if function == "COUNT" {
+				column = nil
+				n = 0
+			}
+			if !q.setAggregate(function, column) {
+				return false
+			}
+			q.use(i, 1+n)
+			i += n
+
+		case q.is(i, "by", "per") || q.is(i, "for") && q.is(i+1, "each") || q.is(i, "grouped") && q.is(i+1, "by"):
+			skip := 1
+			if !q.is(i, "by", "per") {
+				skip = 2
+			}
+			column, n := q.columnAfter(i + skip)
+			if column == nil || q.groupBy != nil {
+				return false
+			}
+			q.groupBy = column
+			q.use(i, skip+n)
+			i += skip + n - 1
+
+		case q.is(i, "sorted", "ordered", "order", "sort") && q.is(i+1, "by"):
+			column, n := q.columnAfter(i + 2)
+			if column == nil || q.orderBy != nil {
+				return false
+			}
+			q.orderBy = column
+			q.use(i, 2+n)
+			i += 1 + n
+			if q.is(i+1, "desc", "descending") {
+				q.descending = true
+				q.use(i+1, 1)
+				i++
+			} else if q.is(i+1, "asc", "ascending") {
+				q.descending = false
+				q.use(i+1, 1)
+				i++
+			}
+
+		case q.is(i, "where", "with", "whose", "having") || q.is(i, "and") && len(q.conditions) > 0:
+			n, ok := q.condition(i + 1)
+			if !ok {
+				return false
+			}
+			q.use(i, 1+n)
+			i += n
+
+		case isCount(word.lower) && i+1 < len(q.words) && q.used[i+1] && q.limit == 0:
+			// "5 employees"
+			q.limit, _ = strconv.Atoi(word.lower)
+			q.use(i, 1)
+		}
+	}
+
+	// Without an aggregate, "top 5 products by price" orders by price
+	if q.aggregate == "" && q.groupBy != nil {
+		if q.orderBy != nil {
+			return false
+		}
+		q.orderBy, q.groupBy = q.groupBy, nil
+		if q.limit == 0 {
+			q.descending = true
+		}
+	}
+	return true
+}
+
+// setAggregate records the question's aggregate, failing on a second one.
+func (q *directQuestion) setAggregate(function string, column *database.ColumnInfo) bool {
+	if q.aggregate != "" {
+		return false
+	}
+	q.aggregate, q.measure = function, column
+	return true
+}
+
+// condition reads a filter such as "status is shipped" starting at i,
+// returning how many words it took.
+func (q *directQuestion) condition(i int) (int, bool) {
+	column, n := q.column(i)
+	if column == nil {
+		return 0, false
+	}
+	j := i + n
+
+	op := "="
+	for _, candidate := range directOperators {
+		if q.hasPhrase(j, candidate.phrase) {
+			op = candidate.op
+			j += len(candidate.phrase)
+			break
+		}
+	}
+
+	value, taken := q.value(j)
+	if taken == 0 {
+		return 0, false
+	}
+	values := []string{value}
+	j += taken
+	if op == "between" {
+		if !q.is(j, "and") {
+			return 0, false
+		}
+		upper, taken := q.value(j + 1)
+		if taken == 0 {
+			return 0, false
+		}
+		values = append(values, upper)
+		j += 1 + taken
+	}
+	if op == "like" || isNumeric(column.DataType) {
+		for _, v := range values {
+			if op == "like" && isNumeric(column.DataType) {
+				return 0, false
+			}
+			if op != "like" && !isNumber(v) {
+				return 0, false
+			}
+		}
+	}
+
+	q.conditions = append(q.conditions, directCondition{column: *column, op: op, values: values})
+	return j - i, true
+}
+
+// hasPhrase reports whether the words from i are phrase.
+func (q *directQuestion) hasPhrase(i int, phrase []string) bool {
+	for k, word := range phrase {
+		if !q.is(i+k, word) {
+			return false
+		}
+	}
+	return true
+}
+
+// value reads a filter value at i: a quoted value, or the words up to the
+// next keyword.
+func (q *directQuestion) value(i int) (string, int) {
+	if i >= len(q.words) {
+		return "", 0
+	}
+	if q.words[i].quoted {
+		return q.words[i].text, 1
+	}
+	var parts []string
+	for j := i; j < len(q.words) && !q.words[j].quoted && !directValueEnd[q.words[j].lower]; j++ {
+		parts = append(parts, q.words[j].text)
+	}
+	return strings.Join(parts, " "), len(parts)
+}
+
+// sql renders the query in the dialect of config.
+func (q *directQuestion) sql(config *database.Config) (string, bool) {
+	quote := config.QuoteIdentifier
+
+	var selected, measure string
+	switch {
+	case q.aggregate == "COUNT":
+		measure = "count"
+		selected = "COUNT(*) AS " + quote(measure)
+	case q.aggregate != "":
+		measure = strings.ToLower(q.aggregate) + "_" + q.measure.Name
+		selected = fmt.Sprintf("%s(%s) AS %s", q.aggregate, quote(q.measure.Name), quote(measure))
+	default:
+		selected = "*"
+	}
+	if q.groupBy != nil {
+		selected = quote(q.groupBy.Name) + ", " + selected
+	}
+
+	query := "SELECT " + selected + " FROM " + quote(q.table)
+
+	var where []string
+	for _, condition := range q.conditions {
+		clause, ok := condition.sql(quote)
+		if !ok {
+			return "", false
+		}
+		where = append(where, clause)
+	}
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	if q.groupBy != nil {
+		query += " GROUP BY " + quote(q.groupBy.Name)
+	}
+	switch {
+	case q.aggregate != "" && q.groupBy != nil && q.orderBy != nil:
+		// "count orders by status sorted by status"
+		if q.orderBy.Name != q.groupBy.Name {
+			return "", false
+		}
+		direction := ""
+		if q.descending {
+			direction = " DESC"
+		}
+		query += " ORDER BY " + quote(q.groupBy.Name) + direction
+	case q.aggregate != "" && q.groupBy != nil:
+		// Largest groups first, or smallest for "bottom 5"
+		direction := " DESC"
+		if q.limit > 0 && !q.descending {
+			direction = ""
+		}
+		query += " ORDER BY " + quote(measure) + direction
+	case q.aggregate != "" && (q.orderBy != nil || q.limit > 0):
+		// An aggregate without grouping returns one row
+		return "", false
+	case q.orderBy != nil:
+		direction := ""
+		if q.descending {
+			direction = " DESC"
+		}
+		query += " ORDER BY " + quote(q.orderBy.Name) + direction
+	}
+
+	if q.aggregate != "" && q.groupBy == nil {
+		return query, true
+	}
+	limit := fallbackRowLimit
+	if q.limit > 0 {
+		limit = min(q.limit, fallbackRowLimit)
+	}
+	return config.Limit(query, limit), true
+}
+
+// sql renders the condition, comparing text case-insensitively.
+func (c directCondition) sql(quote func(string) string) (string, bool) {
+	column := quote(c.column.Name)
+	literals := make([]string, len(c.values))
+	for i, value := range c.values {
+		literal, ok := sqlLiteral(value, isNumeric(c.column.DataType))
+		if !ok {
+			return "", false
+		}
+		literals[i] = literal
+	}
+
+	text := !isNumeric(c.column.DataType) && !isTemporal(c.column.DataType)
+	switch c.op {
+	case "between":
+		return fmt.Sprintf("%s >= %s AND %s <= %s", column, literals[0], column, literals[1]), true
+	case "like":
+		literal, ok := sqlLiteral("%"+strings.ToLower(c.values[0])+"%", false)
+		return fmt.Sprintf("LOWER(%s) LIKE %s", column, literal), ok
+	case "=", "<>":
+		if text {
+			literal, ok := sqlLiteral(strings.ToLower(c.values[0]), false)
+			return fmt.Sprintf("LOWER(%s) %s %s", column, c.op, literal), ok
+		}
+	}
+	return fmt.Sprintf("%s %s %s", column, c.op, literals[0]), true
+}
+
+// sqlLiteral quotes value as a SQL string, or checks it is a number. It
+// refuses backslashes, which MySQL reads as escapes.
+func sqlLiteral(value string, numeric bool) (string, bool) {
+	if numeric {
+		value = strings.ReplaceAll(value, ",", "")
+		return value, isNumber(value)
+	}
+	if strings.Contains(value, `\`) {
+		return "", false
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'", true
+}
+
+// isCount reports whether word is a whole number of rows to return.
+func isCount(word string) bool {
+	n, err := strconv.Atoi(word)
+	return err == nil && n > 0
+}
+
+// isNumber reports whether value is a number.
+func isNumber(value string) bool {
+	_, err := strconv.ParseFloat(strings.ReplaceAll(value, ",", ""), 64)
+	return err == nil
+}
+
+// isNumeric reports whether a column's data type holds numbers.
+func isNumeric(dataType string) bool {
+	lower := strings.ToLower(dataType)
+	if strings.Contains(lower, "interval") || strings.Contains(lower, "point") {
+		return false
+	}
+	for _, name := range []string{"int", "numeric", "decimal", "real", "double", "float", "number", "money"} {
+		if strings.Contains(lower, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTemporal reports whether a column's data type holds dates or times.
+func isTemporal(dataType string) bool {
+	lower := strings.ToLower(dataType)
+	return strings.Contains(lower, "date") || strings.Contains(lower, "time")
+}
@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"context"
+	"regexp"
+	"strings"
+)
+
+// fallbackRowLimit caps the rows returned by a rules-based "show table" query.
+const fallbackRowLimit = 100
+
+var (
+	// listTablesPattern matches requests such as "show tables" or "what tables are there".
+	listTablesPattern = regexp.MustCompile(`^(?:show|list|what)(?: me)?(?: (?:all|the))*(?: available)? tables(?: are there| do you have)?$`)
+
+	// showTablePattern matches requests such as "show table contacts",
+	// "list all employees", or "show me the contacts table".
+	showTablePattern = regexp.MustCompile(`^(?:please )?(?:show|list|display|get|fetch|give)(?: me)?(?: (?:all|everything|the|of|in|from))*(?: table)? ([a-z_][a-z0-9_.]*)(?: table)?(?: (?:rows|records|data))?$`)
+)
+
+// Configured reports whether an API key is set for the provider requests
+// made with ctx are sent to, or, for a gateway, whether it is configured.
+func (c *AnthropicClient) Configured(ctx context.Context) bool {
+	return c.endpoint(ctx).configured()
+}
+
+// FallbackResponse answers simple requests without a provider, for running in
+// direct mode: "show tables" lists the tables as text, "show table X" becomes
+// a database_query tool call for the first rows of X, and simple questions
+// about one table become a database_query call with SQL built from their
+// keywords (see directQuery). It returns false when the message is none of
+// these or names an unknown table.
+func (c *AnthropicClient) FallbackResponse(ctx context.Context, message string) (*AnthropicResponse, bool) {
+	if c.db(ctx) == nil {
+		return nil, false
+	}
+
+	normalized := strings.ToLower(strings.Join(strings.Fields(strings.Trim(message, " \t\n.?!")), " "))
+
+	tables, err := c.db(ctx).TableNames(ctx)
+	if err != nil {
+		return nil, false
+	}
+
+	response := &AnthropicResponse{StopReason: "end_turn"}
+
+	if listTablesPattern.MatchString(normalized) {
+		response.Content = append(response.Content, struct {
+			Type  string                 `json:"type"`
+			Text  string                 `json:"text,omitempty"`
+			ID    string                 `json:"id,omitempty"`
+			Name  string                 `json:"name,omitempty"`
+			Input map[string]interface{} `json:"input,omitempty"`
+		}{
+			Type: "text",
+			Text: "Available tables: " + strings.Join(tables, ", "),
+		})
+		return response, true
+	}
+
+	var query string
+	if match := showTablePattern.FindStringSubmatch(normalized); match != nil {
+		if table, ok := matchTable(match[1], tables); ok {
+			query = c.db(ctx).Config.Limit("SELECT * FROM "+c.db(ctx).Config.QuoteIdentifier(table), fallbackRowLimit)
+		}
+	}
+	if query == "" {
+		schema, err := c.db(ctx).Schema(ctx)
+		if err != nil {
+			return nil, false
+		}
+		built, ok := directQuery(c.db(ctx).Config, schema, message)
+		if !ok {
+			return nil, false
+		}
+		query = built
+	}
+
+	response.StopReason = "tool_use"
+	response.Content = append(response.Content, struct {
+		Type  string                 `json:"type"`
+		Text  string                 `json:"text,omitempty"`
+		ID    string                 `json:"id,omitempty"`
+		Name  string                 `json:"name,omitempty"`
+		Input map[string]interface{} `json:"input,omitempty"`
+	}{
+		Type: "tool_use",
+		ID:   "fallback_1",
+		Name: "database_query",
+		Input: map[string]interface{}{
+			"query": query,
+		},
+	})
+	return response, true
+}
+
+// matchTable finds the table a user referred to, ignoring case and a
+// singular/plural "s".
+func matchTable(name string, tables []string) (string, bool) {
+	for _, table := range tables {
+		lower := strings.ToLower(table)
+		if lower == name || lower == name+"s" || lower+"s" == name {
+			return table, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,61 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ResponseFormat is how the results of a turn are presented in its message.
+type ResponseFormat string
+
+// Supported response formats. FormatRaw leaves the results as JSON for the
+// client to display; the others ask the model to write the message from them.
+const (
+	FormatRaw           ResponseFormat = "raw"
+	FormatSummary       ResponseFormat = "summary"
+	FormatMarkdownTable ResponseFormat = "markdown_table"
+)
+
+// markdownTablePrompt is the system prompt for presenting results as a table.
+const markdownTablePrompt = "You present SQL query results to a data analyst as a GitHub-flavored markdown table. Use readable column headers, keep the values as given, and show at most 50 rows, saying below the table how many were left out. Output only the table and that note."
+
+// ParseResponseFormat parses a client's response format, defaulting to FormatRaw.
+func ParseResponseFormat(value string) (ResponseFormat, error) {
+	switch format := ResponseFormat(strings.ToLower(strings.TrimSpace(value))); format {
+	case "", FormatRaw:
+		return FormatRaw, nil
+	case FormatSummary, FormatMarkdownTable:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported response format %q (use raw, summary, or markdown_table)", value)
+	}
+}
+
+// Format asks the model to present the results of a query that has already
+// run in format: a short summary answering the question, or a markdown
+// table. FormatRaw is returned as an error, as there is nothing to write.
+func (c *AnthropicClient) Format(ctx context.Context, format ResponseFormat, question, sql string, results interface{}, export ExportLink) (string, error) {
+	switch format {
+	case FormatSummary:
+		return c.Summarize(ctx, question, sql, results, export)
+	case FormatMarkdownTable:
+	default:
+		return "", fmt.Errorf("response format %q is not written by the model", format)
+	}
+
+	request, err := c.resultsRequest(ctx, markdownTablePrompt, 4096, question, sql, results, export)
+	if err != nil {
+		return "", err
+	}
+	response, err := c.send(ctx, request)
+	if err != nil {
+		return "", err
+	}
+	for _, block := range response.Content {
+		if block.Type == "text" && block.Text != "" {
+			return strings.TrimSpace(block.Text), nil
+		}
+	}
+	return "", fmt.Errorf("model returned no table")
+}
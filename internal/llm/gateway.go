@@ -0,0 +1,107 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"data-chatter/internal/env"
+)
+
+// Gateway is a self-hosted model gateway with an OpenAI-compatible API, such
+// as vLLM, LiteLLM, or TGI.
+type Gateway struct {
+	// URL is the base of the gateway's API, such as http://vllm:8000/v1;
+	// requests go to its /chat/completions and the key check to its /models.
+	URL string
+
+	// Headers are sent with every request to the gateway, such as a team or
+	// routing header.
+	Headers map[string]string
+
+	// Models are the models the gateway serves. Requests for other models
+	// are refused before they are sent; with no models, any is allowed.
+	Models []string
+}
+
+// ProviderConfig is the provider the server sends requests to, unless a
+// request's context names another.
+type ProviderConfig struct {
+	Provider string
+	APIKey   string
+	Model    string
+	Gateway  Gateway
+}
+
+// ProviderConfigFromEnv reads the server's provider from LLM_PROVIDER:
+// anthropic (the default), openai, or openai_compatible. Anthropic takes its
+// key and model from ANTHROPIC_API_KEY and ANTHROPIC_MODEL unless LLM_API_KEY
+// and LLM_MODEL are set; the others only from LLM_API_KEY and LLM_MODEL.
+// openai_compatible needs LLM_BASE_URL, and reads LLM_HEADERS, a JSON object
+// whose values may refer to environment variables as ${NAME}, and LLM_MODELS,
+// a comma-separated list whose first model is the default.
+func ProviderConfigFromEnv() (ProviderConfig, error) {
+	config := ProviderConfig{
+		Provider: env.Get("LLM_PROVIDER", ProviderAnthropic),
+		APIKey:   os.Getenv("LLM_API_KEY"),
+		Model:    os.Getenv("LLM_MODEL"),
+	}
+	if !ValidProvider(config.Provider) {
+		return ProviderConfig{}, fmt.Errorf("unsupported LLM_PROVIDER %q: use %s, %s, or %s", config.Provider, ProviderAnthropic, ProviderOpenAI, ProviderOpenAICompatible)
+	}
+	if config.Provider == ProviderAnthropic {
+		if config.APIKey == "" {
+			config.APIKey = os.Getenv("ANTHROPIC_API_KEY")
+		}
+		if config.Model == "" {
+			config.Model = env.Get("ANTHROPIC_MODEL", defaultModel)
+		}
+		return config, nil
+	}
+	if config.Provider == ProviderOpenAI {
+		if config.Model == "" {
+			config.Model = defaultModels[ProviderOpenAI]
+		}
+		return config, nil
+	}
+
+	gateway := &config.Gateway
+	gateway.URL = strings.TrimSuffix(os.Getenv("LLM_BASE_URL"), "/")
+	if gateway.URL == "" {
+		return ProviderConfig{}, fmt.Errorf("LLM_BASE_URL is required for the %s provider", ProviderOpenAICompatible)
+	}
+	if parsed, err := url.Parse(gateway.URL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ProviderConfig{}, fmt.Errorf("invalid LLM_BASE_URL %q: want an http or https URL", gateway.URL)
+	}
+	if value := os.Getenv("LLM_HEADERS"); value != "" {
+		if err := json.Unmarshal([]byte(value), &gateway.Headers); err != nil {
+			return ProviderConfig{}, fmt.Errorf("failed to parse LLM_HEADERS: %w", err)
+		}
+		for name, value := range gateway.Headers {
+			gateway.Headers[name] = os.ExpandEnv(value)
+		}
+	}
+	for _, model := range strings.Split(os.Getenv("LLM_MODELS"), ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			gateway.Models = append(gateway.Models, model)
+		}
+	}
+	if config.Model == "" && len(gateway.Models) > 0 {
+		config.Model = gateway.Models[0]
+	}
+	if config.Model == "" {
+		return ProviderConfig{}, fmt.Errorf("LLM_MODEL or LLM_MODELS is required for the %s provider", ProviderOpenAICompatible)
+	}
+	if !gateway.serves(config.Model) {
+		return ProviderConfig{}, fmt.Errorf("LLM_MODEL %q is not one of LLM_MODELS", config.Model)
+	}
+	return config, nil
+}
+
+// serves reports whether the gateway serves model.
+func (g Gateway) serves(model string) bool {
+	return len(g.Models) == 0 || slices.Contains(g.Models, model)
+}
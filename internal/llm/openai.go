@@ -0,0 +1,219 @@
+package llm
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// openAIRequest is a Chat Completions request, translated from a
+// MessageRequest.
+type openAIRequest struct {
+	Model               string               `json:"model"`
+	MaxCompletionTokens int                  `json:"max_completion_tokens"`
+	Messages            []Message            `json:"messages"`
+	Tools               []OpenAITool         `json:"tools,omitempty"`
+	Stream              bool                 `json:"stream,omitempty"`
+	StreamOptions       *openAIStreamOptions `json:"stream_options,omitempty"`
+	Temperature         *float64             `json:"temperature,omitempty"`
+	Seed                *int                 `json:"seed,omitempty"`
+}
+
+// openAIStreamOptions asks for the usage of a streamed request in its last
+// chunk.
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// openAIUsage counts the tokens of a Chat Completions request. Cached
+// prompt tokens are included in PromptTokens.
+type openAIUsage struct {
+	PromptTokens        int `json:"prompt_tokens"`
+	CompletionTokens    int `json:"completion_tokens"`
+	PromptTokensDetails struct {
+		CachedTokens int `json:"cached_tokens"`
+	} `json:"prompt_tokens_details"`
+}
+
+// usage converts u to Usage, counting cached prompt tokens apart as
+// Anthropic does.
+func (u openAIUsage) usage() Usage {
+	cached := u.PromptTokensDetails.CachedTokens
+	return Usage{
+		InputTokens:          u.PromptTokens - cached,
+		OutputTokens:         u.CompletionTokens,
+		CacheReadInputTokens: cached,
+	}
+}
+
+// openAIResponse is a Chat Completions response.
+type openAIResponse struct {
+	Choices []struct {
+		Message struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage openAIUsage `json:"usage"`
+}
+
+// openAIStopReasons maps finish reasons to Anthropic's stop reasons.
+var openAIStopReasons = map[string]string{
+	"stop":       "end_turn",
+	"length":     "max_tokens",
+	"tool_calls": "tool_use",
+}
+
+// encodeOpenAI translates request to a Chat Completions request. The system
+// blocks become one system message, since OpenAI caches prompt prefixes
+// without being told where they end.
+func encodeOpenAI(request MessageRequest) ([]byte, error) {
+	translated := openAIRequest{
+		Model:               request.Model,
+		MaxCompletionTokens: request.MaxTokens,
+		Stream:              request.Stream,
+		Temperature:         request.Temperature,
+		Seed:                request.Seed,
+	}
+	if len(request.System) > 0 {
+		texts := make([]string, len(request.System))
+		for i, block := range request.System {
+			texts[i] = block.Text
+		}
+		translated.Messages = append(translated.Messages, Message{Role: "system", Content: strings.Join(texts, "\n\n")})
+	}
+	translated.Messages = append(translated.Messages, request.Messages...)
+	for _, tool := range request.Tools {
+		translated.Tools = append(translated.Tools, OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.InputSchema,
+			},
+		})
+	}
+	if request.Stream {
+		translated.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	return json.Marshal(translated)
+}
+
+// decodeOpenAI translates a Chat Completions response to an
+// AnthropicResponse, with its text and tool calls as content blocks.
+func decodeOpenAI(body []byte) (*AnthropicResponse, error) {
+	var parsed openAIResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Choices) == 0 {
+		return nil, fmt.Errorf("response has no choices")
+	}
+
+	choice := parsed.Choices[0]
+	response := &AnthropicResponse{
+		StopReason: openAIStopReasons[choice.FinishReason],
+		Usage:      parsed.Usage.usage(),
+	}
+	if response.StopReason == "" {
+		response.StopReason = choice.FinishReason
+	}
+	if choice.Message.Content != "" {
+		response.Content = append(response.Content, struct {
+			Type  string                 `json:"type"`
+			Text  string                 `json:"text,omitempty"`
+			ID    string                 `json:"id,omitempty"`
+			Name  string                 `json:"name,omitempty"`
+			Input map[string]interface{} `json:"input,omitempty"`
+		}{Type: "text", Text: choice.Message.Content})
+	}
+	for _, call := range choice.Message.ToolCalls {
+		input := map[string]interface{}{}
+		if call.Function.Arguments != "" {
+			if err := json.Unmarshal([]byte(call.Function.Arguments), &input); err != nil {
+				return nil, fmt.Errorf("tool call %s has invalid arguments: %w", call.Function.Name, err)
+			}
+		}
+		response.Content = append(response.Content, struct {
+			Type  string                 `json:"type"`
+			Text  string                 `json:"text,omitempty"`
+			ID    string                 `json:"id,omitempty"`
+			Name  string                 `json:"name,omitempty"`
+			Input map[string]interface{} `json:"input,omitempty"`
+		}{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+	}
+	return response, nil
+}
+
+// readOpenAIStream reads a streamed Chat Completions response, passing each
+// piece of text to onText and returning the concatenated text. Usage comes
+// in the last chunk, before the stream's "[DONE]".
+func readOpenAIStream(ctx context.Context, span trace.Span, body io.Reader, onText func(text string)) (string, error) {
+	var full strings.Builder
+	var usage Usage
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			addUsage(ctx, usage)
+			return full.String(), nil
+		}
+
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+			Usage *openAIUsage `json:"usage"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return "", fmt.Errorf("failed to parse stream event: %w", err)
+		}
+		if chunk.Error != nil {
+			return "", fmt.Errorf("API stream failed: %s", chunk.Error.Message)
+		}
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				full.WriteString(choice.Delta.Content)
+				onText(choice.Delta.Content)
+			}
+			if choice.FinishReason != "" {
+				reason := openAIStopReasons[choice.FinishReason]
+				if reason == "" {
+					reason = choice.FinishReason
+				}
+				span.SetAttributes(attribute.String("gen_ai.response.stop_reason", reason))
+			}
+		}
+		if chunk.Usage != nil {
+			usage = chunk.Usage.usage()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read stream: %w", err)
+	}
+	return "", fmt.Errorf("stream ended before the message was complete")
+}
@@ -0,0 +1,108 @@
+package llm
+
+import (
+	"context"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/hints"
+	"data-chatter/internal/knowledge"
+)
+
+// PromptPreview is the request ProcessMessage would send for a question,
+// rendered without calling the provider, for debugging prompts and
+// reviewing what the model is shown.
+type PromptPreview struct {
+	Provider          string              `json:"provider"`
+	Model             string              `json:"model"`
+	System            []SystemBlock       `json:"system"`
+	SystemPrompt      string              `json:"system_prompt"`
+	Messages          []Message           `json:"messages"`
+	Tools             []string            `json:"tools"`
+	Temperature       *float64            `json:"temperature,omitempty"`
+	OrgContextVersion int                 `json:"org_context_version,omitempty"`
+	Redactions        Redactions          `json:"redactions"`
+	Hints             []hints.Hint        `json:"hints"`
+	Documents         []knowledge.Snippet `json:"documents"`
+}
+
+// Redactions are the columns whose values the prompt's sample rows leave
+// out or mask, as "table.column".
+type Redactions struct {
+	// Hidden are columns the user may not read, left out of sample rows.
+	Hidden []string `json:"hidden_columns"`
+
+	// Masked are columns whose names suggest personal data, shown masked.
+	Masked []string `json:"masked_columns"`
+}
+
+// redactionsKey is the context key of the Redactions a prompt being
+// previewed records.
+type redactionsKey struct{}
+
+// snippetsKey is the context key of the documentation snippets a prompt
+// being previewed records.
+type snippetsKey struct{}
+
+// PreviewMessage renders the request ProcessMessage would send for
+// userMessage with ctx: the system prompt with the schema, sample rows,
+// data dictionary, org context, documentation, saved queries, business
+// calendars, and value hints the caller in ctx gets, the tools offered, and
+// the provider and model. No request is sent, so no API key is needed.
+func (c *AnthropicClient) PreviewMessage(ctx context.Context, userMessage string) *PromptPreview {
+	preview := &PromptPreview{Tools: []string{}}
+	preview.Redactions.Hidden = []string{}
+	preview.Redactions.Masked = []string{}
+	ctx = context.WithValue(ctx, redactionsKey{}, &preview.Redactions)
+	preview.Documents = []knowledge.Snippet{}
+	ctx = context.WithValue(ctx, snippetsKey{}, &preview.Documents)
+
+	request, contextVersion := c.messageRequest(ctx, userMessage)
+	e := c.endpoint(ctx)
+	request.Model = e.model
+	c.determinize(ctx, &request)
+
+	preview.Provider = e.provider
+	preview.Model = request.Model
+	preview.System = request.System
+	preview.SystemPrompt = systemPrompt(request.System)
+	preview.Messages = request.Messages
+	preview.Temperature = request.Temperature
+	preview.OrgContextVersion = contextVersion
+	preview.Hints, _ = c.valueHints(ctx, userMessage)
+	if preview.Hints == nil {
+		preview.Hints = []hints.Hint{}
+	}
+	for _, tool := range request.Tools {
+		preview.Tools = append(preview.Tools, tool.Name)
+	}
+	return preview
+}
+
+// recordSnippets notes, when ctx is previewing a prompt, the documentation
+// snippets retrieved for it.
+func recordSnippets(ctx context.Context, snippets []knowledge.Snippet) {
+	if recorded, ok := ctx.Value(snippetsKey{}).(*[]knowledge.Snippet); ok {
+		*recorded = append(*recorded, snippets...)
+	}
+}
+
+// recordRedactions notes, when ctx is previewing a prompt, which of table's
+// columns its sample rows leave out and which they mask.
+func recordRedactions(ctx context.Context, table string, columns, visible []database.ColumnInfo) {
+	redactions, ok := ctx.Value(redactionsKey{}).(*Redactions)
+	if !ok {
+		return
+	}
+	shown := make(map[string]bool, len(visible))
+	for _, col := range visible {
+		shown[col.Name] = true
+	}
+	for _, col := range columns {
+		switch {
+		case !shown[col.Name]:
+			redactions.Hidden = append(redactions.Hidden, table+"."+col.Name)
+		case database.SensitiveColumn(col.Name):
+			redactions.Masked = append(redactions.Masked, table+"."+col.Name)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Providers a request can be sent to. ProviderOpenAICompatible is the
+// server's self-hosted Gateway, spoken to like OpenAI.
+const (
+	ProviderAnthropic        = "anthropic"
+	ProviderOpenAI           = "openai"
+	ProviderOpenAICompatible = "openai_compatible"
+)
+
+// defaultModels are the models used for a provider with no model chosen.
+var defaultModels = map[string]string{
+	ProviderAnthropic: defaultModel,
+	ProviderOpenAI:    "gpt-4o",
+}
+
+// providerURLs are the endpoints requests are posted to.
+var providerURLs = map[string]string{
+	ProviderAnthropic: "https://api.anthropic.com/v1/messages",
+	ProviderOpenAI:    "https://api.openai.com/v1/chat/completions",
+}
+
+// ValidProvider reports whether name is a provider requests can be sent to.
+func ValidProvider(name string) bool {
+	_, ok := providerURLs[name]
+	return ok || name == ProviderOpenAICompatible
+}
+
+// Provider overrides, for one request, the provider, API key, and model the
+// client was configured with, such as with a tenant's own key so that its
+// usage bills to its own account. Empty fields keep the client's values,
+// except that a provider other than the client's needs its own key and
+// defaults to that provider's model.
+type Provider struct {
+	Name   string `json:"provider,omitempty"`
+	APIKey string `json:"-"`
+	Model  string `json:"model,omitempty"`
+}
+
+// providerKey is the context key of a request's Provider.
+type providerKey struct{}
+
+// WithProvider returns a context whose requests are sent as provider says.
+func WithProvider(ctx context.Context, provider Provider) context.Context {
+	return context.WithValue(ctx, providerKey{}, provider)
+}
+
+// endpoint is where and how one request is sent.
+type endpoint struct {
+	provider string
+	apiKey   string
+	model    string
+	url      string
+	gateway  Gateway
+}
+
+// provider returns the provider the client sends requests to by default.
+func (c *AnthropicClient) provider() string {
+	if c.Provider == "" {
+		return ProviderAnthropic
+	}
+	return c.Provider
+}
+
+// providerURL returns the endpoint requests to provider are posted to, or ""
+// for a gateway the server has not configured.
+func (c *AnthropicClient) providerURL(provider string) string {
+	if provider == ProviderOpenAICompatible {
+		if c.Gateway.URL == "" {
+			return ""
+		}
+		return c.Gateway.URL + "/chat/completions"
+	}
+	return providerURLs[provider]
+}
+
+// endpoint returns where requests made with ctx are sent: the client's own
+// provider, key, and model, unless ctx carries a Provider.
+func (c *AnthropicClient) endpoint(ctx context.Context) endpoint {
+	e := endpoint{provider: c.provider(), apiKey: c.APIKey, model: c.Model, url: c.BaseURL}
+	if override, ok := ctx.Value(providerKey{}).(Provider); ok {
+		if override.Name != "" && override.Name != e.provider {
+			e = endpoint{provider: override.Name, model: defaultModels[override.Name], url: c.providerURL(override.Name)}
+		}
+		if override.APIKey != "" {
+			e.apiKey = override.APIKey
+		}
+		if override.Model != "" {
+			e.model = override.Model
+		}
+	}
+	if e.provider == ProviderOpenAICompatible {
+		e.gateway = c.Gateway
+		if e.model == "" && len(e.gateway.Models) > 0 {
+			e.model = e.gateway.Models[0]
+		}
+	}
+	return e
+}
+
+// configured reports whether requests can be sent to e. Gateways may not
+// need a key.
+func (e endpoint) configured() bool {
+	return e.url != "" && (e.apiKey != "" || e.provider == ProviderOpenAICompatible)
+}
+
+// openAI reports whether e speaks OpenAI's Chat Completions API.
+func (e endpoint) openAI() bool {
+	return e.provider == ProviderOpenAI || e.provider == ProviderOpenAICompatible
+}
+
+// modelsURL returns the provider's endpoint listing its models.
+func (e endpoint) modelsURL() string {
+	if e.openAI() {
+		return strings.TrimSuffix(e.url, "/chat/completions") + "/models"
+	}
+	return strings.TrimSuffix(e.url, "/messages") + "/models?limit=1"
+}
+
+// encode returns the body of request in the provider's format.
+func (e endpoint) encode(request MessageRequest) ([]byte, error) {
+	if e.openAI() {
+		return encodeOpenAI(request)
+	}
+	return json.Marshal(request)
+}
+
+// authorize sets the headers that authenticate a request to the provider,
+// and a gateway's own headers.
+func (e endpoint) authorize(req *http.Request) {
+	if e.openAI() {
+		if e.apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+e.apiKey)
+		}
+		for name, value := range e.gateway.Headers {
+			req.Header.Set(name, value)
+		}
+		return
+	}
+	req.Header.Set("x-api-key", e.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+}
+
+// decode parses a successful response body in the provider's format.
+func (e endpoint) decode(body []byte) (*AnthropicResponse, error) {
+	if e.openAI() {
+		return decodeOpenAI(body)
+	}
+	var parsed AnthropicResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, err
+	}
+	return &parsed, nil
+}
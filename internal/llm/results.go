@@ -0,0 +1,179 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+const (
+	// defaultPromptRows is how many rows of each query result the model is
+	// shown when LLM_RESULT_ROWS is unset.
+	defaultPromptRows = 50
+
+	// maxDistinctTracked bounds the distinct values counted per column.
+	maxDistinctTracked = 1000
+)
+
+// ExportLink returns where the caller can download the full result of a
+// tool call, or "" when there is nowhere.
+type ExportLink func(toolCallID string) string
+
+// resultDigest is what the model is shown of one query result too large to
+// send whole: the first rows, with statistics over all of them.
+type resultDigest struct {
+	ToolCallID string                  `json:"tool_call_id,omitempty"`
+	Query      string                  `json:"query,omitempty"`
+	Columns    []string                `json:"columns"`
+	RowCount   int                     `json:"row_count"`
+	Rows       []interface{}           `json:"rows"`
+	Stats      map[string]*columnStats `json:"stats"`
+	Note       string                  `json:"note"`
+}
+
+// columnStats summarizes one column over every row of a result. Min, Max,
+// Mean, and Sum are set for numeric columns; Min and Max also for text.
+type columnStats struct {
+	Nulls          int         `json:"nulls"`
+	Distinct       int         `json:"distinct"`
+	DistinctCapped bool        `json:"distinct_capped,omitempty"`
+	Min            interface{} `json:"min,omitempty"`
+	Max            interface{} `json:"max,omitempty"`
+	Mean           *float64    `json:"mean,omitempty"`
+	Sum            *float64    `json:"sum,omitempty"`
+}
+
+// promptRows is how many rows of each query result the model is shown,
+// from LLM_RESULT_ROWS.
+func promptRows() int {
+	if value, err := strconv.Atoi(os.Getenv("LLM_RESULT_ROWS")); err == nil && value > 0 {
+		return value
+	}
+	return defaultPromptRows
+}
+
+// promptResults returns what the model is shown of a turn's tool results.
+// Query results with more than LLM_RESULT_ROWS rows are cut to their first
+// rows and replaced by a digest with the total row count, statistics over
+// every column, and a note on where the full data is; other results are
+// passed through as they are.
+func promptResults(results interface{}, export ExportLink) interface{} {
+	toolResults, ok := results.([]map[string]interface{})
+	if !ok {
+		return results
+	}
+
+	limit := promptRows()
+	shown := make([]interface{}, len(toolResults))
+	for i, result := range toolResults {
+		shown[i] = result
+		if digest, ok := digestResult(result, limit, export); ok {
+			shown[i] = digest
+		}
+	}
+	return shown
+}
+
+// digestResult digests a query result with more than limit rows.
+func digestResult(result map[string]interface{}, limit int, export ExportLink) (resultDigest, bool) {
+	if isError, _ := result["is_error"].(bool); isError {
+		return resultDigest{}, false
+	}
+	content, _ := result["content"].([]interface{})
+	if len(content) == 0 {
+		return resultDigest{}, false
+	}
+	block, _ := content[0].(map[string]interface{})
+	text, _ := block["text"].(string)
+
+	var payload struct {
+		Query   string                   `json:"query"`
+		Columns []string                 `json:"columns"`
+		Data    []map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(text), &payload); err != nil || payload.Columns == nil || len(payload.Data) <= limit {
+		return resultDigest{}, false
+	}
+
+	toolCallID, _ := result["id"].(string)
+	digest := resultDigest{
+		ToolCallID: toolCallID,
+		Query:      payload.Query,
+		Columns:    payload.Columns,
+		RowCount:   len(payload.Data),
+		Stats:      make(map[string]*columnStats, len(payload.Columns)),
+	}
+	for _, row := range payload.Data[:limit] {
+		digest.Rows = append(digest.Rows, row)
+	}
+	for _, column := range payload.Columns {
+		digest.Stats[column] = summarizeColumn(payload.Data, column)
+	}
+
+	digest.Note = fmt.Sprintf("Only the first %d of %d rows are shown; stats cover every row.", limit, len(payload.Data))
+	if export != nil {
+		if link := export(toolCallID); link != "" {
+			digest.Note += fmt.Sprintf(" The full data is available at %s; mention it if the answer needs rows not shown.", link)
+		}
+	}
+	return digest, true
+}
+
+// summarizeColumn computes the statistics of one column over rows.
+func summarizeColumn(rows []map[string]interface{}, column string) *columnStats {
+	stats := &columnStats{}
+	distinct := make(map[string]bool)
+	numeric, text := true, true
+	var sum float64
+	var count int
+	var minNumber, maxNumber float64
+	var minText, maxText string
+
+	for _, row := range rows {
+		value := row[column]
+		if value == nil {
+			stats.Nulls++
+			continue
+		}
+		if len(distinct) < maxDistinctTracked {
+			distinct[fmt.Sprint(value)] = true
+		} else if !distinct[fmt.Sprint(value)] {
+			stats.DistinctCapped = true
+		}
+
+		number, isNumber := value.(float64)
+		str, isText := value.(string)
+		numeric = numeric && isNumber
+		text = text && isText
+		if isNumber {
+			if count == 0 || number < minNumber {
+				minNumber = number
+			}
+			if count == 0 || number > maxNumber {
+				maxNumber = number
+			}
+			sum += number
+		}
+		if isText {
+			if count == 0 || str < minText {
+				minText = str
+			}
+			if count == 0 || str > maxText {
+				maxText = str
+			}
+		}
+		count++
+	}
+
+	stats.Distinct = len(distinct)
+	switch {
+	case count == 0:
+	case numeric:
+		mean := sum / float64(count)
+		stats.Min, stats.Max, stats.Mean, stats.Sum = minNumber, maxNumber, &mean, &sum
+	case text:
+		stats.Min, stats.Max = minText, maxText
+	}
+	return stats
+}
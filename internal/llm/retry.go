@@ -0,0 +1,86 @@
+package llm
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusOverloaded is the status Anthropic returns when its API is
+// temporarily overloaded.
+const statusOverloaded = 529
+
+// maxRetryBackoff caps the exponential backoff between attempts.
+const maxRetryBackoff = 30 * time.Second
+
+// APIError is a Messages API response other than 200 OK.
+type APIError struct {
+	StatusCode int
+	Body       string
+
+	// RetryAfter is the wait the provider asked for in its retry-after
+	// header, if it sent one.
+	RetryAfter time.Duration
+
+	// Attempts is how many times the request was sent.
+	Attempts int
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API request failed: %s", e.Body)
+}
+
+// Retryable reports whether the request failed because the provider was
+// rate limiting or overloaded, so it may succeed when sent again later.
+func (e *APIError) Retryable() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+// RetryInfo records how a Messages API call was retried after rate-limit
+// and overloaded responses.
+type RetryInfo struct {
+	Attempts   int   `json:"attempts"`
+	WaitedMs   int64 `json:"waited_ms"`
+	LastStatus int   `json:"last_status,omitempty"` // Status of the last response retried
+}
+
+// retryableStatus reports whether a response status is worth retrying.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status == statusOverloaded
+}
+
+// retryDelay returns how long to wait before sending attempt+1. A
+// retry-after header from the provider wins; otherwise the wait doubles from
+// RetryBackoff with each attempt, with up to half of it randomized so that
+// concurrent turns do not retry in lockstep.
+func (c *AnthropicClient) retryDelay(attempt int, header http.Header) time.Duration {
+	if wait, ok := parseRetryAfter(header.Get("retry-after")); ok {
+		return wait
+	}
+	backoff := min(c.RetryBackoff<<(attempt-1), maxRetryBackoff)
+	if backoff <= 0 {
+		return 0
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// maxAttempts returns how many times a request may be sent, at least once.
+func (c *AnthropicClient) maxAttempts() int {
+	return max(c.MaxAttempts, 1)
+}
+
+// parseRetryAfter reads a retry-after header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(time.Until(at), 0), true
+	}
+	return 0, false
+}
@@ -0,0 +1,37 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+
+	"data-chatter/internal/sqlrewrite"
+)
+
+// RewriteSQL asks the model to rewrite query, which failed with failure, for
+// dialect, the database type it ran against. hints are passed on as
+// guidance. The rewritten query is returned without a code fence, and an
+// error when the model gives no SELECT.
+func (c *AnthropicClient) RewriteSQL(ctx context.Context, dialect, query, failure string, hints []sqlrewrite.Hint) (string, error) {
+	if !c.Configured(ctx) {
+		return "", fmt.Errorf("%s environment variable is not set", c.keyVariable())
+	}
+
+	response, err := c.send(ctx, MessageRequest{
+		Model:     c.Model,
+		MaxTokens: 2048,
+		System:    []SystemBlock{systemText(sqlrewrite.SystemPrompt)},
+		Messages: []Message{{
+			Role:    "user",
+			Content: sqlrewrite.Prompt(dialect, query, failure, hints),
+		}},
+	})
+	if err != nil {
+		return "", err
+	}
+	for _, block := range response.Content {
+		if block.Type == "text" && block.Text != "" {
+			return sqlrewrite.ExtractSQL(block.Text)
+		}
+	}
+	return "", fmt.Errorf("model returned no query")
+}
@@ -0,0 +1,101 @@
+package llm
+
+import (
+	"sync"
+
+	"data-chatter/internal/types"
+)
+
+// OpenAITool is a tool definition in OpenAI's function calling format.
+type OpenAITool struct {
+	Type     string         `json:"type"` // always "function"
+	Function OpenAIFunction `json:"function"`
+}
+
+// OpenAIFunction describes a function the model may call.
+type OpenAIFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Parameters  map[string]interface{} `json:"parameters"`
+}
+
+// ToolConverter translates the tool engine's definitions into each
+// provider's tool format. Each definition is converted once and then reused;
+// definitions are keyed by name, which the registry keeps unique and fixes
+// at registration.
+type ToolConverter struct {
+	mu        sync.Mutex
+	anthropic map[string]Tool
+	openAI    map[string]OpenAITool
+}
+
+// NewToolConverter creates an empty converter.
+func NewToolConverter() *ToolConverter {
+	return &ToolConverter{
+		anthropic: make(map[string]Tool),
+		openAI:    make(map[string]OpenAITool),
+	}
+}
+
+// Anthropic returns definitions as Anthropic tools, with the JSON Schema
+// under input_schema.
+func (tc *ToolConverter) Anthropic(definitions []types.ToolDefinition) []Tool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tools := make([]Tool, 0, len(definitions))
+	for _, definition := range definitions {
+		tool, ok := tc.anthropic[definition.Name]
+		if !ok {
+			tool = Tool{
+				Name:        definition.Name,
+				Description: definition.Description,
+				InputSchema: objectSchema(definition.InputSchema),
+			}
+			tc.anthropic[definition.Name] = tool
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// OpenAI returns definitions as OpenAI function tools, with the JSON Schema
+// under function.parameters.
+func (tc *ToolConverter) OpenAI(definitions []types.ToolDefinition) []OpenAITool {
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
+
+	tools := make([]OpenAITool, 0, len(definitions))
+	for _, definition := range definitions {
+		tool, ok := tc.openAI[definition.Name]
+		if !ok {
+			tool = OpenAITool{
+				Type: "function",
+				Function: OpenAIFunction{
+					Name:        definition.Name,
+					Description: definition.Description,
+					Parameters:  objectSchema(definition.InputSchema),
+				},
+			}
+			tc.openAI[definition.Name] = tool
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// objectSchema copies a tool's input schema, filling in the object type and
+// empty properties both providers require of tools that take no input.
+func objectSchema(schema map[string]interface{}) map[string]interface{} {
+	converted := make(map[string]interface{}, len(schema)+2)
+	for key, value := range schema {
+		converted[key] = value
+	}
+	if _, ok := converted["type"]; !ok {
+		converted["type"] = "object"
+	}
+	if _, ok := converted["properties"]; !ok {
+		converted["properties"] = map[string]interface{}{}
+	}
+	return converted
+}
@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Exchange is one request sent to the provider and what came back, as kept
+// in a Transcript.
+type Exchange struct {
+	Provider    string     `json:"provider"`
+	Model       string     `json:"model"`
+	System      string     `json:"system,omitempty"`
+	Messages    []Message  `json:"messages"`
+	Tools       []string   `json:"tools,omitempty"`
+	Temperature *float64   `json:"temperature,omitempty"`
+	Stream      bool       `json:"stream,omitempty"`
+	Output      []Output   `json:"output,omitempty"`
+	StopReason  string     `json:"stop_reason,omitempty"`
+	Usage       Usage      `json:"usage"`
+	Retries     *RetryInfo `json:"retries,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	DurationMs  int64      `json:"duration_ms"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Output is one block of the model's answer: text, or a tool call with its
+// input.
+type Output struct {
+	Type  string                 `json:"type"`
+	Text  string                 `json:"text,omitempty"`
+	ID    string                 `json:"id,omitempty"`
+	Name  string                 `json:"name,omitempty"`
+	Input map[string]interface{} `json:"input,omitempty"`
+}
+
+// Transcript keeps every exchange with the provider made with a context it
+// was added to, such as the requests answering one chat turn.
+type Transcript struct {
+	mu        sync.Mutex
+	started   time.Time
+	exchanges []*Exchange
+}
+
+type transcriptKey struct{}
+
+// exchangeKey is the context key of the exchange a request is part of, so
+// its token usage can be added as it is reported.
+type exchangeKey struct{}
+
+// WithTranscript returns a copy of ctx whose requests, and those of contexts
+// derived from it, are kept in a new Transcript.
+func WithTranscript(ctx context.Context) context.Context {
+	return context.WithValue(ctx, transcriptKey{}, &Transcript{started: time.Now()})
+}
+
+// TranscriptOf returns ctx's transcript, or nil when it has none.
+func TranscriptOf(ctx context.Context) *Transcript {
+	transcript, _ := ctx.Value(transcriptKey{}).(*Transcript)
+	return transcript
+}
+
+// Started returns when the transcript was created.
+func (t *Transcript) Started() time.Time {
+	return t.started
+}
+
+// Exchanges returns a copy of the exchanges kept so far, in the order they
+// were sent.
+func (t *Transcript) Exchanges() []Exchange {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	exchanges := make([]Exchange, len(t.exchanges))
+	for i, exchange := range t.exchanges {
+		exchanges[i] = *exchange
+	}
+	return exchanges
+}
+
+// startExchange records request, about to be sent to e, in ctx's transcript
+// and returns a context that adds the request's usage to it. It returns ctx
+// and nil when ctx has no transcript.
+func startExchange(ctx context.Context, e endpoint, request MessageRequest) (context.Context, *Exchange) {
+	transcript := TranscriptOf(ctx)
+	if transcript == nil {
+		return ctx, nil
+	}
+	exchange := &Exchange{
+		Provider:    e.provider,
+		Model:       request.Model,
+		System:      systemPrompt(request.System),
+		Messages:    request.Messages,
+		Temperature: request.Temperature,
+		Stream:      request.Stream,
+		StartedAt:   time.Now(),
+	}
+	for _, tool := range request.Tools {
+		exchange.Tools = append(exchange.Tools, tool.Name)
+	}
+
+	transcript.mu.Lock()
+	transcript.exchanges = append(transcript.exchanges, exchange)
+	transcript.mu.Unlock()
+	return context.WithValue(ctx, exchangeKey{}, exchange), exchange
+}
+
+// finishExchange records the outcome of an exchange started by
+// startExchange: the response to a sent request, or the text of a streamed
+// one.
+func finishExchange(ctx context.Context, exchange *Exchange, response *AnthropicResponse, text string, err error) {
+	if exchange == nil {
+		return
+	}
+	transcript := TranscriptOf(ctx)
+	transcript.mu.Lock()
+	defer transcript.mu.Unlock()
+
+	exchange.DurationMs = time.Since(exchange.StartedAt).Milliseconds()
+	if err != nil {
+		exchange.Error = err.Error()
+	}
+	if text != "" {
+		exchange.Output = []Output{{Type: "text", Text: text}}
+	}
+	if response != nil {
+		for _, content := range response.Content {
+			exchange.Output = append(exchange.Output, Output{Type: content.Type, Text: content.Text, ID: content.ID, Name: content.Name, Input: content.Input})
+		}
+		exchange.StopReason = response.StopReason
+		if response.Retries.Attempts > 1 {
+			retries := response.Retries
+			exchange.Retries = &retries
+		}
+	}
+}
+
+// addExchangeUsage adds usage to the exchange ctx is part of, if any.
+func addExchangeUsage(ctx context.Context, usage Usage) {
+	exchange, ok := ctx.Value(exchangeKey{}).(*Exchange)
+	if !ok {
+		return
+	}
+	transcript := TranscriptOf(ctx)
+	transcript.mu.Lock()
+	defer transcript.mu.Unlock()
+	exchange.Usage.InputTokens += usage.InputTokens
+	exchange.Usage.OutputTokens += usage.OutputTokens
+	exchange.Usage.CacheCreationInputTokens += usage.CacheCreationInputTokens
+	exchange.Usage.CacheReadInputTokens += usage.CacheReadInputTokens
+}
@@ -0,0 +1,50 @@
+package llm
+
+import (
+	"context"
+	"sync"
+)
+
+// usageMeter totals the tokens of every request sent with a context it was
+// added to, so callers can tell what answering a question cost.
+type usageMeter struct {
+	mu    sync.Mutex
+	total Usage
+}
+
+type usageMeterKey struct{}
+
+// WithUsageMeter returns a copy of ctx that counts the tokens of the
+// requests sent with it, or with contexts derived from it, in place of any
+// count ctx already kept.
+func WithUsageMeter(ctx context.Context) context.Context {
+	return context.WithValue(ctx, usageMeterKey{}, &usageMeter{})
+}
+
+// MeteredUsage returns the tokens counted by ctx's meter so far, or zero
+// when ctx has none.
+func MeteredUsage(ctx context.Context) Usage {
+	meter, ok := ctx.Value(usageMeterKey{}).(*usageMeter)
+	if !ok {
+		return Usage{}
+	}
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+	return meter.total
+}
+
+// addUsage counts usage on ctx's meter, if it has one, and on the exchange
+// it belongs to in ctx's transcript.
+func addUsage(ctx context.Context, usage Usage) {
+	addExchangeUsage(ctx, usage)
+	meter, ok := ctx.Value(usageMeterKey{}).(*usageMeter)
+	if !ok {
+		return
+	}
+	meter.mu.Lock()
+	defer meter.mu.Unlock()
+	meter.total.InputTokens += usage.InputTokens
+	meter.total.OutputTokens += usage.OutputTokens
+	meter.total.CacheCreationInputTokens += usage.CacheCreationInputTokens
+	meter.total.CacheReadInputTokens += usage.CacheReadInputTokens
+}
@@ -0,0 +1,76 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sync"
+)
+
+// journalHandler writes text records for a service manager that stamps and
+// stores log lines itself, as systemd's journal does: each line starts with
+// its syslog priority as a "<N>" prefix, and carries no timestamp.
+type journalHandler struct {
+	slog.Handler
+	out *priorityWriter
+}
+
+func newJournalHandler(w io.Writer, options *slog.HandlerOptions) journalHandler {
+	out := &priorityWriter{out: w}
+	replace := options.ReplaceAttr
+	journalOptions := *options
+	journalOptions.ReplaceAttr = func(groups []string, attr slog.Attr) slog.Attr {
+		if len(groups) == 0 && attr.Key == slog.TimeKey {
+			return slog.Attr{}
+		}
+		if replace != nil {
+			return replace(groups, attr)
+		}
+		return attr
+	}
+	return journalHandler{slog.NewTextHandler(out, &journalOptions), out}
+}
+
+func (h journalHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+	h.out.priority = syslogPriority(record.Level)
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h journalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return journalHandler{h.Handler.WithAttrs(attrs), h.out}
+}
+
+func (h journalHandler) WithGroup(name string) slog.Handler {
+	return journalHandler{h.Handler.WithGroup(name), h.out}
+}
+
+// priorityWriter prefixes each record with the priority of the record being
+// written, which journalHandler sets while holding mu.
+type priorityWriter struct {
+	mu       sync.Mutex
+	out      io.Writer
+	priority string
+}
+
+func (w *priorityWriter) Write(p []byte) (int, error) {
+	if _, err := w.out.Write(append([]byte(w.priority), p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// syslogPriority returns the sd-daemon prefix for a level.
+func syslogPriority(level slog.Level) string {
+	switch {
+	case level >= slog.LevelError:
+		return "<3>"
+	case level >= slog.LevelWarn:
+		return "<4>"
+	case level >= slog.LevelInfo:
+		return "<6>"
+	default:
+		return "<7>"
+	}
+}
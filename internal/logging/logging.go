@@ -0,0 +1,121 @@
+// Package logging configures the process-wide structured logger.
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"data-chatter/internal/redact"
+	"data-chatter/internal/requestid"
+)
+
+// Setup installs the default slog logger from LOG_LEVEL (debug, info, warn,
+// error; default info) and LOG_FORMAT (text, json, or journal; default text,
+// or journal when stderr is connected to the systemd journal). Logs go to
+// stderr, or are appended to LOG_FILE when set, e.g. for Windows services,
+// which have no stderr. Standard library log output is routed through the
+// same handler. Records logged with a request context carry its request_id.
+// Messages and attributes are redacted of secrets, such as the password of
+// a connection string in a driver error.
+func Setup() *slog.Logger {
+	options := &slog.HandlerOptions{Level: ParseLevel(os.Getenv("LOG_LEVEL")), ReplaceAttr: redactAttr}
+
+	var out io.Writer = os.Stderr
+	var fileErr error
+	if path := os.Getenv("LOG_FILE"); path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+		if err != nil {
+			fileErr = err
+		} else {
+			out = file
+		}
+	}
+
+	format := strings.ToLower(os.Getenv("LOG_FORMAT"))
+	if format == "" && os.Getenv("JOURNAL_STREAM") != "" && out == os.Stderr {
+		format = "journal"
+	}
+
+	var handler slog.Handler
+	switch format {
+	case "json":
+		handler = slog.NewJSONHandler(out, options)
+	case "journal":
+		handler = newJournalHandler(out, options)
+	default:
+		handler = slog.NewTextHandler(out, options)
+	}
+
+	logger := slog.New(requestIDHandler{handler})
+	slog.SetDefault(logger)
+	if fileErr != nil {
+		logger.Warn("could not open LOG_FILE; logging to stderr", "error", fileErr)
+	}
+	return logger
+}
+
+// ParseLevel converts a LOG_LEVEL value to a slog level, defaulting to info.
+func ParseLevel(value string) slog.Level {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Rows returns an attribute for count query result rows. The rows themselves
+// are logged only when debug logging is enabled; otherwise just their count is,
+// so result data never reaches logs at info level.
+func Rows(ctx context.Context, key string, count int, rows interface{}) slog.Attr {
+	if slog.Default().Enabled(ctx, slog.LevelDebug) {
+		return slog.Group(key, slog.Int("count", count), slog.Any("data", rows))
+	}
+	return slog.Group(key, slog.Int("count", count), slog.Bool("redacted", true))
+}
+
+// redactAttr removes secrets from an attribute's value, masking it whole
+// when its key names a secret.
+func redactAttr(groups []string, attr slog.Attr) slog.Attr {
+	switch attr.Value.Kind() {
+	case slog.KindString:
+		if redact.SecretName(attr.Key) && attr.Value.String() != "" {
+			return slog.String(attr.Key, redact.Mask)
+		}
+		return slog.String(attr.Key, redact.String(attr.Value.String()))
+	case slog.KindAny:
+		if err, ok := attr.Value.Any().(error); ok {
+			return slog.String(attr.Key, redact.String(err.Error()))
+		}
+		return slog.Any(attr.Key, redact.Value(attr.Value.Any()))
+	}
+	return attr
+}
+
+// requestIDHandler adds the request ID from the record's context, so every
+// line logged while serving a request can be correlated with it.
+type requestIDHandler struct {
+	slog.Handler
+}
+
+func (h requestIDHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h requestIDHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return requestIDHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h requestIDHandler) WithGroup(name string) slog.Handler {
+	return requestIDHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,137 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Seasonalities, the baselines a sample is compared against.
+const (
+	// SeasonNone compares a sample with the metric's recent samples.
+	SeasonNone = ""
+
+	// SeasonDaily compares a sample with earlier ones taken at the same
+	// hour of the day, for metrics with a daily rhythm.
+	SeasonDaily = "daily"
+
+	// SeasonWeekly compares a sample with earlier ones taken at the same
+	// hour on the same weekday, so Monday mornings are compared with
+	// Monday mornings.
+	SeasonWeekly = "weekly"
+)
+
+const (
+	// DefaultThreshold is the z-score beyond which a sample is anomalous.
+	DefaultThreshold = 3.0
+
+	// minBaseline is the fewest earlier samples a baseline needs before
+	// anything is flagged.
+	minBaseline = 5
+
+	// recentBaseline is how many recent samples a non-seasonal baseline uses.
+	recentBaseline = 30
+)
+
+// Anomaly is a sample that differs from its baseline by more than the
+// metric's threshold.
+type Anomaly struct {
+	Value    float64 `json:"value"`
+	Baseline float64 `json:"baseline"` // Mean of the baseline samples
+	StdDev   float64 `json:"std_dev"`
+
+	// ZScore is how many standard deviations Value is from Baseline; it is
+	// 0 when the baseline never varied.
+	ZScore float64 `json:"z_score"`
+
+	// Ratio is Value over Baseline, or 0 when Baseline is 0.
+	Ratio   float64 `json:"ratio"`
+	Samples int     `json:"samples"` // How many samples the baseline has
+}
+
+// Detect compares value, sampled at at, with the baseline drawn from
+// history, which must be ordered oldest first. It returns nil when the
+// value is normal or the baseline has too few samples to judge.
+func Detect(history []Sample, at time.Time, value float64, seasonality string, threshold float64) *Anomaly {
+	var baseline []float64
+	for _, sample := range history {
+		if sameSeason(sample.TakenAt, at, seasonality) {
+			baseline = append(baseline, sample.Value)
+		}
+	}
+	if seasonality == SeasonNone && len(baseline) > recentBaseline {
+		baseline = baseline[len(baseline)-recentBaseline:]
+	}
+	if len(baseline) < minBaseline {
+		return nil
+	}
+
+	var sum float64
+	for _, v := range baseline {
+		sum += v
+	}
+	mean := sum / float64(len(baseline))
+	var squares float64
+	for _, v := range baseline {
+		squares += (v - mean) * (v - mean)
+	}
+	stdDev := math.Sqrt(squares / float64(len(baseline)-1))
+
+	anomaly := &Anomaly{Value: value, Baseline: mean, StdDev: stdDev, Samples: len(baseline)}
+	if mean != 0 {
+		anomaly.Ratio = value / mean
+	}
+	if stdDev == 0 {
+		// A baseline that never varied makes any change stand out
+		if value == mean {
+			return nil
+		}
+		return anomaly
+	}
+	anomaly.ZScore = (value - mean) / stdDev
+	if math.Abs(anomaly.ZScore) < threshold {
+		return nil
+	}
+	return anomaly
+}
+
+// Describe says how the anomalous value compares with normal, e.g.
+// "412 is 4.1x normal (100.5 on average)".
+func (a *Anomaly) Describe() string {
+	var comparison string
+	switch {
+	case a.Ratio >= 2:
+		comparison = fmt.Sprintf("%.1fx normal", a.Ratio)
+	case a.Ratio > 0 && a.Ratio <= 0.5:
+		comparison = fmt.Sprintf("%.0f%% of normal", a.Ratio*100)
+	case a.Value > a.Baseline:
+		comparison = "above normal"
+	default:
+		comparison = "below normal"
+	}
+	text := fmt.Sprintf("%s is %s (%s on average", formatValue(a.Value), comparison, formatValue(a.Baseline))
+	if a.ZScore != 0 {
+		text += fmt.Sprintf(", z-score %.1f", a.ZScore)
+	}
+	return text + ")"
+}
+
+// sameSeason reports whether t falls in the same season as at.
+func sameSeason(t, at time.Time, seasonality string) bool {
+	t, at = t.UTC(), at.UTC()
+	switch seasonality {
+	case SeasonDaily:
+		return t.Hour() == at.Hour()
+	case SeasonWeekly:
+		return t.Weekday() == at.Weekday() && t.Hour() == at.Hour()
+	}
+	return true
+}
+
+// formatValue prints whole numbers without decimals.
+func formatValue(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.2f", v)
+}
@@ -0,0 +1,420 @@
+// Package metrics samples admin-defined numeric queries on a schedule, such
+// as "new contacts this week", keeps a history of their values, and flags
+// values that are statistically unusual for the metric, notifying its
+// subscribers with messages like "New contacts: 412 is 4.1x normal".
+// Metrics live in the dc_metrics table of the connected database and their
+// samples in dc_metric_samples, so every replica sees the same history.
+package metrics
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/notify"
+)
+
+const (
+	// Table is where metrics are stored, and SamplesTable their values.
+	// Their dc_ prefix keeps them out of the schema shown to users and the LLM.
+	Table        = database.MetadataTablePrefix + "metrics"
+	SamplesTable = database.MetadataTablePrefix + "metric_samples"
+
+	// MinInterval is the shortest sampling interval; metrics are checked
+	// for due samples once a minute.
+	MinInterval = time.Minute
+
+	// retention is how long samples are kept.
+	retention = 90 * 24 * time.Hour
+
+	// maxNameLength bounds a metric's name.
+	maxNameLength = 200
+)
+
+var (
+	// ErrNotFound is returned for unknown metric IDs.
+	ErrNotFound = errors.New("metric not found")
+
+	// ErrInvalid is returned for metrics that fail validation.
+	ErrInvalid = errors.New("invalid metric")
+)
+
+// Metric is a SELECT query returning one number, sampled every Interval.
+type Metric struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Query       string `json:"query"`
+	Interval    string `json:"interval"` // A duration like "1h" or "168h"
+
+	// Seasonality picks the baseline samples are compared against:
+	// SeasonNone, SeasonDaily, or SeasonWeekly.
+	Seasonality string `json:"seasonality,omitempty"`
+
+	// Threshold is the z-score beyond which a value is anomalous.
+	Threshold float64 `json:"threshold"`
+
+	// Subscribers are the user IDs notified of anomalies, through their
+	// notification preferences.
+	Subscribers []string  `json:"subscribers"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Sample is a metric's value at one time.
+type Sample struct {
+	TakenAt   time.Time `json:"taken_at"`
+	Value     float64   `json:"value"`
+	Anomalous bool      `json:"anomalous"`
+}
+
+// Store reads and writes metrics and samples them.
+type Store struct {
+	conn   *database.Connection
+	sender *notify.Sender
+}
+
+// NewStore creates the metrics and samples tables if they do not exist yet.
+// Anomalies are sent through sender.
+func NewStore(ctx context.Context, conn *database.Connection, sender *notify.Sender) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	quote := conn.Config.QuoteIdentifier
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+quote(Table)+` (
+		id          VARCHAR(64) NOT NULL PRIMARY KEY,
+		name        VARCHAR(255) NOT NULL,
+		description TEXT NOT NULL,
+		query       TEXT NOT NULL,
+		period      VARCHAR(64) NOT NULL,
+		seasonality VARCHAR(16) NOT NULL,
+		threshold   DOUBLE PRECISION NOT NULL,
+		subscribers TEXT NOT NULL,
+		created_by  VARCHAR(255) NOT NULL,
+		created_at  TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	_, err = conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+quote(SamplesTable)+` (
+		metric_id VARCHAR(64) NOT NULL,
+		taken_at  BIGINT NOT NULL,
+		value     DOUBLE PRECISION NOT NULL,
+		anomalous BOOLEAN NOT NULL,
+		PRIMARY KEY (metric_id, taken_at)
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", SamplesTable, err)
+	}
+	return &Store{conn: conn, sender: sender}, nil
+}
+
+// List returns every metric in name order.
+func (s *Store) List(ctx context.Context) ([]Metric, error) {
+	return s.query(ctx, "")
+}
+
+// Get returns the metric with the given ID.
+func (s *Store) Get(ctx context.Context, id string) (Metric, error) {
+	metrics, err := s.query(ctx, id)
+	if err != nil {
+		return Metric{}, err
+	}
+	if len(metrics) == 0 {
+		return Metric{}, ErrNotFound
+	}
+	return metrics[0], nil
+}
+
+// query reads every metric, or the one with the given ID.
+func (s *Store) query(ctx context.Context, id string) ([]Metric, error) {
+	query := `SELECT id, name, description, query, period, seasonality, threshold, subscribers, created_by, created_at FROM ` + s.conn.Config.QuoteIdentifier(Table)
+	var args []interface{}
+	if id != "" {
+		query += ` WHERE id = ` + s.conn.Config.Placeholder(1)
+		args = append(args, id)
+	}
+	query += ` ORDER BY name, id`
+
+	rows, err := s.conn.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+	defer rows.Close()
+
+	var metrics []Metric
+	for rows.Next() {
+		var metric Metric
+		var subscribers string
+		if err := rows.Scan(&metric.ID, &metric.Name, &metric.Description, &metric.Query, &metric.Interval, &metric.Seasonality,
+			&metric.Threshold, &subscribers, &metric.CreatedBy, &metric.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan metric: %w", err)
+		}
+		metric.Subscribers = []string{}
+		if subscribers != "" {
+			metric.Subscribers = strings.Split(subscribers, ",")
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, rows.Err()
+}
+
+// Add validates and saves a new metric. Its query is run once, read-only,
+// and must return a number. Without subscribers, its creator is subscribed.
+func (s *Store) Add(ctx context.Context, metric Metric) (Metric, error) {
+	metric.Name = strings.TrimSpace(metric.Name)
+	metric.Description = strings.TrimSpace(metric.Description)
+	metric.Query = strings.TrimSpace(metric.Query)
+	metric.Seasonality = strings.ToLower(strings.TrimSpace(metric.Seasonality))
+	if metric.Threshold == 0 {
+		metric.Threshold = DefaultThreshold
+	}
+	if len(metric.Subscribers) == 0 && metric.CreatedBy != "" {
+		metric.Subscribers = []string{metric.CreatedBy}
+	}
+	if err := metric.validate(); err != nil {
+		return Metric{}, err
+	}
+	if _, err := s.value(ctx, metric.Query); err != nil {
+		return Metric{}, fmt.Errorf("%w: query: %v", ErrInvalid, err)
+	}
+	metric.ID = newID()
+	metric.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	config := s.conn.Config
+	placeholders := make([]string, 10)
+	for i := range placeholders {
+		placeholders[i] = config.Placeholder(i + 1)
+	}
+	_, err := s.conn.DB.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, name, description, query, period, seasonality, threshold, subscribers, created_by, created_at) VALUES (%s)`,
+		config.QuoteIdentifier(Table), strings.Join(placeholders, ", ")),
+		metric.ID, metric.Name, metric.Description, metric.Query, metric.Interval, metric.Seasonality, metric.Threshold,
+		strings.Join(metric.Subscribers, ","), metric.CreatedBy, metric.CreatedAt)
+	if err != nil {
+		return Metric{}, fmt.Errorf("failed to save metric: %w", err)
+	}
+	return metric, nil
+}
+
+// validate checks a metric's fields, but not its query's result.
+func (m Metric) validate() error {
+	interval, err := time.ParseDuration(m.Interval)
+	switch {
+	case m.Name == "":
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	case len(m.Name) > maxNameLength:
+		return fmt.Errorf("%w: name is limited to %d characters", ErrInvalid, maxNameLength)
+	case !strings.HasPrefix(strings.ToUpper(m.Query), "SELECT") && !strings.HasPrefix(strings.ToUpper(m.Query), "WITH"):
+		return fmt.Errorf("%w: query must be a SELECT", ErrInvalid)
+	case err != nil || interval < MinInterval:
+		return fmt.Errorf("%w: interval must be a duration of at least %s, like \"24h\"", ErrInvalid, MinInterval)
+	case m.Seasonality != SeasonNone && m.Seasonality != SeasonDaily && m.Seasonality != SeasonWeekly:
+		return fmt.Errorf("%w: seasonality must be %q, %q, or empty", ErrInvalid, SeasonDaily, SeasonWeekly)
+	case m.Threshold < 0:
+		return fmt.Errorf("%w: threshold must be positive", ErrInvalid)
+	}
+	for _, subscriber := range m.Subscribers {
+		if subscriber == "" || strings.Contains(subscriber, ",") {
+			return fmt.Errorf("%w: subscriber %q is not a user ID", ErrInvalid, subscriber)
+		}
+	}
+	return nil
+}
+
+// Delete removes a metric and its samples.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	config := s.conn.Config
+	result, err := s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE id = %s`, config.QuoteIdentifier(Table), config.Placeholder(1)), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete metric: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	_, err = s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE metric_id = %s`, config.QuoteIdentifier(SamplesTable), config.Placeholder(1)), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete metric samples: %w", err)
+	}
+	return nil
+}
+
+// Samples returns a metric's samples taken since since, oldest first.
+func (s *Store) Samples(ctx context.Context, id string, since time.Time) ([]Sample, error) {
+	config := s.conn.Config
+	rows, err := s.conn.DB.QueryContext(ctx,
+		fmt.Sprintf(`SELECT taken_at, value, anomalous FROM %s WHERE metric_id = %s AND taken_at >= %s ORDER BY taken_at`,
+			config.QuoteIdentifier(SamplesTable), config.Placeholder(1), config.Placeholder(2)),
+		id, since.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read metric samples: %w", err)
+	}
+	defer rows.Close()
+
+	samples := []Sample{}
+	for rows.Next() {
+		var takenAt int64
+		var sample Sample
+		if err := rows.Scan(&takenAt, &sample.Value, &sample.Anomalous); err != nil {
+			return nil, fmt.Errorf("failed to scan metric sample: %w", err)
+		}
+		sample.TakenAt = time.UnixMilli(takenAt).UTC()
+		samples = append(samples, sample)
+	}
+	return samples, rows.Err()
+}
+
+// Sample takes a sample of every metric whose interval has passed since its
+// last one, notifying subscribers of anomalies, and drops samples past
+// retention. A metric whose query fails is logged and skipped until the next
+// run. It runs as a scheduled task, once a minute.
+func (s *Store) Sample(ctx context.Context) error {
+	metrics, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, metric := range metrics {
+		if err := s.sample(ctx, metric, now); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			slog.WarnContext(ctx, "metric sample failed", "metric", metric.ID, "name", metric.Name, "error", err)
+		}
+	}
+
+	_, err = s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE taken_at < %s`, s.conn.Config.QuoteIdentifier(SamplesTable), s.conn.Config.Placeholder(1)),
+		now.Add(-retention).UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to prune metric samples: %w", err)
+	}
+	return nil
+}
+
+// sample takes one sample of metric if it is due.
+func (s *Store) sample(ctx context.Context, metric Metric, now time.Time) error {
+	interval, err := time.ParseDuration(metric.Interval)
+	if err != nil {
+		return err
+	}
+	history, err := s.Samples(ctx, metric.ID, now.Add(-lookback(metric.Seasonality, interval)))
+	if err != nil {
+		return err
+	}
+	// A little slack keeps a sample from slipping to the next run when the
+	// previous one ran a few seconds late
+	if len(history) > 0 && now.Sub(history[len(history)-1].TakenAt) < interval-MinInterval/2 {
+		return nil
+	}
+
+	value, err := s.value(ctx, metric.Query)
+	if err != nil {
+		return err
+	}
+	anomaly := Detect(history, now, value, metric.Seasonality, metric.Threshold)
+
+	config := s.conn.Config
+	_, err = s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`INSERT INTO %s (metric_id, taken_at, value, anomalous) VALUES (%s, %s, %s, %s)`,
+			config.QuoteIdentifier(SamplesTable), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3), config.Placeholder(4)),
+		metric.ID, now.UnixMilli(), value, anomaly != nil)
+	if err != nil {
+		return fmt.Errorf("failed to save metric sample: %w", err)
+	}
+	if anomaly != nil {
+		s.alert(ctx, metric, anomaly, now)
+	}
+	return nil
+}
+
+// alert notifies a metric's subscribers of an anomalous sample.
+func (s *Store) alert(ctx context.Context, metric Metric, anomaly *Anomaly, at time.Time) {
+	slog.InfoContext(ctx, "metric anomaly", "metric", metric.ID, "name", metric.Name, "value", anomaly.Value, "baseline", anomaly.Baseline, "z_score", anomaly.ZScore)
+	notification := notify.Notification{
+		Kind:    "metric_anomaly",
+		Subject: fmt.Sprintf("%s is unusual", metric.Name),
+		Text:    fmt.Sprintf("%s: %s.", metric.Name, anomaly.Describe()),
+		Data: map[string]interface{}{
+			"metric_id": metric.ID,
+			"metric":    metric.Name,
+			"taken_at":  at,
+			"anomaly":   anomaly,
+		},
+		SentAt: at,
+	}
+	for _, subscriber := range metric.Subscribers {
+		if err := s.sender.Send(ctx, subscriber, notification); err != nil {
+			slog.WarnContext(ctx, "metric anomaly notification failed", "metric", metric.ID, "user_id", subscriber, "error", err)
+		}
+	}
+}
+
+// value runs a metric's query read-only and returns the first column of its
+// first row as a number.
+func (s *Store) value(ctx context.Context, query string) (float64, error) {
+	rows, err := s.conn.Query(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errors.New("query returned no rows")
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return 0, err
+	}
+
+	switch v := values[0].(type) {
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case []byte:
+		return strconv.ParseFloat(string(v), 64)
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case nil:
+		return 0, errors.New("query returned NULL")
+	}
+	return 0, fmt.Errorf("query returned %T, not a number", values[0])
+}
+
+// lookback is how far back the samples a baseline draws on go.
+func lookback(seasonality string, interval time.Duration) time.Duration {
+	switch seasonality {
+	case SeasonDaily:
+		return 14 * 24 * time.Hour
+	case SeasonWeekly:
+		return 8 * 7 * 24 * time.Hour
+	}
+	return (recentBaseline + 1) * interval
+}
+
+// newID returns a random metric ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
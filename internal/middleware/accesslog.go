@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-chatter/internal/audit"
+)
+
+// AccessLogBodies is what access log entries record about request bodies,
+// which carry users' chat messages and SQL.
+type AccessLogBodies string
+
+const (
+	// BodiesOmit records nothing about request bodies.
+	BodiesOmit AccessLogBodies = "omit"
+
+	// BodiesHash records the size and SHA-256 of the body the handler read,
+	// so identical requests can be matched without logging their content.
+	BodiesHash AccessLogBodies = "hash"
+)
+
+// AccessLogConfig controls the HTTP access log.
+type AccessLogConfig struct {
+	Enabled bool
+	Bodies  AccessLogBodies
+}
+
+// AccessLogConfigFromEnv reads ACCESS_LOG ("true" to log every request) and
+// ACCESS_LOG_BODIES (omit or hash; default omit). Any other body setting is
+// an error rather than a silent default, since it is a privacy control.
+func AccessLogConfigFromEnv() (AccessLogConfig, error) {
+	config := AccessLogConfig{
+		Enabled: os.Getenv("ACCESS_LOG") == "true",
+		Bodies:  BodiesOmit,
+	}
+	switch value := AccessLogBodies(strings.ToLower(strings.TrimSpace(os.Getenv("ACCESS_LOG_BODIES")))); value {
+	case "", BodiesOmit:
+	case BodiesHash:
+		config.Bodies = value
+	default:
+		return config, fmt.Errorf("invalid ACCESS_LOG_BODIES %q: must be omit or hash", value)
+	}
+	return config, nil
+}
+
+// AccessLog records every request to recorder as an http_request entry with
+// its method, path, status, duration, and response size; the caller and
+// request ID are stamped by the recorder. Query strings are left out, as they
+// may carry user data. It must run inside the auth middleware so the caller
+// is known.
+func AccessLog(recorder *audit.Recorder, config AccessLogConfig) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !config.Enabled || recorder == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+
+			var body *hashingBody
+			if config.Bodies == BodiesHash && r.Body != nil && r.Body != http.NoBody {
+				body = &hashingBody{ReadCloser: r.Body, hash: sha256.New()}
+				r.Body = body
+			}
+
+			next.ServeHTTP(wrapped, r)
+
+			details := map[string]interface{}{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"status":      wrapped.statusCode,
+				"duration_ms": time.Since(start).Milliseconds(),
+				"bytes":       wrapped.bytes,
+			}
+			if body != nil && body.size > 0 {
+				details["body_bytes"] = body.size
+				details["body_sha256"] = hex.EncodeToString(body.hash.Sum(nil))
+			}
+			recorder.Record(r.Context(), audit.Entry{
+				Action:  "http_request",
+				Status:  strconv.Itoa(wrapped.statusCode),
+				Details: details,
+			})
+		})
+	}
+}
+
+// hashingBody hashes a request body as the handler reads it, so bodies are
+// never buffered or kept.
+type hashingBody struct {
+	io.ReadCloser
+	hash hash.Hash
+	size int64
+}
+
+func (b *hashingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.hash.Write(p[:n])
+	b.size += int64(n)
+	return n, err
+}
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"data-chatter/internal/apierror"
+)
+
+// errRequestTimeout is the cause of a request's context when its deadline
+// passes.
+var errRequestTimeout = fmt.Errorf("request exceeded REQUEST_TIMEOUT: %w", context.DeadlineExceeded)
+
+// RequestLimitsConfig bounds every request, apart from the server's read
+// and write timeouts.
+type RequestLimitsConfig struct {
+	MaxBodyBytes int64         // Largest request body; 0 allows any size
+	Timeout      time.Duration // Time to handle a request; 0 allows any
+}
+
+// RequestLimitsConfigFromEnv reads MAX_REQUEST_BODY_BYTES (default 10 MB)
+// and REQUEST_TIMEOUT (default 30s); 0 disables either.
+func RequestLimitsConfigFromEnv() (RequestLimitsConfig, error) {
+	config := RequestLimitsConfig{MaxBodyBytes: 10 << 20, Timeout: 30 * time.Second}
+	if value := os.Getenv("MAX_REQUEST_BODY_BYTES"); value != "" {
+		maxBytes, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || maxBytes < 0 {
+			return config, fmt.Errorf("invalid MAX_REQUEST_BODY_BYTES %q: must be a number of bytes", value)
+		}
+		config.MaxBodyBytes = maxBytes
+	}
+	if value := os.Getenv("REQUEST_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return config, fmt.Errorf("invalid REQUEST_TIMEOUT %q: must be a duration such as 30s", value)
+		}
+		config.Timeout = timeout
+	}
+	return config, nil
+}
+
+// RequestLimits rejects request bodies larger than MaxBodyBytes with 413,
+// and cancels requests still running after Timeout, answering 504 if
+// nothing has been written yet. Bodies sent without a Content-Length are
+// cut off at the limit, which the handler reports as it reports any
+// unreadable body. Requests to ownLimits, paths whose handlers take larger
+// bodies and check them themselves, such as uploads, skip the body limit.
+//
+// Handlers that lift the server's write timeout, as event streams, export
+// downloads, and batches do, lift the deadline too, as do connections
+// hijacked for WebSockets.
+func RequestLimits(config RequestLimitsConfig, ownLimits ...string) func(http.Handler) http.Handler {
+	exempt := make(map[string]bool, len(ownLimits))
+	for _, path := range ownLimits {
+		exempt[path] = true
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if config.MaxBodyBytes > 0 && !exempt[r.URL.Path] {
+				if r.ContentLength > config.MaxBodyBytes {
+					apierror.Write(w, r, http.StatusRequestEntityTooLarge, "Request body too large",
+						apierror.New(apierror.PayloadTooLarge, fmt.Sprintf("the request body is %d bytes; at most %d are accepted", r.ContentLength, config.MaxBodyBytes)).
+							WithDetails(map[string]int64{"max_body_bytes": config.MaxBodyBytes}))
+					return
+				}
+				r.Body = http.MaxBytesReader(w, r.Body, config.MaxBodyBytes)
+			}
+			if config.Timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithCancelCause(r.Context())
+			defer cancel(nil)
+			r = r.WithContext(ctx)
+			tw := &timeoutWriter{ResponseWriter: w, header: w.Header().Clone()}
+			tw.timer = time.AfterFunc(config.Timeout, func() {
+				cancel(errRequestTimeout)
+				tw.timeOut(func() {
+					slog.WarnContext(ctx, "request timed out", "method", r.Method, "path", r.URL.Path, "timeout", config.Timeout)
+					apierror.Write(w, r, http.StatusGatewayTimeout, "Request timed out",
+						apierror.New(apierror.RequestTimeout, fmt.Sprintf("the request took longer than %s", config.Timeout)))
+					http.NewResponseController(w).Flush()
+				})
+			})
+			next.ServeHTTP(tw, r)
+			tw.finish()
+		})
+	}
+}
+
+// timeoutWriter passes a handler's response through until the request
+// times out before the handler has written anything. The timeout response
+// is written in its place, and the handler's writes are dropped from then
+// on. The handler sets headers on a copy, applied when it writes, so the
+// timeout response can be written while it is still running.
+type timeoutWriter struct {
+	http.ResponseWriter
+	timer  *time.Timer
+	header http.Header
+
+	mu       sync.Mutex
+	wrote    bool
+	timedOut bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+// writeHeader sends the handler's headers with code, once; tw.mu is held.
+func (tw *timeoutWriter) writeHeader(code int) {
+	if tw.wrote {
+		return
+	}
+	tw.wrote = true
+	header := tw.ResponseWriter.Header()
+	for key, values := range tw.header {
+		header[key] = values
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+// timeOut writes the timeout response with respond, unless the handler
+// has started its own or returned.
+func (tw *timeoutWriter) timeOut(respond func()) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.wrote {
+		return
+	}
+	tw.timedOut = true
+	respond()
+}
+
+// finish stops the deadline once the handler has returned, waiting for a
+// timeout response being written, and sends the headers of a handler that
+// wrote no body.
+func (tw *timeoutWriter) finish() {
+	tw.timer.Stop()
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.timedOut {
+		tw.writeHeader(http.StatusOK)
+	}
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) Write(p []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return tw.ResponseWriter.Write(p)
+}
+
+// FlushError flushes the handler's response, unless the request timed out.
+func (tw *timeoutWriter) FlushError() error {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return http.ErrHandlerTimeout
+	}
+	tw.writeHeader(http.StatusOK)
+	return http.NewResponseController(tw.ResponseWriter).Flush()
+}
+
+// SetWriteDeadline sets the server's write deadline; a handler clearing it
+// runs for as long as it needs, so the request deadline is lifted too.
+func (tw *timeoutWriter) SetWriteDeadline(deadline time.Time) error {
+	if deadline.IsZero() {
+		tw.timer.Stop()
+	}
+	return http.NewResponseController(tw.ResponseWriter).SetWriteDeadline(deadline)
+}
+
+// Hijack hands the connection to a WebSocket handler, which is no longer
+// bound by the request deadline.
+func (tw *timeoutWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return nil, nil, http.ErrHandlerTimeout
+	}
+	tw.timer.Stop()
+	tw.wrote = true
+	return http.NewResponseController(tw.ResponseWriter).Hijack()
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController for the
+// methods timeoutWriter does not have.
+func (tw *timeoutWriter) Unwrap() http.ResponseWriter {
+	return tw.ResponseWriter
+}
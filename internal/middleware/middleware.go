@@ -1,9 +1,14 @@
 package middleware
 
 import (
-	"log"
+	"bufio"
+	"log/slog"
+	"net"
 	"net/http"
+	"strings"
 	"time"
+
+	"data-chatter/internal/types"
 )
 
 // LoggingMiddleware logs HTTP requests
@@ -16,11 +21,61 @@ func LoggingMiddleware(next http.Handler) http.Handler {
 
 		next.ServeHTTP(wrapped, r)
 
-		duration := time.Since(start)
-		log.Printf("%s %s %d %v", r.Method, r.URL.Path, wrapped.statusCode, duration)
+		slog.InfoContext(r.Context(), "http request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", wrapped.statusCode,
+			"duration", time.Since(start))
+	})
+}
+
+// maxLocaleLength bounds the language tag taken from Accept-Language.
+const maxLocaleLength = 35
+
+// LocaleMiddleware records the caller's preferred language, the first tag
+// of Accept-Language, in the request's tool CallContext.
+func LocaleMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if locale := preferredLocale(r.Header.Get("Accept-Language")); locale != "" {
+			cc := types.CallContextFrom(r.Context())
+			cc.Locale = locale
+			r = r.WithContext(types.WithCallContext(r.Context(), cc))
+		}
+		next.ServeHTTP(w, r)
 	})
 }
 
+// CacheControlMiddleware records the request's Cache-Control header in its
+// tool CallContext, so "no-cache", "no-store", and "max-age" reach the
+// query result cache.
+func CacheControlMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if header := r.Header.Get("Cache-Control"); header != "" {
+			cc := types.CallContextFrom(r.Context())
+			cc.CacheControl = header
+			r = r.WithContext(types.WithCallContext(r.Context(), cc))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// preferredLocale returns the first language tag of an Accept-Language
+// header, or "" when it is missing, a wildcard, or malformed.
+func preferredLocale(header string) string {
+	tag, _, _ := strings.Cut(header, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	tag = strings.TrimSpace(tag)
+	if tag == "" || tag == "*" || len(tag) > maxLocaleLength {
+		return ""
+	}
+	for _, r := range tag {
+		if !(r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return ""
+		}
+	}
+	return tag
+}
+
 // CORSMiddleware adds CORS headers
 func CORSMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -37,13 +92,31 @@ func CORSMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-// responseWriter wraps http.ResponseWriter to capture status code
+// responseWriter wraps http.ResponseWriter to capture status code and size
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 func (rw *responseWriter) WriteHeader(code int) {
 	rw.statusCode = code
 	rw.ResponseWriter.WriteHeader(code)
 }
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(p)
+	rw.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap exposes the underlying writer so http.ResponseController can flush event streams.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// Hijack hands the connection to WebSocket handlers, which need it directly
+// rather than through http.ResponseController.
+func (rw *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(rw.ResponseWriter).Hijack()
+}
@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/redis"
+	"data-chatter/internal/tenant"
+)
+
+// idleBucketTTL is how long an untouched client bucket is kept before being evicted.
+const idleBucketTTL = 10 * time.Minute
+
+// RateLimitConfig controls the per-client token bucket.
+type RateLimitConfig struct {
+	RPS   float64 // Tokens refilled per second; 0 disables limiting
+	Burst int     // Bucket capacity
+	ByIP  bool    // Key clients by remote IP only, ignoring users and API keys
+}
+
+// Enabled reports whether rate limiting is configured.
+func (c RateLimitConfig) Enabled() bool {
+	return c.RPS > 0
+}
+
+// RateLimitConfigFromEnv reads RATE_LIMIT_RPS, RATE_LIMIT_BURST, and
+// RATE_LIMIT_BY_IP. Rate limiting is disabled when RATE_LIMIT_RPS is unset
+// or not positive; the burst defaults to the rounded-up RPS.
+func RateLimitConfigFromEnv() RateLimitConfig {
+	var config RateLimitConfig
+	if value := os.Getenv("RATE_LIMIT_RPS"); value != "" {
+		if rps, err := strconv.ParseFloat(value, 64); err == nil && rps > 0 {
+			config.RPS = rps
+		}
+	}
+	if value := os.Getenv("RATE_LIMIT_BURST"); value != "" {
+		if burst, err := strconv.Atoi(value); err == nil && burst > 0 {
+			config.Burst = burst
+		}
+	}
+	if config.Burst == 0 {
+		config.Burst = int(math.Max(1, math.Ceil(config.RPS)))
+	}
+	config.ByIP = os.Getenv("RATE_LIMIT_BY_IP") == "true"
+	return config
+}
+
+// bucket is one client's token bucket.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// takeTokenScript takes a token from the bucket in KEYS[1], refilled at
+// ARGV[2] tokens per second up to ARGV[1], by Redis's clock so replicas'
+// clocks need not agree. It returns 1 and 0 when a token was taken, or 0
+// and the milliseconds until the next one. Idle buckets expire after
+// ARGV[3] milliseconds.
+const takeTokenScript = `
+local burst = tonumber(ARGV[1])
+local rps = tonumber(ARGV[2])
+local clock = redis.call('TIME')
+local now = tonumber(clock[1]) * 1000 + math.floor(tonumber(clock[2]) / 1000)
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(state[1]) or burst
+local last = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - last) / 1000 * rps)
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+if allowed == 1 then
+  return {1, 0}
+end
+return {0, math.ceil((1 - tokens) / rps * 1000)}
+`
+
+// RateLimiter is a token-bucket limiter keyed by client.
+type RateLimiter struct {
+	config    RateLimitConfig
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+
+	shared        *redis.Client // Holds the buckets when set
+	sharedPrefix  string
+	sharedFailing atomic.Bool // Whether the last shared bucket lookup failed
+}
+
+// NewRateLimiter creates a limiter with an independent bucket per client.
+func NewRateLimiter(config RateLimitConfig) *RateLimiter {
+	return &RateLimiter{
+		config:    config,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+// NewSharedRateLimiter creates a limiter whose buckets live in Redis, so a
+// client draws on the same bucket whichever replica serves it. name keeps
+// the limiter's buckets apart from other limiters'. While Redis cannot be
+// reached, each replica falls back to buckets of its own. With a nil
+// client it is NewRateLimiter.
+func NewSharedRateLimiter(config RateLimitConfig, client *redis.Client, name string) *RateLimiter {
+	rl := NewRateLimiter(config)
+	rl.shared = client
+	rl.sharedPrefix = redis.KeyPrefix + "ratelimit:" + name + ":"
+	return rl
+}
+
+// Allow takes a token from the client's bucket. When the bucket is empty it
+// returns false and how long until the next token is available.
+func (rl *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if rl.shared != nil {
+		allowed, wait, err := rl.allowShared(key)
+		if err == nil {
+			if rl.sharedFailing.Swap(false) {
+				slog.Info("shared rate limit buckets are reachable again")
+			}
+			return allowed, wait
+		}
+		if !rl.sharedFailing.Swap(true) {
+			slog.Warn("shared rate limit buckets unavailable; limiting per replica", "error", err)
+		}
+	}
+
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	now := time.Now()
+	rl.sweep(now)
+
+	b, ok := rl.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rl.config.Burst), last: now}
+		rl.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(rl.config.Burst), b.tokens+now.Sub(b.last).Seconds()*rl.config.RPS)
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := (1 - b.tokens) / rl.config.RPS
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// allowShared takes a token from the client's bucket in Redis.
+func (rl *RateLimiter) allowShared(key string) (bool, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redis.Timeout)
+	defer cancel()
+	reply, err := rl.shared.Eval(ctx, takeTokenScript, []string{rl.sharedPrefix + key},
+		strconv.Itoa(rl.config.Burst),
+		strconv.FormatFloat(rl.config.RPS, 'f', -1, 64),
+		strconv.FormatInt(idleBucketTTL.Milliseconds(), 10))
+	if err != nil {
+		return false, 0, err
+	}
+	result, ok := reply.([]interface{})
+	if !ok || len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit reply %v", reply)
+	}
+	allowed, _ := result[0].(int64)
+	waitMillis, _ := result[1].(int64)
+	return allowed == 1, time.Duration(waitMillis) * time.Millisecond, nil
+}
+
+// sweep drops buckets idle long enough to have refilled completely.
+func (rl *RateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < idleBucketTTL {
+		return
+	}
+	for key, b := range rl.buckets {
+		if now.Sub(b.last) > idleBucketTTL {
+			delete(rl.buckets, key)
+		}
+	}
+	rl.lastSweep = now
+}
+
+// Limit wraps a handler so each client is limited to the configured rate.
+// Rejected requests get 429 with a Retry-After header in whole seconds.
+func (rl *RateLimiter) Limit(next http.Handler) http.Handler {
+	if !rl.config.Enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed, wait := rl.Allow(clientKey(r, rl.config.ByIP))
+		if !allowed {
+			retryAfter := RetryAfterSeconds(wait)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			apierror.Write(w, r, http.StatusTooManyRequests, "Too Many Requests", RateLimitedError(wait))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AllowRequest takes a token from the bucket of r's client, as Limit does,
+// for handlers that charge one request several times, such as a batch of
+// questions. Every request is allowed when rate limiting is disabled.
+func (rl *RateLimiter) AllowRequest(r *http.Request) (bool, time.Duration) {
+	if !rl.config.Enabled() {
+		return true, 0
+	}
+	return rl.Allow(clientKey(r, rl.config.ByIP))
+}
+
+// RetryAfterSeconds rounds wait up to whole seconds, at least 1, for a
+// Retry-After header.
+func RetryAfterSeconds(wait time.Duration) int {
+	return max(int(math.Ceil(wait.Seconds())), 1)
+}
+
+// RateLimitedError is the error of a request refused until wait has passed.
+func RateLimitedError(wait time.Duration) *apierror.Error {
+	retryAfter := RetryAfterSeconds(wait)
+	return apierror.New(apierror.RateLimited, "rate limit exceeded, retry after "+strconv.Itoa(retryAfter)+"s").
+		WithDetails(map[string]int{"retry_after_seconds": retryAfter})
+}
+
+// LimitFunc is Limit for handler functions.
+func (rl *RateLimiter) LimitFunc(next http.HandlerFunc) http.Handler {
+	return rl.Limit(next)
+}
+
+// clientKey identifies the caller by authenticated user, then tenant API
+// key, then remote IP; with byIP, only by remote IP. The API key counts only
+// once tenant.Middleware has matched it to a tenant, so callers cannot get
+// fresh buckets by sending made-up keys, and it is hashed so bucket names,
+// which may be kept in Redis, do not reveal it.
+func clientKey(r *http.Request, byIP bool) string {
+	if !byIP {
+		if user := auth.UserFromContext(r.Context()); user != nil {
+			return "user:" + auth.UserID(r.Context())
+		}
+		if key := tenant.APIKey(r.Context()); key != "" {
+			hash := sha256.Sum256([]byte(key))
+			return "key:" + hex.EncodeToString(hash[:16])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
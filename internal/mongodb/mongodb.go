@@ -0,0 +1,302 @@
+// Package mongodb connects to a MongoDB database for the mongo_find and
+// mongo_aggregate tools. The connection is configured apart from the SQL
+// database, and everything run through it is checked to be read-only.
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-chatter/internal/redact"
+	"data-chatter/internal/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// ErrForbidden is returned for filters and pipelines that would write, run
+// server-side JavaScript, or read a collection that is not allowed.
+var ErrForbidden = errors.New("forbidden")
+
+// forbiddenOperators write to the database, run server-side JavaScript, or
+// report on other sessions.
+var forbiddenOperators = []string{
+	"$out", "$merge", "$where", "$function", "$accumulator",
+	"$currentOp", "$listSessions", "$listLocalSessions",
+}
+
+// Config holds the MongoDB connection settings.
+type Config struct {
+	URI      string
+	Database string
+
+	// Collections are the only collections queries may read, such as the
+	// ones $lookup joins; empty allows every collection in Database.
+	Collections []string
+
+	// MaxTime bounds how long the server spends on each query.
+	MaxTime time.Duration
+
+	// MaxDocuments caps the documents a query returns.
+	MaxDocuments int
+}
+
+// ConfigFromEnv reads MONGO_URI, MONGO_DATABASE, MONGO_COLLECTIONS (comma
+// separated), MONGO_MAX_TIME, and MONGO_MAX_DOCUMENTS. It returns nil when
+// MONGO_URI is unset. The database defaults to the one named in the URI.
+func ConfigFromEnv() (*Config, error) {
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		return nil, nil
+	}
+	parsed, err := connstring.ParseAndValidate(uri)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MONGO_URI: %w", err)
+	}
+
+	config := &Config{
+		URI:          uri,
+		Database:     os.Getenv("MONGO_DATABASE"),
+		MaxTime:      30 * time.Second,
+		MaxDocuments: 1000,
+	}
+	if config.Database == "" {
+		config.Database = parsed.Database
+	}
+	if config.Database == "" {
+		return nil, fmt.Errorf("MONGO_DATABASE is not set and MONGO_URI names no database")
+	}
+	for _, name := range strings.Split(os.Getenv("MONGO_COLLECTIONS"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			config.Collections = append(config.Collections, name)
+		}
+	}
+	if value := os.Getenv("MONGO_MAX_TIME"); value != "" {
+		maxTime, err := time.ParseDuration(value)
+		if err != nil || maxTime < 0 {
+			return nil, fmt.Errorf("invalid MONGO_MAX_TIME %q", value)
+		}
+		config.MaxTime = maxTime
+	}
+	if value := os.Getenv("MONGO_MAX_DOCUMENTS"); value != "" {
+		maxDocuments, err := strconv.Atoi(value)
+		if err != nil || maxDocuments <= 0 {
+			return nil, fmt.Errorf("invalid MONGO_MAX_DOCUMENTS %q", value)
+		}
+		config.MaxDocuments = maxDocuments
+	}
+	return config, nil
+}
+
+// Client runs read-only queries against one MongoDB database.
+type Client struct {
+	Config *Config
+
+	client   *mongo.Client
+	database *mongo.Database
+}
+
+// Connect creates a client for config. The driver connects lazily, so an
+// unreachable server fails the first query rather than startup. The URI's
+// password is registered with the redact package.
+func Connect(ctx context.Context, config *Config) (*Client, error) {
+	if parsed, err := url.Parse(config.URI); err == nil && parsed.User != nil {
+		password, _ := parsed.User.Password()
+		redact.Secret(password)
+	}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(config.URI).SetAppName("data-chatter"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", redact.Error(err))
+	}
+	return &Client{Config: config, client: client, database: client.Database(config.Database)}, nil
+}
+
+// Close disconnects the client.
+func (c *Client) Close(ctx context.Context) error {
+	return c.client.Disconnect(ctx)
+}
+
+// SourceName identifies the database for result provenance without exposing
+// credentials, e.g. "mongodb://localhost:27017/analytics".
+func (c *Client) SourceName() string {
+	parsed, err := url.Parse(c.Config.URI)
+	if err != nil {
+		return "mongodb:" + c.Config.Database
+	}
+	return (&url.URL{Scheme: parsed.Scheme, Host: parsed.Host, Path: "/" + c.Config.Database}).String()
+}
+
+// CollectionAllowed reports whether queries may read collection.
+func (c *Client) CollectionAllowed(collection string) bool {
+	return len(c.Config.Collections) == 0 || slices.Contains(c.Config.Collections, collection)
+}
+
+// Find returns the documents of collection matching filter, at most limit
+// of them after skipping skip. projection and sort may be nil.
+func (c *Client) Find(ctx context.Context, collection string, filter, projection, sort bson.D, skip, limit int64) ([]bson.D, error) {
+	if err := c.Check(collection, filter); err != nil {
+		return nil, err
+	}
+	if filter == nil {
+		filter = bson.D{}
+	}
+	opts := options.Find().SetLimit(limit).SetMaxTime(c.Config.MaxTime)
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+	if sort != nil {
+		opts.SetSort(sort)
+	}
+	if skip > 0 {
+		opts.SetSkip(skip)
+	}
+	cursor, err := c.database.Collection(collection).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var documents []bson.D
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// Aggregate runs pipeline on collection, returning at most limit documents.
+// Stages that read other collections, such as $lookup and $unionWith, may
+// only name allowed ones.
+func (c *Client) Aggregate(ctx context.Context, collection string, pipeline bson.A, limit int64) ([]bson.D, error) {
+	if err := c.Check(collection, pipeline); err != nil {
+		return nil, err
+	}
+	pipeline = append(slices.Clip(pipeline), bson.D{{Key: "$limit", Value: limit}})
+	opts := options.Aggregate().SetMaxTime(c.Config.MaxTime).SetAllowDiskUse(false)
+	cursor, err := c.database.Collection(collection).Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	var documents []bson.D
+	if err := cursor.All(ctx, &documents); err != nil {
+		return nil, err
+	}
+	return documents, nil
+}
+
+// Check refuses collections that are not allowed and filters or pipelines
+// that use a forbidden operator or read a collection that is not allowed.
+func (c *Client) Check(collection string, value interface{}) error {
+	if !c.CollectionAllowed(collection) {
+		return fmt.Errorf("%w: collection %s is not one of MONGO_COLLECTIONS", ErrForbidden, collection)
+	}
+	return c.walk(value)
+}
+
+// walk checks every key of value, descending into documents and arrays.
+func (c *Client) walk(value interface{}) error {
+	switch v := value.(type) {
+	case bson.D:
+		for _, element := range v {
+			if slices.Contains(forbiddenOperators, element.Key) {
+				return fmt.Errorf("%w: %s is not allowed in read-only queries", ErrForbidden, element.Key)
+			}
+			if err := c.checkJoin(element.Key, element.Value); err != nil {
+				return err
+			}
+			if err := c.walk(element.Value); err != nil {
+				return err
+			}
+		}
+	case bson.A:
+		for _, item := range v {
+			if err := c.walk(item); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkJoin checks the collection a $lookup, $graphLookup, or $unionWith
+// stage reads.
+func (c *Client) checkJoin(operator string, value interface{}) error {
+	var from interface{}
+	switch operator {
+	case "$lookup", "$graphLookup":
+		stage, _ := value.(bson.D)
+		for _, element := range stage {
+			if element.Key == "db" {
+				return fmt.Errorf("%w: %s may not read another database", ErrForbidden, operator)
+			}
+			if element.Key == "from" {
+				from = element.Value
+			}
+		}
+	case "$unionWith":
+		from = value
+		if stage, ok := value.(bson.D); ok {
+			from = nil
+			for _, element := range stage {
+				if element.Key == "coll" {
+					from = element.Value
+				}
+			}
+		}
+	default:
+		return nil
+	}
+	if name, ok := from.(string); ok && !c.CollectionAllowed(name) {
+		return fmt.Errorf("%w: %s reads collection %s, which is not one of MONGO_COLLECTIONS", ErrForbidden, operator, name)
+	}
+	return nil
+}
+
+// ClassifyError maps a MongoDB error to a tool error code, along with the
+// server's error code when there is one, as database.ClassifyError does for
+// SQL errors.
+func ClassifyError(err error) (code, driverCode string) {
+	switch {
+	case errors.Is(err, ErrForbidden):
+		return types.ErrorPermissionDenied, ""
+	case errors.Is(err, context.Canceled):
+		return types.ErrorCancelled, ""
+	case mongo.IsNetworkError(err), errors.As(err, new(topology.ServerSelectionError)):
+		// Checked before timeouts, since a server that cannot be reached
+		// surfaces as a server selection timeout
+		return types.ErrorConnection, ""
+	case mongo.IsTimeout(err):
+		return types.ErrorTimeout, ""
+	}
+
+	var commandErr mongo.CommandError
+	if errors.As(err, &commandErr) {
+		driverCode = strconv.Itoa(int(commandErr.Code))
+		switch commandErr.Code {
+		case 2, 9, 14, 15, 168, 40323, 40324:
+			// Bad values, unparsable documents, and unknown operators or stages
+			return types.ErrorSyntax, driverCode
+		case 13, 18:
+			return types.ErrorPermissionDenied, driverCode
+		case 26:
+			return types.ErrorUndefinedObject, driverCode
+		case 50:
+			return types.ErrorTimeout, driverCode
+		case 146, 292, 10334:
+			return types.ErrorResourceLimit, driverCode
+		case 112:
+			return types.ErrorLockConflict, driverCode
+		case 6, 7, 89, 91, 189, 11600:
+			return types.ErrorConnection, driverCode
+		}
+		return types.ErrorQuery, driverCode
+	}
+	return types.ErrorQuery, ""
+}
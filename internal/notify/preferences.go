@@ -0,0 +1,252 @@
+// Package notify keeps each user's notification preferences: where alerts
+// and scheduled reports are delivered (email, Slack, or a webhook) and the
+// quiet hours during which they are held back.
+package notify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// Delivery channels.
+const (
+	Email   = "email"
+	Slack   = "slack"
+	Webhook = "webhook"
+)
+
+// ErrInvalid is returned for preferences that fail validation.
+var ErrInvalid = errors.New("invalid notification preferences")
+
+// QuietHours is a daily window, in the user's time zone, during which
+// notifications are held back. A window whose end is before its start runs
+// past midnight, e.g. 22:00 to 07:00.
+type QuietHours struct {
+	Start    string `json:"start"`               // HH:MM
+	End      string `json:"end"`                 // HH:MM
+	TimeZone string `json:"time_zone,omitempty"` // IANA name; defaults to UTC
+}
+
+// Preferences holds a user's delivery settings. A channel is used when its
+// destination is set.
+type Preferences struct {
+	Email           string      `json:"email,omitempty"`
+	SlackWebhookURL string      `json:"slack_webhook_url,omitempty"`
+	WebhookURL      string      `json:"webhook_url,omitempty"`
+	QuietHours      *QuietHours `json:"quiet_hours,omitempty"`
+	UpdatedAt       time.Time   `json:"updated_at,omitzero"`
+}
+
+// Validate checks the destinations and quiet hours.
+func (p Preferences) Validate() error {
+	if p.Email != "" {
+		if _, err := mail.ParseAddress(p.Email); err != nil {
+			return fmt.Errorf("%w: email: %v", ErrInvalid, err)
+		}
+	}
+	if err := checkURL("slack_webhook_url", p.SlackWebhookURL); err != nil {
+		return err
+	}
+	if err := checkURL("webhook_url", p.WebhookURL); err != nil {
+		return err
+	}
+	if q := p.QuietHours; q != nil {
+		if _, err := time.Parse("15:04", q.Start); err != nil {
+			return fmt.Errorf("%w: quiet_hours.start must be HH:MM", ErrInvalid)
+		}
+		if _, err := time.Parse("15:04", q.End); err != nil {
+			return fmt.Errorf("%w: quiet_hours.end must be HH:MM", ErrInvalid)
+		}
+		if _, err := time.LoadLocation(q.TimeZone); err != nil {
+			return fmt.Errorf("%w: quiet_hours.time_zone: %v", ErrInvalid, err)
+		}
+	}
+	return nil
+}
+
+// Channels lists the channels the user has a destination for.
+func (p Preferences) Channels() []string {
+	var channels []string
+	if p.Email != "" {
+		channels = append(channels, Email)
+	}
+	if p.SlackWebhookURL != "" {
+		channels = append(channels, Slack)
+	}
+	if p.WebhookURL != "" {
+		channels = append(channels, Webhook)
+	}
+	return channels
+}
+
+// Quiet reports whether at falls within the user's quiet hours, so senders
+// can hold a notification until they end.
+func (p Preferences) Quiet(at time.Time) bool {
+	q := p.QuietHours
+	if q == nil {
+		return false
+	}
+	start, err1 := time.Parse("15:04", q.Start)
+	end, err2 := time.Parse("15:04", q.End)
+	location, err3 := time.LoadLocation(q.TimeZone)
+	if err1 != nil || err2 != nil || err3 != nil || q.Start == q.End {
+		return false
+	}
+
+	local := at.In(location)
+	now := local.Hour()*60 + local.Minute()
+	from, until := start.Hour()*60+start.Minute(), end.Hour()*60+end.Minute()
+	if from < until {
+		return now >= from && now < until
+	}
+	return now >= from || now < until
+}
+
+// checkURL requires an https URL for a webhook destination, if one is set.
+func checkURL(field, raw string) error {
+	if raw == "" {
+		return nil
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%w: %s must be an https URL", ErrInvalid, field)
+	}
+	return nil
+}
+
+// Store holds every user's preferences, optionally persisted to a JSON file
+// so they survive restarts.
+type Store struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string]Preferences
+}
+
+// NewStoreFromEnv creates a store persisted to NOTIFICATION_PREFS_FILE,
+// loading any preferences already in the file. The store is kept in memory
+// only when the variable is unset.
+func NewStoreFromEnv() (*Store, error) {
+	store := &Store{path: os.Getenv("NOTIFICATION_PREFS_FILE"), users: make(map[string]Preferences)}
+	if store.path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read notification preferences: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.users); err != nil {
+		return nil, fmt.Errorf("failed to parse notification preferences: %w", err)
+	}
+	return store, nil
+}
+
+// Get returns userID's preferences, or false if the user has set none.
+func (s *Store) Get(userID string) (Preferences, bool) {
+	if s == nil {
+		return Preferences{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefs, ok := s.users[userID]
+	return prefs, ok
+}
+
+// Set validates and saves userID's preferences, replacing any earlier ones.
+func (s *Store) Set(userID string, prefs Preferences) (Preferences, error) {
+	if err := prefs.Validate(); err != nil {
+		return Preferences{}, err
+	}
+	prefs.UpdatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.users[userID]
+	s.users[userID] = prefs
+	if err := s.save(); err != nil {
+		if existed {
+			s.users[userID] = previous
+		} else {
+			delete(s.users, userID)
+		}
+		return Preferences{}, err
+	}
+	return prefs, nil
+}
+
+// Delete removes userID's preferences, turning their notifications off.
+func (s *Store) Delete(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.users[userID]
+	if !existed {
+		return nil
+	}
+	delete(s.users, userID)
+	if err := s.save(); err != nil {
+		s.users[userID] = previous
+		return err
+	}
+	return nil
+}
+
+// All returns every user's preferences, keyed by user ID.
+func (s *Store) All() map[string]Preferences {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make(map[string]Preferences, len(s.users))
+	for userID, prefs := range s.users {
+		all[userID] = prefs
+	}
+	return all
+}
+
+// Replace swaps every user's preferences for all, as when restoring a backup.
+func (s *Store) Replace(all map[string]Preferences) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.users
+	s.users = make(map[string]Preferences, len(all))
+	for userID, prefs := range all {
+		s.users[userID] = prefs
+	}
+	if err := s.save(); err != nil {
+		s.users = previous
+		return err
+	}
+	return nil
+}
+
+// save writes every user's preferences to the store's file, if it has one,
+// replacing the file atomically. Callers must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode notification preferences: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write notification preferences: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write notification preferences: %w", err)
+	}
+	return nil
+}
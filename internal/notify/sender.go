@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification is an alert or report for one user.
+type Notification struct {
+	// Kind identifies what sent it, e.g. "metric_anomaly", for webhook
+	// consumers routing notifications.
+	Kind    string      `json:"kind"`
+	Subject string      `json:"subject"`
+	Text    string      `json:"text"`
+	Data    interface{} `json:"data,omitempty"` // Machine-readable details, sent to webhooks
+	SentAt  time.Time   `json:"sent_at"`
+}
+
+// held is a notification waiting for its user's quiet hours to end.
+type held struct {
+	userID       string
+	notification Notification
+}
+
+// Sender delivers notifications to the channels in each user's preferences.
+// Email goes through the SMTP server in SMTP_ADDR, from SMTP_FROM, logging in
+// with SMTP_USERNAME and SMTP_PASSWORD when set; without SMTP_ADDR, email
+// destinations are skipped. Notifications due during a user's quiet hours
+// are held in memory until they end, so they are lost if the server stops
+// first.
+type Sender struct {
+	prefs    *Store
+	client   *http.Client
+	smtpAddr string
+	smtpFrom string
+	smtpAuth smtp.Auth
+
+	mu   sync.Mutex
+	held []held
+}
+
+// NewSenderFromEnv creates a sender that reads destinations from prefs.
+func NewSenderFromEnv(prefs *Store) *Sender {
+	s := &Sender{
+		prefs:    prefs,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		smtpAddr: os.Getenv("SMTP_ADDR"),
+		smtpFrom: os.Getenv("SMTP_FROM"),
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		host, _, _ := strings.Cut(s.smtpAddr, ":")
+		s.smtpAuth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return s
+}
+
+// Start delivers held notifications as their users' quiet hours end, until
+// ctx is done.
+func (s *Sender) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.flush(ctx)
+			}
+		}
+	}()
+}
+
+// Send delivers n to every channel userID has a destination for, or holds
+// it until the user's quiet hours end. A user without preferences gets
+// nothing. The returned error joins the failures of each channel.
+func (s *Sender) Send(ctx context.Context, userID string, n Notification) error {
+	if s == nil {
+		return nil
+	}
+	prefs, ok := s.prefs.Get(userID)
+	if !ok || len(prefs.Channels()) == 0 {
+		return nil
+	}
+	if n.SentAt.IsZero() {
+		n.SentAt = time.Now().UTC()
+	}
+	if prefs.Quiet(time.Now()) {
+		s.mu.Lock()
+		s.held = append(s.held, held{userID: userID, notification: n})
+		s.mu.Unlock()
+		return nil
+	}
+	return s.deliver(ctx, prefs, n)
+}
+
+// flush delivers the held notifications whose users' quiet hours are over.
+func (s *Sender) flush(ctx context.Context) {
+	s.mu.Lock()
+	var due []held
+	waiting := s.held[:0]
+	for _, h := range s.held {
+		if prefs, ok := s.prefs.Get(h.userID); ok && prefs.Quiet(time.Now()) {
+			waiting = append(waiting, h)
+		} else {
+			due = append(due, h)
+		}
+	}
+	s.held = waiting
+	s.mu.Unlock()
+
+	for _, h := range due {
+		prefs, _ := s.prefs.Get(h.userID)
+		if err := s.deliver(ctx, prefs, h.notification); err != nil {
+			slog.WarnContext(ctx, "held notification failed", "user_id", h.userID, "kind", h.notification.Kind, "error", err)
+		}
+	}
+}
+
+// deliver sends n to each of prefs' channels.
+func (s *Sender) deliver(ctx context.Context, prefs Preferences, n Notification) error {
+	var errs []error
+	if prefs.Email != "" && s.smtpAddr != "" {
+		if err := s.email(prefs.Email, n); err != nil {
+			errs = append(errs, fmt.Errorf("email: %w", err))
+		}
+	}
+	if prefs.SlackWebhookURL != "" {
+		if err := s.post(ctx, prefs.SlackWebhookURL, map[string]string{"text": "*" + n.Subject + "*\n" + n.Text}); err != nil {
+			errs = append(errs, fmt.Errorf("slack: %w", err))
+		}
+	}
+	if prefs.WebhookURL != "" {
+		if err := s.post(ctx, prefs.WebhookURL, n); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// email sends n as a plain-text message through the SMTP server.
+func (s *Sender) email(to string, n Notification) error {
+	if s.smtpFrom == "" {
+		return errors.New("SMTP_FROM is not set")
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\n", s.smtpFrom, to, strings.ReplaceAll(n.Subject, "\n", " "))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(n.Text, "\n", "\r\n"))
+	return smtp.SendMail(s.smtpAddr, s.smtpAuth, s.smtpFrom, []string{to}, []byte(msg.String()))
+}
+
+// post sends body as JSON to a webhook URL.
+func (s *Sender) post(ctx context.Context, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+// Package orgcontext keeps the organization-wide context document, such as
+// business rules and naming conventions, that is added to every LLM prompt.
+// Every change creates a new version, so an edit that makes answers worse can
+// be rolled back to an earlier version.
+package orgcontext
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// MaxLength bounds the document so it cannot crowd the schema out of the prompt.
+const MaxLength = 32 * 1024
+
+var (
+	// ErrNotFound is returned for unknown versions.
+	ErrNotFound = errors.New("version not found")
+
+	// ErrTooLarge is returned for documents longer than MaxLength.
+	ErrTooLarge = errors.New("context too large")
+)
+
+// Version is one revision of the document. RolledBackFrom is set when the
+// revision restored the content of an earlier version.
+type Version struct {
+	Version        int       `json:"version"`
+	Content        string    `json:"content"`
+	Author         string    `json:"author"`
+	RolledBackFrom int       `json:"rolled_back_from,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Store holds every version of the document, optionally persisted to a JSON
+// file so the history survives restarts.
+type Store struct {
+	mu       sync.RWMutex
+	path     string
+	versions []Version
+}
+
+// NewStoreFromEnv creates a store persisted to ORG_CONTEXT_FILE, loading any
+// history already in the file. The store is kept in memory only when the
+// variable is unset.
+func NewStoreFromEnv() (*Store, error) {
+	store := &Store{path: os.Getenv("ORG_CONTEXT_FILE")}
+	if store.path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read org context: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.versions); err != nil {
+		return nil, fmt.Errorf("failed to parse org context: %w", err)
+	}
+	return store, nil
+}
+
+// Current returns the latest version, or false if the document was never set.
+func (s *Store) Current() (Version, bool) {
+	if s == nil {
+		return Version{}, false
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.versions) == 0 {
+		return Version{}, false
+	}
+	return s.versions[len(s.versions)-1], true
+}
+
+// Versions returns every version, oldest first.
+func (s *Store) Versions() []Version {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Version{}, s.versions...)
+}
+
+// Set saves content as a new version. An empty document clears the context.
+func (s *Store) Set(content, author string) (Version, error) {
+	if len(content) > MaxLength {
+		return Version{}, fmt.Errorf("%w: %d bytes; the limit is %d", ErrTooLarge, len(content), MaxLength)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.add(Version{Content: content, Author: author})
+}
+
+// Rollback saves the content of an earlier version as a new version, leaving
+// the history intact.
+func (s *Store) Rollback(version int, author string) (Version, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if version < 1 || version > len(s.versions) {
+		return Version{}, ErrNotFound
+	}
+	restored := s.versions[version-1]
+	return s.add(Version{Content: restored.Content, Author: author, RolledBackFrom: version})
+}
+
+// Replace swaps the whole history for versions, as when restoring a backup.
+// Versions are renumbered in order, starting from 1.
+func (s *Store) Replace(versions []Version) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.versions
+	s.versions = append([]Version{}, versions...)
+	for i := range s.versions {
+		s.versions[i].Version = i + 1
+	}
+	if err := s.save(); err != nil {
+		s.versions = previous
+		return err
+	}
+	return nil
+}
+
+// add numbers and appends a version and writes the history to disk.
+// Callers must hold s.mu.
+func (s *Store) add(v Version) (Version, error) {
+	v.Version = len(s.versions) + 1
+	v.CreatedAt = time.Now().UTC()
+	s.versions = append(s.versions, v)
+
+	if err := s.save(); err != nil {
+		s.versions = s.versions[:len(s.versions)-1]
+		return Version{}, err
+	}
+	return v, nil
+}
+
+// save writes the history to the store's file, if it has one, replacing the
+// file atomically. Callers must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.versions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode org context: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write org context: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write org context: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Package presence tracks who is viewing each conversation and fans out
+// conversation activity, such as turns asked by teammates and comments left
+// on results, to everyone connected.
+package presence
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event types sent to conversation members.
+const (
+	Present        = "presence"        // Sent on connect: everyone in the conversation
+	Joined         = "joined"          // A user opened the conversation
+	Left           = "left"            // A user's last connection closed
+	TurnStarted    = "turn_started"    // A user asked a question
+	TurnFinished   = "turn_finished"   // A question was answered
+	CommentAdded   = "comment_added"   // A user commented on a result
+	CommentDeleted = "comment_deleted" // A comment was deleted
+)
+
+// memberBuffer bounds how many events wait for a slow connection before
+// further events are dropped.
+const memberBuffer = 32
+
+// Event is one update about a conversation.
+type Event struct {
+	Type           string      `json:"type"`
+	ConversationID string      `json:"conversation_id"`
+	UserID         string      `json:"user_id,omitempty"`
+	Users          []string    `json:"users,omitempty"`
+	TurnID         string      `json:"turn_id,omitempty"`
+	Message        string      `json:"message,omitempty"`
+	Status         int         `json:"status,omitempty"`
+	Data           interface{} `json:"data,omitempty"`
+	Timestamp      time.Time   `json:"timestamp"`
+}
+
+// Member is one connection to a conversation.
+type Member struct {
+	UserID string
+	Events <-chan Event
+
+	send chan Event
+}
+
+// Hub tracks the connections to every conversation.
+type Hub struct {
+	mu    sync.Mutex
+	rooms map[string]map[*Member]struct{}
+}
+
+// NewHub creates an empty hub.
+func NewHub() *Hub {
+	return &Hub{rooms: make(map[string]map[*Member]struct{})}
+}
+
+// Join connects userID to a conversation. The new member first receives a
+// Present event listing everyone connected; the others are told the user
+// joined unless they already had a connection open. Call leave when the
+// connection closes.
+func (h *Hub) Join(conversationID, userID string) (member *Member, leave func()) {
+	send := make(chan Event, memberBuffer)
+	member = &Member{UserID: userID, Events: send, send: send}
+
+	h.mu.Lock()
+	room, exists := h.rooms[conversationID]
+	if !exists {
+		room = make(map[*Member]struct{})
+		h.rooms[conversationID] = room
+	}
+	alreadyPresent := connected(room, userID)
+	room[member] = struct{}{}
+	member.send <- Event{Type: Present, ConversationID: conversationID, Users: users(room), Timestamp: time.Now()}
+	if !alreadyPresent {
+		h.broadcastLocked(room, member, Event{Type: Joined, ConversationID: conversationID, UserID: userID})
+	}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return member, func() {
+		once.Do(func() { h.leave(conversationID, member) })
+	}
+}
+
+// leave disconnects a member, telling the others if it was the user's last connection.
+func (h *Hub) leave(conversationID string, member *Member) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	room := h.rooms[conversationID]
+	delete(room, member)
+	close(member.send)
+	if len(room) == 0 {
+		delete(h.rooms, conversationID)
+		return
+	}
+	if !connected(room, member.UserID) {
+		h.broadcastLocked(room, nil, Event{Type: Left, ConversationID: conversationID, UserID: member.UserID})
+	}
+}
+
+// Broadcast sends an event to everyone connected to its conversation.
+// Slow connections drop events rather than blocking the caller.
+func (h *Hub) Broadcast(event Event) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if room, exists := h.rooms[event.ConversationID]; exists {
+		h.broadcastLocked(room, nil, event)
+	}
+}
+
+// Users lists the users connected to a conversation.
+func (h *Hub) Users(conversationID string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return users(h.rooms[conversationID])
+}
+
+// broadcastLocked sends event to every member of room except skip.
+// Callers must hold h.mu.
+func (h *Hub) broadcastLocked(room map[*Member]struct{}, skip *Member, event Event) {
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	for member := range room {
+		if member == skip {
+			continue
+		}
+		select {
+		case member.send <- event:
+		default:
+		}
+	}
+}
+
+// connected reports whether userID has a connection in room.
+func connected(room map[*Member]struct{}, userID string) bool {
+	for member := range room {
+		if member.UserID == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// users lists the distinct users in room, sorted.
+func users(room map[*Member]struct{}) []string {
+	seen := make(map[string]bool)
+	var list []string
+	for member := range room {
+		if !seen[member.UserID] {
+			seen[member.UserID] = true
+			list = append(list, member.UserID)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
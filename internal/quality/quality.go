@@ -0,0 +1,533 @@
+// Package quality keeps admin-defined data-quality rules, such as "contacts.email
+// is never null" or "orders.contact_id references contacts.id", evaluates
+// them on a schedule, and summarizes the outcome as a scorecard. Rules and
+// their latest results live in the dc_quality_rules table of the connected
+// database, so every replica serves the same scorecard.
+package quality
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/types"
+)
+
+// Table is where rules and their latest results are stored. Its dc_ prefix
+// keeps it out of the schema shown to users and the LLM.
+const Table = database.MetadataTablePrefix + "quality_rules"
+
+// Rule kinds.
+const (
+	// KindNotNull fails for every row where the column is NULL.
+	KindNotNull = "not_null"
+
+	// KindUnique fails for every row repeating another row's value.
+	KindUnique = "unique"
+
+	// KindReferences fails for every non-NULL value missing from the
+	// referenced column, like a foreign key the schema does not declare.
+	KindReferences = "references"
+
+	// KindFreshness fails when the column's latest timestamp is older than
+	// the rule's maximum age.
+	KindFreshness = "freshness"
+)
+
+var (
+	// ErrNotFound is returned when deleting a rule that does not exist.
+	ErrNotFound = errors.New("quality rule not found")
+
+	// ErrInvalid is returned for rules that fail validation.
+	ErrInvalid = errors.New("invalid quality rule")
+)
+
+// Rule is a data-quality check on a table's column, with its latest result.
+type Rule struct {
+	ID     string `json:"id"`
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Kind   string `json:"kind"`
+
+	// References is the "table.column" a references rule checks values against.
+	References string `json:"references,omitempty"`
+
+	// MaxAge is how old, as a duration like "24h", a freshness rule lets the
+	// column's latest timestamp be.
+	MaxAge string `json:"max_age,omitempty"`
+
+	Description string    `json:"description,omitempty"`
+	CreatedBy   string    `json:"created_by"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Result is the latest evaluation, or nil before the first one.
+	Result *Result `json:"result,omitempty"`
+}
+
+// Result is the outcome of evaluating a rule.
+type Result struct {
+	Passed bool `json:"passed"`
+
+	// Checked is the number of rows examined and Violations how many of them
+	// break the rule. A freshness rule has no violating rows.
+	Checked    int64 `json:"checked"`
+	Violations int64 `json:"violations"`
+
+	// Detail explains a freshness result, e.g. the latest timestamp seen.
+	Detail string `json:"detail,omitempty"`
+
+	// Error is why the rule could not be evaluated, such as a dropped column.
+	Error string `json:"error,omitempty"`
+
+	EvaluatedAt time.Time `json:"evaluated_at"`
+}
+
+// Store reads, writes, and evaluates rules in the connected database.
+type Store struct {
+	conn *database.Connection
+}
+
+// NewStore creates the rules table if it does not exist yet.
+func NewStore(ctx context.Context, conn *database.Connection) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		id            VARCHAR(64) NOT NULL PRIMARY KEY,
+		table_name    VARCHAR(255) NOT NULL,
+		column_name   VARCHAR(255) NOT NULL,
+		kind          VARCHAR(32) NOT NULL,
+		reference     VARCHAR(511) NOT NULL,
+		max_age       VARCHAR(64) NOT NULL,
+		description   TEXT NOT NULL,
+		created_by    VARCHAR(255) NOT NULL,
+		created_at    TIMESTAMP NOT NULL,
+		passed        BOOLEAN,
+		checked       BIGINT,
+		violations    BIGINT,
+		detail        TEXT,
+		error_message TEXT,
+		evaluated_at  TIMESTAMP NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	return &Store{conn: conn}, nil
+}
+
+// IntervalFromEnv returns how often rules are evaluated, from
+// QUALITY_INTERVAL (default 1h).
+func IntervalFromEnv() time.Duration {
+	if value, err := time.ParseDuration(os.Getenv("QUALITY_INTERVAL")); err == nil && value > 0 {
+		return value
+	}
+	return time.Hour
+}
+
+// List returns every rule with its latest result, or those of one table when
+// table is set, ordered by table and column.
+func (s *Store) List(ctx context.Context, table string) ([]Rule, error) {
+	if s == nil {
+		return nil, nil
+	}
+
+	query := `SELECT id, table_name, column_name, kind, reference, max_age, description, created_by, created_at,
+		passed, checked, violations, detail, error_message, evaluated_at FROM ` + s.conn.Config.QuoteIdentifier(Table)
+	var args []interface{}
+	if table != "" {
+		query += ` WHERE table_name = ` + s.conn.Config.Placeholder(1)
+		args = append(args, table)
+	}
+	query += ` ORDER BY table_name, column_name, kind, id`
+
+	rows, err := s.conn.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read quality rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var rule Rule
+		var passed sql.NullBool
+		var checked, violations sql.NullInt64
+		var detail, evalErr sql.NullString
+		var evaluatedAt sql.NullTime
+		if err := rows.Scan(&rule.ID, &rule.Table, &rule.Column, &rule.Kind, &rule.References, &rule.MaxAge, &rule.Description,
+			&rule.CreatedBy, &rule.CreatedAt, &passed, &checked, &violations, &detail, &evalErr, &evaluatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan quality rule: %w", err)
+		}
+		if evaluatedAt.Valid {
+			rule.Result = &Result{
+				Passed:      passed.Bool,
+				Checked:     checked.Int64,
+				Violations:  violations.Int64,
+				Detail:      detail.String,
+				Error:       evalErr.String,
+				EvaluatedAt: evaluatedAt.Time,
+			}
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// Add validates and saves a new rule. Its table and columns must exist.
+func (s *Store) Add(ctx context.Context, rule Rule) (Rule, error) {
+	rule.Table, rule.Column = strings.TrimSpace(rule.Table), strings.TrimSpace(rule.Column)
+	rule.Description = strings.TrimSpace(rule.Description)
+	if err := s.check(ctx, &rule); err != nil {
+		return Rule{}, err
+	}
+	rule.ID = newID()
+	rule.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	rule.Result = nil
+
+	config := s.conn.Config
+	placeholders := make([]string, 9)
+	for i := range placeholders {
+		placeholders[i] = config.Placeholder(i + 1)
+	}
+	_, err := s.conn.DB.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, table_name, column_name, kind, reference, max_age, description, created_by, created_at) VALUES (%s)`,
+		config.QuoteIdentifier(Table), strings.Join(placeholders, ", ")),
+		rule.ID, rule.Table, rule.Column, rule.Kind, rule.References, rule.MaxAge, rule.Description, rule.CreatedBy, rule.CreatedAt)
+	if err != nil {
+		return Rule{}, fmt.Errorf("failed to save quality rule: %w", err)
+	}
+	return rule, nil
+}
+
+// Delete removes the rule with the given ID.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	config := s.conn.Config
+	result, err := s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE id = %s`, config.QuoteIdentifier(Table), config.Placeholder(1)), id)
+	if err != nil {
+		return fmt.Errorf("failed to delete quality rule: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Evaluate checks every rule and saves each result. A rule that cannot be
+// checked, say because its column was dropped, is saved as failed with the
+// reason; only failures to read or write the rules themselves are returned.
+// It runs as a scheduled task.
+func (s *Store) Evaluate(ctx context.Context) error {
+	rules, err := s.List(ctx, "")
+	if err != nil {
+		return err
+	}
+
+	config := s.conn.Config
+	update := fmt.Sprintf(`UPDATE %s SET passed = %s, checked = %s, violations = %s, detail = %s, error_message = %s, evaluated_at = %s WHERE id = %s`,
+		config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3),
+		config.Placeholder(4), config.Placeholder(5), config.Placeholder(6), config.Placeholder(7))
+	for _, rule := range rules {
+		result := s.evaluate(ctx, rule)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if result.Error != "" {
+			slog.WarnContext(ctx, "quality rule could not be evaluated", "rule", rule.ID, "table", rule.Table, "column", rule.Column, "error", result.Error)
+		}
+		if _, err := s.conn.DB.ExecContext(ctx, update, result.Passed, result.Checked, result.Violations,
+			result.Detail, result.Error, result.EvaluatedAt, rule.ID); err != nil {
+			return fmt.Errorf("failed to save quality result: %w", err)
+		}
+	}
+	return nil
+}
+
+// evaluate checks one rule. Its queries run read-only through
+// Connection.Query like any other.
+func (s *Store) evaluate(ctx context.Context, rule Rule) Result {
+	result := Result{EvaluatedAt: time.Now().UTC().Truncate(time.Second)}
+	quote := s.conn.Config.QuoteIdentifier
+	table, column := quote(rule.Table), quote(rule.Column)
+
+	var query string
+	switch rule.Kind {
+	case KindNotNull:
+		query = fmt.Sprintf(`SELECT COUNT(*), COUNT(*) - COUNT(%s) FROM %s`, column, table)
+	case KindUnique:
+		query = fmt.Sprintf(`SELECT COUNT(%[1]s), COUNT(%[1]s) - COUNT(DISTINCT %[1]s) FROM %[2]s`, column, table)
+	case KindReferences:
+		refTable, refColumn, _ := splitReference(rule.References)
+		query = fmt.Sprintf(`SELECT COUNT(*), COALESCE(SUM(CASE WHEN EXISTS (SELECT 1 FROM %[3]s r WHERE r.%[4]s = t.%[2]s) THEN 0 ELSE 1 END), 0)
+			FROM %[1]s t WHERE t.%[2]s IS NOT NULL`, table, column, quote(refTable), quote(refColumn))
+	case KindFreshness:
+		return s.evaluateFreshness(ctx, rule, result)
+	default:
+		result.Error = fmt.Sprintf("unknown rule kind %q", rule.Kind)
+		return result
+	}
+
+	if err := s.queryRow(ctx, query, &result.Checked, &result.Violations); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Passed = result.Violations == 0
+	return result
+}
+
+// evaluateFreshness compares the column's latest timestamp with the rule's
+// maximum age.
+func (s *Store) evaluateFreshness(ctx context.Context, rule Rule, result Result) Result {
+	maxAge, err := time.ParseDuration(rule.MaxAge)
+	if err != nil {
+		result.Error = fmt.Sprintf("invalid max_age: %v", err)
+		return result
+	}
+
+	var latest interface{}
+	query := fmt.Sprintf(`SELECT COUNT(*), MAX(%s) FROM %s`, s.conn.Config.QuoteIdentifier(rule.Column), s.conn.Config.QuoteIdentifier(rule.Table))
+	if err := s.queryRow(ctx, query, &result.Checked, &latest); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if latest == nil {
+		result.Detail = "the column has no timestamps"
+		return result
+	}
+	at, ok := parseTime(latest)
+	if !ok {
+		result.Error = fmt.Sprintf("latest value %v is not a timestamp", latest)
+		return result
+	}
+
+	age := result.EvaluatedAt.Sub(at).Truncate(time.Second)
+	result.Passed = age <= maxAge
+	result.Detail = fmt.Sprintf("latest %s is %s old; the limit is %s", at.UTC().Format(time.RFC3339), age, maxAge)
+	return result
+}
+
+// queryRow runs a single-row query and scans it into dest.
+func (s *Store) queryRow(ctx context.Context, query string, dest ...interface{}) error {
+	rows, err := s.conn.Query(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		return sql.ErrNoRows
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+// check validates a rule against the schema, normalizing its kind.
+func (s *Store) check(ctx context.Context, rule *Rule) error {
+	rule.Kind = strings.ToLower(strings.TrimSpace(rule.Kind))
+	if rule.Table == "" || rule.Column == "" {
+		return fmt.Errorf("%w: table and column are required", ErrInvalid)
+	}
+	if err := s.checkColumn(ctx, rule.Table, rule.Column); err != nil {
+		return err
+	}
+
+	switch rule.Kind {
+	case KindNotNull, KindUnique:
+		rule.References, rule.MaxAge = "", ""
+	case KindReferences:
+		refTable, refColumn, ok := splitReference(rule.References)
+		if !ok {
+			return fmt.Errorf("%w: references must name a column as table.column", ErrInvalid)
+		}
+		if err := s.checkColumn(ctx, refTable, refColumn); err != nil {
+			return err
+		}
+		rule.MaxAge = ""
+	case KindFreshness:
+		maxAge, err := time.ParseDuration(rule.MaxAge)
+		if err != nil || maxAge <= 0 {
+			return fmt.Errorf("%w: max_age must be a positive duration like \"24h\"", ErrInvalid)
+		}
+		rule.References = ""
+	default:
+		return fmt.Errorf("%w: kind must be one of %s, %s, %s, or %s", ErrInvalid, KindNotNull, KindUnique, KindReferences, KindFreshness)
+	}
+	return nil
+}
+
+// checkColumn verifies that table has column.
+func (s *Store) checkColumn(ctx context.Context, table, column string) error {
+	exists, err := s.conn.HasTable(ctx, table)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: table %s does not exist", ErrInvalid, table)
+	}
+
+	columns, err := s.conn.TableColumns(ctx, table)
+	if err != nil {
+		return err
+	}
+	for _, col := range columns {
+		if col.Name == column {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: column %s.%s does not exist", ErrInvalid, table, column)
+}
+
+// splitReference splits "table.column" at its last dot.
+func splitReference(reference string) (table, column string, ok bool) {
+	i := strings.LastIndex(reference, ".")
+	if i <= 0 || i == len(reference)-1 {
+		return "", "", false
+	}
+	return reference[:i], reference[i+1:], true
+}
+
+// timeLayouts are the text forms timestamps are parsed from, as SQLite
+// returns them for expressions like MAX(created_at).
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02",
+}
+
+// parseTime reads a timestamp scanned from the database: a time, text in
+// one of timeLayouts (as UTC when it has no zone), or Unix seconds.
+func parseTime(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case int64:
+		return time.Unix(v, 0), true
+	case []byte:
+		return parseTime(string(v))
+	case string:
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Visible returns the rules whose columns, including a referenced one, the
+// caller in ctx may see. A nil filter hides nothing.
+func Visible(ctx context.Context, rules []Rule, filter types.SchemaFilter) []Rule {
+	if filter == nil {
+		return rules
+	}
+	visible := make([]Rule, 0, len(rules))
+	for _, rule := range rules {
+		if !filter.ColumnVisible(ctx, rule.Table, rule.Column) {
+			continue
+		}
+		if refTable, refColumn, ok := splitReference(rule.References); ok && !filter.ColumnVisible(ctx, refTable, refColumn) {
+			continue
+		}
+		visible = append(visible, rule)
+	}
+	return visible
+}
+
+// Scorecard summarizes the latest results of a set of rules.
+type Scorecard struct {
+	// Score is the percentage of evaluated rules that passed. Rules that
+	// could not be evaluated count as failed.
+	Score     float64      `json:"score"`
+	Rules     int          `json:"rules"`
+	Passed    int          `json:"passed"`
+	Failed    int          `json:"failed"`
+	Errored   int          `json:"errored"`
+	Pending   int          `json:"pending"` // Not evaluated yet
+	Tables    []TableScore `json:"tables"`
+	UpdatedAt *time.Time   `json:"updated_at,omitempty"`
+}
+
+// TableScore is the scorecard of one table's rules.
+type TableScore struct {
+	Table   string  `json:"table"`
+	Score   float64 `json:"score"`
+	Passed  int     `json:"passed"`
+	Failed  int     `json:"failed"`
+	Errored int     `json:"errored"`
+	Pending int     `json:"pending"`
+	Rules   []Rule  `json:"rules"`
+}
+
+// NewScorecard summarizes rules, as returned by List, per table and overall.
+func NewScorecard(rules []Rule) Scorecard {
+	card := Scorecard{Rules: len(rules), Tables: []TableScore{}}
+	byTable := make(map[string]*TableScore)
+	var order []string
+	for _, rule := range rules {
+		table := byTable[rule.Table]
+		if table == nil {
+			table = &TableScore{Table: rule.Table}
+			byTable[rule.Table] = table
+			order = append(order, rule.Table)
+		}
+		table.Rules = append(table.Rules, rule)
+
+		switch result := rule.Result; {
+		case result == nil:
+			table.Pending++
+		case result.Error != "":
+			table.Errored++
+		case result.Passed:
+			table.Passed++
+		default:
+			table.Failed++
+		}
+		if rule.Result != nil && (card.UpdatedAt == nil || rule.Result.EvaluatedAt.After(*card.UpdatedAt)) {
+			at := rule.Result.EvaluatedAt
+			card.UpdatedAt = &at
+		}
+	}
+
+	sort.Strings(order)
+	for _, name := range order {
+		table := byTable[name]
+		table.Score = score(table.Passed, table.Failed+table.Errored)
+		card.Passed += table.Passed
+		card.Failed += table.Failed
+		card.Errored += table.Errored
+		card.Pending += table.Pending
+		card.Tables = append(card.Tables, *table)
+	}
+	card.Score = score(card.Passed, card.Failed+card.Errored)
+	return card
+}
+
+// score is the percentage of passed among passed and failed, rounded to one
+// decimal, or 100 when nothing was evaluated.
+func score(passed, failed int) float64 {
+	if passed+failed == 0 {
+		return 100
+	}
+	return float64(passed*1000/(passed+failed)) / 10
+}
+
+// newID returns a random rule ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
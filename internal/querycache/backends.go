@@ -0,0 +1,87 @@
+package querycache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"data-chatter/internal/redis"
+)
+
+// memoryBackend keeps up to size results in memory, evicting the least
+// recently used.
+type memoryBackend struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List // Of *memoryEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key       string
+	value     []byte
+	expiresAt time.Time
+}
+
+func newMemoryBackend(size int) *memoryBackend {
+	return &memoryBackend{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (m *memoryBackend) Get(_ context.Context, key string) ([]byte, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	element, ok := m.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	entry := element.Value.(*memoryEntry)
+	if time.Now().After(entry.expiresAt) {
+		m.order.Remove(element)
+		delete(m.entries, key)
+		return nil, false, nil
+	}
+	m.order.MoveToFront(element)
+	return entry.value, true, nil
+}
+
+func (m *memoryBackend) Set(_ context.Context, key string, value []byte, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry := &memoryEntry{key: key, value: value, expiresAt: time.Now().Add(ttl)}
+	if element, ok := m.entries[key]; ok {
+		element.Value = entry
+		m.order.MoveToFront(element)
+		return nil
+	}
+	m.entries[key] = m.order.PushFront(entry)
+	for m.order.Len() > m.size {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryEntry).key)
+	}
+	return nil
+}
+
+func (m *memoryBackend) len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// redisKeyPrefix namespaces the cache's keys in a shared Redis.
+const redisKeyPrefix = redis.KeyPrefix + "query:"
+
+// redisBackend stores results in Redis, so every replica shares them.
+type redisBackend struct {
+	client *redis.Client
+}
+
+func (r redisBackend) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	return r.client.Get(ctx, redisKeyPrefix+key)
+}
+
+func (r redisBackend) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return r.client.Set(ctx, redisKeyPrefix+key, value, ttl)
+}
@@ -0,0 +1,226 @@
+// Package querycache keeps query results for a short time, so a query run
+// again soon, as the LLM often does while answering related questions, is
+// answered without the database. Results live in memory, or in Redis when
+// QUERY_CACHE_REDIS_ADDR or REDIS_ADDR is set so that every replica shares
+// them.
+package querycache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"data-chatter/internal/redis"
+	"data-chatter/internal/sqlparse"
+)
+
+const (
+	defaultTTL  = time.Minute
+	defaultSize = 1000
+)
+
+// Backend stores cached results. Get reports a missing or expired key as
+// not found rather than as an error.
+type Backend interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// Cache is a result cache with hit and miss counters. A nil *Cache caches
+// nothing.
+type Cache struct {
+	backend Backend
+	name    string
+	ttl     time.Duration
+
+	hits     atomic.Int64
+	misses   atomic.Int64
+	bypassed atomic.Int64
+	failures atomic.Int64
+}
+
+// Stats reports how the cache has been doing since the server started.
+type Stats struct {
+	Backend    string  `json:"backend"`
+	TTLSeconds float64 `json:"ttl_seconds"`
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	Bypassed   int64   `json:"bypassed"` // Lookups skipped by a no-cache or no-store directive
+	Failures   int64   `json:"failures"` // Backend errors, each counted as a miss
+	HitRate    float64 `json:"hit_rate"`
+	Entries    *int    `json:"entries,omitempty"` // In-memory entries; unknown for Redis
+}
+
+// New creates a cache keeping results in backend for ttl.
+func New(backend Backend, name string, ttl time.Duration) *Cache {
+	return &Cache{backend: backend, name: name, ttl: ttl}
+}
+
+// NewFromEnv creates the cache configured by QUERY_CACHE_TTL (default 1m;
+// 0 disables caching and returns nil) and either QUERY_CACHE_SIZE, the
+// results kept in memory (default 1000), or QUERY_CACHE_REDIS_ADDR with
+// QUERY_CACHE_REDIS_PASSWORD for a Redis of its own. Otherwise results are
+// kept in shared, the Redis of REDIS_ADDR, when it is not nil.
+func NewFromEnv(shared *redis.Client) (*Cache, error) {
+	ttl := defaultTTL
+	if value := os.Getenv("QUERY_CACHE_TTL"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid QUERY_CACHE_TTL %q: must be a duration like \"1m\", or 0", value)
+		}
+		ttl = parsed
+	}
+	if ttl == 0 {
+		return nil, nil
+	}
+
+	if addr := os.Getenv("QUERY_CACHE_REDIS_ADDR"); addr != "" {
+		shared = redis.New(addr, os.Getenv("QUERY_CACHE_REDIS_PASSWORD"))
+	}
+	if shared != nil {
+		return New(redisBackend{client: shared}, "redis", ttl), nil
+	}
+	size := defaultSize
+	if value, err := strconv.Atoi(os.Getenv("QUERY_CACHE_SIZE")); err == nil && value > 0 {
+		size = value
+	}
+	return New(newMemoryBackend(size), "memory", ttl), nil
+}
+
+// Key derives a cache key from a query, its bind arguments, and a variant
+// naming anything else that changes the result, such as masking.
+// Whitespace and comments in the query do not change the key.
+func Key(query string, args []interface{}, variant string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s", variant, normalize(query))
+	for _, arg := range args {
+		fmt.Fprintf(h, "%T:%v\x00", arg, arg)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the result cached under key, honoring the directive's
+// no-cache, no-store, and max-age.
+func (c *Cache) Get(ctx context.Context, key string, directive Directive) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	if directive.NoCache || directive.NoStore {
+		c.bypassed.Add(1)
+		return nil, false
+	}
+
+	data, ok, err := c.backend.Get(ctx, key)
+	if err != nil {
+		c.failures.Add(1)
+		slog.WarnContext(ctx, "query cache read failed", "backend", c.name, "error", err)
+	}
+	if !ok || len(data) < 8 {
+		c.misses.Add(1)
+		return nil, false
+	}
+	storedAt := time.UnixMilli(int64(binary.BigEndian.Uint64(data)))
+	if directive.MaxAge >= 0 && time.Since(storedAt) > directive.MaxAge {
+		c.misses.Add(1)
+		return nil, false
+	}
+	c.hits.Add(1)
+	return data[8:], true
+}
+
+// Set caches value under key unless the directive says no-store.
+func (c *Cache) Set(ctx context.Context, key string, value []byte, directive Directive) {
+	if c == nil {
+		return
+	}
+	c.SetFor(ctx, key, value, directive, c.ttl)
+}
+
+// SetFor is Set keeping value for ttl instead of the cache's TTL, for results
+// whose sources declare how long they stay fresh.
+func (c *Cache) SetFor(ctx context.Context, key string, value []byte, directive Directive, ttl time.Duration) {
+	if c == nil || directive.NoStore || ttl <= 0 {
+		return
+	}
+	data := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(data, uint64(time.Now().UnixMilli()))
+	data = append(data, value...)
+	if err := c.backend.Set(ctx, key, data, ttl); err != nil {
+		c.failures.Add(1)
+		slog.WarnContext(ctx, "query cache write failed", "backend", c.name, "error", err)
+	}
+}
+
+// Stats returns the cache's counters.
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{Backend: "off"}
+	}
+	stats := Stats{
+		Backend:    c.name,
+		TTLSeconds: c.ttl.Seconds(),
+		Hits:       c.hits.Load(),
+		Misses:     c.misses.Load(),
+		Bypassed:   c.bypassed.Load(),
+		Failures:   c.failures.Load(),
+	}
+	if lookups := stats.Hits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.Hits) / float64(lookups)
+	}
+	if memory, ok := c.backend.(*memoryBackend); ok {
+		entries := memory.len()
+		stats.Entries = &entries
+	}
+	return stats
+}
+
+// Directive is how a caller wants the cache used, from a Cache-Control
+// header: NoCache skips cached results but caches the new one, NoStore
+// neither reads nor writes the cache, and a non-negative MaxAge only
+// accepts results cached at most that long ago.
+type Directive struct {
+	NoCache bool
+	NoStore bool
+	MaxAge  time.Duration
+}
+
+// ParseDirective reads the no-cache, no-store, and max-age directives of a
+// Cache-Control header, ignoring any others.
+func ParseDirective(header string) Directive {
+	d := Directive{MaxAge: -1}
+	for _, part := range strings.Split(header, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch strings.ToLower(name) {
+		case "no-cache":
+			d.NoCache = true
+		case "no-store":
+			d.NoStore = true
+		case "max-age":
+			if seconds, err := strconv.Atoi(strings.Trim(value, `"`)); err == nil && seconds >= 0 {
+				d.MaxAge = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	return d
+}
+
+// normalize reduces query to its tokens, so whitespace, comments, and
+// semicolons do not matter.
+func normalize(query string) string {
+	var b strings.Builder
+	for _, tok := range sqlparse.Tokenize(query) {
+		if tok.Kind == sqlparse.Symbol && tok.Value == ";" {
+			continue
+		}
+		fmt.Fprintf(&b, "%d%s\x00", tok.Kind, tok.Value)
+	}
+	return b.String()
+}
@@ -0,0 +1,310 @@
+// Package rbac enforces role-based access control over tools, tables, and
+// columns for authenticated users.
+package rbac
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+	"data-chatter/internal/sqlparse"
+)
+
+// wildcard grants access to every tool, table, or column.
+const wildcard = "*"
+
+// ErrForbidden is wrapped by every access-control denial.
+var ErrForbidden = errors.New("permission denied")
+
+// ErrNoPolicyFile is returned when saving a policy without RBAC_POLICY_FILE set.
+var ErrNoPolicyFile = errors.New("RBAC_POLICY_FILE is not set")
+
+// Role lists what holders of a role may use. Tables maps table names to the
+// columns the role may read; ["*"] grants every column and a "*" table key
+// grants every table. Unmask lets holders see the personal data that
+// PII_MASK_COLUMNS otherwise masks in query results.
+type Role struct {
+	Tools  []string            `json:"tools"`
+	Tables map[string][]string `json:"tables"`
+	Unmask bool                `json:"unmask,omitempty"`
+}
+
+// Policy maps role names to their grants. Users without any configured role
+// fall back to DefaultRole; if that is empty they are denied.
+type Policy struct {
+	DefaultRole string          `json:"default_role"`
+	Roles       map[string]Role `json:"roles"`
+}
+
+// LoadPolicyFromEnv reads the JSON policy named by RBAC_POLICY_FILE.
+// It returns nil, disabling access control, when the variable is unset.
+func LoadPolicyFromEnv() (*Policy, error) {
+	path := os.Getenv("RBAC_POLICY_FILE")
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RBAC policy: %w", err)
+	}
+
+	var policy Policy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse RBAC policy: %w", err)
+	}
+	return &policy, nil
+}
+
+// SavePolicyToEnv writes policy to the file named by RBAC_POLICY_FILE,
+// replacing it atomically, so it is the policy loaded on the next start.
+func SavePolicyToEnv(policy *Policy) error {
+	path := os.Getenv("RBAC_POLICY_FILE")
+	if path == "" {
+		return ErrNoPolicyFile
+	}
+
+	data, err := json.MarshalIndent(policy, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode RBAC policy: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write RBAC policy: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write RBAC policy: %w", err)
+	}
+	return nil
+}
+
+// Authorizer checks tool calls and SQL statements against a policy, which
+// can be replaced while the server runs.
+type Authorizer struct {
+	policy atomic.Pointer[Policy]
+	conn   *database.Connection
+}
+
+// NewAuthorizer creates an authorizer. A nil policy allows everything.
+func NewAuthorizer(policy *Policy, conn *database.Connection) *Authorizer {
+	a := &Authorizer{conn: conn}
+	a.policy.Store(policy)
+	return a
+}
+
+// Policy returns the policy in force, or nil when access control is off.
+func (a *Authorizer) Policy() *Policy {
+	if a == nil {
+		return nil
+	}
+	return a.policy.Load()
+}
+
+// SetPolicy replaces the policy for the checks that follow.
+func (a *Authorizer) SetPolicy(policy *Policy) {
+	a.policy.Store(policy)
+}
+
+// grants is the union of a user's role grants.
+type grants struct {
+	tools  map[string]bool
+	tables map[string]map[string]bool // lower-case table -> lower-case columns
+	unmask bool
+}
+
+// grantsFor merges the roles held by the user in ctx under policy.
+func grantsFor(ctx context.Context, policy *Policy) (*grants, []string) {
+	var roles []string
+	if user := auth.UserFromContext(ctx); user != nil {
+		roles = user.Roles
+	}
+	if len(roles) == 0 && policy.DefaultRole != "" {
+		roles = []string{policy.DefaultRole}
+	}
+
+	g := &grants{
+		tools:  make(map[string]bool),
+		tables: make(map[string]map[string]bool),
+	}
+	for _, name := range roles {
+		role, ok := policy.Roles[name]
+		if !ok {
+			continue
+		}
+		for _, tool := range role.Tools {
+			g.tools[tool] = true
+		}
+		g.unmask = g.unmask || role.Unmask
+		for table, columns := range role.Tables {
+			key := strings.ToLower(table)
+			if g.tables[key] == nil {
+				g.tables[key] = make(map[string]bool)
+			}
+			for _, col := range columns {
+				g.tables[key][strings.ToLower(col)] = true
+			}
+		}
+	}
+	return g, roles
+}
+
+// Authorize checks that the user may call tool and, for inputs naming
+// SQL or tables, that every referenced table and column is granted.
+func (a *Authorizer) Authorize(ctx context.Context, tool string, input map[string]interface{}) error {
+	policy := a.Policy()
+	if policy == nil {
+		return nil
+	}
+
+	g, roles := grantsFor(ctx, policy)
+	if !g.tools[wildcard] && !g.tools[tool] {
+		return fmt.Errorf("%w: roles %v may not use tool %s", ErrForbidden, roles, tool)
+	}
+
+	if query, ok := input["query"].(string); ok && query != "" {
+		if err := a.checkQuery(ctx, g, query); err != nil {
+			return err
+		}
+	}
+
+	if table, ok := input["table"].(string); ok && table != "" {
+		if err := checkTable(g, table); err != nil {
+			return err
+		}
+		columns, _ := input["columns"].([]interface{})
+		if column, ok := input["column"].(string); ok && column != "" {
+			columns = append(columns, column)
+		}
+		if len(columns) > 0 {
+			for _, raw := range columns {
+				col, _ := raw.(string)
+				if !columnAllowed(g, table, col) {
+					return fmt.Errorf("%w: column %s.%s is not accessible", ErrForbidden, table, col)
+				}
+			}
+		} else if !columnAllowed(g, table, wildcard) {
+			return fmt.Errorf("%w: table %s is only partially accessible; name the columns explicitly", ErrForbidden, table)
+		}
+	}
+
+	return nil
+}
+
+// AuthorizeQuery checks a SQL statement run outside the tool registry.
+func (a *Authorizer) AuthorizeQuery(ctx context.Context, query string) error {
+	return a.Authorize(ctx, "database_query", map[string]interface{}{"query": query})
+}
+
+// ToolAllowed reports whether the user in ctx may call tool, so the tools
+// offered to the model can leave out those the user's roles do not grant.
+func (a *Authorizer) ToolAllowed(ctx context.Context, tool string) bool {
+	policy := a.Policy()
+	if policy == nil {
+		return true
+	}
+	g, _ := grantsFor(ctx, policy)
+	return g.tools[wildcard] || g.tools[tool]
+}
+
+// TableVisible reports whether the user in ctx may read table, so listings
+// such as autocomplete can hide tables the user cannot query.
+func (a *Authorizer) TableVisible(ctx context.Context, table string) bool {
+	policy := a.Policy()
+	if policy == nil {
+		return true
+	}
+	g, _ := grantsFor(ctx, policy)
+	return checkTable(g, table) == nil
+}
+
+// ColumnVisible reports whether the user in ctx may read column of table.
+func (a *Authorizer) ColumnVisible(ctx context.Context, table, column string) bool {
+	policy := a.Policy()
+	if policy == nil {
+		return true
+	}
+	g, _ := grantsFor(ctx, policy)
+	return checkTable(g, table) == nil && columnAllowed(g, table, column)
+}
+
+// MayUnmask reports whether the user in ctx holds a role that sees masked
+// personal data unmasked. Without a policy nobody does, since masking is
+// configured apart from access control.
+func (a *Authorizer) MayUnmask(ctx context.Context) bool {
+	policy := a.Policy()
+	if policy == nil {
+		return false
+	}
+	g, _ := grantsFor(ctx, policy)
+	return g.unmask
+}
+
+// checkQuery validates the tables a query reads and, for tables with column
+// restrictions, that it names no forbidden columns and does not SELECT *.
+func (a *Authorizer) checkQuery(ctx context.Context, g *grants, query string) error {
+	tables := sqlparse.ReferencedTables(query)
+	mentioned := make(map[string]bool)
+	for _, ident := range sqlparse.Identifiers(query) {
+		mentioned[ident] = true
+	}
+
+	for _, table := range tables {
+		if err := checkTable(g, table); err != nil {
+			return err
+		}
+		if columnAllowed(g, table, wildcard) {
+			continue
+		}
+
+		if sqlparse.HasSelectStar(query) {
+			return fmt.Errorf("%w: SELECT * is not allowed on %s; name the permitted columns explicitly", ErrForbidden, table)
+		}
+
+		columns, err := a.conn.For(ctx).TableColumns(ctx, baseName(table))
+		if err != nil {
+			return fmt.Errorf("failed to check column permissions: %w", err)
+		}
+		for _, col := range columns {
+			if mentioned[strings.ToLower(col.Name)] && !columnAllowed(g, table, col.Name) {
+				return fmt.Errorf("%w: column %s.%s is not accessible", ErrForbidden, table, col.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// checkTable verifies the table (or its unqualified name) is granted.
+func checkTable(g *grants, table string) error {
+	if g.tables[wildcard] != nil || g.tables[strings.ToLower(table)] != nil || g.tables[strings.ToLower(baseName(table))] != nil {
+		return nil
+	}
+	return fmt.Errorf("%w: table %s is not accessible", ErrForbidden, table)
+}
+
+// columnAllowed reports whether column of table is granted.
+func columnAllowed(g *grants, table, column string) bool {
+	for _, key := range []string{strings.ToLower(table), strings.ToLower(baseName(table)), wildcard} {
+		cols := g.tables[key]
+		if cols == nil {
+			continue
+		}
+		if cols[wildcard] || cols[strings.ToLower(column)] {
+			return true
+		}
+	}
+	return false
+}
+
+// baseName strips a schema qualifier from a table name.
+func baseName(table string) string {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		return table[i+1:]
+	}
+	return table
+}
@@ -0,0 +1,186 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+)
+
+// testPolicy grants analysts every tool and table but only some contacts
+// columns, support only database_query on orders, and admins everything.
+var testPolicy = &Policy{
+	DefaultRole: "support",
+	Roles: map[string]Role{
+		"admin": {Tools: []string{"*"}, Tables: map[string][]string{"*": {"*"}}, Unmask: true},
+		"analyst": {
+			Tools: []string{"*"},
+			Tables: map[string][]string{
+				"contacts":       {"id", "name", "created_at"},
+				"orders":         {"*"},
+				"public.invoice": {"*"},
+			},
+		},
+		"support": {Tools: []string{"database_query"}, Tables: map[string][]string{"orders": {"*"}}},
+	},
+}
+
+// newTestAuthorizer returns an authorizer for policy over a SQLite database
+// with contacts and orders tables, whose columns checkQuery looks up.
+func newTestAuthorizer(t *testing.T, policy *Policy) *Authorizer {
+	t.Helper()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+
+	conn, err := database.NewConnection(&database.Config{
+		Type:     "sqlite",
+		FilePath: filepath.Join(t.TempDir(), "rbac.db"),
+		MaxConns: 1,
+		MaxIdle:  1,
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	for _, statement := range []string{
+		`CREATE TABLE contacts (id INTEGER PRIMARY KEY, name TEXT, email TEXT, phone_number TEXT, created_at TIMESTAMP)`,
+		`CREATE TABLE orders (id INTEGER PRIMARY KEY, contact_id INTEGER, total REAL)`,
+	} {
+		if _, err := conn.DB.Exec(statement); err != nil {
+			t.Fatalf("failed to create table: %v", err)
+		}
+	}
+	return NewAuthorizer(policy, conn)
+}
+
+// asUser returns a context for a user holding roles.
+func asUser(roles ...string) context.Context {
+	return auth.WithUser(context.Background(), &auth.User{ID: "u1", Roles: roles}, "")
+}
+
+func TestAuthorizeQuery(t *testing.T) {
+	authorizer := newTestAuthorizer(t, testPolicy)
+
+	tests := []struct {
+		name    string
+		roles   []string
+		query   string
+		allowed bool
+	}{
+		{"granted columns", []string{"analyst"}, "SELECT id, name FROM contacts", true},
+		{"forbidden column", []string{"analyst"}, "SELECT email FROM contacts", false},
+		{"forbidden column qualified by alias", []string{"analyst"}, "SELECT c.id, c.email FROM contacts c", false},
+		{"forbidden column quoted", []string{"analyst"}, `SELECT "Email" FROM contacts`, false},
+		{"forbidden column in WHERE", []string{"analyst"}, "SELECT id FROM contacts WHERE phone_number LIKE '555%'", false},
+		{"select star on restricted table", []string{"analyst"}, "SELECT * FROM contacts", false},
+		{"qualified star on restricted table", []string{"analyst"}, "SELECT c.* FROM contacts c", false},
+		{"select star on fully granted table", []string{"analyst"}, "SELECT * FROM orders", true},
+		{"forbidden column only in comment", []string{"analyst"}, "SELECT id FROM contacts /* email */ -- phone_number", true},
+		{"forbidden column name in string", []string{"analyst"}, "SELECT id FROM contacts WHERE name = 'email'", true},
+		{"join of granted columns", []string{"analyst"}, "SELECT c.name, o.total FROM contacts c JOIN orders o ON o.contact_id = c.id", true},
+		{"ungranted table", []string{"support"}, "SELECT id FROM contacts", false},
+		{"ungranted table in subquery", []string{"support"}, "SELECT * FROM orders WHERE contact_id IN (SELECT id FROM contacts)", false},
+		{"ungranted table in CTE", []string{"support"}, "WITH c AS (SELECT id FROM contacts) SELECT * FROM orders JOIN c ON c.id = orders.contact_id", false},
+		{"CTE over granted table", []string{"support"}, "WITH big AS (SELECT * FROM orders WHERE total > 100) SELECT * FROM big", true},
+		{"ungranted table joined", []string{"support"}, "SELECT o.id FROM orders o JOIN contacts c ON c.id = o.contact_id", false},
+		{"ungranted table in second statement", []string{"support"}, "SELECT * FROM orders; SELECT * FROM contacts", false},
+		{"quoted ungranted table", []string{"support"}, `SELECT * FROM "contacts"`, false},
+		{"schema-qualified granted table", []string{"support"}, "SELECT * FROM main.orders", true},
+		{"schema-qualified grant", []string{"analyst"}, "SELECT * FROM public.invoice", true},
+		{"no roles uses default role", nil, "SELECT * FROM orders", true},
+		{"no roles denied outside default role", nil, "SELECT id FROM contacts", false},
+		{"unknown role", []string{"intern"}, "SELECT * FROM orders", false},
+		{"wildcard table", []string{"admin"}, "SELECT * FROM contacts", true},
+		{"roles are merged", []string{"support", "analyst"}, "SELECT name, total FROM contacts JOIN orders ON orders.contact_id = contacts.id", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizer.AuthorizeQuery(asUser(tt.roles...), tt.query)
+			if tt.allowed && err != nil {
+				t.Errorf("AuthorizeQuery(%q) as %v = %v, want allowed", tt.query, tt.roles, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrForbidden) {
+				t.Errorf("AuthorizeQuery(%q) as %v = %v, want ErrForbidden", tt.query, tt.roles, err)
+			}
+		})
+	}
+}
+
+func TestAuthorizeTools(t *testing.T) {
+	authorizer := newTestAuthorizer(t, testPolicy)
+
+	tests := []struct {
+		name    string
+		roles   []string
+		tool    string
+		input   map[string]interface{}
+		allowed bool
+	}{
+		{"granted tool", []string{"support"}, "database_query", map[string]interface{}{"query": "SELECT 1"}, true},
+		{"ungranted tool", []string{"support"}, "column_profile", map[string]interface{}{}, false},
+		{"wildcard tool", []string{"analyst"}, "column_profile", map[string]interface{}{"table": "orders"}, true},
+		{"table input not granted", []string{"analyst"}, "column_profile", map[string]interface{}{"table": "secrets"}, false},
+		{"granted column input", []string{"analyst"}, "column_profile", map[string]interface{}{"table": "contacts", "column": "name"}, true},
+		{"forbidden column input", []string{"analyst"}, "column_profile", map[string]interface{}{"table": "contacts", "column": "email"}, false},
+		{"forbidden column in list", []string{"analyst"}, "sample_rows", map[string]interface{}{"table": "contacts", "columns": []interface{}{"id", "email"}}, false},
+		{"restricted table without columns", []string{"analyst"}, "sample_rows", map[string]interface{}{"table": "contacts"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := authorizer.Authorize(asUser(tt.roles...), tt.tool, tt.input)
+			if tt.allowed && err != nil {
+				t.Errorf("Authorize(%s, %v) as %v = %v, want allowed", tt.tool, tt.input, tt.roles, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrForbidden) {
+				t.Errorf("Authorize(%s, %v) as %v = %v, want ErrForbidden", tt.tool, tt.input, tt.roles, err)
+			}
+		})
+	}
+}
+
+func TestVisibility(t *testing.T) {
+	authorizer := newTestAuthorizer(t, testPolicy)
+	analyst, support, admin := asUser("analyst"), asUser("support"), asUser("admin")
+
+	tests := []struct {
+		name string
+		got  bool
+		want bool
+	}{
+		{"analyst sees contacts", authorizer.TableVisible(analyst, "contacts"), true},
+		{"support does not see contacts", authorizer.TableVisible(support, "contacts"), false},
+		{"table names are case-insensitive", authorizer.TableVisible(support, "ORDERS"), true},
+		{"analyst sees granted column", authorizer.ColumnVisible(analyst, "contacts", "Name"), true},
+		{"analyst does not see email", authorizer.ColumnVisible(analyst, "contacts", "email"), false},
+		{"support may use database_query", authorizer.ToolAllowed(support, "database_query"), true},
+		{"support may not use other tools", authorizer.ToolAllowed(support, "chart_render"), false},
+		{"admin may unmask", authorizer.MayUnmask(admin), true},
+		{"analyst may not unmask", authorizer.MayUnmask(analyst), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoPolicy(t *testing.T) {
+	authorizer := newTestAuthorizer(t, nil)
+	ctx := asUser()
+
+	if err := authorizer.AuthorizeQuery(ctx, "SELECT email FROM contacts"); err != nil {
+		t.Errorf("AuthorizeQuery without a policy = %v, want allowed", err)
+	}
+	if !authorizer.ToolAllowed(ctx, "anything") || !authorizer.TableVisible(ctx, "contacts") || !authorizer.ColumnVisible(ctx, "contacts", "email") {
+		t.Error("without a policy every tool, table, and column should be allowed")
+	}
+	if authorizer.MayUnmask(ctx) {
+		t.Error("without a policy nobody may unmask")
+	}
+}
@@ -0,0 +1,292 @@
+// Package redis is a small Redis client for the state replicas share when
+// REDIS_ADDR is set: conversations, rate-limit buckets, schema snapshots,
+// and cached query results. It speaks just enough of the protocol for the
+// commands those stores use, over a single connection.
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// KeyPrefix namespaces the server's keys in a shared Redis.
+const KeyPrefix = "data-chatter:"
+
+// Timeout bounds each command, so a slow Redis fails fast rather than
+// holding up requests.
+const Timeout = time.Second
+
+// updateAttempts is how many times Update retries when another client
+// changes the key between its read and write.
+const updateAttempts = 10
+
+// ErrConflict is returned by Update when the key kept changing under it.
+var ErrConflict = errors.New("redis: key changed concurrently")
+
+// Client sends commands over a single connection, reopened after any error
+// other than an error reply.
+type Client struct {
+	addr     string
+	password string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// New creates a client for the Redis at addr, authenticating with password
+// when it is set. It connects on first use.
+func New(addr, password string) *Client {
+	return &Client{addr: addr, password: password}
+}
+
+// NewFromEnv creates the client for REDIS_ADDR with REDIS_PASSWORD, or
+// returns nil when REDIS_ADDR is unset and state stays in each replica.
+func NewFromEnv() *Client {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		return nil
+	}
+	return New(addr, os.Getenv("REDIS_PASSWORD"))
+}
+
+// Addr returns the address of the Redis the client connects to.
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// Ping checks that Redis can be reached and accepts the password.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Get returns the value of key, reporting a missing key as not found rather
+// than as an error.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	reply, err := c.Do(ctx, "GET", key)
+	if err != nil || reply == nil {
+		return nil, false, err
+	}
+	value, ok := reply.([]byte)
+	if !ok {
+		return nil, false, fmt.Errorf("unexpected redis reply %v", reply)
+	}
+	return value, true, nil
+}
+
+// Set stores value under key for ttl, or without expiry when ttl is 0.
+func (c *Client) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del deletes keys; keys that do not exist are ignored.
+func (c *Client) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// Eval runs a Lua script atomically with keys and args, returning its reply.
+func (c *Client) Eval(ctx context.Context, script string, keys []string, args ...string) (interface{}, error) {
+	command := append([]string{"EVAL", script, strconv.Itoa(len(keys))}, keys...)
+	return c.Do(ctx, append(command, args...)...)
+}
+
+// Update replaces the value of key with what update makes of it, atomically:
+// update gets the current value, or nil and false when the key is missing,
+// and is run again when another client changes the key before the new value
+// is written. An error from update is returned as is, leaving the key
+// unchanged. The new value is kept for ttl, or without expiry when 0.
+func (c *Client) Update(ctx context.Context, key string, ttl time.Duration, update func(value []byte, exists bool) ([]byte, error)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for range updateAttempts {
+		written, err := c.updateOnce(ctx, key, ttl, update)
+		if err != nil || written {
+			return err
+		}
+	}
+	return ErrConflict
+}
+
+// updateOnce runs one WATCH, GET, MULTI, SET, EXEC round of Update. It
+// reports false when EXEC was aborted because the key changed. c.mu is held.
+func (c *Client) updateOnce(ctx context.Context, key string, ttl time.Duration, update func([]byte, bool) ([]byte, error)) (bool, error) {
+	if _, err := c.doLocked(ctx, "WATCH", key); err != nil {
+		return false, err
+	}
+	reply, err := c.doLocked(ctx, "GET", key)
+	if err != nil {
+		c.doLocked(ctx, "UNWATCH")
+		return false, err
+	}
+	current, _ := reply.([]byte)
+	value, err := update(current, reply != nil)
+	if err != nil {
+		c.doLocked(ctx, "UNWATCH")
+		return false, err
+	}
+
+	set := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		set = append(set, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	if _, err := c.doLocked(ctx, "MULTI"); err != nil {
+		return false, err
+	}
+	if _, err := c.doLocked(ctx, set...); err != nil {
+		c.doLocked(ctx, "DISCARD")
+		return false, err
+	}
+	reply, err = c.doLocked(ctx, "EXEC")
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
+// Do sends one command and returns its reply: []byte for a string reply,
+// int64 for an integer, []interface{} for an array, and nil for a nil
+// reply. An error reply is returned as an error and leaves the connection
+// usable.
+func (c *Client) Do(ctx context.Context, args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.doLocked(ctx, args...)
+}
+
+// doLocked is Do with c.mu held.
+func (c *Client) doLocked(ctx context.Context, args ...string) (interface{}, error) {
+	if c.conn == nil {
+		if err := c.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.command(ctx, args...)
+	var replyErr Error
+	if err != nil && !errors.As(err, &replyErr) {
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+// connect opens the connection and authenticates, when a password is set.
+func (c *Client) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: Timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	c.conn, c.reader = conn, bufio.NewReader(conn)
+	if c.password != "" {
+		if _, err := c.command(ctx, "AUTH", c.password); err != nil {
+			conn.Close()
+			c.conn = nil
+			return fmt.Errorf("failed to authenticate with redis: %w", err)
+		}
+	}
+	return nil
+}
+
+// command writes args as a RESP array and reads the reply.
+func (c *Client) command(ctx context.Context, args ...string) (interface{}, error) {
+	deadline := time.Now().Add(Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.conn.SetDeadline(deadline)
+
+	buf := fmt.Appendf(nil, "*%d\r\n", len(args))
+	for _, arg := range args {
+		buf = fmt.Appendf(buf, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads one reply, with the nested replies of an array.
+func (c *Client) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return []byte(body), nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("malformed redis reply %q", line)
+		}
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed redis reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed redis reply %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		// Every element is read, even after an error reply, so the
+		// connection stays in step.
+		elements := make([]interface{}, n)
+		var firstErr error
+		for i := range elements {
+			element, err := c.readReply()
+			var replyErr Error
+			if err != nil && !errors.As(err, &replyErr) {
+				return nil, err
+			}
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			elements[i] = element
+		}
+		return elements, firstErr
+	}
+	return nil, fmt.Errorf("unexpected redis reply %q", line)
+}
+
+// Error is an error reply, which leaves the connection usable.
+type Error string
+
+func (e Error) Error() string { return "redis: " + string(e) }
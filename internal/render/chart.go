@@ -0,0 +1,416 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"strconv"
+)
+
+// Chart image size and plot margins, in pixels.
+const (
+	chartWidth   = 800
+	chartHeight  = 480
+	marginLeft   = 50
+	marginRight  = 30
+	marginTop    = 30
+	marginBottom = 40
+	gridLines    = 5
+)
+
+// ChartTypes lists the chart types ChartPNG draws.
+var ChartTypes = []string{"bar", "line", "area", "scatter", "pie"}
+
+// Chart selects how rows are drawn: the column on the x axis, or the
+// category of a pie chart; the numeric column on the y axis, or the size of
+// a pie slice; and an optional column splitting the rows into series, each
+// in its own color.
+type Chart struct {
+	Type   string
+	X      string
+	Y      string
+	Series string
+}
+
+// chartPalette colors series and pie slices in turn.
+var chartPalette = []color.RGBA{
+	{0x4c, 0x78, 0xa8, 0xff},
+	{0xf5, 0x85, 0x18, 0xff},
+	{0xe4, 0x57, 0x56, 0xff},
+	{0x72, 0xb7, 0xb2, 0xff},
+	{0x54, 0xa2, 0x4b, 0xff},
+	{0xee, 0xca, 0x3b, 0xff},
+	{0xb2, 0x79, 0xa2, 0xff},
+	{0xff, 0x9d, 0xa6, 0xff},
+	{0x9d, 0x75, 0x5d, 0xff},
+	{0xba, 0xb0, 0xac, 0xff},
+}
+
+var (
+	chartAxis = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	chartGrid = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+)
+
+// ChartPNG draws rows as a PNG chart. Images carry no text, so the caller
+// names the axes and series alongside the image; categories keep the order
+// of the rows, and rows whose y value is not a number are left out.
+func ChartPNG(chart Chart, rows []map[string]interface{}) ([]byte, error) {
+	c := newCanvas()
+	var err error
+	switch chart.Type {
+	case "bar":
+		err = c.bars(chart, rows)
+	case "line", "area":
+		err = c.lines(chart, rows, chart.Type == "area")
+	case "scatter":
+		err = c.scatter(chart, rows)
+	case "pie":
+		err = c.pie(chart, rows)
+	default:
+		err = fmt.Errorf("unsupported chart type %q", chart.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// chartSeries holds one series' y values by category.
+type chartSeries struct {
+	name   string
+	values map[string]float64
+}
+
+// group splits rows into categories, in first-seen order, and series, each
+// summing its y values per category.
+func group(chart Chart, rows []map[string]interface{}) ([]string, []*chartSeries, error) {
+	var categories []string
+	seenCategory := make(map[string]bool)
+	var series []*chartSeries
+	byName := make(map[string]*chartSeries)
+	for _, row := range rows {
+		y, ok := chartNumber(row[chart.Y])
+		if !ok {
+			continue
+		}
+		category := Cell(row[chart.X], NullsNull)
+		if !seenCategory[category] {
+			seenCategory[category] = true
+			categories = append(categories, category)
+		}
+		name := ""
+		if chart.Series != "" {
+			name = Cell(row[chart.Series], NullsNull)
+		}
+		s := byName[name]
+		if s == nil {
+			s = &chartSeries{name: name, values: make(map[string]float64)}
+			byName[name] = s
+			series = append(series, s)
+		}
+		s.values[category] += y
+	}
+	if len(categories) == 0 {
+		return nil, nil, fmt.Errorf("no rows have a numeric %s", chart.Y)
+	}
+	return categories, series, nil
+}
+
+// bars draws one group of bars per category, a bar per series.
+func (c *canvas) bars(chart Chart, rows []map[string]interface{}) error {
+	categories, series, err := group(chart, rows)
+	if err != nil {
+		return err
+	}
+	low, high := seriesRange(series, true)
+	c.frame(low, high)
+
+	slot := float64(c.plot.Dx()) / float64(len(categories))
+	width := slot * 0.8 / float64(len(series))
+	base := c.yPixel(0, low, high)
+	for i, category := range categories {
+		for j, s := range series {
+			value, ok := s.values[category]
+			if !ok {
+				continue
+			}
+			left := float64(c.plot.Min.X) + slot*float64(i) + slot*0.1 + width*float64(j)
+			top := c.yPixel(value, low, high)
+			c.fill(int(left), min(top, base), int(math.Max(left+width-1, left+1)), max(top, base), chartPalette[j%len(chartPalette)])
+		}
+	}
+	c.axes(base)
+	return nil
+}
+
+// lines draws a line per series through its categories, filling down to
+// zero for area charts.
+func (c *canvas) lines(chart Chart, rows []map[string]interface{}, area bool) error {
+	categories, series, err := group(chart, rows)
+	if err != nil {
+		return err
+	}
+	low, high := seriesRange(series, area)
+	c.frame(low, high)
+
+	base := c.yPixel(math.Max(low, math.Min(0, high)), low, high)
+	for j, s := range series {
+		stroke := chartPalette[j%len(chartPalette)]
+		var prevX, prevY int
+		drawn := false
+		for i, category := range categories {
+			value, ok := s.values[category]
+			if !ok {
+				continue
+			}
+			x, y := c.xCategory(i, len(categories)), c.yPixel(value, low, high)
+			if drawn {
+				if area {
+					c.fillBetween(prevX, prevY, x, y, base, fade(stroke))
+				}
+				c.line(prevX, prevY, x, y, stroke)
+			}
+			c.dot(x, y, 2, stroke)
+			prevX, prevY, drawn = x, y, true
+		}
+	}
+	c.axes(base)
+	return nil
+}
+
+// scatter draws a point per row, on a numeric x axis when every x value is
+// a number and at category positions otherwise.
+func (c *canvas) scatter(chart Chart, rows []map[string]interface{}) error {
+	categories, series, err := group(chart, rows)
+	if err != nil {
+		return err
+	}
+	numeric := true
+	xLow, xHigh := math.Inf(1), math.Inf(-1)
+	for _, row := range rows {
+		x, ok := chartNumber(row[chart.X])
+		if !ok {
+			numeric = false
+			break
+		}
+		xLow, xHigh = math.Min(xLow, x), math.Max(xHigh, x)
+	}
+	if xLow == xHigh {
+		xLow, xHigh = xLow-1, xHigh+1
+	}
+	low, high := seriesRange(series, false)
+	c.frame(low, high)
+
+	seriesIndex := make(map[string]int)
+	for j, s := range series {
+		seriesIndex[s.name] = j
+	}
+	position := make(map[string]int)
+	for i, category := range categories {
+		position[category] = i
+	}
+	for _, row := range rows {
+		y, ok := chartNumber(row[chart.Y])
+		if !ok {
+			continue
+		}
+		var px int
+		if numeric {
+			x, _ := chartNumber(row[chart.X])
+			px = c.plot.Min.X + int((x-xLow)/(xHigh-xLow)*float64(c.plot.Dx()-1))
+		} else {
+			px = c.xCategory(position[Cell(row[chart.X], NullsNull)], len(categories))
+		}
+		name := ""
+		if chart.Series != "" {
+			name = Cell(row[chart.Series], NullsNull)
+		}
+		c.dot(px, c.yPixel(y, low, high), 3, chartPalette[seriesIndex[name]%len(chartPalette)])
+	}
+	c.axes(c.yPixel(math.Max(low, math.Min(0, high)), low, high))
+	return nil
+}
+
+// pie draws a slice per category, sized by its share of the positive y
+// values.
+func (c *canvas) pie(chart Chart, rows []map[string]interface{}) error {
+	categories, series, err := group(Chart{X: chart.X, Y: chart.Y}, rows)
+	if err != nil {
+		return err
+	}
+	values := series[0].values
+	total := 0.0
+	for _, category := range categories {
+		total += math.Max(values[category], 0)
+	}
+	if total == 0 {
+		return fmt.Errorf("%s has no positive values to chart", chart.Y)
+	}
+
+	// Slice i ends at bounds[i], as a fraction of the full turn clockwise from 12 o'clock
+	bounds := make([]float64, len(categories))
+	sum := 0.0
+	for i, category := range categories {
+		sum += math.Max(values[category], 0)
+		bounds[i] = sum / total
+	}
+	cx, cy := chartWidth/2, chartHeight/2
+	radius := float64(min(chartWidth, chartHeight))/2 - 20
+	for py := cy - int(radius); py <= cy+int(radius); py++ {
+		for px := cx - int(radius); px <= cx+int(radius); px++ {
+			dx, dy := float64(px-cx), float64(py-cy)
+			if dx*dx+dy*dy > radius*radius {
+				continue
+			}
+			turn := math.Atan2(dx, -dy) / (2 * math.Pi)
+			if turn < 0 {
+				turn++
+			}
+			slice := 0
+			for slice < len(bounds)-1 && turn > bounds[slice] {
+				slice++
+			}
+			c.img.SetRGBA(px, py, chartPalette[slice%len(chartPalette)])
+		}
+	}
+	return nil
+}
+
+// seriesRange returns the y range covering every series' values, widened
+// to include zero when zero is true.
+func seriesRange(series []*chartSeries, zero bool) (float64, float64) {
+	low, high := math.Inf(1), math.Inf(-1)
+	if zero {
+		low, high = 0, 0
+	}
+	for _, s := range series {
+		for _, value := range s.values {
+			low, high = math.Min(low, value), math.Max(high, value)
+		}
+	}
+	if low == high {
+		low, high = low-1, high+1
+	}
+	return low, high
+}
+
+// chartNumber converts a result value to a float, accepting numeric text.
+func chartNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// fade returns a lighter shade of c for filled areas.
+func fade(c color.RGBA) color.RGBA {
+	return color.RGBA{uint8((int(c.R) + 2*0xff) / 3), uint8((int(c.G) + 2*0xff) / 3), uint8((int(c.B) + 2*0xff) / 3), 0xff}
+}
+
+// canvas is a chart image with its plot area.
+type canvas struct {
+	img  *image.RGBA
+	plot image.Rectangle
+}
+
+func newCanvas() *canvas {
+	c := &canvas{
+		img:  image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight)),
+		plot: image.Rect(marginLeft, marginTop, chartWidth-marginRight, chartHeight-marginBottom),
+	}
+	c.fill(0, 0, chartWidth-1, chartHeight-1, color.RGBA{0xff, 0xff, 0xff, 0xff})
+	return c
+}
+
+// frame draws the horizontal grid lines of a plot covering low to high.
+func (c *canvas) frame(low, high float64) {
+	for i := 0; i <= gridLines; i++ {
+		y := c.yPixel(low+(high-low)*float64(i)/gridLines, low, high)
+		c.fill(c.plot.Min.X, y, c.plot.Max.X, y, chartGrid)
+	}
+}
+
+// axes draws the y axis and the x axis at the baseline y.
+func (c *canvas) axes(base int) {
+	c.fill(c.plot.Min.X, c.plot.Min.Y, c.plot.Min.X, c.plot.Max.Y, chartAxis)
+	c.fill(c.plot.Min.X, base, c.plot.Max.X, base, chartAxis)
+}
+
+// xCategory returns the x pixel at the middle of category i of n.
+func (c *canvas) xCategory(i, n int) int {
+	slot := float64(c.plot.Dx()) / float64(n)
+	return c.plot.Min.X + int(slot*float64(i)+slot/2)
+}
+
+// yPixel returns the y pixel of value on an axis from low to high.
+func (c *canvas) yPixel(value, low, high float64) int {
+	return c.plot.Max.Y - int((value-low)/(high-low)*float64(c.plot.Dy()))
+}
+
+// fill paints the rectangle from (x0, y0) to (x1, y1), inclusive.
+func (c *canvas) fill(x0, y0, x1, y1 int, col color.RGBA) {
+	for y := y0; y <= y1; y++ {
+		for x := x0; x <= x1; x++ {
+			c.img.SetRGBA(x, y, col)
+		}
+	}
+}
+
+// dot paints a square of side 2r+1 centered on (x, y).
+func (c *canvas) dot(x, y, r int, col color.RGBA) {
+	c.fill(x-r, y-r, x+r, y+r, col)
+}
+
+// line paints a two-pixel line from (x0, y0) to (x1, y1).
+func (c *canvas) line(x0, y0, x1, y1 int, col color.RGBA) {
+	steps := max(abs(x1-x0), abs(y1-y0), 1)
+	for i := 0; i <= steps; i++ {
+		x := x0 + (x1-x0)*i/steps
+		y := y0 + (y1-y0)*i/steps
+		c.fill(x, y, x+1, y+1, col)
+	}
+}
+
+// fillBetween paints the area under the segment from (x0, y0) to (x1, y1)
+// down, or up, to the baseline y.
+func (c *canvas) fillBetween(x0, y0, x1, y1, base int, col color.RGBA) {
+	for x := x0; x <= x1; x++ {
+		y := y0
+		if x1 != x0 {
+			y = y0 + (y1-y0)*(x-x0)/(x1-x0)
+		}
+		c.fill(x, min(y, base), x, max(y, base), col)
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
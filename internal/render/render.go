@@ -0,0 +1,219 @@
+// Package render formats query result rows as JSON, CSV, or markdown, with
+// NULLs shown the way the client asked for.
+package render
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NullStyle is how NULL values appear in rendered results.
+type NullStyle string
+
+// Supported null styles. NullsNull keeps JSON null and shows NULL in text.
+const (
+	NullsNull  NullStyle = "null"
+	NullsEmpty NullStyle = "empty"
+	NullsNA    NullStyle = "na"
+)
+
+// Format is a result rendering format.
+type Format string
+
+// Supported formats.
+const (
+	FormatJSON     Format = "json"
+	FormatCSV      Format = "csv"
+	FormatMarkdown Format = "markdown"
+)
+
+// ContentType returns the media type for the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatMarkdown:
+		return "text/markdown; charset=utf-8"
+	default:
+		return "application/json"
+	}
+}
+
+// ParseNullStyle parses a client's null preference. The empty string selects
+// NullsNull; "N/A" is accepted for NullsNA.
+func ParseNullStyle(value string) (NullStyle, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "null":
+		return NullsNull, nil
+	case "empty":
+		return NullsEmpty, nil
+	case "na", "n/a":
+		return NullsNA, nil
+	default:
+		return "", fmt.Errorf("unsupported null style %q (use null, empty, or na)", value)
+	}
+}
+
+// ParseFormat parses a result format, defaulting to JSON.
+func ParseFormat(value string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "json":
+		return FormatJSON, nil
+	case "csv":
+		return FormatCSV, nil
+	case "markdown", "md":
+		return FormatMarkdown, nil
+	default:
+		return "", fmt.Errorf("unsupported format %q (use json, csv, or markdown)", value)
+	}
+}
+
+// JSONValue is the value a NULL takes in JSON output.
+func (s NullStyle) JSONValue() interface{} {
+	switch s {
+	case NullsEmpty:
+		return ""
+	case NullsNA:
+		return "N/A"
+	default:
+		return nil
+	}
+}
+
+// Text is how a NULL is written in CSV and markdown.
+func (s NullStyle) Text() string {
+	switch s {
+	case NullsEmpty:
+		return ""
+	case NullsNA:
+		return "N/A"
+	default:
+		return "NULL"
+	}
+}
+
+// ApplyNulls replaces NULL values in rows, in place, with the style's JSON value.
+func ApplyNulls(rows []map[string]interface{}, nulls NullStyle) {
+	replacement := nulls.JSONValue()
+	if replacement == nil {
+		return
+	}
+	for _, row := range rows {
+		for column, value := range row {
+			if value == nil {
+				row[column] = replacement
+			}
+		}
+	}
+}
+
+// Cell renders a single value as text.
+func Cell(value interface{}, nulls NullStyle) string {
+	switch v := value.(type) {
+	case nil:
+		return nulls.Text()
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case json.Number:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// Cells renders rows as text cells in column order.
+func Cells(columns []string, rows []map[string]interface{}, nulls NullStyle) [][]string {
+	cells := make([][]string, len(rows))
+	for i, row := range rows {
+		cells[i] = make([]string, len(columns))
+		for j, column := range columns {
+			cells[i][j] = Cell(row[column], nulls)
+		}
+	}
+	return cells
+}
+
+// WriteCSV writes a header and rows as RFC 4180 CSV.
+func WriteCSV(w io.Writer, header []string, cells [][]string) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(cells); err != nil {
+		return err
+	}
+	return writer.Error()
+}
+
+// WriteMarkdown writes a header and rows as a GitHub-flavored markdown table.
+// Pipes are escaped and newlines flattened so every row stays on one line.
+func WriteMarkdown(w io.Writer, header []string, cells [][]string) error {
+	var b strings.Builder
+	writeMarkdownRow(&b, header)
+	b.WriteString("|")
+	for range header {
+		b.WriteString(" --- |")
+	}
+	b.WriteString("\n")
+	for _, row := range cells {
+		writeMarkdownRow(&b, row)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Watermark records who exported a result, when, and how it was filtered,
+// so data that leaves the system can be traced back to its export.
+type Watermark struct {
+	ExportedBy string    `json:"exported_by"`
+	ExportedAt time.Time `json:"exported_at"`
+	Filters    []string  `json:"filters,omitempty"` // The query and export options, e.g. "nulls=na"
+}
+
+// Line renders the watermark as one line of text.
+func (wm Watermark) Line() string {
+	line := fmt.Sprintf("Exported by %s at %s", wm.ExportedBy, wm.ExportedAt.UTC().Format(time.RFC3339))
+	if len(wm.Filters) > 0 {
+		line += "; " + strings.Join(wm.Filters, "; ")
+	}
+	return line
+}
+
+// WriteCSVFooter writes the watermark as a final one-cell row, marked with
+// "#" so readers can tell it from data.
+func WriteCSVFooter(w io.Writer, wm Watermark) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"# " + wm.Line()})
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteMarkdownFooter writes the watermark as an italic line after a table.
+func WriteMarkdownFooter(w io.Writer, wm Watermark) error {
+	_, err := io.WriteString(w, "\n_"+markdownEscaper.Replace(strings.ReplaceAll(wm.Line(), "_", `\_`))+"_\n")
+	return err
+}
+
+// markdownEscaper keeps cell text from breaking the table layout.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ", "\r", " ")
+
+func writeMarkdownRow(b *strings.Builder, row []string) {
+	b.WriteString("|")
+	for _, cell := range row {
+		b.WriteString(" ")
+		b.WriteString(markdownEscaper.Replace(cell))
+		b.WriteString(" |")
+	}
+	b.WriteString("\n")
+}
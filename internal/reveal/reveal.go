@@ -0,0 +1,334 @@
+// Package reveal lets users ask to see the values PII_MASK_COLUMNS masks in
+// one query's results. A user requests a reveal with the query and a
+// reason, an admin approves or denies it, and once approved the requester
+// may run the query unmasked until the approval expires. Requests live in
+// the dc_reveal_requests table, so every replica sees the same approvals.
+package reveal
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/notify"
+)
+
+const (
+	// Table is where reveal requests are stored. Its dc_ prefix keeps it out
+	// of the schema shown to users and the LLM.
+	Table = database.MetadataTablePrefix + "reveal_requests"
+
+	// DefaultTTL is how long an approval lasts when REVEAL_TTL is unset.
+	DefaultTTL = time.Hour
+
+	// retention is how long requests are kept.
+	retention = 90 * 24 * time.Hour
+
+	// maxReasonLength bounds a request's reason.
+	maxReasonLength = 1000
+)
+
+// Request statuses.
+const (
+	StatusPending  = "pending"
+	StatusApproved = "approved"
+	StatusDenied   = "denied"
+)
+
+var (
+	// ErrNotFound is returned for unknown request IDs.
+	ErrNotFound = errors.New("reveal request not found")
+
+	// ErrInvalid is returned for requests that fail validation or cannot be
+	// decided or run in their current state.
+	ErrInvalid = errors.New("invalid reveal request")
+)
+
+// Request asks for one query to be run with masked values revealed.
+type Request struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"user_id"`
+	Query     string     `json:"query"`
+	Reason    string     `json:"reason"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	Note      string     `json:"note,omitempty"`
+
+	// ExpiresAt is when an approved request may no longer be run.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Runs counts the unmasked runs of an approved request.
+	Runs int `json:"runs"`
+}
+
+// Usable reports whether the request may be run unmasked at now.
+func (r Request) Usable(now time.Time) bool {
+	return r.Status == StatusApproved && r.ExpiresAt != nil && now.Before(*r.ExpiresAt)
+}
+
+// Store reads and writes reveal requests.
+type Store struct {
+	conn   *database.Connection
+	sender *notify.Sender
+	ttl    time.Duration
+}
+
+// TTLFromEnv reads REVEAL_TTL, how long an approved request may be run
+// (default 1h).
+func TTLFromEnv() (time.Duration, error) {
+	value := os.Getenv("REVEAL_TTL")
+	if value == "" {
+		return DefaultTTL, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl <= 0 {
+		return 0, fmt.Errorf("invalid REVEAL_TTL %q", value)
+	}
+	return ttl, nil
+}
+
+// NewStore creates the requests table if it does not exist yet. Approvals
+// last ttl, and requesters are told of decisions through sender.
+func NewStore(ctx context.Context, conn *database.Connection, sender *notify.Sender, ttl time.Duration) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		id         VARCHAR(64) NOT NULL PRIMARY KEY,
+		user_id    VARCHAR(255) NOT NULL,
+		query      TEXT NOT NULL,
+		reason     TEXT NOT NULL,
+		status     VARCHAR(16) NOT NULL,
+		created_at BIGINT NOT NULL,
+		decided_by VARCHAR(255) NOT NULL,
+		decided_at BIGINT NOT NULL,
+		note       TEXT NOT NULL,
+		expires_at BIGINT NOT NULL,
+		runs       INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	return &Store{conn: conn, sender: sender, ttl: ttl}, nil
+}
+
+// Add saves a new pending request by userID to run query unmasked.
+func (s *Store) Add(ctx context.Context, userID, query, reason string) (Request, error) {
+	request := Request{
+		ID:        newID(),
+		UserID:    userID,
+		Query:     strings.TrimSpace(query),
+		Reason:    strings.TrimSpace(reason),
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	switch {
+	case request.Query == "":
+		return Request{}, fmt.Errorf("%w: query is required", ErrInvalid)
+	case request.Reason == "":
+		return Request{}, fmt.Errorf("%w: reason is required, so the approver knows why the values are needed", ErrInvalid)
+	case len(request.Reason) > maxReasonLength:
+		return Request{}, fmt.Errorf("%w: reason must be at most %d characters", ErrInvalid, maxReasonLength)
+	}
+
+	config := s.conn.Config
+	placeholders := make([]string, 11)
+	for i := range placeholders {
+		placeholders[i] = config.Placeholder(i + 1)
+	}
+	_, err := s.conn.DB.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (id, user_id, query, reason, status, created_at, decided_by, decided_at, note, expires_at, runs) VALUES (%s)`,
+		config.QuoteIdentifier(Table), strings.Join(placeholders, ", ")),
+		request.ID, request.UserID, request.Query, request.Reason, request.Status, request.CreatedAt.UnixMilli(), "", 0, "", 0, 0)
+	if err != nil {
+		return Request{}, fmt.Errorf("failed to save reveal request: %w", err)
+	}
+	return request, nil
+}
+
+// Get returns the request with the given ID.
+func (s *Store) Get(ctx context.Context, id string) (Request, error) {
+	requests, err := s.query(ctx, "id", id)
+	if err != nil {
+		return Request{}, err
+	}
+	if len(requests) == 0 {
+		return Request{}, ErrNotFound
+	}
+	return requests[0], nil
+}
+
+// List returns the requests with the given status, or every request when
+// status is empty, newest first.
+func (s *Store) List(ctx context.Context, status string) ([]Request, error) {
+	if status == "" {
+		return s.query(ctx, "", "")
+	}
+	return s.query(ctx, "status", status)
+}
+
+// ListFor returns userID's requests, newest first.
+func (s *Store) ListFor(ctx context.Context, userID string) ([]Request, error) {
+	return s.query(ctx, "user_id", userID)
+}
+
+// query reads every request, or those whose column equals value.
+func (s *Store) query(ctx context.Context, column, value string) ([]Request, error) {
+	query := `SELECT id, user_id, query, reason, status, created_at, decided_by, decided_at, note, expires_at, runs FROM ` + s.conn.Config.QuoteIdentifier(Table)
+	var args []interface{}
+	if column != "" {
+		query += ` WHERE ` + column + ` = ` + s.conn.Config.Placeholder(1)
+		args = append(args, value)
+	}
+	query += ` ORDER BY created_at DESC, id`
+
+	rows, err := s.conn.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reveal requests: %w", err)
+	}
+	defer rows.Close()
+
+	var requests []Request
+	for rows.Next() {
+		var request Request
+		var createdAt, decidedAt, expiresAt int64
+		if err := rows.Scan(&request.ID, &request.UserID, &request.Query, &request.Reason, &request.Status, &createdAt,
+			&request.DecidedBy, &decidedAt, &request.Note, &expiresAt, &request.Runs); err != nil {
+			return nil, fmt.Errorf("failed to scan reveal request: %w", err)
+		}
+		request.CreatedAt = time.UnixMilli(createdAt).UTC()
+		if decidedAt != 0 {
+			t := time.UnixMilli(decidedAt).UTC()
+			request.DecidedAt = &t
+		}
+		if expiresAt != 0 {
+			t := time.UnixMilli(expiresAt).UTC()
+			request.ExpiresAt = &t
+		}
+		requests = append(requests, request)
+	}
+	return requests, rows.Err()
+}
+
+// Decide approves or denies a pending request on behalf of adminID, with
+// an optional note for the requester, who is notified of the decision. An
+// approved request may be run until the store's TTL has passed.
+func (s *Store) Decide(ctx context.Context, id, adminID string, approve bool, note string) (Request, error) {
+	request, err := s.Get(ctx, id)
+	if err != nil {
+		return Request{}, err
+	}
+	if request.Status != StatusPending {
+		return Request{}, fmt.Errorf("%w: the request was already %s", ErrInvalid, request.Status)
+	}
+
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	request.Status = StatusDenied
+	request.DecidedBy = adminID
+	request.DecidedAt = &now
+	request.Note = strings.TrimSpace(note)
+	var expiresAt int64
+	if approve {
+		request.Status = StatusApproved
+		expires := now.Add(s.ttl)
+		request.ExpiresAt = &expires
+		expiresAt = expires.UnixMilli()
+	}
+
+	config := s.conn.Config
+	p := config.Placeholder
+	result, err := s.conn.DB.ExecContext(ctx, `UPDATE `+config.QuoteIdentifier(Table)+`
+		SET status = `+p(1)+`, decided_by = `+p(2)+`, decided_at = `+p(3)+`, note = `+p(4)+`, expires_at = `+p(5)+`
+		WHERE id = `+p(6)+` AND status = `+p(7),
+		request.Status, request.DecidedBy, now.UnixMilli(), request.Note, expiresAt, request.ID, StatusPending)
+	if err != nil {
+		return Request{}, fmt.Errorf("failed to decide reveal request: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return Request{}, fmt.Errorf("%w: the request was decided by someone else", ErrInvalid)
+	}
+
+	s.notify(ctx, request)
+	return request, nil
+}
+
+// notify tells the requester whether their request was approved.
+func (s *Store) notify(ctx context.Context, request Request) {
+	if s.sender == nil {
+		return
+	}
+	text := fmt.Sprintf("Your request to reveal masked values was %s by %s.", request.Status, request.DecidedBy)
+	if request.ExpiresAt != nil {
+		text += fmt.Sprintf(" You may run the query unmasked until %s.", request.ExpiresAt.Format(time.RFC3339))
+	}
+	if request.Note != "" {
+		text += "\n\n" + request.Note
+	}
+	text += "\n\nQuery: " + request.Query
+	err := s.sender.Send(ctx, request.UserID, notify.Notification{
+		Kind:    "reveal_" + request.Status,
+		Subject: "Reveal request " + request.Status,
+		Text:    text,
+		Data:    request,
+		SentAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "failed to notify of reveal decision", "request_id", request.ID, "user_id", request.UserID, "error", err)
+	}
+}
+
+// Use checks that userID may run request id unmasked now and counts the
+// run. It returns the request to run.
+func (s *Store) Use(ctx context.Context, id, userID string) (Request, error) {
+	request, err := s.Get(ctx, id)
+	if err != nil {
+		return Request{}, err
+	}
+	if request.UserID != userID {
+		return Request{}, ErrNotFound
+	}
+	now := time.Now()
+	if !request.Usable(now) {
+		switch {
+		case request.Status == StatusApproved:
+			return Request{}, fmt.Errorf("%w: the approval expired at %s", ErrInvalid, request.ExpiresAt.Format(time.RFC3339))
+		default:
+			return Request{}, fmt.Errorf("%w: the request is %s, not approved", ErrInvalid, request.Status)
+		}
+	}
+
+	config := s.conn.Config
+	_, err = s.conn.DB.ExecContext(ctx, `UPDATE `+config.QuoteIdentifier(Table)+` SET runs = runs + 1 WHERE id = `+config.Placeholder(1), request.ID)
+	if err != nil {
+		return Request{}, fmt.Errorf("failed to record reveal run: %w", err)
+	}
+	request.Runs++
+	return request, nil
+}
+
+// Prune deletes requests created longer ago than the retention period. It
+// runs as a scheduled task.
+func (s *Store) Prune(ctx context.Context) error {
+	cutoff := time.Now().Add(-retention).UnixMilli()
+	_, err := s.conn.DB.ExecContext(ctx, `DELETE FROM `+s.conn.Config.QuoteIdentifier(Table)+` WHERE created_at < `+s.conn.Config.Placeholder(1), cutoff)
+	if err != nil {
+		return fmt.Errorf("failed to prune reveal requests: %w", err)
+	}
+	return nil
+}
+
+// newID returns a random request ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,75 @@
+// Package safehttp builds HTTP clients for URLs that API callers supply, such
+// as external table sources and job callbacks, so that a caller cannot make
+// the server reach its own loopback interface, the private network, or a
+// cloud metadata endpoint on their behalf.
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when a request would connect to a loopback,
+// private, link-local, or unspecified address.
+var ErrBlockedAddress = errors.New("destination address is not allowed")
+
+// Blocked reports whether ip is an address caller-supplied URLs may not
+// reach: loopback, private (RFC 1918 and fc00::/7), link-local (including
+// 169.254.169.254, the cloud metadata endpoint), multicast, or unspecified.
+func Blocked(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
+
+// NewClient returns a client whose requests give up after timeout, that
+// returns redirects to the caller instead of following them, and that
+// ignores proxy settings. It refuses to connect to Blocked addresses, as
+// resolved when dialing, unless the URL's host is one of allowedHosts.
+func NewClient(timeout time.Duration, allowedHosts []string) *http.Client {
+	allowed := make(map[string]bool, len(allowedHosts))
+	for _, host := range allowedHosts {
+		allowed[strings.ToLower(host)] = true
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	guarded := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		// Control sees the address after name resolution, so a host name
+		// that resolves to a blocked address is refused as well
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || Blocked(ip) {
+				return fmt.Errorf("%w: %s", ErrBlockedAddress, host)
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err == nil && allowed[strings.ToLower(host)] {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return guarded.DialContext(ctx, network, address)
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
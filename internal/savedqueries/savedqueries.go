@@ -0,0 +1,413 @@
+// Package savedqueries keeps each user's saved queries: named, vetted SQL
+// with optional :name parameters that can be run again from the API or by
+// the LLM through the saved_query_run tool instead of writing fresh SQL.
+package savedqueries
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"data-chatter/internal/sqlparse"
+)
+
+const (
+	maxNameLength        = 100
+	maxDescriptionLength = 1000
+	maxParameters        = 20
+)
+
+// Parameter types.
+const (
+	String  = "string"
+	Number  = "number"
+	Boolean = "boolean"
+)
+
+var (
+	// ErrNotFound is returned for unknown saved query IDs and names.
+	ErrNotFound = errors.New("saved query not found")
+
+	// ErrInvalid is returned for saved queries that fail validation and for
+	// parameter values that do not match their declarations.
+	ErrInvalid = errors.New("invalid saved query")
+
+	// ErrConflict is returned when the user already has a query with the name.
+	ErrConflict = errors.New("a saved query with that name already exists")
+)
+
+// parameterName is the form of a parameter name, as referenced by :name.
+var parameterName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Parameter declares a :name placeholder in a saved query. Parameters
+// without a default are required.
+type Parameter struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"` // string, number, or boolean
+	Description string      `json:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+}
+
+// Query is a saved query owned by one user.
+type Query struct {
+	ID          string      `json:"id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	SQL         string      `json:"sql"`
+	Parameters  []Parameter `json:"parameters,omitempty"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// Validate checks the name, description, and parameters, and that the SQL
+// references exactly the declared parameters. Whether the SQL is a permitted
+// read-only query is checked by the caller before it is saved.
+func (q Query) Validate() error {
+	switch {
+	case strings.TrimSpace(q.Name) == "":
+		return fmt.Errorf("%w: name is required", ErrInvalid)
+	case len(q.Name) > maxNameLength:
+		return fmt.Errorf("%w: name is limited to %d characters", ErrInvalid, maxNameLength)
+	case len(q.Description) > maxDescriptionLength:
+		return fmt.Errorf("%w: description is limited to %d characters", ErrInvalid, maxDescriptionLength)
+	case strings.TrimSpace(q.SQL) == "":
+		return fmt.Errorf("%w: sql is required", ErrInvalid)
+	case len(q.Parameters) > maxParameters:
+		return fmt.Errorf("%w: at most %d parameters are allowed", ErrInvalid, maxParameters)
+	}
+
+	declared := make(map[string]bool, len(q.Parameters))
+	for _, p := range q.Parameters {
+		if !parameterName.MatchString(p.Name) {
+			return fmt.Errorf("%w: parameter name %q must be a letter or underscore followed by letters, digits, or underscores", ErrInvalid, p.Name)
+		}
+		if declared[p.Name] {
+			return fmt.Errorf("%w: parameter %s is declared twice", ErrInvalid, p.Name)
+		}
+		declared[p.Name] = true
+		if p.Type != String && p.Type != Number && p.Type != Boolean {
+			return fmt.Errorf("%w: parameter %s must have type string, number, or boolean", ErrInvalid, p.Name)
+		}
+		if p.Default != nil {
+			if err := checkType(p, p.Default); err != nil {
+				return err
+			}
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, ref := range references(q.SQL) {
+		if !declared[ref.name] {
+			return fmt.Errorf("%w: sql references undeclared parameter :%s", ErrInvalid, ref.name)
+		}
+		used[ref.name] = true
+	}
+	for _, p := range q.Parameters {
+		if !used[p.Name] {
+			return fmt.Errorf("%w: parameter %s is not referenced in sql as :%s", ErrInvalid, p.Name, p.Name)
+		}
+	}
+	return nil
+}
+
+// Bind replaces each :name reference in the query's SQL with the dialect's
+// bind parameter, as returned by placeholder for the nth argument, and
+// returns the SQL with its arguments. Values missing from values take the
+// parameter's default.
+func (q Query) Bind(values map[string]interface{}, placeholder func(n int) string) (string, []interface{}, error) {
+	params := make(map[string]Parameter, len(q.Parameters))
+	for _, p := range q.Parameters {
+		params[p.Name] = p
+	}
+	for name := range values {
+		if _, ok := params[name]; !ok {
+			return "", nil, fmt.Errorf("%w: %s has no parameter %s", ErrInvalid, q.Name, name)
+		}
+	}
+
+	var sql strings.Builder
+	var args []interface{}
+	last := 0
+	for _, ref := range references(q.SQL) {
+		p := params[ref.name]
+		value, ok := values[ref.name]
+		if !ok || value == nil {
+			if p.Default == nil {
+				return "", nil, fmt.Errorf("%w: parameter %s is required", ErrInvalid, ref.name)
+			}
+			value = p.Default
+		}
+		if err := checkType(p, value); err != nil {
+			return "", nil, err
+		}
+
+		args = append(args, value)
+		sql.WriteString(q.SQL[last:ref.start])
+		sql.WriteString(placeholder(len(args)))
+		last = ref.end
+	}
+	sql.WriteString(q.SQL[last:])
+	return sql.String(), args, nil
+}
+
+// checkType verifies that value, as decoded from JSON, has p's type.
+func checkType(p Parameter, value interface{}) error {
+	var ok bool
+	switch p.Type {
+	case String:
+		_, ok = value.(string)
+	case Number:
+		_, ok = value.(float64)
+	case Boolean:
+		_, ok = value.(bool)
+	}
+	if !ok {
+		return fmt.Errorf("%w: parameter %s must be a %s", ErrInvalid, p.Name, p.Type)
+	}
+	return nil
+}
+
+// reference is a :name parameter reference at sql[start:end].
+type reference struct {
+	name       string
+	start, end int
+}
+
+// references returns the :name references in sql in order, skipping string
+// literals, quoted identifiers, comments, and PostgreSQL :: casts.
+func references(sql string) []reference {
+	tokens := sqlparse.Tokenize(sql)
+	var refs []reference
+	for i := 0; i+1 < len(tokens); i++ {
+		colon, name := tokens[i], tokens[i+1]
+		if colon.Kind != sqlparse.Symbol || colon.Value != ":" || name.Kind != sqlparse.Word || name.Pos != colon.Pos+1 {
+			continue
+		}
+		if i > 0 && tokens[i-1].Value == ":" && tokens[i-1].Pos == colon.Pos-1 {
+			continue
+		}
+		refs = append(refs, reference{name: name.Value, start: colon.Pos, end: name.Pos + len(name.Value)})
+		i++
+	}
+	return refs
+}
+
+// Store holds every user's saved queries, optionally persisted to a JSON
+// file so they survive restarts.
+type Store struct {
+	mu    sync.RWMutex
+	path  string
+	users map[string][]Query
+}
+
+// NewStoreFromEnv creates a store persisted to SAVED_QUERIES_FILE, loading
+// any queries already in the file. The store is kept in memory only when the
+// variable is unset.
+func NewStoreFromEnv() (*Store, error) {
+	store := &Store{path: os.Getenv("SAVED_QUERIES_FILE"), users: make(map[string][]Query)}
+	if store.path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved queries: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.users); err != nil {
+		return nil, fmt.Errorf("failed to parse saved queries: %w", err)
+	}
+	return store, nil
+}
+
+// List returns userID's saved queries in the order they were saved.
+func (s *Store) List(userID string) []Query {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Query{}, s.users[userID]...)
+}
+
+// Get returns userID's saved query with id.
+func (s *Store) Get(userID, id string) (Query, error) {
+	if s == nil {
+		return Query{}, ErrNotFound
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, q := range s.users[userID] {
+		if q.ID == id {
+			return q, nil
+		}
+	}
+	return Query{}, ErrNotFound
+}
+
+// Find returns userID's saved query named name, ignoring case.
+func (s *Store) Find(userID, name string) (Query, error) {
+	if s == nil {
+		return Query{}, ErrNotFound
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, q := range s.users[userID] {
+		if strings.EqualFold(q.Name, name) {
+			return q, nil
+		}
+	}
+	return Query{}, ErrNotFound
+}
+
+// Add validates and saves a query for userID. Names are unique per user,
+// ignoring case.
+func (s *Store) Add(userID string, q Query) (Query, error) {
+	q.Name = strings.TrimSpace(q.Name)
+	if err := q.Validate(); err != nil {
+		return Query{}, err
+	}
+	q.ID = newID()
+	q.UpdatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.users[userID]
+	for _, existing := range previous {
+		if strings.EqualFold(existing.Name, q.Name) {
+			return Query{}, ErrConflict
+		}
+	}
+	s.users[userID] = append(append([]Query{}, previous...), q)
+	if err := s.save(); err != nil {
+		s.users[userID] = previous
+		return Query{}, err
+	}
+	return q, nil
+}
+
+// All returns every user's saved queries, keyed by user ID.
+func (s *Store) All() map[string][]Query {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	all := make(map[string][]Query, len(s.users))
+	for userID, queries := range s.users {
+		if len(queries) > 0 {
+			all[userID] = append([]Query{}, queries...)
+		}
+	}
+	return all
+}
+
+// Replace swaps every user's saved queries for all, as when restoring a
+// backup.
+func (s *Store) Replace(all map[string][]Query) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.users
+	s.users = make(map[string][]Query, len(all))
+	for userID, queries := range all {
+		s.users[userID] = append([]Query{}, queries...)
+	}
+	if err := s.save(); err != nil {
+		s.users = previous
+		return err
+	}
+	return nil
+}
+
+// Put validates and saves a query for userID, replacing the user's query
+// with the same name, ignoring case, and keeping its ID, or adding it when
+// there is none.
+func (s *Store) Put(userID string, q Query) (Query, error) {
+	q.Name = strings.TrimSpace(q.Name)
+	if err := q.Validate(); err != nil {
+		return Query{}, err
+	}
+	q.ID = newID()
+	q.UpdatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.users[userID]
+	queries := append([]Query{}, previous...)
+	replaced := false
+	for i, existing := range queries {
+		if strings.EqualFold(existing.Name, q.Name) {
+			q.ID = existing.ID
+			queries[i] = q
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		queries = append(queries, q)
+	}
+	s.users[userID] = queries
+	if err := s.save(); err != nil {
+		s.users[userID] = previous
+		return Query{}, err
+	}
+	return q, nil
+}
+
+// Delete removes userID's saved query with id.
+func (s *Store) Delete(userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.users[userID]
+	for i, q := range previous {
+		if q.ID != id {
+			continue
+		}
+		s.users[userID] = append(append([]Query{}, previous[:i]...), previous[i+1:]...)
+		if err := s.save(); err != nil {
+			s.users[userID] = previous
+			return err
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+// save writes every user's saved queries to the store's file, if it has
+// one, replacing the file atomically. Callers must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode saved queries: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write saved queries: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write saved queries: %w", err)
+	}
+	return nil
+}
+
+// newID returns a random saved query ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
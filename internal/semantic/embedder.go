@@ -0,0 +1,193 @@
+package semantic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"data-chatter/internal/env"
+	"data-chatter/internal/suggestions"
+)
+
+// Embedding providers.
+const (
+	ProviderLocal  = "local"
+	ProviderOpenAI = "openai"
+)
+
+const (
+	// localDimensions is the length of local embeddings.
+	localDimensions = 512
+
+	// maxEmbedLength bounds the text sent to an embedding service, in
+	// bytes, which keeps it well under the usual 8,192-token input limit.
+	maxEmbedLength = 8000
+
+	// defaultOpenAIURL and defaultOpenAIModel are used for
+	// EMBEDDING_PROVIDER=openai unless EMBEDDING_URL and EMBEDDING_MODEL say
+	// otherwise.
+	defaultOpenAIURL   = "https://api.openai.com/v1/embeddings"
+	defaultOpenAIModel = "text-embedding-3-small"
+)
+
+// Embedder turns texts into vectors whose cosine similarity measures how
+// alike the texts are.
+type Embedder interface {
+	// Model names the embeddings, so vectors of different models are never
+	// compared.
+	Model() string
+
+	// Embed returns a vector for each text, in order.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// EmbedderFromEnv creates the embedder chosen by EMBEDDING_PROVIDER: local,
+// the default, or openai, which posts to EMBEDDING_URL (OpenAI's endpoint by
+// default, or any compatible one) with EMBEDDING_API_KEY and
+// EMBEDDING_MODEL.
+func EmbedderFromEnv() (Embedder, error) {
+	switch provider := os.Getenv("EMBEDDING_PROVIDER"); provider {
+	case "", ProviderLocal:
+		return localEmbedder{}, nil
+	case ProviderOpenAI:
+		e := &openAIEmbedder{
+			url:        env.Get("EMBEDDING_URL", defaultOpenAIURL),
+			apiKey:     os.Getenv("EMBEDDING_API_KEY"),
+			model:      env.Get("EMBEDDING_MODEL", defaultOpenAIModel),
+			httpClient: &http.Client{Timeout: time.Minute},
+		}
+		if e.apiKey == "" && e.url == defaultOpenAIURL {
+			return nil, fmt.Errorf("EMBEDDING_PROVIDER=openai needs EMBEDDING_API_KEY")
+		}
+		return e, nil
+	default:
+		return nil, fmt.Errorf("unsupported EMBEDDING_PROVIDER %q (use %s or %s)", provider, ProviderLocal, ProviderOpenAI)
+	}
+}
+
+// localEmbedder hashes the word stems and character trigrams the
+// suggestion matcher uses into a fixed-length vector. It needs no service
+// and is deterministic, but only matches texts that share words or their
+// spelling, not meaning.
+type localEmbedder struct{}
+
+// Model names the local embeddings.
+func (localEmbedder) Model() string {
+	return fmt.Sprintf("local-%d", localDimensions)
+}
+
+// Embed hashes each text's terms into a unit vector.
+func (localEmbedder) Embed(_ context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vector := make([]float32, localDimensions)
+		for term, weight := range suggestions.Embed(text) {
+			h := fnv.New32a()
+			h.Write([]byte(term))
+			sum := h.Sum32()
+			// The top bit picks a sign, so colliding terms tend to cancel
+			// out rather than add up
+			if sum&(1<<31) != 0 {
+				weight = -weight
+			}
+			vector[sum%localDimensions] += float32(weight)
+		}
+		vectors[i] = normalize(vector)
+	}
+	return vectors, nil
+}
+
+// openAIEmbedder calls an OpenAI-compatible embeddings endpoint.
+type openAIEmbedder struct {
+	url        string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+}
+
+// Model names the service's model.
+func (e *openAIEmbedder) Model() string {
+	return e.model
+}
+
+// Embed sends texts to the endpoint in one request.
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	inputs := make([]string, len(texts))
+	for i, text := range texts {
+		inputs[i] = truncate(text, maxEmbedLength)
+	}
+	payload, err := json.Marshal(map[string]interface{}{"model": e.model, "input": inputs})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode embedding request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.apiKey)
+	}
+
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding response: %w", err)
+	}
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("embedding service returned %s: %s", resp.Status, truncate(strings.TrimSpace(string(body)), 200))
+	}
+	if parsed.Error != nil {
+		return nil, fmt.Errorf("embedding service returned %s: %s", resp.Status, parsed.Error.Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embedding service returned %s", resp.Status)
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range parsed.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding service returned an embedding for input %d of %d", item.Index, len(texts))
+		}
+		vectors[item.Index] = normalize(item.Embedding)
+	}
+	for i, vector := range vectors {
+		if len(vector) == 0 {
+			return nil, fmt.Errorf("embedding service returned no embedding for input %d", i)
+		}
+	}
+	return vectors, nil
+}
+
+// truncate shortens s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
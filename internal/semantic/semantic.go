@@ -0,0 +1,560 @@
+// Package semantic indexes text columns by embedding for the
+// semantic_search tool, so questions can find rows by what their text is
+// about rather than by exact keywords. Each configured column's values are
+// embedded and kept in the dc_embeddings table of the connected database:
+// as pgvector vectors on PostgreSQL with the vector extension, searched by
+// the database, and as text elsewhere, searched in the server.
+package semantic
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"data-chatter/internal/database"
+)
+
+const (
+	// Table is where embeddings are kept. Its dc_ prefix keeps it out of the
+	// schema shown to users and the LLM.
+	Table = database.MetadataTablePrefix + "embeddings"
+
+	// batchSize bounds the texts embedded in one request.
+	batchSize = 64
+
+	// defaultInterval is how often the index is refreshed without
+	// SEMANTIC_INTERVAL.
+	defaultInterval = 15 * time.Minute
+)
+
+// Column is a text column whose values are indexed.
+type Column struct {
+	Table string `json:"table"`
+	Name  string `json:"column"`
+}
+
+// String returns the column as table.column.
+func (c Column) String() string {
+	return c.Table + "." + c.Name
+}
+
+// Config says which columns are indexed and how often.
+type Config struct {
+	Columns  []Column
+	Interval time.Duration
+}
+
+// ConfigFromEnv reads the comma-separated table.column list in
+// SEMANTIC_COLUMNS and the refresh interval in SEMANTIC_INTERVAL (default
+// 15m). It returns nil when SEMANTIC_COLUMNS is unset.
+func ConfigFromEnv() (*Config, error) {
+	raw := strings.TrimSpace(os.Getenv("SEMANTIC_COLUMNS"))
+	if raw == "" {
+		return nil, nil
+	}
+	config := &Config{Interval: defaultInterval}
+	seen := make(map[Column]bool)
+	for _, entry := range strings.Split(raw, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		table, name, ok := strings.Cut(entry, ".")
+		if !ok || table == "" || name == "" || strings.Contains(name, ".") {
+			return nil, fmt.Errorf("invalid SEMANTIC_COLUMNS entry %q: expected table.column", entry)
+		}
+		column := Column{Table: table, Name: name}
+		if !seen[column] {
+			seen[column] = true
+			config.Columns = append(config.Columns, column)
+		}
+	}
+	if value := os.Getenv("SEMANTIC_INTERVAL"); value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid SEMANTIC_INTERVAL %q", value)
+		}
+		config.Interval = interval
+	}
+	return config, nil
+}
+
+// Match is a row whose text is similar to a searched phrase.
+type Match struct {
+	Column
+	KeyColumn  string  `json:"key_column"`
+	Key        string  `json:"key"`
+	Similarity float64 `json:"similarity"`
+	Text       string  `json:"text"`
+}
+
+// Index keeps the embeddings of the configured columns' values.
+type Index struct {
+	conn     *database.Connection
+	embedder Embedder
+	columns  []Column
+	pgvector bool
+
+	refreshing sync.Mutex
+}
+
+// NewIndex creates the embeddings table if it does not exist yet. On
+// PostgreSQL with the vector extension installed, a new table stores
+// pgvector vectors; one created before the extension keeps text until it
+// is dropped.
+func NewIndex(ctx context.Context, conn *database.Connection, embedder Embedder, columns []Column) (*Index, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	index := &Index{conn: conn, embedder: embedder, columns: columns}
+	vectorType := "TEXT"
+	if conn.Config.Type == "postgres" {
+		var installed int
+		if err := conn.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM pg_extension WHERE extname = 'vector'`).Scan(&installed); err == nil && installed > 0 {
+			vectorType = "vector"
+		}
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		table_name   VARCHAR(255) NOT NULL,
+		column_name  VARCHAR(255) NOT NULL,
+		row_key      VARCHAR(255) NOT NULL,
+		model        VARCHAR(255) NOT NULL,
+		content_hash VARCHAR(64) NOT NULL,
+		embedding    `+vectorType+` NOT NULL,
+		updated_at   BIGINT NOT NULL,
+		PRIMARY KEY (table_name, column_name, row_key)
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+
+	if conn.Config.Type == "postgres" {
+		var udt string
+		err := conn.DB.QueryRowContext(ctx, `SELECT udt_name FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1 AND column_name = 'embedding'`, Table).Scan(&udt)
+		index.pgvector = err == nil && udt == "vector"
+	}
+	return index, nil
+}
+
+// Columns returns the indexed columns.
+func (x *Index) Columns() []Column {
+	if x == nil {
+		return nil
+	}
+	return x.columns
+}
+
+// Model returns the model the index's embeddings are made with.
+func (x *Index) Model() string {
+	return x.embedder.Model()
+}
+
+// Refresh embeds the values that are new or changed since the last
+// refresh, whose embeddings were made with another model, and forgets
+// deleted rows and columns no longer configured. A column that cannot be
+// indexed does not stop the others.
+func (x *Index) Refresh(ctx context.Context) error {
+	x.refreshing.Lock()
+	defer x.refreshing.Unlock()
+
+	var errs []error
+	for _, column := range x.columns {
+		if err := x.refreshColumn(ctx, column); err != nil {
+			errs = append(errs, fmt.Errorf("failed to index %s: %w", column, err))
+		}
+	}
+	if err := x.forgetUnconfigured(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// pending is a value waiting to be embedded.
+type pending struct {
+	key  string
+	text string
+	hash string
+}
+
+// refreshColumn brings the embeddings of one column up to date.
+func (x *Index) refreshColumn(ctx context.Context, column Column) error {
+	keyColumn, err := x.keyColumn(ctx, column)
+	if err != nil {
+		return err
+	}
+	stored, err := x.storedHashes(ctx, column)
+	if err != nil {
+		return err
+	}
+
+	// Changed values are collected before any are written, since SQLite
+	// cannot write while the read is open
+	config := x.conn.Config
+	rows, err := x.conn.DB.QueryContext(ctx, `SELECT `+config.QuoteIdentifier(keyColumn)+`, `+config.QuoteIdentifier(column.Name)+
+		` FROM `+config.QuoteIdentifier(column.Table)+` WHERE `+config.QuoteIdentifier(column.Name)+` IS NOT NULL`)
+	if err != nil {
+		return fmt.Errorf("failed to read values: %w", err)
+	}
+	model := x.embedder.Model()
+	seen := make(map[string]bool)
+	var changed []pending
+	for rows.Next() {
+		var key interface{}
+		var text sql.NullString
+		if err := rows.Scan(&key, &text); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read values: %w", err)
+		}
+		value := pending{key: keyString(key), text: strings.TrimSpace(text.String)}
+		if value.text == "" {
+			continue
+		}
+		seen[value.key] = true
+		if value.hash = contentHash(model, value.text); stored[value.key] != value.hash {
+			changed = append(changed, value)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read values: %w", err)
+	}
+
+	for start := 0; start < len(changed); start += batchSize {
+		batch := changed[start:min(start+batchSize, len(changed))]
+		texts := make([]string, len(batch))
+		for i, value := range batch {
+			texts[i] = value.text
+		}
+		vectors, err := x.embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		if err := x.save(ctx, column, batch, vectors); err != nil {
+			return err
+		}
+	}
+
+	var removed []string
+	for key := range stored {
+		if !seen[key] {
+			removed = append(removed, key)
+		}
+	}
+	if err := x.remove(ctx, column, removed); err != nil {
+		return err
+	}
+
+	if len(changed) > 0 || len(removed) > 0 {
+		slog.InfoContext(ctx, "semantic index refreshed", "column", column.String(), "model", model,
+			"embedded", len(changed), "removed", len(removed))
+	}
+	return nil
+}
+
+// keyColumn returns the primary key column of column's table, which
+// identifies its rows in the index.
+func (x *Index) keyColumn(ctx context.Context, column Column) (string, error) {
+	schema, err := x.conn.Schema(ctx)
+	if err != nil {
+		return "", err
+	}
+	columns, ok := schema.Columns[column.Table]
+	if !ok {
+		return "", fmt.Errorf("table %s does not exist", column.Table)
+	}
+	var keys []string
+	found := false
+	for _, col := range columns {
+		if col.PrimaryKey {
+			keys = append(keys, col.Name)
+		}
+		found = found || col.Name == column.Name
+	}
+	if !found {
+		return "", fmt.Errorf("column %s does not exist", column)
+	}
+	if len(keys) != 1 {
+		return "", fmt.Errorf("table %s needs a single-column primary key", column.Table)
+	}
+	return keys[0], nil
+}
+
+// storedHashes returns the content hash of each row of column in the
+// index, by row key.
+func (x *Index) storedHashes(ctx context.Context, column Column) (map[string]string, error) {
+	p := x.conn.Config.Placeholder
+	rows, err := x.conn.DB.QueryContext(ctx, `SELECT row_key, content_hash FROM `+x.conn.Config.QuoteIdentifier(Table)+
+		` WHERE table_name = `+p(1)+` AND column_name = `+p(2), column.Table, column.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	hashes := make(map[string]string)
+	for rows.Next() {
+		var key, hash string
+		if err := rows.Scan(&key, &hash); err != nil {
+			return nil, fmt.Errorf("failed to read embeddings: %w", err)
+		}
+		hashes[key] = hash
+	}
+	return hashes, rows.Err()
+}
+
+// save replaces the embeddings of a batch of values in one transaction.
+func (x *Index) save(ctx context.Context, column Column, batch []pending, vectors [][]float32) error {
+	config := x.conn.Config
+	p := config.Placeholder
+	table := config.QuoteIdentifier(Table)
+	now := time.Now().UnixMilli()
+	model := x.embedder.Model()
+
+	tx, err := x.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to save embeddings: %w", err)
+	}
+	defer tx.Rollback()
+	for i, value := range batch {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE table_name = `+p(1)+` AND column_name = `+p(2)+` AND row_key = `+p(3),
+			column.Table, column.Name, value.key); err != nil {
+			return fmt.Errorf("failed to save embeddings: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO `+table+` (table_name, column_name, row_key, model, content_hash, embedding, updated_at) VALUES (`+
+			p(1)+`, `+p(2)+`, `+p(3)+`, `+p(4)+`, `+p(5)+`, `+p(6)+`, `+p(7)+`)`,
+			column.Table, column.Name, value.key, model, value.hash, FormatVector(vectors[i]), now); err != nil {
+			return fmt.Errorf("failed to save embeddings: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save embeddings: %w", err)
+	}
+	return nil
+}
+
+// remove forgets the embeddings of rows of column.
+func (x *Index) remove(ctx context.Context, column Column, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	p := x.conn.Config.Placeholder
+	tx, err := x.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to remove embeddings: %w", err)
+	}
+	defer tx.Rollback()
+	for _, key := range keys {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+x.conn.Config.QuoteIdentifier(Table)+` WHERE table_name = `+p(1)+` AND column_name = `+p(2)+` AND row_key = `+p(3),
+			column.Table, column.Name, key); err != nil {
+			return fmt.Errorf("failed to remove embeddings: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to remove embeddings: %w", err)
+	}
+	return nil
+}
+
+// forgetUnconfigured removes the embeddings of columns no longer in the
+// configuration.
+func (x *Index) forgetUnconfigured(ctx context.Context) error {
+	table := x.conn.Config.QuoteIdentifier(Table)
+	rows, err := x.conn.DB.QueryContext(ctx, `SELECT DISTINCT table_name, column_name FROM `+table)
+	if err != nil {
+		return fmt.Errorf("failed to read embeddings: %w", err)
+	}
+	configured := make(map[Column]bool, len(x.columns))
+	for _, column := range x.columns {
+		configured[column] = true
+	}
+	var stale []Column
+	for rows.Next() {
+		var column Column
+		if err := rows.Scan(&column.Table, &column.Name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read embeddings: %w", err)
+		}
+		if !configured[column] {
+			stale = append(stale, column)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read embeddings: %w", err)
+	}
+
+	p := x.conn.Config.Placeholder
+	for _, column := range stale {
+		if _, err := x.conn.DB.ExecContext(ctx, `DELETE FROM `+table+` WHERE table_name = `+p(1)+` AND column_name = `+p(2),
+			column.Table, column.Name); err != nil {
+			return fmt.Errorf("failed to remove embeddings: %w", err)
+		}
+		slog.InfoContext(ctx, "semantic index dropped column", "column", column.String())
+	}
+	return nil
+}
+
+// Search returns up to limit rows of columns whose text is most similar to
+// phrase, most similar first, with their current text. Rows deleted since
+// the last refresh are left out; rows added since are not found yet.
+func (x *Index) Search(ctx context.Context, phrase string, columns []Column, limit int) ([]Match, error) {
+	vectors, err := x.embedder.Embed(ctx, []string{phrase})
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []Match
+	for _, column := range columns {
+		found, err := x.nearest(ctx, column, vectors[0], limit)
+		if err != nil {
+			return nil, err
+		}
+		if found, err = x.withText(ctx, column, found); err != nil {
+			return nil, err
+		}
+		matches = append(matches, found...)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Similarity > matches[j].Similarity
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// nearest returns up to limit rows of column nearest to vector, by
+// pgvector's cosine distance when the database has it and by comparing
+// every stored embedding otherwise.
+func (x *Index) nearest(ctx context.Context, column Column, vector []float32, limit int) ([]Match, error) {
+	config := x.conn.Config
+	table := config.QuoteIdentifier(Table)
+	model := x.embedder.Model()
+
+	if x.pgvector {
+		rows, err := x.conn.DB.QueryContext(ctx, `SELECT row_key, 1 - (embedding <=> $1::vector) FROM `+table+`
+			WHERE table_name = $2 AND column_name = $3 AND model = $4 AND vector_dims(embedding) = $5
+			ORDER BY embedding <=> $1::vector, row_key LIMIT $6`,
+			FormatVector(vector), column.Table, column.Name, model, len(vector), limit)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search embeddings: %w", err)
+		}
+		defer rows.Close()
+		var matches []Match
+		for rows.Next() {
+			match := Match{Column: column}
+			if err := rows.Scan(&match.Key, &match.Similarity); err != nil {
+				return nil, fmt.Errorf("failed to search embeddings: %w", err)
+			}
+			matches = append(matches, match)
+		}
+		return matches, rows.Err()
+	}
+
+	p := config.Placeholder
+	rows, err := x.conn.DB.QueryContext(ctx, `SELECT row_key, embedding FROM `+table+
+		` WHERE table_name = `+p(1)+` AND column_name = `+p(2)+` AND model = `+p(3), column.Table, column.Name, model)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search embeddings: %w", err)
+	}
+	defer rows.Close()
+	var matches []Match
+	for rows.Next() {
+		var key, text string
+		if err := rows.Scan(&key, &text); err != nil {
+			return nil, fmt.Errorf("failed to search embeddings: %w", err)
+		}
+		stored, err := ParseVector(text)
+		if err != nil {
+			return nil, fmt.Errorf("failed to search embeddings: %s.%s: %w", column, key, err)
+		}
+		matches = append(matches, Match{Column: column, Key: key, Similarity: Similarity(vector, stored)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search embeddings: %w", err)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Similarity != matches[j].Similarity {
+			return matches[i].Similarity > matches[j].Similarity
+		}
+		return matches[i].Key < matches[j].Key
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches, nil
+}
+
+// withText fills in the key column and current text of matches of column,
+// dropping those whose rows no longer exist.
+func (x *Index) withText(ctx context.Context, column Column, matches []Match) ([]Match, error) {
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	keyColumn, err := x.keyColumn(ctx, column)
+	if err != nil {
+		return nil, err
+	}
+
+	config := x.conn.Config
+	placeholders := make([]string, len(matches))
+	args := make([]interface{}, len(matches))
+	for i, match := range matches {
+		placeholders[i] = config.Placeholder(i + 1)
+		args[i] = match.Key
+	}
+	rows, err := x.conn.DB.QueryContext(ctx, `SELECT `+config.QuoteIdentifier(keyColumn)+`, `+config.QuoteIdentifier(column.Name)+
+		` FROM `+config.QuoteIdentifier(column.Table)+` WHERE `+config.QuoteIdentifier(keyColumn)+` IN (`+strings.Join(placeholders, ", ")+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read matched rows: %w", err)
+	}
+	defer rows.Close()
+	texts := make(map[string]string, len(matches))
+	for rows.Next() {
+		var key interface{}
+		var text sql.NullString
+		if err := rows.Scan(&key, &text); err != nil {
+			return nil, fmt.Errorf("failed to read matched rows: %w", err)
+		}
+		texts[keyString(key)] = text.String
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read matched rows: %w", err)
+	}
+
+	found := matches[:0]
+	for _, match := range matches {
+		if text, ok := texts[match.Key]; ok {
+			match.KeyColumn, match.Text = keyColumn, text
+			found = append(found, match)
+		}
+	}
+	return found, nil
+}
+
+// keyString returns a scanned primary key value as text.
+func keyString(value interface{}) string {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
+
+// contentHash identifies a text as embedded by model, so a value is
+// embedded again when it changes or the model does.
+func contentHash(model, text string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + text))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,75 @@
+package semantic
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// normalize scales vector to unit length in place, so cosine similarity is
+// a dot product. A zero vector stays zero.
+func normalize(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+	norm = math.Sqrt(norm)
+	for i := range vector {
+		vector[i] = float32(float64(vector[i]) / norm)
+	}
+	return vector
+}
+
+// Similarity returns the cosine similarity of two unit vectors, or 0 when
+// their lengths differ.
+func Similarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+// FormatVector writes vector in pgvector's text format, [1,2,3], which is
+// also how vectors are kept in databases without pgvector.
+func FormatVector(vector []float32) string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, v := range vector {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(v), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// ParseVector reads a vector written by FormatVector.
+func ParseVector(text string) ([]float32, error) {
+	text = strings.TrimSpace(text)
+	if len(text) < 2 || text[0] != '[' || text[len(text)-1] != ']' {
+		return nil, fmt.Errorf("invalid vector %q", truncate(text, 20))
+	}
+	text = text[1 : len(text)-1]
+	if text == "" {
+		return []float32{}, nil
+	}
+	fields := strings.Split(text, ",")
+	vector := make([]float32, len(fields))
+	for i, field := range fields {
+		v, err := strconv.ParseFloat(strings.TrimSpace(field), 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid vector component %q", field)
+		}
+		vector[i] = float32(v)
+	}
+	return vector, nil
+}
@@ -0,0 +1,245 @@
+// Package servertls lets the server terminate TLS itself, with a
+// certificate and key from files or one obtained from Let's Encrypt, so it
+// can run without a reverse proxy. Listeners with TLS serve HTTP/2 as well
+// as HTTP/1.1. It also sets Strict-Transport-Security on HTTPS responses and
+// can redirect plain HTTP to HTTPS.
+package servertls
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// certCheckInterval is how often certificate files are checked for a
+// renewed certificate.
+const certCheckInterval = time.Minute
+
+// Config controls TLS termination.
+type Config struct {
+	// CertFile and KeyFile are PEM files for a certificate and its key.
+	CertFile, KeyFile string
+
+	// Domains are the host names to obtain Let's Encrypt certificates for,
+	// used instead of CertFile and KeyFile. Certificates are kept in
+	// CacheDir, and Email is given to Let's Encrypt for expiry notices.
+	Domains  []string
+	CacheDir string
+	Email    string
+
+	// DirectoryURL is the ACME directory to use instead of Let's
+	// Encrypt's production one, such as its staging directory.
+	DirectoryURL string
+
+	// HSTSMaxAge is the max-age of the Strict-Transport-Security header;
+	// 0 leaves the header out.
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+
+	// RedirectPort is the port of a plain HTTP listener redirecting to
+	// HTTPS, or empty for none. With Let's Encrypt it also answers the
+	// HTTP-01 challenges.
+	RedirectPort string
+
+	manager *autocert.Manager
+}
+
+// ConfigFromEnv reads TLS_CERT_FILE and TLS_KEY_FILE, or TLS_DOMAINS with
+// TLS_CACHE_DIR (default "autocert-cache"), TLS_EMAIL, and
+// TLS_ACME_DIRECTORY, along with HSTS_MAX_AGE, HSTS_INCLUDE_SUBDOMAINS, and
+// HTTP_REDIRECT_PORT. TLS is disabled when none of the certificate
+// settings are set.
+func ConfigFromEnv() (*Config, error) {
+	config := &Config{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		CacheDir:     os.Getenv("TLS_CACHE_DIR"),
+		Email:        os.Getenv("TLS_EMAIL"),
+		DirectoryURL: os.Getenv("TLS_ACME_DIRECTORY"),
+		RedirectPort: os.Getenv("HTTP_REDIRECT_PORT"),
+
+		HSTSIncludeSubdomains: os.Getenv("HSTS_INCLUDE_SUBDOMAINS") == "true",
+	}
+	for _, domain := range strings.Split(os.Getenv("TLS_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			config.Domains = append(config.Domains, domain)
+		}
+	}
+	if config.CacheDir == "" {
+		config.CacheDir = "autocert-cache"
+	}
+	if value := os.Getenv("HSTS_MAX_AGE"); value != "" {
+		maxAge, err := time.ParseDuration(value)
+		if err != nil || maxAge < 0 {
+			return nil, fmt.Errorf("invalid HSTS_MAX_AGE %q: must be a duration such as 8760h", value)
+		}
+		config.HSTSMaxAge = maxAge
+	}
+
+	switch {
+	case (config.CertFile == "") != (config.KeyFile == ""):
+		return nil, fmt.Errorf("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	case config.CertFile != "" && len(config.Domains) > 0:
+		return nil, fmt.Errorf("set either TLS_CERT_FILE and TLS_KEY_FILE or TLS_DOMAINS, not both")
+	case !config.Enabled() && (config.HSTSMaxAge > 0 || config.RedirectPort != ""):
+		return nil, fmt.Errorf("HSTS_MAX_AGE and HTTP_REDIRECT_PORT need TLS_CERT_FILE and TLS_KEY_FILE or TLS_DOMAINS")
+	}
+	if config.RedirectPort != "" {
+		if _, err := strconv.Atoi(config.RedirectPort); err != nil {
+			return nil, fmt.Errorf("invalid HTTP_REDIRECT_PORT %q: must be a port number", config.RedirectPort)
+		}
+	}
+	return config, nil
+}
+
+// Enabled reports whether the server terminates TLS.
+func (c *Config) Enabled() bool {
+	return c.CertFile != "" || len(c.Domains) > 0
+}
+
+// TLSConfig returns the server's TLS configuration, offering HTTP/2. It
+// fails when the certificate files cannot be loaded.
+func (c *Config) TLSConfig() (*tls.Config, error) {
+	if len(c.Domains) > 0 {
+		c.manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			Cache:      autocert.DirCache(c.CacheDir),
+			HostPolicy: autocert.HostWhitelist(c.Domains...),
+			Email:      c.Email,
+		}
+		if c.DirectoryURL != "" {
+			c.manager.Client = &acme.Client{DirectoryURL: c.DirectoryURL}
+		}
+		config := c.manager.TLSConfig()
+		config.MinVersion = tls.VersionTLS12
+		return config, nil
+	}
+
+	certificate := &certificateFiles{certFile: c.CertFile, keyFile: c.KeyFile}
+	if err := certificate.load(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		NextProtos:     []string{"h2", "http/1.1"},
+		GetCertificate: certificate.get,
+	}, nil
+}
+
+// HSTS sets Strict-Transport-Security on responses to HTTPS requests when
+// HSTSMaxAge is set.
+func (c *Config) HSTS(next http.Handler) http.Handler {
+	if c.HSTSMaxAge <= 0 {
+		return next
+	}
+	value := "max-age=" + strconv.FormatInt(int64(c.HSTSMaxAge.Seconds()), 10)
+	if c.HSTSIncludeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			w.Header().Set("Strict-Transport-Security", value)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RedirectServer returns the plain HTTP server on RedirectPort, which
+// permanently redirects every request to the same URL over HTTPS on
+// httpsPort, or nil when RedirectPort is not set. TLSConfig must be called
+// first so Let's Encrypt challenges are answered.
+func (c *Config) RedirectServer(httpsPort string) *http.Server {
+	if c.RedirectPort == "" {
+		return nil
+	}
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+	if c.manager != nil {
+		handler = c.manager.HTTPHandler(handler)
+	}
+	return &http.Server{
+		Addr:              ":" + c.RedirectPort,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+}
+
+// certificateFiles serves a certificate from files, loading it again when
+// either file changes, so a renewed certificate is picked up without a
+// restart.
+type certificateFiles struct {
+	certFile, keyFile string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modified    time.Time
+	checked     time.Time
+}
+
+// load reads the certificate and key.
+func (f *certificateFiles) load() error {
+	modified, err := f.lastModified()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	f.certificate, f.modified, f.checked = &certificate, modified, time.Now()
+	return nil
+}
+
+// lastModified returns when the later of the two files was modified.
+func (f *certificateFiles) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{f.certFile, f.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read TLS certificate: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// get returns the certificate for a handshake, reloading it at most once
+// per certCheckInterval when the files have changed. A certificate that
+// fails to load is logged and the previous one kept.
+func (f *certificateFiles) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if time.Since(f.checked) < certCheckInterval {
+		return f.certificate, nil
+	}
+	f.checked = time.Now()
+	if modified, err := f.lastModified(); err == nil && modified.After(f.modified) {
+		if err := f.load(); err != nil {
+			slog.Error("failed to reload TLS certificate, keeping the previous one", "error", err)
+		} else {
+			slog.Info("reloaded TLS certificate", "cert_file", f.certFile)
+		}
+	}
+	return f.certificate, nil
+}
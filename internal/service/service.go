@@ -0,0 +1,52 @@
+// Package service runs the server under a service manager: systemd, which
+// is told when the server is ready and stopping (sd_notify) and pinged for
+// its watchdog, or the Windows service control manager. Outside a service
+// manager the server runs until SIGINT or SIGTERM.
+package service
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// RunFunc runs the server until ctx is cancelled, calling ready once it is
+// serving traffic.
+type RunFunc func(ctx context.Context, ready func()) error
+
+// Run runs fn as the Windows service name when started by the Windows
+// service control manager, and otherwise until the process gets SIGINT or
+// SIGTERM, notifying systemd when NOTIFY_SOCKET is set.
+func Run(name string, fn RunFunc) error {
+	if isService, err := runWindowsService(name, fn); isService {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return runNotified(ctx, fn)
+}
+
+// runNotified runs fn, telling systemd when it is ready and when it starts
+// stopping, and pinging the watchdog in between when one is configured.
+func runNotified(ctx context.Context, fn RunFunc) error {
+	watchdog, cancelWatchdog := context.WithCancel(ctx)
+	defer cancelWatchdog()
+
+	stopping := context.AfterFunc(ctx, func() {
+		if err := Notify(StateStopping); err != nil {
+			slog.Warn("failed to notify systemd", "state", StateStopping, "error", err)
+		}
+	})
+	defer stopping()
+
+	return fn(ctx, func() {
+		if err := Notify(StateReady); err != nil {
+			slog.Warn("failed to notify systemd", "state", StateReady, "error", err)
+			return
+		}
+		go pingWatchdog(watchdog)
+	})
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package service
+
+// runWindowsService reports that the process is not a Windows service.
+func runWindowsService(string, RunFunc) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,74 @@
+//go:build windows
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"golang.org/x/sys/windows/svc"
+)
+
+// runWindowsService runs fn as the service name when the process was
+// started by the Windows service control manager, reporting whether it was.
+// Stop and shutdown requests cancel fn's context.
+func runWindowsService(name string, fn RunFunc) (bool, error) {
+	isService, err := svc.IsWindowsService()
+	if err != nil {
+		return false, fmt.Errorf("failed to detect Windows service: %w", err)
+	}
+	if !isService {
+		return false, nil
+	}
+
+	handler := &windowsService{name: name, run: fn}
+	if err := svc.Run(name, handler); err != nil {
+		return true, fmt.Errorf("failed to run Windows service %s: %w", name, err)
+	}
+	return true, handler.err
+}
+
+// windowsService adapts a RunFunc to the service control manager.
+type windowsService struct {
+	name string
+	run  RunFunc
+	err  error
+}
+
+// Execute reports the service running once fn is ready, and stops it on
+// stop or shutdown requests.
+func (s *windowsService) Execute(_ []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	const accepted = svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.StartPending}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.run(ctx, func() {
+			status <- svc.Status{State: svc.Running, Accepts: accepted}
+		})
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			s.err = err
+			status <- svc.Status{State: svc.StopPending}
+			if err != nil {
+				return false, 1
+			}
+			return false, 0
+		case request := <-requests:
+			switch request.Cmd {
+			case svc.Interrogate:
+				status <- request.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				slog.Info("windows service stop requested", "service", s.name)
+				status <- svc.Status{State: svc.StopPending}
+				cancel()
+			}
+		}
+	}
+}
@@ -0,0 +1,428 @@
+// Package snapshots materializes query results as named tables of the
+// connected database, so later chats can query a result as it stood when it
+// was taken, and query_diff can compare the current result with it. Each
+// snapshot is kept for its retention, then dropped. The registrations live
+// in the dc_snapshots table, so every replica sees the same snapshots.
+package snapshots
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+)
+
+// Table is where registrations are stored. Its dc_ prefix keeps it out of
+// the schema shown to users and the LLM.
+const Table = database.MetadataTablePrefix + "snapshots"
+
+// insertBatchValues caps the bind values of one multi-row INSERT, below
+// SQLite's oldest limit of 999.
+const insertBatchValues = 900
+
+// Retention defaults, when SNAPSHOT_RETENTION and SNAPSHOT_MAX_RETENTION are
+// unset.
+const (
+	defaultRetention    = 7 * 24 * time.Hour
+	defaultMaxRetention = 90 * 24 * time.Hour
+)
+
+// Column types.
+const (
+	TypeInteger   = "integer"
+	TypeReal      = "real"
+	TypeBoolean   = "boolean"
+	TypeTimestamp = "timestamp"
+	TypeText      = "text"
+)
+
+var (
+	// ErrNotFound is returned for snapshots that do not exist.
+	ErrNotFound = errors.New("snapshot not found")
+
+	// ErrInvalid is returned for snapshots that fail validation.
+	ErrInvalid = errors.New("invalid snapshot")
+)
+
+// tableName is what a snapshot may be called: an unquoted identifier on
+// every supported database.
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Snapshot is a query result kept as a table.
+type Snapshot struct {
+	Name      string    `json:"name"`
+	Query     string    `json:"query"`
+	Columns   []Column  `json:"columns"`
+	Rows      int64     `json:"rows"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Column is a column of a snapshot, typed after the values it holds.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Policy bounds how long snapshots are kept.
+type Policy struct {
+	Retention    time.Duration // Kept this long when the request names no retention
+	MaxRetention time.Duration // The longest retention a request may ask for
+}
+
+// PolicyFromEnv reads SNAPSHOT_RETENTION (default 168h) and
+// SNAPSHOT_MAX_RETENTION (default 2160h).
+func PolicyFromEnv() (Policy, error) {
+	policy := Policy{Retention: defaultRetention, MaxRetention: defaultMaxRetention}
+	for name, target := range map[string]*time.Duration{
+		"SNAPSHOT_RETENTION":     &policy.Retention,
+		"SNAPSHOT_MAX_RETENTION": &policy.MaxRetention,
+	} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return Policy{}, fmt.Errorf("invalid %s %q", name, value)
+		}
+		*target = duration
+	}
+	if policy.Retention > policy.MaxRetention {
+		return Policy{}, fmt.Errorf("SNAPSHOT_RETENTION %s exceeds SNAPSHOT_MAX_RETENTION %s", policy.Retention, policy.MaxRetention)
+	}
+	return policy, nil
+}
+
+// Store creates, lists, and drops snapshots in the connected database.
+type Store struct {
+	conn   *database.Connection
+	policy Policy
+}
+
+// NewStore creates the registrations table if it does not exist yet.
+func NewStore(ctx context.Context, conn *database.Connection, policy Policy) (*Store, error) {
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(Table)+` (
+		name         VARCHAR(255) NOT NULL PRIMARY KEY,
+		query_text   TEXT NOT NULL,
+		columns_json TEXT NOT NULL,
+		row_count    BIGINT NOT NULL,
+		created_by   VARCHAR(255) NOT NULL,
+		created_at   TIMESTAMP NOT NULL,
+		expires_at   TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", Table, err)
+	}
+	return &Store{conn: conn, policy: policy}, nil
+}
+
+// List returns every snapshot, ordered by name.
+func (s *Store) List(ctx context.Context) ([]Snapshot, error) {
+	return s.list(ctx, "")
+}
+
+// Get returns the snapshot called name.
+func (s *Store) Get(ctx context.Context, name string) (Snapshot, error) {
+	if name == "" {
+		return Snapshot{}, ErrNotFound
+	}
+	snapshots, err := s.list(ctx, name)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(snapshots) == 0 {
+		return Snapshot{}, ErrNotFound
+	}
+	return snapshots[0], nil
+}
+
+// list returns the snapshots, or the one called name when it is set.
+func (s *Store) list(ctx context.Context, name string) ([]Snapshot, error) {
+	config := s.conn.Config
+	query := `SELECT name, query_text, columns_json, row_count, created_by, created_at, expires_at FROM ` + config.QuoteIdentifier(Table)
+	var args []interface{}
+	if name != "" {
+		query += ` WHERE name = ` + config.Placeholder(1)
+		args = append(args, name)
+	}
+	query += ` ORDER BY name`
+
+	rows, err := s.conn.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	var snapshots []Snapshot
+	for rows.Next() {
+		var snapshot Snapshot
+		var columns string
+		var createdAt, expiresAt sql.NullTime
+		if err := rows.Scan(&snapshot.Name, &snapshot.Query, &columns, &snapshot.Rows, &snapshot.CreatedBy, &createdAt, &expiresAt); err != nil {
+			return nil, fmt.Errorf("failed to scan snapshot: %w", err)
+		}
+		if err := json.Unmarshal([]byte(columns), &snapshot.Columns); err != nil {
+			return nil, fmt.Errorf("failed to read columns of snapshot %s: %w", snapshot.Name, err)
+		}
+		snapshot.CreatedAt, snapshot.ExpiresAt = createdAt.Time, expiresAt.Time
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// Create keeps a query result, its column names and rows, as the table
+// snapshot.Name and registers it, to be dropped once retention has passed;
+// zero keeps it for the policy's default retention. Column types follow the
+// values: a column holding more than one kind of value is text. The name
+// may not be taken by another table, except by an earlier snapshot when
+// replace is set, which the new one replaces.
+func (s *Store) Create(ctx context.Context, snapshot Snapshot, retention time.Duration, replace bool, columns []string, rows [][]interface{}) (Snapshot, error) {
+	snapshot.Name = strings.TrimSpace(snapshot.Name)
+	if !tableName.MatchString(snapshot.Name) || strings.HasPrefix(strings.ToLower(snapshot.Name), database.MetadataTablePrefix) {
+		return Snapshot{}, fmt.Errorf("%w: name must be letters, digits, and underscores, not starting with a digit or %q", ErrInvalid, database.MetadataTablePrefix)
+	}
+	switch {
+	case retention == 0:
+		retention = s.policy.Retention
+	case retention < 0:
+		return Snapshot{}, fmt.Errorf("%w: retention must be positive", ErrInvalid)
+	case retention > s.policy.MaxRetention:
+		return Snapshot{}, fmt.Errorf("%w: retention %s exceeds the maximum of %s", ErrInvalid, retention, s.policy.MaxRetention)
+	}
+	if len(columns) == 0 {
+		return Snapshot{}, fmt.Errorf("%w: the query returned no columns", ErrInvalid)
+	}
+	seen := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		if seen[strings.ToLower(column)] {
+			return Snapshot{}, fmt.Errorf("%w: the result has two columns named %s; alias one of them", ErrInvalid, column)
+		}
+		seen[strings.ToLower(column)] = true
+	}
+
+	existing, err := s.Get(ctx, snapshot.Name)
+	switch {
+	case err == nil && !replace:
+		return Snapshot{}, fmt.Errorf("%w: snapshot %s already exists; set replace to take it again", ErrInvalid, snapshot.Name)
+	case err == nil:
+		if err := s.Delete(ctx, existing.Name); err != nil {
+			return Snapshot{}, err
+		}
+	case !errors.Is(err, ErrNotFound):
+		return Snapshot{}, err
+	}
+	exists, err := s.conn.HasTable(ctx, snapshot.Name)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if exists {
+		return Snapshot{}, fmt.Errorf("%w: a table named %s already exists", ErrInvalid, snapshot.Name)
+	}
+
+	snapshot.Columns = inferColumns(columns, rows)
+	snapshot.Rows = int64(len(rows))
+	snapshot.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	snapshot.ExpiresAt = snapshot.CreatedAt.Add(retention)
+	if err := s.create(ctx, snapshot, rows); err != nil {
+		// MySQL commits CREATE TABLE at once, so the rollback may leave it
+		if _, dropErr := s.conn.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+s.conn.Config.QuoteIdentifier(snapshot.Name)); dropErr != nil {
+			slog.WarnContext(ctx, "failed to drop table of failed snapshot", "snapshot", snapshot.Name, "error", dropErr)
+		}
+		return Snapshot{}, err
+	}
+	s.conn.InvalidateSchema()
+	return snapshot, nil
+}
+
+// create creates the snapshot's table, copies its rows in, and saves the
+// registration, all in one transaction so a failure leaves nothing behind.
+func (s *Store) create(ctx context.Context, snapshot Snapshot, rows [][]interface{}) error {
+	columnsJSON, err := json.Marshal(snapshot.Columns)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.conn.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	config := s.conn.Config
+	definitions := make([]string, len(snapshot.Columns))
+	quoted := make([]string, len(snapshot.Columns))
+	for i, column := range snapshot.Columns {
+		quoted[i] = config.QuoteIdentifier(column.Name)
+		definitions[i] = quoted[i] + " " + column.sqlType(config.Type)
+	}
+	table := config.QuoteIdentifier(snapshot.Name)
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf("CREATE TABLE %s (%s)", table, strings.Join(definitions, ", "))); err != nil {
+		return fmt.Errorf("failed to create table %s: %w", snapshot.Name, err)
+	}
+
+	insert := fmt.Sprintf(`INSERT INTO %s (%s) VALUES `, table, strings.Join(quoted, ", "))
+	batchRows := max(1, insertBatchValues/len(snapshot.Columns))
+	for start := 0; start < len(rows); start += batchRows {
+		var values []string
+		var args []interface{}
+		for _, row := range rows[start:min(start+batchRows, len(rows))] {
+			placeholders := make([]string, len(row))
+			for i, value := range row {
+				args = append(args, snapshot.Columns[i].convert(value))
+				placeholders[i] = config.Placeholder(len(args))
+			}
+			values = append(values, "("+strings.Join(placeholders, ", ")+")")
+		}
+		if _, err := tx.ExecContext(ctx, insert+strings.Join(values, ", "), args...); err != nil {
+			return fmt.Errorf("failed to copy rows into %s: %w", snapshot.Name, err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO %s (name, query_text, columns_json, row_count, created_by, created_at, expires_at) VALUES (%s, %s, %s, %s, %s, %s, %s)`,
+		config.QuoteIdentifier(Table), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3),
+		config.Placeholder(4), config.Placeholder(5), config.Placeholder(6), config.Placeholder(7)),
+		snapshot.Name, snapshot.Query, string(columnsJSON), snapshot.Rows, snapshot.CreatedBy, snapshot.CreatedAt, snapshot.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to save snapshot: %w", err)
+	}
+	return tx.Commit()
+}
+
+// Delete drops a snapshot's table and its registration.
+func (s *Store) Delete(ctx context.Context, name string) error {
+	snapshot, err := s.Get(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	config := s.conn.Config
+	if _, err := s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE name = %s`, config.QuoteIdentifier(Table), config.Placeholder(1)), snapshot.Name); err != nil {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	if _, err := s.conn.DB.ExecContext(ctx, "DROP TABLE IF EXISTS "+config.QuoteIdentifier(snapshot.Name)); err != nil {
+		return fmt.Errorf("failed to drop table %s: %w", snapshot.Name, err)
+	}
+	s.conn.InvalidateSchema()
+	return nil
+}
+
+// Prune drops the snapshots whose retention has passed. It runs as a
+// scheduled task.
+func (s *Store) Prune(ctx context.Context) error {
+	snapshots, err := s.List(ctx)
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, snapshot := range snapshots {
+		if time.Now().Before(snapshot.ExpiresAt) {
+			continue
+		}
+		if err := s.Delete(ctx, snapshot.Name); err != nil && !errors.Is(err, ErrNotFound) {
+			errs = append(errs, err)
+			continue
+		}
+		slog.InfoContext(ctx, "snapshot expired", "snapshot", snapshot.Name, "created_at", snapshot.CreatedAt)
+	}
+	return errors.Join(errs...)
+}
+
+// inferColumns types each column after the values it holds.
+func inferColumns(names []string, rows [][]interface{}) []Column {
+	columns := make([]Column, len(names))
+	for i, name := range names {
+		columns[i] = Column{Name: name}
+		for _, row := range rows {
+			kind := typeOf(row[i])
+			switch {
+			case kind == "":
+			case columns[i].Type == "" || columns[i].Type == kind:
+				columns[i].Type = kind
+			case isNumeric(columns[i].Type) && isNumeric(kind):
+				columns[i].Type = TypeReal
+			default:
+				columns[i].Type = TypeText
+			}
+		}
+		if columns[i].Type == "" {
+			columns[i].Type = TypeText
+		}
+	}
+	return columns
+}
+
+// typeOf returns the column type a value fits, or "" for NULL.
+func typeOf(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return ""
+	case int, int8, int16, int32, int64, uint8, uint16, uint32:
+		return TypeInteger
+	case float32, float64:
+		return TypeReal
+	case bool:
+		return TypeBoolean
+	case time.Time:
+		return TypeTimestamp
+	}
+	return TypeText
+}
+
+// isNumeric reports whether a column type holds numbers.
+func isNumeric(kind string) bool {
+	return kind == TypeInteger || kind == TypeReal
+}
+
+// sqlType returns the column's type on a database of the given type.
+func (c Column) sqlType(dbType string) string {
+	switch c.Type {
+	case TypeInteger:
+		return "BIGINT"
+	case TypeReal:
+		switch dbType {
+		case "postgres":
+			return "DOUBLE PRECISION"
+		case "mysql", "duckdb":
+			return "DOUBLE"
+		}
+		return "REAL"
+	case TypeBoolean:
+		return "BOOLEAN"
+	case TypeTimestamp:
+		if dbType == "mysql" {
+			return "DATETIME(6)"
+		}
+		return "TIMESTAMP"
+	}
+	return "TEXT"
+}
+
+// convert turns a result value into one for the column: text columns take
+// other kinds of values as text.
+func (c Column) convert(value interface{}) interface{} {
+	if value == nil || c.Type != TypeText {
+		return value
+	}
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
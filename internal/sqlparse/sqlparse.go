@@ -0,0 +1,396 @@
+// Package sqlparse provides a lightweight SQL tokenizer for inspecting
+// LLM-generated SELECT statements: which tables they read and which
+// identifiers they mention. It is deliberately permissive and dialect-neutral.
+package sqlparse
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TokenKind classifies a SQL token.
+type TokenKind int
+
+const (
+	Word   TokenKind = iota // Bare keyword or identifier
+	Quoted                  // Quoted identifier ("x", `x`, [x])
+	String                  // String literal
+	Number                  // Numeric literal
+	Symbol                  // Punctuation and operators
+)
+
+// Token is a lexical unit of a SQL statement.
+type Token struct {
+	Kind  TokenKind
+	Value string // Identifier text without quotes, or the raw text
+	Pos   int    // Byte offset in the statement
+}
+
+// IsKeyword reports whether the token is the bare word kw, case-insensitively.
+func (t Token) IsKeyword(kw string) bool {
+	return t.Kind == Word && strings.EqualFold(t.Value, kw)
+}
+
+// IsIdentifier reports whether the token can name a table or column.
+func (t Token) IsIdentifier() bool {
+	return t.Kind == Word || t.Kind == Quoted
+}
+
+// Tokenize splits a SQL statement into tokens, dropping comments and whitespace.
+func Tokenize(sql string) []Token {
+	var tokens []Token
+	runes := []rune(sql)
+	offsets := make([]int, len(runes)+1)
+	pos := 0
+	for i, r := range runes {
+		offsets[i] = pos
+		pos += len(string(r))
+	}
+	offsets[len(runes)] = pos
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i += 2
+		case r == '\'':
+			start := i
+			i++
+			for i < len(runes) {
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			end := min(i, len(runes)-1)
+			tokens = append(tokens, Token{Kind: String, Value: string(runes[start : end+1]), Pos: offsets[start]})
+			i++
+		case r == '"' || r == '`' || r == '[':
+			closer := r
+			if r == '[' {
+				closer = ']'
+			}
+			start := i
+			i++
+			var b strings.Builder
+			for i < len(runes) {
+				if runes[i] == closer {
+					if i+1 < len(runes) && runes[i+1] == closer && closer != ']' {
+						b.WriteRune(closer)
+						i += 2
+						continue
+					}
+					break
+				}
+				b.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, Token{Kind: Quoted, Value: b.String(), Pos: offsets[start]})
+			i++
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: Word, Value: string(runes[start:i]), Pos: offsets[start]})
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E') {
+				i++
+			}
+			tokens = append(tokens, Token{Kind: Number, Value: string(runes[start:i]), Pos: offsets[start]})
+		default:
+			tokens = append(tokens, Token{Kind: Symbol, Value: string(r), Pos: offsets[i]})
+			i++
+		}
+	}
+
+	return tokens
+}
+
+// clauseKeywords end a FROM list.
+var clauseKeywords = map[string]bool{
+	"WHERE": true, "GROUP": true, "ORDER": true, "HAVING": true, "LIMIT": true,
+	"OFFSET": true, "UNION": true, "INTERSECT": true, "EXCEPT": true, "JOIN": true,
+	"INNER": true, "LEFT": true, "RIGHT": true, "FULL": true, "CROSS": true,
+	"NATURAL": true, "ON": true, "USING": true, "WINDOW": true, "FETCH": true,
+	"FOR": true, "OUTER": true, "TABLESAMPLE": true,
+}
+
+// readName reads a possibly schema-qualified name starting at i and returns it
+// with the index of the following token.
+func readName(tokens []Token, i int) (string, int) {
+	if i >= len(tokens) || !tokens[i].IsIdentifier() {
+		return "", i
+	}
+	name := tokens[i].Value
+	i++
+	for i+1 < len(tokens) && tokens[i].Value == "." && tokens[i+1].IsIdentifier() {
+		name += "." + tokens[i+1].Value
+		i += 2
+	}
+	return name, i
+}
+
+// readAlias reads an optional "AS alias" or bare alias after a table
+// reference and returns it, or "", with the index of the following token.
+func readAlias(tokens []Token, i int) (string, int) {
+	if i < len(tokens) && tokens[i].IsKeyword("AS") {
+		i++
+	}
+	if i < len(tokens) && tokens[i].IsIdentifier() && !(tokens[i].Kind == Word && clauseKeywords[strings.ToUpper(tokens[i].Value)]) {
+		return tokens[i].Value, i + 1
+	}
+	return "", i
+}
+
+// CTENames returns the names defined by WITH common table expressions.
+func CTENames(tokens []Token) map[string]bool {
+	names := make(map[string]bool)
+	for i := 0; i+2 < len(tokens); i++ {
+		if tokens[i].IsIdentifier() && tokens[i+1].IsKeyword("AS") && tokens[i+2].Value == "(" {
+			if i > 0 && (tokens[i-1].IsKeyword("WITH") || tokens[i-1].IsKeyword("RECURSIVE") || tokens[i-1].Value == ",") {
+				names[strings.ToLower(tokens[i].Value)] = true
+			}
+		}
+	}
+	return names
+}
+
+// tableRef is a table named in a FROM or JOIN clause, with its alias if it
+// has one.
+type tableRef struct {
+	name  string
+	alias string
+}
+
+// tableRefs returns the table references of FROM and JOIN clauses, excluding
+// CTE names, in the order they appear.
+func tableRefs(tokens []Token) []tableRef {
+	ctes := CTENames(tokens)
+	var refs []tableRef
+
+	add := func(name, alias string) {
+		if name != "" && !ctes[strings.ToLower(name)] {
+			refs = append(refs, tableRef{name: name, alias: alias})
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		switch {
+		case tokens[i].IsKeyword("FROM"):
+			j := i + 1
+			for j < len(tokens) {
+				if tokens[j].Value == "(" {
+					break
+				}
+				name, next := readName(tokens, j)
+				if name == "" {
+					break
+				}
+				var alias string
+				alias, j = readAlias(tokens, next)
+				add(name, alias)
+				if j < len(tokens) && tokens[j].Value == "," {
+					j++
+					continue
+				}
+				break
+			}
+		case tokens[i].IsKeyword("JOIN"):
+			if name, next := readName(tokens, i+1); name != "" {
+				alias, _ := readAlias(tokens, next)
+				add(name, alias)
+			}
+		}
+	}
+	return refs
+}
+
+// ReferencedTables returns the tables read by FROM and JOIN clauses, excluding
+// CTE names. Names keep any schema qualifier, e.g. "public.contacts".
+func ReferencedTables(sql string) []string {
+	seen := make(map[string]bool)
+	var tables []string
+	for _, ref := range tableRefs(Tokenize(sql)) {
+		key := strings.ToLower(ref.name)
+		if !seen[key] {
+			seen[key] = true
+			tables = append(tables, ref.name)
+		}
+	}
+	return tables
+}
+
+// TableAliases maps each alias given to a table in FROM and JOIN clauses,
+// lower-cased, to the table's name, so "FROM contacts c" yields c: contacts.
+func TableAliases(sql string) map[string]string {
+	aliases := make(map[string]string)
+	for _, ref := range tableRefs(Tokenize(sql)) {
+		if ref.alias != "" {
+			aliases[strings.ToLower(ref.alias)] = ref.name
+		}
+	}
+	return aliases
+}
+
+// Identifiers returns every identifier-like token in the statement, lower-cased
+// and with qualifiers split, so "c.phone_number" yields "c" and "phone_number".
+func Identifiers(sql string) []string {
+	var idents []string
+	for _, tok := range Tokenize(sql) {
+		if tok.IsIdentifier() {
+			idents = append(idents, strings.ToLower(tok.Value))
+		}
+	}
+	return idents
+}
+
+// MultipleStatements reports whether sql holds more than one statement: a
+// semicolon followed by anything other than comments and whitespace.
+func MultipleStatements(sql string) bool {
+	tokens := Tokenize(sql)
+	for i, tok := range tokens {
+		if tok.Kind != Symbol || tok.Value != ";" {
+			continue
+		}
+		for _, next := range tokens[i+1:] {
+			if next.Kind != Symbol || next.Value != ";" {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// HasSelectStar reports whether the statement selects * (including t.*).
+func HasSelectStar(sql string) bool {
+	tokens := Tokenize(sql)
+	for i, tok := range tokens {
+		if tok.Value != "*" {
+			continue
+		}
+		if i == 0 {
+			return true
+		}
+		prev := tokens[i-1]
+		if prev.IsKeyword("SELECT") || prev.IsKeyword("DISTINCT") || prev.Value == "," || prev.Value == "." {
+			return true
+		}
+	}
+	return false
+}
+
+// aliasIntroducers are keywords a name may follow without being an alias.
+var aliasIntroducers = map[string]bool{
+	"SELECT": true, "DISTINCT": true, "ALL": true, "FROM": true, "JOIN": true,
+	"WHERE": true, "AND": true, "OR": true, "NOT": true, "ON": true, "BY": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "IN": true, "IS": true,
+	"LIKE": true, "BETWEEN": true, "HAVING": true, "UNION": true, "INTERSECT": true,
+	"EXCEPT": true, "WITH": true, "RECURSIVE": true, "LATERAL": true, "INTERVAL": true,
+}
+
+// Aliases returns the names the statement may give to columns or tables,
+// lower-cased: those after AS, and bare names following another name or a
+// closing parenthesis, as in "SELECT lower(email) contact". It errs toward
+// including names that are not aliases.
+func Aliases(sql string) []string {
+	tokens := Tokenize(sql)
+	var aliases []string
+	for i := 1; i < len(tokens); i++ {
+		if !tokens[i].IsIdentifier() {
+			continue
+		}
+		prev := tokens[i-1]
+		switch {
+		case prev.IsKeyword("AS"), prev.Value == ")":
+		case prev.IsIdentifier() && !(prev.Kind == Word && aliasIntroducers[strings.ToUpper(prev.Value)]):
+		default:
+			continue
+		}
+		aliases = append(aliases, strings.ToLower(tokens[i].Value))
+	}
+	return aliases
+}
+
+// ColumnRef is a column named in a statement, lower-cased, with the table
+// or alias qualifying it, if any.
+type ColumnRef struct {
+	Qualifier string
+	Name      string
+}
+
+// filterEnders end a WHERE or ON condition.
+var filterEnders = map[string]bool{
+	"SELECT": true, "FROM": true, "JOIN": true, "GROUP": true, "ORDER": true,
+	"HAVING": true, "LIMIT": true, "OFFSET": true, "UNION": true, "INTERSECT": true,
+	"EXCEPT": true, "WINDOW": true, "FETCH": true, "INNER": true, "LEFT": true,
+	"RIGHT": true, "FULL": true, "CROSS": true, "NATURAL": true,
+}
+
+// comparisonWords may follow a column a condition compares.
+var comparisonWords = map[string]bool{
+	"LIKE": true, "ILIKE": true, "IN": true, "BETWEEN": true, "IS": true, "NOT": true,
+}
+
+// FilterColumns returns the columns that WHERE and JOIN ... ON conditions
+// compare, such as c.city in "WHERE c.city = 'Oslo'" or both sides of
+// "ON o.contact_id = c.id", in the order they appear. Columns passed to
+// functions are left out, since an index on the column would not serve them.
+func FilterColumns(sql string) []ColumnRef {
+	tokens := Tokenize(sql)
+	var refs []ColumnRef
+	inFilter := false
+	for i := 0; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.Kind == Word {
+			switch upper := strings.ToUpper(tok.Value); {
+			case upper == "WHERE" || upper == "ON":
+				inFilter = true
+				continue
+			case filterEnders[upper]:
+				inFilter = false
+				continue
+			}
+		}
+		if !inFilter || !tok.IsIdentifier() || (i > 0 && tokens[i-1].Value == ".") {
+			continue
+		}
+
+		ref := ColumnRef{Name: strings.ToLower(tok.Value)}
+		next := i + 1
+		if next+1 < len(tokens) && tokens[next].Value == "." && tokens[next+1].IsIdentifier() {
+			ref = ColumnRef{Qualifier: ref.Name, Name: strings.ToLower(tokens[next+1].Value)}
+			next += 2
+		}
+		if next < len(tokens) && tokens[next].Value == "(" {
+			continue // a function call
+		}
+		compared := next < len(tokens) && (strings.Contains("=<>!", tokens[next].Value) && tokens[next].Kind == Symbol ||
+			tokens[next].Kind == Word && comparisonWords[strings.ToUpper(tokens[next].Value)])
+		if !compared && i > 0 {
+			prev := tokens[i-1]
+			compared = prev.Kind == Symbol && strings.Contains("=<>", prev.Value)
+		}
+		if compared && !(tok.Kind == Word && aliasIntroducers[strings.ToUpper(tok.Value)]) {
+			refs = append(refs, ref)
+		}
+		i = next - 1
+	}
+	return refs
+}
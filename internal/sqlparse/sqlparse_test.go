@@ -0,0 +1,178 @@
+package sqlparse
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestReferencedTables(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"single table", "SELECT name FROM contacts", []string{"contacts"}},
+		{"schema qualified", "SELECT * FROM public.contacts", []string{"public.contacts"}},
+		{"comma list", "SELECT * FROM contacts, orders WHERE orders.contact_id = contacts.id", []string{"contacts", "orders"}},
+		{"joins", "SELECT * FROM contacts c JOIN orders o ON o.contact_id = c.id LEFT JOIN items i ON i.order_id = o.id", []string{"contacts", "orders", "items"}},
+		{"repeated table once", "SELECT * FROM contacts a JOIN contacts b ON a.id = b.id", []string{"contacts"}},
+		{"double-quoted identifier", `SELECT * FROM "Order Items"`, []string{"Order Items"}},
+		{"backtick identifier", "SELECT * FROM `orders`", []string{"orders"}},
+		{"bracket identifier", "SELECT * FROM [dbo].[orders]", []string{"dbo.orders"}},
+		{"quoted schema and table", `SELECT * FROM "sales"."orders" o`, []string{"sales.orders"}},
+		{"line comment", "SELECT * FROM contacts -- JOIN secrets ON true\nWHERE id = 1", []string{"contacts"}},
+		{"block comment", "SELECT * FROM /* salaries */ contacts", []string{"contacts"}},
+		{"keyword in string", "SELECT * FROM contacts WHERE note = 'FROM salaries'", []string{"contacts"}},
+		{"subquery in FROM", "SELECT * FROM (SELECT contact_id FROM orders) sub JOIN contacts c ON c.id = sub.contact_id", []string{"orders", "contacts"}},
+		{"subquery in WHERE", "SELECT name FROM contacts WHERE id IN (SELECT contact_id FROM orders)", []string{"contacts", "orders"}},
+		{"CTE excluded", "WITH recent AS (SELECT * FROM orders) SELECT * FROM recent JOIN contacts ON contacts.id = recent.contact_id", []string{"orders", "contacts"}},
+		{"several CTEs", "WITH a AS (SELECT * FROM orders), b AS (SELECT * FROM a) SELECT * FROM b", []string{"orders"}},
+		{"recursive CTE", "WITH RECURSIVE n AS (SELECT 1 AS x UNION ALL SELECT x + 1 FROM n) SELECT * FROM n", nil},
+		{"no FROM", "SELECT 1", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ReferencedTables(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReferencedTables(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want map[string]string
+	}{
+		{"bare alias", "SELECT * FROM contacts c", map[string]string{"c": "contacts"}},
+		{"AS alias", "SELECT * FROM contacts AS C", map[string]string{"c": "contacts"}},
+		{"join aliases", "SELECT * FROM contacts c JOIN orders AS o ON o.contact_id = c.id", map[string]string{"c": "contacts", "o": "orders"}},
+		{"quoted alias", `SELECT * FROM contacts "People"`, map[string]string{"people": "contacts"}},
+		{"keyword is not an alias", "SELECT * FROM contacts WHERE id = 1", map[string]string{}},
+		{"join keyword is not an alias", "SELECT * FROM contacts LEFT JOIN orders ON true", map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TableAliases(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TableAliases(%q) = %v, want %v", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentifiers(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"qualified column", "SELECT c.phone_number FROM contacts c", []string{"select", "c", "phone_number", "from", "contacts", "c"}},
+		{"quoted column", `SELECT "Email" FROM contacts`, []string{"select", "email", "from", "contacts"}},
+		{"comments and strings skipped", "SELECT id /* salary */ FROM contacts -- ssn\nWHERE name = 'ssn'", []string{"select", "id", "from", "contacts", "where", "name"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Identifiers(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Identifiers(%q) = %q, want %q", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMultipleStatements(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want bool
+	}{
+		{"single", "SELECT * FROM contacts", false},
+		{"trailing semicolon", "SELECT * FROM contacts;", false},
+		{"trailing semicolons and comment", "SELECT * FROM contacts; ; -- done\n/* end */", false},
+		{"semicolon in string", "SELECT * FROM contacts WHERE note = 'a; DROP TABLE contacts'", false},
+		{"semicolon in quoted identifier", `SELECT "a;b" FROM contacts`, false},
+		{"semicolon in comment", "SELECT * FROM contacts /* ; DELETE FROM contacts */", false},
+		{"stacked statement", "SELECT 1; DELETE FROM contacts", true},
+		{"stacked after comment", "SELECT 1; -- hi\nDELETE FROM contacts", true},
+		{"transaction escape", "SELECT 1; COMMIT; DROP TABLE contacts", true},
+		{"second select", "SELECT 1;SELECT 2", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MultipleStatements(tt.sql); got != tt.want {
+				t.Errorf("MultipleStatements(%q) = %v, want %v", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHasSelectStar(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want bool
+	}{
+		{"star", "SELECT * FROM contacts", true},
+		{"qualified star", "SELECT c.* FROM contacts c", true},
+		{"distinct star", "SELECT DISTINCT * FROM contacts", true},
+		{"star after column", "SELECT id, * FROM contacts", true},
+		{"count star", "SELECT COUNT(*) FROM contacts", false},
+		{"multiplication", "SELECT price * quantity FROM items", false},
+		{"named columns", "SELECT id, name FROM contacts", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasSelectStar(tt.sql); got != tt.want {
+				t.Errorf("HasSelectStar(%q) = %v, want %v", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
+
+// Aliases errs toward including names that are not aliases, so only the
+// presence of the expected ones is checked.
+func TestAliases(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{"AS alias", "SELECT email AS contact FROM contacts", []string{"contact"}},
+		{"quoted AS alias", `SELECT email AS "Contact" FROM contacts`, []string{"contact"}},
+		{"bare alias after function", "SELECT lower(email) contact FROM contacts", []string{"contact"}},
+		{"table aliases", "SELECT id FROM contacts c JOIN orders AS o ON o.contact_id = c.id", []string{"c", "o"}},
+		{"CTE subquery alias", "WITH r AS (SELECT id FROM orders) SELECT * FROM (SELECT id FROM r) sub", []string{"sub"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Aliases(tt.sql)
+			for _, alias := range tt.want {
+				if !slices.Contains(got, alias) {
+					t.Errorf("Aliases(%q) = %q, missing %q", tt.sql, got, alias)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []ColumnRef
+	}{
+		{"where equality", "SELECT * FROM contacts c WHERE c.city = 'Oslo'", []ColumnRef{{Qualifier: "c", Name: "city"}}},
+		{"join condition", "SELECT * FROM orders o JOIN contacts c ON o.contact_id = c.id", []ColumnRef{{Qualifier: "o", Name: "contact_id"}, {Qualifier: "c", Name: "id"}}},
+		{"comparison words", "SELECT * FROM contacts WHERE name LIKE 'A%' AND age BETWEEN 1 AND 2", []ColumnRef{{Name: "name"}, {Name: "age"}}},
+		{"function call skipped", "SELECT * FROM contacts WHERE lower(email) = 'a@b.c'", nil},
+		{"select list ignored", "SELECT city FROM contacts ORDER BY city", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FilterColumns(tt.sql); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FilterColumns(%q) = %+v, want %+v", tt.sql, got, tt.want)
+			}
+		})
+	}
+}
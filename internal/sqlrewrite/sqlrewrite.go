@@ -0,0 +1,313 @@
+// Package sqlrewrite recognizes SQL written for a different dialect than
+// the database's, such as SQLite's strftime run against PostgreSQL or LIMIT
+// against SQL Server. When such a query fails, Hints says what to use
+// instead, and Prompt asks the model to rewrite the query for the active
+// dialect. Constructs are found by pattern, so one inside a string literal
+// may be reported too; hints are guidance, never applied by themselves.
+package sqlrewrite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"data-chatter/internal/types"
+)
+
+// Hint is guidance about one construct of the query that the dialect does
+// not support.
+type Hint struct {
+	Construct string `json:"construct"` // e.g. "strftime" or "ILIKE"
+	Advice    string `json:"advice"`
+}
+
+// construct is a piece of SQL some dialects lack, with what to use in each
+// dialect that lacks it. Advice under "" applies to any dialect without
+// its own.
+type construct struct {
+	name    string
+	pattern *regexp.Regexp
+	native  []string
+	advice  map[string]string
+}
+
+// constructs are the dialect-specific pieces of SQL models most often carry
+// over from another dialect.
+var constructs = []construct{
+	{
+		name:    "strftime",
+		pattern: regexp.MustCompile(`(?i)\bstrftime\s*\(`),
+		native:  []string{"sqlite", "duckdb"},
+		advice: map[string]string{
+			"postgres":   "PostgreSQL has no strftime; use to_char(ts, 'YYYY-MM-DD'), date_trunc('month', ts), or EXTRACT(YEAR FROM ts)",
+			"mysql":      "MySQL has no strftime; use DATE_FORMAT(ts, '%Y-%m-%d'), YEAR(ts), or MONTH(ts)",
+			"sqlserver":  "SQL Server has no strftime; use FORMAT(ts, 'yyyy-MM-dd'), DATEPART(year, ts), or DATEFROMPARTS",
+			"clickhouse": "ClickHouse has no strftime; use formatDateTime(ts, '%Y-%m-%d'), toStartOfMonth(ts), or toYear(ts)",
+		},
+	},
+	{
+		name:    "date_trunc",
+		pattern: regexp.MustCompile(`(?i)\bdate_trunc\s*\(`),
+		native:  []string{"postgres", "duckdb", "clickhouse"},
+		advice: map[string]string{
+			"sqlite":    "SQLite has no date_trunc; use date(ts, 'start of month'), date(ts, 'start of year'), or strftime('%Y-%m', ts)",
+			"mysql":     "MySQL has no date_trunc; use DATE_FORMAT(ts, '%Y-%m-01') for months or MAKEDATE(YEAR(ts), 1) for years",
+			"sqlserver": "SQL Server before 2022 has no date_trunc; use DATEFROMPARTS(YEAR(ts), MONTH(ts), 1), or DATETRUNC(month, ts) on 2022 and later",
+		},
+	},
+	{
+		name:    "to_char",
+		pattern: regexp.MustCompile(`(?i)\bto_char\s*\(`),
+		native:  []string{"postgres"},
+		advice: map[string]string{
+			"sqlite":     "SQLite has no to_char; use strftime('%Y-%m-%d', ts)",
+			"mysql":      "MySQL has no to_char; use DATE_FORMAT(ts, '%Y-%m-%d')",
+			"duckdb":     "DuckDB has no to_char; use strftime(ts, '%Y-%m-%d')",
+			"sqlserver":  "SQL Server has no to_char; use FORMAT(ts, 'yyyy-MM-dd')",
+			"clickhouse": "ClickHouse has no to_char; use formatDateTime(ts, '%Y-%m-%d')",
+		},
+	},
+	{
+		name:    "DATE_FORMAT",
+		pattern: regexp.MustCompile(`(?i)\bdate_format\s*\(`),
+		native:  []string{"mysql"},
+		advice: map[string]string{
+			"sqlite":     "SQLite has no DATE_FORMAT; use strftime('%Y-%m-%d', ts)",
+			"postgres":   "PostgreSQL has no DATE_FORMAT; use to_char(ts, 'YYYY-MM-DD')",
+			"duckdb":     "DuckDB has no DATE_FORMAT; use strftime(ts, '%Y-%m-%d')",
+			"sqlserver":  "SQL Server has no DATE_FORMAT; use FORMAT(ts, 'yyyy-MM-dd')",
+			"clickhouse": "ClickHouse has no DATE_FORMAT; use formatDateTime(ts, '%Y-%m-%d')",
+		},
+	},
+	{
+		name:    "julianday",
+		pattern: regexp.MustCompile(`(?i)\b(?:julianday|datetime\s*\(\s*'now')\s*\(?`),
+		native:  []string{"sqlite"},
+		advice: map[string]string{
+			"":          "julianday and datetime('now') are SQLite functions; use CURRENT_TIMESTAMP and the dialect's date arithmetic",
+			"postgres":  "julianday and datetime('now') are SQLite functions; use now() and subtract dates directly (date_a - date_b gives days)",
+			"mysql":     "julianday and datetime('now') are SQLite functions; use NOW() and DATEDIFF(a, b) for days between dates",
+			"sqlserver": "julianday and datetime('now') are SQLite functions; use GETDATE() and DATEDIFF(day, a, b)",
+		},
+	},
+	{
+		name:    "DATEADD/DATEDIFF",
+		pattern: regexp.MustCompile(`(?i)\b(?:dateadd|datediff)\s*\(\s*(?:year|quarter|month|week|day|hour|minute|second|yy|qq|mm|wk|dd|hh|mi|ss)\s*,`),
+		native:  []string{"sqlserver", "clickhouse"},
+		advice: map[string]string{
+			"sqlite":   "SQLite has no DATEADD or DATEDIFF; use date(ts, '+7 days') and julianday(a) - julianday(b)",
+			"postgres": "PostgreSQL has no DATEADD or DATEDIFF; use ts + INTERVAL '7 days' and date_a - date_b, or EXTRACT(EPOCH FROM a - b)",
+			"mysql":    "MySQL's DATEDIFF takes two dates; use DATE_ADD(ts, INTERVAL 7 DAY) and TIMESTAMPDIFF(DAY, a, b)",
+			"duckdb":   "DuckDB has no DATEADD; use ts + INTERVAL 7 DAY and date_diff('day', a, b)",
+		},
+	},
+	{
+		name:    "GETDATE()",
+		pattern: regexp.MustCompile(`(?i)\bgetdate\s*\(\s*\)`),
+		native:  []string{"sqlserver"},
+		advice: map[string]string{
+			"":       "GETDATE() is SQL Server's; use CURRENT_TIMESTAMP",
+			"sqlite": "GETDATE() is SQL Server's; use datetime('now') or CURRENT_TIMESTAMP",
+		},
+	},
+	{
+		name:    "now()",
+		pattern: regexp.MustCompile(`(?i)\bnow\s*\(\s*\)`),
+		native:  []string{"postgres", "mysql", "duckdb", "clickhouse"},
+		advice: map[string]string{
+			"sqlite":    "SQLite has no now(); use datetime('now') or CURRENT_TIMESTAMP",
+			"sqlserver": "SQL Server has no now(); use GETDATE() or SYSDATETIME()",
+		},
+	},
+	{
+		name:    "INTERVAL",
+		pattern: regexp.MustCompile(`(?i)\binterval\s+'`),
+		native:  []string{"postgres", "duckdb", "clickhouse", "mysql"},
+		advice: map[string]string{
+			"sqlite":    "SQLite has no INTERVAL; use date modifiers such as date(ts, '-30 days') or datetime('now', '-1 month')",
+			"sqlserver": "SQL Server has no INTERVAL; use DATEADD(day, -30, ts)",
+		},
+	},
+	{
+		name:    "EXTRACT",
+		pattern: regexp.MustCompile(`(?i)\bextract\s*\(`),
+		native:  []string{"postgres", "mysql", "duckdb", "clickhouse"},
+		advice: map[string]string{
+			"sqlite":    "SQLite has no EXTRACT; use CAST(strftime('%Y', ts) AS INTEGER), with %m for the month or %d for the day",
+			"sqlserver": "SQL Server has no EXTRACT; use DATEPART(year, ts), YEAR(ts), or MONTH(ts)",
+		},
+	},
+	{
+		name:    "::",
+		pattern: regexp.MustCompile(`[\w)'"\]]::\s*[a-zA-Z]`),
+		native:  []string{"postgres", "duckdb", "clickhouse"},
+		advice: map[string]string{
+			"": "The :: cast is not supported; use CAST(value AS type)",
+		},
+	},
+	{
+		name:    "ILIKE",
+		pattern: regexp.MustCompile(`(?i)\bilike\b`),
+		native:  []string{"postgres", "duckdb", "clickhouse"},
+		advice: map[string]string{
+			"": "ILIKE is not supported; use LOWER(column) LIKE LOWER('pattern')",
+		},
+	},
+	{
+		name:    "LIMIT",
+		pattern: regexp.MustCompile(`(?i)\blimit\s+\d+`),
+		native:  []string{"sqlite", "postgres", "mysql", "duckdb", "clickhouse"},
+		advice: map[string]string{
+			"sqlserver": "SQL Server has no LIMIT; use SELECT TOP n, or ORDER BY ... OFFSET 0 ROWS FETCH NEXT n ROWS ONLY",
+		},
+	},
+	{
+		name:    "TOP",
+		pattern: regexp.MustCompile(`(?i)\bselect\s+(?:distinct\s+)?top\s*\(?\s*\d+`),
+		native:  []string{"sqlserver"},
+		advice: map[string]string{
+			"": "TOP is SQL Server's; put LIMIT n at the end of the query",
+		},
+	},
+	{
+		name:    "IFNULL/ISNULL",
+		pattern: regexp.MustCompile(`(?i)\b(?:ifnull|isnull)\s*\(`),
+		native:  []string{"sqlite", "mysql", "duckdb", "clickhouse", "sqlserver"},
+		advice: map[string]string{
+			"postgres": "PostgreSQL has no IFNULL or ISNULL; use COALESCE(value, fallback)",
+		},
+	},
+	{
+		name:    "GROUP_CONCAT",
+		pattern: regexp.MustCompile(`(?i)\bgroup_concat\s*\(`),
+		native:  []string{"sqlite", "mysql", "duckdb"},
+		advice: map[string]string{
+			"postgres":   "PostgreSQL has no GROUP_CONCAT; use string_agg(value, ',')",
+			"sqlserver":  "SQL Server has no GROUP_CONCAT; use STRING_AGG(value, ',')",
+			"clickhouse": "ClickHouse has no GROUP_CONCAT; use arrayStringConcat(groupArray(value), ',')",
+		},
+	},
+	{
+		name:    "string_agg",
+		pattern: regexp.MustCompile(`(?i)\bstring_agg\s*\(`),
+		native:  []string{"postgres", "sqlserver", "duckdb"},
+		advice: map[string]string{
+			"sqlite":     "SQLite has no string_agg; use group_concat(value, ',')",
+			"mysql":      "MySQL has no string_agg; use GROUP_CONCAT(value SEPARATOR ',')",
+			"clickhouse": "ClickHouse has no string_agg; use arrayStringConcat(groupArray(value), ',')",
+		},
+	},
+	{
+		name:    "backtick quoting",
+		pattern: regexp.MustCompile("`[^`]+`"),
+		native:  []string{"mysql", "clickhouse", "sqlite"},
+		advice: map[string]string{
+			"":          "Backtick quoting is MySQL's; quote identifiers with double quotes",
+			"sqlserver": "Backtick quoting is MySQL's; quote identifiers with [brackets] or double quotes",
+		},
+	},
+	{
+		name:    "||",
+		pattern: regexp.MustCompile(`\|\|`),
+		native:  []string{"sqlite", "postgres", "duckdb", "clickhouse"},
+		advice: map[string]string{
+			"mysql":     "In MySQL || is a logical OR; concatenate with CONCAT(a, b)",
+			"sqlserver": "SQL Server has no || operator; concatenate with CONCAT(a, b) or +",
+		},
+	},
+}
+
+// Applies reports whether a failure with the tool error code may come from
+// SQL written for another dialect: a syntax error, or a function or object
+// that does not exist.
+func Applies(code string) bool {
+	return code == types.ErrorSyntax || code == types.ErrorUndefinedObject
+}
+
+// Hints returns guidance for each construct in query that dialect, a
+// database type such as "postgres", does not support.
+func Hints(dialect, query string) []Hint {
+	var hints []Hint
+	for _, c := range constructs {
+		if contains(c.native, dialect) {
+			continue
+		}
+		if !c.pattern.MatchString(query) {
+			continue
+		}
+		advice, ok := c.advice[dialect]
+		if !ok {
+			if advice, ok = c.advice[""]; !ok {
+				continue
+			}
+		}
+		hints = append(hints, Hint{Construct: c.name, Advice: advice})
+	}
+	return hints
+}
+
+// DialectName returns the display name of a database type, such as
+// "PostgreSQL" for "postgres".
+func DialectName(dialect string) string {
+	switch dialect {
+	case "postgres":
+		return "PostgreSQL"
+	case "mysql":
+		return "MySQL"
+	case "duckdb":
+		return "DuckDB"
+	case "clickhouse":
+		return "ClickHouse"
+	case "sqlserver":
+		return "SQL Server"
+	default:
+		return "SQLite"
+	}
+}
+
+// SystemPrompt instructs the model to rewrite a failed query.
+const SystemPrompt = "You fix SQL queries that failed because they were written for the wrong SQL dialect. " +
+	"Rewrite the query for the dialect given so it returns the same result, changing only what the dialect requires. " +
+	"The query must stay a single read-only SELECT. Output only the SQL, with no explanation and no code fence."
+
+// Prompt asks for query, which failed with failure, to be rewritten for
+// dialect, passing on hints.
+func Prompt(dialect, query, failure string, hints []Hint) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Database: %s\n\nQuery:\n%s\n\nError:\n%s\n", DialectName(dialect), query, failure)
+	if len(hints) > 0 {
+		b.WriteString("\nHints:\n")
+		for _, hint := range hints {
+			fmt.Fprintf(&b, "- %s\n", hint.Advice)
+		}
+	}
+	return b.String()
+}
+
+// fence matches a markdown code fence around the model's SQL.
+var fence = regexp.MustCompile("(?s)^```[a-zA-Z]*\\s*(.*?)\\s*```$")
+
+// ExtractSQL returns the SQL in the model's reply, without a code fence or
+// trailing semicolon, failing when the reply is not a SELECT or WITH query.
+func ExtractSQL(reply string) (string, error) {
+	sql := strings.TrimSpace(reply)
+	if m := fence.FindStringSubmatch(sql); m != nil {
+		sql = m[1]
+	}
+	sql = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(sql), ";"))
+	upper := strings.ToUpper(sql)
+	if !strings.HasPrefix(upper, "SELECT") && !strings.HasPrefix(upper, "WITH") {
+		return "", fmt.Errorf("the rewritten query is not a SELECT")
+	}
+	return sql, nil
+}
+
+// contains reports whether values holds value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
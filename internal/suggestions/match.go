@@ -0,0 +1,111 @@
+package suggestions
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// DefaultMatchThreshold is the similarity above which a user's question is
+// answered by a suggestion's saved query instead of the LLM.
+const DefaultMatchThreshold = 0.9
+
+// trigramWeight scales the character trigrams of each word relative to the
+// word itself, so misspellings and inflections still overlap without
+// outweighing the words.
+const trigramWeight = 0.3
+
+// stopWords carry no meaning for matching questions to one another.
+var stopWords = map[string]bool{
+	"a": true, "all": true, "an": true, "and": true, "are": true, "can": true,
+	"do": true, "does": true, "for": true, "give": true, "has": true,
+	"have": true, "i": true, "is": true, "list": true, "me": true, "my": true,
+	"of": true, "our": true, "please": true, "show": true, "tell": true,
+	"the": true, "there": true, "to": true, "us": true, "we": true,
+	"what": true, "which": true,
+}
+
+// Embedding is a question as a unit-length sparse vector of its word stems
+// and their character trigrams. It is computed locally, so matching needs no
+// embedding service and gives the same answer every time.
+type Embedding map[string]float64
+
+// Embed computes the embedding of text.
+func Embed(text string) Embedding {
+	embedding := make(Embedding)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	for _, word := range words {
+		if stopWords[word] {
+			continue
+		}
+		word = stem(word)
+		embedding["w:"+word]++
+
+		padded := []rune("^" + word + "$")
+		for i := 0; i+3 <= len(padded); i++ {
+			embedding["t:"+string(padded[i:i+3])] += trigramWeight
+		}
+	}
+
+	var norm float64
+	for _, weight := range embedding {
+		norm += weight * weight
+	}
+	norm = math.Sqrt(norm)
+	for term := range embedding {
+		embedding[term] /= norm
+	}
+	return embedding
+}
+
+// Similarity returns the cosine similarity of two embeddings, from 0 for
+// questions with nothing in common to 1 for the same question.
+func (e Embedding) Similarity(other Embedding) float64 {
+	if len(other) < len(e) {
+		e, other = other, e
+	}
+	var dot float64
+	for term, weight := range e {
+		dot += weight * other[term]
+	}
+	return dot
+}
+
+// stem strips common English plural endings, so "contacts" matches "contact".
+func stem(word string) string {
+	switch {
+	case len(word) > 4 && strings.HasSuffix(word, "ies"):
+		return word[:len(word)-3] + "y"
+	case len(word) > 3 && strings.HasSuffix(word, "s") && !strings.HasSuffix(word, "ss"):
+		return word[:len(word)-1]
+	}
+	return word
+}
+
+// Match returns the suggestion whose question is most similar to question,
+// with its similarity, if it reaches the store's match threshold. allowed
+// filters the candidates, e.g. to those the caller may run.
+func (s *Store) Match(question string, allowed func(Suggestion) bool) (Suggestion, float64, bool) {
+	if s == nil || s.threshold <= 0 {
+		return Suggestion{}, 0, false
+	}
+	asked := Embed(question)
+	if len(asked) == 0 {
+		return Suggestion{}, 0, false
+	}
+
+	var best Suggestion
+	var bestSimilarity float64
+	for _, suggestion := range s.List() {
+		similarity := asked.Similarity(Embed(suggestion.Question))
+		if similarity > bestSimilarity && allowed(suggestion) {
+			best, bestSimilarity = suggestion, similarity
+		}
+	}
+	if bestSimilarity < s.threshold {
+		return Suggestion{}, bestSimilarity, false
+	}
+	return best, bestSimilarity, true
+}
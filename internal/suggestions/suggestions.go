@@ -0,0 +1,237 @@
+// Package suggestions keeps the catalog of suggested questions admins
+// publish for users to start from. Each question is answered by a saved
+// query rather than the LLM, so everyone who asks it gets the same answer,
+// as do users who type a question close enough to it.
+package suggestions
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	maxQuestionLength    = 200
+	maxDescriptionLength = 1000
+)
+
+var (
+	// ErrNotFound is returned for unknown suggestion IDs.
+	ErrNotFound = errors.New("suggestion not found")
+
+	// ErrInvalid is returned for suggestions missing a question or query, or
+	// with fields over their length limits.
+	ErrInvalid = errors.New("invalid suggestion")
+)
+
+// Suggestion is a suggested question and the saved query that answers it.
+type Suggestion struct {
+	ID          string    `json:"id"`
+	Question    string    `json:"question"`
+	Description string    `json:"description,omitempty"`
+	SQL         string    `json:"sql"`
+	CreatedBy   string    `json:"created_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Validate checks the question, description, and that a query is set. The
+// query itself is checked by running it before it is saved.
+func (s Suggestion) Validate() error {
+	switch {
+	case strings.TrimSpace(s.Question) == "":
+		return fmt.Errorf("%w: question is required", ErrInvalid)
+	case len(s.Question) > maxQuestionLength:
+		return fmt.Errorf("%w: question is limited to %d characters", ErrInvalid, maxQuestionLength)
+	case len(s.Description) > maxDescriptionLength:
+		return fmt.Errorf("%w: description is limited to %d characters", ErrInvalid, maxDescriptionLength)
+	case strings.TrimSpace(s.SQL) == "":
+		return fmt.Errorf("%w: sql is required", ErrInvalid)
+	}
+	return nil
+}
+
+// Store holds the catalog in publication order, optionally persisted to a
+// JSON file so it survives restarts.
+type Store struct {
+	mu          sync.RWMutex
+	path        string
+	threshold   float64
+	suggestions []Suggestion
+}
+
+// NewStoreFromEnv creates a store persisted to SUGGESTIONS_FILE, loading any
+// suggestions already in the file. The store is kept in memory only when the
+// variable is unset. SUGGESTION_MATCH_THRESHOLD sets the similarity, between
+// 0 and 1, above which Match answers a question with a suggestion; 0 turns
+// matching off.
+func NewStoreFromEnv() (*Store, error) {
+	store := &Store{path: os.Getenv("SUGGESTIONS_FILE"), threshold: DefaultMatchThreshold}
+	if value := os.Getenv("SUGGESTION_MATCH_THRESHOLD"); value != "" {
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil || threshold < 0 || threshold > 1 {
+			return nil, fmt.Errorf("invalid SUGGESTION_MATCH_THRESHOLD %q: must be a number from 0 to 1", value)
+		}
+		store.threshold = threshold
+	}
+	if store.path == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suggestions: %w", err)
+	}
+	if err := json.Unmarshal(data, &store.suggestions); err != nil {
+		return nil, fmt.Errorf("failed to parse suggestions: %w", err)
+	}
+	return store, nil
+}
+
+// List returns every suggestion in publication order.
+func (s *Store) List() []Suggestion {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]Suggestion{}, s.suggestions...)
+}
+
+// Get returns the suggestion with id.
+func (s *Store) Get(id string) (Suggestion, error) {
+	if s == nil {
+		return Suggestion{}, ErrNotFound
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if i := s.index(id); i >= 0 {
+		return s.suggestions[i], nil
+	}
+	return Suggestion{}, ErrNotFound
+}
+
+// Add publishes a new suggestion.
+func (s *Store) Add(suggestion Suggestion) (Suggestion, error) {
+	if err := suggestion.Validate(); err != nil {
+		return Suggestion{}, err
+	}
+	suggestion.ID = newID()
+	suggestion.UpdatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.suggestions = append(s.suggestions, suggestion)
+	if err := s.save(); err != nil {
+		s.suggestions = s.suggestions[:len(s.suggestions)-1]
+		return Suggestion{}, err
+	}
+	return suggestion, nil
+}
+
+// Update replaces the question, description, and query of the suggestion
+// with id, keeping its author.
+func (s *Store) Update(id string, suggestion Suggestion) (Suggestion, error) {
+	if err := suggestion.Validate(); err != nil {
+		return Suggestion{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return Suggestion{}, ErrNotFound
+	}
+	previous := s.suggestions[i]
+	suggestion.ID = id
+	suggestion.CreatedBy = previous.CreatedBy
+	suggestion.UpdatedAt = time.Now().UTC()
+	s.suggestions[i] = suggestion
+	if err := s.save(); err != nil {
+		s.suggestions[i] = previous
+		return Suggestion{}, err
+	}
+	return suggestion, nil
+}
+
+// Delete removes the suggestion with id from the catalog.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	previous := s.suggestions
+	s.suggestions = append(append([]Suggestion{}, previous[:i]...), previous[i+1:]...)
+	if err := s.save(); err != nil {
+		s.suggestions = previous
+		return err
+	}
+	return nil
+}
+
+// Replace swaps the whole catalog for suggestions, as when restoring a
+// backup.
+func (s *Store) Replace(suggestions []Suggestion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.suggestions
+	s.suggestions = append([]Suggestion{}, suggestions...)
+	if err := s.save(); err != nil {
+		s.suggestions = previous
+		return err
+	}
+	return nil
+}
+
+// index returns the position of the suggestion with id, or -1. Callers must hold s.mu.
+func (s *Store) index(id string) int {
+	for i, suggestion := range s.suggestions {
+		if suggestion.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// save writes the catalog to the store's file, if it has one, replacing the
+// file atomically. Callers must hold s.mu.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.suggestions, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode suggestions: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write suggestions: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write suggestions: %w", err)
+	}
+	return nil
+}
+
+// newID returns a random suggestion ID.
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
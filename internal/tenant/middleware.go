@@ -0,0 +1,64 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"data-chatter/internal/apierror"
+	"data-chatter/internal/auth"
+)
+
+// Middleware resolves each request to its tenant and routes it to the
+// tenant's database. It runs after auth.Middleware, which attaches the user
+// whose token may name the tenant. Requests that cannot be resolved are
+// rejected, except to public paths such as /health. A nil registry leaves
+// multi-tenant mode off and passes every request through.
+func Middleware(registry *Registry) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if registry == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.IsPublic(r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := r.Header.Get(APIKeyHeader)
+			ctx, err := registry.Resolve(r.Context(), key)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if key != "" {
+				ctx = context.WithValue(ctx, apiKeyKey{}, key)
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// apiKeyKey is the context key of the API key a request was sent with.
+type apiKeyKey struct{}
+
+// APIKey returns the tenant API key ctx's request was sent with, or "", so
+// requests made on its behalf, such as a chat turn's tool calls, can send
+// it too.
+func APIKey(ctx context.Context) string {
+	key, _ := ctx.Value(apiKeyKey{}).(string)
+	return key
+}
+
+// writeError responds with 401 or 403 and a JSON error body, or with 503
+// when the tenant's settings could not be read.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status, message := http.StatusServiceUnavailable, "Tenant settings unavailable"
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		status, message = http.StatusUnauthorized, "Unauthorized"
+	case errors.Is(err, ErrForbidden):
+		status, message = http.StatusForbidden, "Forbidden"
+	}
+	apierror.Write(w, r, status, message, apierror.New(apierror.ForStatus(status), err.Error()))
+}
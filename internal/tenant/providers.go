@@ -0,0 +1,289 @@
+package tenant
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/encryption"
+	"data-chatter/internal/llm"
+	"data-chatter/internal/redact"
+)
+
+const (
+	// ProviderTable is where tenants' own LLM provider settings are kept,
+	// in the default database. Its dc_ prefix keeps it out of the schema
+	// shown to users and the LLM.
+	ProviderTable = database.MetadataTablePrefix + "tenant_providers"
+
+	// providerCacheTTL is how long a tenant's settings are reused before
+	// they are read again, so changes made on another replica apply within
+	// it.
+	providerCacheTTL = time.Minute
+)
+
+var (
+	// ErrInvalid is returned for provider settings that cannot be saved.
+	ErrInvalid = errors.New("invalid provider settings")
+
+	// ErrNotFound is returned for tenants that have not set a provider.
+	ErrNotFound = errors.New("provider settings not found")
+)
+
+// ProviderUpdate sets the LLM provider a tenant's requests are sent to, with
+// the tenant's own API key so that its usage bills to its own account. An
+// empty APIKey keeps the key already saved for the same provider, so the
+// model can be changed without sending the key again.
+type ProviderUpdate struct {
+	Provider string `json:"provider"`
+	APIKey   string `json:"api_key,omitempty"`
+	Model    string `json:"model,omitempty"`
+}
+
+// ProviderSettings are a tenant's saved provider settings. The API key is
+// never returned, only its last four characters.
+type ProviderSettings struct {
+	Tenant    string    `json:"tenant"`
+	Provider  string    `json:"provider"`
+	Model     string    `json:"model,omitempty"`
+	KeyHint   string    `json:"key_hint"`
+	UpdatedBy string    `json:"updated_by"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// cachedProvider is a tenant's provider as last read, or found false when
+// it had none.
+type cachedProvider struct {
+	provider llm.Provider
+	found    bool
+	expires  time.Time
+}
+
+// ProviderStore keeps tenants' provider settings, with their API keys
+// encrypted.
+type ProviderStore struct {
+	conn *database.Connection
+	keys *encryption.Keyring
+
+	mu    sync.Mutex
+	cache map[string]cachedProvider
+}
+
+// NewProviderStore creates the provider settings table if it does not exist
+// yet. API keys are only ever stored encrypted, so keys must be enabled.
+func NewProviderStore(ctx context.Context, conn *database.Connection, keys *encryption.Keyring) (*ProviderStore, error) {
+	if !keys.Enabled() {
+		return nil, errors.New("tenant API keys are stored only when HISTORY_ENCRYPTION_KEYS is set")
+	}
+	if err := conn.Config.CheckMetadataTables(); err != nil {
+		return nil, err
+	}
+
+	_, err := conn.DB.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+conn.Config.QuoteIdentifier(ProviderTable)+` (
+		tenant_id  VARCHAR(64) NOT NULL PRIMARY KEY,
+		provider   VARCHAR(32) NOT NULL,
+		api_key    TEXT NOT NULL,
+		model      VARCHAR(255) NOT NULL,
+		updated_by VARCHAR(255) NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", ProviderTable, err)
+	}
+	return &ProviderStore{conn: conn, keys: keys, cache: make(map[string]cachedProvider)}, nil
+}
+
+// Get returns tenant's provider settings.
+func (s *ProviderStore) Get(ctx context.Context, tenant string) (ProviderSettings, error) {
+	settings, _, err := s.get(ctx, tenant)
+	return settings, err
+}
+
+// get returns tenant's provider settings and its opened API key.
+func (s *ProviderStore) get(ctx context.Context, tenant string) (ProviderSettings, string, error) {
+	config := s.conn.Config
+	settings := ProviderSettings{Tenant: tenant}
+	var sealed string
+	var updatedAt int64
+	err := s.conn.DB.QueryRowContext(ctx,
+		fmt.Sprintf(`SELECT provider, api_key, model, updated_by, updated_at FROM %s WHERE tenant_id = %s`,
+			config.QuoteIdentifier(ProviderTable), config.Placeholder(1)),
+		tenant).Scan(&settings.Provider, &sealed, &settings.Model, &settings.UpdatedBy, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ProviderSettings{}, "", fmt.Errorf("%w: tenant %s", ErrNotFound, tenant)
+	}
+	if err != nil {
+		return ProviderSettings{}, "", fmt.Errorf("failed to read provider settings: %w", err)
+	}
+	key, err := s.keys.Open(sealed)
+	if err != nil {
+		return ProviderSettings{}, "", err
+	}
+	settings.KeyHint = keyHint(key)
+	settings.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+	return settings, key, nil
+}
+
+// Set saves tenant's provider settings, replacing any earlier ones.
+func (s *ProviderStore) Set(ctx context.Context, tenant string, update ProviderUpdate, updatedBy string) (ProviderSettings, error) {
+	update.Provider = strings.ToLower(strings.TrimSpace(update.Provider))
+	update.APIKey = strings.TrimSpace(update.APIKey)
+	update.Model = strings.TrimSpace(update.Model)
+	if !llm.ValidProvider(update.Provider) {
+		return ProviderSettings{}, fmt.Errorf("%w: provider must be %s or %s", ErrInvalid, llm.ProviderAnthropic, llm.ProviderOpenAI)
+	}
+	if len(update.Model) > 255 {
+		return ProviderSettings{}, fmt.Errorf("%w: model name is too long", ErrInvalid)
+	}
+	if update.APIKey == "" {
+		current, key, err := s.get(ctx, tenant)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return ProviderSettings{}, err
+		}
+		if err != nil || current.Provider != update.Provider {
+			return ProviderSettings{}, fmt.Errorf("%w: api_key is required", ErrInvalid)
+		}
+		update.APIKey = key
+	}
+	sealed, err := s.keys.Seal(update.APIKey)
+	if err != nil {
+		return ProviderSettings{}, err
+	}
+
+	settings := ProviderSettings{
+		Tenant:    tenant,
+		Provider:  update.Provider,
+		Model:     update.Model,
+		KeyHint:   keyHint(update.APIKey),
+		UpdatedBy: updatedBy,
+		UpdatedAt: time.Now().UTC().Truncate(time.Millisecond),
+	}
+	config := s.conn.Config
+	insert := fmt.Sprintf(`INSERT INTO %s (tenant_id, provider, api_key, model, updated_by, updated_at) VALUES (%s, %s, %s, %s, %s, %s)`,
+		config.QuoteIdentifier(ProviderTable), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3),
+		config.Placeholder(4), config.Placeholder(5), config.Placeholder(6))
+	if config.Type == "mysql" {
+		insert += ` ON DUPLICATE KEY UPDATE provider = VALUES(provider), api_key = VALUES(api_key), model = VALUES(model), updated_by = VALUES(updated_by), updated_at = VALUES(updated_at)`
+	} else {
+		insert += ` ON CONFLICT (tenant_id) DO UPDATE SET provider = excluded.provider, api_key = excluded.api_key, model = excluded.model, updated_by = excluded.updated_by, updated_at = excluded.updated_at`
+	}
+	if _, err := s.conn.DB.ExecContext(ctx, insert, tenant, settings.Provider, sealed, settings.Model, updatedBy, settings.UpdatedAt.UnixMilli()); err != nil {
+		return ProviderSettings{}, fmt.Errorf("failed to save provider settings: %w", err)
+	}
+	s.forget(tenant)
+	return settings, nil
+}
+
+// Delete removes tenant's provider settings, so its requests go back to the
+// server's provider.
+func (s *ProviderStore) Delete(ctx context.Context, tenant string) error {
+	config := s.conn.Config
+	result, err := s.conn.DB.ExecContext(ctx,
+		fmt.Sprintf(`DELETE FROM %s WHERE tenant_id = %s`, config.QuoteIdentifier(ProviderTable), config.Placeholder(1)),
+		tenant)
+	if err != nil {
+		return fmt.Errorf("failed to delete provider settings: %w", err)
+	}
+	s.forget(tenant)
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("%w: tenant %s", ErrNotFound, tenant)
+	}
+	return nil
+}
+
+// Provider returns the provider tenant's requests are sent to, and false
+// when it has not set one. Settings are cached for providerCacheTTL.
+func (s *ProviderStore) Provider(ctx context.Context, tenant string) (llm.Provider, bool, error) {
+	s.mu.Lock()
+	cached, ok := s.cache[tenant]
+	s.mu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.provider, cached.found, nil
+	}
+
+	cached = cachedProvider{expires: time.Now().Add(providerCacheTTL)}
+	settings, key, err := s.get(ctx, tenant)
+	switch {
+	case err == nil:
+		redact.Secret(key)
+		cached.provider = llm.Provider{Name: settings.Provider, APIKey: key, Model: settings.Model}
+		cached.found = true
+	case !errors.Is(err, ErrNotFound):
+		return llm.Provider{}, false, err
+	}
+
+	s.mu.Lock()
+	s.cache[tenant] = cached
+	s.mu.Unlock()
+	return cached.provider, cached.found, nil
+}
+
+// forget drops tenant's cached settings after they change.
+func (s *ProviderStore) forget(tenant string) {
+	s.mu.Lock()
+	delete(s.cache, tenant)
+	s.mu.Unlock()
+}
+
+// Reseal encrypts again the API keys sealed with a key other than the
+// current one, after a key is rotated. It runs as a scheduled task.
+func (s *ProviderStore) Reseal(ctx context.Context) error {
+	config := s.conn.Config
+	rows, err := s.conn.DB.QueryContext(ctx,
+		fmt.Sprintf(`SELECT tenant_id, api_key FROM %s WHERE api_key NOT LIKE %s`,
+			config.QuoteIdentifier(ProviderTable), config.Placeholder(1)),
+		s.keys.CurrentPrefix()+"%")
+	if err != nil {
+		return fmt.Errorf("failed to read provider settings: %w", err)
+	}
+	stale := make(map[string]string)
+	for rows.Next() {
+		var tenant, sealed string
+		if err := rows.Scan(&tenant, &sealed); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read provider settings: %w", err)
+		}
+		stale[tenant] = sealed
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read provider settings: %w", err)
+	}
+
+	for tenant, sealed := range stale {
+		key, err := s.keys.Open(sealed)
+		if err != nil {
+			return err
+		}
+		resealed, err := s.keys.Seal(key)
+		if err != nil {
+			return err
+		}
+		_, err = s.conn.DB.ExecContext(ctx,
+			fmt.Sprintf(`UPDATE %s SET api_key = %s WHERE tenant_id = %s AND api_key = %s`,
+				config.QuoteIdentifier(ProviderTable), config.Placeholder(1), config.Placeholder(2), config.Placeholder(3)),
+			resealed, tenant, sealed)
+		if err != nil {
+			return fmt.Errorf("failed to reseal provider settings: %w", err)
+		}
+	}
+	if len(stale) > 0 {
+		slog.InfoContext(ctx, "resealed tenant API keys", "tenants", len(stale))
+	}
+	return nil
+}
+
+// keyHint returns the last four characters of key, enough to tell keys
+// apart without revealing them.
+func keyHint(key string) string {
+	if len(key) <= 4 {
+		return strings.Repeat("*", len(key))
+	}
+	return "..." + key[len(key)-4:]
+}
@@ -0,0 +1,267 @@
+// Package tenant runs the server as a shared service for several tenants.
+// Each tenant has its own database, with its own schema cache, and may have
+// its own audit log. Requests are resolved to a tenant from the tenant claim
+// of their token or from their API key, and are routed to that tenant's
+// database; conversations, history, and everything else kept per user are
+// kept per tenant, since user IDs are qualified with the tenant. Tenants
+// may send their LLM requests to a provider of their own, with their own
+// API key.
+package tenant
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+
+	"data-chatter/internal/audit"
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+	"data-chatter/internal/llm"
+)
+
+// APIKeyHeader is the request header carrying a tenant's API key.
+const APIKeyHeader = "X-API-Key"
+
+// tenantID is what a tenant may be called: it prefixes its users' IDs.
+var tenantID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+var (
+	// ErrUnauthorized is returned for requests that name no tenant or
+	// present an unknown API key.
+	ErrUnauthorized = errors.New("tenant not identified")
+
+	// ErrForbidden is returned for tokens whose tenant is not configured
+	// or does not match the API key sent with them.
+	ErrForbidden = errors.New("tenant not allowed")
+)
+
+// Config describes a tenant in TENANTS_FILE. Provider and Model are the
+// LLM provider and model its requests use by default, with the server's
+// API key unless the tenant saves its own; a provider other than the
+// server's needs the tenant's own key.
+type Config struct {
+	ID           string         `json:"id"`
+	APIKeys      []string       `json:"api_keys,omitempty"`
+	Database     DatabaseConfig `json:"database"`
+	AuditLogFile string         `json:"audit_log_file,omitempty"`
+	Provider     string         `json:"provider,omitempty"`
+	Model        string         `json:"model,omitempty"`
+}
+
+// DatabaseConfig names a tenant's database. Tenant databases are of the
+// default database's type, so they share its SQL dialect and limits; fields
+// left empty keep the default database's values. Password may refer to
+// environment variables as ${NAME}.
+type DatabaseConfig = database.Target
+
+// ConfigsFromEnv reads the tenants in the JSON file named by TENANTS_FILE,
+// an array of Config. API keys and passwords may refer to environment
+// variables as ${NAME}, so the file need not hold secrets. It returns nil,
+// leaving multi-tenant mode off, when the variable is unset.
+func ConfigsFromEnv() ([]Config, error) {
+	path := os.Getenv("TENANTS_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tenants: %w", err)
+	}
+	var configs []Config
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse tenants: %w", err)
+	}
+	if len(configs) == 0 {
+		return nil, errors.New("TENANTS_FILE lists no tenants")
+	}
+
+	ids, keys := make(map[string]bool), make(map[string]string)
+	for i := range configs {
+		config := &configs[i]
+		if !tenantID.MatchString(config.ID) {
+			return nil, fmt.Errorf("invalid tenant id %q: want lowercase letters, digits, dashes, and underscores", config.ID)
+		}
+		if ids[config.ID] {
+			return nil, fmt.Errorf("tenant %s is listed twice", config.ID)
+		}
+		ids[config.ID] = true
+		if config.Provider != "" && !llm.ValidProvider(config.Provider) {
+			return nil, fmt.Errorf("tenant %s has unknown provider %q", config.ID, config.Provider)
+		}
+
+		for j, key := range config.APIKeys {
+			key = os.ExpandEnv(key)
+			if key == "" {
+				return nil, fmt.Errorf("tenant %s has an empty API key", config.ID)
+			}
+			if other, taken := keys[key]; taken {
+				return nil, fmt.Errorf("tenants %s and %s share an API key", other, config.ID)
+			}
+			keys[key] = config.ID
+			config.APIKeys[j] = key
+		}
+		config.Database.Password = os.ExpandEnv(config.Database.Password)
+	}
+	return configs, nil
+}
+
+// Tenant is a configured tenant, the connection to its database, and its
+// default LLM provider.
+type Tenant struct {
+	ID       string
+	Conn     *database.Connection
+	Provider llm.Provider
+}
+
+// apiKey is a tenant's API key, kept as a hash so keys are compared in
+// constant time whatever their length.
+type apiKey struct {
+	hash   [sha256.Size]byte
+	tenant *Tenant
+}
+
+// Registry holds the tenants and resolves requests to them.
+type Registry struct {
+	tenants   map[string]*Tenant
+	keys      []apiKey
+	closers   []io.Closer
+	providers *ProviderStore
+}
+
+// Open connects to every tenant's database and opens their audit logs,
+// sending each tenant's audit entries to its own file. Each connection
+// copies the settings of base, the default connection, and its PII masking,
+// result cache, and slow query log; it reads and caches its own schema.
+func Open(configs []Config, base *database.Connection, auditLog *audit.Recorder) (*Registry, error) {
+	r := &Registry{tenants: make(map[string]*Tenant, len(configs))}
+	for _, config := range configs {
+		conn, err := connect(config, base)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.closers = append(r.closers, conn)
+		tenant := &Tenant{ID: config.ID, Conn: conn, Provider: llm.Provider{Name: config.Provider, Model: config.Model}}
+		r.tenants[config.ID] = tenant
+		for _, key := range config.APIKeys {
+			r.keys = append(r.keys, apiKey{hash: sha256.Sum256([]byte(key)), tenant: tenant})
+		}
+
+		if config.AuditLogFile != "" {
+			file, err := os.OpenFile(config.AuditLogFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				r.Close()
+				return nil, fmt.Errorf("failed to open audit log of tenant %s: %w", config.ID, err)
+			}
+			r.closers = append(r.closers, file)
+			auditLog.SetTenantOutput(config.ID, file)
+		}
+	}
+	slog.Info("multi-tenant mode enabled", "tenants", r.IDs())
+	return r, nil
+}
+
+// connect opens the database of the tenant config describes.
+func connect(config Config, base *database.Connection) (*database.Connection, error) {
+	conn, err := base.Derive(config.Database)
+	if err != nil {
+		return nil, fmt.Errorf("database of tenant %s: %w", config.ID, err)
+	}
+	conn.Tenant = config.ID
+	return conn, nil
+}
+
+// IDs returns the tenants' IDs in order.
+func (r *Registry) IDs() []string {
+	ids := make([]string, 0, len(r.tenants))
+	for id := range r.tenants {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// UseProviders has tenants' LLM requests sent with the provider settings
+// they saved in store, in place of their defaults.
+func (r *Registry) UseProviders(store *ProviderStore) {
+	r.providers = store
+}
+
+// Route returns ctx carrying tenant id, routed to its database, and sending
+// LLM requests to its provider.
+func (r *Registry) Route(ctx context.Context, id string) (context.Context, error) {
+	tenant, ok := r.tenants[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: tenant %q is not configured", ErrForbidden, id)
+	}
+	provider := tenant.Provider
+	if r.providers != nil {
+		saved, found, err := r.providers.Provider(ctx, tenant.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the provider settings of tenant %s: %w", tenant.ID, err)
+		}
+		if found {
+			provider = saved
+		}
+	}
+	ctx = database.WithConnection(auth.WithTenant(ctx, tenant.ID), tenant.Conn)
+	return llm.WithProvider(ctx, provider), nil
+}
+
+// Resolve routes ctx to the tenant named by the tenant claim of its user's
+// token or, without one, to the tenant whose API key is key. When both are
+// present they must agree.
+func (r *Registry) Resolve(ctx context.Context, key string) (context.Context, error) {
+	var keyTenant *Tenant
+	if key != "" {
+		keyTenant = r.lookup(key)
+		if keyTenant == nil {
+			return nil, fmt.Errorf("%w: invalid API key", ErrUnauthorized)
+		}
+	}
+
+	id := ""
+	if user := auth.UserFromContext(ctx); user != nil {
+		id = user.Tenant
+	}
+	switch {
+	case id != "" && keyTenant != nil && keyTenant.ID != id:
+		return nil, fmt.Errorf("%w: the API key belongs to another tenant than the token", ErrForbidden)
+	case id != "":
+		return r.Route(ctx, id)
+	case keyTenant != nil:
+		return r.Route(ctx, keyTenant.ID)
+	default:
+		return nil, fmt.Errorf("%w: send a tenant API key in %s or a token with a tenant claim", ErrUnauthorized, APIKeyHeader)
+	}
+}
+
+// lookup returns the tenant whose API key is key, or nil. Every key is
+// compared, so the time taken does not reveal which one matched.
+func (r *Registry) lookup(key string) *Tenant {
+	hash := sha256.Sum256([]byte(key))
+	var found *Tenant
+	for _, k := range r.keys {
+		if subtle.ConstantTimeCompare(hash[:], k.hash[:]) == 1 {
+			found = k.tenant
+		}
+	}
+	return found
+}
+
+// Close closes the tenants' connections and audit logs.
+func (r *Registry) Close() error {
+	var errs []error
+	for _, closer := range r.closers {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"data-chatter/internal/columnar"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+)
+
+// ArrowStreamContentType is the media type of an Arrow IPC stream.
+const ArrowStreamContentType = "application/vnd.apache.arrow.stream"
+
+// StreamArrow runs query and writes the result to w as an Arrow IPC stream,
+// one record batch per columnar.DefaultBatchSize rows, so large results are
+// never held in memory as rows. Nothing is written to w until the first batch
+// is complete; if an error is returned after that, the stream is truncated
+// and lacks its end-of-stream marker. It returns the number of rows written.
+// The MaxResultRows cap does not apply, since the stream is never buffered.
+func (d *DatabaseQueryTool) StreamArrow(ctx context.Context, query string, w io.Writer) (int, error) {
+	var (
+		writer   *ipc.Writer
+		builder  *columnar.Builder
+		rowCount int
+	)
+
+	emit := func(record arrow.Record) error {
+		if writer == nil {
+			writer = ipc.NewWriter(w, ipc.WithSchema(record.Schema()))
+		}
+		rowCount += int(record.NumRows())
+		return writer.Write(record)
+	}
+	setColumns := func(columns []string) {
+		builder = columnar.NewBuilder(columns, columnar.DefaultBatchSize, emit)
+	}
+	addRow := func(values []interface{}) error {
+		return builder.Append(values)
+	}
+
+	if err := d.scanRows(ctx, query, nil, 0, setColumns, addRow); err != nil {
+		return rowCount, err
+	}
+	if err := builder.Close(); err != nil {
+		return rowCount, fmt.Errorf("failed to write record batch: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return rowCount, fmt.Errorf("failed to finish Arrow stream: %w", err)
+	}
+	return rowCount, nil
+}
@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"data-chatter/internal/artifacts"
+	"data-chatter/internal/database"
+	"data-chatter/internal/render"
+	"data-chatter/internal/types"
+)
+
+// ArtifactCreateTool attaches a file to the current turn for the user to
+// download: a query's result as CSV, a chart of it as a PNG image, or a
+// markdown report the model writes.
+type ArtifactCreateTool struct {
+	queryTool *DatabaseQueryTool
+	store     *artifacts.Store
+}
+
+// NewArtifactCreateTool creates a new artifact tool instance. Its calls
+// fail until SetStore is called.
+func NewArtifactCreateTool(conn *database.Connection) *ArtifactCreateTool {
+	return &ArtifactCreateTool{queryTool: NewDatabaseQueryTool(conn)}
+}
+
+// SetStore sets the store artifacts are saved in.
+func (t *ArtifactCreateTool) SetStore(store *artifacts.Store) {
+	t.store = store
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *ArtifactCreateTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "artifact_create",
+		Description: "Create a file the user can download with the answer: a CSV export or a PNG chart of a read-only SQL SELECT query's result, or a markdown report. Use it when the user asks for a file, export, download, or report",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"kind": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{artifacts.KindCSV, artifacts.KindChart, artifacts.KindMarkdown},
+					"description": "csv exports the query's rows, chart draws them as a PNG image, markdown saves content as a report",
+				},
+				"name": map[string]interface{}{
+					"type":        "string",
+					"description": "File name without extension, e.g. revenue_by_month",
+				},
+				"description": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional one-line description of the file shown next to the download; for charts, name what the axes and colors show, since the image has no labels",
+				},
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "SQL SELECT query producing the data, for csv and chart",
+				},
+				"chart_type": map[string]interface{}{
+					"type":        "string",
+					"enum":        render.ChartTypes,
+					"description": "Type of chart, for chart",
+				},
+				"x": map[string]interface{}{
+					"type":        "string",
+					"description": "Result column for the x axis (or the category for pie charts), for chart",
+				},
+				"y": map[string]interface{}{
+					"type":        "string",
+					"description": "Numeric result column for the y axis (or the value for pie charts), for chart",
+				},
+				"series": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional result column used to color separate series, for chart",
+				},
+				"content": map[string]interface{}{
+					"type":        "string",
+					"description": "The report's markdown, for markdown",
+				},
+			},
+			"required": []string{"kind", "name"},
+		},
+	}
+}
+
+// Validate checks the inputs each kind needs, applying query validation to
+// the data query of CSV exports and charts.
+func (t *ArtifactCreateTool) Validate(input map[string]interface{}) error {
+	kind, _ := input["kind"].(string)
+	switch kind {
+	case artifacts.KindCSV:
+		return t.queryTool.Validate(input)
+	case artifacts.KindChart:
+		chartType, _ := input["chart_type"].(string)
+		if !slices.Contains(render.ChartTypes, chartType) {
+			return fmt.Errorf("chart_type must be one of %s", strings.Join(render.ChartTypes, ", "))
+		}
+		for _, field := range []string{"x", "y"} {
+			if value, _ := input[field].(string); value == "" {
+				return fmt.Errorf("%s must be a non-empty column name", field)
+			}
+		}
+		return t.queryTool.Validate(input)
+	case artifacts.KindMarkdown:
+		if content, _ := input["content"].(string); strings.TrimSpace(content) == "" {
+			return fmt.Errorf("content is required for markdown reports")
+		}
+		if len(input["content"].(string)) > artifacts.MaxBytes {
+			return fmt.Errorf("content must be at most %d bytes", artifacts.MaxBytes)
+		}
+		return nil
+	}
+	return fmt.Errorf("kind must be one of %s, %s, %s", artifacts.KindCSV, artifacts.KindChart, artifacts.KindMarkdown)
+}
+
+// Execute builds the file, saves it, and returns its description. The
+// artifact is attached to the turn in the call context.
+func (t *ArtifactCreateTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	if t.store == nil {
+		return nil, errors.New("artifacts are unavailable")
+	}
+
+	cc := types.CallContextFrom(ctx)
+	artifact := artifacts.Artifact{
+		Kind:           input["kind"].(string),
+		Name:           input["name"].(string),
+		ConversationID: cc.ConversationID,
+		TurnID:         cc.TurnID,
+		CreatedBy:      cc.UserID,
+	}
+	artifact.Description, _ = input["description"].(string)
+	response := map[string]interface{}{}
+
+	var data []byte
+	if artifact.Kind == artifacts.KindMarkdown {
+		data = []byte(input["content"].(string))
+	} else {
+		query := input["query"].(string)
+		columns, rows, err := t.queryTool.runQuery(ctx, query)
+		if err != nil {
+			return queryErrorResult(err), nil
+		}
+		response["query"] = query
+		response["row_count"] = len(rows)
+
+		if artifact.Kind == artifacts.KindCSV {
+			var buf bytes.Buffer
+			if err := render.WriteCSV(&buf, columns, render.Cells(columns, rows, render.NullsEmpty)); err != nil {
+				return nil, err
+			}
+			data = buf.Bytes()
+		} else {
+			chart := render.Chart{Type: input["chart_type"].(string), X: input["x"].(string), Y: input["y"].(string)}
+			chart.Series, _ = input["series"].(string)
+			for _, field := range []string{chart.X, chart.Y, chart.Series} {
+				if field != "" && !containsColumn(columns, field) {
+					return validationErrorResult(fmt.Sprintf("column %q is not in the query result (columns: %s)", field, strings.Join(columns, ", "))), nil
+				}
+			}
+			data, err = render.ChartPNG(chart, rows)
+			if err != nil {
+				return validationErrorResult(err.Error()), nil
+			}
+		}
+	}
+
+	saved, err := t.store.Create(ctx, artifact, data)
+	if errors.Is(err, artifacts.ErrInvalid) {
+		return validationErrorResult(err.Error()), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	response["artifact"] = saved
+
+	jsonData, _ := json.MarshalIndent(response, "", "  ")
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
@@ -0,0 +1,121 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"data-chatter/internal/calc"
+	"data-chatter/internal/types"
+)
+
+// variableName matches the names calculate's variables may have.
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// CalculateTool evaluates arithmetic on figures the LLM already has, such
+// as percentages, ratios, growth rates, and date differences, so derived
+// figures are computed rather than worked out in-token.
+type CalculateTool struct{}
+
+// NewCalculateTool creates a new calculate tool instance.
+func NewCalculateTool() *CalculateTool {
+	return &CalculateTool{}
+}
+
+// calculation is the calculate tool's result.
+type calculation struct {
+	Expression string      `json:"expression"`
+	Result     interface{} `json:"result"`
+	Type       string      `json:"type"` // number or date
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *CalculateTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name: "calculate",
+		Description: "Evaluate an arithmetic expression exactly, for percentages, ratios, growth rates, averages, and date arithmetic on figures you already have, such as values from the question or earlier answers. Use it instead of doing arithmetic yourself. " +
+			"Operators: + - * / % ^ and parentheses. Dates are written 'YYYY-MM-DD'; subtracting two dates gives days, and adding a number to a date adds days. " +
+			"Functions: " + strings.Join(calc.Functions(), ", ") + ". pct, pct_change, and cagr return percentages",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"expression": map[string]interface{}{
+					"type":        "string",
+					"description": "The expression, e.g. pct_change(revenue_2024, revenue_2025) or '2025-03-31' - '2025-01-01'",
+				},
+				"variables": map[string]interface{}{
+					"type":                 "object",
+					"description":          "Optional named values used in the expression: numbers, or dates as 'YYYY-MM-DD' strings",
+					"additionalProperties": map[string]interface{}{"type": []string{"number", "string"}},
+				},
+			},
+			"required": []string{"expression"},
+		},
+	}
+}
+
+// Validate checks that the input has an expression and well-formed
+// variables.
+func (t *CalculateTool) Validate(input map[string]interface{}) error {
+	expression, ok := input["expression"].(string)
+	if !ok || strings.TrimSpace(expression) == "" {
+		return fmt.Errorf("expression must be a non-empty string")
+	}
+	if len(expression) > calc.MaxLength {
+		return fmt.Errorf("expression must be at most %d characters", calc.MaxLength)
+	}
+	_, err := calculateVariables(input)
+	return err
+}
+
+// Execute evaluates the expression and returns its result as JSON.
+func (t *CalculateTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	expression, _ := input["expression"].(string)
+	variables, err := calculateVariables(input)
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+
+	value, err := calc.Evaluate(expression, variables)
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+	result := calculation{Expression: expression, Result: value.Result(), Type: "number"}
+	if value.IsDate {
+		result.Type = "date"
+	}
+	jsonData, _ := json.MarshalIndent(result, "", "  ")
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
+
+// calculateVariables reads the variables of a calculate call.
+func calculateVariables(input map[string]interface{}) (map[string]calc.Value, error) {
+	raw, exists := input["variables"]
+	if !exists {
+		return nil, nil
+	}
+	object, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("variables must be an object of names to numbers or dates")
+	}
+	variables := make(map[string]calc.Value, len(object))
+	for name, value := range object {
+		if !variableName.MatchString(name) {
+			return nil, fmt.Errorf("variable name %q must be letters, digits, and underscores, not starting with a digit", name)
+		}
+		parsed, err := calc.ParseValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %v", name, err)
+		}
+		variables[name] = parsed
+	}
+	return variables, nil
+}
@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"data-chatter/internal/calendar"
+	"data-chatter/internal/types"
+)
+
+// DateRangeTool resolves periods such as "last fiscal quarter" or "this
+// month to date" to dates, and counts the business days in them, by the
+// configured business calendars.
+type DateRangeTool struct {
+	calendars *calendar.Set
+}
+
+// NewDateRangeTool creates a new date range tool instance over calendars.
+func NewDateRangeTool(calendars *calendar.Set) *DateRangeTool {
+	return &DateRangeTool{calendars: calendars}
+}
+
+// dateRange is the date_range tool's result.
+type dateRange struct {
+	Calendar     string            `json:"calendar"`
+	Label        string            `json:"label,omitempty"`
+	Start        string            `json:"start"`
+	End          string            `json:"end"`
+	EndExclusive string            `json:"end_exclusive"`
+	Days         int               `json:"days"`
+	BusinessDays int               `json:"business_days"`
+	Holidays     []calendar.DayOff `json:"holidays"`
+	Today        string            `json:"today"`
+}
+
+// GetDefinition returns the tool definition for LLM integration, naming
+// the calendars when there are several.
+func (t *DateRangeTool) GetDefinition() types.ToolDefinition {
+	description := "Resolve a period such as last fiscal quarter, this week, or this month to date into start and end dates, with the number of days, the business days (excluding weekends and holidays), and the holidays in it, by the business calendar. Pass start and end instead of period to count the business days between two dates. Use it before filtering on fiscal periods, weeks, or business days rather than working the dates out yourself"
+	if len(t.calendars.Calendars) > 1 {
+		description += ". Calendars: " + strings.Join(t.calendars.Names(), ", ") + " (default " + t.calendars.Default().Name + ")"
+	}
+
+	return types.ToolDefinition{
+		Name:        "date_range",
+		Description: description,
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"period": map[string]interface{}{
+					"type":        "string",
+					"enum":        calendar.Units,
+					"description": "The kind of period; weeks start on the calendar's week start day",
+				},
+				"offset": map[string]interface{}{
+					"type":        "integer",
+					"description": "Periods from the current one: 0 this period (default), -1 the last, 1 the next",
+				},
+				"date": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional YYYY-MM-DD date whose period is meant; defaults to today",
+				},
+				"to_date": map[string]interface{}{
+					"type":        "boolean",
+					"description": "End a period containing date (today by default) at that date, e.g. quarter to date",
+				},
+				"start": map[string]interface{}{
+					"type":        "string",
+					"description": "YYYY-MM-DD first day of a range, instead of period",
+				},
+				"end": map[string]interface{}{
+					"type":        "string",
+					"description": "YYYY-MM-DD last day of a range, inclusive, instead of period",
+				},
+				"calendar": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional calendar name; omit for the default calendar",
+				},
+			},
+		},
+	}
+}
+
+// Validate checks that the input names either a period or a start and an
+// end, and that dates, offset, and calendar are well formed.
+func (t *DateRangeTool) Validate(input map[string]interface{}) error {
+	for _, name := range []string{"period", "date", "start", "end", "calendar"} {
+		if raw, exists := input[name]; exists {
+			if value, ok := raw.(string); !ok || value == "" {
+				return fmt.Errorf("%s must be a non-empty string", name)
+			}
+		}
+	}
+	for _, name := range []string{"date", "start", "end"} {
+		if value, ok := input[name].(string); ok {
+			if _, err := time.Parse(time.DateOnly, value); err != nil {
+				return fmt.Errorf("%s must be a YYYY-MM-DD date", name)
+			}
+		}
+	}
+	if raw, exists := input["offset"]; exists {
+		n, ok := raw.(float64)
+		if !ok || n != math.Trunc(n) || math.Abs(n) > 1000 {
+			return fmt.Errorf("offset must be an integer between -1000 and 1000")
+		}
+	}
+	if raw, exists := input["to_date"]; exists {
+		if _, ok := raw.(bool); !ok {
+			return fmt.Errorf("to_date must be a boolean")
+		}
+	}
+
+	_, hasPeriod := input["period"]
+	_, hasStart := input["start"]
+	_, hasEnd := input["end"]
+	switch {
+	case hasPeriod && (hasStart || hasEnd):
+		return fmt.Errorf("pass either period or start and end, not both")
+	case !hasPeriod && (!hasStart || !hasEnd):
+		return fmt.Errorf("period, or start and end, is required")
+	}
+	if name, ok := input["calendar"].(string); ok {
+		if _, found := t.calendars.Get(name); !found {
+			return fmt.Errorf("unknown calendar %q; calendars: %s", name, strings.Join(t.calendars.Names(), ", "))
+		}
+	}
+	return nil
+}
+
+// Execute resolves the period or range and returns it as JSON.
+func (t *DateRangeTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	name, _ := input["calendar"].(string)
+	c, found := t.calendars.Get(name)
+	if !found {
+		return validationErrorResult(fmt.Sprintf("unknown calendar %q", name)), nil
+	}
+	today := c.Today()
+
+	var r calendar.Range
+	if period, ok := input["period"].(string); ok {
+		anchor := today
+		if value, ok := input["date"].(string); ok {
+			anchor, _ = time.Parse(time.DateOnly, value)
+		}
+		offset, _ := input["offset"].(float64)
+		toDate, _ := input["to_date"].(bool)
+		var err error
+		if r, err = c.Period(period, int(offset), anchor, toDate); err != nil {
+			return validationErrorResult(err.Error()), nil
+		}
+	} else {
+		start, _ := time.Parse(time.DateOnly, input["start"].(string))
+		end, _ := time.Parse(time.DateOnly, input["end"].(string))
+		if end.Before(start) {
+			return validationErrorResult("end must not be before start"), nil
+		}
+		r = calendar.Range{Start: start, End: end}
+	}
+	if r.Days() > calendar.MaxRangeDays {
+		return validationErrorResult(fmt.Sprintf("the range spans more than %d days", calendar.MaxRangeDays)), nil
+	}
+
+	holidays := c.HolidaysBetween(r.Start, r.End)
+	if holidays == nil {
+		holidays = []calendar.DayOff{}
+	}
+	jsonData, _ := json.MarshalIndent(dateRange{
+		Calendar:     c.Name,
+		Label:        r.Label,
+		Start:        r.Start.Format(time.DateOnly),
+		End:          r.End.Format(time.DateOnly),
+		EndExclusive: r.End.AddDate(0, 0, 1).Format(time.DateOnly),
+		Days:         r.Days(),
+		BusinessDays: c.BusinessDays(r.Start, r.End),
+		Holidays:     holidays,
+		Today:        today.Format(time.DateOnly),
+	}, "", "  ")
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
@@ -0,0 +1,193 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/types"
+)
+
+// chartMarks maps supported chart types to their Vega-Lite mark.
+var chartMarks = map[string]string{
+	"bar":     "bar",
+	"line":    "line",
+	"area":    "area",
+	"scatter": "point",
+	"pie":     "arc",
+}
+
+// ChartRenderTool builds a Vega-Lite chart specification from a query result
+// so clients can render visualizations of the data.
+type ChartRenderTool struct {
+	queryTool *DatabaseQueryTool
+}
+
+// NewChartRenderTool creates a new chart rendering tool instance.
+func NewChartRenderTool(conn *database.Connection) *ChartRenderTool {
+	return &ChartRenderTool{
+		queryTool: NewDatabaseQueryTool(conn),
+	}
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (c *ChartRenderTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "chart_render",
+		Description: "Render the result of a read-only SQL SELECT query as a chart (bar, line, area, scatter, or pie)",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "SQL SELECT query producing the data to chart, typically an aggregation",
+				},
+				"chart_type": map[string]interface{}{
+					"type":        "string",
+					"enum":        []string{"bar", "line", "area", "scatter", "pie"},
+					"description": "Type of chart to render",
+				},
+				"x": map[string]interface{}{
+					"type":        "string",
+					"description": "Result column for the x axis (or the category for pie charts)",
+				},
+				"y": map[string]interface{}{
+					"type":        "string",
+					"description": "Result column for the y axis (or the value for pie charts)",
+				},
+				"series": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional result column used to color separate series",
+				},
+				"title": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional chart title",
+				},
+			},
+			"required": []string{"query", "chart_type", "x", "y"},
+		},
+	}
+}
+
+// Validate checks the chart parameters and applies query validation to the data query.
+func (c *ChartRenderTool) Validate(input map[string]interface{}) error {
+	chartType, _ := input["chart_type"].(string)
+	if _, ok := chartMarks[chartType]; !ok {
+		return fmt.Errorf("chart_type must be one of bar, line, area, scatter, pie")
+	}
+
+	for _, field := range []string{"x", "y"} {
+		if value, _ := input[field].(string); value == "" {
+			return fmt.Errorf("%s must be a non-empty column name", field)
+		}
+	}
+
+	return c.queryTool.Validate(input)
+}
+
+// Execute runs the data query and returns a Vega-Lite spec with the rows inlined.
+func (c *ChartRenderTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	query := input["query"].(string)
+	chartType := input["chart_type"].(string)
+	x := input["x"].(string)
+	y := input["y"].(string)
+	series, _ := input["series"].(string)
+	title, _ := input["title"].(string)
+
+	columns, rows, err := c.queryTool.runQuery(ctx, query)
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+
+	for _, field := range []string{x, y, series} {
+		if field != "" && !containsColumn(columns, field) {
+			return validationErrorResult(fmt.Sprintf("column %q is not in the query result (columns: %s)", field, strings.Join(columns, ", "))), nil
+		}
+	}
+
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+
+	response := map[string]interface{}{
+		"query":      query,
+		"chart_type": chartType,
+		"columns":    columns,
+		"row_count":  len(rows),
+		"spec":       buildVegaLiteSpec(chartType, x, y, series, title, rows),
+	}
+
+	jsonData, _ := json.MarshalIndent(response, "", "  ")
+
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
+
+// buildVegaLiteSpec assembles a Vega-Lite v5 specification for the given rows.
+func buildVegaLiteSpec(chartType, x, y, series, title string, rows []map[string]interface{}) map[string]interface{} {
+	encoding := map[string]interface{}{}
+
+	if chartType == "pie" {
+		encoding["theta"] = map[string]interface{}{"field": y, "type": "quantitative"}
+		encoding["color"] = map[string]interface{}{"field": x, "type": "nominal"}
+	} else {
+		encoding["x"] = map[string]interface{}{"field": x, "type": inferFieldType(rows, x)}
+		encoding["y"] = map[string]interface{}{"field": y, "type": inferFieldType(rows, y)}
+		if series != "" {
+			encoding["color"] = map[string]interface{}{"field": series, "type": "nominal"}
+		}
+	}
+
+	spec := map[string]interface{}{
+		"$schema":  "https://vega.github.io/schema/vega-lite/v5.json",
+		"mark":     map[string]interface{}{"type": chartMarks[chartType], "tooltip": true},
+		"data":     map[string]interface{}{"values": rows},
+		"encoding": encoding,
+	}
+	if title != "" {
+		spec["title"] = title
+	}
+
+	return spec
+}
+
+// inferFieldType picks a Vega-Lite measurement type from the first non-null value of a column.
+func inferFieldType(rows []map[string]interface{}, field string) string {
+	for _, row := range rows {
+		switch v := row[field].(type) {
+		case nil:
+			continue
+		case int64, float64, int, float32:
+			return "quantitative"
+		case string:
+			if _, err := time.Parse(time.RFC3339, v); err == nil {
+				return "temporal"
+			}
+			if _, err := time.Parse("2006-01-02", v); err == nil {
+				return "temporal"
+			}
+			return "nominal"
+		default:
+			return "nominal"
+		}
+	}
+	return "nominal"
+}
+
+// containsColumn reports whether name is one of the result columns.
+func containsColumn(columns []string, name string) bool {
+	for _, col := range columns {
+		if col == name {
+			return true
+		}
+	}
+	return false
+}
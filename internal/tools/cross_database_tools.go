@@ -0,0 +1,318 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"data-chatter/internal/auth"
+	"data-chatter/internal/catalog"
+	"data-chatter/internal/database"
+	"data-chatter/internal/types"
+)
+
+const (
+	// DefaultStagingRows bounds the rows cross_database_join pulls from each
+	// database when CROSS_DATABASE_MAX_ROWS is unset.
+	DefaultStagingRows = 10000
+
+	// maxJoinSources bounds the result sets one call stages.
+	maxJoinSources = 4
+)
+
+// stagingTable is what a staged result set may be called.
+var stagingTable = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,62}$`)
+
+// CrossDatabaseJoinTool answers questions spanning the named databases,
+// such as the CRM and billing databases: it runs a bounded SELECT on each,
+// loads the results into an in-memory SQLite database as tables, and runs
+// a query joining them there.
+type CrossDatabaseJoinTool struct {
+	conn       *database.Connection
+	query      *DatabaseQueryTool
+	databases  []catalog.Database
+	catalog    *catalog.Catalog
+	maxRows    int
+	authorizer types.Authorizer
+}
+
+// NewCrossDatabaseJoinTool creates a new cross-database join tool instance.
+// Its calls fail until SetCatalog is called.
+func NewCrossDatabaseJoinTool(conn *database.Connection) *CrossDatabaseJoinTool {
+	return &CrossDatabaseJoinTool{
+		conn:    conn,
+		query:   NewDatabaseQueryTool(conn),
+		maxRows: DefaultStagingRows,
+	}
+}
+
+// SetDatabases sets the databases the tool's definition names, the default
+// first, and the rows it pulls from each. It must be called before the tool
+// is registered.
+func (t *CrossDatabaseJoinTool) SetDatabases(databases []catalog.Database, maxRows int) {
+	t.databases = databases
+	t.maxRows = maxRows
+}
+
+// SetCatalog sets the connections to the named databases.
+func (t *CrossDatabaseJoinTool) SetCatalog(c *catalog.Catalog) {
+	t.catalog = c
+}
+
+// SetAuthorizer checks each source's SQL as a database_query call, since
+// the registry only sees the tool's name.
+func (t *CrossDatabaseJoinTool) SetAuthorizer(authorizer types.Authorizer) {
+	t.authorizer = authorizer
+}
+
+// GetDefinition returns the tool definition for LLM integration, naming
+// the databases.
+func (t *CrossDatabaseJoinTool) GetDefinition() types.ToolDefinition {
+	description := fmt.Sprintf("Answer a question spanning databases: run a SELECT on each of 2 to %d databases, load each result as a table of an in-memory SQLite database under the name given in as, and run join_query, a SQLite SELECT over those tables. Each source may return at most %d rows, so filter and aggregate in the source queries and select only the columns the join needs. Use database_query instead for questions about one database",
+		maxJoinSources, t.maxRows)
+	if len(t.databases) > 0 {
+		names := make([]string, len(t.databases))
+		for i, db := range t.databases {
+			names[i] = db.Name
+			if db.Description != "" {
+				names[i] += " (" + db.Description + ")"
+			}
+		}
+		description += ". Databases: " + strings.Join(names, ", ")
+	}
+
+	return types.ToolDefinition{
+		Name:        "cross_database_join",
+		Description: description,
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"sources": map[string]interface{}{
+					"type":        "array",
+					"description": "The result sets to join, one per database",
+					"minItems":    2,
+					"maxItems":    maxJoinSources,
+					"items": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"database": map[string]interface{}{
+								"type":        "string",
+								"description": "The database to query, by name; " + catalog.Default + " for the default database",
+							},
+							"query": map[string]interface{}{
+								"type":        "string",
+								"description": "SQL SELECT query in the database's own dialect",
+							},
+							"as": map[string]interface{}{
+								"type":        "string",
+								"description": "The table name join_query reads the result as, e.g. customers",
+							},
+						},
+						"required": []string{"database", "query", "as"},
+					},
+				},
+				"join_query": map[string]interface{}{
+					"type":        "string",
+					"description": "SQLite SELECT query over the tables named in as (include LIMIT clause if needed)",
+				},
+			},
+			"required": []string{"sources", "join_query"},
+		},
+	}
+}
+
+// joinSource is a result set to stage.
+type joinSource struct {
+	database, query, as string
+}
+
+// joinSources reads the sources of a call's input.
+func joinSources(input map[string]interface{}) ([]joinSource, error) {
+	raw, ok := input["sources"].([]interface{})
+	if !ok || len(raw) < 2 || len(raw) > maxJoinSources {
+		return nil, fmt.Errorf("sources must be an array of 2 to %d sources", maxJoinSources)
+	}
+	sources := make([]joinSource, len(raw))
+	names := make(map[string]bool)
+	for i, item := range raw {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("sources[%d] must be an object", i)
+		}
+		for _, key := range []string{"database", "query", "as"} {
+			if value, ok := fields[key].(string); !ok || strings.TrimSpace(value) == "" {
+				return nil, fmt.Errorf("sources[%d].%s is required and must be a non-empty string", i, key)
+			}
+		}
+		source := joinSource{database: fields["database"].(string), query: fields["query"].(string), as: fields["as"].(string)}
+		if !stagingTable.MatchString(source.as) {
+			return nil, fmt.Errorf("sources[%d].as must be a table name of letters, digits, and underscores", i)
+		}
+		if names[strings.ToLower(source.as)] {
+			return nil, fmt.Errorf("sources[%d].as: %s names two sources", i, source.as)
+		}
+		names[strings.ToLower(source.as)] = true
+		sources[i] = source
+	}
+	return sources, nil
+}
+
+// Validate checks the sources' databases, queries, and table names, and
+// that join_query is a SELECT.
+func (t *CrossDatabaseJoinTool) Validate(input map[string]interface{}) error {
+	sources, err := joinSources(input)
+	if err != nil {
+		return err
+	}
+	for i, source := range sources {
+		if !t.knows(source.database) {
+			return fmt.Errorf("sources[%d].database: unknown database %q", i, source.database)
+		}
+		// Named databases share the default database's type and dialect
+		if err := t.query.Validate(map[string]interface{}{"query": source.query}); err != nil {
+			return fmt.Errorf("sources[%d].query: %w", i, err)
+		}
+	}
+
+	joinQuery, ok := input["join_query"].(string)
+	if !ok || joinQuery == "" {
+		return fmt.Errorf("join_query is required and must be a non-empty string")
+	}
+	if err := NewDatabaseQueryTool(nil).Validate(map[string]interface{}{"query": joinQuery}); err != nil {
+		return fmt.Errorf("join_query: %w", err)
+	}
+	return nil
+}
+
+// knows reports whether name is one of the databases.
+func (t *CrossDatabaseJoinTool) knows(name string) bool {
+	if name == catalog.Default {
+		return true
+	}
+	for _, db := range t.databases {
+		if db.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute runs each source query on its database, stages the results, and
+// returns the rows of join_query in the format of database_query. Source
+// results are masked as database_query's are before they are staged.
+func (t *CrossDatabaseJoinTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	if t.catalog == nil {
+		return nil, errors.New("cross-database joins are unavailable")
+	}
+	if auth.TenantID(ctx) != "" {
+		return validationErrorResult("cross-database joins are not available in multi-tenant mode"), nil
+	}
+	sources, err := joinSources(input)
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+	joinQuery := input["join_query"].(string)
+
+	for _, source := range sources {
+		checked := map[string]interface{}{"query": source.query}
+		if t.authorizer != nil {
+			if err := t.authorizer.Authorize(ctx, "database_query", checked); err != nil {
+				return &types.ToolResult{
+					Content: []types.ToolContent{{Type: "text", Text: source.as + ": " + err.Error()}},
+					IsError: true,
+					Error:   &types.ToolError{Code: types.ErrorPermissionDenied, Message: source.as + ": " + err.Error()},
+				}, nil
+			}
+		}
+	}
+
+	staging, err := database.NewStaging(t.conn.Config)
+	if err != nil {
+		return nil, err
+	}
+	defer staging.Close()
+
+	var warnings, staged []string
+	for _, source := range sources {
+		conn, err := t.catalog.Lookup(source.database)
+		if err != nil {
+			return validationErrorResult(err.Error()), nil
+		}
+		if conn == nil {
+			conn = t.conn
+		}
+		sourceCtx := database.WithConnection(ctx, conn)
+
+		problems, err := t.query.checkCost(sourceCtx, source.query, nil)
+		if err != nil {
+			return queryErrorResult(fmt.Errorf("%s: %w", source.as, err)), nil
+		}
+		for _, problem := range problems {
+			warnings = append(warnings, source.as+": "+problem)
+		}
+
+		var columns []string
+		var rows [][]interface{}
+		err = t.query.scanRows(sourceCtx, source.query, nil, t.maxRows,
+			func(names []string) { columns = uniqueColumns(names) },
+			func(values []interface{}) error {
+				rows = append(rows, append([]interface{}(nil), values...))
+				return nil
+			})
+		if err != nil {
+			slog.WarnContext(ctx, "cross-database source failed", "database", source.database, "query", source.query, "error", err)
+			return queryErrorResult(fmt.Errorf("%s: %w", source.as, err)), nil
+		}
+		if err := staging.Stage(ctx, source.as, columns, rows); err != nil {
+			return queryErrorResult(err), nil
+		}
+		staged = append(staged, fmt.Sprintf("%s from %s (%d rows)", source.as, source.database, len(rows)))
+	}
+
+	// The staged rows are already masked, and the join reads no table of a
+	// real database, so it runs without a cost check or result cache
+	joined := NewDatabaseQueryTool(staging)
+	joinCtx := database.WithConnection(ctx, staging)
+	var buf bytes.Buffer
+	encoder := newResultEncoder(&buf)
+	encoder.begin(joinQuery, "staging: "+strings.Join(staged, ", "))
+	encoder.writeWarnings(warnings)
+	if err := joined.scanRows(joinCtx, joinQuery, nil, t.conn.Config.MaxResultRows, encoder.writeColumns, encoder.writeRow); err != nil {
+		slog.WarnContext(ctx, "cross-database join failed", "query", joinQuery, "error", err)
+		return queryErrorResult(err), nil
+	}
+	encoder.end()
+
+	slog.InfoContext(ctx, "cross-database join executed", "sources", staged, "query", joinQuery, "rows", encoder.rowCount)
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: buf.String(),
+		}},
+		IsError: false,
+	}, nil
+}
+
+// uniqueColumns renames result columns whose names repeat, ignoring case
+// as SQLite does, by numbering the later ones: id, id_2.
+func uniqueColumns(names []string) []string {
+	unique := make([]string, len(names))
+	seen := make(map[string]bool)
+	for i, name := range names {
+		if name == "" {
+			name = "column_" + strconv.Itoa(i+1)
+		}
+		candidate := name
+		for n := 2; seen[strings.ToLower(candidate)]; n++ {
+			candidate = name + "_" + strconv.Itoa(n)
+		}
+		seen[strings.ToLower(candidate)] = true
+		unique[i] = candidate
+	}
+	return unique
+}
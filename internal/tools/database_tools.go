@@ -2,15 +2,52 @@
 package tools
 
 import (
-	"encoding/json"
+	"bytes"
+	"context"
 	"fmt"
+	"log/slog"
+	"regexp"
 	"strings"
 	"time"
 
 	"data-chatter/internal/database"
+	"data-chatter/internal/events"
+	"data-chatter/internal/logging"
+	"data-chatter/internal/querycache"
+	"data-chatter/internal/sqlparse"
+	"data-chatter/internal/sqlrewrite"
+	"data-chatter/internal/telemetry"
 	"data-chatter/internal/types"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = telemetry.Tracer("data-chatter/internal/tools")
+
+// progressInterval is how many scanned rows pass between progress reports.
+const progressInterval = 500
+
+// clickHouseForbidden matches what a ClickHouse SELECT may contain but an
+// analytics query never needs: table functions that read files, URLs, or
+// other servers, the system database with its query logs and users, a
+// SETTINGS clause that could lift the server's limits, and INTO OUTFILE.
+var clickHouseForbidden = regexp.MustCompile(`(?i)\b(?:url|file|s3|s3Cluster|gcs|azureBlobStorage|hdfs|remote|remoteSecure|` +
+	`cluster|clusterAllReplicas|mysql|postgresql|mongodb|redis|sqlite|jdbc|odbc|executable|input|iceberg|deltaLake|hudi)\s*\(|` +
+	`\bsystem\s*\.|\bSETTINGS\b|\bINTO\s+OUTFILE\b`)
+
+// sqlServerForbidden matches what a SQL Server SELECT may contain but an
+// analytics query never needs: rowset functions that read files or other
+// servers, stored procedures and the statements that run them, WAITFOR,
+// and SELECT ... INTO, which creates a table.
+var sqlServerForbidden = regexp.MustCompile(`(?i)\b(?:OPENROWSET|OPENQUERY|OPENDATASOURCE|OPENXML)\s*\(|` +
+	`\bEXEC(?:UTE)?\b|\b(?:xp|sp)_\w+|\bWAITFOR\b|\bINTO\b|\bBULK\b`)
+
+// statementForbidden matches statements that change the connection rather
+// than the data, such as SQLite's PRAGMA query_only and ATTACH, and REPLACE,
+// which writes on SQLite and MySQL. The replace() function is still allowed.
+var statementForbidden = regexp.MustCompile(`(?i)\b(?:PRAGMA|ATTACH|DETACH)\b|\bREPLACE\b\s*(?:INTO\b|\w)`)
+
 // DatabaseQueryTool executes read-only SQL SELECT queries with security validation.
 type DatabaseQueryTool struct {
 	conn *database.Connection
@@ -27,13 +64,13 @@ func NewDatabaseQueryTool(conn *database.Connection) *DatabaseQueryTool {
 func (d *DatabaseQueryTool) GetDefinition() types.ToolDefinition {
 	return types.ToolDefinition{
 		Name:        "database_query",
-		Description: "Execute a read-only SQL SELECT query on the database",
+		Description: "Execute a read-only SQL SELECT query on the database (include LIMIT clause if needed). Values in columns holding personal data may come back masked to their shape, e.g. \"999-9999\". Slow queries come back with \"advice\" naming indexes that might speed them up",
 		InputSchema: map[string]interface{}{
 			"type": "object",
 			"properties": map[string]interface{}{
 				"query": map[string]interface{}{
 					"type":        "string",
-					"description": "SQL SELECT query to execute (include LIMIT clause if needed)",
+					"description": "SQL SELECT query to execute (include LIMIT clause if needed, or TOP on SQL Server)",
 				},
 			},
 			"required": []string{"query"},
@@ -41,7 +78,9 @@ func (d *DatabaseQueryTool) GetDefinition() types.ToolDefinition {
 	}
 }
 
-// Validate performs security checks on the SQL query to ensure only SELECT statements are allowed.
+// Validate performs security checks on the SQL query to ensure only a single SELECT statement is allowed.
+// On ClickHouse it also refuses table functions and clauses that reach beyond the database,
+// and on SQL Server rowset functions, procedures, and SELECT ... INTO.
 func (d *DatabaseQueryTool) Validate(input map[string]interface{}) error {
 	query, ok := input["query"].(string)
 	if !ok {
@@ -55,6 +94,9 @@ func (d *DatabaseQueryTool) Validate(input map[string]interface{}) error {
 	if !strings.HasPrefix(queryUpper, "SELECT") {
 		return fmt.Errorf("only SELECT queries are allowed")
 	}
+	if sqlparse.MultipleStatements(query) {
+		return fmt.Errorf("only one statement is allowed")
+	}
 
 	dangerousKeywords := []string{"DROP", "DELETE", "UPDATE", "INSERT", "ALTER", "CREATE", "TRUNCATE"}
 	for _, keyword := range dangerousKeywords {
@@ -62,108 +104,409 @@ func (d *DatabaseQueryTool) Validate(input map[string]interface{}) error {
 			return fmt.Errorf("query contains forbidden keyword: %s", keyword)
 		}
 	}
+	if match := statementForbidden.FindString(query); match != "" {
+		return fmt.Errorf("query contains forbidden keyword: %s", strings.ToUpper(strings.Fields(match)[0]))
+	}
+
+	if d.conn != nil && d.conn.Config.Type == "clickhouse" {
+		if match := clickHouseForbidden.FindString(query); match != "" {
+			return fmt.Errorf("query uses %s, which is not allowed on ClickHouse", strings.TrimRight(match, " \t\n(."))
+		}
+	}
+	if d.conn != nil && d.conn.Config.Type == "sqlserver" {
+		if match := sqlServerForbidden.FindString(query); match != "" {
+			return fmt.Errorf("query uses %s, which is not allowed on SQL Server", strings.TrimRight(match, " \t\n("))
+		}
+	}
 
 	return nil
 }
 
 // Execute runs the SQL query and returns formatted results as JSON.
-// Handles type conversion for different database column types.
-func (d *DatabaseQueryTool) Execute(input map[string]interface{}) (*types.ToolResult, error) {
-	query := input["query"].(string)
+// Rows are encoded as they are scanned, without building a map per row,
+// since large result sets are dominated by that allocation.
+// The query is cancelled if ctx expires before it completes.
+func (d *DatabaseQueryTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	return d.execute(ctx, input["query"].(string), nil), nil
+}
 
-	fmt.Printf("DEBUG: Executing query: %s\n", query)
+// execute runs query with its bind arguments and encodes the rows as JSON.
+// With QUERY_STABLE_ORDER set, query is first given a deterministic ORDER BY;
+// it is then linted, and any LIMIT added and the lint's warnings are
+// reported in the result.
+func (d *DatabaseQueryTool) execute(ctx context.Context, query string, args []interface{}) *types.ToolResult {
+	conn := d.conn.For(ctx)
+	query = conn.StableOrder(ctx, query)
+	lint := conn.Lint(ctx, query)
+	query = lint.Query
+	slog.DebugContext(ctx, "executing query", "query", query)
 
-	rows, err := d.conn.DB.Query(query)
+	cache := conn.ResultCache
+	key, directive := d.cacheKey(ctx, query, args)
+	if text, ok := cache.Get(ctx, key, directive); ok {
+		slog.DebugContext(ctx, "query result served from cache", "query", query)
+		return &types.ToolResult{Content: []types.ToolContent{{Type: "text", Text: string(text)}}}
+	}
+
+	warnings, err := d.checkCost(ctx, query, args)
 	if err != nil {
-		return &types.ToolResult{
-			Content: []types.ToolContent{{
-				Type: "text",
-				Text: fmt.Sprintf("Query execution failed: %v", err),
-			}},
-			IsError: true,
-			Error:   &types.ToolError{Type: "query_error", Message: err.Error()},
-		}, nil
+		slog.WarnContext(ctx, "query rejected", "query", query, "error", err)
+		return queryErrorResult(err)
+	}
+
+	start := time.Now()
+	var buf bytes.Buffer
+	encoder := newResultEncoder(&buf)
+	encoder.begin(query, conn.Config.SourceName())
+	encoder.writeWarnings(append(lint.Warnings, warnings...))
+	encoder.writeRewrites(lint.Rewrites)
+	encoder.limit = lint.Limit
+
+	err = d.scanRows(ctx, query, args, conn.Config.MaxResultRows, encoder.writeColumns, encoder.writeRow)
+	if err != nil {
+		slog.WarnContext(ctx, "query failed", "query", query, "error", err)
+		return withDialectHints(queryErrorResult(err), conn.Config.Type, query)
+	}
+	duration := time.Since(start)
+	if threshold := conn.Config.SlowQueryThreshold; threshold > 0 && duration >= threshold {
+		encoder.advice = d.slowQuery(ctx, query, args, duration, encoder.rowCount)
+	}
+	encoder.end()
+	cache.Set(ctx, key, buf.Bytes(), directive)
+
+	cc := types.CallContextFrom(ctx)
+	slog.InfoContext(ctx, "query executed",
+		"query", query,
+		"user_id", cc.UserID,
+		"conversation_id", cc.ConversationID,
+		"duration", duration,
+		logging.Rows(ctx, "rows", encoder.rowCount, encoder.data()))
+
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: buf.String(),
+		}},
+		IsError: false,
+	}
+}
+
+// cacheKey returns the result cache key for query and the caller's
+// Cache-Control directive. Masked and unmasked results are cached apart, as
+// are the results of each tenant's database and each named database.
+func (d *DatabaseQueryTool) cacheKey(ctx context.Context, query string, args []interface{}) (string, querycache.Directive) {
+	conn := d.conn.For(ctx)
+	variant := "unmasked"
+	if conn.Masker.Applies(ctx) {
+		variant = "masked"
+	}
+	if conn.Tenant != "" {
+		variant = "tenant:" + conn.Tenant + ":" + variant
+	}
+	if conn.Name != "" {
+		variant = "database:" + conn.Name + ":" + variant
+	}
+	if conn.Generation > 0 {
+		variant = fmt.Sprintf("generation:%d:%s", conn.Generation, variant)
+	}
+	return querycache.Key(query, args, variant), querycache.ParseDirective(types.CallContextFrom(ctx).CacheControl)
+}
+
+// runQuery executes query and scans every row into a column-keyed map,
+// converting driver-specific types into JSON-friendly values.
+func (d *DatabaseQueryTool) runQuery(ctx context.Context, query string) (columns []string, results []map[string]interface{}, err error) {
+	setColumns := func(cols []string) {
+		columns = cols
+	}
+	addRow := func(values []interface{}) error {
+		row := make(map[string]interface{}, len(columns))
+		for i, col := range columns {
+			row[col] = normalizeValue(values[i])
+		}
+		results = append(results, row)
+		return nil
+	}
+	query = d.conn.For(ctx).StableOrder(ctx, query)
+	if _, err := d.checkCost(ctx, query, nil); err != nil {
+		return nil, nil, err
+	}
+	if err := d.scanRows(ctx, query, nil, d.conn.For(ctx).Config.MaxResultRows, setColumns, addRow); err != nil {
+		return nil, nil, err
+	}
+	return columns, results, nil
+}
+
+// QueryRows runs a validated SELECT and returns its columns and rows, masked
+// and capped at MaxResultRows as database_query's are, for callers that keep
+// the result, such as snapshots. Values keep their types, except that bytes
+// become strings.
+func (d *DatabaseQueryTool) QueryRows(ctx context.Context, query string) (columns []string, rows [][]interface{}, err error) {
+	setColumns := func(cols []string) {
+		columns = cols
+	}
+	addRow := func(values []interface{}) error {
+		row := make([]interface{}, len(values))
+		for i, value := range values {
+			if b, ok := value.([]byte); ok {
+				value = string(b)
+			}
+			row[i] = value
+		}
+		rows = append(rows, row)
+		return nil
+	}
+	if _, err := d.checkCost(ctx, query, nil); err != nil {
+		return nil, nil, err
+	}
+	if err := d.scanRows(ctx, query, nil, d.conn.For(ctx).Config.MaxResultRows, setColumns, addRow); err != nil {
+		return nil, nil, err
+	}
+	return columns, rows, nil
+}
+
+// checkCost applies the cost guard to query's plan. In warn mode the plan's
+// problems, such as full scans of large tables, come back as warnings; in
+// reject mode the query fails with database.ErrTooExpensive and the plan, so
+// the model can rewrite it. A plan that cannot be read does not stop the
+// query, which will report its own error if it is broken.
+func (d *DatabaseQueryTool) checkCost(ctx context.Context, query string, args []interface{}) ([]string, error) {
+	conn := d.conn.For(ctx)
+	config := conn.Config
+	if config.CostGuard != database.CostGuardWarn && config.CostGuard != database.CostGuardReject {
+		return nil, nil
+	}
+
+	plan, err := conn.Explain(ctx, query, args...)
+	if err != nil {
+		slog.DebugContext(ctx, "could not explain query", "query", query, "error", err)
+		return nil, nil
+	}
+	problems := plan.Problems(config.MaxScanRows, config.MaxPlanCost)
+	if len(problems) == 0 {
+		return nil, nil
+	}
+
+	if config.CostGuard == database.CostGuardReject {
+		return nil, fmt.Errorf("%w: %s; filter on indexed columns or aggregate and try again\nQuery plan:\n%s",
+			database.ErrTooExpensive, strings.Join(problems, "; "), plan.Text)
+	}
+	slog.WarnContext(ctx, "expensive query plan", "query", query, "problems", problems)
+	return problems, nil
+}
+
+// slowQuery reads the plan of a query that ran for duration, at least the
+// slow query threshold, records it in the slow query log, and returns the
+// indexes that might speed it up. A plan that cannot be read yields no
+// advice.
+func (d *DatabaseQueryTool) slowQuery(ctx context.Context, query string, args []interface{}, duration time.Duration, rows int) []string {
+	conn := d.conn.For(ctx)
+	cc := types.CallContextFrom(ctx)
+	entry := database.SlowQuery{
+		Time:           time.Now(),
+		Query:          query,
+		DurationMS:     duration.Milliseconds(),
+		Rows:           rows,
+		UserID:         cc.UserID,
+		ConversationID: cc.ConversationID,
+	}
+	plan, err := conn.Explain(ctx, query, args...)
+	if err != nil {
+		slog.DebugContext(ctx, "could not explain slow query", "query", query, "error", err)
+	} else {
+		entry.Plan = plan.Text
+		entry.FullScans = plan.Scans
+		entry.Advice = conn.IndexAdvice(ctx, query, plan)
+	}
+	slog.WarnContext(ctx, "slow query", "query", query, "duration", duration, "advice", entry.Advice)
+	conn.SlowQueries.Record(entry)
+	return entry.Advice
+}
+
+// scanRows executes query with its bind arguments, passes the result columns
+// to onColumns, and then calls onRow with each row's raw values. The values
+// slice is reused between rows, so onRow must copy anything it keeps. A result with more than maxRows
+// rows fails with database.ErrTooManyRows; 0 means no cap.
+// The query and the row scan are traced as a "db.query" span carrying the SQL.
+func (d *DatabaseQueryTool) scanRows(ctx context.Context, query string, args []interface{}, maxRows int, onColumns func([]string), onRow func([]interface{}) error) (err error) {
+	ctx, span := tracer.Start(ctx, "db.query", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("db.system", d.conn.For(ctx).Config.Type),
+		attribute.String("db.statement", query),
+	))
+	rowCount := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("db.rows_returned", rowCount))
+		telemetry.EndSpan(span, err)
+	}()
+
+	mask := d.columnMask(ctx, query)
+	rows, err := d.conn.For(ctx).Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("query execution failed: %w", err)
 	}
 	defer rows.Close()
 
 	columns, err := rows.Columns()
 	if err != nil {
-		return &types.ToolResult{
-			Content: []types.ToolContent{{
-				Type: "text",
-				Text: fmt.Sprintf("Failed to get column names: %v", err),
-			}},
-			IsError: true,
-			Error:   &types.ToolError{Type: "query_error", Message: err.Error()},
-		}, nil
+		return fmt.Errorf("failed to get column names: %w", err)
 	}
+	onColumns(columns)
+	masked := mask.masked(columns)
 
-	var results []map[string]interface{}
-	rowCount := 0
+	values := make([]interface{}, len(columns))
+	valuePtrs := make([]interface{}, len(columns))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
 
 	for rows.Next() {
-		values := make([]interface{}, len(columns))
-		valuePtrs := make([]interface{}, len(columns))
-		for i := range values {
-			valuePtrs[i] = &values[i]
+		if maxRows > 0 && rowCount >= maxRows {
+			return fmt.Errorf("%w (limit %d); add a LIMIT clause or aggregate the results", database.ErrTooManyRows, maxRows)
 		}
-
 		if err := rows.Scan(valuePtrs...); err != nil {
-			return &types.ToolResult{
-				Content: []types.ToolContent{{
-					Type: "text",
-					Text: fmt.Sprintf("Failed to scan row: %v", err),
-				}},
-				IsError: true,
-				Error:   &types.ToolError{Type: "query_error", Message: err.Error()},
-			}, nil
+			return fmt.Errorf("failed to scan row: %w", err)
 		}
-
-		row := make(map[string]interface{})
-		for i, col := range columns {
-			val := values[i]
-			if val != nil {
-				switch v := val.(type) {
-				case []byte:
-					row[col] = string(v)
-				case time.Time:
-					row[col] = v.Format(time.RFC3339)
-				default:
-					row[col] = v
-				}
-			} else {
-				row[col] = nil
+		for i := range masked {
+			if masked[i] {
+				values[i] = database.MaskValue(values[i])
 			}
 		}
-		results = append(results, row)
+		if err := onRow(values); err != nil {
+			return err
+		}
 		rowCount++
+		if rowCount%progressInterval == 0 {
+			events.ReportRows(ctx, rowCount)
+		}
 	}
 
 	if err := rows.Err(); err != nil {
-		return &types.ToolResult{
-			Content: []types.ToolContent{{
-				Type: "text",
-				Text: fmt.Sprintf("Error iterating rows: %v", err),
-			}},
-			IsError: true,
-			Error:   &types.ToolError{Type: "query_error", Message: err.Error()},
-		}, nil
+		return fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return nil
+}
+
+// columnMask decides which result columns of a query are masked.
+type columnMask struct {
+	masker      *database.Masker
+	readsMasked bool            // The query mentions a masked column
+	plain       map[string]bool // Lower-case columns of the queried tables, less aliases
+}
+
+// columnMask prepares masking for query's results, or returns nil when the
+// caller in ctx sees values as they are. It reads the queried tables'
+// columns, so it runs before the query holds a connection.
+func (d *DatabaseQueryTool) columnMask(ctx context.Context, query string) *columnMask {
+	masker := d.conn.For(ctx).Masker
+	if !masker.Applies(ctx) {
+		return nil
+	}
+
+	mask := &columnMask{masker: masker, plain: make(map[string]bool)}
+	for _, ident := range sqlparse.Identifiers(query) {
+		if masker.Masks(ident) {
+			mask.readsMasked = true
+			break
+		}
+	}
+	if !mask.readsMasked {
+		return mask
+	}
+	for _, table := range sqlparse.ReferencedTables(query) {
+		if i := strings.LastIndex(table, "."); i >= 0 {
+			table = table[i+1:]
+		}
+		// A table that cannot be read leaves its columns masked
+		columns, _ := d.conn.For(ctx).TableColumns(ctx, table)
+		for _, col := range columns {
+			mask.plain[strings.ToLower(col.Name)] = true
+		}
 	}
+	for _, alias := range sqlparse.Aliases(query) {
+		delete(mask.plain, alias)
+	}
+	return mask
+}
 
-	response := map[string]interface{}{
-		"query":     query,
-		"columns":   columns,
-		"row_count": rowCount,
-		"data":      results,
+// masked reports which result columns are masked, or nil when none are.
+// Columns named like personal data are masked, and when the query reads
+// such a column so is every result column that is not a plain column of
+// the tables it reads, since an alias or expression such as lower(email)
+// could carry the column's values.
+func (m *columnMask) masked(columns []string) []bool {
+	if m == nil {
+		return nil
 	}
+	masked := make([]bool, len(columns))
+	maskAny := false
+	for i, col := range columns {
+		masked[i] = m.masker.Masks(col) || (m.readsMasked && !m.plain[strings.ToLower(col)])
+		maskAny = maskAny || masked[i]
+	}
+	if !maskAny {
+		return nil
+	}
+	return masked
+}
 
-	jsonData, _ := json.MarshalIndent(response, "", "  ")
+// normalizeValue converts driver-specific scan values into JSON-friendly values.
+func normalizeValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339)
+	default:
+		return v
+	}
+}
 
+// queryErrorResult wraps a query failure as an error tool result, classified
+// into a stable error code by database.ClassifyError.
+func queryErrorResult(err error) *types.ToolResult {
+	code, driverCode := database.ClassifyError(err)
 	return &types.ToolResult{
 		Content: []types.ToolContent{{
 			Type: "text",
-			Text: string(jsonData),
+			Text: err.Error(),
 		}},
-		IsError: false,
-	}, nil
+		IsError: true,
+		Error: &types.ToolError{
+			Code:       code,
+			Message:    err.Error(),
+			DriverCode: driverCode,
+			Retryable:  types.IsRetryable(code),
+		},
+	}
+}
+
+// withDialectHints adds guidance to a failed query's result when the failure
+// may come from SQL written for another dialect, such as strftime run
+// against PostgreSQL, so the model can rewrite the query for this one. The
+// hints are appended to the text and kept in the error's details.
+func withDialectHints(result *types.ToolResult, dialect, query string) *types.ToolResult {
+	if !sqlrewrite.Applies(result.Error.Code) {
+		return result
+	}
+	hints := sqlrewrite.Hints(dialect, query)
+	if len(hints) == 0 {
+		return result
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\nThe database is %s; the query uses syntax it does not support:", result.Content[0].Text, sqlrewrite.DialectName(dialect))
+	for _, hint := range hints {
+		fmt.Fprintf(&b, "\n- %s", hint.Advice)
+	}
+	result.Content[0].Text = b.String()
+	result.Error.Details = map[string]interface{}{"dialect": dialect, "hints": hints}
+	return result
+}
+
+// validationErrorResult wraps a problem with the tool input as an error tool result.
+func validationErrorResult(msg string) *types.ToolResult {
+	return &types.ToolResult{
+		Content: []types.ToolContent{{Type: "text", Text: msg}},
+		IsError: true,
+		Error:   &types.ToolError{Code: types.ErrorValidation, Message: msg},
+	}
 }
@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"data-chatter/internal/database"
+)
+
+// benchmarkSizes are the result set sizes exercised by each benchmark.
+var benchmarkSizes = []int{100, 1_000, 10_000}
+
+// newBenchmarkTool creates a SQLite database with rows rows of mixed column
+// types and returns a query tool over it.
+func newBenchmarkTool(b *testing.B, rows int) *DatabaseQueryTool {
+	b.Helper()
+	slog.SetDefault(slog.New(slog.DiscardHandler))
+
+	conn, err := database.NewConnection(&database.Config{
+		Type:     "sqlite",
+		FilePath: filepath.Join(b.TempDir(), "bench.db"),
+		MaxConns: 1,
+		MaxIdle:  1,
+	})
+	if err != nil {
+		b.Fatalf("failed to open database: %v", err)
+	}
+	b.Cleanup(func() { conn.Close() })
+
+	statements := []string{
+		`CREATE TABLE contacts (
+			id INTEGER PRIMARY KEY,
+			name TEXT,
+			email TEXT,
+			score REAL,
+			notes TEXT,
+			created_at TIMESTAMP
+		)`,
+		fmt.Sprintf(`WITH RECURSIVE seq(n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM seq WHERE n < %d)
+			INSERT INTO contacts (id, name, email, score, notes, created_at)
+			SELECT n, 'Contact ' || n, 'contact' || n || '@example.com', n * 1.5,
+			       CASE WHEN n %% 3 = 0 THEN NULL ELSE 'Prefers "email" <after 5pm>' END,
+			       '2025-09-30 17:49:32'
+			FROM seq`, rows),
+	}
+	for _, statement := range statements {
+		if _, err := conn.DB.Exec(statement); err != nil {
+			b.Fatalf("failed to seed database: %v", err)
+		}
+	}
+
+	return NewDatabaseQueryTool(conn)
+}
+
+// BenchmarkExecute measures the streaming scan and encode path used by database_query.
+func BenchmarkExecute(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("rows=%d", size), func(b *testing.B) {
+			tool := newBenchmarkTool(b, size)
+			input := map[string]interface{}{"query": "SELECT * FROM contacts"}
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				result, err := tool.Execute(ctx, input)
+				if err != nil || result.IsError {
+					b.Fatalf("query failed: %v %+v", err, result)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkRunQueryMarshal measures scanning rows into maps and marshalling
+// them, the path database_query used before streaming and chart_render still uses.
+func BenchmarkRunQueryMarshal(b *testing.B) {
+	for _, size := range benchmarkSizes {
+		b.Run(fmt.Sprintf("rows=%d", size), func(b *testing.B) {
+			tool := newBenchmarkTool(b, size)
+			ctx := context.Background()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				columns, results, err := tool.runQuery(ctx, "SELECT * FROM contacts")
+				if err != nil {
+					b.Fatalf("query failed: %v", err)
+				}
+				if _, err := json.Marshal(map[string]interface{}{
+					"columns":   columns,
+					"row_count": len(results),
+					"data":      results,
+				}); err != nil {
+					b.Fatalf("marshal failed: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkEncodeRow isolates per-row encoding from database access.
+func BenchmarkEncodeRow(b *testing.B) {
+	columns := []string{"id", "name", "email", "score", "notes", "created_at"}
+	values := []interface{}{int64(42), "Contact 42", []byte("contact42@example.com"), 63.0, nil, "2025-09-30T17:49:32Z"}
+
+	b.Run("encoder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var buf bytes.Buffer
+			encoder := newResultEncoder(&buf)
+			encoder.begin("SELECT * FROM contacts", "sqlite:bench.db")
+			encoder.writeColumns(columns)
+			encoder.writeRow(values)
+			encoder.end()
+		}
+	})
+
+	b.Run("map+marshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			row := make(map[string]interface{}, len(columns))
+			for j, column := range columns {
+				row[column] = normalizeValue(values[j])
+			}
+			if _, err := json.Marshal(row); err != nil {
+				b.Fatalf("marshal failed: %v", err)
+			}
+		}
+	})
+}
@@ -0,0 +1,385 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"data-chatter/internal/artifacts"
+	"data-chatter/internal/database"
+	"data-chatter/internal/render"
+	"data-chatter/internal/snapshots"
+	"data-chatter/internal/types"
+)
+
+// maxDiffRows bounds the added, removed, and changed rows a query_diff
+// result lists; the counts cover them all.
+const maxDiffRows = 50
+
+// QueryDiffTool compares two results row by row, matching rows on key
+// columns: those of two queries, such as the same query over two time
+// points, or of a query and a snapshot, either a named snapshot table taken
+// with POST /db/query/snapshot or a CSV saved earlier with artifact_create.
+type QueryDiffTool struct {
+	queryTool  *DatabaseQueryTool
+	store      *artifacts.Store
+	snapshots  *snapshots.Store
+	authorizer types.Authorizer
+}
+
+// NewQueryDiffTool creates a new query diff tool instance. Comparisons with
+// snapshots fail until SetStore is called.
+func NewQueryDiffTool(conn *database.Connection) *QueryDiffTool {
+	return &QueryDiffTool{queryTool: NewDatabaseQueryTool(conn)}
+}
+
+// SetStore sets the store CSV snapshots are read from.
+func (t *QueryDiffTool) SetStore(store *artifacts.Store) {
+	t.store = store
+}
+
+// SetSnapshots sets the store named snapshots are looked up in.
+func (t *QueryDiffTool) SetSnapshots(store *snapshots.Store) {
+	t.snapshots = store
+}
+
+// SetAuthorizer checks before_query as the registry checks query, since
+// the registry only sees the input's query.
+func (t *QueryDiffTool) SetAuthorizer(authorizer types.Authorizer) {
+	t.authorizer = authorizer
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *QueryDiffTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "query_diff",
+		Description: "Compare two results row by row and return the rows added, removed, and changed, matching rows on key columns. Compare query with before_query, such as the same SELECT filtered to two dates, or with snapshot, the name of a snapshot table or the ID of a CSV artifact saved earlier with artifact_create. Use it for questions like what changed since last week",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "SQL SELECT query giving the current, or later, result",
+				},
+				"before_query": map[string]interface{}{
+					"type":        "string",
+					"description": "SQL SELECT query giving the earlier result, with the same key columns; omit when comparing with snapshot",
+				},
+				"snapshot": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of a snapshot table, or ID of a CSV artifact, holding the earlier result; omit when comparing with before_query",
+				},
+				"key": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Result columns identifying a row in both results, e.g. [\"customer_id\"]; together they must be unique",
+				},
+			},
+			"required": []string{"query", "key"},
+		},
+	}
+}
+
+// Validate checks the queries, that exactly one of before_query and
+// snapshot is given, and the key columns.
+func (t *QueryDiffTool) Validate(input map[string]interface{}) error {
+	if err := t.queryTool.Validate(map[string]interface{}{"query": input["query"]}); err != nil {
+		return err
+	}
+	_, hasQuery := input["before_query"]
+	_, hasSnapshot := input["snapshot"]
+	switch {
+	case hasQuery && hasSnapshot:
+		return fmt.Errorf("pass either before_query or snapshot, not both")
+	case hasQuery:
+		if err := t.queryTool.Validate(map[string]interface{}{"query": input["before_query"]}); err != nil {
+			return fmt.Errorf("before_query: %w", err)
+		}
+	case hasSnapshot:
+		if snapshot, ok := input["snapshot"].(string); !ok || snapshot == "" {
+			return fmt.Errorf("snapshot must be a non-empty string")
+		}
+	default:
+		return fmt.Errorf("before_query or snapshot is required")
+	}
+
+	if _, err := diffKey(input); err != nil {
+		return err
+	}
+	return nil
+}
+
+// diffKey reads the key columns of a call's input.
+func diffKey(input map[string]interface{}) ([]string, error) {
+	raw, ok := input["key"].([]interface{})
+	if !ok || len(raw) == 0 {
+		return nil, fmt.Errorf("key must be a non-empty array of column names")
+	}
+	key := make([]string, len(raw))
+	for i, item := range raw {
+		column, ok := item.(string)
+		if !ok || column == "" {
+			return nil, fmt.Errorf("key[%d] must be a non-empty string", i)
+		}
+		key[i] = column
+	}
+	return key, nil
+}
+
+// diffSide is one of the results compared.
+type diffSide struct {
+	Source   string `json:"source"`
+	RowCount int    `json:"row_count"`
+
+	columns []string
+	rows    []map[string]interface{}
+}
+
+// rowChange is a row whose key is in both results but whose other values
+// differ.
+type rowChange struct {
+	Key     map[string]interface{}       `json:"key"`
+	Changes map[string]map[string]string `json:"changes"`
+}
+
+// queryDiff is the query_diff tool's result.
+type queryDiff struct {
+	Key            []string                 `json:"key"`
+	Before         diffSide                 `json:"before"`
+	After          diffSide                 `json:"after"`
+	ColumnsAdded   []string                 `json:"columns_added,omitempty"`
+	ColumnsRemoved []string                 `json:"columns_removed,omitempty"`
+	AddedCount     int                      `json:"added_count"`
+	RemovedCount   int                      `json:"removed_count"`
+	ChangedCount   int                      `json:"changed_count"`
+	Unchanged      int                      `json:"unchanged_count"`
+	Added          []map[string]interface{} `json:"added"`
+	Removed        []map[string]interface{} `json:"removed"`
+	Changed        []rowChange              `json:"changed"`
+	Truncated      bool                     `json:"truncated,omitempty"`
+}
+
+// Execute runs the queries, or reads the snapshot, and diffs the results.
+// Values are compared as text, as they are written to CSV, so a result
+// compared with a snapshot does not differ by type alone; with a CSV
+// snapshot, NULL and the empty string compare equal.
+func (t *QueryDiffTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	key, err := diffKey(input)
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+
+	after := diffSide{Source: "query"}
+	after.columns, after.rows, err = t.queryTool.runQuery(ctx, input["query"].(string))
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+
+	nulls := render.NullsNull
+	var before diffSide
+	if snapshot, ok := input["snapshot"].(string); ok && t.isSnapshotTable(ctx, snapshot) {
+		query := "SELECT * FROM " + t.queryTool.conn.Config.QuoteIdentifier(snapshot)
+		if result := t.authorize(ctx, "snapshot", query); result != nil {
+			return result, nil
+		}
+		before = diffSide{Source: "snapshot " + snapshot}
+		if before.columns, before.rows, err = t.queryTool.runQuery(ctx, query); err != nil {
+			return queryErrorResult(fmt.Errorf("snapshot: %w", err)), nil
+		}
+	} else if ok {
+		nulls = render.NullsEmpty
+		before = diffSide{Source: "snapshot " + snapshot}
+		if before.columns, before.rows, err = t.readSnapshot(ctx, snapshot); err != nil {
+			if errors.Is(err, artifacts.ErrNotFound) || errors.Is(err, artifacts.ErrInvalid) {
+				return validationErrorResult(err.Error()), nil
+			}
+			return nil, err
+		}
+	} else {
+		beforeQuery := input["before_query"].(string)
+		if result := t.authorize(ctx, "before_query", beforeQuery); result != nil {
+			return result, nil
+		}
+		before = diffSide{Source: "before_query"}
+		if before.columns, before.rows, err = t.queryTool.runQuery(ctx, beforeQuery); err != nil {
+			return queryErrorResult(fmt.Errorf("before_query: %w", err)), nil
+		}
+	}
+
+	for _, side := range []diffSide{before, after} {
+		for _, column := range key {
+			if !slices.Contains(side.columns, column) {
+				return validationErrorResult(fmt.Sprintf("key column %q is not in the %s result (columns: %s)", column, side.Source, strings.Join(side.columns, ", "))), nil
+			}
+		}
+	}
+
+	diff, err := diffRows(key, before, after, nulls)
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+	jsonData, _ := json.MarshalIndent(diff, "", "  ")
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
+
+// authorize checks a query the registry did not see, returning the error
+// result to report when it is not permitted.
+func (t *QueryDiffTool) authorize(ctx context.Context, field, query string) *types.ToolResult {
+	if t.authorizer == nil {
+		return nil
+	}
+	if err := t.authorizer.Authorize(ctx, "query_diff", map[string]interface{}{"query": query}); err != nil {
+		return &types.ToolResult{
+			Content: []types.ToolContent{{Type: "text", Text: field + ": " + err.Error()}},
+			IsError: true,
+			Error:   &types.ToolError{Code: types.ErrorPermissionDenied, Message: field + ": " + err.Error()},
+		}
+	}
+	return nil
+}
+
+// isSnapshotTable reports whether name is a snapshot table rather than a
+// CSV artifact's ID. Snapshots are kept in the default database, so queries
+// routed to a tenant's have none.
+func (t *QueryDiffTool) isSnapshotTable(ctx context.Context, name string) bool {
+	if t.snapshots == nil || database.ConnectionFromContext(ctx) != nil {
+		return false
+	}
+	_, err := t.snapshots.Get(ctx, name)
+	return err == nil
+}
+
+// readSnapshot reads the header and rows of the CSV artifact with the given
+// ID.
+func (t *QueryDiffTool) readSnapshot(ctx context.Context, id string) ([]string, []map[string]interface{}, error) {
+	if t.store == nil {
+		return nil, nil, errors.New("snapshots are unavailable")
+	}
+	data, err := t.store.Open(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+	if err != nil || len(records) == 0 {
+		return nil, nil, fmt.Errorf("%w: snapshot %s is not a CSV artifact", artifacts.ErrInvalid, id)
+	}
+	columns := records[0]
+	rows := make([]map[string]interface{}, 0, len(records)-1)
+	for _, record := range records[1:] {
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows, nil
+}
+
+// diffRows matches the rows of before and after on key and sorts them into
+// added, removed, changed, and unchanged rows, comparing the columns the
+// results share. It fails when a key repeats within either result.
+func diffRows(key []string, before, after diffSide, nulls render.NullStyle) (*queryDiff, error) {
+	diff := &queryDiff{
+		Key:     key,
+		Before:  diffSide{Source: before.Source, RowCount: len(before.rows)},
+		After:   diffSide{Source: after.Source, RowCount: len(after.rows)},
+		Added:   []map[string]interface{}{},
+		Removed: []map[string]interface{}{},
+		Changed: []rowChange{},
+	}
+	var shared []string
+	for _, column := range after.columns {
+		if slices.Contains(before.columns, column) {
+			shared = append(shared, column)
+		} else {
+			diff.ColumnsAdded = append(diff.ColumnsAdded, column)
+		}
+	}
+	for _, column := range before.columns {
+		if !slices.Contains(after.columns, column) {
+			diff.ColumnsRemoved = append(diff.ColumnsRemoved, column)
+		}
+	}
+
+	rowKey := func(row map[string]interface{}) string {
+		parts := make([]string, len(key))
+		for i, column := range key {
+			parts[i] = render.Cell(row[column], nulls)
+		}
+		encoded, _ := json.Marshal(parts)
+		return string(encoded)
+	}
+	index := func(side diffSide) (map[string]map[string]interface{}, error) {
+		rows := make(map[string]map[string]interface{}, len(side.rows))
+		for _, row := range side.rows {
+			k := rowKey(row)
+			if _, exists := rows[k]; exists {
+				return nil, fmt.Errorf("key %s repeats in the %s result; choose key columns that identify one row", k, side.Source)
+			}
+			rows[k] = row
+		}
+		return rows, nil
+	}
+	beforeRows, err := index(before)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := index(after); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool, len(after.rows))
+	for _, row := range after.rows {
+		k := rowKey(row)
+		seen[k] = true
+		old, exists := beforeRows[k]
+		if !exists {
+			diff.AddedCount++
+			if len(diff.Added) < maxDiffRows {
+				diff.Added = append(diff.Added, row)
+			}
+			continue
+		}
+		changes := make(map[string]map[string]string)
+		for _, column := range shared {
+			was, now := render.Cell(old[column], nulls), render.Cell(row[column], nulls)
+			if was != now {
+				changes[column] = map[string]string{"before": was, "after": now}
+			}
+		}
+		if len(changes) == 0 {
+			diff.Unchanged++
+			continue
+		}
+		diff.ChangedCount++
+		if len(diff.Changed) < maxDiffRows {
+			keyValues := make(map[string]interface{}, len(key))
+			for _, column := range key {
+				keyValues[column] = row[column]
+			}
+			diff.Changed = append(diff.Changed, rowChange{Key: keyValues, Changes: changes})
+		}
+	}
+	for _, row := range before.rows {
+		if seen[rowKey(row)] {
+			continue
+		}
+		diff.RemovedCount++
+		if len(diff.Removed) < maxDiffRows {
+			diff.Removed = append(diff.Removed, row)
+		}
+	}
+	diff.Truncated = diff.AddedCount > maxDiffRows || diff.RemovedCount > maxDiffRows || diff.ChangedCount > maxDiffRows
+	return diff, nil
+}
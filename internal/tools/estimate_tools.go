@@ -0,0 +1,520 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+	"data-chatter/internal/jobs"
+	"data-chatter/internal/sqlparse"
+	"data-chatter/internal/types"
+)
+
+const (
+	// estimateTargetRows is how many rows of the sampled table an estimate
+	// aims to read when no sample_percent is given.
+	estimateTargetRows = 100_000
+
+	// defaultSamplePercent is used when the sampled table's size is unknown.
+	defaultSamplePercent = 10.0
+
+	// estimateZ is the normal quantile of the 95% error bounds.
+	estimateZ = 1.96
+
+	// estimateHelperPrefix names the columns added to the sampled query to
+	// compute error bounds; they are left out of the result.
+	estimateHelperPrefix = "dc_estimate_"
+)
+
+// DatabaseEstimateTool answers heavy aggregations approximately by running
+// them over a random sample of their main table: TABLESAMPLE SYSTEM on
+// PostgreSQL, and a random filter on SQLite, MySQL, DuckDB, and ClickHouse.
+// COUNT and SUM are scaled up to the whole table, and every COUNT, SUM, and
+// AVG comes with a 95% error bound. The exact query can be queued to run in the background.
+type DatabaseEstimateTool struct {
+	queryTool *DatabaseQueryTool
+
+	mu   sync.RWMutex
+	jobs *jobs.Manager
+}
+
+// QueryEstimate is an approximate query result. Data holds the estimates,
+// and ErrorBounds, row by row, the bounds of each estimated column.
+type QueryEstimate struct {
+	Query         string                     `json:"query"`
+	SampledQuery  string                     `json:"sampled_query"`
+	SamplePercent float64                    `json:"sample_percent"`
+	Confidence    float64                    `json:"confidence"`
+	Columns       []string                   `json:"columns"`
+	Data          []map[string]interface{}   `json:"data"`
+	ErrorBounds   []map[string]EstimateBound `json:"error_bounds"`
+	RowCount      int                        `json:"row_count"`
+	Notes         []string                   `json:"notes,omitempty"`
+
+	// ExactJobID is the background job running the exact query, when one
+	// was asked for.
+	ExactJobID string `json:"exact_job_id,omitempty"`
+}
+
+// EstimateBound is the range an estimated value falls in at the estimate's
+// confidence.
+type EstimateBound struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// NewDatabaseEstimateTool creates a new approximate query tool instance.
+func NewDatabaseEstimateTool(conn *database.Connection) *DatabaseEstimateTool {
+	return &DatabaseEstimateTool{
+		queryTool: NewDatabaseQueryTool(conn),
+	}
+}
+
+// SetJobs sets the manager that runs exact queries in the background.
+func (e *DatabaseEstimateTool) SetJobs(manager *jobs.Manager) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.jobs = manager
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (e *DatabaseEstimateTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "database_estimate",
+		Description: "Estimate the result of an aggregation over a large table fast, by running it on a random sample of the first table in FROM. Supports plain COUNT, SUM, AVG, MIN, and MAX columns with GROUP BY; COUNT and SUM are scaled to the whole table and come with 95% error bounds. Say that the numbers are estimates. Set run_exact to also run the exact query in the background",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "SQL SELECT aggregation to estimate, as it would be run exactly",
+				},
+				"sample_percent": map[string]interface{}{
+					"type":        "number",
+					"description": "Percentage of the table's rows to sample, above 0 and up to 100 (default: enough for about 100,000 rows)",
+				},
+				"run_exact": map[string]interface{}{
+					"type":        "boolean",
+					"description": "Also queue the exact query as a background job and return its ID",
+				},
+			},
+			"required": []string{"query"},
+		},
+	}
+}
+
+// Validate checks the query like database_query does, and the options.
+func (e *DatabaseEstimateTool) Validate(input map[string]interface{}) error {
+	if err := e.queryTool.Validate(input); err != nil {
+		return err
+	}
+	if raw, ok := input["sample_percent"]; ok {
+		percent, ok := raw.(float64)
+		if !ok || percent <= 0 || percent > 100 {
+			return fmt.Errorf("sample_percent must be a number above 0 and up to 100")
+		}
+	}
+	if raw, ok := input["run_exact"]; ok {
+		if _, ok := raw.(bool); !ok {
+			return fmt.Errorf("run_exact must be a boolean")
+		}
+	}
+	return nil
+}
+
+// Execute samples the query's main table, runs the aggregation over the
+// sample, and scales the results with their error bounds.
+func (e *DatabaseEstimateTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	query := input["query"].(string)
+	conn := e.queryTool.conn.For(ctx)
+
+	plan, err := planEstimate(query)
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+
+	percent, _ := input["sample_percent"].(float64)
+	if percent == 0 {
+		percent = e.defaultPercent(ctx, plan)
+	}
+	sampled := plan.sampledQuery(conn.Config.Type, percent)
+
+	var columns []string
+	var rows [][]interface{}
+	setColumns := func(cols []string) {
+		columns = cols
+	}
+	addRow := func(values []interface{}) error {
+		row := make([]interface{}, len(values))
+		for i, value := range values {
+			row[i] = normalizeValue(value)
+		}
+		rows = append(rows, row)
+		return nil
+	}
+	if err := e.queryTool.scanRows(ctx, sampled, nil, conn.Config.MaxResultRows, setColumns, addRow); err != nil {
+		return queryErrorResult(err), nil
+	}
+
+	estimate := plan.scale(columns, rows, percent/100)
+	estimate.Query = query
+	estimate.SampledQuery = sampled
+	estimate.SamplePercent = percent
+	if conn.Config.Type == "postgres" && percent < 100 {
+		estimate.Notes = append(estimate.Notes, "PostgreSQL samples whole pages, so the bounds are optimistic when rows on a page are alike")
+	}
+
+	if runExact, _ := input["run_exact"].(bool); runExact {
+		e.mu.RLock()
+		manager := e.jobs
+		e.mu.RUnlock()
+		if manager == nil {
+			estimate.Notes = append(estimate.Notes, "The exact query was not queued: background jobs are not available")
+		} else if job, err := manager.Submit(ctx, auth.UserID(ctx), jobs.Job{Kind: jobs.KindQuery, Query: query}); err != nil {
+			estimate.Notes = append(estimate.Notes, "The exact query was not queued: "+err.Error())
+		} else {
+			estimate.ExactJobID = job.ID
+			estimate.Notes = append(estimate.Notes, "The exact result will be at GET /jobs/"+job.ID)
+		}
+	}
+
+	jsonData, _ := json.MarshalIndent(estimate, "", "  ")
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
+
+// defaultPercent picks a sample of about estimateTargetRows rows, from the
+// table's size in the query plan.
+func (e *DatabaseEstimateTool) defaultPercent(ctx context.Context, plan *estimatePlan) float64 {
+	queryPlan, err := e.queryTool.conn.For(ctx).Explain(ctx, plan.query)
+	if err != nil {
+		return defaultSamplePercent
+	}
+	for _, scan := range queryPlan.Scans {
+		sampled := strings.EqualFold(scan.Table, plan.table) || strings.EqualFold(scan.Table, plan.alias)
+		if sampled && scan.Rows > 0 {
+			percent := 100 * float64(estimateTargetRows) / float64(scan.Rows)
+			return math.Min(100, math.Max(0.01, math.Round(percent*100)/100))
+		}
+	}
+	return defaultSamplePercent
+}
+
+// estimateItem is one column of the query's select list.
+type estimateItem struct {
+	text      string // As written, including any alias
+	aggregate string // COUNT, SUM, AVG, MIN, or MAX; "" for a grouping column
+	argument  string // The aggregate's argument
+}
+
+// estimatePlan is a query split up for sampling.
+type estimatePlan struct {
+	query     string
+	selectEnd int // Byte offset of the select list, after any DISTINCT
+	items     []estimateItem
+	from      int    // Byte offset of the FROM keyword
+	fromStart int    // Byte offset of the sampled table reference
+	fromEnd   int    // Byte offset just past its alias
+	table     string // The sampled table, as written
+	alias     string // Its alias, or its unqualified name
+}
+
+// planEstimate finds the select list and the first table of the query's
+// FROM clause, rejecting queries whose results sampling cannot estimate.
+func planEstimate(query string) (*estimatePlan, error) {
+	tokens := sqlparse.Tokenize(query)
+	if len(tokens) == 0 || !tokens[0].IsKeyword("SELECT") {
+		return nil, fmt.Errorf("database_estimate needs a plain SELECT; common table expressions are not supported")
+	}
+	end := func(i int) int {
+		if i < len(tokens) {
+			return tokens[i].Pos
+		}
+		return len(query)
+	}
+
+	from, depth := -1, 0
+	var commas []int
+	for i, tok := range tokens {
+		switch {
+		case tok.Value == "(":
+			depth++
+		case tok.Value == ")":
+			depth--
+		case depth > 0:
+		case tok.IsKeyword("UNION"), tok.IsKeyword("INTERSECT"), tok.IsKeyword("EXCEPT"):
+			return nil, fmt.Errorf("database_estimate cannot sample %s queries", strings.ToUpper(tok.Value))
+		case tok.IsKeyword("HAVING"):
+			return nil, fmt.Errorf("database_estimate cannot apply HAVING to sampled totals; filter the estimates instead")
+		case tok.IsKeyword("FROM") && from < 0:
+			from = i
+		case tok.Value == "," && from < 0:
+			commas = append(commas, i)
+		}
+	}
+	if from < 0 {
+		return nil, fmt.Errorf("database_estimate needs a query that reads a table")
+	}
+
+	start := 1
+	if tokens[start].IsKeyword("DISTINCT") || tokens[start].IsKeyword("ALL") {
+		start++
+	}
+	plan := &estimatePlan{query: query, selectEnd: tokens[start].Pos, from: tokens[from].Pos}
+	hasAggregate := false
+	for _, stop := range append(commas, from) {
+		item, err := parseEstimateItem(query, tokens[start:stop], end(stop))
+		if err != nil {
+			return nil, err
+		}
+		hasAggregate = hasAggregate || item.aggregate != ""
+		plan.items = append(plan.items, item)
+		start = stop + 1
+	}
+	if !hasAggregate {
+		return nil, fmt.Errorf("database_estimate is for aggregations; use database_query to read rows")
+	}
+
+	// The sampled table is the first in FROM, with its optional alias
+	i := from + 1
+	if i >= len(tokens) || !tokens[i].IsIdentifier() {
+		return nil, fmt.Errorf("database_estimate samples the first table in FROM, which must be a table rather than a subquery")
+	}
+	plan.fromStart = tokens[i].Pos
+	i++
+	for i+1 < len(tokens) && tokens[i].Value == "." && tokens[i+1].IsIdentifier() {
+		i += 2
+	}
+	plan.table = strings.TrimSpace(query[plan.fromStart:end(i)])
+	plan.alias = tokens[i-1].Value
+	if i < len(tokens) && tokens[i].IsKeyword("AS") {
+		i++
+	}
+	if i < len(tokens) && tokens[i].IsIdentifier() && !estimateStopWords[strings.ToUpper(tokens[i].Value)] {
+		plan.alias = tokens[i].Value
+		i++
+	}
+	plan.fromEnd = end(i)
+	return plan, nil
+}
+
+// estimateStopWords end a table reference, so they are not read as aliases.
+var estimateStopWords = map[string]bool{
+	"WHERE": true, "GROUP": true, "ORDER": true, "LIMIT": true, "OFFSET": true,
+	"JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"CROSS": true, "NATURAL": true, "ON": true, "USING": true, "WINDOW": true,
+	"FETCH": true, "TABLESAMPLE": true,
+}
+
+// estimateAggregates are the aggregates an estimate can scale or bound.
+var estimateAggregates = map[string]bool{"COUNT": true, "SUM": true, "AVG": true, "MIN": true, "MAX": true}
+
+// parseEstimateItem classifies a select list item: a single aggregate call,
+// optionally aliased, or an expression without aggregates.
+func parseEstimateItem(query string, tokens []sqlparse.Token, end int) (estimateItem, error) {
+	if len(tokens) == 0 {
+		return estimateItem{}, fmt.Errorf("database_estimate could not read the select list")
+	}
+	item := estimateItem{text: strings.TrimSpace(query[tokens[0].Pos:end])}
+
+	for i, tok := range tokens {
+		if tok.Kind != sqlparse.Word || i+1 >= len(tokens) || tokens[i+1].Value != "(" {
+			continue
+		}
+		name := strings.ToUpper(tok.Value)
+		if !estimateAggregates[name] {
+			continue
+		}
+		if i != 0 || item.aggregate != "" {
+			return item, fmt.Errorf("database_estimate supports plain COUNT, SUM, AVG, MIN, and MAX columns, not %q", item.text)
+		}
+
+		// Find the closing parenthesis; only an alias may follow it
+		depth, close := 0, -1
+		for j := i + 1; j < len(tokens) && close < 0; j++ {
+			switch tokens[j].Value {
+			case "(":
+				depth++
+			case ")":
+				depth--
+				if depth == 0 {
+					close = j
+				}
+			}
+		}
+		if close < 0 {
+			return item, fmt.Errorf("database_estimate could not read %q", item.text)
+		}
+		rest := len(tokens) - close - 1
+		aliased := rest == 1 && tokens[close+1].IsIdentifier() ||
+			rest == 2 && tokens[close+1].IsKeyword("AS") && tokens[close+2].IsIdentifier()
+		if rest != 0 && !aliased {
+			return item, fmt.Errorf("database_estimate supports plain COUNT, SUM, AVG, MIN, and MAX columns, not %q", item.text)
+		}
+		if close > i+2 && tokens[i+2].IsKeyword("DISTINCT") {
+			return item, fmt.Errorf("database_estimate cannot scale DISTINCT aggregates like %q", item.text)
+		}
+		item.aggregate = name
+		item.argument = strings.TrimSpace(query[tokens[i+2].Pos:tokens[close].Pos])
+	}
+	return item, nil
+}
+
+// sampledQuery rewrites the query to read a percent sample of its table,
+// adding the sums of squares and counts the error bounds need.
+func (p *estimatePlan) sampledQuery(dialect string, percent float64) string {
+	var list []string
+	for i, item := range p.items {
+		list = append(list, item.text)
+		square := fmt.Sprintf("(%s) * 1.0 * (%s)", item.argument, item.argument)
+		switch item.aggregate {
+		case "SUM":
+			list = append(list, fmt.Sprintf("SUM(%s) AS %ssq%d", square, estimateHelperPrefix, i))
+		case "AVG":
+			list = append(list,
+				fmt.Sprintf("SUM(%s) AS %ssq%d", square, estimateHelperPrefix, i),
+				fmt.Sprintf("COUNT(%s) AS %sn%d", item.argument, estimateHelperPrefix, i))
+		}
+	}
+
+	source := p.query[p.fromStart:p.fromEnd]
+	if percent < 100 {
+		fraction := strconv.FormatFloat(percent/100, 'f', -1, 64)
+		switch dialect {
+		case "postgres":
+			source = strings.TrimSpace(source) + fmt.Sprintf(" TABLESAMPLE SYSTEM (%s) ", strconv.FormatFloat(percent, 'f', -1, 64))
+		case "mysql":
+			source = fmt.Sprintf("(SELECT * FROM %s WHERE RAND() < %s) AS %s ", p.table, fraction, p.alias)
+		case "duckdb":
+			source = fmt.Sprintf("(SELECT * FROM %s WHERE random() < %s) AS %s ", p.table, fraction, p.alias)
+		case "clickhouse":
+			source = fmt.Sprintf("(SELECT * FROM %s WHERE rand() %% 1000000 < %d) AS %s ", p.table, int64(percent*10_000), p.alias)
+		case "sqlserver":
+			// RAND() is evaluated once per query, NEWID() once per row
+			source = fmt.Sprintf("(SELECT * FROM %s WHERE ABS(CHECKSUM(NEWID())) %% 1000000 < %d) AS %s ", p.table, int64(percent*10_000), p.alias)
+		default:
+			source = fmt.Sprintf("(SELECT * FROM %s WHERE abs(random()) %% 1000000 < %d) AS %s ", p.table, int64(percent*10_000), p.alias)
+		}
+	}
+
+	return strings.TrimSpace(p.query[:p.selectEnd] + strings.Join(list, ", ") + " " + p.query[p.from:p.fromStart] + source + p.query[p.fromEnd:])
+}
+
+// scale turns the sampled rows into estimates for the whole table, where
+// fraction is the share of rows sampled.
+func (p *estimatePlan) scale(columns []string, rows [][]interface{}, fraction float64) QueryEstimate {
+	estimate := QueryEstimate{Confidence: 0.95, Data: []map[string]interface{}{}, ErrorBounds: []map[string]EstimateBound{}}
+
+	// Map each select list item to its result column and helper columns
+	type itemColumns struct{ value, squares, count int }
+	var layout []itemColumns
+	col := 0
+	for _, item := range p.items {
+		c := itemColumns{value: col, squares: -1, count: -1}
+		col++
+		switch item.aggregate {
+		case "SUM":
+			c.squares = col
+			col++
+		case "AVG":
+			c.squares, c.count = col, col+1
+			col += 2
+		}
+		layout = append(layout, c)
+		if c.value < len(columns) {
+			estimate.Columns = append(estimate.Columns, columns[c.value])
+		}
+	}
+
+	unseenMinMax := false
+	for _, values := range rows {
+		row := make(map[string]interface{}, len(layout))
+		bounds := make(map[string]EstimateBound)
+		for i, item := range p.items {
+			c := layout[i]
+			if c.value >= len(columns) {
+				continue
+			}
+			name := columns[c.value]
+			value := values[c.value]
+			x, numeric := estimateNumber(value)
+			if !numeric || item.aggregate == "" {
+				row[name] = value
+				continue
+			}
+
+			var est, se float64
+			switch item.aggregate {
+			case "COUNT":
+				est = math.Round(x / fraction)
+				se = math.Sqrt(x*(1-fraction)) / fraction
+			case "SUM":
+				squares, _ := estimateNumber(values[c.squares])
+				est = x / fraction
+				se = math.Sqrt((1-fraction)*squares) / fraction
+			case "AVG":
+				squares, _ := estimateNumber(values[c.squares])
+				n, _ := estimateNumber(values[c.count])
+				est = x
+				if n > 1 {
+					variance := math.Max(0, (squares-n*x*x)/(n-1))
+					se = math.Sqrt(variance / n * (1 - fraction))
+				}
+			default:
+				row[name] = value
+				unseenMinMax = true
+				continue
+			}
+			row[name] = est
+			bounds[name] = EstimateBound{Low: est - estimateZ*se, High: est + estimateZ*se}
+		}
+		estimate.Data = append(estimate.Data, row)
+		estimate.ErrorBounds = append(estimate.ErrorBounds, bounds)
+	}
+	estimate.RowCount = len(estimate.Data)
+
+	if unseenMinMax && fraction < 1 {
+		estimate.Notes = append(estimate.Notes, "MIN and MAX are taken from the sample, so the true extremes may lie beyond them")
+	}
+	if fraction < 1 && len(p.items) > 0 && hasGroupingColumn(p.items) {
+		estimate.Notes = append(estimate.Notes, "Small groups may be missing, since none of their rows were sampled")
+	}
+	return estimate
+}
+
+// hasGroupingColumn reports whether any select list item is not an aggregate.
+func hasGroupingColumn(items []estimateItem) bool {
+	for _, item := range items {
+		if item.aggregate == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// estimateNumber reads a sampled value as a number.
+func estimateNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case nil:
+		return 0, false
+	}
+	return 0, false
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/sqlparse"
+	"data-chatter/internal/types"
+)
+
+// DatabaseExplainTool shows how the database would run a SELECT query,
+// without running it, along with the indexes on the tables it reads, so the
+// LLM can explain why a query is slow and suggest a better one.
+type DatabaseExplainTool struct {
+	queryTool *DatabaseQueryTool
+}
+
+// QueryExplanation is a query's plan and the indexes it could use.
+type QueryExplanation struct {
+	Query string `json:"query"`
+	Plan  string `json:"plan"`
+	// Cost is the planner's estimated total cost; only PostgreSQL reports one.
+	Cost      float64                         `json:"estimated_cost,omitempty"`
+	FullScans []database.TableScan            `json:"full_scans"`
+	Indexes   map[string][]database.IndexInfo `json:"indexes"`
+	// Problems are the plan's steps over the cost guard's limits.
+	Problems []string `json:"problems,omitempty"`
+}
+
+// NewDatabaseExplainTool creates a new query plan tool instance.
+func NewDatabaseExplainTool(conn *database.Connection) *DatabaseExplainTool {
+	return &DatabaseExplainTool{
+		queryTool: NewDatabaseQueryTool(conn),
+	}
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (e *DatabaseExplainTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "database_explain",
+		Description: "Show the execution plan of a read-only SQL SELECT query without running it, with the full table scans it does and the indexes on the tables it reads. Use it to answer \"why is this query slow?\" and to suggest faster SQL or missing indexes",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "SQL SELECT query to explain",
+				},
+			},
+			"required": []string{"query"},
+		},
+	}
+}
+
+// Validate applies query validation to the query to explain.
+func (e *DatabaseExplainTool) Validate(input map[string]interface{}) error {
+	return e.queryTool.Validate(input)
+}
+
+// Execute explains the query and lists the indexes of each table it reads.
+func (e *DatabaseExplainTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	query := input["query"].(string)
+	conn := e.queryTool.conn.For(ctx)
+
+	plan, err := conn.Explain(ctx, query)
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+
+	explanation := QueryExplanation{
+		Query:     query,
+		Plan:      plan.Text,
+		Cost:      plan.Cost,
+		FullScans: append([]database.TableScan{}, plan.Scans...),
+		Indexes:   make(map[string][]database.IndexInfo),
+		Problems:  plan.Problems(conn.Config.MaxScanRows, conn.Config.MaxPlanCost),
+	}
+	for _, table := range sqlparse.ReferencedTables(query) {
+		if _, seen := explanation.Indexes[table]; seen {
+			continue
+		}
+		indexes, err := conn.TableIndexes(ctx, table)
+		if err != nil {
+			slog.DebugContext(ctx, "could not list indexes", "table", table, "error", err)
+			continue
+		}
+		explanation.Indexes[table] = append([]database.IndexInfo{}, indexes...)
+	}
+
+	jsonData, _ := json.MarshalIndent(explanation, "", "  ")
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"data-chatter/internal/render"
+)
+
+// Export formats.
+const (
+	ExportCSV   = "csv"
+	ExportJSONL = "jsonl"
+)
+
+// ExportPage writes the next page of query's rows to w in format, csv with
+// a header row when header is set or jsonl, and returns the number of rows
+// written and the key of the last, to pass as after for the page following.
+// Pages are read by keyset: the rows are ordered by the key columns, which
+// must identify a row and hold no NULLs, and each page starts after the key
+// of the last row of the previous one, a JSON array, or at the first row
+// when after is empty. Rows are masked as database_query's are, but key
+// columns may not be. The MaxResultRows cap does not apply; limit bounds
+// the page instead.
+func (d *DatabaseQueryTool) ExportPage(ctx context.Context, query string, key []string, after json.RawMessage, limit int, format string, header bool, w io.Writer) (int, json.RawMessage, error) {
+	config := d.conn.For(ctx).Config
+	var args []interface{}
+	if len(after) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(after))
+		decoder.UseNumber()
+		if err := decoder.Decode(&args); err != nil || len(args) != len(key) {
+			return 0, nil, fmt.Errorf("invalid export checkpoint %s", after)
+		}
+		for i, arg := range args {
+			if n, ok := arg.(json.Number); ok {
+				if integer, err := n.Int64(); err == nil {
+					args[i] = integer
+				} else {
+					args[i], _ = n.Float64()
+				}
+			}
+		}
+	}
+
+	quoted := make([]string, len(key))
+	for i, column := range key {
+		quoted[i] = config.QuoteIdentifier(column)
+	}
+	page := "SELECT * FROM (" + strings.TrimSuffix(strings.TrimSpace(query), ";") + ") export_page"
+	var params []interface{}
+	if args != nil {
+		// (k1, k2) > (a1, a2) spelled out, since not every dialect compares
+		// row values: k1 > a1 OR (k1 = a1 AND k2 > a2)
+		var terms []string
+		for i := range key {
+			var term []string
+			for j := 0; j < i; j++ {
+				params = append(params, args[j])
+				term = append(term, fmt.Sprintf("%s = %s", quoted[j], config.Placeholder(len(params))))
+			}
+			params = append(params, args[i])
+			term = append(term, fmt.Sprintf("%s > %s", quoted[i], config.Placeholder(len(params))))
+			terms = append(terms, "("+strings.Join(term, " AND ")+")")
+		}
+		page += " WHERE " + strings.Join(terms, " OR ")
+	}
+	page = config.Limit(page+" ORDER BY "+strings.Join(quoted, ", "), limit)
+
+	mask := d.columnMask(ctx, page)
+	var (
+		columns  []string
+		keyIndex []int
+		csvOut   *csv.Writer
+		line     bytes.Buffer
+		last     []interface{}
+		previous string
+		count    int
+	)
+	setColumns := func(names []string) {
+		columns = names
+	}
+	addRow := func(values []interface{}) error {
+		if keyIndex == nil {
+			masked := mask.masked(columns)
+			for _, column := range key {
+				index := -1
+				for i, name := range columns {
+					if name == column {
+						index = i
+					}
+				}
+				if index < 0 {
+					return fmt.Errorf("key column %q is not in the query result (columns: %s)", column, strings.Join(columns, ", "))
+				}
+				if masked != nil && masked[index] {
+					return fmt.Errorf("key column %q is masked; page by a column that is not personal data", column)
+				}
+				keyIndex = append(keyIndex, index)
+			}
+			if format == ExportCSV {
+				csvOut = csv.NewWriter(w)
+				if header {
+					if err := csvOut.Write(columns); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		last = make([]interface{}, len(keyIndex))
+		for i, index := range keyIndex {
+			switch v := values[index].(type) {
+			case nil:
+				return fmt.Errorf("key column %q is NULL in a row; page by columns that are never NULL", key[i])
+			case []byte:
+				last[i] = string(v)
+			case time.Time:
+				last[i] = v.Format(time.RFC3339Nano)
+			default:
+				last[i] = v
+			}
+		}
+		current, _ := json.Marshal(last)
+		if string(current) == previous {
+			return fmt.Errorf("key %s repeats; page by columns that identify one row", current)
+		}
+		previous = string(current)
+
+		if format == ExportCSV {
+			cells := make([]string, len(values))
+			for i, value := range values {
+				cells[i] = render.Cell(normalizeValue(value), render.NullsEmpty)
+			}
+			if err := csvOut.Write(cells); err != nil {
+				return err
+			}
+		} else {
+			line.Reset()
+			line.WriteByte('{')
+			for i, column := range columns {
+				if i > 0 {
+					line.WriteByte(',')
+				}
+				name, _ := json.Marshal(column)
+				value, err := json.Marshal(normalizeValue(values[i]))
+				if err != nil {
+					return fmt.Errorf("failed to encode column %s: %w", column, err)
+				}
+				line.Write(name)
+				line.WriteByte(':')
+				line.Write(value)
+			}
+			line.WriteString("}\n")
+			if _, err := w.Write(line.Bytes()); err != nil {
+				return err
+			}
+		}
+		count++
+		return nil
+	}
+
+	if err := d.scanRows(ctx, page, params, 0, setColumns, addRow); err != nil {
+		return count, nil, err
+	}
+	if csvOut == nil && format == ExportCSV && header {
+		// An empty result still has its header
+		csvOut = csv.NewWriter(w)
+		csvOut.Write(columns)
+	}
+	if csvOut != nil {
+		csvOut.Flush()
+		if err := csvOut.Error(); err != nil {
+			return count, nil, err
+		}
+	}
+	if count == 0 {
+		return 0, after, nil
+	}
+	next, _ := json.Marshal(last)
+	return count, next, nil
+}
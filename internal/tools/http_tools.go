@@ -0,0 +1,238 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/types"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+const (
+	defaultHTTPToolTimeout = 30 * time.Second
+	maxHTTPToolResponse    = 1 << 20
+)
+
+// Headers carrying the call's CallContext to external services, so they can
+// apply per-caller behavior such as row filters. The locale is sent as
+// Accept-Language.
+const (
+	UserIDHeader         = "X-User-ID"
+	ConversationIDHeader = "X-Conversation-ID"
+	TurnIDHeader         = "X-Turn-ID"
+)
+
+// HTTPToolConfig describes an external tool backed by a REST endpoint.
+// Header values may reference environment variables as ${NAME}, so secrets
+// such as auth tokens can stay out of the configuration file.
+type HTTPToolConfig struct {
+	Name        string                 `json:"name" yaml:"name" toml:"name"`
+	Description string                 `json:"description" yaml:"description" toml:"description"`
+	InputSchema map[string]interface{} `json:"input_schema" yaml:"input_schema" toml:"input_schema"`
+	URL         string                 `json:"url" yaml:"url" toml:"url"`
+	Method      string                 `json:"method,omitempty" yaml:"method" toml:"method"`
+	Headers     map[string]string      `json:"headers,omitempty" yaml:"headers" toml:"headers"`
+	Timeout     string                 `json:"timeout,omitempty" yaml:"timeout" toml:"timeout"`
+}
+
+// HTTPTool forwards tool inputs as a JSON body to an external service and
+// returns the service's response as the tool result.
+type HTTPTool struct {
+	definition types.ToolDefinition
+	url        string
+	method     string
+	headers    map[string]string
+	client     *http.Client
+}
+
+// NewHTTPTool creates an HTTP-backed tool from its configuration.
+func NewHTTPTool(config HTTPToolConfig) (*HTTPTool, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("http tool is missing a name")
+	}
+	if !strings.HasPrefix(config.URL, "http://") && !strings.HasPrefix(config.URL, "https://") {
+		return nil, fmt.Errorf("http tool %s: url must be an http or https URL", config.Name)
+	}
+
+	method := strings.ToUpper(config.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	if method != http.MethodPost && method != http.MethodPut {
+		return nil, fmt.Errorf("http tool %s: method must be POST or PUT", config.Name)
+	}
+
+	timeout := defaultHTTPToolTimeout
+	if config.Timeout != "" {
+		parsed, err := time.ParseDuration(config.Timeout)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("http tool %s: invalid timeout %q", config.Name, config.Timeout)
+		}
+		timeout = parsed
+	}
+
+	schema := config.InputSchema
+	if schema == nil {
+		schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+	}
+
+	headers := make(map[string]string, len(config.Headers))
+	for key, value := range config.Headers {
+		headers[key] = os.ExpandEnv(value)
+	}
+
+	return &HTTPTool{
+		definition: types.ToolDefinition{
+			Name:        config.Name,
+			Description: config.Description,
+			InputSchema: schema,
+		},
+		url:     config.URL,
+		method:  method,
+		headers: headers,
+		client:  &http.Client{Timeout: timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}, nil
+}
+
+// ParseHTTPTools decodes a JSON array of HTTP tool configurations.
+func ParseHTTPTools(data string) ([]HTTPToolConfig, error) {
+	var configs []HTTPToolConfig
+	if err := json.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("invalid http tool configuration: %w", err)
+	}
+	return configs, nil
+}
+
+// GetDefinition returns the configured tool definition.
+func (t *HTTPTool) GetDefinition() types.ToolDefinition {
+	return t.definition
+}
+
+// Validate checks that the fields the input schema marks as required are present.
+func (t *HTTPTool) Validate(input map[string]interface{}) error {
+	required, _ := t.definition.InputSchema["required"].([]interface{})
+	for _, raw := range required {
+		field, _ := raw.(string)
+		if _, exists := input[field]; field != "" && !exists {
+			return fmt.Errorf("%s is required", field)
+		}
+	}
+	return nil
+}
+
+// Execute sends the input to the service and wraps its response body as the
+// result.
+func (t *HTTPTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	body, err := json.Marshal(input)
+	if err != nil {
+		return validationErrorResult(fmt.Sprintf("input cannot be encoded as JSON: %v", err)), nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, t.method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return httpErrorResult(types.ErrorExecution, err.Error()), nil
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	setCallContextHeaders(req.Header, types.CallContextFrom(ctx))
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	text, failed := send(ctx, t.client, req, t.definition.Name)
+	if failed != nil {
+		return failed, nil
+	}
+	return &types.ToolResult{
+		Content: []types.ToolContent{{Type: "text", Text: text}},
+	}, nil
+}
+
+// send makes a request to the external service called name and returns
+// its trimmed response body, or the error result to return instead. Non-2xx
+// responses become errors; timeouts, unreachable services, and 502-504
+// responses are reported as retryable.
+func send(ctx context.Context, client *http.Client, req *http.Request, name string) (string, *types.ToolResult) {
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", httpErrorResult(types.ErrorTimeout, fmt.Sprintf("%s timed out: %v", name, err))
+		}
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return "", httpErrorResult(types.ErrorCancelled, fmt.Sprintf("%s was cancelled", name))
+		}
+		return "", httpErrorResult(types.ErrorConnection, fmt.Sprintf("%s is unreachable: %v", name, err))
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPToolResponse+1))
+	if err != nil {
+		return "", httpErrorResult(types.ErrorConnection, fmt.Sprintf("failed to read %s response: %v", name, err))
+	}
+	if len(data) > maxHTTPToolResponse {
+		return "", httpErrorResult(types.ErrorResourceLimit, fmt.Sprintf("%s response exceeds %d bytes", name, maxHTTPToolResponse))
+	}
+	text := strings.TrimSpace(string(data))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		code := types.ErrorExecution
+		switch resp.StatusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			code = types.ErrorConnection
+		}
+		message := fmt.Sprintf("%s returned %s", name, resp.Status)
+		if text != "" {
+			message += ": " + truncate(text, 500)
+		}
+		return "", httpErrorResult(code, message)
+	}
+	return text, nil
+}
+
+// setCallContextHeaders adds the non-empty fields of cc to header.
+func setCallContextHeaders(header http.Header, cc types.CallContext) {
+	for key, value := range map[string]string{
+		UserIDHeader:         cc.UserID,
+		ConversationIDHeader: cc.ConversationID,
+		TurnIDHeader:         cc.TurnID,
+		"Accept-Language":    cc.Locale,
+	} {
+		if value != "" {
+			header.Set(key, value)
+		}
+	}
+}
+
+// httpErrorResult reports a failed call to an external service.
+func httpErrorResult(code, message string) *types.ToolResult {
+	return &types.ToolResult{
+		Content: []types.ToolContent{{Type: "text", Text: message}},
+		IsError: true,
+		Error: &types.ToolError{
+			Code:      code,
+			Message:   message,
+			Retryable: types.IsRetryable(code),
+		},
+	}
+}
+
+// truncate shortens s to at most n bytes, marking the cut.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
@@ -0,0 +1,210 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/dbt"
+	"data-chatter/internal/types"
+)
+
+// MetricToolPrefix starts the name of every dbt metric tool.
+const MetricToolPrefix = "metric_"
+
+// MetricTool computes one dbt metric, optionally grouped by its dimensions
+// and by a time grain, with the SQL its definition implies, so answers about
+// governed metrics match the data team's numbers.
+type MetricTool struct {
+	metric     dbt.Metric
+	conn       *database.Connection
+	query      *DatabaseQueryTool
+	authorizer types.Authorizer
+}
+
+// NewMetricTool creates the tool for a dbt metric.
+func NewMetricTool(conn *database.Connection, metric dbt.Metric) *MetricTool {
+	return &MetricTool{
+		metric: metric,
+		conn:   conn,
+		query:  NewDatabaseQueryTool(conn),
+	}
+}
+
+// Name returns the tool's name, the metric's name with MetricToolPrefix.
+func (t *MetricTool) Name() string {
+	return MetricToolPrefix + t.metric.Name
+}
+
+// SetAuthorizer checks the metric's SQL as a database_query call, since the
+// registry only sees the metric tool's name.
+func (t *MetricTool) SetAuthorizer(authorizer types.Authorizer) {
+	t.authorizer = authorizer
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *MetricTool) GetDefinition() types.ToolDefinition {
+	label := t.metric.Label
+	if label == "" {
+		label = t.metric.Name
+	}
+	description := fmt.Sprintf("Compute the governed dbt metric %q", label)
+	if t.metric.Description != "" {
+		description += ": " + strings.TrimSuffix(strings.TrimSpace(t.metric.Description), ".")
+	}
+	description += ". Prefer this over database_query whenever the question asks for this metric"
+
+	properties := map[string]interface{}{
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": "Most rows to return",
+		},
+	}
+	if dimensions := t.metric.DimensionNames(); len(dimensions) > 0 {
+		properties["group_by"] = map[string]interface{}{
+			"type":        "array",
+			"items":       map[string]interface{}{"type": "string", "enum": dimensions},
+			"description": "Dimensions to break the metric down by",
+		}
+	}
+	if t.metric.Time != "" {
+		properties["grain"] = map[string]interface{}{
+			"type":        "string",
+			"enum":        database.TimeGrains,
+			"description": "Break the metric down by this period of its time dimension",
+		}
+		properties["start"] = map[string]interface{}{
+			"type":        "string",
+			"description": "Only include rows at or after this date or time, e.g. 2024-01-01",
+		}
+		properties["end"] = map[string]interface{}{
+			"type":        "string",
+			"description": "Only include rows before this date or time",
+		}
+	}
+	return types.ToolDefinition{
+		Name:        t.Name(),
+		Description: description,
+		InputSchema: map[string]interface{}{
+			"type":       "object",
+			"properties": properties,
+		},
+	}
+}
+
+// Validate checks group_by names known dimensions, grain is a known grain,
+// and the time range is only given for metrics with a time dimension.
+func (t *MetricTool) Validate(input map[string]interface{}) error {
+	if raw, exists := input["group_by"]; exists {
+		list, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("group_by must be an array of dimension names")
+		}
+		for _, item := range list {
+			name, _ := item.(string)
+			if _, ok := t.metric.Dimensions[name]; !ok {
+				return fmt.Errorf("unknown dimension %q: use one of %s", name, strings.Join(t.metric.DimensionNames(), ", "))
+			}
+		}
+	}
+	for _, key := range []string{"grain", "start", "end"} {
+		raw, exists := input[key]
+		if !exists {
+			continue
+		}
+		if t.metric.Time == "" {
+			return fmt.Errorf("%s is not supported: metric %s has no time dimension", key, t.metric.Name)
+		}
+		if value, ok := raw.(string); !ok || value == "" {
+			return fmt.Errorf("%s must be a non-empty string", key)
+		}
+	}
+	if grain, ok := input["grain"].(string); ok && !slices.Contains(database.TimeGrains, grain) {
+		return fmt.Errorf("grain must be one of %s", strings.Join(database.TimeGrains, ", "))
+	}
+	if raw, exists := input["limit"]; exists {
+		if limit, ok := raw.(float64); !ok || limit < 1 || limit != float64(int(limit)) {
+			return fmt.Errorf("limit must be a positive integer")
+		}
+	}
+	return nil
+}
+
+// Execute builds the metric's SQL and runs it read-only with the same access
+// checks as database_query. The SQL comes from the manifest and validated
+// input rather than the LLM, so it skips database_query's keyword checks.
+func (t *MetricTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	query, args, err := t.build(input)
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+
+	checked := map[string]interface{}{"query": query}
+	if t.authorizer != nil {
+		if err := t.authorizer.Authorize(ctx, "database_query", checked); err != nil {
+			return &types.ToolResult{
+				Content: []types.ToolContent{{Type: "text", Text: err.Error()}},
+				IsError: true,
+				Error:   &types.ToolError{Code: types.ErrorPermissionDenied, Message: err.Error()},
+			}, nil
+		}
+	}
+
+	return t.query.execute(ctx, query, args), nil
+}
+
+// build renders the metric's SELECT: the requested dimensions and time
+// bucket, the metric's aggregate, and the time range as bind arguments.
+func (t *MetricTool) build(input map[string]interface{}) (string, []interface{}, error) {
+	config := t.conn.Config
+	var columns, expressions, where []string
+	var args []interface{}
+
+	groupBy, _ := input["group_by"].([]interface{})
+	for _, item := range groupBy {
+		name := item.(string)
+		columns = append(columns, fmt.Sprintf("%s AS %s", t.metric.Dimensions[name], config.QuoteIdentifier(name)))
+		expressions = append(expressions, t.metric.Dimensions[name])
+	}
+	if grain, ok := input["grain"].(string); ok {
+		bucket, err := config.TruncateTime(t.metric.Time, grain)
+		if err != nil {
+			return "", nil, err
+		}
+		columns = append(columns, fmt.Sprintf("%s AS %s", bucket, config.QuoteIdentifier(grain)))
+		expressions = append(expressions, bucket)
+	}
+	grouped := len(columns)
+	columns = append(columns, fmt.Sprintf("%s AS %s", t.metric.Expression, config.QuoteIdentifier(t.metric.Name)))
+
+	for _, bound := range []struct{ key, op string }{{"start", ">="}, {"end", "<"}} {
+		if value, ok := input[bound.key].(string); ok {
+			args = append(args, value)
+			where = append(where, fmt.Sprintf("%s %s %s", t.metric.Time, bound.op, config.Placeholder(len(args))))
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT %s FROM %s", strings.Join(columns, ", "), t.metric.Table)
+	if len(where) > 0 {
+		fmt.Fprintf(&b, " WHERE %s", strings.Join(where, " AND "))
+	}
+	if grouped > 0 {
+		positions := make([]string, grouped)
+		for i := range positions {
+			positions[i] = fmt.Sprint(i + 1)
+		}
+		if config.Type == "sqlserver" {
+			// SQL Server groups by expressions only, not select list positions
+			fmt.Fprintf(&b, " GROUP BY %s ORDER BY %s", strings.Join(expressions, ", "), strings.Join(positions, ", "))
+		} else {
+			fmt.Fprintf(&b, " GROUP BY %s ORDER BY %s", strings.Join(positions, ", "), strings.Join(positions, ", "))
+		}
+	}
+	if limit, ok := input["limit"].(float64); ok {
+		return config.Limit(b.String(), int(limit)), args, nil
+	}
+	return b.String(), args, nil
+}
@@ -0,0 +1,384 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/mongodb"
+	"data-chatter/internal/types"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultMongoLimit is how many documents mongo_find returns without a limit.
+const defaultMongoLimit = 100
+
+// mongoTool holds what mongo_find and mongo_aggregate share: the MongoDB
+// client, and the SQL connection whose masker hides personal data in their
+// results too.
+type mongoTool struct {
+	client *mongodb.Client
+	conn   *database.Connection
+}
+
+// collectionProperty describes the collection input, listing the allowed
+// collections when MONGO_COLLECTIONS restricts them.
+func (m mongoTool) collectionProperty() map[string]interface{} {
+	property := map[string]interface{}{
+		"type":        "string",
+		"description": "Name of the collection to query",
+	}
+	if collections := m.client.Config.Collections; len(collections) > 0 {
+		property["enum"] = collections
+	}
+	return property
+}
+
+// validateCollection checks the collection input.
+func (m mongoTool) validateCollection(input map[string]interface{}) (string, error) {
+	collection, ok := input["collection"].(string)
+	if !ok || collection == "" {
+		return "", fmt.Errorf("collection must be a non-empty string")
+	}
+	if !m.client.CollectionAllowed(collection) {
+		return "", fmt.Errorf("collection %s is not available; use one of %s", collection, strings.Join(m.client.Config.Collections, ", "))
+	}
+	return collection, nil
+}
+
+// MongoFindTool runs a find on a MongoDB collection with a filter written
+// by the LLM in MongoDB Extended JSON.
+type MongoFindTool struct {
+	mongoTool
+}
+
+// NewMongoFindTool creates a mongo_find tool on client. Values in fields
+// that conn's masker matches are masked as in database_query results.
+func NewMongoFindTool(conn *database.Connection, client *mongodb.Client) *MongoFindTool {
+	return &MongoFindTool{mongoTool{client: client, conn: conn}}
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *MongoFindTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name: "mongo_find",
+		Description: fmt.Sprintf("Find documents in a collection of the MongoDB database %s. The filter, projection, and sort are MongoDB Extended JSON objects "+
+			"written as strings, e.g. {\"status\": \"open\", \"created_at\": {\"$gte\": {\"$date\": \"2024-01-01T00:00:00Z\"}}}. "+
+			"Returns rows whose columns are the documents' top-level fields; nested documents and arrays come back as JSON text. "+
+			"$where and other server-side JavaScript are refused", t.client.Config.Database),
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"collection": t.collectionProperty(),
+				"filter": map[string]interface{}{
+					"type":        "string",
+					"description": "Query filter as an Extended JSON object; {} or empty matches every document",
+				},
+				"projection": map[string]interface{}{
+					"type":        "string",
+					"description": "Fields to return as an Extended JSON object, e.g. {\"name\": 1, \"total\": 1}",
+				},
+				"sort": map[string]interface{}{
+					"type":        "string",
+					"description": "Sort order as an Extended JSON object, e.g. {\"created_at\": -1}",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Maximum documents to return (default %d, at most %d)", defaultMongoLimit, t.client.Config.MaxDocuments),
+				},
+				"skip": map[string]interface{}{
+					"type":        "integer",
+					"description": "Documents to skip before returning any",
+				},
+			},
+			"required": []string{"collection"},
+		},
+	}
+}
+
+// Validate checks the collection, parses the filter, projection, and sort,
+// and refuses operators that write or run JavaScript.
+func (t *MongoFindTool) Validate(input map[string]interface{}) error {
+	collection, err := t.validateCollection(input)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{"filter", "projection", "sort"} {
+		document, err := documentInput(input, key)
+		if err != nil {
+			return err
+		}
+		if err := t.client.Check(collection, document); err != nil {
+			return err
+		}
+	}
+	for _, key := range []string{"limit", "skip"} {
+		if value, ok := input[key]; ok {
+			number, ok := value.(float64)
+			if !ok || number < 0 || number != float64(int64(number)) {
+				return fmt.Errorf("%s must be a non-negative integer", key)
+			}
+		}
+	}
+	return nil
+}
+
+// Execute runs the find and returns the documents as a query result. A
+// limit above MONGO_MAX_DOCUMENTS is lowered to it, with a warning.
+func (t *MongoFindTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	collection := input["collection"].(string)
+	filter, _ := documentInput(input, "filter")
+	projection, _ := documentInput(input, "projection")
+	sort, _ := documentInput(input, "sort")
+	skip, _ := input["skip"].(float64)
+
+	var warnings []string
+	limit := int64(defaultMongoLimit)
+	if value, ok := input["limit"].(float64); ok && value > 0 {
+		limit = int64(value)
+	}
+	if maxDocuments := int64(t.client.Config.MaxDocuments); limit > maxDocuments {
+		warnings = append(warnings, fmt.Sprintf("limit lowered from %d to %d documents", limit, maxDocuments))
+		limit = maxDocuments
+	}
+
+	shell := fmt.Sprintf("db.%s.find(%s", collection, extJSON(filter, "{}"))
+	if projection != nil {
+		shell += ", " + extJSON(projection, "{}")
+	}
+	shell += ")"
+	if sort != nil {
+		shell += ".sort(" + extJSON(sort, "{}") + ")"
+	}
+	if skip > 0 {
+		shell += fmt.Sprintf(".skip(%d)", int64(skip))
+	}
+	shell += fmt.Sprintf(".limit(%d)", limit)
+
+	start := time.Now()
+	documents, err := t.client.Find(ctx, collection, filter, projection, sort, int64(skip), limit)
+	if err != nil {
+		slog.WarnContext(ctx, "mongo find failed", "collection", collection, "error", err)
+		return mongoErrorResult(err), nil
+	}
+	slog.InfoContext(ctx, "mongo find", "collection", collection, "duration", time.Since(start), "documents", len(documents))
+	return t.encode(ctx, shell, documents, warnings), nil
+}
+
+// MongoAggregateTool runs an aggregation pipeline on a MongoDB collection.
+type MongoAggregateTool struct {
+	mongoTool
+}
+
+// NewMongoAggregateTool creates a mongo_aggregate tool on client. Values in
+// fields that conn's masker matches are masked as in database_query results.
+func NewMongoAggregateTool(conn *database.Connection, client *mongodb.Client) *MongoAggregateTool {
+	return &MongoAggregateTool{mongoTool{client: client, conn: conn}}
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *MongoAggregateTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name: "mongo_aggregate",
+		Description: fmt.Sprintf("Run an aggregation pipeline on a collection of the MongoDB database %s, e.g. to group, count, or join with $lookup. "+
+			"The pipeline is a MongoDB Extended JSON array of stages written as a string, e.g. "+
+			"[{\"$match\": {\"status\": \"paid\"}}, {\"$group\": {\"_id\": \"$region\", \"total\": {\"$sum\": \"$amount\"}}}, {\"$sort\": {\"total\": -1}}]. "+
+			"Returns rows whose columns are the output documents' top-level fields, at most %d of them. "+
+			"$out, $merge, and server-side JavaScript are refused", t.client.Config.Database, t.client.Config.MaxDocuments),
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"collection": t.collectionProperty(),
+				"pipeline": map[string]interface{}{
+					"type":        "string",
+					"description": "Aggregation pipeline as an Extended JSON array of stage objects",
+				},
+			},
+			"required": []string{"collection", "pipeline"},
+		},
+	}
+}
+
+// Validate checks the collection, parses the pipeline, and refuses stages
+// that write, run JavaScript, or read collections that are not allowed.
+func (t *MongoAggregateTool) Validate(input map[string]interface{}) error {
+	collection, err := t.validateCollection(input)
+	if err != nil {
+		return err
+	}
+	pipeline, err := pipelineInput(input)
+	if err != nil {
+		return err
+	}
+	return t.client.Check(collection, pipeline)
+}
+
+// Execute runs the pipeline and returns its output documents as a query
+// result. One document more than MONGO_MAX_DOCUMENTS is read so a cut
+// result can be flagged.
+func (t *MongoAggregateTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	collection := input["collection"].(string)
+	pipeline, _ := pipelineInput(input)
+	shell := fmt.Sprintf("db.%s.aggregate(%s)", collection, strings.TrimSpace(input["pipeline"].(string)))
+
+	start := time.Now()
+	maxDocuments := t.client.Config.MaxDocuments
+	documents, err := t.client.Aggregate(ctx, collection, pipeline, int64(maxDocuments)+1)
+	if err != nil {
+		slog.WarnContext(ctx, "mongo aggregate failed", "collection", collection, "error", err)
+		return mongoErrorResult(err), nil
+	}
+	slog.InfoContext(ctx, "mongo aggregate", "collection", collection, "duration", time.Since(start), "documents", len(documents))
+
+	var warnings []string
+	if len(documents) > maxDocuments {
+		warnings = append(warnings, fmt.Sprintf("only the first %d documents are shown; add a $limit or $group stage", maxDocuments))
+		documents = documents[:maxDocuments]
+	}
+	return t.encode(ctx, shell, documents, warnings), nil
+}
+
+// encode writes documents as a database_query payload whose query is the
+// mongo shell command. The columns are the documents' top-level fields in
+// the order they first appear.
+func (m mongoTool) encode(ctx context.Context, shell string, documents []bson.D, warnings []string) *types.ToolResult {
+	var columns []string
+	index := make(map[string]int)
+	for _, document := range documents {
+		for _, element := range document {
+			if _, ok := index[element.Key]; !ok {
+				index[element.Key] = len(columns)
+				columns = append(columns, element.Key)
+			}
+		}
+	}
+	masked := make([]bool, len(columns))
+	if masker := m.conn.For(ctx).Masker; masker.Applies(ctx) {
+		for i, column := range columns {
+			masked[i] = masker.Masks(column)
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := newResultEncoder(&buf)
+	encoder.begin(shell, m.client.SourceName())
+	encoder.writeWarnings(warnings)
+	encoder.writeColumns(columns)
+	values := make([]interface{}, len(columns))
+	for _, document := range documents {
+		clear(values)
+		for _, element := range document {
+			i := index[element.Key]
+			values[i] = mongoValue(element.Value)
+			if masked[i] {
+				values[i] = database.MaskValue(values[i])
+			}
+		}
+		encoder.writeRow(values)
+	}
+	encoder.end()
+	return &types.ToolResult{Content: []types.ToolContent{{Type: "text", Text: buf.String()}}}
+}
+
+// documentInput parses the Extended JSON object in input[key], returning
+// nil when it is missing or empty.
+func documentInput(input map[string]interface{}, key string) (bson.D, error) {
+	value, ok := input[key]
+	if !ok || value == nil {
+		return nil, nil
+	}
+	raw, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s must be an Extended JSON object written as a string", key)
+	}
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var document bson.D
+	if err := bson.UnmarshalExtJSON([]byte(raw), false, &document); err != nil {
+		return nil, fmt.Errorf("%s is not a valid Extended JSON object: %v", key, err)
+	}
+	return document, nil
+}
+
+// pipelineInput parses the Extended JSON array of stages in input["pipeline"].
+func pipelineInput(input map[string]interface{}) (bson.A, error) {
+	raw, ok := input["pipeline"].(string)
+	if !ok || strings.TrimSpace(raw) == "" {
+		return nil, fmt.Errorf("pipeline must be an Extended JSON array written as a string")
+	}
+	// Extended JSON is parsed a document at a time, so the array is wrapped in one
+	var wrapper struct {
+		Pipeline bson.A `bson:"pipeline"`
+	}
+	if err := bson.UnmarshalExtJSON([]byte(`{"pipeline":`+raw+`}`), false, &wrapper); err != nil {
+		return nil, fmt.Errorf("pipeline is not a valid Extended JSON array: %v", err)
+	}
+	for i, stage := range wrapper.Pipeline {
+		if document, ok := stage.(bson.D); !ok || len(document) != 1 {
+			return nil, fmt.Errorf("pipeline stage %d must be an object with one stage operator, such as {\"$match\": {...}}", i+1)
+		}
+	}
+	return wrapper.Pipeline, nil
+}
+
+// mongoValue converts a decoded BSON value for a result row: identifiers
+// and decimals become strings, dates become times, and nested documents
+// and arrays become relaxed Extended JSON text.
+func mongoValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case nil, primitive.Null, primitive.Undefined:
+		return nil
+	case string, bool, int64, float64:
+		return v
+	case int32:
+		return int64(v)
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC()
+	case primitive.Timestamp:
+		return time.Unix(int64(v.T), 0).UTC()
+	case primitive.Decimal128:
+		return v.String()
+	}
+	return extJSON(value, "null")
+}
+
+// extJSON renders value as relaxed Extended JSON, or fallback when value
+// is nil or cannot be rendered.
+func extJSON(value interface{}, fallback string) string {
+	if value == nil {
+		return fallback
+	}
+	if document, ok := value.(bson.D); ok && document == nil {
+		return fallback
+	}
+	// Only documents marshal on their own, so value is wrapped in one
+	encoded, err := bson.MarshalExtJSON(bson.D{{Key: "v", Value: value}}, false, false)
+	if err != nil {
+		return fallback
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(string(encoded), `{"v":`), "}")
+}
+
+// mongoErrorResult wraps a MongoDB error as an error tool result.
+func mongoErrorResult(err error) *types.ToolResult {
+	code, driverCode := mongodb.ClassifyError(err)
+	return &types.ToolResult{
+		Content: []types.ToolContent{{Type: "text", Text: err.Error()}},
+		IsError: true,
+		Error: &types.ToolError{
+			Code:       code,
+			Message:    err.Error(),
+			DriverCode: driverCode,
+			Retryable:  types.IsRetryable(code),
+		},
+	}
+}
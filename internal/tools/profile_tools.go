@@ -0,0 +1,229 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/types"
+)
+
+const (
+	defaultProfileTopN = 5
+	maxProfileTopN     = 20
+)
+
+// TableProfileTool computes per-column statistics for a table so the LLM can
+// describe its contents without guessing.
+type TableProfileTool struct {
+	conn *database.Connection
+}
+
+// ColumnProfile holds the computed statistics for one column.
+type ColumnProfile struct {
+	Name          string       `json:"name"`
+	DataType      string       `json:"data_type"`
+	NullCount     int64        `json:"null_count"`
+	NullRate      float64      `json:"null_rate"`
+	DistinctCount int64        `json:"distinct_count"`
+	Min           interface{}  `json:"min"`
+	Max           interface{}  `json:"max"`
+	TopValues     []ValueCount `json:"top_values"`
+}
+
+// ValueCount is a column value with its number of occurrences.
+type ValueCount struct {
+	Value interface{} `json:"value"`
+	Count int64       `json:"count"`
+}
+
+// NewTableProfileTool creates a new table profiling tool instance.
+func NewTableProfileTool(conn *database.Connection) *TableProfileTool {
+	return &TableProfileTool{
+		conn: conn,
+	}
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *TableProfileTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "table_profile",
+		Description: "Profile a table: row count and, per column, null rate, distinct count, min/max, and most frequent values",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"table": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the table to profile",
+				},
+				"columns": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Optional subset of columns to profile (defaults to all)",
+				},
+				"top_n": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Number of most frequent values to report per column (default %d, max %d)", defaultProfileTopN, maxProfileTopN),
+				},
+			},
+			"required": []string{"table"},
+		},
+	}
+}
+
+// Validate checks that a table name was supplied and top_n is in range.
+func (t *TableProfileTool) Validate(input map[string]interface{}) error {
+	table, ok := input["table"].(string)
+	if !ok || table == "" {
+		return fmt.Errorf("table must be a non-empty string")
+	}
+
+	if raw, exists := input["top_n"]; exists {
+		n, ok := raw.(float64)
+		if !ok || n < 1 || n > maxProfileTopN {
+			return fmt.Errorf("top_n must be an integer between 1 and %d", maxProfileTopN)
+		}
+	}
+
+	if raw, exists := input["columns"]; exists {
+		cols, ok := raw.([]interface{})
+		if !ok {
+			return fmt.Errorf("columns must be an array of column names")
+		}
+		for _, col := range cols {
+			if _, ok := col.(string); !ok {
+				return fmt.Errorf("columns must be an array of column names")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Execute profiles the requested table and returns the statistics as JSON.
+// Table and column names are checked against the live schema before being
+// interpolated into SQL.
+func (t *TableProfileTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	conn := t.conn.For(ctx)
+	table := input["table"].(string)
+
+	topN := defaultProfileTopN
+	if n, ok := input["top_n"].(float64); ok {
+		topN = int(n)
+	}
+
+	exists, err := conn.HasTable(ctx, table)
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+	if !exists {
+		return validationErrorResult(fmt.Sprintf("table %q does not exist", table)), nil
+	}
+
+	columns, err := conn.TableColumns(ctx, table)
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+
+	if requested, ok := input["columns"].([]interface{}); ok && len(requested) > 0 {
+		columns, err = selectColumns(columns, requested)
+		if err != nil {
+			return validationErrorResult(err.Error()), nil
+		}
+	}
+
+	quotedTable := conn.Config.QuoteIdentifier(table)
+
+	var rowCount int64
+	if err := conn.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+quotedTable).Scan(&rowCount); err != nil {
+		return queryErrorResult(fmt.Errorf("failed to count rows: %w", err)), nil
+	}
+
+	profiles := make([]ColumnProfile, 0, len(columns))
+	for _, col := range columns {
+		profile, err := t.profileColumn(ctx, quotedTable, col, rowCount, topN)
+		if err != nil {
+			return queryErrorResult(err), nil
+		}
+		profiles = append(profiles, profile)
+	}
+
+	response := map[string]interface{}{
+		"table":     table,
+		"row_count": rowCount,
+		"columns":   profiles,
+	}
+
+	jsonData, _ := json.MarshalIndent(response, "", "  ")
+
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
+
+// profileColumn computes the statistics for a single column.
+func (t *TableProfileTool) profileColumn(ctx context.Context, quotedTable string, col database.ColumnInfo, rowCount int64, topN int) (ColumnProfile, error) {
+	conn := t.conn.For(ctx)
+	quotedCol := conn.Config.QuoteIdentifier(col.Name)
+	profile := ColumnProfile{
+		Name:      col.Name,
+		DataType:  col.DataType,
+		TopValues: []ValueCount{},
+	}
+
+	var nonNull int64
+	var minValue, maxValue interface{}
+	statsQuery := fmt.Sprintf("SELECT COUNT(%[1]s), COUNT(DISTINCT %[1]s), MIN(%[1]s), MAX(%[1]s) FROM %[2]s", quotedCol, quotedTable)
+	if err := conn.DB.QueryRowContext(ctx, statsQuery).Scan(&nonNull, &profile.DistinctCount, &minValue, &maxValue); err != nil {
+		return profile, fmt.Errorf("failed to profile column %s: %w", col.Name, err)
+	}
+
+	profile.NullCount = rowCount - nonNull
+	if rowCount > 0 {
+		profile.NullRate = float64(profile.NullCount) / float64(rowCount)
+	}
+	profile.Min = normalizeValue(minValue)
+	profile.Max = normalizeValue(maxValue)
+
+	topQuery := conn.Config.Limit(fmt.Sprintf("SELECT %[1]s, COUNT(*) AS cnt FROM %[2]s GROUP BY %[1]s ORDER BY cnt DESC", quotedCol, quotedTable), topN)
+	rows, err := conn.DB.QueryContext(ctx, topQuery)
+	if err != nil {
+		return profile, fmt.Errorf("failed to get top values for %s: %w", col.Name, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var value interface{}
+		var count int64
+		if err := rows.Scan(&value, &count); err != nil {
+			return profile, fmt.Errorf("failed to scan top values for %s: %w", col.Name, err)
+		}
+		profile.TopValues = append(profile.TopValues, ValueCount{Value: normalizeValue(value), Count: count})
+	}
+
+	return profile, rows.Err()
+}
+
+// selectColumns narrows columns to the requested names, rejecting unknown ones.
+func selectColumns(columns []database.ColumnInfo, requested []interface{}) ([]database.ColumnInfo, error) {
+	byName := make(map[string]database.ColumnInfo, len(columns))
+	for _, col := range columns {
+		byName[col.Name] = col
+	}
+
+	selected := make([]database.ColumnInfo, 0, len(requested))
+	for _, raw := range requested {
+		name := raw.(string)
+		col, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("column %q does not exist", name)
+		}
+		selected = append(selected, col)
+	}
+	return selected, nil
+}
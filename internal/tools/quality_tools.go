@@ -0,0 +1,84 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"data-chatter/internal/quality"
+	"data-chatter/internal/types"
+)
+
+// QualityScorecardTool reports the data-quality scorecard: the latest
+// results of the rules admins defined, so users can ask "how clean is the
+// contacts table?" in chat.
+type QualityScorecardTool struct {
+	store  *quality.Store
+	filter types.SchemaFilter
+}
+
+// NewQualityScorecardTool creates a new scorecard tool instance. Its calls
+// fail until SetStore is called.
+func NewQualityScorecardTool() *QualityScorecardTool {
+	return &QualityScorecardTool{}
+}
+
+// SetStore sets the store rules and results are read from.
+func (t *QualityScorecardTool) SetStore(store *quality.Store) {
+	t.store = store
+}
+
+// SetFilter hides rules on tables and columns the caller may not read.
+func (t *QualityScorecardTool) SetFilter(filter types.SchemaFilter) {
+	t.filter = filter
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *QualityScorecardTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "quality_scorecard",
+		Description: "Get the data-quality scorecard: the score and latest results of the not-null, uniqueness, referential integrity, and freshness rules admins defined, per table. Use it for questions about how complete, consistent, or up to date the data is",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"table": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional table to report on; omit for every table",
+				},
+			},
+		},
+	}
+}
+
+// Validate checks the optional table name.
+func (t *QualityScorecardTool) Validate(input map[string]interface{}) error {
+	if raw, exists := input["table"]; exists {
+		if _, ok := raw.(string); !ok {
+			return fmt.Errorf("table must be a string")
+		}
+	}
+	return nil
+}
+
+// Execute returns the scorecard as JSON.
+func (t *QualityScorecardTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	if t.store == nil {
+		return nil, errors.New("data-quality rules are unavailable")
+	}
+
+	table, _ := input["table"].(string)
+	rules, err := t.store.List(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonData, _ := json.MarshalIndent(quality.NewScorecard(quality.Visible(ctx, rules, t.filter)), "", "  ")
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
@@ -0,0 +1,435 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/querycache"
+	"data-chatter/internal/requestid"
+	"data-chatter/internal/types"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// defaultRemoteMetricCacheTTL is how long responses are cached by default.
+const defaultRemoteMetricCacheTTL = 5 * time.Minute
+
+// Remote metric value types, as JSON Schema names them.
+var remoteMetricTypes = []string{"string", "integer", "number", "boolean"}
+
+// RemoteMetricConfig describes a metric served by a remote endpoint, such as
+// an analytics API or another warehouse's metrics layer. Its parameters and
+// result columns are declared in the configuration, so the LLM sees a typed
+// tool and gets rows back in the same shape as database_query's. Header
+// values may reference environment variables as ${NAME}.
+type RemoteMetricConfig struct {
+	Name        string            `json:"name" yaml:"name" toml:"name"`
+	Description string            `json:"description" yaml:"description" toml:"description"`
+	URL         string            `json:"url" yaml:"url" toml:"url"`
+	Method      string            `json:"method,omitempty" yaml:"method" toml:"method"` // GET sends parameters in the query string, POST as a JSON body
+	Headers     map[string]string `json:"headers,omitempty" yaml:"headers" toml:"headers"`
+	Timeout     string            `json:"timeout,omitempty" yaml:"timeout" toml:"timeout"`
+
+	Parameters []RemoteMetricParameter `json:"parameters,omitempty" yaml:"parameters" toml:"parameters"`
+
+	// Rows is the dotted path to the array of result rows in the response,
+	// such as "data.rows"; empty when the response is the array itself.
+	Rows    string               `json:"rows,omitempty" yaml:"rows" toml:"rows"`
+	Columns []RemoteMetricColumn `json:"columns" yaml:"columns" toml:"columns"`
+
+	// CacheTTL is how long responses are reused for the same parameters and
+	// user (default 5m); 0 disables caching.
+	CacheTTL string `json:"cache_ttl,omitempty" yaml:"cache_ttl" toml:"cache_ttl"`
+}
+
+// RemoteMetricParameter declares an input of a remote metric.
+type RemoteMetricParameter struct {
+	Name        string   `json:"name" yaml:"name" toml:"name"`
+	Type        string   `json:"type,omitempty" yaml:"type" toml:"type"` // string (default), integer, number, or boolean
+	Description string   `json:"description,omitempty" yaml:"description" toml:"description"`
+	Required    bool     `json:"required,omitempty" yaml:"required" toml:"required"`
+	Enum        []string `json:"enum,omitempty" yaml:"enum" toml:"enum"`
+}
+
+// RemoteMetricColumn declares a column of a remote metric's result.
+type RemoteMetricColumn struct {
+	Name string `json:"name" yaml:"name" toml:"name"`
+
+	// Path is the dotted path to the value in each row; the name when empty.
+	Path string `json:"path,omitempty" yaml:"path" toml:"path"`
+	Type string `json:"type,omitempty" yaml:"type" toml:"type"` // string (default), integer, number, or boolean
+}
+
+// RemoteMetricTool fetches a remote metric and returns its declared columns
+// as a query result. Responses are kept in the connection's result cache for
+// the metric's cache TTL, per user, since the service may filter by the
+// X-User-ID header.
+type RemoteMetricTool struct {
+	config  RemoteMetricConfig
+	method  string
+	headers map[string]string
+	ttl     time.Duration
+	conn    *database.Connection
+	client  *http.Client
+}
+
+// NewRemoteMetricTool checks a remote metric's configuration and creates its
+// tool. Responses are cached in conn's result cache and cut to its result
+// row limit.
+func NewRemoteMetricTool(conn *database.Connection, config RemoteMetricConfig) (*RemoteMetricTool, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("remote metric is missing a name")
+	}
+	if !strings.HasPrefix(config.URL, "http://") && !strings.HasPrefix(config.URL, "https://") {
+		return nil, fmt.Errorf("remote metric %s: url must be an http or https URL", config.Name)
+	}
+	method := strings.ToUpper(config.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if method != http.MethodGet && method != http.MethodPost {
+		return nil, fmt.Errorf("remote metric %s: method must be GET or POST", config.Name)
+	}
+
+	timeout := defaultHTTPToolTimeout
+	if config.Timeout != "" {
+		parsed, err := time.ParseDuration(config.Timeout)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("remote metric %s: invalid timeout %q", config.Name, config.Timeout)
+		}
+		timeout = parsed
+	}
+	ttl := defaultRemoteMetricCacheTTL
+	if config.CacheTTL != "" {
+		parsed, err := time.ParseDuration(config.CacheTTL)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("remote metric %s: invalid cache_ttl %q", config.Name, config.CacheTTL)
+		}
+		ttl = parsed
+	}
+
+	seen := make(map[string]bool)
+	for i, parameter := range config.Parameters {
+		if parameter.Name == "" || seen[parameter.Name] {
+			return nil, fmt.Errorf("remote metric %s: parameter %d needs a unique name", config.Name, i+1)
+		}
+		seen[parameter.Name] = true
+		if parameter.Type == "" {
+			config.Parameters[i].Type = "string"
+		} else if !slices.Contains(remoteMetricTypes, parameter.Type) {
+			return nil, fmt.Errorf("remote metric %s: parameter %s has unknown type %q", config.Name, parameter.Name, parameter.Type)
+		}
+	}
+	if len(config.Columns) == 0 {
+		return nil, fmt.Errorf("remote metric %s needs columns", config.Name)
+	}
+	seen = make(map[string]bool)
+	for i, column := range config.Columns {
+		if column.Name == "" || seen[column.Name] {
+			return nil, fmt.Errorf("remote metric %s: column %d needs a unique name", config.Name, i+1)
+		}
+		seen[column.Name] = true
+		if column.Type != "" && !slices.Contains(remoteMetricTypes, column.Type) {
+			return nil, fmt.Errorf("remote metric %s: column %s has unknown type %q", config.Name, column.Name, column.Type)
+		}
+	}
+
+	headers := make(map[string]string, len(config.Headers))
+	for key, value := range config.Headers {
+		headers[key] = os.ExpandEnv(value)
+	}
+	return &RemoteMetricTool{
+		config:  config,
+		method:  method,
+		headers: headers,
+		ttl:     ttl,
+		conn:    conn,
+		client:  &http.Client{Timeout: timeout, Transport: otelhttp.NewTransport(http.DefaultTransport)},
+	}, nil
+}
+
+// ParseRemoteMetrics decodes a JSON array of remote metric configurations.
+func ParseRemoteMetrics(data string) ([]RemoteMetricConfig, error) {
+	var configs []RemoteMetricConfig
+	if err := json.Unmarshal([]byte(data), &configs); err != nil {
+		return nil, fmt.Errorf("invalid remote metric configuration: %w", err)
+	}
+	return configs, nil
+}
+
+// Name returns the tool's name, the metric's name with MetricToolPrefix, so
+// remote metrics sit beside dbt metrics.
+func (t *RemoteMetricTool) Name() string {
+	return MetricToolPrefix + t.config.Name
+}
+
+// GetDefinition returns the tool definition for LLM integration, with one
+// property per declared parameter.
+func (t *RemoteMetricTool) GetDefinition() types.ToolDefinition {
+	description := fmt.Sprintf("Fetch the metric %q from a remote service", t.config.Name)
+	if t.config.Description != "" {
+		description += ": " + strings.TrimSuffix(strings.TrimSpace(t.config.Description), ".")
+	}
+	columns := make([]string, len(t.config.Columns))
+	for i, column := range t.config.Columns {
+		columns[i] = column.Name
+	}
+	description += ". Returns the columns " + strings.Join(columns, ", ")
+
+	properties := make(map[string]interface{}, len(t.config.Parameters))
+	var required []interface{}
+	for _, parameter := range t.config.Parameters {
+		property := map[string]interface{}{"type": parameter.Type}
+		if parameter.Description != "" {
+			property["description"] = parameter.Description
+		}
+		if len(parameter.Enum) > 0 {
+			property["enum"] = parameter.Enum
+		}
+		properties[parameter.Name] = property
+		if parameter.Required {
+			required = append(required, parameter.Name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return types.ToolDefinition{Name: t.Name(), Description: description, InputSchema: schema}
+}
+
+// Validate checks the input against the declared parameters: required ones
+// are present, values have their types and enums, and nothing else is sent.
+func (t *RemoteMetricTool) Validate(input map[string]interface{}) error {
+	for _, parameter := range t.config.Parameters {
+		value, exists := input[parameter.Name]
+		if !exists {
+			if parameter.Required {
+				return fmt.Errorf("%s is required", parameter.Name)
+			}
+			continue
+		}
+		if !hasType(value, parameter.Type) {
+			return fmt.Errorf("%s must be a %s", parameter.Name, parameter.Type)
+		}
+		if len(parameter.Enum) > 0 && !slices.Contains(parameter.Enum, fmt.Sprint(value)) {
+			return fmt.Errorf("%s must be one of %s", parameter.Name, strings.Join(parameter.Enum, ", "))
+		}
+	}
+	for name := range input {
+		if !slices.ContainsFunc(t.config.Parameters, func(p RemoteMetricParameter) bool { return p.Name == name }) {
+			return fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+	return nil
+}
+
+// hasType reports whether a decoded JSON value is of a JSON Schema type.
+func hasType(value interface{}, typ string) bool {
+	switch v := value.(type) {
+	case string:
+		return typ == "string"
+	case float64:
+		return typ == "number" || typ == "integer" && v == float64(int64(v))
+	case bool:
+		return typ == "boolean"
+	}
+	return false
+}
+
+// Execute serves the metric from the cache or fetches it, and encodes the
+// declared columns of each row as a query result.
+func (t *RemoteMetricTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	encodedInput, err := json.Marshal(input)
+	if err != nil {
+		return validationErrorResult(fmt.Sprintf("input cannot be encoded as JSON: %v", err)), nil
+	}
+	cc := types.CallContextFrom(ctx)
+	key := querycache.Key(t.Name(), []interface{}{string(encodedInput)}, "remote:"+cc.UserID)
+	directive := querycache.ParseDirective(cc.CacheControl)
+	cache := t.conn.For(ctx).ResultCache
+	if text, ok := cache.Get(ctx, key, directive); ok {
+		slog.DebugContext(ctx, "remote metric served from cache", "metric", t.config.Name)
+		return &types.ToolResult{Content: []types.ToolContent{{Type: "text", Text: string(text)}}}, nil
+	}
+
+	req, err := t.request(ctx, input, encodedInput)
+	if err != nil {
+		return httpErrorResult(types.ErrorExecution, err.Error()), nil
+	}
+	start := time.Now()
+	text, failed := send(ctx, t.client, req, t.Name())
+	if failed != nil {
+		return failed, nil
+	}
+
+	var buf bytes.Buffer
+	rows, err := t.encode(&buf, req, text)
+	if err != nil {
+		return httpErrorResult(types.ErrorExecution, fmt.Sprintf("%s: %v", t.Name(), err)), nil
+	}
+	cache.SetFor(ctx, key, buf.Bytes(), directive, t.ttl)
+	slog.InfoContext(ctx, "remote metric fetched",
+		"metric", t.config.Name,
+		"user_id", cc.UserID,
+		"duration", time.Since(start),
+		"rows", rows)
+
+	return &types.ToolResult{Content: []types.ToolContent{{Type: "text", Text: buf.String()}}}, nil
+}
+
+// request builds the call for input: its values in the query string for
+// GET, or as the JSON body for POST.
+func (t *RemoteMetricTool) request(ctx context.Context, input map[string]interface{}, encodedInput []byte) (*http.Request, error) {
+	var req *http.Request
+	var err error
+	if t.method == http.MethodGet {
+		target, parseErr := url.Parse(t.config.URL)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		query := target.Query()
+		for name, value := range input {
+			query.Set(name, fmt.Sprint(value))
+		}
+		target.RawQuery = query.Encode()
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, t.config.URL, bytes.NewReader(encodedInput))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	setCallContextHeaders(req.Header, types.CallContextFrom(ctx))
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+	return req, nil
+}
+
+// encode writes the response's rows as a database_query payload whose
+// query is the request line, returning how many rows it wrote. Rows past
+// the result row limit are dropped with a warning.
+func (t *RemoteMetricTool) encode(buf *bytes.Buffer, req *http.Request, text string) (int, error) {
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var body interface{}
+	if err := decoder.Decode(&body); err != nil {
+		return 0, fmt.Errorf("response is not JSON: %v", err)
+	}
+	rows, ok := valueAt(body, t.config.Rows).([]interface{})
+	if !ok && valueAt(body, t.config.Rows) != nil {
+		return 0, fmt.Errorf("%q in the response is not an array of rows", t.config.Rows)
+	}
+
+	var warnings []string
+	if limit := t.conn.For(req.Context()).Config.MaxResultRows; limit > 0 && len(rows) > limit {
+		warnings = append(warnings, fmt.Sprintf("only the first %d of %d rows are shown", limit, len(rows)))
+		rows = rows[:limit]
+	}
+
+	encoder := newResultEncoder(buf)
+	encoder.begin(req.Method+" "+req.URL.Redacted(), req.URL.Host)
+	encoder.writeWarnings(warnings)
+	columns := make([]string, len(t.config.Columns))
+	for i, column := range t.config.Columns {
+		columns[i] = column.Name
+	}
+	encoder.writeColumns(columns)
+	values := make([]interface{}, len(columns))
+	for _, row := range rows {
+		for i, column := range t.config.Columns {
+			path := column.Path
+			if path == "" {
+				path = column.Name
+			}
+			values[i] = remoteValue(valueAt(row, path), column.Type)
+		}
+		encoder.writeRow(values)
+	}
+	encoder.end()
+	return encoder.rowCount, nil
+}
+
+// valueAt follows a dotted path through JSON objects and arrays, returning
+// nil when any step is missing.
+func valueAt(value interface{}, path string) interface{} {
+	if path == "" {
+		return value
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			value = v[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil
+			}
+			value = v[i]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// remoteValue converts a decoded JSON value to a column's type. Services
+// often send numbers as strings, so strings are parsed for numeric and
+// boolean columns; values that do not parse are kept as they are.
+func remoteValue(value interface{}, typ string) interface{} {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case json.Number:
+		text = v.String()
+	case string:
+		text = v
+	case bool:
+		if typ == "" || typ == "string" {
+			return strconv.FormatBool(v)
+		}
+		return v
+	default:
+		encoded, _ := json.Marshal(v)
+		return string(encoded)
+	}
+
+	switch typ {
+	case "integer":
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return int64(f)
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(text, 64); err == nil {
+			return f
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(strings.ToLower(text)); err == nil {
+			return b
+		}
+	}
+	return text
+}
@@ -0,0 +1,260 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+	"unsafe"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// resultEncoder streams a query result as the database_query JSON payload:
+//
+//	{"query":...,"database":...,"columns":[...],"data":[{...},...],"row_count":N,"advice":[...]}
+//
+// Warnings and rewrites come before the columns, and "truncated" after the
+// row count, when there are any.
+//
+// Rows are appended straight from the scanned values, with column keys encoded
+// once up front, instead of building and marshalling a map per row. Values are
+// rendered the same way normalizeValue and encoding/json would render them.
+type resultEncoder struct {
+	buf       *bytes.Buffer
+	keys      [][]byte
+	rowCount  int
+	dataStart int
+	dataEnd   int
+
+	// advice is written by end, when there is any.
+	advice []string
+	// limit is the LIMIT the query was given by the lint, or 0; end marks
+	// the result truncated when it reached it.
+	limit int
+}
+
+// newResultEncoder creates an encoder writing into buf.
+func newResultEncoder(buf *bytes.Buffer) *resultEncoder {
+	return &resultEncoder{buf: buf}
+}
+
+// begin writes the opening of the payload.
+func (e *resultEncoder) begin(query, database string) {
+	b := e.buf.AvailableBuffer()
+	b = append(b, `{"query":`...)
+	b = appendJSONString(b, query)
+	b = append(b, `,"database":`...)
+	b = appendJSONString(b, database)
+	e.buf.Write(b)
+}
+
+// writeWarnings writes the warnings about the query, if there are any.
+func (e *resultEncoder) writeWarnings(warnings []string) {
+	e.writeStrings("warnings", warnings)
+}
+
+// writeRewrites writes what was changed in the query, if anything was.
+func (e *resultEncoder) writeRewrites(rewrites []string) {
+	e.writeStrings("rewrites", rewrites)
+}
+
+// writeStrings writes a list of strings under key, unless it is empty.
+func (e *resultEncoder) writeStrings(key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	b := e.buf.AvailableBuffer()
+	b = append(b, ',')
+	b = appendJSONString(b, key)
+	b = append(b, `:[`...)
+	for i, value := range values {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, value)
+	}
+	b = append(b, ']')
+	e.buf.Write(b)
+}
+
+// writeColumns writes the column list, opens the data array, and prepares
+// the encoded key for each column.
+func (e *resultEncoder) writeColumns(columns []string) {
+	b := e.buf.AvailableBuffer()
+	b = append(b, `,"columns":[`...)
+	e.keys = make([][]byte, len(columns))
+	for i, column := range columns {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = appendJSONString(b, column)
+
+		key := make([]byte, 0, len(column)+4)
+		if i > 0 {
+			key = append(key, ',')
+		}
+		key = appendJSONString(key, column)
+		e.keys[i] = append(key, ':')
+	}
+	b = append(b, `],"data":`...)
+	e.buf.Write(b)
+	e.dataStart = e.buf.Len()
+	e.buf.WriteByte('[')
+}
+
+// writeRow appends one row object to the data array.
+func (e *resultEncoder) writeRow(values []interface{}) error {
+	b := e.buf.AvailableBuffer()
+	if e.rowCount > 0 {
+		b = append(b, ',')
+	}
+	b = append(b, '{')
+	for i, value := range values {
+		b = append(b, e.keys[i]...)
+		b = appendJSONValue(b, value)
+	}
+	b = append(b, '}')
+	e.buf.Write(b)
+	e.rowCount++
+	return nil
+}
+
+// end closes the data array and the payload.
+func (e *resultEncoder) end() {
+	e.buf.WriteByte(']')
+	e.dataEnd = e.buf.Len()
+
+	b := e.buf.AvailableBuffer()
+	b = append(b, `,"row_count":`...)
+	b = strconv.AppendInt(b, int64(e.rowCount), 10)
+	if e.limit > 0 && e.rowCount >= e.limit {
+		b = append(b, `,"truncated":true`...)
+	}
+	if len(e.advice) > 0 {
+		b = append(b, `,"advice":[`...)
+		for i, advice := range e.advice {
+			if i > 0 {
+				b = append(b, ',')
+			}
+			b = appendJSONString(b, advice)
+		}
+		b = append(b, ']')
+	}
+	b = append(b, '}')
+	e.buf.Write(b)
+}
+
+// data returns the encoded data array. It is only valid after end.
+func (e *resultEncoder) data() json.RawMessage {
+	return json.RawMessage(e.buf.Bytes()[e.dataStart:e.dataEnd])
+}
+
+// appendJSONValue appends a scanned database value as JSON.
+func appendJSONValue(b []byte, value interface{}) []byte {
+	switch v := value.(type) {
+	case nil:
+		return append(b, "null"...)
+	case string:
+		return appendJSONString(b, v)
+	case []byte:
+		if len(v) == 0 {
+			return append(b, `""`...)
+		}
+		// The bytes are only read while appending, so they need not be copied.
+		return appendJSONString(b, unsafe.String(&v[0], len(v)))
+	case int64:
+		return strconv.AppendInt(b, v, 10)
+	case float64:
+		return appendJSONFloat(b, v)
+	case bool:
+		return strconv.AppendBool(b, v)
+	case time.Time:
+		b = append(b, '"')
+		b = v.AppendFormat(b, time.RFC3339)
+		return append(b, '"')
+	default:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return append(b, "null"...)
+		}
+		return append(b, encoded...)
+	}
+}
+
+// appendJSONFloat formats f like encoding/json. NaN and infinities, which
+// JSON cannot represent, become null.
+func appendJSONFloat(b []byte, f float64) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return append(b, "null"...)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	b = strconv.AppendFloat(b, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9, as encoding/json does
+		n := len(b)
+		if n >= 4 && b[n-4] == 'e' && b[n-3] == '-' && b[n-2] == '0' {
+			b[n-2] = b[n-1]
+			b = b[:n-1]
+		}
+	}
+	return b
+}
+
+// appendJSONString appends s as a JSON string, escaping it like encoding/json
+// including its HTML-safe escapes and replacement of invalid UTF-8.
+func appendJSONString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' && c != '<' && c != '>' && c != '&' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			case '\b':
+				b = append(b, '\\', 'b')
+			case '\f':
+				b = append(b, '\\', 'f')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hexDigits[c>>4], hexDigits[c&0xF])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, "\ufffd"...)
+			i += size
+			start = i
+			continue
+		}
+		if r == '\u2028' || r == '\u2029' {
+			b = append(b, s[start:i]...)
+			b = append(b, '\\', 'u', '2', '0', '2', hexDigits[r&0xF])
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
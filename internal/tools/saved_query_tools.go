@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+
+	"data-chatter/internal/auth"
+	"data-chatter/internal/database"
+	"data-chatter/internal/savedqueries"
+	"data-chatter/internal/types"
+)
+
+// SavedQueryRunTool runs one of the caller's saved queries by name, binding
+// its parameters, so the LLM can answer common questions with vetted SQL.
+type SavedQueryRunTool struct {
+	conn       *database.Connection
+	query      *DatabaseQueryTool
+	store      *savedqueries.Store
+	authorizer types.Authorizer
+}
+
+// NewSavedQueryRunTool creates a new saved query tool instance.
+func NewSavedQueryRunTool(conn *database.Connection) *SavedQueryRunTool {
+	return &SavedQueryRunTool{
+		conn:  conn,
+		query: NewDatabaseQueryTool(conn),
+	}
+}
+
+// SetStore sets where saved queries are looked up.
+func (t *SavedQueryRunTool) SetStore(store *savedqueries.Store) {
+	t.store = store
+}
+
+// SetAuthorizer checks the bound SQL of every run as a database_query call,
+// since the registry only sees the query's name.
+func (t *SavedQueryRunTool) SetAuthorizer(authorizer types.Authorizer) {
+	t.authorizer = authorizer
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *SavedQueryRunTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "saved_query_run",
+		Description: "Run one of the user's saved queries by name. Prefer this over database_query when a saved query answers the question",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the saved query to run",
+				},
+				"parameters": map[string]interface{}{
+					"type":        "object",
+					"description": "Values for the saved query's parameters, by name; parameters with defaults may be left out",
+				},
+			},
+			"required": []string{"name"},
+		},
+	}
+}
+
+// Validate checks that a name is given and parameters is an object.
+func (t *SavedQueryRunTool) Validate(input map[string]interface{}) error {
+	if name, ok := input["name"].(string); !ok || name == "" {
+		return fmt.Errorf("name must be a non-empty string")
+	}
+	if raw, exists := input["parameters"]; exists {
+		if _, ok := raw.(map[string]interface{}); !ok {
+			return fmt.Errorf("parameters must be an object")
+		}
+	}
+	return nil
+}
+
+// Execute binds the parameters into the caller's saved query and runs it
+// with the same read-only and access checks as database_query.
+func (t *SavedQueryRunTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	name := input["name"].(string)
+	saved, err := t.store.Find(auth.UserID(ctx), name)
+	if err != nil {
+		return validationErrorResult(fmt.Sprintf("no saved query named %q", name)), nil
+	}
+
+	values, _ := input["parameters"].(map[string]interface{})
+	query, args, err := saved.Bind(values, t.conn.For(ctx).Config.Placeholder)
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+
+	checked := map[string]interface{}{"query": query}
+	if err := t.query.Validate(checked); err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+	if t.authorizer != nil {
+		if err := t.authorizer.Authorize(ctx, "database_query", checked); err != nil {
+			return &types.ToolResult{
+				Content: []types.ToolContent{{Type: "text", Text: err.Error()}},
+				IsError: true,
+				Error:   &types.ToolError{Code: types.ErrorPermissionDenied, Message: err.Error()},
+			}, nil
+		}
+	}
+
+	return t.query.execute(ctx, query, args), nil
+}
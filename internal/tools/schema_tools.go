@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/types"
+)
+
+// DatabaseSchemaTool describes the database's tables and columns, optionally
+// with sample rows so the LLM can see how values are formatted.
+type DatabaseSchemaTool struct {
+	conn   *database.Connection
+	filter types.SchemaFilter
+}
+
+// TableSchema describes one table for the LLM.
+type TableSchema struct {
+	Name       string                   `json:"name"`
+	Columns    []database.ColumnInfo    `json:"columns"`
+	SampleRows []map[string]interface{} `json:"sample_rows,omitempty"`
+}
+
+// NewDatabaseSchemaTool creates a new schema description tool instance.
+func NewDatabaseSchemaTool(conn *database.Connection) *DatabaseSchemaTool {
+	return &DatabaseSchemaTool{
+		conn: conn,
+	}
+}
+
+// SetFilter hides the tables and columns the caller may not read.
+func (t *DatabaseSchemaTool) SetFilter(filter types.SchemaFilter) {
+	t.filter = filter
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *DatabaseSchemaTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "database_schema",
+		Description: "Describe the database's tables and columns, with optional sample rows showing how values are formatted. Personal data in samples is masked to its shape and long values are shortened",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"table": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional table to describe (defaults to all tables)",
+				},
+				"sample_rows": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Sample rows to include per table (default %d, max %d)", t.conn.Config.SchemaSampleRows, database.MaxSampleRows),
+				},
+			},
+		},
+	}
+}
+
+// Validate checks the optional table name and that sample_rows is in range.
+func (t *DatabaseSchemaTool) Validate(input map[string]interface{}) error {
+	if raw, exists := input["table"]; exists {
+		if table, ok := raw.(string); !ok || table == "" {
+			return fmt.Errorf("table must be a non-empty string")
+		}
+	}
+
+	if raw, exists := input["sample_rows"]; exists {
+		n, ok := raw.(float64)
+		if !ok || n < 0 || n > database.MaxSampleRows {
+			return fmt.Errorf("sample_rows must be an integer between 0 and %d", database.MaxSampleRows)
+		}
+	}
+
+	return nil
+}
+
+// Execute describes the requested table, or every table the caller may
+// read, and returns the descriptions as JSON.
+func (t *DatabaseSchemaTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	conn := t.conn.For(ctx)
+	samples := conn.Config.SchemaSampleRows
+	if n, ok := input["sample_rows"].(float64); ok {
+		samples = int(n)
+	}
+
+	schema, err := conn.Schema(ctx)
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+
+	var tables []string
+	if table, ok := input["table"].(string); ok {
+		if _, exists := schema.Columns[table]; !exists || !t.tableVisible(ctx, table) {
+			return validationErrorResult(fmt.Sprintf("table %q does not exist", table)), nil
+		}
+		tables = []string{table}
+	} else {
+		for _, name := range schema.Tables {
+			if t.tableVisible(ctx, name) {
+				tables = append(tables, name)
+			}
+		}
+	}
+
+	schemas := make([]TableSchema, 0, len(tables))
+	for _, table := range tables {
+		visible := []database.ColumnInfo{}
+		for _, col := range schema.Columns[table] {
+			if t.filter == nil || t.filter.ColumnVisible(ctx, table, col.Name) {
+				visible = append(visible, col)
+			}
+		}
+
+		described := TableSchema{Name: table, Columns: visible}
+		if described.SampleRows, err = conn.SampleRows(ctx, table, visible, samples); err != nil {
+			return queryErrorResult(err), nil
+		}
+		schemas = append(schemas, described)
+	}
+
+	jsonData, _ := json.MarshalIndent(map[string]interface{}{"tables": schemas}, "", "  ")
+
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
+
+// tableVisible reports whether the caller may read table.
+func (t *DatabaseSchemaTool) tableVisible(ctx context.Context, table string) bool {
+	return t.filter == nil || t.filter.TableVisible(ctx, table)
+}
@@ -0,0 +1,203 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/semantic"
+	"data-chatter/internal/types"
+)
+
+const (
+	// defaultSemanticLimit and maxSemanticLimit bound the rows one
+	// semantic_search call returns.
+	defaultSemanticLimit = 10
+	maxSemanticLimit     = 50
+
+	// maxSemanticText bounds the text shown for each matched row.
+	maxSemanticText = 500
+)
+
+// SemanticSearchTool finds rows whose indexed text columns are about a
+// phrase, for questions keywords miss, such as "contacts who mentioned
+// plumbing experience".
+type SemanticSearchTool struct {
+	conn    *database.Connection
+	columns []semantic.Column
+	index   *semantic.Index
+	filter  types.SchemaFilter
+}
+
+// NewSemanticSearchTool creates a new semantic search tool instance. Its
+// calls fail until SetIndex is called.
+func NewSemanticSearchTool(conn *database.Connection) *SemanticSearchTool {
+	return &SemanticSearchTool{conn: conn}
+}
+
+// SetColumns sets the indexed columns the tool's definition names. It must
+// be called before the tool is registered.
+func (t *SemanticSearchTool) SetColumns(columns []semantic.Column) {
+	t.columns = columns
+}
+
+// SetIndex sets the index searched.
+func (t *SemanticSearchTool) SetIndex(index *semantic.Index) {
+	t.index = index
+}
+
+// SetFilter leaves out the indexed columns the caller may not read.
+func (t *SemanticSearchTool) SetFilter(filter types.SchemaFilter) {
+	t.filter = filter
+}
+
+// GetDefinition returns the tool definition for LLM integration, naming
+// the indexed columns.
+func (t *SemanticSearchTool) GetDefinition() types.ToolDefinition {
+	description := "Find rows whose text is about a phrase, by the similarity of embeddings rather than exact keywords, e.g. contacts whose notes mention plumbing experience. Returns each matching row's table, primary key, similarity from 0 to 1, and text, most similar first; look the rows up with database_query by their keys for other columns. Weak similarities may be unrelated"
+	if len(t.columns) > 0 {
+		names := make([]string, len(t.columns))
+		for i, column := range t.columns {
+			names[i] = column.String()
+		}
+		description += ". Indexed columns: " + strings.Join(names, ", ")
+	}
+
+	return types.ToolDefinition{
+		Name:        "semantic_search",
+		Description: description,
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"phrase": map[string]interface{}{
+					"type":        "string",
+					"description": "What the text should be about, e.g. plumbing experience",
+				},
+				"table": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional table to search; omit to search every indexed column",
+				},
+				"column": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional indexed column of table to search",
+				},
+				"limit": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Rows to return (default %d, max %d)", defaultSemanticLimit, maxSemanticLimit),
+				},
+			},
+			"required": []string{"phrase"},
+		},
+	}
+}
+
+// Validate checks the phrase, the optional table and column, and that
+// limit is in range.
+func (t *SemanticSearchTool) Validate(input map[string]interface{}) error {
+	phrase, ok := input["phrase"].(string)
+	if !ok || strings.TrimSpace(phrase) == "" {
+		return fmt.Errorf("phrase is required and must be a non-empty string")
+	}
+	for _, name := range []string{"table", "column"} {
+		if raw, exists := input[name]; exists {
+			if value, ok := raw.(string); !ok || value == "" {
+				return fmt.Errorf("%s must be a non-empty string", name)
+			}
+		}
+	}
+	if _, hasColumn := input["column"]; hasColumn {
+		if _, hasTable := input["table"]; !hasTable {
+			return fmt.Errorf("column needs table")
+		}
+	}
+	if raw, exists := input["limit"]; exists {
+		n, ok := raw.(float64)
+		if !ok || n < 1 || n > maxSemanticLimit || n != math.Trunc(n) {
+			return fmt.Errorf("limit must be an integer between 1 and %d", maxSemanticLimit)
+		}
+	}
+	return nil
+}
+
+// Execute searches the indexed columns the caller may read and returns
+// the matches as a table. Masked columns' text is masked as in query
+// results.
+func (t *SemanticSearchTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	if t.index == nil {
+		return nil, errors.New("semantic search is unavailable")
+	}
+	// The index holds the server's own database, not a tenant's or a
+	// session's
+	conn := t.conn.For(ctx)
+	if conn != t.conn {
+		return validationErrorResult("semantic search is only available on the default database"), nil
+	}
+
+	table, _ := input["table"].(string)
+	name, _ := input["column"].(string)
+	var columns []semantic.Column
+	for _, column := range t.index.Columns() {
+		if (table != "" && column.Table != table) || (name != "" && column.Name != name) {
+			continue
+		}
+		if t.filter == nil || t.filter.ColumnVisible(ctx, column.Table, column.Name) {
+			columns = append(columns, column)
+		}
+	}
+	if len(columns) == 0 {
+		if table != "" {
+			return validationErrorResult(fmt.Sprintf("no indexed column matches %q; indexed columns are listed in the tool description", strings.TrimSuffix(table+"."+name, "."))), nil
+		}
+		return validationErrorResult("no indexed column is accessible"), nil
+	}
+
+	limit := defaultSemanticLimit
+	if n, ok := input["limit"].(float64); ok {
+		limit = int(n)
+	}
+	phrase := strings.TrimSpace(input["phrase"].(string))
+	matches, err := t.index.Search(ctx, phrase, columns, limit)
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+
+	masked := conn.Masker.Applies(ctx)
+	data := make([]map[string]interface{}, len(matches))
+	for i, match := range matches {
+		var key, text interface{} = match.Key, truncate(match.Text, maxSemanticText)
+		if masked && conn.Masker.Masks(match.KeyColumn) {
+			key = database.MaskValue(key)
+		}
+		if masked && conn.Masker.Masks(match.Name) {
+			text = database.MaskValue(text)
+		}
+		data[i] = map[string]interface{}{
+			"table":      match.Table,
+			"column":     match.Name,
+			"key_column": match.KeyColumn,
+			"key":        key,
+			"similarity": math.Round(match.Similarity*1000) / 1000,
+			"text":       text,
+		}
+	}
+
+	jsonData, _ := json.MarshalIndent(map[string]interface{}{
+		"phrase":    phrase,
+		"model":     t.index.Model(),
+		"columns":   []string{"table", "column", "key_column", "key", "similarity", "text"},
+		"data":      data,
+		"row_count": len(data),
+	}, "", "  ")
+
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
@@ -0,0 +1,254 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"data-chatter/internal/database"
+	"data-chatter/internal/dictionary"
+	"data-chatter/internal/render"
+	"data-chatter/internal/types"
+)
+
+const (
+	defaultViolationExamples = 10
+	maxViolationExamples     = 50
+)
+
+// ColumnValidateTool checks a column's values against the accepted values or
+// pattern declared for it in COLUMN_RULES, or given in the call, and reports
+// the values that break the rule, answering questions like "are there any
+// invalid phone numbers?".
+type ColumnValidateTool struct {
+	conn *database.Connection
+
+	mu    sync.RWMutex
+	rules []dictionary.Rule
+}
+
+// ColumnValidation is the outcome of checking one column against a rule.
+type ColumnValidation struct {
+	Table           string          `json:"table"`
+	Column          string          `json:"column"`
+	Rule            dictionary.Rule `json:"rule"`
+	CheckedRows     int64           `json:"checked_rows"`
+	NullRows        int64           `json:"null_rows"`
+	ViolatingRows   int64           `json:"violating_rows"`
+	DistinctInvalid int             `json:"distinct_invalid_values"`
+	Examples        []ValueCount    `json:"examples"` // The most frequent invalid values
+}
+
+// NewColumnValidateTool creates a new column validation tool instance.
+func NewColumnValidateTool(conn *database.Connection) *ColumnValidateTool {
+	return &ColumnValidateTool{
+		conn: conn,
+	}
+}
+
+// SetRules sets the declared column rules.
+func (t *ColumnValidateTool) SetRules(rules []dictionary.Rule) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rules = rules
+}
+
+// GetDefinition returns the tool definition for LLM integration.
+func (t *ColumnValidateTool) GetDefinition() types.ToolDefinition {
+	return types.ToolDefinition{
+		Name:        "column_validate",
+		Description: "Check a column's values against its declared accepted values or pattern (or ones you give) and report how many rows break the rule, with the most frequent invalid values. Use it for data-quality questions like \"are there any invalid phone numbers?\"",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"table": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the table",
+				},
+				"column": map[string]interface{}{
+					"type":        "string",
+					"description": "Column to check; uses the rule declared for it unless accepted_values or pattern is given",
+				},
+				"accepted_values": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": "Optional list of valid values, overriding the declared rule",
+				},
+				"pattern": map[string]interface{}{
+					"type":        "string",
+					"description": "Optional regular expression valid values match (RE2 syntax), overriding the declared rule",
+				},
+				"examples": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("Number of invalid values to report (default %d, max %d)", defaultViolationExamples, maxViolationExamples),
+				},
+			},
+			"required": []string{"table", "column"},
+		},
+	}
+}
+
+// Validate checks the table and column names, the override rule, and the
+// number of examples.
+func (t *ColumnValidateTool) Validate(input map[string]interface{}) error {
+	table, ok := input["table"].(string)
+	if !ok || table == "" {
+		return fmt.Errorf("table must be a non-empty string")
+	}
+	column, ok := input["column"].(string)
+	if !ok || column == "" {
+		return fmt.Errorf("column must be a non-empty string")
+	}
+
+	if raw, exists := input["examples"]; exists {
+		n, ok := raw.(float64)
+		if !ok || n < 1 || n > maxViolationExamples {
+			return fmt.Errorf("examples must be an integer between 1 and %d", maxViolationExamples)
+		}
+	}
+
+	rule, declared, err := t.rule(input)
+	if err != nil {
+		return err
+	}
+	if !declared && len(rule.AcceptedValues) == 0 && rule.Pattern == "" {
+		return fmt.Errorf("no rule is declared for %s.%s; give accepted_values or a pattern", table, column)
+	}
+	_, err = rule.Check()
+	return err
+}
+
+// Execute scans the column's distinct values and counts those that break
+// the rule. Values are matched as text, the way they render in results.
+func (t *ColumnValidateTool) Execute(ctx context.Context, input map[string]interface{}) (*types.ToolResult, error) {
+	rule, _, err := t.rule(input)
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+	pattern, err := rule.Check()
+	if err != nil {
+		return validationErrorResult(err.Error()), nil
+	}
+
+	examples := defaultViolationExamples
+	if n, ok := input["examples"].(float64); ok {
+		examples = int(n)
+	}
+
+	exists, err := t.conn.For(ctx).HasTable(ctx, rule.Table)
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+	if !exists {
+		return validationErrorResult(fmt.Sprintf("table %q does not exist", rule.Table)), nil
+	}
+
+	columns, err := t.conn.For(ctx).TableColumns(ctx, rule.Table)
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+	if !slices.ContainsFunc(columns, func(c database.ColumnInfo) bool { return c.Name == rule.Column }) {
+		return validationErrorResult(fmt.Sprintf("column %q does not exist in table %q", rule.Column, rule.Table)), nil
+	}
+
+	validation, err := t.check(ctx, rule, pattern, examples)
+	if err != nil {
+		return queryErrorResult(err), nil
+	}
+
+	jsonData, _ := json.MarshalIndent(validation, "", "  ")
+	return &types.ToolResult{
+		Content: []types.ToolContent{{
+			Type: "text",
+			Text: string(jsonData),
+		}},
+		IsError: false,
+	}, nil
+}
+
+// check counts the rows whose value in the rule's column breaks it.
+func (t *ColumnValidateTool) check(ctx context.Context, rule dictionary.Rule, pattern *regexp.Regexp, examples int) (*ColumnValidation, error) {
+	conn := t.conn.For(ctx)
+	quotedColumn := conn.Config.QuoteIdentifier(rule.Column)
+	query := fmt.Sprintf("SELECT %[1]s, COUNT(*) FROM %[2]s GROUP BY %[1]s", quotedColumn, conn.Config.QuoteIdentifier(rule.Table))
+	rows, err := conn.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s.%s: %w", rule.Table, rule.Column, err)
+	}
+	defer rows.Close()
+
+	validation := &ColumnValidation{Table: rule.Table, Column: rule.Column, Rule: rule, Examples: []ValueCount{}}
+	var invalid []ValueCount
+	for rows.Next() {
+		var value interface{}
+		var count int64
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan %s.%s: %w", rule.Table, rule.Column, err)
+		}
+		validation.CheckedRows += count
+		if value == nil {
+			validation.NullRows += count
+			continue
+		}
+
+		text := render.Cell(normalizeValue(value), render.NullsNull)
+		valid := slices.Contains(rule.AcceptedValues, text)
+		if pattern != nil {
+			valid = pattern.MatchString(text)
+		}
+		if !valid {
+			validation.ViolatingRows += count
+			invalid = append(invalid, ValueCount{Value: text, Count: count})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read %s.%s: %w", rule.Table, rule.Column, err)
+	}
+
+	sort.SliceStable(invalid, func(i, j int) bool { return invalid[i].Count > invalid[j].Count })
+	validation.DistinctInvalid = len(invalid)
+	validation.Examples = append(validation.Examples, invalid[:min(examples, len(invalid))]...)
+	return validation, nil
+}
+
+// rule returns the rule the call checks: accepted_values or pattern from the
+// input when given, otherwise the rule declared for the column. declared
+// reports whether one was.
+func (t *ColumnValidateTool) rule(input map[string]interface{}) (rule dictionary.Rule, declared bool, err error) {
+	table, _ := input["table"].(string)
+	column, _ := input["column"].(string)
+	rule = dictionary.Rule{Table: table, Column: column}
+
+	rawValues, hasValues := input["accepted_values"]
+	pattern, hasPattern := input["pattern"].(string)
+	if hasValues || hasPattern {
+		values, ok := rawValues.([]interface{})
+		if hasValues && !ok {
+			return rule, false, fmt.Errorf("accepted_values must be an array of strings")
+		}
+		for _, raw := range values {
+			value, ok := raw.(string)
+			if !ok {
+				return rule, false, fmt.Errorf("accepted_values must be an array of strings")
+			}
+			rule.AcceptedValues = append(rule.AcceptedValues, value)
+		}
+		rule.Pattern = pattern
+		return rule, false, nil
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	for _, declaredRule := range t.rules {
+		if strings.EqualFold(declaredRule.Table, table) && strings.EqualFold(declaredRule.Column, column) {
+			declaredRule.Table, declaredRule.Column = table, column
+			return declaredRule, true, nil
+		}
+	}
+	return rule, false, nil
+}
@@ -0,0 +1,79 @@
+package types
+
+import "context"
+
+// Keys of ToolCall.Metadata understood by the tool engine.
+const (
+	MetadataUserID         = "user_id"
+	MetadataConversationID = "conversation_id"
+	MetadataTurnID         = "turn_id"
+	MetadataTraceID        = "trace_id"
+	MetadataLocale         = "locale"
+	MetadataCacheControl   = "cache_control"
+	MetadataDatabase       = "database"
+)
+
+// CallContext is the request-scoped context of a tool call: who is calling,
+// from which conversation and turn, under which trace, and in what locale.
+// The engine attaches it to the context every tool executes with, so tools
+// can tailor their behavior to the caller deep in the execution path.
+type CallContext struct {
+	UserID         string
+	Roles          []string
+	ConversationID string
+	TurnID         string
+	TraceID        string
+	Locale         string // BCP 47 language tag, e.g. "en-US"
+	CacheControl   string // Cache-Control directives for the query result cache, e.g. "no-cache"
+	Database       string // Named database from DATABASES_FILE the call runs on; "" for the default
+}
+
+type callContextKey struct{}
+
+// WithCallContext returns a copy of ctx carrying cc.
+func WithCallContext(ctx context.Context, cc CallContext) context.Context {
+	return context.WithValue(ctx, callContextKey{}, cc)
+}
+
+// CallContextFrom returns the CallContext in ctx, or the zero value.
+func CallContextFrom(ctx context.Context) CallContext {
+	cc, _ := ctx.Value(callContextKey{}).(CallContext)
+	return cc
+}
+
+// CallContextFromMetadata reads the known keys of a tool call's metadata.
+// Values that are not strings are ignored.
+func CallContextFromMetadata(metadata map[string]interface{}) CallContext {
+	value := func(key string) string {
+		s, _ := metadata[key].(string)
+		return s
+	}
+	return CallContext{
+		UserID:         value(MetadataUserID),
+		ConversationID: value(MetadataConversationID),
+		TurnID:         value(MetadataTurnID),
+		TraceID:        value(MetadataTraceID),
+		Locale:         value(MetadataLocale),
+		CacheControl:   value(MetadataCacheControl),
+		Database:       value(MetadataDatabase),
+	}
+}
+
+// Metadata returns cc as tool call metadata, leaving out empty fields.
+func (cc CallContext) Metadata() map[string]interface{} {
+	metadata := make(map[string]interface{})
+	for key, value := range map[string]string{
+		MetadataUserID:         cc.UserID,
+		MetadataConversationID: cc.ConversationID,
+		MetadataTurnID:         cc.TurnID,
+		MetadataTraceID:        cc.TraceID,
+		MetadataLocale:         cc.Locale,
+		MetadataCacheControl:   cc.CacheControl,
+		MetadataDatabase:       cc.Database,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+	return metadata
+}
@@ -0,0 +1,144 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"github.com/santhosh-tekuri/jsonschema/v6/kind"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+// FieldError is one way a tool call's input breaks its tool's input
+// schema. Field is the path to the offending value, such as "limit" or
+// "sources[1].query", or "input" for the input as a whole.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// InputError is a tool call input that does not match its tool's input
+// schema.
+type InputError struct {
+	Fields []FieldError
+}
+
+// Error lists the offending fields.
+func (e *InputError) Error() string {
+	parts := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		parts[i] = field.Field + ": " + field.Message
+	}
+	return "invalid input: " + strings.Join(parts, "; ")
+}
+
+var printer = message.NewPrinter(language.English)
+
+// compileSchema compiles a tool's declared input schema. Schemas are
+// written as Go maps and slices, so they are round-tripped through JSON
+// into the values the compiler expects.
+func compileSchema(name string, schema map[string]interface{}) (*jsonschema.Schema, error) {
+	doc, err := toJSONValue(schema)
+	if err != nil {
+		return nil, fmt.Errorf("tool %s: input schema: %w", name, err)
+	}
+	url := "tool://" + name + "/input_schema.json"
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource(url, doc); err != nil {
+		return nil, fmt.Errorf("tool %s: input schema: %w", name, err)
+	}
+	compiled, err := compiler.Compile(url)
+	if err != nil {
+		return nil, fmt.Errorf("tool %s: input schema: %w", name, err)
+	}
+	return compiled, nil
+}
+
+// validateInput checks input against a compiled input schema, returning an
+// *InputError listing every offending field.
+func validateInput(schema *jsonschema.Schema, input map[string]interface{}) error {
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+	value, err := toJSONValue(input)
+	if err != nil {
+		return &InputError{Fields: []FieldError{{Field: "input", Message: err.Error()}}}
+	}
+	err = schema.Validate(value)
+	var invalid *jsonschema.ValidationError
+	if !errors.As(err, &invalid) {
+		return err
+	}
+
+	var fields []FieldError
+	collectFieldErrors(invalid, &fields)
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].Field < fields[j].Field })
+	return &InputError{Fields: fields}
+}
+
+// collectFieldErrors adds the leaf errors under e to fields. A missing
+// required property is reported at the property's own path.
+func collectFieldErrors(e *jsonschema.ValidationError, fields *[]FieldError) {
+	if len(e.Causes) > 0 {
+		for _, cause := range e.Causes {
+			collectFieldErrors(cause, fields)
+		}
+		return
+	}
+	if required, ok := e.ErrorKind.(*kind.Required); ok {
+		for _, missing := range required.Missing {
+			*fields = append(*fields, FieldError{Field: fieldPath(append(slices.Clone(e.InstanceLocation), missing)), Message: "is required"})
+		}
+		return
+	}
+	*fields = append(*fields, FieldError{Field: fieldPath(e.InstanceLocation), Message: e.ErrorKind.LocalizedString(printer)})
+}
+
+// fieldPath renders an instance location such as ["sources", "1",
+// "query"] as "sources[1].query".
+func fieldPath(location []string) string {
+	if len(location) == 0 {
+		return "input"
+	}
+	var b strings.Builder
+	for i, token := range location {
+		if isIndex(token) && i > 0 {
+			b.WriteString("[" + token + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(token)
+	}
+	return b.String()
+}
+
+// isIndex reports whether token is an array index.
+func isIndex(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, c := range token {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// toJSONValue converts v to the plain JSON values the schema library
+// works on, with numbers kept exact.
+func toJSONValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return jsonschema.UnmarshalJSON(bytes.NewReader(data))
+}
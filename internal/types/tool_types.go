@@ -1,7 +1,14 @@
 package types
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
 )
 
 // ToolCall represents a tool call request from Claude
@@ -13,13 +20,15 @@ type ToolCall struct {
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
-// ToolResult represents the result of a tool execution
+// ToolResult represents the result of a tool execution.
+// RequestID identifies the HTTP request that ran the tool.
 type ToolResult struct {
-	ID      string        `json:"id"`
-	Content []ToolContent `json:"content"`
-	IsError bool          `json:"is_error"`
-	Error   *ToolError    `json:"error,omitempty"`
-	Usage   *ToolUsage    `json:"usage,omitempty"`
+	ID        string        `json:"id"`
+	Content   []ToolContent `json:"content"`
+	IsError   bool          `json:"is_error"`
+	Error     *ToolError    `json:"error,omitempty"`
+	Usage     *ToolUsage    `json:"usage,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
 }
 
 // ToolContent represents content in a tool result
@@ -29,10 +38,48 @@ type ToolContent struct {
 	Data interface{} `json:"data,omitempty"`
 }
 
-// ToolError represents an error in tool execution
+// ToolError represents an error in tool execution, in the shape of the API's
+// error envelope. Code is one of the stable Error* codes, so the LLM and API
+// clients can branch on it; DriverCode is the database's own code when the
+// error came from the driver (a SQLSTATE for PostgreSQL, an error number for
+// MySQL, an extended result code for SQLite). Retryable reports whether the
+// same call may succeed if repeated.
 type ToolError struct {
-	Type    string `json:"type"`
-	Message string `json:"message"`
+	Code       string      `json:"code"`
+	Message    string      `json:"message"`
+	Details    interface{} `json:"details,omitempty"`
+	DriverCode string      `json:"driver_code,omitempty"`
+	Retryable  bool        `json:"retryable"`
+}
+
+// Stable tool error codes.
+const (
+	ErrorValidation       = "validation_error"     // The tool input was rejected before running
+	ErrorPermissionDenied = "permission_denied"    // Access control or the database refused the query
+	ErrorSyntax           = "syntax_error"         // The SQL could not be parsed
+	ErrorUndefinedObject  = "undefined_object"     // A referenced table, column, or function does not exist
+	ErrorTimeout          = "timeout"              // The query or turn ran out of time
+	ErrorCancelled        = "cancelled"            // The caller cancelled the query
+	ErrorTooManyRows      = "too_many_rows"        // The result exceeded the configured row cap
+	ErrorResourceLimit    = "resource_limit"       // The query hit a memory, size, or step limit, or its plan was too expensive
+	ErrorLockConflict     = "lock_conflict"        // A lock, deadlock, or serialization conflict
+	ErrorConnection       = "connection_error"     // The database or an external tool's service could not be reached
+	ErrorUnavailable      = "database_unavailable" // Repeated connection failures opened the circuit breaker
+	ErrorQuery            = "query_error"          // Any other database failure
+	ErrorExecution        = "execution_error"      // The tool failed outside the database
+	ErrorToolDisabled     = "tool_disabled"        // An operator disabled the tool at runtime
+)
+
+// IsRetryable reports whether errors with the given code are transient:
+// timeouts, lock conflicts, and lost connections. Everything else fails the
+// same way on every attempt.
+func IsRetryable(code string) bool {
+	switch code {
+	case ErrorTimeout, ErrorLockConflict, ErrorConnection:
+		return true
+	default:
+		return false
+	}
 }
 
 // ToolUsage represents usage statistics for a tool
@@ -48,9 +95,13 @@ type ToolDefinition struct {
 	InputSchema map[string]interface{} `json:"input_schema"`
 }
 
-// ToolExecutionRequest represents a request to execute tools
+// ToolExecutionRequest represents a request to execute tools. With Async
+// set, the calls are queued as a background job instead, and the finished
+// job is POSTed to CallbackURL when one is given.
 type ToolExecutionRequest struct {
-	Tools []ToolCall `json:"tools"`
+	Tools       []ToolCall `json:"tools"`
+	Async       bool       `json:"async,omitempty"`
+	CallbackURL string     `json:"callback_url,omitempty"`
 }
 
 // ToolExecutionResponse represents the response from tool execution
@@ -62,33 +113,105 @@ type ToolExecutionResponse struct {
 type ToolRegistryEntry struct {
 	Definition ToolDefinition
 	Executor   ToolExecutor
+
+	// schema is Definition.InputSchema compiled; calls are checked
+	// against it before the executor's own Validate.
+	schema *jsonschema.Schema
 }
 
-// ToolExecutor is the interface that all tools must implement
+// ToolExecutor is the interface that all tools must implement.
+// Execute must honor ctx cancellation so a turn's deadline bounds tool work.
 type ToolExecutor interface {
-	Execute(input map[string]interface{}) (*ToolResult, error)
+	Execute(ctx context.Context, input map[string]interface{}) (*ToolResult, error)
 	GetDefinition() ToolDefinition
 	Validate(input map[string]interface{}) error
 }
 
-// ToolRegistry manages available tools
+// Authorizer decides whether the caller in ctx may run a tool with the given input.
+// A non-nil error denies the call.
+type Authorizer interface {
+	Authorize(ctx context.Context, tool string, input map[string]interface{}) error
+}
+
+// SchemaFilter hides the tables and columns the caller in ctx may not read
+// from tools that describe the schema.
+type SchemaFilter interface {
+	TableVisible(ctx context.Context, table string) bool
+	ColumnVisible(ctx context.Context, table, column string) bool
+}
+
+// ToolStatus reports whether a registered tool is enabled.
+type ToolStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+}
+
+// ToolRegistry manages available tools. Tools can be disabled at runtime,
+// which hides them from ListTools and makes calls to them fail.
 type ToolRegistry struct {
-	tools map[string]ToolRegistryEntry
+	tools      map[string]ToolRegistryEntry
+	authorizer Authorizer
+
+	// ExecuteTools settings; see SetConcurrency and SetCallContext.
+	parallelism int
+	callTimeout time.Duration
+	callContext func(ctx context.Context, call ToolCall) context.Context
+
+	// observe is told of every call to a registered tool; see SetObserver.
+	observe func(name string, result *ToolResult, err error, elapsed time.Duration)
+
+	mu       sync.RWMutex
+	disabled map[string]bool
 }
 
 // NewToolRegistry creates a new tool registry
 func NewToolRegistry() *ToolRegistry {
 	return &ToolRegistry{
-		tools: make(map[string]ToolRegistryEntry),
+		tools:       make(map[string]ToolRegistryEntry),
+		parallelism: 1,
+		disabled:    make(map[string]bool),
 	}
 }
 
-// RegisterTool registers a new tool
-func (tr *ToolRegistry) RegisterTool(name string, executor ToolExecutor) {
+// SetConcurrency lets ExecuteTools run up to parallelism calls at once
+// (at least one) and bounds each call to timeout; 0 means no per-call limit.
+func (tr *ToolRegistry) SetConcurrency(parallelism int, timeout time.Duration) {
+	tr.parallelism = max(parallelism, 1)
+	tr.callTimeout = timeout
+}
+
+// SetCallContext installs a function deriving each call's context in
+// ExecuteTools from the batch's, such as to add the call's metadata.
+func (tr *ToolRegistry) SetCallContext(derive func(ctx context.Context, call ToolCall) context.Context) {
+	tr.callContext = derive
+}
+
+// SetObserver installs a function told of the outcome and duration of
+// every call ExecuteTool makes to a registered tool, including calls
+// refused as disabled, forbidden, or invalid.
+func (tr *ToolRegistry) SetObserver(observe func(name string, result *ToolResult, err error, elapsed time.Duration)) {
+	tr.observe = observe
+}
+
+// RegisterTool registers a new tool, compiling its declared input schema.
+// It fails when the schema is not a valid JSON Schema.
+func (tr *ToolRegistry) RegisterTool(name string, executor ToolExecutor) error {
+	definition := executor.GetDefinition()
+	schema, err := compileSchema(name, definition.InputSchema)
+	if err != nil {
+		return err
+	}
 	tr.tools[name] = ToolRegistryEntry{
-		Definition: executor.GetDefinition(),
+		Definition: definition,
 		Executor:   executor,
+		schema:     schema,
 	}
+	return nil
+}
+
+// SetAuthorizer installs an access-control check run before every tool call
+func (tr *ToolRegistry) SetAuthorizer(authorizer Authorizer) {
+	tr.authorizer = authorizer
 }
 
 // GetTool retrieves a tool by name
@@ -97,53 +220,175 @@ func (tr *ToolRegistry) GetTool(name string) (ToolRegistryEntry, bool) {
 	return tool, exists
 }
 
-// ListTools returns all registered tools
+// SetEnabled enables or disables a registered tool.
+func (tr *ToolRegistry) SetEnabled(name string, enabled bool) error {
+	if _, exists := tr.tools[name]; !exists {
+		return fmt.Errorf("tool '%s' not found", name)
+	}
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if enabled {
+		delete(tr.disabled, name)
+	} else {
+		tr.disabled[name] = true
+	}
+	return nil
+}
+
+// Enabled reports whether name is registered and not disabled.
+func (tr *ToolRegistry) Enabled(name string) bool {
+	if _, exists := tr.tools[name]; !exists {
+		return false
+	}
+
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+	return !tr.disabled[name]
+}
+
+// Statuses returns every registered tool with whether it is enabled, sorted by name.
+func (tr *ToolRegistry) Statuses() []ToolStatus {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
+	statuses := make([]ToolStatus, 0, len(tr.tools))
+	for name := range tr.tools {
+		statuses = append(statuses, ToolStatus{Name: name, Enabled: !tr.disabled[name]})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// ListTools returns all enabled tools, sorted by name
 func (tr *ToolRegistry) ListTools() []ToolDefinition {
+	tr.mu.RLock()
+	defer tr.mu.RUnlock()
+
 	definitions := make([]ToolDefinition, 0, len(tr.tools))
-	for _, entry := range tr.tools {
-		definitions = append(definitions, entry.Definition)
+	for name, entry := range tr.tools {
+		if !tr.disabled[name] {
+			definitions = append(definitions, entry.Definition)
+		}
 	}
+	sort.Slice(definitions, func(i, j int) bool { return definitions[i].Name < definitions[j].Name })
 	return definitions
 }
 
 // ExecuteTool executes a tool by name
-func (tr *ToolRegistry) ExecuteTool(name string, input map[string]interface{}) (*ToolResult, error) {
+func (tr *ToolRegistry) ExecuteTool(ctx context.Context, name string, input map[string]interface{}) (result *ToolResult, err error) {
+	if _, exists := tr.GetTool(name); exists && tr.observe != nil {
+		start := time.Now()
+		defer func() { tr.observe(name, result, err, time.Since(start)) }()
+	}
+	if failed, err := tr.CheckTool(ctx, name, input); failed != nil || err != nil {
+		return failed, err
+	}
+
+	// Execute tool
+	entry, _ := tr.GetTool(name)
+	return entry.Executor.Execute(ctx, input)
+}
+
+// CheckTool makes the checks ExecuteTool runs before executing a tool: that
+// it exists and is enabled, that the caller may use it, and that the input
+// is valid, first against the tool's input schema and then by its own
+// Validate. It returns the error result of the first check that fails, or
+// nil when the call would run. Schema violations list every offending
+// field in the error's Details.
+func (tr *ToolRegistry) CheckTool(ctx context.Context, name string, input map[string]interface{}) (*ToolResult, error) {
 	entry, exists := tr.GetTool(name)
 	if !exists {
 		return nil, fmt.Errorf("tool '%s' not found", name)
 	}
+	if !tr.Enabled(name) {
+		return checkFailed(input, ErrorToolDisabled, fmt.Sprintf("tool '%s' is disabled", name), nil), nil
+	}
+
+	// Check access before touching the tool
+	if tr.authorizer != nil {
+		if err := tr.authorizer.Authorize(ctx, name, input); err != nil {
+			return checkFailed(input, ErrorPermissionDenied, err.Error(), nil), nil
+		}
+	}
 
 	// Validate input
+	if entry.schema != nil {
+		if err := validateInput(entry.schema, input); err != nil {
+			var invalid *InputError
+			if errors.As(err, &invalid) {
+				return checkFailed(input, ErrorValidation, err.Error(), invalid.Fields), nil
+			}
+			return checkFailed(input, ErrorValidation, err.Error(), nil), nil
+		}
+	}
 	if err := entry.Executor.Validate(input); err != nil {
-		return &ToolResult{
-			ID:      input["id"].(string),
-			Content: []ToolContent{{Type: "text", Text: fmt.Sprintf("Validation error: %v", err)}},
-			IsError: true,
-			Error:   &ToolError{Type: "validation_error", Message: err.Error()},
-		}, nil
+		return checkFailed(input, ErrorValidation, err.Error(), nil), nil
 	}
 
-	// Execute tool
-	return entry.Executor.Execute(input)
+	return nil, nil
 }
 
-// ExecuteTools executes multiple tools
-func (tr *ToolRegistry) ExecuteTools(toolCalls []ToolCall) []ToolResult {
+// checkFailed returns the error result of a call that failed a check. The
+// call's ID is taken from its input when it carries one.
+func checkFailed(input map[string]interface{}, code, message string, details interface{}) *ToolResult {
+	id, _ := input["id"].(string)
+	text := message
+	if code == ErrorValidation {
+		text = "Validation error: " + message
+	}
+	return &ToolResult{
+		ID:      id,
+		Content: []ToolContent{{Type: "text", Text: text}},
+		IsError: true,
+		Error:   &ToolError{Code: code, Message: message, Details: details},
+	}
+}
+
+// ExecuteTools executes multiple tools concurrently, at most the configured
+// parallelism at a time, and returns their results in the order of toolCalls.
+func (tr *ToolRegistry) ExecuteTools(ctx context.Context, toolCalls []ToolCall) []ToolResult {
 	results := make([]ToolResult, len(toolCalls))
+	slots := make(chan struct{}, max(tr.parallelism, 1))
 
+	var wg sync.WaitGroup
 	for i, toolCall := range toolCalls {
-		result, err := tr.ExecuteTool(toolCall.Name, toolCall.Input)
-		if err != nil {
-			results[i] = ToolResult{
-				ID:      toolCall.ID,
-				Content: []ToolContent{{Type: "text", Text: fmt.Sprintf("Execution error: %v", err)}},
-				IsError: true,
-				Error:   &ToolError{Type: "execution_error", Message: err.Error()},
-			}
-		} else {
-			results[i] = *result
-		}
+		slots <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			results[i] = tr.executeCall(ctx, toolCall)
+		}()
 	}
+	wg.Wait()
 
 	return results
 }
+
+// executeCall runs one call of a batch in its own context, bounded by the
+// per-call timeout, turning a Go error into an error result.
+func (tr *ToolRegistry) executeCall(ctx context.Context, toolCall ToolCall) ToolResult {
+	if tr.callContext != nil {
+		ctx = tr.callContext(ctx, toolCall)
+	}
+	if tr.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, tr.callTimeout)
+		defer cancel()
+	}
+
+	result, err := tr.ExecuteTool(ctx, toolCall.Name, toolCall.Input)
+	if err != nil {
+		return ToolResult{
+			ID:      toolCall.ID,
+			Content: []ToolContent{{Type: "text", Text: fmt.Sprintf("Execution error: %v", err)}},
+			IsError: true,
+			Error:   &ToolError{Code: ErrorExecution, Message: err.Error()},
+		}
+	}
+	if result.ID == "" {
+		result.ID = toolCall.ID
+	}
+	return *result
+}
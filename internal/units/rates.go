@@ -0,0 +1,125 @@
+package units
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateSource supplies currency exchange rates relative to a common base,
+// keyed by upper-case ISO 4217 code. The base currency has rate 1.
+type RateSource interface {
+	Rates(ctx context.Context) (map[string]float64, error)
+}
+
+// ratesDocument is the JSON format read from files and URLs, compatible with
+// common exchange-rate APIs: {"base": "USD", "rates": {"EUR": 0.92, ...}}.
+type ratesDocument struct {
+	Base  string             `json:"base"`
+	Rates map[string]float64 `json:"rates"`
+}
+
+// normalize returns the rates keyed by upper-case code with the base included.
+func (d ratesDocument) normalize() map[string]float64 {
+	rates := make(map[string]float64, len(d.Rates)+1)
+	for code, rate := range d.Rates {
+		rates[strings.ToUpper(code)] = rate
+	}
+	if d.Base != "" {
+		rates[strings.ToUpper(d.Base)] = 1
+	}
+	return rates
+}
+
+// FileRateSource reads exchange rates from a JSON file once.
+type FileRateSource struct {
+	Path string
+
+	once  sync.Once
+	rates map[string]float64
+	err   error
+}
+
+// Rates loads and returns the rates from the file.
+func (f *FileRateSource) Rates(ctx context.Context) (map[string]float64, error) {
+	f.once.Do(func() {
+		data, err := os.ReadFile(f.Path)
+		if err != nil {
+			f.err = fmt.Errorf("failed to read rates file: %w", err)
+			return
+		}
+		var doc ratesDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			f.err = fmt.Errorf("failed to parse rates file: %w", err)
+			return
+		}
+		f.rates = doc.normalize()
+	})
+	return f.rates, f.err
+}
+
+// HTTPRateSource fetches exchange rates from a URL and caches them for TTL.
+type HTTPRateSource struct {
+	URL        string
+	TTL        time.Duration
+	HTTPClient *http.Client
+
+	mu        sync.Mutex
+	rates     map[string]float64
+	fetchedAt time.Time
+}
+
+// Rates returns cached rates, refreshing them from the URL when stale.
+func (h *HTTPRateSource) Rates(ctx context.Context) (map[string]float64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.rates != nil && time.Since(h.fetchedAt) < h.TTL {
+		return h.rates, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rates request: %w", err)
+	}
+
+	resp, err := h.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rates: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("rates request failed with status %d", resp.StatusCode)
+	}
+
+	var doc ratesDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to parse rates: %w", err)
+	}
+
+	h.rates = doc.normalize()
+	h.fetchedAt = time.Now()
+	return h.rates, nil
+}
+
+// RateSourceFromEnv configures a rate source from UNIT_RATES_FILE or
+// UNIT_RATES_URL, returning nil when neither is set.
+func RateSourceFromEnv() RateSource {
+	if path := os.Getenv("UNIT_RATES_FILE"); path != "" {
+		return &FileRateSource{Path: path}
+	}
+	if url := os.Getenv("UNIT_RATES_URL"); url != "" {
+		return &HTTPRateSource{
+			URL:        url,
+			TTL:        time.Hour,
+			HTTPClient: &http.Client{Timeout: 5 * time.Second},
+		}
+	}
+	return nil
+}
@@ -0,0 +1,261 @@
+// Package units converts numeric result columns between units of measure and
+// currencies when a user asks for an answer "in km" or "in EUR".
+package units
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// unit describes a unit of measure relative to its category's base unit.
+type unit struct {
+	Symbol   string
+	Category string
+	Factor   float64 // multiply by Factor to get the base unit
+}
+
+// units lists the supported non-currency units keyed by symbol.
+var units = map[string]unit{
+	"mm": {"mm", "length", 0.001},
+	"cm": {"cm", "length", 0.01},
+	"m":  {"m", "length", 1},
+	"km": {"km", "length", 1000},
+	"in": {"in", "length", 0.0254},
+	"ft": {"ft", "length", 0.3048},
+	"yd": {"yd", "length", 0.9144},
+	"mi": {"mi", "length", 1609.344},
+
+	"g":  {"g", "mass", 0.001},
+	"kg": {"kg", "mass", 1},
+	"t":  {"t", "mass", 1000},
+	"oz": {"oz", "mass", 0.028349523125},
+	"lb": {"lb", "mass", 0.45359237},
+
+	"ml":  {"ml", "volume", 0.001},
+	"l":   {"l", "volume", 1},
+	"gal": {"gal", "volume", 3.785411784},
+
+	"c": {"c", "temperature", 1},
+	"f": {"f", "temperature", 1},
+	"k": {"k", "temperature", 1},
+}
+
+// aliases maps spelled-out unit names to their symbols.
+var aliases = map[string]string{
+	"millimeters": "mm", "millimetres": "mm",
+	"centimeters": "cm", "centimetres": "cm",
+	"meters": "m", "metres": "m", "meter": "m", "metre": "m",
+	"kilometers": "km", "kilometres": "km", "kms": "km",
+	"inches": "in", "inch": "in",
+	"feet": "ft", "foot": "ft",
+	"yards": "yd", "yard": "yd",
+	"miles": "mi", "mile": "mi",
+	"grams": "g", "gram": "g",
+	"kilograms": "kg", "kilos": "kg", "kgs": "kg",
+	"tonnes": "t", "tons": "t",
+	"ounces": "oz", "ounce": "oz",
+	"pounds": "lb", "lbs": "lb",
+	"milliliters": "ml", "millilitres": "ml",
+	"liters": "l", "litres": "l", "liter": "l", "litre": "l",
+	"gallons": "gal", "gallon": "gal",
+	"celsius": "c", "fahrenheit": "f", "kelvin": "k",
+	"dollars": "USD", "euros": "EUR", "yen": "JPY",
+	"$": "USD", "€": "EUR", "£": "GBP", "¥": "JPY",
+}
+
+// targetPattern matches a trailing "in km" / "convert to EUR" request.
+var targetPattern = regexp.MustCompile(`(?i)(?:^|\s)(?:in|to|into)\s+([a-z$€£¥]+)\s*[?.!]*\s*$`)
+
+// followUpPattern matches messages that only ask for a conversion of the previous answer.
+var followUpPattern = regexp.MustCompile(`(?i)^\s*(?:(?:and|now|ok|okay|what about|how about|show (?:that|it|them)|convert (?:that|it|them)?)\s*)*(?:in|to|into)\s+[a-z$€£¥]+\s*[?.!]*\s*$`)
+
+// Conversion records a column that was converted so clients can mark the values.
+type Conversion struct {
+	Column          string  `json:"column"`
+	ConvertedColumn string  `json:"converted_column"`
+	FromUnit        string  `json:"from_unit"`
+	ToUnit          string  `json:"to_unit"`
+	Rate            float64 `json:"rate,omitempty"`
+}
+
+// Converter converts result columns using static unit tables and a currency rate source.
+type Converter struct {
+	rates RateSource
+}
+
+// NewConverter creates a converter. rates may be nil, which disables currency conversion.
+func NewConverter(rates RateSource) *Converter {
+	return &Converter{rates: rates}
+}
+
+// ParseTarget extracts the requested target unit from a message such as
+// "total distance per driver in km". It returns false when no known unit is requested.
+func (c *Converter) ParseTarget(message string) (string, bool) {
+	match := targetPattern.FindStringSubmatch(strings.TrimSpace(message))
+	if match == nil {
+		return "", false
+	}
+	symbol, ok := c.resolve(match[1])
+	return symbol, ok
+}
+
+// IsFollowUp reports whether message only asks to convert the previous answer,
+// e.g. "in EUR" or "what about in miles?".
+func (c *Converter) IsFollowUp(message string) bool {
+	if !followUpPattern.MatchString(message) {
+		return false
+	}
+	_, ok := c.ParseTarget(message)
+	return ok
+}
+
+// resolve normalizes a unit or currency token to its canonical symbol.
+func (c *Converter) resolve(token string) (string, bool) {
+	lower := strings.ToLower(token)
+	if symbol, ok := aliases[lower]; ok {
+		return symbol, true
+	}
+	if symbol, ok := aliases[token]; ok {
+		return symbol, true
+	}
+	if _, ok := units[lower]; ok {
+		return lower, true
+	}
+	if isCurrencyCode(token) {
+		return strings.ToUpper(token), true
+	}
+	return "", false
+}
+
+// isCurrencyCode reports whether token looks like an ISO 4217 code.
+func isCurrencyCode(token string) bool {
+	if len(token) != 3 {
+		return false
+	}
+	for _, r := range token {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// ConvertRows converts every column whose name ends in a unit compatible with
+// target (e.g. "distance_miles", "price_usd"), adding a new column with the
+// converted values next to the original. It returns the conversions applied.
+func (c *Converter) ConvertRows(ctx context.Context, columns []string, rows []map[string]interface{}, target string) ([]string, []Conversion, error) {
+	var conversions []Conversion
+
+	for _, col := range columns {
+		from, ok := c.columnUnit(col)
+		if !ok || from == target {
+			continue
+		}
+
+		convert, rate, err := c.converterFor(ctx, from, target)
+		if err != nil {
+			return columns, conversions, err
+		}
+		if convert == nil {
+			continue
+		}
+
+		converted := convertedColumnName(col, target)
+		for _, row := range rows {
+			switch v := row[col].(type) {
+			case float64:
+				row[converted] = convert(v)
+			case int64:
+				row[converted] = convert(float64(v))
+			default:
+				row[converted] = nil
+			}
+		}
+
+		columns = append(columns, converted)
+		conversions = append(conversions, Conversion{
+			Column:          col,
+			ConvertedColumn: converted,
+			FromUnit:        from,
+			ToUnit:          target,
+			Rate:            rate,
+		})
+	}
+
+	return columns, conversions, nil
+}
+
+// columnUnit infers a column's unit from its last underscore-separated suffix.
+func (c *Converter) columnUnit(column string) (string, bool) {
+	parts := strings.Split(column, "_")
+	if len(parts) < 2 {
+		return "", false
+	}
+	return c.resolve(parts[len(parts)-1])
+}
+
+// converterFor returns a function converting from one unit to another, or nil
+// when the units are not comparable. rate is set for linear conversions.
+func (c *Converter) converterFor(ctx context.Context, from, to string) (func(float64) float64, float64, error) {
+	fromUnit, fromKnown := units[from]
+	toUnit, toKnown := units[to]
+
+	if fromKnown && toKnown {
+		if fromUnit.Category != toUnit.Category {
+			return nil, 0, nil
+		}
+		if fromUnit.Category == "temperature" {
+			return temperatureConverter(from, to), 0, nil
+		}
+		rate := fromUnit.Factor / toUnit.Factor
+		return func(v float64) float64 { return v * rate }, rate, nil
+	}
+
+	if fromKnown || toKnown || !isCurrencyCode(from) || !isCurrencyCode(to) {
+		return nil, 0, nil
+	}
+
+	if c.rates == nil {
+		return nil, 0, fmt.Errorf("currency conversion is not configured (set UNIT_RATES_FILE or UNIT_RATES_URL)")
+	}
+
+	rates, err := c.rates.Rates(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load exchange rates: %w", err)
+	}
+	fromRate, ok := rates[from]
+	if !ok {
+		// Suffixes like "_new" look like currency codes but are not; leave them alone
+		return nil, 0, nil
+	}
+	toRate, ok := rates[to]
+	if !ok {
+		return nil, 0, fmt.Errorf("no exchange rate for %s", to)
+	}
+
+	rate := toRate / fromRate
+	return func(v float64) float64 { return v * rate }, rate, nil
+}
+
+// temperatureConverter converts between Celsius, Fahrenheit, and Kelvin.
+func temperatureConverter(from, to string) func(float64) float64 {
+	toCelsius := map[string]func(float64) float64{
+		"c": func(v float64) float64 { return v },
+		"f": func(v float64) float64 { return (v - 32) * 5 / 9 },
+		"k": func(v float64) float64 { return v - 273.15 },
+	}
+	fromCelsius := map[string]func(float64) float64{
+		"c": func(v float64) float64 { return v },
+		"f": func(v float64) float64 { return v*9/5 + 32 },
+		"k": func(v float64) float64 { return v + 273.15 },
+	}
+	return func(v float64) float64 { return fromCelsius[to](toCelsius[from](v)) }
+}
+
+// convertedColumnName swaps the unit suffix of column for target.
+func convertedColumnName(column, target string) string {
+	base := column[:strings.LastIndex(column, "_")]
+	return base + "_" + strings.ToLower(target)
+}
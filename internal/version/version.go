@@ -0,0 +1,57 @@
+// Package version identifies the running build, so operators can tell
+// which build is serving traffic during a rollout. Version, Commit, and
+// BuildTime are set at build time:
+//
+//	go build -ldflags "-X data-chatter/internal/version.Version=v1.4.0 \
+//	  -X data-chatter/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X data-chatter/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/server
+package version
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// Set with -ldflags -X at build time.
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = ""
+)
+
+// Info describes the running build.
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// Get returns the running build's version. Without ldflags, the commit and
+// build time come from the VCS stamp go build embeds, when there is one.
+func Get() Info {
+	info := Info{
+		Version:   Version,
+		Commit:    Commit,
+		BuildTime: BuildTime,
+		GoVersion: runtime.Version(),
+	}
+	build, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	settings := make(map[string]string, len(build.Settings))
+	for _, setting := range build.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	if info.Commit == "" && settings["vcs.revision"] != "" {
+		info.Commit = settings["vcs.revision"]
+		if settings["vcs.modified"] == "true" {
+			info.Commit += "-dirty"
+		}
+	}
+	if info.BuildTime == "" {
+		info.BuildTime = settings["vcs.time"]
+	}
+	return info
+}
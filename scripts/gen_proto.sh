@@ -0,0 +1,13 @@
+#!/bin/bash
+# Regenerates the gRPC code in internal/gen from proto/.
+# Requires protoc, protoc-gen-go, and protoc-gen-go-grpc on PATH:
+#   go install google.golang.org/protobuf/cmd/protoc-gen-go@latest
+#   go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.5.1
+
+set -euo pipefail
+cd "$(dirname "$0")/.."
+
+protoc -I proto \
+    --go_out=. --go_opt=module=data-chatter \
+    --go-grpc_out=. --go-grpc_opt=module=data-chatter \
+    proto/datachatter/v1/datachatter.proto
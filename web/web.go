@@ -0,0 +1,17 @@
+// Package web holds the static web UI, embedded in the server binary and
+// served at /ui/.
+package web
+
+import (
+	"embed"
+	"net/http"
+)
+
+//go:embed index.html
+var assets embed.FS
+
+// Handler serves the web UI under prefix, such as "/ui/". The UI calls the
+// API on the same origin, so it needs no proxy or CORS.
+func Handler(prefix string) http.Handler {
+	return http.StripPrefix(prefix, http.FileServer(http.FS(assets)))
+}